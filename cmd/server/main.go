@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,6 +15,7 @@ import (
 	"github.com/genc-murat/crystalcache/internal/cache"
 	"github.com/genc-murat/crystalcache/internal/config"
 	"github.com/genc-murat/crystalcache/internal/pool"
+	"github.com/genc-murat/crystalcache/internal/prometheus"
 	"github.com/genc-murat/crystalcache/internal/server"
 	"github.com/genc-murat/crystalcache/internal/storage"
 )
@@ -40,11 +40,16 @@ func main() {
 	// Initialize cache
 	memCache := cache.NewMemoryCache()
 	memCache.StartDefragmentation(cfg.Cache.DefragInterval, cfg.Cache.DefragThreshold)
+	if cfg.Cache.MaxMemory > 0 {
+		memCache.SetMemoryLimit(cfg.Cache.MaxMemory)
+	}
+	memCache.SetListConfig(cfg.Cache.ListMaxListpackSize, cfg.Cache.ListCompressDepth)
 
 	// Initialize storage
 	aofConfig := storage.DefaultAOFConfig()
 	aofConfig.Path = cfg.Storage.Path
 	aofConfig.SyncInterval = cfg.Storage.SyncInterval
+	aofConfig.SyncStrategy = cfg.Storage.SyncStrategy
 
 	aofStorage, err := storage.NewAOF(aofConfig)
 	if err != nil {
@@ -52,15 +57,46 @@ func main() {
 	}
 	defer aofStorage.Close()
 
+	// Runtime parameters for CONFIG GET/SET; the server binds its own
+	params := config.NewRegistry(cfg)
+	params.OnChange("appendfsync", func(c *config.Config) error {
+		return aofStorage.SetSyncStrategy(c.Storage.SyncStrategy)
+	})
+	defrag := func(c *config.Config) error {
+		memCache.SetDefragConfig(c.Cache.DefragInterval, c.Cache.DefragThreshold)
+		return nil
+	}
+	params.OnChange("active-defrag-interval", defrag)
+	params.OnChange("active-defrag-threshold", defrag)
+	params.OnChange("maxmemory", func(c *config.Config) error {
+		memCache.SetMemoryLimit(c.Cache.MaxMemory)
+		return nil
+	})
+	lists := func(c *config.Config) error {
+		memCache.SetListConfig(c.Cache.ListMaxListpackSize, c.Cache.ListCompressDepth)
+		return nil
+	}
+	params.OnChange("list-max-listpack-size", lists)
+	params.OnChange("list-compress-depth", lists)
+
 	// Initialize server
 	serverConfig := server.ServerConfig{
-		MaxConnections: cfg.Server.MaxConnections,
-		ReadTimeout:    cfg.Server.ReadTimeout,
-		WriteTimeout:   cfg.Server.WriteTimeout,
-		IdleTimeout:    cfg.Server.IdleTimeout,
+		MaxConnections:          cfg.Server.MaxConnections,
+		ReadTimeout:             cfg.Server.ReadTimeout,
+		WriteTimeout:            cfg.Server.WriteTimeout,
+		IdleTimeout:             cfg.Server.IdleTimeout,
+		SlowLogSlowerThan:       cfg.SlowLog.LogSlowerThan,
+		SlowLogMaxLen:           cfg.SlowLog.MaxLen,
+		LatencyMonitorThreshold: cfg.Latency.MonitorThreshold,
+		NotifyKeyspaceEvents:    cfg.Cache.NotifyKeyspaceEvents,
+		Params:                  params,
 	}
 
 	server := server.NewServer(memCache, aofStorage, nil, serverConfig)
+	memCache.SetLatencyMonitor(server.LatencyMonitor())
+	memCache.SetPublisher(server.Publish)
+	memCache.SetKeyspaceNotifier(server.NotifyKeyspaceEvent)
+	aofStorage.SetLatencyMonitor(server.LatencyMonitor())
 	server.SetMaster(true)
 	go server.Start(fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port))
 	time.Sleep(1 * time.Second)
@@ -88,10 +124,7 @@ func main() {
 	// Start metrics server if enabled
 	if cfg.Metrics.Enabled {
 		go func() {
-			http.HandleFunc(cfg.Metrics.Path, func(w http.ResponseWriter, r *http.Request) {
-				metrics := server.GetMetrics()
-				json.NewEncoder(w).Encode(metrics)
-			})
+			http.Handle(cfg.Metrics.Path, server.MetricsHandler())
 			log.Printf("Metrics server starting on :%d", cfg.Metrics.Port)
 			if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Metrics.Port), nil); err != nil {
 				log.Printf("Metrics server error: %v", err)
@@ -99,6 +132,19 @@ func main() {
 		}()
 	}
 
+	// Start Prometheus remote storage server if enabled
+	if cfg.Prometheus.Enabled {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle(cfg.Prometheus.WritePath, prometheus.WriteHandler(memCache, server.LogWrite))
+			mux.Handle(cfg.Prometheus.ReadPath, prometheus.ReadHandler(memCache))
+			log.Printf("Prometheus remote storage server starting on :%d", cfg.Prometheus.Port)
+			if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Prometheus.Port), mux); err != nil {
+				log.Printf("Prometheus remote storage server error: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -2,9 +2,21 @@ package bitmap
 
 import (
 	"fmt"
+	"math"
 	"sync"
 )
 
+// A bitmap is stored as flat bytes, or as a *Roaring bitmap once SETBIT
+// would grow it past flatMaxLen bytes or an R.* command writes it. Roaring
+// bitmaps are modified in place, so they are only accessed under the lock
+// of their key.
+const (
+	flatMaxLen = 64 << 10
+
+	// MaxOffset is the highest bit offset of a bitmap
+	MaxOffset = math.MaxUint32
+)
+
 // BasicOps handles basic bitmap operations
 type BasicOps struct {
 	cache      *sync.Map
@@ -33,6 +45,16 @@ func (b *BasicOps) GetBit(key string, offset int64) (int, error) {
 		return 0, nil
 	}
 
+	if _, ok := val.(*Roaring); ok {
+		bit := 0
+		b.view(key, func(r *Roaring) {
+			if offset <= MaxOffset && r.Contains(uint32(offset)) {
+				bit = 1
+			}
+		})
+		return bit, nil
+	}
+
 	valBytes, ok := val.([]byte)
 	if !ok {
 		return 0, fmt.Errorf("ERR invalid bitmap format")
@@ -60,12 +82,18 @@ func (b *BasicOps) SetBit(key string, offset int64, value int) (int, error) {
 	if value != 0 && value != 1 {
 		return 0, fmt.Errorf("ERR bit value must be 0 or 1")
 	}
+	if offset < 0 || offset > MaxOffset {
+		return 0, ErrOutOfBoundsOffset
+	}
 
 	mu := b.getMutex(key)
 	mu.Lock()
 	defer mu.Unlock()
 
 	valI, _ := b.cache.LoadOrStore(key, make([]byte, 0)) // Assuming LoadOrStore never returns an error
+	if r, ok := valI.(*Roaring); ok {
+		return b.setRoaringBit(key, r, offset, value), nil
+	}
 	valBytes, ok := valI.([]byte)
 	if !ok {
 		return 0, fmt.Errorf("ERR invalid bitmap format")
@@ -74,6 +102,14 @@ func (b *BasicOps) SetBit(key string, offset int64, value int) (int, error) {
 	byteIndex := offset / 8
 	bitIndex := offset % 8
 
+	// Past flatMaxLen bytes, the bitmap is likely sparse and the roaring
+	// representation spares allocating it all
+	if byteIndex >= flatMaxLen && int64(len(valBytes)) <= byteIndex {
+		r := RoaringFromBytes(valBytes)
+		b.cache.Store(key, r)
+		return b.setRoaringBit(key, r, offset, value), nil
+	}
+
 	// Extend the bitmap if needed
 	if int64(len(valBytes)) <= byteIndex {
 		newBytes := make([]byte, byteIndex+1)
@@ -98,6 +134,69 @@ func (b *BasicOps) SetBit(key string, offset int64, value int) (int, error) {
 	return int(oldBit), nil
 }
 
+// setRoaringBit sets a bit of the roaring bitmap of key, whose lock is
+// held, and returns its previous value
+func (b *BasicOps) setRoaringBit(key string, r *Roaring, offset int64, value int) int {
+	changed := false
+	if value == 1 {
+		changed = r.Add(uint32(offset))
+	} else {
+		changed = r.Remove(uint32(offset))
+	}
+	b.incrementKeyVersion(key)
+
+	// The bit was set if adding it changed nothing or removing it did
+	if changed == (value == 0) {
+		return 1
+	}
+	return 0
+}
+
+// view calls fn with the bitmap of key as a roaring bitmap, which is empty
+// if there is no bitmap and converted from a flat one. fn must not modify
+// or keep the bitmap.
+func (b *BasicOps) view(key string, fn func(r *Roaring)) {
+	mu := b.getMutex(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	val, _ := b.cache.Load(key)
+	switch v := val.(type) {
+	case *Roaring:
+		fn(v)
+	case []byte:
+		fn(RoaringFromBytes(v))
+	default:
+		fn(NewRoaring())
+	}
+}
+
+// isRoaring reports whether the bitmap of key is stored as a roaring bitmap
+func (b *BasicOps) isRoaring(key string) bool {
+	val, _ := b.cache.Load(key)
+	_, ok := val.(*Roaring)
+	return ok
+}
+
+// Copy copies the bitmap at source to destination, and reports whether
+// there is one.
+func (b *BasicOps) Copy(source, destination string) bool {
+	val, exists := b.cache.Load(source)
+	if !exists {
+		return false
+	}
+	switch v := val.(type) {
+	case *Roaring:
+		b.view(source, func(r *Roaring) {
+			b.cache.Store(destination, r.Clone())
+		})
+	case []byte:
+		b.cache.Store(destination, append([]byte(nil), v...))
+	}
+	b.incrementKeyVersion(destination)
+	return true
+}
+
 // incrementKeyVersion increments the version of a key
 func (b *BasicOps) incrementKeyVersion(key string) {
 	val, _ := b.version.LoadOrStore(key, int64(0))
@@ -105,7 +204,8 @@ func (b *BasicOps) incrementKeyVersion(key string) {
 	b.version.Store(key, version+1)
 }
 
-// GetBitmap returns the underlying byte slice for a key
+// GetBitmap returns the underlying byte slice for a key, nil if it is
+// stored as a roaring bitmap
 func (b *BasicOps) GetBitmap(key string) []byte {
 	val, exists := b.cache.Load(key)
 	if !exists {
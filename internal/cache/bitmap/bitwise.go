@@ -21,6 +21,18 @@ func (b *BitwiseOps) BitOp(operation string, destkey string, keys ...string) (in
 		return 0, fmt.Errorf("ERR wrong number of arguments for 'bitop' command")
 	}
 
+	// Roaring bitmaps are combined container by container
+	for _, key := range keys {
+		if b.basicOps.isRoaring(key) {
+			result, err := b.roaringBitOp(operation, keys...)
+			if err != nil {
+				return 0, err
+			}
+			b.storeRoaring(destkey, result)
+			return result.ByteLen(), nil
+		}
+	}
+
 	var result []byte
 	switch strings.ToUpper(operation) {
 	case "AND":
@@ -146,10 +158,62 @@ func (b *BitwiseOps) bitopXOR(keys ...string) []byte {
 		for i := 0; i < maxLen; i++ {
 			if i < len(val) {
 				result[i] ^= val[i]
-				fmt.Printf("Intermediate result at byte %d: %08b\n", i, result[i])
 			}
 		}
 	}
 
 	return result
 }
+
+// roaringBitOp performs a bitwise operation on bitmaps as roaring bitmaps.
+// Missing keys are empty bitmaps. NOT flips the bits of the bytes up to the
+// highest set bit.
+func (b *BitwiseOps) roaringBitOp(operation string, keys ...string) (*Roaring, error) {
+	operation = strings.ToUpper(operation)
+	var op bitOp
+	switch operation {
+	case "AND":
+		op = opAnd
+	case "OR":
+		op = opOr
+	case "XOR":
+		op = opXor
+	case "NOT":
+		if len(keys) != 1 {
+			return nil, fmt.Errorf("ERR BITOP NOT must be called with a single source key")
+		}
+	default:
+		return nil, fmt.Errorf("ERR unknown operation '%s'", operation)
+	}
+
+	var result *Roaring
+	for _, key := range keys {
+		b.basicOps.view(key, func(r *Roaring) {
+			switch {
+			case operation == "NOT":
+				result = r.Xor(RoaringRange(0, uint64(r.ByteLen())*8))
+			case result == nil:
+				result = r.Clone()
+			default:
+				result = roaringOp(op, result, r)
+			}
+		})
+	}
+	result.RunOptimize()
+	return result, nil
+}
+
+// storeRoaring stores a roaring bitmap at key, or deletes key if the bitmap
+// is empty
+func (b *BitwiseOps) storeRoaring(key string, r *Roaring) {
+	mu := b.basicOps.getMutex(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if r.IsEmpty() {
+		b.basicOps.cache.Delete(key)
+	} else {
+		b.basicOps.cache.Store(key, r)
+	}
+	b.basicOps.incrementKeyVersion(key)
+}
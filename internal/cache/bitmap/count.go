@@ -16,6 +16,10 @@ func NewCountOps(basicOps *BasicOps) *CountOps {
 
 // BitCount returns the number of set bits (1) in the bitmap
 func (c *CountOps) BitCount(key string, start, end int64) (int64, error) {
+	if c.basicOps.isRoaring(key) {
+		return c.roaringBitCount(key, start, end), nil
+	}
+
 	bytes := c.basicOps.GetBitmap(key)
 	if bytes == nil {
 		return 0, nil
@@ -47,6 +51,10 @@ func (c *CountOps) BitCount(key string, start, end int64) (int64, error) {
 
 // BitPos finds the position of the first bit set to a given value (0 or 1)
 func (c *CountOps) BitPos(key string, bit int, start, end int64, reverse bool) (int64, error) {
+	if c.basicOps.isRoaring(key) {
+		return c.roaringBitPos(key, bit, start, end, reverse), nil
+	}
+
 	bytes := c.basicOps.GetBitmap(key)
 	if bytes == nil {
 		if bit == 0 {
@@ -89,6 +97,67 @@ func (c *CountOps) BitPos(key string, bit int, start, end int64, reverse bool) (
 	return -1, nil
 }
 
+// roaringByteRange returns the bits of the bytes from start to end of a
+// roaring bitmap, end excluded, adjusting the indices as for a flat one of
+// its byte length
+func roaringByteRange(r *Roaring, start, end int64) (uint64, uint64) {
+	length := r.ByteLen()
+	if start < 0 {
+		start = length + start
+	}
+	if end < 0 {
+		end = length + end
+	}
+	start = max(start, 0)
+	end = min(end, length-1)
+	if start > end {
+		return 0, 0
+	}
+	return uint64(start) * 8, uint64(end+1) * 8
+}
+
+// roaringBitCount counts the bits of a roaring bitmap container by
+// container
+func (c *CountOps) roaringBitCount(key string, start, end int64) int64 {
+	var count int64
+	c.basicOps.view(key, func(r *Roaring) {
+		first, last := roaringByteRange(r, start, end)
+		count = int64(r.CountRange(first, last))
+	})
+	return count
+}
+
+// roaringBitPos finds a bit of a roaring bitmap by skipping through its
+// containers
+func (c *CountOps) roaringBitPos(key string, bit int, start, end int64, reverse bool) int64 {
+	pos := int64(-1)
+	c.basicOps.view(key, func(r *Roaring) {
+		first, last := roaringByteRange(r, start, end)
+		if first >= last {
+			return
+		}
+		switch {
+		case bit == 1 && reverse:
+			if x, ok := r.PrevSet(last - 1); ok && uint64(x) >= first {
+				pos = int64(x)
+			}
+		case bit == 1:
+			if x, ok := r.NextSet(first); ok && uint64(x) < last {
+				pos = int64(x)
+			}
+		case reverse:
+			if x, ok := r.PrevClear(last - 1); ok && x >= first {
+				pos = int64(x)
+			}
+		default:
+			if x := r.NextClear(first); x < last {
+				pos = int64(x)
+			}
+		}
+	})
+	return pos
+}
+
 // Helper methods
 
 // findBitInByte finds the position of a bit value within a byte
@@ -62,6 +62,10 @@ func (f *FieldOps) BitFieldRO(key string, commands []models.BitFieldCommand) ([]
 // Helper methods
 
 func (f *FieldOps) bitfieldGet(key string, typ string, offset int64) (int64, error) {
+	if f.basicOps.isRoaring(key) {
+		return f.roaringBitfieldGet(key, typ, offset)
+	}
+
 	bytes := f.basicOps.GetBitmap(key)
 	if bytes == nil {
 		return 0, nil
@@ -98,6 +102,10 @@ func (f *FieldOps) bitfieldGet(key string, typ string, offset int64) (int64, err
 }
 
 func (f *FieldOps) bitfieldSet(key string, typ string, offset int64, value int64) (int64, error) {
+	if f.basicOps.isRoaring(key) {
+		return f.roaringBitfieldSet(key, typ, offset, value)
+	}
+
 	bits, _, err := f.parseBitfieldType(typ)
 	if err != nil {
 		return 0, err
@@ -187,6 +195,49 @@ func (f *FieldOps) bitfieldIncrBy(key string, typ string, offset int64, incremen
 	return result, nil
 }
 
+// roaringBitfieldGet reads an integer from the bits of a roaring bitmap,
+// most significant bit first
+func (f *FieldOps) roaringBitfieldGet(key string, typ string, offset int64) (int64, error) {
+	bits, signed, err := f.parseBitfieldType(typ)
+	if err != nil {
+		return 0, err
+	}
+
+	var result uint64
+	f.basicOps.view(key, func(r *Roaring) {
+		for i := int64(0); i < int64(bits); i++ {
+			result <<= 1
+			if x := offset + i; x <= MaxOffset && r.Contains(uint32(x)) {
+				result |= 1
+			}
+		}
+	})
+
+	value := int64(result)
+	if signed && bits < 64 && value&(1<<(bits-1)) != 0 {
+		value -= 1 << bits
+	}
+	return value, nil
+}
+
+// roaringBitfieldSet writes an integer to the bits of a roaring bitmap,
+// most significant bit first, and returns the previous one
+func (f *FieldOps) roaringBitfieldSet(key string, typ string, offset int64, value int64) (int64, error) {
+	old, err := f.roaringBitfieldGet(key, typ, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	bits, _, _ := f.parseBitfieldType(typ)
+	for i := 0; i < bits; i++ {
+		bit := int(uint64(value) >> (bits - 1 - i) & 1)
+		if _, err := f.basicOps.SetBit(key, offset+int64(i), bit); err != nil {
+			return 0, err
+		}
+	}
+	return old, nil
+}
+
 func (f *FieldOps) parseBitfieldType(typ string) (bits int, signed bool, err error) {
 	if len(typ) < 2 {
 		return 0, false, fmt.Errorf("invalid bitfield type")
@@ -11,17 +11,20 @@ type Manager struct {
 	countOps   *CountOps
 	fieldOps   *FieldOps
 	bitwiseOps *BitwiseOps
+	roaringOps *RoaringOps
 }
 
 func NewManager(bcache *sync.Map, version *sync.Map) *Manager {
 
 	basicOps := NewBasicOps(bcache, version)
+	bitwiseOps := NewBitwiseOps(basicOps)
 
 	return &Manager{
 		basicOps:   basicOps,
 		countOps:   NewCountOps(basicOps),
 		fieldOps:   NewFieldOps(basicOps),
-		bitwiseOps: NewBitwiseOps(basicOps),
+		bitwiseOps: bitwiseOps,
+		roaringOps: NewRoaringOps(basicOps, bitwiseOps),
 	}
 }
 
@@ -56,3 +59,39 @@ func (m *Manager) BitOp(operation string, destkey string, keys ...string) (int64
 func (m *Manager) GetBitmap(key string) []byte {
 	return m.basicOps.GetBitmap(key)
 }
+
+func (m *Manager) Copy(source, destination string) bool {
+	return m.basicOps.Copy(source, destination)
+}
+
+func (m *Manager) RSetBit(key string, offset int64, value int) (int, error) {
+	return m.roaringOps.SetBit(key, offset, value)
+}
+
+func (m *Manager) RSetIntArray(key string, offsets []int64) error {
+	return m.roaringOps.SetIntArray(key, offsets)
+}
+
+func (m *Manager) RBitOp(operation string, destkey string, keys ...string) (int64, error) {
+	return m.roaringOps.BitOp(operation, destkey, keys...)
+}
+
+func (m *Manager) RCard(key string) int64 {
+	return m.roaringOps.Card(key)
+}
+
+func (m *Manager) RRange(key string, start, end int64) ([]int64, error) {
+	return m.roaringOps.Range(key, start, end)
+}
+
+func (m *Manager) RGetIntArray(key string) []int64 {
+	return m.roaringOps.GetIntArray(key)
+}
+
+func (m *Manager) RMin(key string) int64 {
+	return m.roaringOps.Min(key)
+}
+
+func (m *Manager) RMax(key string) int64 {
+	return m.roaringOps.Max(key)
+}
@@ -0,0 +1,823 @@
+package bitmap
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+	"sort"
+)
+
+// Roaring is a compressed bitmap of 32 bit offsets. Offsets are split by
+// their high 16 bits into containers of their low 16 bits, each stored the
+// way that takes the least memory: a sorted array while sparse, a 65536 bit
+// bitmap while dense, or runs of consecutive offsets.
+// Reference: https://arxiv.org/abs/1603.06549
+//
+// A Roaring bitmap is not safe for concurrent use.
+type Roaring struct {
+	keys       []uint16 // sorted high bits of the containers
+	containers []*container
+}
+
+const (
+	// arrayMaxSize is the cardinality past which an array container would
+	// take more memory than a bitmap one
+	arrayMaxSize = 4096
+	// bitmapWords is the number of words of a bitmap container
+	bitmapWords = 1 << 16 / 64
+)
+
+type containerKind uint8
+
+const (
+	arrayKind containerKind = iota
+	bitmapKind
+	runKind
+)
+
+// container holds the low 16 bits of the offsets sharing their high bits.
+// Array and bitmap containers are kept to their cardinality: arrays up to
+// arrayMaxSize offsets, bitmaps past it. Run containers are only made by
+// optimize, and turn back into one of the others when modified.
+type container struct {
+	kind  containerKind
+	array []uint16 // sorted offsets of an array container
+	words []uint64 // bits of a bitmap container
+	runs  []run    // sorted runs of a run container, with gaps between them
+	card  int
+}
+
+// run is a run of consecutive offsets, from start to last included
+type run struct {
+	start, last uint16
+}
+
+// NewRoaring returns an empty Roaring bitmap.
+func NewRoaring() *Roaring {
+	return &Roaring{}
+}
+
+// RoaringFromBytes returns the Roaring bitmap of a flat bitmap, in which
+// the first bit is the most significant bit of the first byte.
+func RoaringFromBytes(data []byte) *Roaring {
+	r := NewRoaring()
+	const chunk = 1 << 16 / 8
+	for hi := 0; hi*chunk < len(data) && hi <= math.MaxUint16; hi++ {
+		bytes := data[hi*chunk : min((hi+1)*chunk, len(data))]
+		words := make([]uint64, bitmapWords)
+		for j, b := range bytes {
+			words[j/8] |= uint64(bits.Reverse8(b)) << (j % 8 * 8)
+		}
+		if c := containerFromWords(words); c != nil {
+			r.keys = append(r.keys, uint16(hi))
+			r.containers = append(r.containers, c)
+		}
+	}
+	return r
+}
+
+// RoaringRange returns the Roaring bitmap of the offsets from start to end,
+// end excluded.
+func RoaringRange(start, end uint64) *Roaring {
+	r := NewRoaring()
+	end = min(end, 1<<32)
+	for start < end {
+		hi := start >> 16
+		last := min(end-1, hi<<16|0xffff)
+		r.keys = append(r.keys, uint16(hi))
+		r.containers = append(r.containers, &container{
+			kind: runKind,
+			runs: []run{{uint16(start), uint16(last)}},
+			card: int(last-start) + 1,
+		})
+		start = last + 1
+	}
+	return r
+}
+
+// index returns the index of the container of hi, or where it would be
+func (r *Roaring) index(hi uint16) (int, bool) {
+	return slices.BinarySearch(r.keys, hi)
+}
+
+// Add adds x, and reports whether it was not in the bitmap yet.
+func (r *Roaring) Add(x uint32) bool {
+	hi, lo := uint16(x>>16), uint16(x)
+	i, found := r.index(hi)
+	if !found {
+		r.keys = slices.Insert(r.keys, i, hi)
+		r.containers = slices.Insert(r.containers, i, &container{kind: arrayKind})
+	}
+	return r.containers[i].add(lo)
+}
+
+// Remove removes x, and reports whether it was in the bitmap.
+func (r *Roaring) Remove(x uint32) bool {
+	i, found := r.index(uint16(x >> 16))
+	if !found {
+		return false
+	}
+	removed := r.containers[i].remove(uint16(x))
+	if r.containers[i].card == 0 {
+		r.keys = slices.Delete(r.keys, i, i+1)
+		r.containers = slices.Delete(r.containers, i, i+1)
+	}
+	return removed
+}
+
+// Contains reports whether x is in the bitmap.
+func (r *Roaring) Contains(x uint32) bool {
+	i, found := r.index(uint16(x >> 16))
+	return found && r.containers[i].contains(uint16(x))
+}
+
+// Cardinality returns the number of offsets in the bitmap.
+func (r *Roaring) Cardinality() uint64 {
+	var card uint64
+	for _, c := range r.containers {
+		card += uint64(c.card)
+	}
+	return card
+}
+
+// IsEmpty reports whether the bitmap holds no offset.
+func (r *Roaring) IsEmpty() bool {
+	return len(r.containers) == 0
+}
+
+// Minimum returns the lowest offset of the bitmap, false if it is empty.
+func (r *Roaring) Minimum() (uint32, bool) {
+	return r.NextSet(0)
+}
+
+// Maximum returns the highest offset of the bitmap, false if it is empty.
+func (r *Roaring) Maximum() (uint32, bool) {
+	return r.PrevSet(math.MaxUint32)
+}
+
+// ByteLen returns the length of the flat bitmap holding the highest offset.
+func (r *Roaring) ByteLen() int64 {
+	max, ok := r.Maximum()
+	if !ok {
+		return 0
+	}
+	return int64(max)/8 + 1
+}
+
+// NextSet returns the lowest offset of the bitmap from x on.
+func (r *Roaring) NextSet(x uint64) (uint32, bool) {
+	if x > math.MaxUint32 {
+		return 0, false
+	}
+	hi := uint16(x >> 16)
+	i, found := r.index(hi)
+	if found {
+		if lo, ok := r.containers[i].next(int(x & 0xffff)); ok {
+			return uint32(hi)<<16 | uint32(lo), true
+		}
+		i++
+	}
+	if i < len(r.containers) {
+		lo, _ := r.containers[i].next(0)
+		return uint32(r.keys[i])<<16 | uint32(lo), true
+	}
+	return 0, false
+}
+
+// PrevSet returns the highest offset of the bitmap up to x.
+func (r *Roaring) PrevSet(x uint64) (uint32, bool) {
+	x = min(x, math.MaxUint32)
+	hi := uint16(x >> 16)
+	i, found := r.index(hi)
+	if found {
+		if lo, ok := r.containers[i].prev(int(x & 0xffff)); ok {
+			return uint32(hi)<<16 | uint32(lo), true
+		}
+	}
+	if i--; i >= 0 {
+		lo, _ := r.containers[i].prev(math.MaxUint16)
+		return uint32(r.keys[i])<<16 | uint32(lo), true
+	}
+	return 0, false
+}
+
+// NextClear returns the lowest offset not in the bitmap from x on, 1<<32
+// if there is none.
+func (r *Roaring) NextClear(x uint64) uint64 {
+	for x <= math.MaxUint32 {
+		hi := uint16(x >> 16)
+		i, found := r.index(hi)
+		if !found {
+			return x
+		}
+		if lo, ok := r.containers[i].nextClear(int(x & 0xffff)); ok {
+			return uint64(hi)<<16 | uint64(lo)
+		}
+		x = (uint64(hi) + 1) << 16
+	}
+	return 1 << 32
+}
+
+// PrevClear returns the highest offset not in the bitmap up to x.
+func (r *Roaring) PrevClear(x uint64) (uint64, bool) {
+	for next := min(x, math.MaxUint32) + 1; next > 0; {
+		x := next - 1
+		hi := uint16(x >> 16)
+		i, found := r.index(hi)
+		if !found {
+			return x, true
+		}
+		if lo, ok := r.containers[i].prevClear(int(x & 0xffff)); ok {
+			return uint64(hi)<<16 | uint64(lo), true
+		}
+		next = uint64(hi) << 16
+	}
+	return 0, false
+}
+
+// CountRange returns the number of offsets of the bitmap from start to end,
+// end excluded.
+func (r *Roaring) CountRange(start, end uint64) uint64 {
+	end = min(end, 1<<32)
+	if start >= end {
+		return 0
+	}
+	first, last := start>>16, (end-1)>>16
+	i, _ := r.index(uint16(first))
+
+	var count uint64
+	for ; i < len(r.keys) && uint64(r.keys[i]) <= last; i++ {
+		lo, hi := 0, math.MaxUint16
+		if uint64(r.keys[i]) == first {
+			lo = int(start & 0xffff)
+		}
+		if uint64(r.keys[i]) == last {
+			hi = int((end - 1) & 0xffff)
+		}
+		count += uint64(r.containers[i].countRange(lo, hi))
+	}
+	return count
+}
+
+// Iterate calls fn with the offsets of the bitmap from start to end, end
+// excluded, in order until it returns false.
+func (r *Roaring) Iterate(start, end uint64, fn func(uint32) bool) {
+	if start > math.MaxUint32 {
+		return
+	}
+	i, _ := r.index(uint16(start >> 16))
+	for ; i < len(r.keys); i++ {
+		hi := uint64(r.keys[i]) << 16
+		if hi >= end {
+			return
+		}
+		// Offsets past end stop the iteration as well
+		more := r.containers[i].forEach(func(lo uint16) bool {
+			x := hi | uint64(lo)
+			if x < start {
+				return true
+			}
+			return x < end && fn(uint32(x))
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// ToArray returns the offsets of the bitmap in order.
+func (r *Roaring) ToArray() []uint32 {
+	array := make([]uint32, 0, r.Cardinality())
+	for i, c := range r.containers {
+		hi := uint32(r.keys[i]) << 16
+		c.forEach(func(lo uint16) bool {
+			array = append(array, hi|uint32(lo))
+			return true
+		})
+	}
+	return array
+}
+
+// Clone returns a copy of the bitmap.
+func (r *Roaring) Clone() *Roaring {
+	clone := &Roaring{
+		keys:       slices.Clone(r.keys),
+		containers: make([]*container, len(r.containers)),
+	}
+	for i, c := range r.containers {
+		clone.containers[i] = c.clone()
+	}
+	return clone
+}
+
+// RunOptimize stores each container the way that takes the least memory,
+// which may be runs.
+func (r *Roaring) RunOptimize() {
+	for _, c := range r.containers {
+		c.optimize()
+	}
+}
+
+// SizeInBytes returns an estimate of the memory used by the bitmap.
+func (r *Roaring) SizeInBytes() int64 {
+	size := int64(2 * len(r.keys))
+	for _, c := range r.containers {
+		size += 16 + int64(2*len(c.array)+8*len(c.words)+4*len(c.runs))
+	}
+	return size
+}
+
+type bitOp uint8
+
+const (
+	opAnd bitOp = iota
+	opOr
+	opXor
+	opAndNot
+)
+
+// And returns the offsets in both r and other.
+func (r *Roaring) And(other *Roaring) *Roaring {
+	return roaringOp(opAnd, r, other)
+}
+
+// Or returns the offsets in r or other.
+func (r *Roaring) Or(other *Roaring) *Roaring {
+	return roaringOp(opOr, r, other)
+}
+
+// Xor returns the offsets in exactly one of r and other.
+func (r *Roaring) Xor(other *Roaring) *Roaring {
+	return roaringOp(opXor, r, other)
+}
+
+// AndNot returns the offsets in r but not in other.
+func (r *Roaring) AndNot(other *Roaring) *Roaring {
+	return roaringOp(opAndNot, r, other)
+}
+
+// roaringOp merges the containers of a and b by their high bits
+func roaringOp(op bitOp, a, b *Roaring) *Roaring {
+	result := NewRoaring()
+	appendContainer := func(key uint16, c *container) {
+		if c != nil {
+			result.keys = append(result.keys, key)
+			result.containers = append(result.containers, c)
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a.keys) || j < len(b.keys) {
+		switch {
+		case j == len(b.keys) || (i < len(a.keys) && a.keys[i] < b.keys[j]):
+			// Only in a
+			if op != opAnd {
+				appendContainer(a.keys[i], a.containers[i].clone())
+			}
+			i++
+		case i == len(a.keys) || b.keys[j] < a.keys[i]:
+			// Only in b
+			if op == opOr || op == opXor {
+				appendContainer(b.keys[j], b.containers[j].clone())
+			}
+			j++
+		default:
+			appendContainer(a.keys[i], containerOp(op, a.containers[i], b.containers[j]))
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func (c *container) clone() *container {
+	return &container{
+		kind:  c.kind,
+		array: slices.Clone(c.array),
+		words: slices.Clone(c.words),
+		runs:  slices.Clone(c.runs),
+		card:  c.card,
+	}
+}
+
+func (c *container) contains(x uint16) bool {
+	switch c.kind {
+	case arrayKind:
+		_, found := slices.BinarySearch(c.array, x)
+		return found
+	case bitmapKind:
+		return c.words[x>>6]&(1<<(x&63)) != 0
+	default:
+		i := c.runIndex(int(x))
+		return i >= 0 && c.runs[i].last >= x
+	}
+}
+
+// runIndex returns the index of the last run starting at or before x, -1
+// if there is none
+func (c *container) runIndex(x int) int {
+	return sort.Search(len(c.runs), func(i int) bool {
+		return int(c.runs[i].start) > x
+	}) - 1
+}
+
+// add adds x, and reports whether it was not in the container yet
+func (c *container) add(x uint16) bool {
+	switch c.kind {
+	case runKind:
+		if c.contains(x) {
+			return false
+		}
+		c.expand()
+		return c.add(x)
+	case arrayKind:
+		i, found := slices.BinarySearch(c.array, x)
+		if found {
+			return false
+		}
+		if len(c.array) == arrayMaxSize {
+			c.toBitmap()
+			return c.add(x)
+		}
+		c.array = slices.Insert(c.array, i, x)
+	case bitmapKind:
+		if c.words[x>>6]&(1<<(x&63)) != 0 {
+			return false
+		}
+		c.words[x>>6] |= 1 << (x & 63)
+	}
+	c.card++
+	return true
+}
+
+// remove removes x, and reports whether it was in the container
+func (c *container) remove(x uint16) bool {
+	switch c.kind {
+	case runKind:
+		if !c.contains(x) {
+			return false
+		}
+		c.expand()
+		return c.remove(x)
+	case arrayKind:
+		i, found := slices.BinarySearch(c.array, x)
+		if !found {
+			return false
+		}
+		c.array = slices.Delete(c.array, i, i+1)
+	case bitmapKind:
+		if c.words[x>>6]&(1<<(x&63)) == 0 {
+			return false
+		}
+		c.words[x>>6] &^= 1 << (x & 63)
+	}
+	c.card--
+	if c.kind == bitmapKind && c.card <= arrayMaxSize {
+		c.toArray()
+	}
+	return true
+}
+
+// forEach calls fn with the offsets of the container in order until it
+// returns false, and reports whether it got through all of them
+func (c *container) forEach(fn func(uint16) bool) bool {
+	switch c.kind {
+	case arrayKind:
+		for _, x := range c.array {
+			if !fn(x) {
+				return false
+			}
+		}
+	case bitmapKind:
+		for w, word := range c.words {
+			for word != 0 {
+				if !fn(uint16(w*64 + bits.TrailingZeros64(word))) {
+					return false
+				}
+				word &= word - 1
+			}
+		}
+	default:
+		for _, r := range c.runs {
+			for x := int(r.start); x <= int(r.last); x++ {
+				if !fn(uint16(x)) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// bits returns the bits of the container, which are its own for a bitmap
+// container
+func (c *container) bits() []uint64 {
+	if c.kind == bitmapKind {
+		return c.words
+	}
+	words := make([]uint64, bitmapWords)
+	if c.kind == runKind {
+		for _, r := range c.runs {
+			setRange(words, int(r.start), int(r.last))
+		}
+		return words
+	}
+	for _, x := range c.array {
+		words[x>>6] |= 1 << (x & 63)
+	}
+	return words
+}
+
+// setRange sets the bits from start to last included
+func setRange(words []uint64, start, last int) {
+	for w := start / 64; w <= last/64; w++ {
+		mask := ^uint64(0)
+		if w == start/64 {
+			mask &= ^uint64(0) << (start % 64)
+		}
+		if w == last/64 {
+			mask &= ^uint64(0) >> (63 - last%64)
+		}
+		words[w] |= mask
+	}
+}
+
+// containerFromWords returns the container of bits, an array or a bitmap
+// container by their cardinality, or nil if no bit is set
+func containerFromWords(words []uint64) *container {
+	card := 0
+	for _, word := range words {
+		card += bits.OnesCount64(word)
+	}
+	if card == 0 {
+		return nil
+	}
+	c := &container{kind: bitmapKind, words: words, card: card}
+	if card <= arrayMaxSize {
+		c.toArray()
+	}
+	return c
+}
+
+// containerFromArray returns the container of sorted offsets, or nil if
+// there are none
+func containerFromArray(array []uint16) *container {
+	if len(array) == 0 {
+		return nil
+	}
+	c := &container{kind: arrayKind, array: array, card: len(array)}
+	if len(array) > arrayMaxSize {
+		c.toBitmap()
+	}
+	return c
+}
+
+// expand turns a run container into an array or bitmap one
+func (c *container) expand() {
+	*c = *containerFromWords(c.bits())
+}
+
+func (c *container) toBitmap() {
+	c.words, c.kind, c.array, c.runs = c.bits(), bitmapKind, nil, nil
+}
+
+func (c *container) toArray() {
+	array := make([]uint16, 0, c.card)
+	c.forEach(func(x uint16) bool {
+		array = append(array, x)
+		return true
+	})
+	c.array, c.kind, c.words, c.runs = array, arrayKind, nil, nil
+}
+
+// optimize turns the container into a run container if that takes less
+// memory, and a run container back into an array or bitmap one if not
+func (c *container) optimize() {
+	var runs []run
+	c.forEach(func(x uint16) bool {
+		if n := len(runs); n > 0 && int(runs[n-1].last)+1 == int(x) {
+			runs[n-1].last = x
+		} else {
+			runs = append(runs, run{x, x})
+		}
+		return true
+	})
+
+	arraySize, bitmapSize, runSize := 2*c.card, 8*bitmapWords, 4*len(runs)
+	switch {
+	case runSize < min(arraySize, bitmapSize):
+		c.runs, c.kind, c.array, c.words = runs, runKind, nil, nil
+	case c.kind == runKind:
+		c.expand()
+	}
+}
+
+// next returns the lowest offset of the container from x on
+func (c *container) next(x int) (uint16, bool) {
+	switch c.kind {
+	case arrayKind:
+		i, _ := slices.BinarySearch(c.array, uint16(x))
+		if i < len(c.array) {
+			return c.array[i], true
+		}
+	case bitmapKind:
+		w := x / 64
+		word := c.words[w] & (^uint64(0) << (x % 64))
+		for {
+			if word != 0 {
+				return uint16(w*64 + bits.TrailingZeros64(word)), true
+			}
+			if w++; w == bitmapWords {
+				break
+			}
+			word = c.words[w]
+		}
+	default:
+		i := c.runIndex(x)
+		if i >= 0 && int(c.runs[i].last) >= x {
+			return uint16(x), true
+		}
+		if i+1 < len(c.runs) {
+			return c.runs[i+1].start, true
+		}
+	}
+	return 0, false
+}
+
+// prev returns the highest offset of the container up to x
+func (c *container) prev(x int) (uint16, bool) {
+	switch c.kind {
+	case arrayKind:
+		i := sort.Search(len(c.array), func(i int) bool {
+			return int(c.array[i]) > x
+		})
+		if i > 0 {
+			return c.array[i-1], true
+		}
+	case bitmapKind:
+		w := x / 64
+		word := c.words[w] & (^uint64(0) >> (63 - x%64))
+		for {
+			if word != 0 {
+				return uint16(w*64 + 63 - bits.LeadingZeros64(word)), true
+			}
+			if w--; w < 0 {
+				break
+			}
+			word = c.words[w]
+		}
+	default:
+		if i := c.runIndex(x); i >= 0 {
+			return min(c.runs[i].last, uint16(x)), true
+		}
+	}
+	return 0, false
+}
+
+// nextClear returns the lowest offset not in the container from x on
+func (c *container) nextClear(x int) (uint16, bool) {
+	switch c.kind {
+	case arrayKind:
+		i, _ := slices.BinarySearch(c.array, uint16(x))
+		for ; i < len(c.array) && int(c.array[i]) == x; i++ {
+			x++
+		}
+	case bitmapKind:
+		w := x / 64
+		word := ^c.words[w] & (^uint64(0) << (x % 64))
+		for {
+			if word != 0 {
+				return uint16(w*64 + bits.TrailingZeros64(word)), true
+			}
+			if w++; w == bitmapWords {
+				return 0, false
+			}
+			word = ^c.words[w]
+		}
+	default:
+		if i := c.runIndex(x); i >= 0 && int(c.runs[i].last) >= x {
+			// Runs have gaps between them
+			x = int(c.runs[i].last) + 1
+		}
+	}
+	return uint16(x), x <= math.MaxUint16
+}
+
+// prevClear returns the highest offset not in the container up to x
+func (c *container) prevClear(x int) (uint16, bool) {
+	switch c.kind {
+	case arrayKind:
+		i := sort.Search(len(c.array), func(i int) bool {
+			return int(c.array[i]) > x
+		}) - 1
+		for ; i >= 0 && int(c.array[i]) == x; i-- {
+			x--
+		}
+	case bitmapKind:
+		w := x / 64
+		word := ^c.words[w] & (^uint64(0) >> (63 - x%64))
+		for {
+			if word != 0 {
+				return uint16(w*64 + 63 - bits.LeadingZeros64(word)), true
+			}
+			if w--; w < 0 {
+				return 0, false
+			}
+			word = ^c.words[w]
+		}
+	default:
+		if i := c.runIndex(x); i >= 0 && int(c.runs[i].last) >= x {
+			x = int(c.runs[i].start) - 1
+		}
+	}
+	return uint16(x), x >= 0
+}
+
+// countRange returns the number of offsets of the container from lo to hi
+// included
+func (c *container) countRange(lo, hi int) int {
+	if lo == 0 && hi == math.MaxUint16 {
+		return c.card
+	}
+	switch c.kind {
+	case arrayKind:
+		i, _ := slices.BinarySearch(c.array, uint16(lo))
+		j := sort.Search(len(c.array), func(j int) bool {
+			return int(c.array[j]) > hi
+		})
+		return max(0, j-i)
+	case bitmapKind:
+		count := 0
+		for w := lo / 64; w <= hi/64; w++ {
+			word := c.words[w]
+			if w == lo/64 {
+				word &= ^uint64(0) << (lo % 64)
+			}
+			if w == hi/64 {
+				word &= ^uint64(0) >> (63 - hi%64)
+			}
+			count += bits.OnesCount64(word)
+		}
+		return count
+	default:
+		count := 0
+		for _, r := range c.runs {
+			start, last := max(int(r.start), lo), min(int(r.last), hi)
+			if start <= last {
+				count += last - start + 1
+			}
+		}
+		return count
+	}
+}
+
+// containerOp returns the result of op on two containers, nil if it is
+// empty. Arrays are merged, anything else is computed on bitmaps.
+func containerOp(op bitOp, a, b *container) *container {
+	if a.kind == arrayKind && b.kind == arrayKind {
+		return containerFromArray(arrayOp(op, a.array, b.array))
+	}
+
+	wa, wb := a.bits(), b.bits()
+	words := make([]uint64, bitmapWords)
+	for i := range words {
+		switch op {
+		case opAnd:
+			words[i] = wa[i] & wb[i]
+		case opOr:
+			words[i] = wa[i] | wb[i]
+		case opXor:
+			words[i] = wa[i] ^ wb[i]
+		case opAndNot:
+			words[i] = wa[i] &^ wb[i]
+		}
+	}
+	return containerFromWords(words)
+}
+
+// arrayOp merges two sorted arrays
+func arrayOp(op bitOp, a, b []uint16) []uint16 {
+	var result []uint16
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			if op != opAnd {
+				result = append(result, a[i])
+			}
+			i++
+		case i == len(a) || b[j] < a[i]:
+			if op == opOr || op == opXor {
+				result = append(result, b[j])
+			}
+			j++
+		default:
+			if op == opAnd || op == opOr {
+				result = append(result, a[i])
+			}
+			i++
+			j++
+		}
+	}
+	return result
+}
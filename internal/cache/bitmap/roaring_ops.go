@@ -0,0 +1,124 @@
+package bitmap
+
+import "fmt"
+
+// RoaringOps handles the R.* commands, which treat a bitmap as the set of
+// its set bit offsets and always store it as a roaring bitmap
+type RoaringOps struct {
+	basicOps   *BasicOps
+	bitwiseOps *BitwiseOps
+}
+
+func NewRoaringOps(basicOps *BasicOps, bitwiseOps *BitwiseOps) *RoaringOps {
+	return &RoaringOps{
+		basicOps:   basicOps,
+		bitwiseOps: bitwiseOps,
+	}
+}
+
+// SetBit sets a bit like BasicOps.SetBit, converting a flat bitmap to a
+// roaring one
+func (o *RoaringOps) SetBit(key string, offset int64, value int) (int, error) {
+	if value != 0 && value != 1 {
+		return 0, fmt.Errorf("ERR bit value must be 0 or 1")
+	}
+	if offset < 0 || offset > MaxOffset {
+		return 0, ErrOutOfBoundsOffset
+	}
+
+	mu := o.basicOps.getMutex(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	val, _ := o.basicOps.cache.Load(key)
+	r, ok := val.(*Roaring)
+	if !ok {
+		if bytes, ok := val.([]byte); ok {
+			r = RoaringFromBytes(bytes)
+		} else {
+			r = NewRoaring()
+		}
+		o.basicOps.cache.Store(key, r)
+	}
+	return o.basicOps.setRoaringBit(key, r, offset, value), nil
+}
+
+// SetIntArray replaces the bitmap at key by one with the given bits set
+func (o *RoaringOps) SetIntArray(key string, offsets []int64) error {
+	r := NewRoaring()
+	for _, offset := range offsets {
+		if offset < 0 || offset > MaxOffset {
+			return ErrOutOfBoundsOffset
+		}
+		r.Add(uint32(offset))
+	}
+	r.RunOptimize()
+	o.bitwiseOps.storeRoaring(key, r)
+	return nil
+}
+
+// BitOp performs a bitwise operation like BitwiseOps.BitOp, storing a
+// roaring bitmap, and returns the number of bits set in the result
+func (o *RoaringOps) BitOp(operation string, destkey string, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("ERR wrong number of arguments for 'r.bitop' command")
+	}
+	result, err := o.bitwiseOps.roaringBitOp(operation, keys...)
+	if err != nil {
+		return 0, err
+	}
+	o.bitwiseOps.storeRoaring(destkey, result)
+	return int64(result.Cardinality()), nil
+}
+
+// Card returns the number of bits set
+func (o *RoaringOps) Card(key string) int64 {
+	var card int64
+	o.basicOps.view(key, func(r *Roaring) {
+		card = int64(r.Cardinality())
+	})
+	return card
+}
+
+// Range returns the offsets of the bits set from start to end included
+func (o *RoaringOps) Range(key string, start, end int64) ([]int64, error) {
+	if start < 0 || end < 0 {
+		return nil, ErrOutOfBoundsOffset
+	}
+	var offsets []int64
+	o.basicOps.view(key, func(r *Roaring) {
+		r.Iterate(uint64(start), uint64(end)+1, func(x uint32) bool {
+			offsets = append(offsets, int64(x))
+			return true
+		})
+	})
+	return offsets, nil
+}
+
+// GetIntArray returns the offsets of all the bits set
+func (o *RoaringOps) GetIntArray(key string) []int64 {
+	offsets, _ := o.Range(key, 0, MaxOffset)
+	return offsets
+}
+
+// Min returns the offset of the first bit set, -1 if there is none
+func (o *RoaringOps) Min(key string) int64 {
+	min := int64(-1)
+	o.basicOps.view(key, func(r *Roaring) {
+		if x, ok := r.Minimum(); ok {
+			min = int64(x)
+		}
+	})
+	return min
+}
+
+// Max returns the offset of the last bit set, -1 if there is none
+func (o *RoaringOps) Max(key string) int64 {
+	max := int64(-1)
+	o.basicOps.view(key, func(r *Roaring) {
+		if x, ok := r.Maximum(); ok {
+			max = int64(x)
+		}
+	})
+	return max
+}
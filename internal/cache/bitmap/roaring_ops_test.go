@@ -0,0 +1,127 @@
+package bitmap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoaringOps(t *testing.T) {
+	cache := &sync.Map{}
+	version := &sync.Map{}
+	manager := NewManager(cache, version)
+
+	t.Run("SetBit far away stores a roaring bitmap", func(t *testing.T) {
+		old, err := manager.SetBit("sparse", 4000000000, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, old)
+		val, _ := cache.Load("sparse")
+		assert.IsType(t, &Roaring{}, val)
+
+		old, err = manager.SetBit("sparse", 4000000000, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, old)
+		bit, _ := manager.GetBit("sparse", 4000000000)
+		assert.Equal(t, 1, bit)
+		bit, _ = manager.GetBit("sparse", 3999999999)
+		assert.Equal(t, 0, bit)
+
+		_, err = manager.SetBit("sparse", MaxOffset+1, 1)
+		assert.Equal(t, ErrOutOfBoundsOffset, err)
+	})
+
+	t.Run("Counting matches the flat bitmap", func(t *testing.T) {
+		flat := []byte{0b10101010, 0b11110000, 0b00001111, 0}
+		cache.Store("flat", flat)
+		assert.True(t, manager.Copy("flat", "roaring"))
+		// Converts the copy
+		_, err := manager.RSetBit("roaring", 0, 1)
+		assert.NoError(t, err)
+		val, _ := cache.Load("roaring")
+		assert.IsType(t, &Roaring{}, val)
+
+		for _, r := range [][2]int64{{0, -1}, {1, 2}, {-2, -1}, {2, 1}} {
+			want, _ := manager.BitCount("flat", r[0], r[1])
+			got, _ := manager.BitCount("roaring", r[0], r[1])
+			// The roaring bitmap ends with its last set bit, the flat one
+			// has a trailing zero byte
+			if r[0] < 0 {
+				want, _ = manager.BitCount("flat", r[0]-1, r[1]-1)
+			}
+			assert.Equal(t, want, got, "BitCount(%d, %d)", r[0], r[1])
+		}
+
+		for _, bit := range []int{0, 1} {
+			for _, r := range [][2]int64{{0, -1}, {1, 2}} {
+				want, _ := manager.BitPos("flat", bit, r[0], r[1], false)
+				got, _ := manager.BitPos("roaring", bit, r[0], r[1], false)
+				assert.Equal(t, want, got, "BitPos(%d, %d, %d)", bit, r[0], r[1])
+			}
+		}
+		pos, _ := manager.BitPos("roaring", 1, 0, -1, true)
+		assert.Equal(t, int64(23), pos)
+		pos, _ = manager.BitPos("roaring", 0, 0, -1, true)
+		assert.Equal(t, int64(19), pos)
+	})
+
+	t.Run("BitOp mixes flat and roaring bitmaps", func(t *testing.T) {
+		cache.Store("a", []byte{0b11110000})
+		_, err := manager.RSetBit("b", 2, 1)
+		assert.NoError(t, err)
+		manager.RSetBit("b", 1000000, 1)
+
+		length, err := manager.BitOp("OR", "or", "a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1000000/8+1), length)
+		assert.Equal(t, []int64{0, 1, 2, 3, 1000000}, manager.RGetIntArray("or"))
+
+		card, err := manager.RBitOp("AND", "and", "a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), card)
+		assert.Equal(t, []int64{2}, manager.RGetIntArray("and"))
+
+		card, err = manager.RBitOp("NOT", "not", "a")
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{4, 5, 6, 7}, manager.RGetIntArray("not"))
+		assert.Equal(t, int64(4), card)
+
+		// An empty result deletes the destination
+		manager.RBitOp("AND", "and", "a", "missing")
+		_, exists := cache.Load("and")
+		assert.False(t, exists)
+
+		_, err = manager.RBitOp("NOT", "not", "a", "b")
+		assert.Error(t, err)
+	})
+
+	t.Run("Int arrays, ranges and bounds", func(t *testing.T) {
+		assert.NoError(t, manager.RSetIntArray("ints", []int64{5, 1, 70000, 4294967295, 1}))
+		assert.Equal(t, []int64{1, 5, 70000, 4294967295}, manager.RGetIntArray("ints"))
+		assert.Equal(t, int64(4), manager.RCard("ints"))
+		assert.Equal(t, int64(1), manager.RMin("ints"))
+		assert.Equal(t, int64(4294967295), manager.RMax("ints"))
+
+		offsets, err := manager.RRange("ints", 5, 70000)
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{5, 70000}, offsets)
+
+		assert.Equal(t, int64(-1), manager.RMin("missing"))
+		assert.Equal(t, int64(0), manager.RCard("missing"))
+		assert.Equal(t, ErrOutOfBoundsOffset, manager.RSetIntArray("ints", []int64{-1}))
+	})
+
+	t.Run("BitField on a roaring bitmap", func(t *testing.T) {
+		manager.RSetBit("field", 100, 0)
+		results, err := manager.BitField("field", []models.BitFieldCommand{
+			{Op: "SET", Type: "u8", Offset: 8, Value: 0b10100101},
+			{Op: "GET", Type: "u8", Offset: 8},
+			{Op: "GET", Type: "i4", Offset: 8},
+			{Op: "INCRBY", Type: "u8", Offset: 8, Increment: 1},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{0, 0b10100101, -6, 0b10100110}, results)
+		assert.Equal(t, []int64{8, 10, 13, 14}, manager.RGetIntArray("field"))
+	})
+}
@@ -0,0 +1,237 @@
+package bitmap
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomRoaring returns a bitmap mixing sparse, dense and run containers,
+// and the set of its offsets
+func randomRoaring(r *rand.Rand) (*Roaring, map[uint32]bool) {
+	bitmap := NewRoaring()
+	set := make(map[uint32]bool)
+	add := func(x uint32) {
+		bitmap.Add(x)
+		set[x] = true
+	}
+
+	for i := 0; i < 200; i++ {
+		add(r.Uint32())
+	}
+	// A dense container and a run
+	for i := 0; i < 10000; i++ {
+		add(1<<16 | uint32(r.Intn(1<<16)))
+	}
+	for x := uint32(3 << 16); x < 3<<16+20000; x++ {
+		add(x)
+	}
+	// The last offsets
+	add(math.MaxUint32)
+	add(math.MaxUint32 - 1)
+	bitmap.RunOptimize()
+	return bitmap, set
+}
+
+func sortedKeys(set map[uint32]bool) []uint32 {
+	keys := make([]uint32, 0, len(set))
+	for x := range set {
+		keys = append(keys, x)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func TestRoaring(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bitmap, set := randomRoaring(r)
+
+	t.Run("Contents", func(t *testing.T) {
+		assert.Equal(t, uint64(len(set)), bitmap.Cardinality())
+		assert.Equal(t, sortedKeys(set), bitmap.ToArray())
+		for i := 0; i < 10000; i++ {
+			x := r.Uint32()
+			if i%2 == 0 {
+				x = 1<<16 | uint32(r.Intn(1<<16))
+			}
+			assert.Equal(t, set[x], bitmap.Contains(x), "Contains(%d)", x)
+		}
+	})
+
+	t.Run("Run container", func(t *testing.T) {
+		i, _ := bitmap.index(3)
+		assert.Equal(t, runKind, bitmap.containers[i].kind)
+		i, _ = bitmap.index(1)
+		assert.Equal(t, bitmapKind, bitmap.containers[i].kind)
+	})
+
+	t.Run("Add and Remove", func(t *testing.T) {
+		clone := bitmap.Clone()
+		// Removing from the run container expands it
+		assert.True(t, clone.Remove(3<<16+5))
+		assert.False(t, clone.Remove(3<<16+5))
+		assert.False(t, clone.Contains(3<<16+5))
+		assert.True(t, clone.Add(3<<16+5))
+		assert.False(t, clone.Add(3<<16+5))
+		assert.Equal(t, bitmap.ToArray(), clone.ToArray())
+		// The clone is a copy
+		clone.Remove(math.MaxUint32)
+		assert.True(t, bitmap.Contains(math.MaxUint32))
+	})
+
+	t.Run("Array to bitmap and back", func(t *testing.T) {
+		b := NewRoaring()
+		for x := uint32(0); x <= arrayMaxSize; x++ {
+			b.Add(x * 2)
+		}
+		assert.Equal(t, bitmapKind, b.containers[0].kind)
+		b.Remove(0)
+		assert.Equal(t, arrayKind, b.containers[0].kind)
+		assert.Equal(t, uint64(arrayMaxSize), b.Cardinality())
+		for x := uint32(1); x <= arrayMaxSize; x++ {
+			b.Remove(x * 2)
+		}
+		assert.True(t, b.IsEmpty())
+	})
+
+	t.Run("Minimum and Maximum", func(t *testing.T) {
+		keys := sortedKeys(set)
+		min, ok := bitmap.Minimum()
+		assert.True(t, ok)
+		assert.Equal(t, keys[0], min)
+		max, ok := bitmap.Maximum()
+		assert.True(t, ok)
+		assert.Equal(t, uint32(math.MaxUint32), max)
+		assert.Equal(t, int64(1<<29), bitmap.ByteLen())
+
+		_, ok = NewRoaring().Minimum()
+		assert.False(t, ok)
+	})
+
+	t.Run("Next and Prev", func(t *testing.T) {
+		keys := sortedKeys(set)
+		for i := 0; i < 2000; i++ {
+			x := uint64(r.Uint32())
+			if i%2 == 0 {
+				x = 3<<16 + uint64(r.Intn(30000)) - 5000
+			}
+			j := sort.Search(len(keys), func(j int) bool { return uint64(keys[j]) >= x })
+
+			next, ok := bitmap.NextSet(x)
+			assert.Equal(t, j < len(keys), ok)
+			if ok {
+				assert.Equal(t, keys[j], next, "NextSet(%d)", x)
+			}
+			prev, ok := bitmap.PrevSet(x)
+			if j < len(keys) && uint64(keys[j]) == x {
+				assert.Equal(t, uint32(x), prev, "PrevSet(%d)", x)
+			} else {
+				assert.Equal(t, j > 0, ok)
+				if ok {
+					assert.Equal(t, keys[j-1], prev, "PrevSet(%d)", x)
+				}
+			}
+
+			clear := x
+			for set[uint32(clear)] {
+				clear++
+			}
+			assert.Equal(t, clear, bitmap.NextClear(x), "NextClear(%d)", x)
+			clear = x
+			for set[uint32(clear)] {
+				clear--
+			}
+			prevClear, ok := bitmap.PrevClear(x)
+			assert.True(t, ok)
+			assert.Equal(t, clear, prevClear, "PrevClear(%d)", x)
+		}
+
+		assert.Equal(t, uint64(1<<32), bitmap.NextClear(math.MaxUint32-1))
+		_, ok := RoaringRange(0, 100).PrevClear(50)
+		assert.False(t, ok)
+	})
+
+	t.Run("CountRange and Iterate", func(t *testing.T) {
+		keys := sortedKeys(set)
+		for i := 0; i < 200; i++ {
+			start := uint64(r.Uint32())
+			end := start + uint64(r.Intn(1<<20))
+			if i%2 == 0 {
+				start, end = 3<<16+uint64(r.Intn(20000)), 3<<16+uint64(r.Intn(40000))
+			}
+			var want []uint32
+			for _, x := range keys {
+				if uint64(x) >= start && uint64(x) < end {
+					want = append(want, x)
+				}
+			}
+			assert.Equal(t, uint64(len(want)), bitmap.CountRange(start, end))
+
+			var got []uint32
+			bitmap.Iterate(start, end, func(x uint32) bool {
+				got = append(got, x)
+				return true
+			})
+			assert.Equal(t, want, got)
+		}
+		assert.Equal(t, uint64(len(set)), bitmap.CountRange(0, 1<<32))
+	})
+
+	t.Run("Operations", func(t *testing.T) {
+		other, otherSet := randomRoaring(r)
+		tests := []struct {
+			name   string
+			result *Roaring
+			want   func(a, b bool) bool
+		}{
+			{"And", bitmap.And(other), func(a, b bool) bool { return a && b }},
+			{"Or", bitmap.Or(other), func(a, b bool) bool { return a || b }},
+			{"Xor", bitmap.Xor(other), func(a, b bool) bool { return a != b }},
+			{"AndNot", bitmap.AndNot(other), func(a, b bool) bool { return a && !b }},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				want := make(map[uint32]bool)
+				for x := range set {
+					if tt.want(true, otherSet[x]) {
+						want[x] = true
+					}
+				}
+				for x := range otherSet {
+					if tt.want(set[x], true) {
+						want[x] = true
+					}
+				}
+				assert.Equal(t, sortedKeys(want), tt.result.ToArray())
+			})
+		}
+	})
+}
+
+func TestRoaringFromBytes(t *testing.T) {
+	data := make([]byte, 1<<14)
+	data[0] = 0x80          // offset 0
+	data[1] = 0x01          // offset 15
+	data[1<<13] = 0x40      // offset 1<<16 + 1
+	data[len(data)-1] = 0x1 // the last offset
+	bitmap := RoaringFromBytes(data)
+	assert.Equal(t, []uint32{0, 15, 1<<16 + 1, 1<<17 - 1}, bitmap.ToArray())
+	assert.Equal(t, int64(len(data)), bitmap.ByteLen())
+}
+
+func TestRoaringRange(t *testing.T) {
+	bitmap := RoaringRange(65530, 1<<17+10)
+	assert.Equal(t, uint64(1<<17+10-65530), bitmap.Cardinality())
+	assert.True(t, bitmap.Contains(65530))
+	assert.False(t, bitmap.Contains(65529))
+	assert.True(t, bitmap.Contains(1<<17+9))
+	assert.False(t, bitmap.Contains(1<<17+10))
+	// Runs take a few bytes whatever their length
+	assert.Less(t, bitmap.SizeInBytes(), int64(100))
+
+	not := RoaringFromBytes([]byte{0xf0, 0x0f}).Xor(RoaringRange(0, 16))
+	assert.Equal(t, []uint32{4, 5, 6, 7, 8, 9, 10, 11}, not.ToArray())
+}
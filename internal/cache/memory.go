@@ -3,7 +3,9 @@ package cache
 import (
 	cryptorand "crypto/rand"
 	"fmt"
+	"hash/maphash"
 	"log"
+	"math"
 	"math/big"
 	mathrand "math/rand"
 	"runtime"
@@ -18,6 +20,9 @@ import (
 	"github.com/genc-murat/crystalcache/internal/cache/zset"
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+	"github.com/genc-murat/crystalcache/internal/search"
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
 	"github.com/genc-murat/crystalcache/pkg/utils/pattern"
 )
 
@@ -35,7 +40,6 @@ type MemoryCache struct {
 	streams       *sync.Map // stream entries
 	streamGroups  *sync.Map // stream consumer groups
 	bitmaps       *sync.Map
-	geoData       *sync.Map
 	suggestions   *sync.Map // suggestion dictionaries
 	cms           *sync.Map // Count-Min Sketches
 	hlls          *sync.Map
@@ -47,15 +51,42 @@ type MemoryCache struct {
 	lastDefrag    time.Time
 	defragMu      sync.Mutex
 	timeSeries    *sync.Map
+	tsIndex       *models.TimeSeriesIndex // time series labels
+	geoFences     *sync.Map               // geofences by geo set key
 
 	zsetManager   *zset.Manager
 	bitmapManager *bitmap.Manager
+	search        *search.Engine
+
+	jsonSchemaMu sync.RWMutex
+	jsonSchemas  map[string]*jsonUtil.Schema // JSON.SCHEMA rules by key pattern
 
 	patternMatcher *pattern.Matcher
 
 	lastAccessed *sync.Map
+
+	latency   atomic.Pointer[metrics.LatencyMonitor]
+	publisher atomic.Pointer[func(channel, message string) int]
+	notifier  atomic.Pointer[func(class byte, event, key string)]
+
+	memoryLimit     atomic.Int64
+	limitOnce       sync.Once
+	defragInterval  atomic.Int64  // nanoseconds
+	defragThreshold atomic.Uint64 // float64 bits
+	defragOnce      sync.Once
+
+	listFill          atomic.Int64 // list-max-listpack-size
+	listCompressDepth atomic.Int64 // list-compress-depth
+
+	keyLocks [keyLockStripes]sync.Mutex
 }
 
+// keyLockStripes is the number of locks lockKey spreads the keys over
+const keyLockStripes = 256
+
+// keyLockSeed hashes keys to their lock stripe
+var keyLockSeed = maphash.MakeSeed()
+
 func NewMemoryCache() *MemoryCache {
 	config := models.BloomFilterConfig{
 		ExpectedItems:     1000000,
@@ -76,7 +107,6 @@ func NewMemoryCache() *MemoryCache {
 		streams:        &sync.Map{},
 		streamGroups:   &sync.Map{},
 		bitmaps:        &sync.Map{},
-		geoData:        &sync.Map{},
 		suggestions:    &sync.Map{},
 		cms:            &sync.Map{},
 		cuckooFilters:  &sync.Map{},
@@ -86,8 +116,11 @@ func NewMemoryCache() *MemoryCache {
 		tdigests:       &sync.Map{},
 		topks:          &sync.Map{},
 		timeSeries:     &sync.Map{},
+		tsIndex:        models.NewTimeSeriesIndex(),
+		geoFences:      &sync.Map{},
 		patternMatcher: pattern.NewMatcher(),
 		lastAccessed:   &sync.Map{},
+		jsonSchemas:    make(map[string]*jsonUtil.Schema),
 	}
 
 	// Start background cleanup
@@ -100,6 +133,7 @@ func NewMemoryCache() *MemoryCache {
 
 	mc.zsetManager = zset.NewManager(mc.zsets, mc.keyVersions)
 	mc.bitmapManager = bitmap.NewManager(mc.bitmaps, mc.keyVersions)
+	mc.search = search.NewEngine(searchSource{c: mc})
 
 	return mc
 }
@@ -109,25 +143,185 @@ func init() {
 	mathrand.Seed(time.Now().UnixNano())
 }
 
+// SetLatencyMonitor makes the expire, eviction and defragmentation cycles
+// report their duration to monitor.
+func (c *MemoryCache) SetLatencyMonitor(monitor *metrics.LatencyMonitor) {
+	c.latency.Store(monitor)
+}
+
+// SetPublisher makes the cache publish its events, such as geofence
+// crossings, with publish.
+func (c *MemoryCache) SetPublisher(publish func(channel, message string) int) {
+	c.publisher.Store(&publish)
+}
+
+// publish publishes message on channel, if there is a publisher
+func (c *MemoryCache) publish(channel, message string) {
+	if publish := c.publisher.Load(); publish != nil {
+		(*publish)(channel, message)
+	}
+}
+
+// SetKeyspaceNotifier makes the cache report the keys it expires or evicts
+// by itself, as the expired and evicted keyspace events.
+func (c *MemoryCache) SetKeyspaceNotifier(notify func(class byte, event, key string)) {
+	c.notifier.Store(&notify)
+}
+
+// notifyKeyspaceEvent reports an event, if there is a notifier
+func (c *MemoryCache) notifyKeyspaceEvent(class byte, event, key string) {
+	if notify := c.notifier.Load(); notify != nil {
+		(*notify)(class, event, key)
+	}
+}
+
+// lockKey locks key against the other read-check-write sequences on it,
+// such as SET NX and the expiry of its old value, and returns the function
+// unlocking it. Keys share locks, so the caller must not lock another key
+// before unlocking.
+func (c *MemoryCache) lockKey(key string) (unlock func()) {
+	mu := &c.keyLocks[maphash.String(keyLockSeed, key)%keyLockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// expireKey deletes key once its time to live has passed, counting and
+// notifying the expiry. A key written again meanwhile is left alone.
+func (c *MemoryCache) expireKey(key string) {
+	unlock := c.lockKey(key)
+	if !c.expired(key) {
+		unlock()
+		return
+	}
+	deleted, _ := c.Del(key)
+	unlock()
+	if !deleted {
+		return
+	}
+	if c.stats != nil {
+		atomic.AddInt64(&c.stats.expiredKeys, 1)
+	}
+	c.notifyKeyspaceEvent('x', "expired", key)
+}
+
 func (c *MemoryCache) cleanExpired() {
 	now := time.Now()
 	c.expires.Range(func(key, expireTime interface{}) bool {
 		if expTime, ok := expireTime.(time.Time); ok && now.After(expTime) {
-			c.strings.Delete(key)
-			c.expires.Delete(key)
+			c.expireKey(key.(string))
 		}
 		return true
 	})
+	c.latency.Load().Observe(metrics.LatencyEventExpireCycle, time.Since(now))
 }
 
+// SetJSON stores a JSON value, rejecting it if it violates a schema
+// registered with JSONSchemaSet for the key.
 func (c *MemoryCache) SetJSON(key string, value interface{}) error {
-	c.jsonData.Store(key, value)
+	doc, err := jsonUtil.EncodeDocument(value)
+	if err != nil {
+		return fmt.Errorf("ERR %v", err)
+	}
+	return c.storeJSON(key, doc, func() interface{} { return value })
+}
+
+// SetJSONDocument is SetJSON for a value that is already encoded.
+func (c *MemoryCache) SetJSONDocument(key string, doc *jsonUtil.Document) error {
+	return c.storeJSON(key, doc, doc.Decode)
+}
+
+// storeJSON stores doc once the schemas covering key accept it; value is
+// only called to get the decoded document when a schema applies.
+func (c *MemoryCache) storeJSON(key string, doc *jsonUtil.Document, value func() interface{}) error {
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	if err := c.validateJSON(key, value); err != nil {
+		return err
+	}
+	c.jsonData.Store(key, doc)
 	c.incrementKeyVersion(key)
 	return nil
 }
 
+// validateJSON checks a document for key against the schemas covering key.
+// The caller holds jsonSchemaMu.
+func (c *MemoryCache) validateJSON(key string, value func() interface{}) error {
+	if !c.coversJSONSchema(key) {
+		return nil
+	}
+	return c.checkJSONSchemas(key, value())
+}
+
+// UpdateJSON replaces the document at key with the one fn derives from it,
+// with no other update of key in between. fn gets the stored document, or
+// nil if there is none, and returns it unchanged to leave the key alone or
+// nil to delete it. The new document is checked against the schemas as
+// for SetJSONDocument.
+func (c *MemoryCache) UpdateJSON(key string, fn func(doc *jsonUtil.Document) (*jsonUtil.Document, error)) error {
+	unlock := c.lockKey(key)
+	defer unlock()
+
+	for {
+		stored, exists := c.jsonData.Load(key)
+		var doc *jsonUtil.Document
+		if exists {
+			doc = stored.(*jsonUtil.Document)
+		}
+		updated, err := fn(doc)
+		if err != nil || updated == doc {
+			return err
+		}
+
+		// Writers that do not take the key lock, such as DEL or a plain
+		// JSON.SET, make the update start over from their result
+		swapped, err := c.swapJSON(key, stored, exists, updated)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			c.incrementKeyVersion(key)
+			return nil
+		}
+	}
+}
+
+// swapJSON replaces the document at key with doc, deleting it if doc is
+// nil, provided that key still holds stored, or nothing unless exists.
+func (c *MemoryCache) swapJSON(key string, stored interface{}, exists bool, doc *jsonUtil.Document) (bool, error) {
+	if doc == nil {
+		return c.jsonData.CompareAndDelete(key, stored), nil
+	}
+
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	if err := c.validateJSON(key, doc.Decode); err != nil {
+		return false, err
+	}
+	if exists {
+		return c.jsonData.CompareAndSwap(key, stored, doc), nil
+	}
+	_, loaded := c.jsonData.LoadOrStore(key, doc)
+	return !loaded, nil
+}
+
+// GetJSON returns the JSON value stored at key, decoded into a new tree
+// the caller may modify.
 func (c *MemoryCache) GetJSON(key string) (interface{}, bool) {
-	return c.jsonData.Load(key)
+	doc, ok := c.GetJSONDocument(key)
+	if !ok {
+		return nil, false
+	}
+	return doc.Decode(), true
+}
+
+// GetJSONDocument returns the document stored at key. Documents are
+// immutable and may be shared.
+func (c *MemoryCache) GetJSONDocument(key string) (*jsonUtil.Document, bool) {
+	doc, ok := c.jsonData.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return doc.(*jsonUtil.Document), true
 }
 
 func (c *MemoryCache) DeleteJSON(key string) bool {
@@ -161,11 +355,7 @@ func (c *MemoryCache) Expire(key string, seconds int) error {
 			// Check if the key still exists with the same expiration time
 			if expTime, exists := c.expires.Load(key); exists {
 				if expTime.(time.Time).Equal(expirationTime) {
-					c.Del(key) // Use the unified delete function
-					// Increment expired keys counter
-					if c.stats != nil {
-						atomic.AddInt64(&c.stats.expiredKeys, 1)
-					}
+					c.expireKey(key)
 				}
 			}
 		}()
@@ -177,7 +367,7 @@ func (c *MemoryCache) Expire(key string, seconds int) error {
 // TTL implementation with sync.Map
 func (c *MemoryCache) TTL(key string) int {
 	// Check if key exists
-	if _, exists := c.strings.Load(key); !exists {
+	if !c.Exists(key) {
 		return -2
 	}
 
@@ -191,13 +381,7 @@ func (c *MemoryCache) TTL(key string) int {
 	ttl := int(time.Until(expireTime).Seconds())
 	if ttl < 0 {
 		// Key has expired, clean it up
-		go func() {
-			c.strings.Delete(key)
-			c.expires.Delete(key)
-			if c.stats != nil {
-				atomic.AddInt64(&c.stats.expiredKeys, 1)
-			}
-		}()
+		go c.expireKey(key)
 		return -2
 	}
 	return ttl
@@ -262,226 +446,97 @@ func (c *MemoryCache) BatchTTL(keys []string) map[string]int {
 	return results
 }
 
-type ListOp struct {
-	Op     string
-	Key    string
-	Value  string
-	Values []string
-	Index  int
+// listEntry holds a list with its own lock, so that operations on a list
+// apply one at a time while different lists do not contend
+type listEntry struct {
+	mu   sync.Mutex
+	list *models.QuickList
 }
 
-type ListOpResult struct {
-	Value interface{}
-	Error error
+// SetListConfig sets the node fill factor and compress depth of the lists
+// created from now on, as list-max-listpack-size and list-compress-depth
+func (c *MemoryCache) SetListConfig(fill, compressDepth int) {
+	c.listFill.Store(int64(fill))
+	c.listCompressDepth.Store(int64(compressDepth))
 }
 
-func (c *MemoryCache) execListOp(op ListOp) (interface{}, error) {
-	// Get list from pool
-	listPool := sync.Pool{
-		New: func() interface{} {
-			list := make([]string, 0, 16) // Initial capacity of 16
-			return &list
-		},
-	}
-
-	for i := 0; i < maxRetries; i++ {
-		var list []string
-		oldListI, loaded := c.lists.LoadOrStore(op.Key, listPool.Get())
-		oldList := oldListI.(*[]string)
-
-		// If not loaded (new key), initialize empty list
-		if !loaded {
-			list = make([]string, 0, 16)
-		} else {
-			initialCap := cap(*oldList)
-			neededCap := len(*oldList)
-			if len(op.Values) > 0 {
-				neededCap += len(op.Values)
-			} else if op.Value != "" {
-				neededCap += 1
-			}
-			if initialCap < neededCap {
-				initialCap = neededCap * 2
-			}
-			list = make([]string, len(*oldList), initialCap)
-			copy(list, *oldList)
-		}
-
-		result, newList, err := c.processListOp(op, oldList, &list)
-		if err != nil {
-			if !loaded {
-				listPool.Put(oldListI)
-			}
-			return nil, err
-		}
-
-		// Try to update the list
-		if c.lists.CompareAndSwap(op.Key, oldListI, newList) {
-			// Return old list to pool if it was newly created
-			if !loaded {
-				listPool.Put(oldListI)
-			}
-
-			// If list is empty after operation, remove it
-			if len(*newList) == 0 {
-				c.lists.Delete(op.Key)
-				listPool.Put(newList)
-			}
-
-			c.incrementKeyVersion(op.Key)
-
-			// Update stats
-			if c.stats != nil {
-				atomic.AddInt64(&c.stats.cmdCount, 1)
-			}
-
-			return result, nil
-		}
-
-		// If CAS failed, return new list to pool
-		listPool.Put(&list)
-	}
-
-	return nil, fmt.Errorf("failed to execute list operation after %d retries", maxRetries)
+func (c *MemoryCache) newListEntry() *listEntry {
+	return &listEntry{list: models.NewQuickList(int(c.listFill.Load()), int(c.listCompressDepth.Load()))}
 }
 
-func (c *MemoryCache) processListOp(op ListOp, oldList *[]string, newList *[]string) (interface{}, *[]string, error) {
-	switch op.Op {
-	case "LPUSH":
-		if len(op.Values) > 0 {
-			// Değerleri ters sırada eklememiz gerekiyor çünkü LPUSH listenin başına ekler
-			for i := len(op.Values) - 1; i >= 0; i-- {
-				*newList = append([]string{op.Values[i]}, *newList...)
+// withList runs fn on the list at key while holding its lock, creating the
+// list first if create is set. It returns false without running fn if
+// there is no list at key. fn reports whether it modified the list, and a
+// list it leaves empty is deleted.
+func (c *MemoryCache) withList(key string, create bool, fn func(list *models.QuickList) bool) bool {
+	for {
+		entryI, exists := c.lists.Load(key)
+		if !exists {
+			if !create {
+				return false
 			}
-			return len(*newList), newList, nil
-		} else if op.Value != "" {
-			*newList = append([]string{op.Value}, *newList...)
-			return len(*newList), newList, nil
-		}
-		return 0, newList, fmt.Errorf("LPUSH called without values")
-	case "RPUSH":
-		if len(op.Values) > 0 {
-			*newList = append(*newList, op.Values...)
-			return len(*newList), newList, nil
-		} else if op.Value != "" {
-			*newList = append(*newList, op.Value)
-			return len(*newList), newList, nil
+			entryI, _ = c.lists.LoadOrStore(key, c.newListEntry())
 		}
-		return 0, newList, fmt.Errorf("RPUSH called without values")
 
-	case "LPOP":
-		if len(*oldList) == 0 {
-			return "", nil, nil
+		entry := entryI.(*listEntry)
+		entry.mu.Lock()
+		if current, ok := c.lists.Load(key); !ok || current != entryI {
+			// Deleted or replaced while waiting for the lock
+			entry.mu.Unlock()
+			continue
 		}
-		result := (*oldList)[0]
-		*newList = append(*newList, (*oldList)[1:]...)
-		return result, newList, nil
 
-	case "RPOP":
-		if len(*oldList) == 0 {
-			return "", nil, nil
+		modified := fn(entry.list)
+		if entry.list.Len() == 0 {
+			c.lists.CompareAndDelete(key, entryI)
 		}
-		lastIdx := len(*oldList) - 1
-		result := (*oldList)[lastIdx]
-		*newList = append(*newList, (*oldList)[:lastIdx]...)
-		return result, newList, nil
-
-	case "LSET":
-		if op.Index < 0 {
-			op.Index = len(*oldList) + op.Index
-		}
-		if op.Index < 0 || op.Index >= len(*oldList) {
-			return nil, nil, fmt.Errorf("ERR index out of range")
-		}
-		*newList = append(*newList, *oldList...)
-		(*newList)[op.Index] = op.Value
-		return "OK", newList, nil
-
-	default:
-		return nil, nil, fmt.Errorf("ERR unknown operation %s", op.Op)
-	}
-}
-
-const maxRetries = 3
-
-// Helper functions for common list operations
-func (c *MemoryCache) getListLength(key string) int {
-	if listI, ok := c.lists.Load(key); ok {
-		list := listI.(*[]string)
-		return len(*list)
-	}
-	return 0
-}
+		entry.mu.Unlock()
 
-func (c *MemoryCache) checkListExists(key string) bool {
-	_, ok := c.lists.Load(key)
-	return ok
-}
-
-func (c *MemoryCache) execBatchListOps(ops []ListOp) []ListOpResult {
-	results := make([]ListOpResult, len(ops))
-
-	// Execute operations sequentially to maintain order
-	for i, op := range ops {
-		value, err := c.execListOp(op)
-		results[i] = ListOpResult{
-			Value: value,
-			Error: err,
+		if modified {
+			c.incrementKeyVersion(key)
 		}
+		return true
 	}
-
-	return results
 }
 
 func (c *MemoryCache) LPush(key string, values ...string) (int, error) {
-	result, err := c.execListOp(ListOp{Op: "LPUSH", Key: key, Values: values})
-	if err != nil {
-		return 0, err
+	if len(values) == 0 {
+		return 0, fmt.Errorf("LPUSH called without values")
 	}
-	return result.(int), nil
+
+	var length int
+	c.withList(key, true, func(list *models.QuickList) bool {
+		for _, value := range values {
+			list.PushFront(value)
+		}
+		length = list.Len()
+		return true
+	})
+	return length, nil
 }
 
 func (c *MemoryCache) RPush(key string, values ...string) (int, error) {
-	result, err := c.execListOp(ListOp{Op: "RPUSH", Key: key, Values: values}) // Values alanını ekledik
-	if err != nil {
-		return 0, err
+	if len(values) == 0 {
+		return 0, fmt.Errorf("RPUSH called without values")
 	}
-	return result.(int), nil
+
+	var length int
+	c.withList(key, true, func(list *models.QuickList) bool {
+		for _, value := range values {
+			list.PushBack(value)
+		}
+		length = list.Len()
+		return true
+	})
+	return length, nil
 }
 
 func (c *MemoryCache) LRange(key string, start, stop int) ([]string, error) {
-	// Load the list from sync.Map
-	listI, exists := c.lists.Load(key)
-	if !exists {
-		return []string{}, nil
-	}
-
-	// Type assertion
-	list := listI.(*[]string)
-	length := len(*list)
-
-	// Adjust negative indices
-	if start < 0 {
-		start = length + start
-	}
-	if stop < 0 {
-		stop = length + stop
-	}
-
-	// Boundary checks
-	if start < 0 {
-		start = 0
-	}
-	if stop >= length {
-		stop = length - 1
-	}
-	if start > stop {
-		return []string{}, nil
-	}
-
-	// Create result slice with exact capacity needed
-	result := make([]string, stop-start+1)
-	copy(result, (*list)[start:stop+1])
+	result := []string{}
+	c.withList(key, false, func(list *models.QuickList) bool {
+		result = list.Range(start, stop)
+		return false
+	})
 
 	// Update stats if needed
 	if c.stats != nil {
@@ -515,97 +570,47 @@ func (c *MemoryCache) BatchLRange(ranges map[string][2]int) map[string][]string
 
 // List Operations
 func (c *MemoryCache) LLen(key string) int {
-	if listI, ok := c.lists.Load(key); ok {
-		list := listI.(*[]string)
-		return len(*list)
-	}
-	return 0
+	var length int
+	c.withList(key, false, func(list *models.QuickList) bool {
+		length = list.Len()
+		return false
+	})
+	return length
 }
 
 func (c *MemoryCache) LPop(key string) (string, bool) {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return "", false
-		}
-
-		list := listI.(*[]string)
-		if len(*list) == 0 {
-			c.lists.Delete(key)
-			return "", false
-		}
-
-		value := (*list)[0]
-		newList := make([]string, len(*list)-1)
-		copy(newList, (*list)[1:])
-
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-
-			if len(newList) == 0 {
-				c.lists.Delete(key)
-			}
-
-			return value, true
-		}
-	}
+	var value string
+	var ok bool
+	c.withList(key, false, func(list *models.QuickList) bool {
+		value, ok = list.PopFront()
+		return ok
+	})
+	return value, ok
 }
 
 func (c *MemoryCache) RPop(key string) (string, bool) {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return "", false
-		}
-
-		list := listI.(*[]string)
-		if len(*list) == 0 {
-			c.lists.Delete(key)
-			return "", false
-		}
-
-		lastIdx := len(*list) - 1
-		value := (*list)[lastIdx]
-		newList := make([]string, lastIdx)
-		copy(newList, (*list)[:lastIdx])
-
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-
-			if len(newList) == 0 {
-				c.lists.Delete(key)
-			}
-
-			return value, true
-		}
-	}
+	var value string
+	var ok bool
+	c.withList(key, false, func(list *models.QuickList) bool {
+		value, ok = list.PopBack()
+		return ok
+	})
+	return value, ok
 }
 
 func (c *MemoryCache) LSet(key string, index int, value string) error {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return fmt.Errorf("ERR no such key")
-		}
-
-		list := listI.(*[]string)
-		if index < 0 {
-			index = len(*list) + index
-		}
-
-		if index < 0 || index >= len(*list) {
-			return fmt.Errorf("ERR index out of range")
-		}
-
-		newList := make([]string, len(*list))
-		copy(newList, *list)
-		newList[index] = value
-
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-			return nil
-		}
+	var ok bool
+	exists := c.withList(key, false, func(list *models.QuickList) bool {
+		ok = list.Set(index, value)
+		return ok
+	})
+	if !exists {
+		return fmt.Errorf("ERR no such key")
+	}
+	if !ok {
+		return fmt.Errorf("ERR index out of range")
 	}
+	return nil
 }
 
 func (c *MemoryCache) Type(key string) string {
@@ -633,9 +638,6 @@ func (c *MemoryCache) Type(key string) string {
 	if _, exists := c.streams.Load(key); exists {
 		return "stream"
 	}
-	if _, exists := c.geoData.Load(key); exists {
-		return "geo"
-	}
 	if _, exists := c.suggestions.Load(key); exists {
 		return "suggestion"
 	}
@@ -847,6 +849,8 @@ func (c *MemoryCache) FlushAll() {
 		}
 	}()
 
+	c.search.Reset()
+
 	// Update stats
 	if c.stats != nil {
 		atomic.AddInt64(&c.stats.cmdCount, 1)
@@ -919,6 +923,22 @@ func (s *Stats) GetStats() map[string]int64 {
 	}
 }
 
+// Reset zeroes the counters, as CONFIG RESETSTAT does.
+func (s *Stats) Reset() {
+	atomic.StoreInt64(&s.cmdCount, 0)
+	atomic.StoreInt64(&s.evictedKeys, 0)
+	atomic.StoreInt64(&s.expiredKeys, 0)
+	atomic.StoreInt64(&s.hits, 0)
+	atomic.StoreInt64(&s.misses, 0)
+}
+
+// ResetStats clears the keyspace statistics.
+func (c *MemoryCache) ResetStats() {
+	if c.stats != nil {
+		c.stats.Reset()
+	}
+}
+
 func (c *MemoryCache) IncrCommandCount() {
 	if c.stats != nil {
 		atomic.AddInt64(&c.stats.cmdCount, 1)
@@ -926,63 +946,11 @@ func (c *MemoryCache) IncrCommandCount() {
 }
 
 func (c *MemoryCache) LRem(key string, count int, value string) (int, error) {
-	listI, exists := c.lists.Load(key)
-	if !exists {
-		return 0, nil
-	}
-
-	list := listI.(*[]string)
-	removed := 0
-	newList := make([]string, 0, len(*list))
-
-	if count > 0 {
-		for _, v := range *list {
-			if v == value && removed < count {
-				removed++
-				continue
-			}
-			newList = append(newList, v)
-		}
-	} else if count < 0 {
-		matches := make([]int, 0)
-		for i, v := range *list {
-			if v == value {
-				matches = append(matches, i)
-			}
-		}
-
-		removeIndices := make(map[int]bool)
-		for i := 0; i < len(matches) && i < -count; i++ {
-			removeIndices[matches[len(matches)-1-i]] = true
-		}
-
-		for i, v := range *list {
-			if !removeIndices[i] {
-				newList = append(newList, v)
-			} else {
-				removed++
-			}
-		}
-	} else {
-		for _, v := range *list {
-			if v != value {
-				newList = append(newList, v)
-			} else {
-				removed++
-			}
-		}
-	}
-
-	if removed > 0 {
-		c.incrementKeyVersion(key)
-	}
-
-	if len(newList) == 0 {
-		c.lists.Delete(key)
-	} else {
-		c.lists.Store(key, &newList)
-	}
-
+	var removed int
+	c.withList(key, false, func(list *models.QuickList) bool {
+		removed = list.Remove(count, value)
+		return removed > 0
+	})
 	return removed, nil
 }
 
@@ -1022,9 +990,35 @@ func (c *MemoryCache) Rename(oldKey, newKey string) error {
 		return nil
 	}
 
+	if _, exists = c.jsonData.Load(oldKey); exists {
+		if err := c.renameJSON(oldKey, newKey); err != nil {
+			return err
+		}
+		if expTime, hasExp := c.expires.LoadAndDelete(oldKey); hasExp {
+			c.expires.Store(newKey, expTime)
+		}
+		c.incrementKeyVersion(oldKey)
+		return nil
+	}
+
 	return fmt.Errorf("ERR no such key")
 }
 
+// renameJSON moves the document at oldKey to newKey. The schemas covering
+// newKey must accept it; if they do not, the document stays at oldKey.
+func (c *MemoryCache) renameJSON(oldKey, newKey string) error {
+	value, exists := c.jsonData.Load(oldKey)
+	if !exists {
+		return nil
+	}
+	doc := value.(*jsonUtil.Document)
+	if err := c.storeJSON(newKey, doc, doc.Decode); err != nil {
+		return err
+	}
+	c.jsonData.CompareAndDelete(oldKey, value)
+	return nil
+}
+
 func (c *MemoryCache) Info() map[string]string {
 	stats := make(map[string]string)
 
@@ -1050,7 +1044,7 @@ func (c *MemoryCache) Info() map[string]string {
 	// Keys count
 	var stringKeys, hashKeys, listKeys, setKeys, jsonKeys,
 		streamKeys, bitmapKeys, zsetKeys, suggestionKeys,
-		geoKeys, cmsKeys, cuckooKeys, tdigestKeys, bloomFilterKeys,
+		cmsKeys, cuckooKeys, tdigestKeys, bloomFilterKeys,
 		timeseriesKeys int
 
 	c.strings.Range(func(_, _ interface{}) bool {
@@ -1107,12 +1101,6 @@ func (c *MemoryCache) Info() map[string]string {
 	})
 	stats["suggestion_keys"] = fmt.Sprintf("%d", suggestionKeys)
 
-	c.geoData.Range(func(_, _ interface{}) bool {
-		geoKeys++
-		return true
-	})
-	stats["geo_keys"] = fmt.Sprintf("%d", geoKeys)
-
 	c.cms.Range(func(_, _ interface{}) bool {
 		cmsKeys++
 		return true
@@ -1162,7 +1150,7 @@ func (c *MemoryCache) Info() map[string]string {
 	// Total keys
 	totalKeys := stringKeys + hashKeys + listKeys + setKeys + jsonKeys +
 		streamKeys + bitmapKeys + zsetKeys + suggestionKeys +
-		geoKeys + cmsKeys + cuckooKeys + hllKeys + tdigestKeys +
+		cmsKeys + cuckooKeys + hllKeys + tdigestKeys +
 		bloomFilterKeys + topkKeys + timeseriesKeys
 	stats["total_keys"] = fmt.Sprintf("%d", totalKeys)
 
@@ -1375,6 +1363,7 @@ func (c *MemoryCache) incrementKeyVersion(key string) {
 			break
 		}
 	}
+	c.search.Notify(key)
 }
 
 func (c *MemoryCache) GetKeyVersion(key string) int64 {
@@ -1520,6 +1509,11 @@ func (c *MemoryCache) Defragment() {
 	c.defragMu.Lock()
 	defer c.defragMu.Unlock()
 
+	start := time.Now()
+	defer func() {
+		c.latency.Load().Observe(metrics.LatencyEventDefrag, time.Since(start))
+	}()
+
 	c.defragStrings()
 	c.defragHashes()
 	c.defragLists()
@@ -1529,9 +1523,7 @@ func (c *MemoryCache) Defragment() {
 	c.defragStreamGroups()
 	c.defragBitmaps()
 
-	c.defragGeoData()
 	c.defragCMS()
-	c.defragSuggestions()
 	c.defragCuckooFilters()
 	c.defragHLL()
 	c.defragTDigests()
@@ -1572,8 +1564,9 @@ func (c *MemoryCache) defragStreamGroups() {
 
 func (c *MemoryCache) defragBitmaps() {
 	c.bitmaps.Range(func(key, bitmapI interface{}) bool {
-		bitmap := bitmapI.([]byte)
-		if cap(bitmap) > 2*len(bitmap) {
+		// Roaring bitmaps are compact already
+		bitmap, ok := bitmapI.([]byte)
+		if ok && cap(bitmap) > 2*len(bitmap) {
 			newBitmap := make([]byte, len(bitmap))
 			copy(newBitmap, bitmap)
 			c.bitmaps.Store(key, newBitmap)
@@ -1583,13 +1576,11 @@ func (c *MemoryCache) defragBitmaps() {
 }
 
 func (c *MemoryCache) defragLists() {
-	c.lists.Range(func(key, listI interface{}) bool {
-		list := listI.(*[]string)
-		if cap(*list) > 2*len(*list) {
-			newList := make([]string, len(*list))
-			copy(newList, *list)
-			c.lists.Store(key, &newList)
-		}
+	c.lists.Range(func(_, entryI interface{}) bool {
+		entry := entryI.(*listEntry)
+		entry.mu.Lock()
+		entry.list.Compact()
+		entry.mu.Unlock()
 		return true
 	})
 }
@@ -1611,24 +1602,37 @@ func (c *MemoryCache) GetDefragStats() map[string]interface{} {
 
 // StartDefragmentation starts automatic defragmentation based on memory threshold
 func (c *MemoryCache) StartDefragmentation(interval time.Duration, threshold float64) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
+	c.SetDefragConfig(interval, threshold)
+	c.defragOnce.Do(func() {
+		go c.defragLoop()
+	})
+}
 
-		for range ticker.C {
-			stats := c.GetMemoryStats()
-			fragPercent := float64(stats.FragmentedBytes) / float64(stats.TotalMemory)
+// SetDefragConfig changes the interval and fragmentation threshold of the
+// background defragmentation started by StartDefragmentation. The new
+// interval takes effect after the current one elapses.
+func (c *MemoryCache) SetDefragConfig(interval time.Duration, threshold float64) {
+	c.defragInterval.Store(int64(interval))
+	c.defragThreshold.Store(math.Float64bits(threshold))
+}
+
+func (c *MemoryCache) defragLoop() {
+	for {
+		time.Sleep(time.Duration(c.defragInterval.Load()))
 
-			if fragPercent > threshold {
-				log.Printf("Starting defragmentation. Fragmentation: %.2f%%", fragPercent*100)
-				c.Defragment()
+		threshold := math.Float64frombits(c.defragThreshold.Load())
+		stats := c.GetMemoryStats()
+		fragPercent := float64(stats.FragmentedBytes) / float64(stats.TotalMemory)
 
-				// Log stats after defragmentation
-				newStats := c.GetMemoryStats() // Using GetMemoryStats for simplicity, can create GetDefragStats if needed
-				log.Printf("Defragmentation completed. New heap objects: %v", newStats.HeapObjects())
-			}
+		if fragPercent > threshold {
+			log.Printf("Starting defragmentation. Fragmentation: %.2f%%", fragPercent*100)
+			c.Defragment()
+
+			// Log stats after defragmentation
+			newStats := c.GetMemoryStats() // Using GetMemoryStats for simplicity, can create GetDefragStats if needed
+			log.Printf("Defragmentation completed. New heap objects: %v", newStats.HeapObjects())
 		}
-	}()
+	}
 }
 
 // GetMemoryStats returns memory statistics
@@ -1778,11 +1782,7 @@ func (c *MemoryCache) ExpireAt(key string, timestamp int64) error {
 		// Check if the key still exists with the same expiration time
 		if expTime, exists := c.expires.Load(key); exists {
 			if expTime.(time.Time).Equal(expireTime) {
-				c.Del(key)
-				// Increment expired keys counter
-				if c.stats != nil {
-					atomic.AddInt64(&c.stats.expiredKeys, 1)
-				}
+				c.expireKey(key)
 			}
 		}
 	}()
@@ -1810,12 +1810,7 @@ func (c *MemoryCache) ExpireTime(key string) (int64, error) {
 	expireTime := expireTimeI.(time.Time)
 	// If the key has already expired, remove it and return -2
 	if time.Now().After(expireTime) {
-		go func() {
-			c.Del(key)
-			if c.stats != nil {
-				atomic.AddInt64(&c.stats.expiredKeys, 1)
-			}
-		}()
+		go c.expireKey(key)
 		return -2, nil
 	}
 
@@ -1823,116 +1818,38 @@ func (c *MemoryCache) ExpireTime(key string) (int64, error) {
 }
 
 func (c *MemoryCache) LIndex(key string, index int) (string, bool) {
-	// Load the list from sync.Map
-	listI, exists := c.lists.Load(key)
-	if !exists {
-		return "", false
-	}
-
-	list := listI.(*[]string)
-	length := len(*list)
-
-	// Handle negative indices by converting to positive
-	if index < 0 {
-		index = length + index
-	}
-
-	// Check bounds
-	if index < 0 || index >= length {
-		return "", false
-	}
-
-	// Return element at index
-	return (*list)[index], true
+	var value string
+	var ok bool
+	c.withList(key, false, func(list *models.QuickList) bool {
+		value, ok = list.Index(index)
+		return false
+	})
+	return value, ok
 }
 
 func (c *MemoryCache) LInsert(key string, before bool, pivot string, value string) (int, error) {
-	for {
-		// Load or create the list
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return 0, nil // Return 0 if key doesn't exist
-		}
-
-		list := listI.(*[]string)
-		pivotIndex := -1
-
-		// Find pivot element
-		for i, element := range *list {
-			if element == pivot {
-				pivotIndex = i
-				break
-			}
-		}
-
-		// If pivot wasn't found, return -1
-		if pivotIndex == -1 {
-			return -1, nil
-		}
-
-		// Create new list with appropriate capacity
-		newList := make([]string, len(*list)+1)
-
-		if before {
-			// Copy elements before pivot
-			copy(newList, (*list)[:pivotIndex])
-			// Insert new value
-			newList[pivotIndex] = value
-			// Copy remaining elements
-			copy(newList[pivotIndex+1:], (*list)[pivotIndex:])
-		} else {
-			// Copy elements up to and including pivot
-			copy(newList, (*list)[:pivotIndex+1])
-			// Insert new value
-			newList[pivotIndex+1] = value
-			// Copy remaining elements
-			copy(newList[pivotIndex+2:], (*list)[pivotIndex+1:])
-		}
-
-		// Try to update the list atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-			return len(newList), nil
-		}
-	}
+	return c.LInsertBeforeAfter(key, before, pivot, []string{value}, 1)
 }
 
 // LPOS returns the index of the first matching element in a list
 func (c *MemoryCache) LPos(key string, element string) (int, bool) {
-	listI, exists := c.lists.Load(key)
-	if !exists {
-		return 0, false
-	}
-
-	list := listI.(*[]string)
-	for i, value := range *list {
-		if value == element {
-			return i, true
-		}
-	}
-	return 0, false
+	var index int
+	var ok bool
+	c.withList(key, false, func(list *models.QuickList) bool {
+		index, ok = list.Pos(element)
+		return false
+	})
+	return index, ok
 }
 
 // LPUSHX inserts elements at the head of the list only if the list exists
 func (c *MemoryCache) LPushX(key string, value string) (int, error) {
-	// First check if list exists
-	if !c.Exists(key) {
-		return 0, nil
-	}
-
-	// If it exists, use standard LPush
-	return c.LPush(key, value)
+	return c.LPushXGet(key, value)
 }
 
 // RPUSHX inserts elements at the tail of the list only if the list exists
 func (c *MemoryCache) RPushX(key string, value string) (int, error) {
-	// First check if list exists
-	if !c.Exists(key) {
-		return 0, nil
-	}
-
-	// If it exists, use standard RPush
-	return c.RPush(key, value)
+	return c.RPushXGet(key, value)
 }
 
 func (c *MemoryCache) LInsertBeforeAfter(key string, before bool, pivot string, values []string, count int) (int, error) {
@@ -1943,153 +1860,53 @@ func (c *MemoryCache) LInsertBeforeAfter(key string, before bool, pivot string,
 		count = len(values)
 	}
 
-	for {
-		// Load or create the list
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return 0, nil // Return 0 if key doesn't exist
-		}
-
-		list := listI.(*[]string)
-		pivotIndex := -1
-
-		// Find pivot element
-		for i, element := range *list {
-			if element == pivot {
-				pivotIndex = i
-				break
-			}
-		}
-
-		// If pivot wasn't found, return -1
-		if pivotIndex == -1 {
-			return -1, nil
-		}
-
-		// Calculate insertion index
-		insertIndex := pivotIndex
-		if !before {
-			insertIndex++
-		}
-
-		// Create new list with appropriate capacity
-		newList := make([]string, len(*list)+count)
-
-		// Copy elements up to insertion point
-		copy(newList, (*list)[:insertIndex])
-
-		// Insert new values
-		copy(newList[insertIndex:], values[:count])
-
-		// Copy remaining elements
-		copy(newList[insertIndex+count:], (*list)[insertIndex:])
-
-		// Try to update the list atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-			return len(newList), nil
+	// 0 if the key doesn't exist, -1 if the pivot wasn't found
+	length := -1
+	exists := c.withList(key, false, func(list *models.QuickList) bool {
+		if !list.Insert(pivot, values[:count], before) {
+			return false
 		}
+		length = list.Len()
+		return true
+	})
+	if !exists {
+		return 0, nil
 	}
+	return length, nil
 }
 
 // LPushXGet atomically pushes a value to the front of an existing list and returns its new length.
 // If the list doesn't exist, it returns 0 without performing any operation.
 func (c *MemoryCache) LPushXGet(key string, value string) (int, error) {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return 0, nil // List doesn't exist, return 0
-		}
-
-		list := listI.(*[]string)
-		newList := make([]string, len(*list)+1)
-
-		// Add new value at the beginning
-		newList[0] = value
-		copy(newList[1:], *list)
-
-		// Try to update atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-			return len(newList), nil
-		}
-		// If CAS failed, retry the operation
-	}
+	var length int
+	c.withList(key, false, func(list *models.QuickList) bool {
+		list.PushFront(value)
+		length = list.Len()
+		return true
+	})
+	return length, nil
 }
 
 // RPushXGet atomically pushes a value to the end of an existing list and returns its new length.
 // If the list doesn't exist, it returns 0 without performing any operation.
 func (c *MemoryCache) RPushXGet(key string, value string) (int, error) {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return 0, nil // List doesn't exist, return 0
-		}
-
-		list := listI.(*[]string)
-		newList := make([]string, len(*list)+1)
-
-		// Copy existing elements and add new value at the end
-		copy(newList, *list)
-		newList[len(*list)] = value
-
-		// Try to update atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-			return len(newList), nil
-		}
-		// If CAS failed, retry the operation
-	}
+	var length int
+	c.withList(key, false, func(list *models.QuickList) bool {
+		list.PushBack(value)
+		length = list.Len()
+		return true
+	})
+	return length, nil
 }
 
 // LTRIM trims a list to the specified range
 func (c *MemoryCache) LTrim(key string, start int, stop int) error {
-	for {
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return nil
-		}
-
-		list := listI.(*[]string)
-		length := len(*list)
-
-		// Convert negative indices to positive
-		if start < 0 {
-			start = length + start
-		}
-		if stop < 0 {
-			stop = length + stop
-		}
-
-		// Boundary checks
-		if start < 0 {
-			start = 0
-		}
-		if stop >= length {
-			stop = length - 1
-		}
-		if start > stop {
-			// Empty the list if start > stop
-			c.lists.Delete(key)
-			c.incrementKeyVersion(key)
-			return nil
-		}
-
-		// Create new list with trimmed values
-		newList := make([]string, stop-start+1)
-		copy(newList, (*list)[start:stop+1])
-
-		// Try to update atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			c.incrementKeyVersion(key)
-
-			// If list is empty after trim, remove it
-			if len(newList) == 0 {
-				c.lists.Delete(key)
-			}
-			return nil
-		}
-	}
+	c.withList(key, false, func(list *models.QuickList) bool {
+		length := list.Len()
+		list.Trim(start, stop)
+		return list.Len() != length
+	})
+	return nil
 }
 
 func (c *MemoryCache) XAdd(key string, id string, fields map[string]string) error {
@@ -2524,33 +2341,17 @@ func (c *MemoryCache) XGroupSetID(key, group, id string) error {
 }
 
 func (c *MemoryCache) LRotate(key string) (bool, error) {
-	for {
-		// Get the list
-		listI, exists := c.lists.Load(key)
-		if !exists {
-			return false, nil
-		}
-
-		list := listI.(*[]string)
-		if len(*list) <= 1 {
-			return false, nil // No rotation needed for empty or single-element lists
-		}
-
-		// Create new list with rotated elements
-		newList := make([]string, len(*list))
-		// Move last element to front
-		newList[0] = (*list)[len(*list)-1]
-		// Copy rest of elements
-		copy(newList[1:], (*list)[:len(*list)-1])
-
-		// Try to update the list atomically
-		if c.lists.CompareAndSwap(key, listI, &newList) {
-			// Increment key version
-			c.incrementKeyVersion(key)
-			return true, nil
-		}
-		// If update fails, retry
-	}
+	var rotated bool
+	c.withList(key, false, func(list *models.QuickList) bool {
+		if list.Len() <= 1 {
+			return false // No rotation needed for single-element lists
+		}
+		value, _ := list.PopBack()
+		list.PushFront(value)
+		rotated = true
+		return true
+	})
+	return rotated, nil
 }
 
 func (c *MemoryCache) RandomKey() (string, bool) {
@@ -2576,7 +2377,6 @@ func (c *MemoryCache) RandomKey() (string, bool) {
 	collectKeys(c.jsonData)
 	collectKeys(c.streams)
 	collectKeys(c.bitmaps)
-	collectKeys(c.geoData)
 	collectKeys(c.suggestions)
 	collectKeys(c.cms)
 	collectKeys(c.cuckooFilters)
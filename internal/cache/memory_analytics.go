@@ -7,7 +7,10 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/genc-murat/crystalcache/internal/cache/bitmap"
 	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
 )
 
 type MemoryAnalytics struct {
@@ -43,7 +46,6 @@ type MemoryAnalytics struct {
 	StreamGroupMemory int64
 	BitmapMemory      int64
 
-	GeoMemory         int64
 	SuggestionMemory  int64
 	CMSMemory         int64
 	CuckooMemory      int64
@@ -80,12 +82,7 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	c.topks.Range(func(key, value interface{}) bool {
 		k := key.(string)
 		tk := value.(*models.TopK)
-		size := int64(len(k))
-
-		// Use Info() to get structure information
-		info := tk.Info()
-		size += 24                             // Base structure (k, capacity, decay)
-		size += int64(info["size"].(int)) * 16 // Approximate size per item (string pointer + count)
+		size := int64(len(k)) + tk.GetMemoryUsage()
 
 		atomic.AddInt64(&analytics.TopKMemory, size)
 		return true
@@ -94,13 +91,8 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	// Bloom Filter memory calculation
 	c.bfilters.Range(func(key, value interface{}) bool {
 		k := key.(string)
-		bf := value.(*models.BloomFilter)
-		size := int64(len(k))
-
-		// Get stats from the bloom filter
-		stats := bf.Stats()
-		size += int64(stats.BitsetSize / 8) // Bitset size in bytes
-		size += 16                          // Size (uint) and HashCount (uint)
+		bf := value.(*models.ScalableBloomFilter)
+		size := int64(len(k)) + bf.GetMemoryUsage()
 
 		atomic.AddInt64(&analytics.BloomFilterMemory, size)
 		return true
@@ -131,13 +123,12 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	})
 
 	// List memory
-	c.lists.Range(func(key, list interface{}) bool {
+	c.lists.Range(func(key, entryI interface{}) bool {
 		k := key.(string)
-		l := list.([]string)
-		size := int64(len(k))
-		for _, item := range l {
-			size += int64(len(item))
-		}
+		entry := entryI.(*listEntry)
+		entry.mu.Lock()
+		size := int64(len(k)) + entry.list.SizeInBytes()
+		entry.mu.Unlock()
 		atomic.AddInt64(&analytics.ListMemory, size)
 		return true
 	})
@@ -173,8 +164,7 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	// JSON data memory
 	c.jsonData.Range(func(key, value interface{}) bool {
 		k := key.(string)
-		v := value.([]byte) // Assuming JSON is stored as []byte
-		size := int64(len(k) + len(v))
+		size := int64(len(k)) + value.(*jsonUtil.Document).Size()
 		atomic.AddInt64(&analytics.JSONMemory, size)
 		return true
 	})
@@ -212,10 +202,15 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	})
 
 	// Bitmap memory
-	c.bitmaps.Range(func(key, bitmap interface{}) bool {
+	c.bitmaps.Range(func(key, value interface{}) bool {
 		k := key.(string)
-		b := bitmap.([]byte)
-		size := int64(len(k) + len(b))
+		size := int64(len(k))
+		switch b := value.(type) {
+		case []byte:
+			size += int64(len(b))
+		case *bitmap.Roaring:
+			size += b.SizeInBytes()
+		}
 		atomic.AddInt64(&analytics.BitmapMemory, size)
 		return true
 	})
@@ -228,34 +223,18 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 		atomic.AddInt64(&analytics.HLLMemory, size)
 		return true
 	})
-	// Geo memory
-	c.geoData.Range(func(key, geoSet interface{}) bool {
-		k := key.(string)
-		gs := geoSet.(*sync.Map)
-		size := int64(len(k))
-		gs.Range(func(member, point interface{}) bool {
-			m := member.(string)
-			p := point.(*models.GeoPoint)
-			size += int64(len(m))         // member name
-			size += 24                    // Longitude, Latitude (float64 * 2)
-			size += int64(len(p.GeoHash)) // GeoHash string
-			return true
-		})
-		atomic.AddInt64(&analytics.GeoMemory, size)
-		return true
-	})
 
 	// Suggestion memory
 	c.suggestions.Range(func(key, dict interface{}) bool {
 		k := key.(string)
 		d := dict.(*models.SuggestionDict)
 		size := int64(len(k))
-		for str, sug := range d.Entries {
-			size += int64(len(str))         // String key
+		d.Range(func(sug models.Suggestion) bool {
 			size += int64(len(sug.String))  // Suggestion string
 			size += 8                       // Score (float64)
 			size += int64(len(sug.Payload)) // Payload
-		}
+			return true
+		})
 		atomic.AddInt64(&analytics.SuggestionMemory, size)
 		return true
 	})
@@ -293,14 +272,7 @@ func (c *MemoryCache) calculateStructureMemory(analytics *MemoryAnalytics) {
 	c.timeSeries.Range(func(key, value interface{}) bool {
 		k := key.(string)
 		ts := value.(*models.TimeSeries)
-		size := int64(len(k))
-
-		size += int64(len(ts.Samples) * 16) // Bulk calculate sample memory
-
-		for labelKey, labelValue := range ts.Labels {
-			size += int64(len(labelKey) + len(labelValue))
-		}
-
+		size := int64(len(k)) + ts.GetMemoryUsage()
 		atomic.AddInt64(&analytics.TimeSeriesMemory, size)
 		return true
 	})
@@ -367,12 +339,6 @@ func (c *MemoryCache) getKeyCount() int64 {
 		return true
 	})
 
-	// Count Geo keys
-	c.geoData.Range(func(_, _ interface{}) bool {
-		atomic.AddInt64(&count, 1)
-		return true
-	})
-
 	// Count Suggestion keys
 	c.suggestions.Range(func(_, _ interface{}) bool {
 		atomic.AddInt64(&count, 1)
@@ -451,20 +417,32 @@ func (c *MemoryCache) StartMemoryMonitor(interval time.Duration) {
 	}()
 }
 
-// Add memory usage limits
+// SetMemoryLimit sets the heap size above which keys are evicted. Zero
+// disables eviction. The limit can be changed at any time; the watcher
+// goroutine is started on first use.
 func (c *MemoryCache) SetMemoryLimit(maxBytes int64) {
-	go func() {
-		for {
-			analytics := c.GetMemoryAnalytics()
-			if analytics.CurrentlyInUse > maxBytes {
-				c.evictKeys(maxBytes)
+	c.memoryLimit.Store(maxBytes)
+	c.limitOnce.Do(func() {
+		go func() {
+			for {
+				if maxBytes := c.memoryLimit.Load(); maxBytes > 0 {
+					analytics := c.GetMemoryAnalytics()
+					if analytics.CurrentlyInUse > maxBytes {
+						c.evictKeys(maxBytes)
+					}
+				}
+				time.Sleep(time.Second)
 			}
-			time.Sleep(time.Second)
-		}
-	}()
+		}()
+	})
 }
 
 func (c *MemoryCache) evictKeys(targetBytes int64) {
+	start := time.Now()
+	defer func() {
+		c.latency.Load().Observe(metrics.LatencyEventEviction, time.Since(start))
+	}()
+
 	for {
 		analytics := c.GetMemoryAnalytics()
 		if analytics.CurrentlyInUse <= targetBytes {
@@ -481,7 +459,6 @@ func (c *MemoryCache) evictKeys(targetBytes int64) {
 			c.sets_,         // Sets
 			c.zsets,         // Sorted sets
 			c.streamGroups,  // Stream groups
-			c.geoData,       // Geo data
 			c.suggestions,   // Suggestions
 			c.cms,           // Count-Min Sketches
 			c.hlls,          // HyperLogLog
@@ -508,7 +485,9 @@ func (c *MemoryCache) evictKeys(targetBytes int64) {
 
 				if keyToDelete != nil {
 					m.Delete(keyToDelete)
+					c.expires.Delete(keyToDelete)
 					atomic.AddInt64(&c.stats.evictedKeys, 1)
+					c.notifyKeyspaceEvent('e', "evicted", keyToDelete.(string))
 					evicted = true
 					break
 				}
@@ -540,15 +519,9 @@ func (c *MemoryCache) getMapMemoryUsage(m *sync.Map) int64 {
 		case *models.TDigest:
 			size += v.GetMemoryUsage()
 		case *models.TopK:
-			// Use Info() method for TopK size estimation
-			info := v.Info()
-			size += 24                             // Base structure size
-			size += int64(info["size"].(int)) * 16 // Approximate size per item
-		case *models.BloomFilter:
-			// Calculate Bloom Filter size
-			stats := v.Stats()
-			size += int64(stats.BitsetSize / 8) // Bitset size in bytes
-			size += 16                          // Configuration overhead
+			size += v.GetMemoryUsage()
+		case *models.ScalableBloomFilter:
+			size += v.GetMemoryUsage()
 		case *sync.Map:
 			v.Range(func(k, val interface{}) bool {
 				size += int64(len(k.(string)))
@@ -558,18 +531,7 @@ func (c *MemoryCache) getMapMemoryUsage(m *sync.Map) int64 {
 				return true
 			})
 		case *models.TimeSeries:
-			// Calculate TimeSeries size
-			ts := v
-			ts.Mutex.Lock()
-			defer ts.Mutex.Unlock()
-
-			// Add memory used by labels
-			for labelKey, labelValue := range ts.Labels {
-				size += int64(len(labelKey) + len(labelValue))
-			}
-
-			// Add memory used by samples
-			size += int64(len(ts.Samples) * 16)
+			size += v.GetMemoryUsage()
 		}
 		return true
 	})
@@ -39,3 +39,49 @@ func (c *MemoryCache) BitFieldRO(key string, commands []models.BitFieldCommand)
 func (c *MemoryCache) BitOp(operation string, destkey string, keys ...string) (int64, error) {
 	return c.bitmapManager.BitOp(operation, destkey, keys...)
 }
+
+// RSetBit sets or clears a bit like SetBit, storing the bitmap as a roaring
+// bitmap.
+func (c *MemoryCache) RSetBit(key string, offset int64, value int) (int, error) {
+	return c.bitmapManager.RSetBit(key, offset, value)
+}
+
+// RSetIntArray replaces the bitmap at key by a roaring bitmap with the bits
+// at offsets set.
+func (c *MemoryCache) RSetIntArray(key string, offsets []int64) error {
+	return c.bitmapManager.RSetIntArray(key, offsets)
+}
+
+// RBitOp performs a bitwise operation like BitOp, storing a roaring bitmap,
+// and returns the number of bits set in the result.
+func (c *MemoryCache) RBitOp(operation string, destkey string, keys ...string) (int64, error) {
+	return c.bitmapManager.RBitOp(operation, destkey, keys...)
+}
+
+// RCard returns the number of bits set in the bitmap at key.
+func (c *MemoryCache) RCard(key string) int64 {
+	return c.bitmapManager.RCard(key)
+}
+
+// RRange returns the offsets of the bits set in the bitmap at key from
+// start to end included.
+func (c *MemoryCache) RRange(key string, start, end int64) ([]int64, error) {
+	return c.bitmapManager.RRange(key, start, end)
+}
+
+// RGetIntArray returns the offsets of the bits set in the bitmap at key.
+func (c *MemoryCache) RGetIntArray(key string) []int64 {
+	return c.bitmapManager.RGetIntArray(key)
+}
+
+// RMin returns the offset of the first bit set in the bitmap at key, -1 if
+// there is none.
+func (c *MemoryCache) RMin(key string) int64 {
+	return c.bitmapManager.RMin(key)
+}
+
+// RMax returns the offset of the last bit set in the bitmap at key, -1 if
+// there is none.
+func (c *MemoryCache) RMax(key string) int64 {
+	return c.bitmapManager.RMax(key)
+}
@@ -280,21 +280,21 @@ func (c *MemoryCache) memoryUsageHash(key string) (int64, error) {
 	return 0, fmt.Errorf("hash key not found")
 }
 
-// memoryUsageList calculates the total memory usage of all elements in a list stored at the given key.
+// memoryUsageList calculates the memory used by the nodes of a list stored at the given key.
 // It returns the total size in bytes and an error if the key is not found.
 //
 // Parameters:
 //   - key: The key of the list in the cache.
 //
 // Returns:
-//   - int64: The total size in bytes of all elements in the list.
+//   - int64: The size in bytes of the packed, possibly compressed, nodes of the list.
 //   - error: An error if the key is not found or if there is an issue retrieving the list.
 func (c *MemoryCache) memoryUsageList(key string) (int64, error) {
 	var valueSize int64
-	if values, err := c.LRange(key, 0, -1); err == nil {
-		for _, v := range values {
-			valueSize += int64(len(v))
-		}
+	if c.withList(key, false, func(list *models.QuickList) bool {
+		valueSize = list.SizeInBytes()
+		return false
+	}) {
 		return valueSize, nil
 	}
 	return 0, fmt.Errorf("list key not found")
@@ -358,8 +358,8 @@ func (c *MemoryCache) memoryUsageZSet(key string) (int64, error) {
 //	int64 - The size in bytes of the JSON value.
 //	error - An error if the key does not exist in the cache.
 func (c *MemoryCache) memoryUsageJSON(key string) (int64, error) {
-	if val, exists := c.GetJSON(key); exists {
-		return int64(len(fmt.Sprintf("%v", val))), nil
+	if doc, exists := c.GetJSONDocument(key); exists {
+		return doc.Size(), nil
 	}
 	return 0, fmt.Errorf("json key not found")
 }
@@ -6,21 +6,30 @@ import (
 	"github.com/genc-murat/crystalcache/internal/core/models"
 )
 
-// CFReserve reserves a new Cuckoo filter for the given key with the specified capacity.
-// It creates a new Cuckoo filter using the provided capacity and stores it in the cache.
-// The key version is incremented after storing the filter.
+// cfScanDumpChunkSize bounds the bucket bytes returned by one CF.SCANDUMP call.
+const cfScanDumpChunkSize = 16 * 1024 * 1024
+
+// CFReserve creates a cuckoo filter for the given key. Its first table holds
+// opts.Capacity items in buckets of opts.BucketSize fingerprints; when an item
+// cannot be placed a table opts.Expansion times larger is chained, unless the
+// expansion is 0.
 //
 // Parameters:
 //
 //	key - the key for which the Cuckoo filter is reserved
-//	capacity - the capacity of the new Cuckoo filter
+//	opts - the capacity, bucket size, eviction limit, growth and fingerprint width
 //
 // Returns:
 //
-//	error - if there is an error during the reservation process
-func (c *MemoryCache) CFReserve(key string, capacity uint64) error {
-	filter := models.NewCuckooFilter(capacity)
-	c.cuckooFilters.Store(key, filter)
+//	error - if the options are invalid or the key already exists
+func (c *MemoryCache) CFReserve(key string, opts models.CuckooFilterOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if _, loaded := c.cuckooFilters.LoadOrStore(key, models.NewCuckooFilter(opts)); loaded {
+		return fmt.Errorf("ERR item exists")
+	}
 	c.incrementKeyVersion(key)
 	return nil
 }
@@ -35,7 +44,7 @@ func (c *MemoryCache) CFReserve(key string, capacity uint64) error {
 //
 // Returns:
 //   - bool: True if the item was successfully added, false otherwise.
-//   - error: An error if the filter does not exist.
+//   - error: An error if the filter does not exist or is full and cannot grow.
 func (c *MemoryCache) CFAdd(key string, item string) (bool, error) {
 	filterI, exists := c.cuckooFilters.Load(key)
 	if !exists {
@@ -43,11 +52,11 @@ func (c *MemoryCache) CFAdd(key string, item string) (bool, error) {
 	}
 
 	filter := filterI.(*models.CuckooFilter)
-	success := filter.Add(item)
-	if success {
-		c.incrementKeyVersion(key)
+	if err := filter.Add(item); err != nil {
+		return false, err
 	}
-	return success, nil
+	c.incrementKeyVersion(key)
+	return true, nil
 }
 
 // CFAddNX attempts to add an item to the cuckoo filter associated with the given key,
@@ -60,7 +69,7 @@ func (c *MemoryCache) CFAdd(key string, item string) (bool, error) {
 //
 // Returns:
 //   - bool: True if the item was successfully added, false if the item already exists.
-//   - error: An error if the filter does not exist.
+//   - error: An error if the filter does not exist or is full and cannot grow.
 func (c *MemoryCache) CFAddNX(key string, item string) (bool, error) {
 	filterI, exists := c.cuckooFilters.Load(key)
 	if !exists {
@@ -68,80 +77,79 @@ func (c *MemoryCache) CFAddNX(key string, item string) (bool, error) {
 	}
 
 	filter := filterI.(*models.CuckooFilter)
-	success := filter.AddNX(item)
-	if success {
+	added, err := filter.AddNX(item)
+	if added && err == nil {
 		c.incrementKeyVersion(key)
 	}
-	return success, nil
+	return added, err
 }
 
 // CFInsert inserts a list of items into the cuckoo filter associated with the given key.
-// If the key does not exist, a new cuckoo filter is created with a default capacity.
-// It returns a slice of booleans indicating whether each item was successfully inserted,
-// and an error if any occurred during the process.
+// A missing filter is created with the given capacity, or the default one when it is 0,
+// unless noCreate is set.
 //
 // Parameters:
 //   - key: The key associated with the cuckoo filter.
+//   - capacity: The capacity of the filter if it is created.
+//   - noCreate: Whether a missing filter is an error.
 //   - items: A slice of strings representing the items to be inserted.
 //
 // Returns:
-//   - []bool: A slice of booleans where each value indicates if the corresponding item was successfully inserted.
-//   - error: An error if any occurred during the insertion process.
-func (c *MemoryCache) CFInsert(key string, items []string) ([]bool, error) {
-	filterI, exists := c.cuckooFilters.Load(key)
-	if !exists {
-		// Create new filter with default capacity
-		filter := models.NewCuckooFilter(uint64(len(items) * 2))
-		c.cuckooFilters.Store(key, filter)
-		filterI = filter
-	}
-
-	filter := filterI.(*models.CuckooFilter)
-	results := make([]bool, len(items))
-	changed := false
-
-	for i, item := range items {
-		results[i] = filter.Add(item)
-		if results[i] {
-			changed = true
-		}
-	}
-
-	if changed {
-		c.incrementKeyVersion(key)
-	}
-	return results, nil
+//   - []int: 1 for every item inserted and -1 for every item that did not fit.
+//   - error: An error if the filter is missing with noCreate.
+func (c *MemoryCache) CFInsert(key string, capacity uint64, noCreate bool, items []string) ([]int, error) {
+	return c.cfInsert(key, capacity, noCreate, items, false)
 }
 
 // CFInsertNX inserts the given items into the cuckoo filter associated with the specified key,
-// only if they do not already exist in the filter. If the key does not have an associated filter,
-// a new filter is created with a default capacity.
+// only if they do not already exist in the filter. A missing filter is created as by CFInsert.
 //
 // Parameters:
 //   - key: The key associated with the cuckoo filter.
+//   - capacity: The capacity of the filter if it is created.
+//   - noCreate: Whether a missing filter is an error.
 //   - items: A slice of strings representing the items to be inserted.
 //
 // Returns:
-//   - A slice of booleans indicating whether each item was successfully inserted (true) or already existed (false).
-//   - An error, if any occurred during the operation.
+//   - []int: 1 for every item inserted, 0 for every item that may already exist
+//     and -1 for every item that did not fit.
+//   - error: An error if the filter is missing with noCreate.
 //
 // If any item is successfully inserted, the version of the key is incremented.
-func (c *MemoryCache) CFInsertNX(key string, items []string) ([]bool, error) {
+func (c *MemoryCache) CFInsertNX(key string, capacity uint64, noCreate bool, items []string) ([]int, error) {
+	return c.cfInsert(key, capacity, noCreate, items, true)
+}
+
+func (c *MemoryCache) cfInsert(key string, capacity uint64, noCreate bool, items []string, nx bool) ([]int, error) {
 	filterI, exists := c.cuckooFilters.Load(key)
 	if !exists {
-		// Create new filter with default capacity
-		filter := models.NewCuckooFilter(uint64(len(items) * 2))
-		c.cuckooFilters.Store(key, filter)
-		filterI = filter
+		if noCreate {
+			return nil, fmt.Errorf("filter does not exist")
+		}
+		opts := models.DefaultCuckooFilterOptions()
+		if capacity > 0 {
+			opts.Capacity = capacity
+		}
+		filterI, _ = c.cuckooFilters.LoadOrStore(key, models.NewCuckooFilter(opts))
 	}
 
 	filter := filterI.(*models.CuckooFilter)
-	results := make([]bool, len(items))
+	results := make([]int, len(items))
 	changed := false
 
 	for i, item := range items {
-		results[i] = filter.AddNX(item)
-		if results[i] {
+		var err error
+		added := true
+		if nx {
+			added, err = filter.AddNX(item)
+		} else {
+			err = filter.Add(item)
+		}
+		switch {
+		case err != nil:
+			results[i] = -1
+		case added:
+			results[i] = 1
 			changed = true
 		}
 	}
@@ -270,16 +278,17 @@ func (c *MemoryCache) CFInfo(key string) (*models.CuckooInfo, error) {
 	return &info, nil
 }
 
-// CFScanDump scans and dumps the data from the Cuckoo filter associated with the given key.
-// It returns the next iteration value, the dumped data as a byte slice, and an error if the filter does not exist.
+// CFScanDump returns the next chunk of a cuckoo filter dump. Iteration starts at 0;
+// the first chunk describes the chained tables and the following ones carry their
+// buckets. A returned iterator of 0 marks the end of the dump.
 //
 // Parameters:
 //   - key: The key associated with the Cuckoo filter.
-//   - iter: The current iteration value.
+//   - iter: The iterator returned by the previous call, or 0 to start.
 //
 // Returns:
-//   - uint64: The next iteration value.
-//   - []byte: The dumped data as a byte slice.
+//   - uint64: The iterator to pass to the next call and to CF.LOADCHUNK with this chunk.
+//   - []byte: The chunk data.
 //   - error: An error if the filter does not exist.
 func (c *MemoryCache) CFScanDump(key string, iter uint64) (uint64, []byte, error) {
 	filterI, exists := c.cuckooFilters.Load(key)
@@ -288,28 +297,46 @@ func (c *MemoryCache) CFScanDump(key string, iter uint64) (uint64, []byte, error
 	}
 
 	filter := filterI.(*models.CuckooFilter)
-	nextIter, data := filter.ScanDump(iter)
+	nextIter, data := filter.ScanDump(iter, cfScanDumpChunkSize)
 	return nextIter, data, nil
 }
 
-// CFLoadChunk loads a chunk of data into the cuckoo filter associated with the given key.
-// If the filter does not exist, it returns an error.
+// CFLoadChunk restores a chunk produced by CF.SCANDUMP. The header chunk (iterator 1)
+// replaces the key with an empty filter of the dumped layout; later chunks fill in
+// its buckets.
 //
 // Parameters:
 //   - key: The key associated with the cuckoo filter.
-//   - iter: The iteration or chunk index to load the data into.
-//   - data: The byte slice containing the data to be loaded.
+//   - iter: The iterator CF.SCANDUMP returned with the chunk.
+//   - data: The chunk data.
 //
 // Returns:
-//   - error: An error if the filter does not exist or if there is an issue loading the chunk.
+//   - error: An error if the chunk is malformed or the filter does not exist yet.
 func (c *MemoryCache) CFLoadChunk(key string, iter uint64, data []byte) error {
+	if iter == 1 {
+		filter, err := models.LoadCuckooHeader(data)
+		if err != nil {
+			return err
+		}
+		c.cuckooFilters.Store(key, filter)
+		c.incrementKeyVersion(key)
+		return nil
+	}
+
 	filterI, exists := c.cuckooFilters.Load(key)
 	if !exists {
 		return fmt.Errorf("filter does not exist")
 	}
+	if iter == 0 {
+		return fmt.Errorf("ERR invalid iterator")
+	}
 
 	filter := filterI.(*models.CuckooFilter)
-	return filter.LoadChunk(iter, data)
+	if err := filter.LoadChunk(iter, data); err != nil {
+		return err
+	}
+	c.incrementKeyVersion(key)
+	return nil
 }
 
 // defragCuckooFilters defragments the cuckoo filters in the MemoryCache.
@@ -2,259 +2,190 @@ package cache
 
 import (
 	"fmt"
-	"math"
 	"sort"
 	"strings"
 	"sync"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/pkg/utils/geohash"
 )
 
-// GeoAdd adds one or more GeoPoint items to the in-memory cache under the specified key.
-// It returns the number of items successfully added and an error if any occurred.
+// Geo sets are sorted sets scored with the 52 bit geohash of their members,
+// so every sorted set command works on them. A search looks up the score
+// ranges of the geohash cells covering its area and keeps the members of
+// those which are in the area.
+//
+// Geofences are areas of a geo set. GEOADD publishes the members it moves
+// into or out of a fence of the set on the channel
+// __geofence__:<key>:<fence>, as "enter <member>" or "exit <member>".
+
+// geoFenceChannelPrefix starts the channels geofence events are published on
+const geoFenceChannelPrefix = "__geofence__:"
+
+// geoFenceSet holds the fences of a geo set. Its lock also serializes the
+// updates of the set, so that events are published in order.
+type geoFenceSet struct {
+	mu     sync.Mutex
+	fences map[string]*geoFence
+}
+
+type geoFence struct {
+	models.GeoFence
+	shape geohash.Shape
+}
+
+// GeoAdd adds one or more GeoPoint items to the geo set stored at key.
+// Nothing is added if any item has invalid coordinates.
 //
 // Parameters:
-//   - key: A string representing the key under which the GeoPoint items will be stored.
-//   - items: A variadic parameter of GeoPoint items to be added to the cache.
+//   - key: The key of the geo set.
+//   - items: The GeoPoint items to add. The coordinates of existing members are updated.
 //
 // Returns:
-//   - int: The number of GeoPoint items successfully added to the cache.
-//   - error: An error if any occurred during the operation.
-//
-// The function performs the following steps:
-//  1. Loads or stores a new sync.Map for the given key in the geoData map.
-//  2. Iterates over the provided GeoPoint items.
-//  3. Validates the coordinates of each item.
-//  4. Encodes the longitude and latitude into a GeoHash and stores the item in the sync.Map.
-//  5. Increments the key version if any items were added.
+//   - int: The number of members added, not counting the updated ones.
+//   - error: An error if the coordinates of an item are out of range.
 func (c *MemoryCache) GeoAdd(key string, items ...models.GeoPoint) (int, error) {
-	geoSetI, _ := c.geoData.LoadOrStore(key, &sync.Map{})
-	geoSet := geoSetI.(*sync.Map)
-
-	added := 0
-	for _, item := range items {
-		if !isValidCoordinate(item.Longitude, item.Latitude) {
-			continue
+	scores := make([]uint64, len(items))
+	for i, item := range items {
+		score, err := geohash.Encode(item.Longitude, item.Latitude)
+		if err != nil {
+			return 0, err
 		}
-
-		item.GeoHash = encodeGeoHash(item.Longitude, item.Latitude)
-		geoSet.Store(item.Name, &item)
-		added++
+		scores[i] = score
 	}
 
-	if added > 0 {
-		c.incrementKeyVersion(key)
+	var fences *geoFenceSet
+	if value, ok := c.geoFences.Load(key); ok {
+		fences = value.(*geoFenceSet)
+		fences.mu.Lock()
+		defer fences.mu.Unlock()
 	}
 
+	added := 0
+	for i, item := range items {
+		oldScore, exists := c.zsetManager.ZScore(key, item.Name)
+		if !exists {
+			added++
+		}
+		if err := c.zsetManager.ZAdd(key, float64(scores[i]), item.Name); err != nil {
+			return added, err
+		}
+		if fences != nil {
+			c.publishGeoFenceEvents(key, fences, item.Name, oldScore, exists, scores[i])
+		}
+	}
 	return added, nil
 }
 
-// encodeGeoHash encodes the given longitude and latitude into a GeoHash string.
-// The GeoHash is a string representation of the geographic location, using base32 encoding.
-// The function returns an 11-character GeoHash string.
-//
-// Parameters:
-//   - lon: The longitude of the location to encode.
-//   - lat: The latitude of the location to encode.
-//
-// Returns:
-//   - A string representing the GeoHash of the given longitude and latitude.
-func encodeGeoHash(lon, lat float64) string {
-	const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
-	var hash strings.Builder
-
-	minLat, maxLat := -90.0, 90.0
-	minLon, maxLon := -180.0, 180.0
-	isEven := true
-
-	bit := 0
-	ch := 0
-
-	for hash.Len() < 11 {
-		if isEven {
-			mid := (minLon + maxLon) / 2
-			if lon >= mid {
-				ch |= 1 << (4 - bit)
-				minLon = mid
-			} else {
-				maxLon = mid
-			}
-		} else {
-			mid := (minLat + maxLat) / 2
-			if lat >= mid {
-				ch |= 1 << (4 - bit)
-				minLat = mid
-			} else {
-				maxLat = mid
-			}
-		}
-
-		isEven = !isEven
-		bit++
+// publishGeoFenceEvents publishes the fences a member entered or left
+// moving from oldScore, if it had one, to score
+func (c *MemoryCache) publishGeoFenceEvents(key string, fences *geoFenceSet, member string, oldScore float64, moved bool, score uint64) {
+	lon, lat := geohash.Decode(score)
+	var oldLon, oldLat float64
+	if moved {
+		oldLon, oldLat = geohash.Decode(uint64(oldScore))
+	}
 
-		if bit == 5 {
-			hash.WriteByte(base32[ch])
-			bit = 0
-			ch = 0
+	names := make([]string, 0, len(fences.fences))
+	for name := range fences.fences {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fence := fences.fences[name]
+		_, inside := fence.shape.Contains(lon, lat)
+		wasInside := false
+		if moved {
+			_, wasInside = fence.shape.Contains(oldLon, oldLat)
 		}
+		switch {
+		case inside && !wasInside:
+			c.publish(geoFenceChannelPrefix+key+":"+name, "enter "+member)
+		case !inside && wasInside:
+			c.publish(geoFenceChannelPrefix+key+":"+name, "exit "+member)
+		}
+	}
+}
+
+// geoPoint returns the point a member of the geo set at key is scored with
+func (c *MemoryCache) geoPoint(key, member string) (models.GeoPoint, bool) {
+	score, exists := c.zsetManager.ZScore(key, member)
+	if !exists {
+		return models.GeoPoint{}, false
 	}
+	return newGeoPoint(member, score), true
+}
 
-	return hash.String()
+func newGeoPoint(member string, score float64) models.GeoPoint {
+	hash := uint64(score)
+	lon, lat := geohash.Decode(hash)
+	return models.GeoPoint{Name: member, Longitude: lon, Latitude: lat, Hash: hash}
 }
 
-// GeoDist calculates the distance between two members of a geospatial index represented by the given key.
-// The distance is calculated using the Haversine formula and returned in the specified unit.
+// GeoDist calculates the distance between two members of the geo set at key.
 //
 // Parameters:
-//   - key: The key of the geospatial index.
-//   - member1: The first member whose coordinates are used for distance calculation.
-//   - member2: The second member whose coordinates are used for distance calculation.
-//   - unit: The unit of measurement for the distance (e.g., "m" for meters, "km" for kilometers).
+//   - key: The key of the geo set.
+//   - member1, member2: The members to measure the distance between.
+//   - unit: The unit of the distance: "m", "km", "mi" or "ft".
 //
 // Returns:
-//   - float64: The calculated distance between the two members in the specified unit.
-//   - error: An error if the key or members are not found, or if any other issue occurs during calculation.
+//   - float64: The distance between the two members in the given unit.
+//   - error: An error if the key or a member is not found, or the unit is unknown.
 func (c *MemoryCache) GeoDist(key, member1, member2, unit string) (float64, error) {
-	geoSetI, exists := c.geoData.Load(key)
-	if !exists {
+	conversion, err := geoUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	if _, exists := c.zsets.Load(key); !exists {
 		return 0, fmt.Errorf("ERR key not found")
 	}
-	geoSet := geoSetI.(*sync.Map)
-
-	point1I, exists1 := geoSet.Load(member1)
-	point2I, exists2 := geoSet.Load(member2)
 
+	point1, exists1 := c.geoPoint(key, member1)
+	point2, exists2 := c.geoPoint(key, member2)
 	if !exists1 || !exists2 {
 		return 0, fmt.Errorf("ERR member not found")
 	}
 
-	point1 := point1I.(*models.GeoPoint)
-	point2 := point2I.(*models.GeoPoint)
-
-	dist := calculateDistance(point1.Longitude, point1.Latitude, point2.Longitude, point2.Latitude)
-	return convertDistance(dist, unit), nil
+	dist := geohash.Distance(point1.Longitude, point1.Latitude, point2.Longitude, point2.Latitude)
+	return dist / conversion, nil
 }
 
-// GeoPos retrieves the geographical positions of the specified members from the cache.
+// GeoPos retrieves the positions of members of the geo set at key, as
+// decoded from their scores.
 //
 // Parameters:
-//   - key: The key identifying the geo set in the cache.
-//   - members: A variadic list of member names whose geographical positions are to be retrieved.
+//   - key: The key of the geo set.
+//   - members: The members whose positions are retrieved.
 //
 // Returns:
-//   - A slice of pointers to GeoPoint objects corresponding to the specified members. If a member
-//     does not exist in the geo set, its position in the slice will be nil.
-//   - An error if any issue occurs during the retrieval process. If the key does not exist in the
-//     cache, both the slice and error will be nil.
+//   - A slice holding a GeoPoint for each member, nil for those not in the set.
+//   - An error if any issue occurs during the retrieval.
 func (c *MemoryCache) GeoPos(key string, members ...string) ([]*models.GeoPoint, error) {
-	geoSetI, exists := c.geoData.Load(key)
-	if !exists {
-		return nil, nil
-	}
-	geoSet := geoSetI.(*sync.Map)
-
 	results := make([]*models.GeoPoint, len(members))
 	for i, member := range members {
-		if pointI, exists := geoSet.Load(member); exists {
-			point := pointI.(*models.GeoPoint)
-			results[i] = point
+		if point, exists := c.geoPoint(key, member); exists {
+			point.GeoHash = geohash.String(point.Hash)
+			results[i] = &point
 		}
 	}
-
 	return results, nil
 }
 
-// isValidCoordinate checks if the given longitude and latitude values
-// are within the valid ranges for geographic coordinates.
-// Longitude must be between -180 and 180 degrees.
-// Latitude must be between -85.05112878 and 85.05112878 degrees.
-//
-// Parameters:
-//
-//	lon - Longitude value to be checked.
-//	lat - Latitude value to be checked.
-//
-// Returns:
-//
-//	bool - true if both longitude and latitude are within valid ranges, false otherwise.
-func isValidCoordinate(lon, lat float64) bool {
-	return lon >= -180 && lon <= 180 && lat >= -85.05112878 && lat <= 85.05112878
-}
-
-// calculateDistance calculates the distance between two points on the Earth's surface
-// specified by their longitude and latitude in decimal degrees using the Haversine formula.
-//
-// Parameters:
-//   - lon1: Longitude of the first point in decimal degrees.
-//   - lat1: Latitude of the first point in decimal degrees.
-//   - lon2: Longitude of the second point in decimal degrees.
-//   - lat2: Latitude of the second point in decimal degrees.
-//
-// Returns:
-//   - The distance between the two points in meters.
-func calculateDistance(lon1, lat1, lon2, lat2 float64) float64 {
-	const earthRadius = 6371000 // Earth's radius in meters
-
-	lat1Rad := lat1 * math.Pi / 180
-	lat2Rad := lat2 * math.Pi / 180
-	lonDiff := (lon2 - lon1) * math.Pi / 180
-	latDiff := (lat2 - lat1) * math.Pi / 180
-
-	a := math.Sin(latDiff/2)*math.Sin(latDiff/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-			math.Sin(lonDiff/2)*math.Sin(lonDiff/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-
-	return earthRadius * c
-}
-
-// convertToMeters converts a given distance to meters based on the specified unit.
-// Supported units are kilometers ("km"), miles ("mi"), feet ("ft"), and meters ("m").
-// If the unit is not recognized, the function assumes the distance is already in meters.
-//
-// Parameters:
-//   - distance: The distance to be converted.
-//   - unit: The unit of the distance (e.g., "km", "mi", "ft", "m").
-//
-// Returns:
-//
-//	The distance converted to meters.
-func convertToMeters(distance float64, unit string) float64 {
+// geoUnit returns the meters in a distance unit
+func geoUnit(unit string) (float64, error) {
 	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
 	case "km":
-		return distance * 1000
+		return 1000, nil
 	case "mi":
-		return distance * 1609.34
+		return 1609.34, nil
 	case "ft":
-		return distance / 3.28084
-	default: // "m"
-		return distance
-	}
-}
-
-// convertDistance converts a distance from meters to the specified unit.
-// Supported units are:
-// - "km" for kilometers
-// - "mi" for miles
-// - "ft" for feet
-// If the unit is not recognized, the function returns the distance in meters.
-//
-// Parameters:
-// - meters: the distance in meters to be converted.
-// - unit: the unit to convert the distance to.
-//
-// Returns:
-// - The converted distance in the specified unit.
-func convertDistance(meters float64, unit string) float64 {
-	switch strings.ToLower(unit) {
-	case "km":
-		return meters / 1000
-	case "mi":
-		return meters / 1609.34
-	case "ft":
-		return meters * 3.28084
-	default: // "m"
-		return meters
+		return 0.3048, nil
+	default:
+		return 0, fmt.Errorf("ERR unsupported unit provided. please use M, KM, FT, MI")
 	}
 }
 
@@ -277,187 +208,233 @@ func sortGeoResults(results []models.GeoPoint, sortOrder string) {
 	}
 }
 
-// GeoRadius retrieves geo points within a specified radius from a given location.
-// It searches for geo points stored under the provided key and returns those within the specified radius.
+// GeoRadius retrieves the members of the geo set at key within a radius of
+// a point. It is GeoSearch with a FROMLONLAT center and a BYRADIUS area.
 //
 // Parameters:
-//   - key: The key under which the geo points are stored.
-//   - longitude: The longitude of the center point.
-//   - latitude: The latitude of the center point.
-//   - radius: The radius within which to search for geo points.
-//   - unit: The unit of the radius (e.g., "m" for meters, "km" for kilometers).
-//   - withDist: If true, includes the distance of each point from the center.
-//   - withCoord: If true, includes the coordinates of each point.
-//   - withHash: If true, includes the hash of each point.
+//   - key: The key of the geo set.
+//   - longitude, latitude: The center of the search.
+//   - radius: The radius of the search.
+//   - unit: The unit of the radius and of the returned distances.
+//   - withDist, withCoord, withHash: The data returned with each member.
 //   - count: The maximum number of results to return. If 0, returns all results.
-//   - sortOption: The sorting option for the results ("ASC" for ascending, "DESC" for descending).
+//   - sortOption: "ASC" or "DESC" to sort the results by distance.
 //
 // Returns:
-//   - A slice of GeoPoint objects that are within the specified radius.
-//   - An error if any issues occur during the retrieval process.
+//   - A slice of GeoPoint objects that are within the radius.
+//   - An error if the unit is unknown.
 func (c *MemoryCache) GeoRadius(key string, longitude, latitude, radius float64, unit string, withDist, withCoord, withHash bool, count int, sortOption string) ([]models.GeoPoint, error) {
-	geoSetI, exists := c.geoData.Load(key)
-	if !exists {
-		return nil, nil
-	}
-	geoSet := geoSetI.(*sync.Map)
-
-	radiusM := convertToMeters(radius, unit)
-	var results []models.GeoPoint
-
-	geoSet.Range(func(_, pointI interface{}) bool {
-		point := pointI.(*models.GeoPoint)
-		dist := calculateDistance(longitude, latitude, point.Longitude, point.Latitude)
-
-		if dist <= radiusM {
-			result := *point
-			result.Distance = dist
-			results = append(results, result)
-		}
-		return true
+	return c.GeoSearch(key, &models.GeoSearchOptions{
+		FromLon:   longitude,
+		FromLat:   latitude,
+		ByRadius:  true,
+		Radius:    radius,
+		Unit:      unit,
+		WithDist:  withDist,
+		WithCoord: withCoord,
+		WithHash:  withHash,
+		Count:     count,
+		Sort:      sortOption,
 	})
-
-	// Sort results
-	sortOrder := strings.ToUpper(sortOption)
-	sortGeoResults(results, sortOrder)
-
-	// Apply count limit
-	if count > 0 && len(results) > count {
-		results = results[:count]
-	}
-
-	return results, nil
 }
 
-// GeoSearch searches for geographical points stored in the memory cache based on the provided options.
-// It supports searching by radius or bounding box, and can sort and limit the results.
+// GeoSearch searches the members of the geo set at key within a radius of,
+// or a box centered on, a member or a point.
 //
 // Parameters:
-//   - key: The key identifying the set of geographical points.
-//   - options: A pointer to GeoSearchOptions containing search parameters.
+//   - key: The key of the geo set.
+//   - options: The search. The center is FromMember if set, else FromLon
+//     and FromLat. The area is a circle of Radius if ByRadius, the Polygon
+//     if ByPolygon, else a box of BoxWidth by BoxHeight, in Unit.
 //
 // Returns:
-//   - A slice of GeoPoint containing the search results.
-//   - An error if the search fails.
-//
-// The search options can include:
-//   - FromMember: The member name to start the search from. If provided, its coordinates will be used as the center.
-//   - FromLon, FromLat: The longitude and latitude to start the search from. These are set if FromMember is provided.
-//   - ByRadius: A boolean indicating if the search should be within a radius.
-//   - Radius: The radius distance for the search.
-//   - Unit: The unit of the radius (e.g., meters, kilometers).
-//   - ByBox: A boolean indicating if the search should be within a bounding box.
-//   - BoxWidth, BoxHeight: The width and height of the bounding box.
-//   - Sort: The sorting order of the results ("ASC" or "DESC").
-//   - Count: The maximum number of results to return.
-//
-// If FromMember is provided but not found, an error is returned.
-// If ByRadius is true, the search will include points within the specified radius from the center.
-// If ByBox is true, the search will include points within the specified bounding box.
-// The results can be sorted and limited based on the options provided.
+//   - A slice of GeoPoint holding the members found, with their distance to
+//     the center in Unit. With a Count, they are sorted by distance unless
+//     CountAny is set, in which case the search stops at the first Count
+//     members found.
+//   - An error if FromMember is not in the set, the unit is unknown or the
+//     polygon is invalid.
 func (c *MemoryCache) GeoSearch(key string, options *models.GeoSearchOptions) ([]models.GeoPoint, error) {
-	geoSetI, exists := c.geoData.Load(key)
-	if !exists {
+	conversion, err := geoUnit(options.Unit)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := c.zsets.Load(key); !exists {
 		return nil, nil
 	}
-	geoSet := geoSetI.(*sync.Map)
 
+	shape := geohash.Shape{Lon: options.FromLon, Lat: options.FromLat}
 	if options.FromMember != "" {
-		if pointI, exists := geoSet.Load(options.FromMember); exists {
-			point := pointI.(*models.GeoPoint)
-			options.FromLon = point.Longitude
-			options.FromLat = point.Latitude
-		} else {
-			return nil, fmt.Errorf("ERR member not found")
+		center, exists := c.geoPoint(key, options.FromMember)
+		if !exists {
+			return nil, fmt.Errorf("ERR could not decode requested zset member")
+		}
+		shape.Lon, shape.Lat = center.Longitude, center.Latitude
+	}
+	switch {
+	case options.ByPolygon:
+		if shape.Polygon, err = geohash.NewPolygon(options.Polygon); err != nil {
+			return nil, err
 		}
+	case options.ByBox:
+		shape.Box = true
+		shape.Width, shape.Height = options.BoxWidth*conversion, options.BoxHeight*conversion
+	default:
+		shape.Radius = options.Radius * conversion
 	}
 
 	var results []models.GeoPoint
-	geoSet.Range(func(_, pointI interface{}) bool {
-		point := pointI.(*models.GeoPoint)
-		var inArea bool
-
-		if options.ByRadius {
-			dist := calculateDistance(options.FromLon, options.FromLat, point.Longitude, point.Latitude)
-			radiusM := convertToMeters(options.Radius, options.Unit)
-			inArea = dist <= radiusM
-			if inArea {
-				result := *point
-				result.Distance = dist
-				results = append(results, result)
+search:
+	for _, r := range shape.Ranges() {
+		// Scores are integers below 2^52, so the range end is the score before Max
+		for _, member := range c.zsetManager.ZRangeByScoreWithScores(key, float64(r.Min), float64(r.Max-1)) {
+			point := newGeoPoint(member.Member, member.Score)
+			dist, ok := shape.Contains(point.Longitude, point.Latitude)
+			if !ok {
+				continue
 			}
-		} else if options.ByBox {
-			widthM := convertToMeters(options.BoxWidth, options.Unit)
-			heightM := convertToMeters(options.BoxHeight, options.Unit)
-
-			latDiff := math.Abs(point.Latitude - options.FromLat)
-			lonDiff := math.Abs(point.Longitude - options.FromLon)
-
-			inArea = latDiff <= heightM/(111320.0) &&
-				lonDiff <= widthM/(111320.0*math.Cos(options.FromLat*math.Pi/180.0))
-			if inArea {
-				result := *point
-				result.Distance = calculateDistance(options.FromLon, options.FromLat, point.Longitude, point.Latitude)
-				results = append(results, result)
+			point.Distance = dist / conversion
+			results = append(results, point)
+			if options.CountAny && len(results) == options.Count {
+				break search
 			}
 		}
+	}
 
-		return true
-	})
-
-	// Sort results if requested
-	if options.Sort != "" {
-		sortGeoResults(results, strings.ToUpper(options.Sort))
+	sortOrder := strings.ToUpper(options.Sort)
+	if sortOrder == "" && options.Count > 0 && !options.CountAny {
+		sortOrder = "ASC"
 	}
+	sortGeoResults(results, sortOrder)
 
-	// Apply count limit
 	if options.Count > 0 && len(results) > options.Count {
 		results = results[:options.Count]
 	}
-
 	return results, nil
 }
 
-// GeoSearchStore searches for geographical points based on the given options
-// from the source key and stores the results in the destination key.
+// GeoSearchStore searches the geo set at srcKey as GeoSearch does and
+// stores the members found as a geo set at destKey, replacing its value.
+// With StoreDist set, they are scored with their distance instead, which
+// makes destKey a plain sorted set.
 //
 // Parameters:
-// - destKey: The key where the search results will be stored.
-// - srcKey: The key from which the geographical search will be performed.
-// - options: The options to use for the geographical search.
+//   - destKey: The key where the search results are stored. It is deleted if there are none.
+//   - srcKey: The key of the geo set searched.
+//   - options: The search.
 //
 // Returns:
-// - int: The number of points stored in the destination key.
-// - error: An error if the search or store operation fails.
+//   - int: The number of members stored.
+//   - error: An error if the search fails.
 func (c *MemoryCache) GeoSearchStore(destKey, srcKey string, options *models.GeoSearchOptions) (int, error) {
 	results, err := c.GeoSearch(srcKey, options)
 	if err != nil {
 		return 0, err
 	}
 
-	geoSetI, _ := c.geoData.LoadOrStore(destKey, &sync.Map{})
-	geoSet := geoSetI.(*sync.Map)
-
-	stored := 0
+	zset := &sync.Map{}
 	for _, point := range results {
-		geoSet.Store(point.Name, &point)
-		stored++
+		score := float64(point.Hash)
+		if options.StoreDist {
+			score = point.Distance
+		}
+		zset.Store(point.Name, score)
 	}
 
-	if stored > 0 {
+	c.Del(destKey)
+	if len(results) > 0 {
+		c.zsets.Store(destKey, zset)
 		c.incrementKeyVersion(destKey)
 	}
+	return len(results), nil
+}
 
-	return stored, nil
+// GeoFenceAdd adds a fence to the geo set at key, replacing the fence of
+// the same name. The set need not exist.
+//
+// Parameters:
+//   - key: The key of the geo set.
+//   - fence: The fence, a polygon or a circle.
+//
+// Returns:
+//   - bool: True if the fence is new, false if it replaced one.
+//   - error: An error if the fence is not a valid area.
+func (c *MemoryCache) GeoFenceAdd(key string, fence models.GeoFence) (bool, error) {
+	f := &geoFence{GeoFence: fence}
+	if len(fence.Polygon) > 0 {
+		polygon, err := geohash.NewPolygon(fence.Polygon)
+		if err != nil {
+			return false, err
+		}
+		f.shape.Polygon = polygon
+		f.shape.Lon, f.shape.Lat = polygon.Center()
+	} else {
+		conversion, err := geoUnit(fence.Unit)
+		if err != nil {
+			return false, err
+		}
+		if !geohash.Valid(fence.Longitude, fence.Latitude) {
+			return false, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", fence.Longitude, fence.Latitude)
+		}
+		if fence.Radius < 0 {
+			return false, fmt.Errorf("ERR radius cannot be negative")
+		}
+		f.shape = geohash.Shape{Lon: fence.Longitude, Lat: fence.Latitude, Radius: fence.Radius * conversion}
+	}
+
+	value, _ := c.geoFences.LoadOrStore(key, &geoFenceSet{fences: make(map[string]*geoFence)})
+	fences := value.(*geoFenceSet)
+	fences.mu.Lock()
+	defer fences.mu.Unlock()
+
+	_, exists := fences.fences[fence.Name]
+	fences.fences[fence.Name] = f
+	return !exists, nil
 }
 
-func (c *MemoryCache) defragGeoData() {
-	c.geoData.Range(func(key, valueI interface{}) bool {
-		geoSet := valueI.(*sync.Map)
-		defraggedGeoSet := c.defragSyncMap(geoSet)
-		if defraggedGeoSet != geoSet {
-			c.geoData.Store(key, defraggedGeoSet)
+// GeoFenceDel removes fences from the geo set at key.
+//
+// Parameters:
+//   - key: The key of the geo set.
+//   - names: The names of the fences to remove.
+//
+// Returns:
+//   - int: The number of fences removed.
+func (c *MemoryCache) GeoFenceDel(key string, names ...string) int {
+	value, ok := c.geoFences.Load(key)
+	if !ok {
+		return 0
+	}
+	fences := value.(*geoFenceSet)
+	fences.mu.Lock()
+	defer fences.mu.Unlock()
+
+	removed := 0
+	for _, name := range names {
+		if _, exists := fences.fences[name]; exists {
+			delete(fences.fences, name)
+			removed++
 		}
-		return true
+	}
+	return removed
+}
+
+// GeoFenceList returns the fences of the geo set at key, sorted by name.
+func (c *MemoryCache) GeoFenceList(key string) []models.GeoFence {
+	value, ok := c.geoFences.Load(key)
+	if !ok {
+		return nil
+	}
+	fences := value.(*geoFenceSet)
+	fences.mu.Lock()
+	defer fences.mu.Unlock()
+
+	list := make([]models.GeoFence, 0, len(fences.fences))
+	for _, fence := range fences.fences {
+		list = append(list, fence.GeoFence)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
 	})
+	return list
 }
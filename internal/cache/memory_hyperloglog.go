@@ -2,33 +2,55 @@ package cache
 
 import (
 	"fmt"
-	"hash/fnv"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 )
 
+// loadHLL returns the HyperLogLog stored at key. A string holding a HyperLogLog
+// in the Redis representation, typically written by SET, is taken over as one.
+// A missing key yields nil, or a new empty HyperLogLog if create is set.
+func (c *MemoryCache) loadHLL(key string, create bool) (*models.HyperLogLog, bool, error) {
+	if hllI, exists := c.hlls.Load(key); exists {
+		return hllI.(*models.HyperLogLog), false, nil
+	}
+
+	if value, exists := c.strings.Load(key); exists {
+		hll, err := models.ParseHyperLogLog([]byte(value.(string)))
+		if err != nil {
+			return nil, false, err
+		}
+		hllI, _ := c.hlls.LoadOrStore(key, hll)
+		c.strings.Delete(key)
+		return hllI.(*models.HyperLogLog), false, nil
+	}
+
+	if !create {
+		return nil, false, nil
+	}
+	c.bloomFilter.Add([]byte(key))
+	hllI, loaded := c.hlls.LoadOrStore(key, models.NewHyperLogLog())
+	return hllI.(*models.HyperLogLog), !loaded, nil
+}
+
 // PFAdd adds the specified elements to the HyperLogLog data structure associated with the given key.
-// It returns a boolean indicating whether the HyperLogLog was modified and an error if any occurred.
+// It returns a boolean indicating whether the HyperLogLog was created or modified and an error if any occurred.
 //
 // Parameters:
 //   - key: The key associated with the HyperLogLog data structure.
 //   - elements: The elements to be added to the HyperLogLog.
 //
 // Returns:
-//   - bool: True if the HyperLogLog was modified, false otherwise.
-//   - error: An error if any occurred during the operation.
+//   - bool: True if the HyperLogLog was created or modified, false otherwise.
+//   - error: An error if the key holds a string that is not a HyperLogLog.
 func (c *MemoryCache) PFAdd(key string, elements ...string) (bool, error) {
-	hllI, _ := c.hlls.LoadOrStore(key, models.NewHyperLogLog())
-	hll := hllI.(*models.HyperLogLog)
+	hll, created, err := c.loadHLL(key, true)
+	if err != nil {
+		return false, err
+	}
 
-	modified := false
+	modified := created
 	for _, element := range elements {
-		// Create FNV-64a hash
-		h := fnv.New64a()
-		h.Write([]byte(element))
-		hashValue := h.Sum64()
-
-		if hll.Add(hashValue) {
+		if hll.Add([]byte(element)) {
 			modified = true
 		}
 	}
@@ -41,8 +63,9 @@ func (c *MemoryCache) PFAdd(key string, elements ...string) (bool, error) {
 }
 
 // PFCount returns the approximate cardinality of the set(s) stored at the given key(s).
-// If a single key is provided, it returns the cardinality of the set stored at that key.
-// If multiple keys are provided, it merges the sets stored at those keys and returns the cardinality of the merged set.
+// If a single key is provided, it returns the cardinality of the set stored at that key,
+// which is cached in the HyperLogLog until it changes.
+// If multiple keys are provided, it returns the cardinality of the union of the sets stored at those keys.
 // If no keys are provided, it returns an error indicating that at least one key is required.
 //
 // Parameters:
@@ -52,62 +75,61 @@ func (c *MemoryCache) PFAdd(key string, elements ...string) (bool, error) {
 // Returns:
 //
 //	int64 - The approximate cardinality of the set(s).
-//	error - An error if no keys are provided or if any other error occurs.
+//	error - An error if no keys are provided or a key holds a string that is not a HyperLogLog.
 func (c *MemoryCache) PFCount(keys ...string) (int64, error) {
 	if len(keys) == 0 {
 		return 0, fmt.Errorf("at least one key is required")
 	}
 
-	if len(keys) == 1 {
-		// Single key case
-		if hllI, exists := c.hlls.Load(keys[0]); exists {
-			hll := hllI.(*models.HyperLogLog)
-			return int64(hll.Count()), nil
-		}
-		return 0, nil
-	}
-
-	// Multiple keys case - merge all HLLs
-	merged := models.NewHyperLogLog()
+	hlls := make([]*models.HyperLogLog, 0, len(keys))
 	for _, key := range keys {
-		if hllI, exists := c.hlls.Load(key); exists {
-			hll := hllI.(*models.HyperLogLog)
-			merged.Merge(hll)
+		hll, _, err := c.loadHLL(key, false)
+		if err != nil {
+			return 0, err
+		}
+		if hll != nil {
+			hlls = append(hlls, hll)
 		}
 	}
 
-	return int64(merged.Count()), nil
+	switch {
+	case len(hlls) == 0:
+		return 0, nil
+	case len(keys) == 1:
+		return int64(hlls[0].Count()), nil
+	}
+	return int64(models.CountMerged(hlls...)), nil
 }
 
 // PFMerge merges multiple HyperLogLog structures into a destination HyperLogLog.
-// It takes a destination key and one or more source keys. If no source keys are provided,
-// it returns an error. The function creates or retrieves the destination HyperLogLog,
-// then merges all source HyperLogLogs into the destination. Finally, it increments the
-// version of the destination key.
+// The destination, created if it does not exist, takes the union of its own
+// registers and those of the sources. Finally, it increments the version of
+// the destination key.
 //
 // Parameters:
 //   - destKey: The key for the destination HyperLogLog.
-//   - sourceKeys: One or more keys for the source HyperLogLogs.
+//   - sourceKeys: The keys for the source HyperLogLogs.
 //
 // Returns:
-//   - error: An error if no source keys are provided, otherwise nil.
+//   - error: An error if a key holds a string that is not a HyperLogLog, otherwise nil.
 func (c *MemoryCache) PFMerge(destKey string, sourceKeys ...string) error {
-	if len(sourceKeys) == 0 {
-		return fmt.Errorf("at least one source key is required")
-	}
-
-	// Create or get destination HLL
-	destHLLI, _ := c.hlls.LoadOrStore(destKey, models.NewHyperLogLog())
-	destHLL := destHLLI.(*models.HyperLogLog)
-
-	// Merge all source HLLs
+	sources := make([]*models.HyperLogLog, 0, len(sourceKeys))
 	for _, sourceKey := range sourceKeys {
-		if sourceHLLI, exists := c.hlls.Load(sourceKey); exists {
-			sourceHLL := sourceHLLI.(*models.HyperLogLog)
-			destHLL.Merge(sourceHLL)
+		hll, _, err := c.loadHLL(sourceKey, false)
+		if err != nil {
+			return err
+		}
+		if hll != nil {
+			sources = append(sources, hll)
 		}
 	}
 
+	destHLL, _, err := c.loadHLL(destKey, true)
+	if err != nil {
+		return err
+	}
+	destHLL.Merge(sources...)
+
 	c.incrementKeyVersion(destKey)
 	return nil
 }
@@ -122,12 +144,14 @@ func (c *MemoryCache) PFMerge(destKey string, sourceKeys ...string) error {
 //   - map[string]interface{}: A map containing the debug information of the HyperLogLog.
 //   - error: An error if the key does not exist.
 func (c *MemoryCache) PFDebug(key string) (map[string]interface{}, error) {
-	hllI, exists := c.hlls.Load(key)
-	if !exists {
+	hll, _, err := c.loadHLL(key, false)
+	if err != nil {
+		return nil, err
+	}
+	if hll == nil {
 		return nil, fmt.Errorf("key not found")
 	}
 
-	hll := hllI.(*models.HyperLogLog)
 	return hll.Debug(), nil
 }
 
@@ -144,12 +168,7 @@ func (c *MemoryCache) PFSelfTest() error {
 	// Test basic operations
 	testData := []string{"a", "b", "a", "c", "d", "a"}
 	for _, elem := range testData {
-		// Create FNV-64a hash
-		h := fnv.New64a()
-		h.Write([]byte(elem))
-		hashValue := h.Sum64()
-
-		hll.Add(hashValue)
+		hll.Add([]byte(elem))
 	}
 
 	// Verify count is within expected range
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/genc-murat/crystalcache/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSetNXIsAtomic(t *testing.T) {
+	const callers = 32
+
+	for round := 0; round < 100; round++ {
+		c := NewMemoryCache()
+		h := handlers.NewJSONHandlers(c)
+		require.Equal(t, "OK", run(h.HandleJSON, "doc", "$", `{}`).Str)
+
+		var rootGranted, fieldGranted atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				<-start
+				if run(h.HandleJSON, "new", "$", token, "NX").Str == "OK" {
+					rootGranted.Add(1)
+				}
+				if run(h.HandleJSON, "doc", "$.owner", token, "NX").Str == "OK" {
+					fieldGranted.Add(1)
+				}
+			}(strconv.Itoa(i))
+		}
+		close(start)
+		wg.Wait()
+
+		require.Equal(t, int32(1), rootGranted.Load(), "round %d: the new key was created more than once", round)
+		require.Equal(t, int32(1), fieldGranted.Load(), "round %d: the field was set more than once", round)
+	}
+}
+
+func TestJSONUpdatesAreNotLost(t *testing.T) {
+	const writers, writes = 8, 50
+
+	c := NewMemoryCache()
+	h := handlers.NewJSONHandlers(c)
+	require.Equal(t, "OK", run(h.HandleJSON, "doc", "$", `{"n":0,"m":{"n":0},"arr":[],"obj":{}}`).Str)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				// A singular path splices the stored document, a recursive
+				// one rewrites the decoded document
+				run(h.HandleJSONNumIncrBy, "doc", "$.n", "1")
+				run(h.HandleJSONNumIncrBy, "doc", "$..m.n", "1")
+				run(h.HandleJSONArrAppend, "doc", "$.arr", strconv.Itoa(i))
+				run(h.HandleJSONMerge, "doc", "$.obj", `{"w`+strconv.Itoa(w)+`-`+strconv.Itoa(i)+`":true}`)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := strconv.Itoa(writers * writes)
+	assert.Equal(t, "["+total+"]", run(h.HandleJSONGet, "doc", "$.n").Bulk)
+	assert.Equal(t, "["+total+"]", run(h.HandleJSONGet, "doc", "$.m.n").Bulk)
+	assert.Equal(t, writers*writes, run(h.HandleJSONArrLen, "doc", ".arr").Num)
+	assert.Equal(t, writers*writes, run(h.HandleJSONObjLen, "doc", ".obj").Num)
+}
+
+func TestJSONUpdatesFollowSchemas(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewJSONHandlers(c)
+	require.Equal(t, "OK", run(h.HandleJSONSchema, "SET", "capped:*", `{"properties":{"n":{"maximum":10}}}`).Str)
+	require.Equal(t, "OK", run(h.HandleJSON, "capped:1", "$", `{"n":9}`).Str)
+
+	assert.Equal(t, "[10]", run(h.HandleJSONNumIncrBy, "capped:1", "$.n", "1").Bulk)
+	assert.Equal(t, "error", run(h.HandleJSONNumIncrBy, "capped:1", "$.n", "1").Type)
+	assert.Equal(t, "error", run(h.HandleJSONMerge, "capped:1", "$", `{"n":11}`).Type)
+	assert.Equal(t, "error", run(h.HandleJSONPatch, "capped:1", `[{"op":"replace","path":"/n","value":12}]`).Type)
+	assert.Equal(t, "[10]", run(h.HandleJSONGet, "capped:1", "$.n").Bulk)
+}
+
+func TestJSONRenameAndCopyFollowSchemas(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewJSONHandlers(c)
+	s := handlers.NewStringHandlers(c)
+	require.Equal(t, "OK", run(h.HandleJSONSchema, "SET", "user:*", `{"required":["name"]}`).Str)
+	require.Equal(t, "OK", run(h.HandleJSON, "draft", "$", `{"age":3}`).Str)
+	require.Equal(t, "OK", run(h.HandleJSON, "named", "$", `{"name":"ada"}`).Str)
+
+	for _, reply := range []string{
+		run(s.HandleRename, "draft", "user:1").Str,
+		run(s.HandleRenameNX, "draft", "user:1").Str,
+		run(s.HandleCopy, "draft", "user:1").Str,
+	} {
+		assert.Contains(t, reply, "$")
+	}
+	// A rejected rename leaves the source in place
+	assert.Equal(t, `{"age":3}`, run(h.HandleJSONGet, "draft").Bulk)
+	assert.Equal(t, "null", run(h.HandleJSONGet, "user:1").Type)
+
+	assert.Equal(t, 1, run(s.HandleCopy, "named", "user:1").Num)
+	assert.Equal(t, "OK", run(s.HandleRename, "named", "user:2").Str)
+	assert.Equal(t, 1, run(s.HandleRenameNX, "user:2", "user:3").Num)
+	assert.Equal(t, `{"name":"ada"}`, run(h.HandleJSONGet, "user:3").Bulk)
+	assert.Equal(t, "null", run(h.HandleJSONGet, "named").Type)
+	assert.Equal(t, "null", run(h.HandleJSONGet, "user:2").Type)
+}
+
+func TestJSONStrAppendTakesJSONStrings(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewJSONHandlers(c)
+	require.Equal(t, "OK", run(h.HandleJSON, "doc", "$", `{"s":"ab"}`).Str)
+
+	assert.Equal(t, 3, run(h.HandleJSONStrAppend, "doc", ".s", `"c"`).Num)
+	assert.Equal(t, 6, run(h.HandleJSONStrAppend, "doc", ".s", `"\u0064\"!"`).Num)
+	assert.Equal(t, `["abcd\"!"]`, run(h.HandleJSONGet, "doc", "$.s").Bulk)
+
+	for _, value := range []string{`c`, `1`, `null`, `["c"]`} {
+		assert.Equal(t, "error", run(h.HandleJSONStrAppend, "doc", "$.s", value).Type, value)
+	}
+	assert.Equal(t, `["abcd\"!"]`, run(h.HandleJSONGet, "doc", "$.s").Bulk)
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
+	"github.com/genc-murat/crystalcache/pkg/utils/pattern"
+)
+
+// JSONSchemaSet enforces schema on the JSON keys matching keyPattern,
+// replacing any schema registered for the same pattern. It fails if an
+// existing key already violates the schema.
+func (c *MemoryCache) JSONSchemaSet(keyPattern string, schema *jsonUtil.Schema) error {
+	c.jsonSchemaMu.Lock()
+	defer c.jsonSchemaMu.Unlock()
+
+	validator := jsonUtil.NewValidationUtil()
+	var err error
+	c.jsonData.Range(func(k, v interface{}) bool {
+		key := k.(string)
+		if !pattern.Match(keyPattern, key) {
+			return true
+		}
+		if verr := validator.Validate(v.(*jsonUtil.Document).Decode(), schema); verr != nil {
+			err = fmt.Errorf("ERR existing key '%s' violates the schema at %v", key, verr)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	c.jsonSchemas[keyPattern] = schema
+	return nil
+}
+
+// JSONSchemaGet returns the schema registered for keyPattern.
+func (c *MemoryCache) JSONSchemaGet(keyPattern string) (*jsonUtil.Schema, bool) {
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	schema, ok := c.jsonSchemas[keyPattern]
+	return schema, ok
+}
+
+// JSONSchemaDel stops enforcing the schema registered for keyPattern.
+func (c *MemoryCache) JSONSchemaDel(keyPattern string) bool {
+	c.jsonSchemaMu.Lock()
+	defer c.jsonSchemaMu.Unlock()
+	_, ok := c.jsonSchemas[keyPattern]
+	delete(c.jsonSchemas, keyPattern)
+	return ok
+}
+
+// JSONSchemaList returns the registered key patterns in sorted order.
+func (c *MemoryCache) JSONSchemaList() []string {
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	return c.jsonSchemaPatterns()
+}
+
+// JSONSchemaCovers reports whether any schema applies to key.
+func (c *MemoryCache) JSONSchemaCovers(key string) bool {
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	return c.coversJSONSchema(key)
+}
+
+// coversJSONSchema is JSONSchemaCovers for callers holding jsonSchemaMu.
+func (c *MemoryCache) coversJSONSchema(key string) bool {
+	for keyPattern := range c.jsonSchemas {
+		if pattern.Match(keyPattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONSchemaCheck validates value against every schema applying to key.
+func (c *MemoryCache) JSONSchemaCheck(key string, value interface{}) error {
+	c.jsonSchemaMu.RLock()
+	defer c.jsonSchemaMu.RUnlock()
+	return c.checkJSONSchemas(key, value)
+}
+
+// checkJSONSchemas is JSONSchemaCheck for callers holding jsonSchemaMu.
+func (c *MemoryCache) checkJSONSchemas(key string, value interface{}) error {
+	if len(c.jsonSchemas) == 0 {
+		return nil
+	}
+	validator := jsonUtil.NewValidationUtil()
+	for _, keyPattern := range c.jsonSchemaPatterns() {
+		if !pattern.Match(keyPattern, key) {
+			continue
+		}
+		if err := validator.Validate(value, c.jsonSchemas[keyPattern]); err != nil {
+			return fmt.Errorf("ERR document violates schema '%s' at %v", keyPattern, err)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryCache) jsonSchemaPatterns() []string {
+	patterns := make([]string, 0, len(c.jsonSchemas))
+	for keyPattern := range c.jsonSchemas {
+		patterns = append(patterns, keyPattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
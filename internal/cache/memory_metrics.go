@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/genc-murat/crystalcache/internal/metrics"
+)
+
+// keyspaceMaps returns the storage map of every key type together with the
+// type name used in metrics labels.
+func (c *MemoryCache) keyspaceMaps() []struct {
+	name string
+	m    *sync.Map
+} {
+	return []struct {
+		name string
+		m    *sync.Map
+	}{
+		{"string", c.strings},
+		{"hash", c.hsets},
+		{"list", c.lists},
+		{"set", c.sets_},
+		{"zset", c.zsets},
+		{"stream", c.streams},
+		{"json", c.jsonData},
+		{"bitmap", c.bitmaps},
+		{"suggestion", c.suggestions},
+		{"cms", c.cms},
+		{"cuckoo", c.cuckooFilters},
+		{"hll", c.hlls},
+		{"tdigest", c.tdigests},
+		{"bloomfilter", c.bfilters},
+		{"topk", c.topks},
+		{"timeseries", c.timeSeries},
+	}
+}
+
+// Collect implements metrics.Collector for the keyspace and memory usage.
+func (c *MemoryCache) Collect(w *metrics.OpenMetricsWriter) {
+	keyspace := c.keyspaceMaps()
+	keys := make([]metrics.Sample, 0, len(keyspace))
+	for _, ks := range keyspace {
+		var count int64
+		ks.m.Range(func(_, _ interface{}) bool {
+			count++
+			return true
+		})
+		keys = append(keys, metrics.Sample{
+			Labels: []metrics.Label{{Name: "db", Value: "0"}, {Name: "type", Value: ks.name}},
+			Value:  float64(count),
+		})
+	}
+
+	var expiring int64
+	c.expires.Range(func(_, _ interface{}) bool {
+		expiring++
+		return true
+	})
+
+	w.Gauge("crystalcache_keys", "Number of keys per database and type.", keys...)
+	w.Gauge("crystalcache_keys_with_expiry", "Number of keys with an expiration set.",
+		metrics.Sample{Labels: []metrics.Label{{Name: "db", Value: "0"}}, Value: float64(expiring)})
+	w.Counter("crystalcache_expired_keys", "Total number of keys removed because their TTL elapsed.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&c.stats.expiredKeys))})
+	w.Counter("crystalcache_evicted_keys", "Total number of keys evicted because of the memory limit.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&c.stats.evictedKeys))})
+	w.Counter("crystalcache_keyspace_hits", "Total number of successful key lookups.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&c.stats.hits))})
+	w.Counter("crystalcache_keyspace_misses", "Total number of failed key lookups.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&c.stats.misses))})
+
+	analytics := c.GetMemoryAnalytics()
+	structures := []struct {
+		name  string
+		bytes int64
+	}{
+		{"string", analytics.StringMemory},
+		{"hash", analytics.HashMemory},
+		{"list", analytics.ListMemory},
+		{"set", analytics.SetMemory},
+		{"zset", analytics.ZSetMemory},
+		{"hll", analytics.HLLMemory},
+		{"json", analytics.JSONMemory},
+		{"stream", analytics.StreamMemory},
+		{"stream_group", analytics.StreamGroupMemory},
+		{"bitmap", analytics.BitmapMemory},
+		{"suggestion", analytics.SuggestionMemory},
+		{"cms", analytics.CMSMemory},
+		{"cuckoo", analytics.CuckooMemory},
+		{"tdigest", analytics.TDigestMemory},
+		{"topk", analytics.TopKMemory},
+		{"bloomfilter", analytics.BloomFilterMemory},
+		{"timeseries", analytics.TimeSeriesMemory},
+	}
+	byType := make([]metrics.Sample, 0, len(structures))
+	for _, s := range structures {
+		byType = append(byType, metrics.Sample{
+			Labels: []metrics.Label{{Name: "type", Value: s.name}},
+			Value:  float64(s.bytes),
+		})
+	}
+
+	w.Gauge("crystalcache_memory_used_bytes", "Bytes of heap currently allocated.",
+		metrics.Sample{Value: float64(analytics.CurrentlyInUse)})
+	w.Gauge("crystalcache_memory_system_bytes", "Bytes of memory obtained from the operating system.",
+		metrics.Sample{Value: float64(analytics.MaxMemoryUsed)})
+	w.Gauge("crystalcache_memory_fragmentation_ratio", "Ratio of memory obtained from the OS that is not in use by the heap.",
+		metrics.Sample{Value: analytics.FragmentationRatio})
+	w.Gauge("crystalcache_memory_structure_bytes", "Estimated bytes used per data structure.", byType...)
+	w.Counter("crystalcache_memory_allocations", "Total number of heap allocations.",
+		metrics.Sample{Value: float64(analytics.AllocationCount)})
+	w.Counter("crystalcache_memory_frees", "Total number of heap frees.",
+		metrics.Sample{Value: float64(analytics.FreeCount)})
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/genc-murat/crystalcache/internal/search"
+)
+
+// searchSource exposes the hash and JSON keyspaces to the search engine.
+type searchSource struct {
+	c *MemoryCache
+}
+
+func (s searchSource) LoadHash(key string) (map[string]string, bool) {
+	hashI, ok := s.c.hsets.Load(key)
+	if !ok {
+		return nil, false
+	}
+	fields := make(map[string]string)
+	hashI.(*sync.Map).Range(func(k, v interface{}) bool {
+		fields[k.(string)] = v.(string)
+		return true
+	})
+	return fields, true
+}
+
+func (s searchSource) LoadJSON(key string) (interface{}, bool) {
+	return s.c.GetJSON(key)
+}
+
+func (s searchSource) Keys(on search.SourceType, fn func(key string)) {
+	m := s.c.hsets
+	if on == search.OnJSON {
+		m = s.c.jsonData
+	}
+	m.Range(func(k, _ interface{}) bool {
+		fn(k.(string))
+		return true
+	})
+}
+
+// FTCreate creates a secondary index and indexes the keys it already covers.
+// Later writes to those keys are indexed as they happen.
+func (c *MemoryCache) FTCreate(def *search.IndexDefinition) error {
+	return c.search.Create(def)
+}
+
+// FTDropIndex removes an index. With deleteDocs the indexed keys are
+// deleted as well.
+func (c *MemoryCache) FTDropIndex(name string, deleteDocs bool) error {
+	keys, err := c.search.Drop(name)
+	if err != nil {
+		return err
+	}
+	if deleteDocs {
+		for _, key := range keys {
+			c.Del(key)
+		}
+	}
+	return nil
+}
+
+// FTInfo returns the definition and statistics of an index.
+func (c *MemoryCache) FTInfo(name string) (*search.IndexInfo, error) {
+	return c.search.Info(name)
+}
+
+// FTList returns the names of all indexes.
+func (c *MemoryCache) FTList() []string {
+	return c.search.List()
+}
+
+// FTSearch runs a query against an index.
+func (c *MemoryCache) FTSearch(index, query string, opts *search.SearchOptions) (*search.SearchResult, error) {
+	return c.search.Search(index, query, opts)
+}
+
+// FTAggregate runs an aggregation pipeline against an index.
+func (c *MemoryCache) FTAggregate(index string, req *search.AggregateRequest) (*search.AggregateResult, error) {
+	return c.search.Aggregate(index, req)
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ftCreate(t *testing.T, c *MemoryCache, args ...string) {
+	t.Helper()
+	def, err := search.ParseCreate(args)
+	require.NoError(t, err)
+	require.NoError(t, c.FTCreate(def))
+}
+
+func ftSearch(t *testing.T, c *MemoryCache, index, query string) []string {
+	t.Helper()
+	res, err := c.FTSearch(index, query, &search.SearchOptions{Limit: 100, Dialect: 1})
+	require.NoError(t, err)
+	keys := make([]string, 0, len(res.Hits))
+	for _, hit := range res.Hits {
+		keys = append(keys, hit.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSearchFollowsHashWrites(t *testing.T) {
+	c := NewMemoryCache()
+	require.NoError(t, c.HSet("product:1", "title", "trail shoes"))
+	ftCreate(t, c, "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA", "title", "TEXT", "price", "NUMERIC")
+	assert.Equal(t, []string{"product:1"}, ftSearch(t, c, "products", "shoes"))
+
+	// Writes after the index exists are indexed as they happen
+	require.NoError(t, c.HSet("product:2", "title", "office shoes"))
+	require.NoError(t, c.HSet("product:2", "price", "80"))
+	require.NoError(t, c.HSet("other:1", "title", "shoes"))
+	assert.Equal(t, []string{"product:1", "product:2"}, ftSearch(t, c, "products", "shoes"))
+	assert.Equal(t, []string{"product:2"}, ftSearch(t, c, "products", "@price:[0 100]"))
+
+	require.NoError(t, c.HSet("product:2", "title", "office boots"))
+	assert.Equal(t, []string{"product:1"}, ftSearch(t, c, "products", "shoes"))
+	assert.Equal(t, []string{"product:2"}, ftSearch(t, c, "products", "boots"))
+
+	deleted, err := c.HDel("product:2", "price")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	assert.Empty(t, ftSearch(t, c, "products", "@price:[0 100]"))
+
+	deleted, err = c.Del("product:1")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	assert.Empty(t, ftSearch(t, c, "products", "shoes"))
+
+	require.NoError(t, c.Rename("product:2", "archived:2"))
+	assert.Empty(t, ftSearch(t, c, "products", "boots"))
+	require.NoError(t, c.Rename("archived:2", "product:3"))
+	assert.Equal(t, []string{"product:3"}, ftSearch(t, c, "products", "boots"))
+}
+
+func TestSearchFollowsConcurrentHashWrites(t *testing.T) {
+	const writers = 8
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel"}
+
+	c := NewMemoryCache()
+	ftCreate(t, c, "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA", "title", "TEXT")
+
+	for round := 0; round < 200; round++ {
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(word string) {
+				defer wg.Done()
+				<-start
+				assert.NoError(t, c.HSet("product:1", "title", word))
+			}(words[w])
+		}
+		close(start)
+		wg.Wait()
+
+		// Whichever write landed last is what the index holds
+		title, exists := c.HGet("product:1", "title")
+		require.True(t, exists)
+		for _, word := range words {
+			expected := []string{}
+			if word == title {
+				expected = []string{"product:1"}
+			}
+			require.Equal(t, expected, ftSearch(t, c, "products", word), "round %d: stored title %q", round, title)
+		}
+	}
+}
+
+func TestSearchFollowsJSONWrites(t *testing.T) {
+	c := NewMemoryCache()
+	ftCreate(t, c, "users", "ON", "JSON", "PREFIX", "1", "user:", "SCHEMA", "$.name", "AS", "name", "TEXT", "$.city", "AS", "city", "TAG")
+
+	require.NoError(t, c.SetJSON("user:1", map[string]interface{}{"name": "Alice", "city": "Paris"}))
+	require.NoError(t, c.SetJSON("user:2", map[string]interface{}{"name": "Bob", "city": "Berlin"}))
+	assert.Equal(t, []string{"user:1"}, ftSearch(t, c, "users", "@city:{paris}"))
+
+	require.NoError(t, c.SetJSON("user:1", map[string]interface{}{"name": "Alice", "city": "Berlin"}))
+	assert.Equal(t, []string{"user:1", "user:2"}, ftSearch(t, c, "users", "@city:{berlin}"))
+
+	require.True(t, c.DeleteJSON("user:2"))
+	assert.Equal(t, []string{"user:1"}, ftSearch(t, c, "users", "@city:{berlin}"))
+}
+
+func TestSearchFollowsExpiry(t *testing.T) {
+	c := NewMemoryCache()
+	ftCreate(t, c, "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA", "title", "TEXT")
+	require.NoError(t, c.HSet("product:1", "title", "trail shoes"))
+	require.NoError(t, c.HSet("product:2", "title", "office shoes"))
+
+	require.NoError(t, c.PExpireAt("product:1", time.Now().Add(50*time.Millisecond).UnixMilli()))
+	assert.Equal(t, []string{"product:1", "product:2"}, ftSearch(t, c, "products", "shoes"))
+
+	assert.Eventually(t, func() bool {
+		keys := ftSearch(t, c, "products", "shoes")
+		return len(keys) == 1 && keys[0] == "product:2"
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.False(t, c.Exists("product:1"))
+}
@@ -15,11 +15,7 @@ func (c *MemoryCache) Sort(key string, desc bool, alpha bool, limit bool, start
 	// Check what type of key we're dealing with
 	switch c.Type(key) {
 	case "list":
-		if listI, exists := c.lists.Load(key); exists {
-			list := listI.(*[]string)
-			values = make([]string, len(*list))
-			copy(values, *list)
-		}
+		values, _ = c.LRange(key, 0, -1)
 	case "set":
 		if setI, exists := c.sets_.Load(key); exists {
 			set := setI.(*sync.Map)
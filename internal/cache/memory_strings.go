@@ -4,12 +4,16 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	"github.com/genc-murat/crystalcache/internal/cache/bitmap"
 	"github.com/genc-murat/crystalcache/internal/core/models"
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
 )
 
+// embstrMaxLen is the longest string Redis reports as embstr encoded
+const embstrMaxLen = 44
+
 // Set stores a key-value pair in the memory cache. It adds the key to the bloom filter,
 // stores the value in the cache, and increments the version of the key.
 //
@@ -24,10 +28,79 @@ import (
 func (c *MemoryCache) Set(key string, value string) error {
 	c.bloomFilter.Add([]byte(key))
 	c.strings.Store(key, value)
+	c.hlls.Delete(key)
 	c.incrementKeyVersion(key)
 	return nil
 }
 
+// SetWithOptions stores a string like Set, applying the NX, XX, GET and
+// expiry options of SET atomically: of concurrent SET NX calls on a key,
+// exactly one writes, even when the key has expired but is not deleted yet.
+// Values of other types are replaced, unless the old value is requested.
+func (c *MemoryCache) SetWithOptions(key string, value string, opts models.SetOptions) (models.SetResult, error) {
+	// The value and its expiry change together, so that no other caller
+	// sees the new value with the expiry of the old one
+	unlock := c.lockKey(key)
+	defer unlock()
+
+	var result models.SetResult
+	for {
+		result = models.SetResult{}
+		old, loaded := c.strings.Load(key)
+		otherType := false
+		if loaded {
+			if !c.expired(key) {
+				result.Previous, result.Existed = old.(string), true
+			}
+		} else if hll, exists := c.hlls.Load(key); exists {
+			// HyperLogLogs are strings to their clients
+			result.Previous, result.Existed = string(hll.(*models.HyperLogLog).Bytes()), true
+		} else if c.Exists(key) {
+			if opts.Get {
+				return result, fmt.Errorf("WRONGTYPE Operation against a key holding the wrong kind of value")
+			}
+			result.Existed, otherType = true, true
+		}
+
+		if (opts.NX && result.Existed) || (opts.XX && !result.Existed) {
+			return result, nil
+		}
+
+		if loaded {
+			if !c.strings.CompareAndSwap(key, old, value) {
+				continue
+			}
+			break
+		}
+		if otherType {
+			c.Del(key)
+		}
+		if _, raced := c.strings.LoadOrStore(key, value); !raced {
+			break
+		}
+	}
+
+	c.bloomFilter.Add([]byte(key))
+	c.hlls.Delete(key)
+	switch {
+	case !opts.ExpireAt.IsZero():
+		c.scheduleExpiry(key, opts.ExpireAt)
+	case !opts.KeepTTL || !result.Existed:
+		c.expires.Delete(key)
+	}
+	c.lastAccessed.Store(key, time.Now())
+	c.incrementKeyVersion(key)
+	result.Written = true
+	return result, nil
+}
+
+// expired reports whether key has an expiry in the past, its value waiting
+// to be deleted
+func (c *MemoryCache) expired(key string) bool {
+	expireTime, ok := c.expires.Load(key)
+	return ok && time.Now().After(expireTime.(time.Time))
+}
+
 // Get retrieves the value associated with the given key from the memory cache.
 // It first checks if the key is likely to be present using a bloom filter.
 // If the key is not present in the bloom filter, it returns an empty string and false.
@@ -48,9 +121,8 @@ func (c *MemoryCache) Get(key string) (string, bool) {
 
 	if expireTime, ok := c.expires.Load(key); ok {
 		if expTime, ok := expireTime.(time.Time); ok && time.Now().After(expTime) {
-			c.strings.Delete(key)
-			c.expires.Delete(key)
-			return "", false
+			// Unless it was just written again, the key is gone after this
+			c.expireKey(key)
 		}
 	}
 
@@ -58,6 +130,11 @@ func (c *MemoryCache) Get(key string) (string, bool) {
 		c.lastAccessed.Store(key, time.Now())
 		return value.(string), true
 	}
+	// HyperLogLogs read as their Redis string representation
+	if hll, exists := c.hlls.Load(key); exists {
+		c.lastAccessed.Store(key, time.Now())
+		return string(hll.(*models.HyperLogLog).Bytes()), true
+	}
 	return "", false
 }
 
@@ -67,7 +144,7 @@ func (c *MemoryCache) Get(key string) (string, bool) {
 // If the key has expired, it returns -2 and schedules the key for deletion.
 func (c *MemoryCache) PTTL(key string) int64 {
 	// Check if key exists
-	if _, exists := c.strings.Load(key); !exists {
+	if !c.Exists(key) {
 		return -2
 	}
 
@@ -81,13 +158,7 @@ func (c *MemoryCache) PTTL(key string) int64 {
 	ttlMs := time.Until(expireTime).Milliseconds()
 	if ttlMs < 0 {
 		// Key has expired, clean it up
-		go func() {
-			c.strings.Delete(key)
-			c.expires.Delete(key)
-			if c.stats != nil {
-				atomic.AddInt64(&c.stats.expiredKeys, 1)
-			}
-		}()
+		go c.expireKey(key)
 		return -2
 	}
 
@@ -130,7 +201,6 @@ func (c *MemoryCache) Incr(key string) (int, error) {
 // - lists
 // - jsonData
 // - zsets
-// - geoData
 // - suggestions
 // - cms
 // - cuckooFilters
@@ -169,10 +239,6 @@ func (c *MemoryCache) Del(key string) (bool, error) {
 		deleted = true
 	}
 
-	if _, ok := c.geoData.LoadAndDelete(key); ok {
-		deleted = true
-	}
-
 	if _, ok := c.suggestions.LoadAndDelete(key); ok {
 		deleted = true
 	}
@@ -206,9 +272,14 @@ func (c *MemoryCache) Del(key string) (bool, error) {
 	}
 
 	if _, ok := c.timeSeries.LoadAndDelete(key); ok {
+		c.tsIndex.Remove(key)
 		deleted = true
 	}
 
+	if deleted {
+		c.expires.Delete(key)
+	}
+
 	return deleted, nil
 }
 
@@ -244,9 +315,55 @@ func (c *MemoryCache) MGetType(keys []string) map[string]string {
 // Returns:
 //   - error: An error if the operation fails, otherwise nil.
 func (c *MemoryCache) PExpireAt(key string, timestampMs int64) error {
-	// Convert millisecond timestamp to time.Time
-	expireTime := time.Unix(0, timestampMs*int64(time.Millisecond))
+	c.scheduleExpiry(key, time.UnixMilli(timestampMs))
+	return nil
+}
+
+// PExpire sets a time to live in milliseconds on key under condition, one
+// of NX, XX, GT and LT, or none if empty. For GT and LT a key without a
+// time to live never expires. A time to live that is not positive deletes
+// the key. It reports whether the expiry was changed.
+func (c *MemoryCache) PExpire(key string, milliseconds int64, condition string) (bool, error) {
+	if !c.Exists(key) || c.expired(key) {
+		return false, nil
+	}
+
+	expireTime := time.Now().Add(time.Duration(milliseconds) * time.Millisecond)
+	currentI, hasExpire := c.expires.Load(key)
+
+	switch condition {
+	case "NX":
+		if hasExpire {
+			return false, nil
+		}
+	case "XX":
+		if !hasExpire {
+			return false, nil
+		}
+	case "GT":
+		if !hasExpire || !expireTime.After(currentI.(time.Time)) {
+			return false, nil
+		}
+	case "LT":
+		if hasExpire && !expireTime.Before(currentI.(time.Time)) {
+			return false, nil
+		}
+	case "":
+	default:
+		return false, fmt.Errorf("ERR Unsupported option %s", condition)
+	}
+
+	if milliseconds <= 0 {
+		c.Del(key)
+		return true, nil
+	}
+	c.scheduleExpiry(key, expireTime)
+	return true, nil
+}
 
+// scheduleExpiry makes key expire at expireTime, replacing any expiry it
+// had.
+func (c *MemoryCache) scheduleExpiry(key string, expireTime time.Time) {
 	// Store expiration time
 	c.expires.Store(key, expireTime)
 
@@ -260,16 +377,10 @@ func (c *MemoryCache) PExpireAt(key string, timestampMs int64) error {
 		// Check if the key still exists with the same expiration time
 		if expTime, exists := c.expires.Load(key); exists {
 			if expTime.(time.Time).Equal(expireTime) {
-				c.Del(key)
-				// Increment expired keys counter
-				if c.stats != nil {
-					atomic.AddInt64(&c.stats.expiredKeys, 1)
-				}
+				c.expireKey(key)
 			}
 		}
 	}()
-
-	return nil
 }
 
 // SEExpire sets the expiration time for a given key in the memory cache based on a specified condition.
@@ -348,11 +459,7 @@ func (c *MemoryCache) SEExpire(key string, seconds int, condition string) (bool,
 		// Check if the key still exists with the same expiration time
 		if expTime, exists := c.expires.Load(key); exists {
 			if expTime.(time.Time).Equal(newExpireTime) {
-				c.Del(key)
-				// Increment expired keys counter
-				if c.stats != nil {
-					atomic.AddInt64(&c.stats.expiredKeys, 1)
-				}
+				c.expireKey(key)
 			}
 		}
 	}()
@@ -385,8 +492,6 @@ func (c *MemoryCache) Unlink(key string) (bool, error) {
 			c.streams.Delete(key)
 		case "bitmap":
 			c.bitmaps.Delete(key)
-		case "geo":
-			c.geoData.Delete(key)
 		case "suggestion":
 			c.suggestions.Delete(key)
 		case "cms":
@@ -457,9 +562,8 @@ func (c *MemoryCache) RenameNX(oldKey, newKey string) (bool, error) {
 			c.zsets.Store(newKey, value)
 		}
 	case "json":
-		value, exists = c.jsonData.LoadAndDelete(oldKey)
-		if exists {
-			c.jsonData.Store(newKey, value)
+		if err := c.renameJSON(oldKey, newKey); err != nil {
+			return false, err
 		}
 	case "stream":
 		value, exists = c.streams.LoadAndDelete(oldKey)
@@ -523,14 +627,11 @@ func (c *MemoryCache) Copy(source, destination string, replace bool) (bool, erro
 		}
 
 	case "list":
-		if value, exists := c.lists.Load(source); exists {
-			// Deep copy the list
-			originalList := value.(*[]string)
-			newList := make([]string, len(*originalList))
-			copy(newList, *originalList)
-			c.lists.Store(destination, &newList)
-			success = true
-		}
+		// Deep copy the list
+		success = c.withList(source, false, func(list *models.QuickList) bool {
+			c.lists.Store(destination, &listEntry{list: list.Clone()})
+			return false
+		})
 
 	case "set":
 		if value, exists := c.sets_.Load(source); exists {
@@ -560,7 +661,12 @@ func (c *MemoryCache) Copy(source, destination string, replace bool) (bool, erro
 
 	case "json":
 		if value, exists := c.jsonData.Load(source); exists {
-			c.jsonData.Store(destination, deepCopyJSON(value))
+			// Documents are immutable, but the schemas covering the
+			// destination must accept this one
+			doc := value.(*jsonUtil.Document)
+			if err := c.storeJSON(destination, doc, doc.Decode); err != nil {
+				return false, err
+			}
 			success = true
 		}
 
@@ -586,14 +692,8 @@ func (c *MemoryCache) Copy(source, destination string, replace bool) (bool, erro
 		}
 
 	case "bitmap":
-		if value, exists := c.bitmaps.Load(source); exists {
-			// Deep copy the bitmap
-			originalBitmap := value.([]byte)
-			newBitmap := make([]byte, len(originalBitmap))
-			copy(newBitmap, originalBitmap)
-			c.bitmaps.Store(destination, newBitmap)
-			success = true
-		}
+		// Deep copy the bitmap
+		success = c.bitmapManager.Copy(source, destination)
 	}
 
 	// Copy expiration if exists
@@ -609,26 +709,6 @@ func (c *MemoryCache) Copy(source, destination string, replace bool) (bool, erro
 	return success, nil
 }
 
-// Helper function to deep copy JSON values
-func deepCopyJSON(value interface{}) interface{} {
-	switch v := value.(type) {
-	case map[string]interface{}:
-		newMap := make(map[string]interface{})
-		for k, val := range v {
-			newMap[k] = deepCopyJSON(val)
-		}
-		return newMap
-	case []interface{}:
-		newSlice := make([]interface{}, len(v))
-		for i, val := range v {
-			newSlice[i] = deepCopyJSON(val)
-		}
-		return newSlice
-	default:
-		return v
-	}
-}
-
 func (c *MemoryCache) Persist(key string) (bool, error) {
 	// Check if key exists
 	if !c.Exists(key) {
@@ -663,6 +743,62 @@ func (c *MemoryCache) Touch(keys ...string) (int, error) {
 	return count, nil
 }
 
+// ObjectEncoding returns the internal representation of the value at key as
+// OBJECT ENCODING names it.
+func (c *MemoryCache) ObjectEncoding(key string) (string, bool) {
+	switch c.Type(key) {
+	case "none":
+		return "", false
+	case "string":
+		value, _ := c.strings.Load(key)
+		str, _ := value.(string)
+		if _, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return "int", true
+		}
+		if len(str) <= embstrMaxLen {
+			return "embstr", true
+		}
+		return "raw", true
+	case "list":
+		encoding := "quicklist"
+		c.withList(key, false, func(list *models.QuickList) bool {
+			if list.Nodes() <= 1 {
+				encoding = "listpack"
+			}
+			return false
+		})
+		return encoding, true
+	case "hash", "set":
+		return "hashtable", true
+	case "zset":
+		return "skiplist", true
+	case "stream":
+		return "stream", true
+	case "bitmap":
+		if value, _ := c.bitmaps.Load(key); value != nil {
+			if _, ok := value.(*bitmap.Roaring); ok {
+				return "roaring", true
+			}
+		}
+		return "raw", true
+	default:
+		return "raw", true
+	}
+}
+
+// ObjectIdleTime returns the number of seconds since the key was last read
+// or written.
+func (c *MemoryCache) ObjectIdleTime(key string) (int64, bool) {
+	if !c.Exists(key) {
+		return 0, false
+	}
+	accessed, ok := c.lastAccessed.Load(key)
+	if !ok {
+		return 0, true
+	}
+	return int64(time.Since(accessed.(time.Time)).Seconds()), true
+}
+
 func (c *MemoryCache) defragStrings() {
 	c.strings = c.defragSyncMap(c.strings)
 }
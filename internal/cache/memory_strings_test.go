@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run calls handle with args as bulk strings
+func run(handle func([]models.Value) models.Value, args ...string) models.Value {
+	values := make([]models.Value, len(args))
+	for i, arg := range args {
+		values[i] = models.Value{Type: "bulk", Bulk: arg}
+	}
+	return handle(values)
+}
+
+func TestSetOptionGrammar(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+
+	for _, args := range [][]string{
+		{"k", "v", "NX", "XX"},
+		{"k", "v", "XX", "NX"},
+		{"k", "v", "KEEPTTL", "EX", "10"},
+		{"k", "v", "EX", "10", "KEEPTTL"},
+		{"k", "v", "EX", "10", "PX", "100"},
+		{"k", "v", "EXAT", "10", "PXAT", "100"},
+		{"k", "v", "PX"},
+		{"k", "v", "BOGUS"},
+	} {
+		assert.Equal(t, "ERR syntax error", run(h.HandleSet, args...).Str, "SET %q", args)
+	}
+
+	for _, args := range [][]string{
+		{"k", "v", "EX", "0"},
+		{"k", "v", "PX", "-5"},
+		{"k", "v", "EX", strconv.FormatInt(1<<62, 10)},
+	} {
+		assert.Equal(t, "ERR invalid expire time in 'set' command", run(h.HandleSet, args...).Str, "SET %q", args)
+	}
+	assert.Equal(t, "ERR value is not an integer or out of range", run(h.HandleSet, "k", "v", "EX", "ten").Str)
+
+	_, exists := c.Get("k")
+	assert.False(t, exists, "rejected SETs must not write")
+}
+
+func TestSetConditions(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+
+	assert.Equal(t, "null", run(h.HandleSet, "k", "v", "XX").Type)
+	assert.Equal(t, "OK", run(h.HandleSet, "k", "v1", "NX").Str)
+	assert.Equal(t, "null", run(h.HandleSet, "k", "v2", "NX").Type)
+	assert.Equal(t, "OK", run(h.HandleSet, "k", "v3", "XX").Str)
+
+	value, _ := c.Get("k")
+	assert.Equal(t, "v3", value)
+
+	// GET returns the old value, whether or not the condition held
+	assert.Equal(t, "null", run(h.HandleSet, "new", "v", "GET").Type)
+	assert.Equal(t, "v", run(h.HandleSet, "new", "w", "GET").Bulk)
+	assert.Equal(t, "w", run(h.HandleSet, "new", "x", "NX", "GET").Bulk)
+	value, _ = c.Get("new")
+	assert.Equal(t, "w", value)
+
+	// GET fails on other types and leaves them alone
+	require.NoError(t, c.HSet("hash", "f", "v"))
+	assert.True(t, strings.HasPrefix(run(h.HandleSet, "hash", "v", "GET").Str, "WRONGTYPE"))
+	assert.Equal(t, "hash", c.Type("hash"))
+
+	// Without GET, other types are replaced
+	assert.Equal(t, "OK", run(h.HandleSet, "hash", "v").Str)
+	assert.Equal(t, "string", c.Type("hash"))
+}
+
+func TestSetExpiryOptions(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+
+	require.Equal(t, "OK", run(h.HandleSet, "k", "v", "EX", "100").Str)
+	assert.InDelta(t, 100000, c.PTTL("k"), 1000)
+
+	// KEEPTTL retains the expiry, a plain SET drops it
+	require.Equal(t, "OK", run(h.HandleSet, "k", "v2", "KEEPTTL").Str)
+	assert.InDelta(t, 100000, c.PTTL("k"), 1000)
+	require.Equal(t, "OK", run(h.HandleSet, "k", "v3").Str)
+	assert.Equal(t, int64(-1), c.PTTL("k"))
+
+	// KEEPTTL on a new key sets no expiry
+	require.Equal(t, "OK", run(h.HandleSet, "fresh", "v", "KEEPTTL").Str)
+	assert.Equal(t, int64(-1), c.PTTL("fresh"))
+
+	at := time.Now().Add(time.Hour)
+	require.Equal(t, "OK", run(h.HandleSet, "exat", "v", "EXAT", strconv.FormatInt(at.Unix(), 10)).Str)
+	assert.InDelta(t, time.Hour.Milliseconds(), c.PTTL("exat"), 2000)
+	require.Equal(t, "OK", run(h.HandleSet, "pxat", "v", "PXAT", strconv.FormatInt(at.UnixMilli(), 10)).Str)
+	assert.InDelta(t, time.Hour.Milliseconds(), c.PTTL("pxat"), 1000)
+
+	// A time in the past leaves a key that is already gone
+	require.Equal(t, "OK", run(h.HandleSet, "past", "v", "PXAT", "1").Str)
+	_, exists := c.Get("past")
+	assert.False(t, exists)
+}
+
+func TestSetNXOnExpiredKeyIsAtomic(t *testing.T) {
+	const callers = 32
+
+	for round := 0; round < 200; round++ {
+		c := NewMemoryCache()
+		h := handlers.NewStringHandlers(c)
+
+		// An expired lock whose deletion is still pending
+		key := "lock"
+		c.bloomFilter.Add([]byte(key))
+		c.strings.Store(key, "stale")
+		c.expires.Store(key, time.Now().Add(-time.Second))
+
+		var granted atomic.Int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(token string) {
+				defer wg.Done()
+				<-start
+				if run(h.HandleSet, key, token, "NX", "PX", "30000").Str == "OK" {
+					granted.Add(1)
+				}
+			}(strconv.Itoa(i))
+		}
+		close(start)
+		wg.Wait()
+
+		require.Equal(t, int32(1), granted.Load(), "round %d: the lock was granted more than once", round)
+		assert.Greater(t, c.PTTL(key), int64(0))
+	}
+}
+
+func TestExpiryOfOldValueSparesNewOne(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+
+	key := "lock"
+	c.bloomFilter.Add([]byte(key))
+	c.strings.Store(key, "stale")
+	c.expires.Store(key, time.Now().Add(-time.Second))
+
+	require.Equal(t, "OK", run(h.HandleSet, key, "mine", "NX").Str)
+	assert.Equal(t, "null", run(h.HandleSet, key, "theirs", "NX").Type)
+
+	// The deletion pending for the stale value runs late
+	c.expireKey(key)
+	value, exists := c.Get(key)
+	assert.True(t, exists)
+	assert.Equal(t, "mine", value)
+}
+
+func TestSetNXCommands(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+
+	assert.Equal(t, 1, run(h.HandleSetNX, "k", "v1").Num)
+	assert.Equal(t, 0, run(h.HandleSetNX, "k", "v2").Num)
+	value, _ := c.Get("k")
+	assert.Equal(t, "v1", value)
+	assert.Contains(t, run(h.HandleSetNX, "k").Str, "wrong number of arguments")
+
+	assert.Equal(t, "null", run(h.HandleGetSet, "g", "a").Type)
+	assert.Equal(t, "a", run(h.HandleGetSet, "g", "b").Bulk)
+	value, _ = c.Get("g")
+	assert.Equal(t, "b", value)
+
+	// GETSET drops the expiry, as SET does
+	require.Equal(t, "OK", run(h.HandleSet, "g", "c", "EX", "100").Str)
+	assert.Equal(t, "c", run(h.HandleGetSet, "g", "d").Bulk)
+	assert.Equal(t, int64(-1), c.PTTL("g"))
+
+	assert.Equal(t, "OK", run(h.HandlePSetEx, "p", "1500", "v").Str)
+	assert.InDelta(t, 1500, c.PTTL("p"), 100)
+	assert.Equal(t, "ERR invalid expire time in 'psetex' command", run(h.HandlePSetEx, "p", "0", "v").Str)
+	assert.Equal(t, "OK", run(h.HandleSetEx, "s", "100", "v").Str)
+	assert.InDelta(t, 100000, c.PTTL("s"), 1000)
+}
+
+func TestExpireConditions(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+	require.NoError(t, c.Set("k", "v"))
+
+	assert.Equal(t, 0, run(h.HandlePExpire, "missing", "1000").Num)
+
+	// XX and GT need an expiry, NX needs none
+	assert.Equal(t, 0, run(h.HandlePExpire, "k", "50000", "XX").Num)
+	assert.Equal(t, 0, run(h.HandlePExpire, "k", "50000", "GT").Num)
+	assert.Equal(t, 1, run(h.HandlePExpire, "k", "50000", "NX").Num)
+	assert.Equal(t, 0, run(h.HandlePExpire, "k", "90000", "NX").Num)
+
+	assert.Equal(t, 0, run(h.HandlePExpire, "k", "10000", "GT").Num)
+	assert.Equal(t, 1, run(h.HandlePExpire, "k", "90000", "GT").Num)
+	assert.Equal(t, 0, run(h.HandlePExpire, "k", "95000", "LT").Num)
+	assert.Equal(t, 1, run(h.HandleExpire, "k", "20", "LT").Num)
+	assert.InDelta(t, 20000, c.PTTL("k"), 1000)
+
+	assert.Equal(t, "ERR NX and XX, GT or LT options at the same time are not compatible",
+		run(h.HandlePExpire, "k", "1000", "NX", "GT").Str)
+	assert.Equal(t, "ERR GT and LT options at the same time are not compatible",
+		run(h.HandleExpire, "k", "10", "GT", "LT").Str)
+	assert.Equal(t, "ERR Unsupported option FOO", run(h.HandleExpire, "k", "10", "FOO").Str)
+	assert.Equal(t, "ERR invalid expire time in 'pexpire' command",
+		run(h.HandlePExpire, "k", strconv.FormatInt(1<<62, 10)).Str)
+
+	// A time to live that is not positive deletes the key
+	assert.Equal(t, 1, run(h.HandlePExpire, "k", "0").Num)
+	assert.False(t, c.Exists("k"))
+}
+
+func TestExpireAtConditions(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+	require.NoError(t, c.Set("k", "v"))
+
+	in := func(d time.Duration) (seconds, milliseconds string) {
+		at := time.Now().Add(d)
+		return strconv.FormatInt(at.Unix(), 10), strconv.FormatInt(at.UnixMilli(), 10)
+	}
+
+	hour, hourMs := in(time.Hour)
+	assert.Equal(t, 0, run(h.HandleExpireAt, "k", hour, "XX").Num)
+	assert.Equal(t, 1, run(h.HandleExpireAt, "k", hour, "NX").Num)
+	assert.InDelta(t, time.Hour.Milliseconds(), c.PTTL("k"), 2000)
+
+	_, halfHourMs := in(30 * time.Minute)
+	_, twoHoursMs := in(2 * time.Hour)
+	assert.Equal(t, 0, run(h.HandlePExpireAt, "k", halfHourMs, "GT").Num)
+	assert.Equal(t, 1, run(h.HandlePExpireAt, "k", twoHoursMs, "GT").Num)
+	assert.Equal(t, 1, run(h.HandlePExpireAt, "k", hourMs, "LT").Num)
+	assert.InDelta(t, time.Hour.Milliseconds(), c.PTTL("k"), 1000)
+
+	assert.Equal(t, "ERR NX and XX, GT or LT options at the same time are not compatible",
+		run(h.HandleExpireAt, "k", hour, "XX", "NX").Str)
+	assert.Contains(t, run(h.HandlePExpireAt, "k").Str, "wrong number of arguments for 'pexpireat'")
+
+	// A time in the past deletes the key
+	assert.Equal(t, 1, run(h.HandleExpireAt, "k", "1").Num)
+	assert.False(t, c.Exists("k"))
+	assert.Equal(t, 0, run(h.HandleExpireAt, "k", hour).Num)
+}
+
+func TestSubstr(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewStringHandlers(c)
+	require.NoError(t, c.Set("k", "This is a string"))
+
+	// SUBSTR is the old name of GETRANGE
+	assert.Equal(t, "This", run(h.HandleGetRange, "k", "0", "3").Bulk)
+	assert.Equal(t, "ing", run(h.HandleGetRange, "k", "-3", "-1").Bulk)
+	assert.Equal(t, "This is a string", run(h.HandleGetRange, "k", "0", "100").Bulk)
+	assert.Equal(t, "", run(h.HandleGetRange, "k", "5", "2").Bulk)
+	assert.Equal(t, "", run(h.HandleGetRange, "missing", "0", "3").Bulk)
+}
+
+func TestObjectEncodingAndIdleTime(t *testing.T) {
+	c := NewMemoryCache()
+	h := handlers.NewMemoryHandlers(c)
+
+	require.NoError(t, c.Set("int", "12345"))
+	require.NoError(t, c.Set("short", "hello"))
+	require.NoError(t, c.Set("long", strings.Repeat("x", embstrMaxLen+1)))
+	require.NoError(t, c.HSet("hash", "f", "v"))
+
+	for key, encoding := range map[string]string{
+		"int":   "int",
+		"short": "embstr",
+		"long":  "raw",
+		"hash":  "hashtable",
+	} {
+		assert.Equal(t, encoding, run(h.HandleObject, "ENCODING", key).Bulk, key)
+	}
+	assert.Equal(t, "null", run(h.HandleObject, "ENCODING", "missing").Type)
+
+	c.lastAccessed.Store("short", time.Now().Add(-90*time.Second))
+	assert.Equal(t, 90, run(h.HandleObject, "IDLETIME", "short").Num)
+	_, _ = c.Get("short")
+	assert.Equal(t, 0, run(h.HandleObject, "IDLETIME", "short").Num)
+	assert.Equal(t, "null", run(h.HandleObject, "IDLETIME", "missing").Type)
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 )
@@ -52,47 +53,43 @@ func (c *MemoryCache) TDigestAdd(key string, values ...float64) error {
 	return nil
 }
 
-// TDigestMerge merges multiple T-Digests into a destination T-Digest within the memory cache.
-// It takes a destination key, a slice of source keys, and a slice of weights as parameters.
-// The number of source keys must match the number of weights.
+// TDigestMerge merges the T-Digests stored at sourceKeys into destKey.
+// An existing destination takes part in the merge unless override is set,
+// in which case it is replaced. The result uses the given compression, or
+// the largest compression among the merged digests when it is zero.
 //
 // Parameters:
 //   - destKey: The key for the destination T-Digest.
-//   - sourceKeys: A slice of keys for the source T-Digests to be merged.
-//   - weights: A slice of weights corresponding to each source T-Digest.
+//   - sourceKeys: The keys of the T-Digests to merge.
+//   - compression: The compression of the result, or 0 to derive it.
+//   - override: Whether to discard the current destination.
 //
 // Returns:
-//   - error: An error if the number of source keys does not match the number of weights,
-//     or if any source key is not found in the cache.
-//
-// The function retrieves or creates the destination T-Digest and merges each source T-Digest into it.
-// After merging, it increments the version of the destination key.
-func (c *MemoryCache) TDigestMerge(destKey string, sourceKeys []string, weights []float64) error {
-	if len(sourceKeys) != len(weights) {
-		return fmt.Errorf("number of sources and weights must match")
-	}
-
-	// Get or create destination T-Digest
-	destTDigestI, exists := c.tdigests.Load(destKey)
-	var destTDigest *models.TDigest
-	if !exists {
-		destTDigest = models.NewTDigest(100.0) // Default compression
-		c.tdigests.Store(destKey, destTDigest)
-	} else {
-		destTDigest = destTDigestI.(*models.TDigest)
+//   - error: An error if the compression is negative or a source key is not found.
+func (c *MemoryCache) TDigestMerge(destKey string, sourceKeys []string, compression float64, override bool) error {
+	if compression < 0 {
+		return fmt.Errorf("compression must be positive")
 	}
 
-	// Merge each source
+	digests := make([]*models.TDigest, 0, len(sourceKeys)+1)
 	for _, sourceKey := range sourceKeys {
 		sourceTDigestI, exists := c.tdigests.Load(sourceKey)
 		if !exists {
 			return fmt.Errorf("source key %s not found", sourceKey)
 		}
+		digests = append(digests, sourceTDigestI.(*models.TDigest))
+	}
+	if destTDigestI, exists := c.tdigests.Load(destKey); exists && !override {
+		digests = append(digests, destTDigestI.(*models.TDigest))
+	}
 
-		sourceTDigest := sourceTDigestI.(*models.TDigest)
-		destTDigest.Merge(sourceTDigest)
+	if compression == 0 {
+		for _, td := range digests {
+			compression = math.Max(compression, td.Compression())
+		}
 	}
 
+	c.tdigests.Store(destKey, models.MergeTDigests(compression, digests...))
 	c.incrementKeyVersion(destKey)
 	return nil
 }
@@ -143,6 +140,104 @@ func (c *MemoryCache) TDigestQuantile(key string, quantiles ...float64) ([]float
 	return results, nil
 }
 
+// TDigestRank estimates the rank of each value in the t-digest at key: the
+// number of observations smaller than the value plus half of those equal
+// to it. Values below the minimum rank -1 and values above the maximum
+// rank the observation count; an empty t-digest gives -2.
+//
+// Parameters:
+//   - key: The key associated with the t-digest.
+//   - values: The values to rank.
+//
+// Returns:
+//   - []int64: The estimated rank of each value.
+//   - error: An error if the key does not exist.
+func (c *MemoryCache) TDigestRank(key string, values ...float64) ([]int64, error) {
+	tdigestI, exists := c.tdigests.Load(key)
+	if !exists {
+		return nil, fmt.Errorf("key not found")
+	}
+
+	tdigest := tdigestI.(*models.TDigest)
+	results := make([]int64, len(values))
+	for i, v := range values {
+		results[i] = tdigest.Rank(v)
+	}
+	return results, nil
+}
+
+// TDigestRevRank is TDigestRank counted from the largest observation down.
+//
+// Parameters:
+//   - key: The key associated with the t-digest.
+//   - values: The values to rank.
+//
+// Returns:
+//   - []int64: The estimated reverse rank of each value.
+//   - error: An error if the key does not exist.
+func (c *MemoryCache) TDigestRevRank(key string, values ...float64) ([]int64, error) {
+	tdigestI, exists := c.tdigests.Load(key)
+	if !exists {
+		return nil, fmt.Errorf("key not found")
+	}
+
+	tdigest := tdigestI.(*models.TDigest)
+	results := make([]int64, len(values))
+	for i, v := range values {
+		results[i] = tdigest.RevRank(v)
+	}
+	return results, nil
+}
+
+// TDigestByRank estimates the value at each rank of the t-digest at key,
+// where rank 0 is the minimum. Ranks at or past the observation count give
+// +Inf and an empty t-digest gives NaN.
+//
+// Parameters:
+//   - key: The key associated with the t-digest.
+//   - ranks: The ranks to look up.
+//
+// Returns:
+//   - []float64: The estimated value at each rank.
+//   - error: An error if the key does not exist.
+func (c *MemoryCache) TDigestByRank(key string, ranks ...int64) ([]float64, error) {
+	tdigestI, exists := c.tdigests.Load(key)
+	if !exists {
+		return nil, fmt.Errorf("key not found")
+	}
+
+	tdigest := tdigestI.(*models.TDigest)
+	results := make([]float64, len(ranks))
+	for i, r := range ranks {
+		results[i] = tdigest.ByRank(r)
+	}
+	return results, nil
+}
+
+// TDigestByRevRank is TDigestByRank counted from the maximum down; ranks at
+// or past the observation count give -Inf.
+//
+// Parameters:
+//   - key: The key associated with the t-digest.
+//   - ranks: The reverse ranks to look up.
+//
+// Returns:
+//   - []float64: The estimated value at each reverse rank.
+//   - error: An error if the key does not exist.
+func (c *MemoryCache) TDigestByRevRank(key string, ranks ...int64) ([]float64, error) {
+	tdigestI, exists := c.tdigests.Load(key)
+	if !exists {
+		return nil, fmt.Errorf("key not found")
+	}
+
+	tdigest := tdigestI.(*models.TDigest)
+	results := make([]float64, len(ranks))
+	for i, r := range ranks {
+		results[i] = tdigest.ByRevRank(r)
+	}
+	return results, nil
+}
+
 // TDigestMin retrieves the minimum value from the t-digest associated with the given key.
 // If the key does not exist, it returns an error.
 //
@@ -7,39 +7,51 @@ import (
 	"github.com/genc-murat/crystalcache/internal/core/models"
 )
 
-func (c *MemoryCache) TSCreate(key string, labels map[string]string) error {
-	if _, exists := c.timeSeries.Load(key); exists {
-		return fmt.Errorf("ERR time series already exists")
+func (c *MemoryCache) TSCreate(key string, opts models.TimeSeriesOptions) error {
+	if _, loaded := c.timeSeries.LoadOrStore(key, models.NewTimeSeries(opts)); loaded {
+		return fmt.Errorf("ERR TSDB: key already exists")
 	}
-	ts := &models.TimeSeries{
-		Samples: []models.TimeSeriesSample{},
-		Labels:  labels,
-	}
-	c.timeSeries.Store(key, ts)
+	c.tsIndex.Set(key, opts.Labels)
+	c.incrementKeyVersion(key)
 	return nil
 }
 
-func (c *MemoryCache) TSAdd(key string, timestamp int64, value float64) error {
-	tsI, exists := c.timeSeries.Load(key)
-	if !exists {
-		return fmt.Errorf("ERR no such time series")
+// TSAdd appends a sample to the series at key, creating it with opts if it does
+// not exist. onDuplicate overrides the duplicate policy of the series for this
+// sample when it is not empty. It returns the timestamp of the sample.
+func (c *MemoryCache) TSAdd(key string, timestamp int64, value float64, opts models.TimeSeriesOptions, onDuplicate string) (int64, error) {
+	tsI, loaded := c.timeSeries.LoadOrStore(key, models.NewTimeSeries(opts))
+	if !loaded {
+		c.tsIndex.Set(key, opts.Labels)
 	}
 	sourceTS := tsI.(*models.TimeSeries)
 
-	sourceTS.Mutex.Lock()
-	sourceTS.Samples = append(sourceTS.Samples, models.TimeSeriesSample{Timestamp: timestamp, Value: value})
-	sourceTS.Mutex.Unlock()
+	added, err := sourceTS.Add(timestamp, value, onDuplicate)
+	if err != nil {
+		return 0, err
+	}
+	c.incrementKeyVersion(key)
+
+	c.writeCompactions(sourceTS)
+	return added, nil
+}
 
-	// Kuralları uygula
-	for _, rule := range sourceTS.Rules {
-		destTSI, destExists := c.timeSeries.Load(rule.DestinationKey)
-		if destExists {
-			destTS := destTSI.(*models.TimeSeries)
-			applyRule(rule, sourceTS, destTS)
+// writeCompactions writes the samples the compaction rules of sourceTS
+// produced into their destinations.
+func (c *MemoryCache) writeCompactions(sourceTS *models.TimeSeries) {
+	for _, compacted := range sourceTS.TakeCompactions() {
+		destTSI, destExists := c.timeSeries.Load(compacted.DestinationKey)
+		if !destExists {
+			continue
+		}
+		destTS := destTSI.(*models.TimeSeries)
+		if compacted.Deleted {
+			destTS.Delete(compacted.Sample.Timestamp, compacted.Sample.Timestamp)
+		} else {
+			destTS.Add(compacted.Sample.Timestamp, compacted.Sample.Value, models.DuplicatePolicyLast)
 		}
+		c.incrementKeyVersion(compacted.DestinationKey)
 	}
-
-	return nil
 }
 
 func (c *MemoryCache) TSGet(key string) (*models.TimeSeriesSample, error) {
@@ -49,10 +61,11 @@ func (c *MemoryCache) TSGet(key string) (*models.TimeSeriesSample, error) {
 	}
 	ts := tsI.(*models.TimeSeries)
 
-	if len(ts.Samples) == 0 {
+	sample, ok := ts.Get()
+	if !ok {
 		return nil, fmt.Errorf("ERR no samples in time series")
 	}
-	return &ts.Samples[len(ts.Samples)-1], nil
+	return &sample, nil
 }
 
 func (c *MemoryCache) TSMAdd(entries map[string][]models.TimeSeriesSample) error {
@@ -63,18 +76,14 @@ func (c *MemoryCache) TSMAdd(entries map[string][]models.TimeSeriesSample) error
 		}
 		sourceTS := tsI.(*models.TimeSeries)
 
-		sourceTS.Mutex.Lock()
-		sourceTS.Samples = append(sourceTS.Samples, samples...)
-		sourceTS.Mutex.Unlock()
-
-		// Kuralları uygula
-		for _, rule := range sourceTS.Rules {
-			destTSI, destExists := c.timeSeries.Load(rule.DestinationKey)
-			if destExists {
-				destTS := destTSI.(*models.TimeSeries)
-				applyRule(rule, sourceTS, destTS)
+		for _, sample := range samples {
+			if _, err := sourceTS.Add(sample.Timestamp, sample.Value, ""); err != nil {
+				return err
 			}
 		}
+		c.incrementKeyVersion(key)
+
+		c.writeCompactions(sourceTS)
 	}
 	return nil
 }
@@ -86,78 +95,53 @@ func (c *MemoryCache) TSDel(key string, from, to int64) (int, error) {
 	}
 	ts := tsI.(*models.TimeSeries)
 
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
-
-	originalCount := len(ts.Samples)
-	filteredSamples := ts.Samples[:0]
-
-	for _, sample := range ts.Samples {
-		if sample.Timestamp < from || sample.Timestamp > to {
-			filteredSamples = append(filteredSamples, sample)
-		}
+	deleted := ts.Delete(from, to)
+	if deleted > 0 {
+		c.incrementKeyVersion(key)
+		c.writeCompactions(ts)
 	}
-	ts.Samples = filteredSamples
-	return originalCount - len(filteredSamples), nil
+	return deleted, nil
 }
 
-func (c *MemoryCache) TSRange(key string, from, to int64) ([]models.TimeSeriesSample, error) {
+func (c *MemoryCache) TSRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error) {
+	return c.tsQuery(key, from, to, opts, false)
+}
+
+// tsQuery returns the samples of the series at key in [from, to] with the
+// options of TS.RANGE applied.
+func (c *MemoryCache) tsQuery(key string, from, to int64, opts models.TimeSeriesRangeOptions, reverse bool) ([]models.TimeSeriesSample, error) {
 	tsI, exists := c.timeSeries.Load(key)
 	if !exists {
 		return nil, fmt.Errorf("ERR no such time series")
 	}
 	ts := tsI.(*models.TimeSeries)
-
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
-
-	var results []models.TimeSeriesSample
-	for _, sample := range ts.Samples {
-		if sample.Timestamp >= from && sample.Timestamp <= to {
-			results = append(results, sample)
-		}
-	}
-	return results, nil
+	return c.tsQuerySeries(key, ts, from, to, opts, reverse), nil
 }
 
-func (c *MemoryCache) TSMRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error) {
-	results := make(map[string][]models.TimeSeriesSample)
-
-	c.timeSeries.Range(func(key, value interface{}) bool {
-		ts := value.(*models.TimeSeries)
-
-		// Filtre kontrolü
-		matches := true
-		for k, v := range filters {
-			if tsValue, ok := ts.Labels[k]; !ok || tsValue != v {
-				matches = false
-				break
+func (c *MemoryCache) tsQuerySeries(key string, ts *models.TimeSeries, from, to int64, opts models.TimeSeriesRangeOptions, reverse bool) []models.TimeSeriesSample {
+	samples := ts.Range(from, to)
+	if opts.Latest {
+		if latest, ok := c.tsLatest(key, ts); ok && latest.Timestamp >= from && latest.Timestamp <= to {
+			if n := len(samples); n == 0 || samples[n-1].Timestamp < latest.Timestamp {
+				samples = append(samples, latest)
 			}
 		}
-
-		if matches {
-			ts.Mutex.Lock()
-			var rangeSamples []models.TimeSeriesSample
-			for _, sample := range ts.Samples {
-				if sample.Timestamp >= from && sample.Timestamp <= to {
-					rangeSamples = append(rangeSamples, sample)
-				}
-			}
-			ts.Mutex.Unlock()
-
-			if len(rangeSamples) > 0 {
-				results[key.(string)] = rangeSamples
-			}
-		}
-
-		return true
-	})
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("ERR no matching time series found")
 	}
+	return models.QueryTimeSeries(samples, opts, reverse)
+}
 
-	return results, nil
+// tsLatest returns the bucket of the compaction destination at key that is
+// still open in its source.
+func (c *MemoryCache) tsLatest(key string, ts *models.TimeSeries) (models.TimeSeriesSample, bool) {
+	sourceKey := ts.SourceKey()
+	if sourceKey == "" {
+		return models.TimeSeriesSample{}, false
+	}
+	sourceTSI, exists := c.timeSeries.Load(sourceKey)
+	if !exists {
+		return models.TimeSeriesSample{}, false
+	}
+	return sourceTSI.(*models.TimeSeries).OpenBucket(key)
 }
 
 func (c *MemoryCache) TSIncrBy(key string, increment float64) error {
@@ -167,21 +151,12 @@ func (c *MemoryCache) TSIncrBy(key string, increment float64) error {
 	}
 	ts := tsI.(*models.TimeSeries)
 
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
-
-	if len(ts.Samples) == 0 {
-		ts.Samples = append(ts.Samples, models.TimeSeriesSample{
-			Timestamp: time.Now().Unix(),
-			Value:     increment,
-		})
-	} else {
-		lastSample := &ts.Samples[len(ts.Samples)-1]
-		ts.Samples = append(ts.Samples, models.TimeSeriesSample{
-			Timestamp: time.Now().Unix(),
-			Value:     lastSample.Value + increment,
-		})
+	if _, err := ts.IncrBy(time.Now().UnixMilli(), increment); err != nil {
+		return err
 	}
+	c.incrementKeyVersion(key)
+
+	c.writeCompactions(ts)
 	return nil
 }
 
@@ -189,59 +164,36 @@ func (c *MemoryCache) TSDecrBy(key string, decrement float64) error {
 	return c.TSIncrBy(key, -decrement)
 }
 
-func (c *MemoryCache) TSInfo(key string) (*models.TimeSeriesStats, error) {
+func (c *MemoryCache) TSInfo(key string, debug bool) (*models.TimeSeriesInfo, error) {
 	tsI, exists := c.timeSeries.Load(key)
 	if !exists {
 		return nil, fmt.Errorf("ERR no such time series")
 	}
 	ts := tsI.(*models.TimeSeries)
 
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
-
-	if len(ts.Samples) == 0 {
-		return nil, fmt.Errorf("ERR no samples in time series")
-	}
-
-	var total, max, min float64
-	min = ts.Samples[0].Value
-	for _, sample := range ts.Samples {
-		total += sample.Value
-		if sample.Value > max {
-			max = sample.Value
-		}
-		if sample.Value < min {
-			min = sample.Value
-		}
-	}
-
-	avg := total / float64(len(ts.Samples))
-	return &models.TimeSeriesStats{
-		TotalSamples: len(ts.Samples),
-		MaxValue:     max,
-		MinValue:     min,
-		AvgValue:     avg,
-	}, nil
+	info := ts.Info(debug)
+	return &info, nil
 }
 
-func (c *MemoryCache) TSAlter(key string, labels map[string]string) error {
+func (c *MemoryCache) TSAlter(key string, opts models.TimeSeriesAlterOptions) error {
 	tsI, exists := c.timeSeries.Load(key)
 	if !exists {
 		return fmt.Errorf("ERR no such time series")
 	}
 	ts := tsI.(*models.TimeSeries)
 
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
-
-	for k, v := range labels {
-		ts.Labels[k] = v
+	ts.Alter(opts)
+	if opts.Labels != nil {
+		c.tsIndex.Set(key, opts.Labels)
 	}
-
+	c.incrementKeyVersion(key)
 	return nil
 }
 
-func (c *MemoryCache) TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize int64) error {
+func (c *MemoryCache) TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize, alignTimestamp int64) error {
+	if sourceKey == destKey {
+		return fmt.Errorf("ERR TSDB: the source key and destination key should be different")
+	}
 	sourceTSI, sourceExists := c.timeSeries.Load(sourceKey)
 	destTSI, destExists := c.timeSeries.Load(destKey)
 
@@ -255,105 +207,28 @@ func (c *MemoryCache) TSCreateRule(sourceKey, destKey string, aggregationType st
 	sourceTS := sourceTSI.(*models.TimeSeries)
 	destTS := destTSI.(*models.TimeSeries)
 
-	sourceTS.Mutex.Lock()
-	defer sourceTS.Mutex.Unlock()
-
-	destTS.Mutex.Lock()
-	defer destTS.Mutex.Unlock()
+	if sourceTS.SourceKey() != "" {
+		return fmt.Errorf("ERR TSDB: the source key already has a source rule")
+	}
+	if destTS.SourceKey() != "" {
+		return fmt.Errorf("ERR TSDB: the destination key already has a src rule")
+	}
+	if len(destTS.Rules()) > 0 {
+		return fmt.Errorf("ERR TSDB: the destination key already has a dst rule")
+	}
 
 	rule := models.TimeSeriesRule{
 		AggregationType: aggregationType,
 		BucketSize:      bucketSize,
 		DestinationKey:  destKey,
+		AlignTimestamp:  alignTimestamp,
 	}
-	sourceTS.Rules = append(sourceTS.Rules, rule)
+	sourceTS.AddRule(rule)
+	destTS.SetSourceKey(sourceKey)
 
 	return nil
 }
 
-func applyRule(rule models.TimeSeriesRule, sourceTS *models.TimeSeries, destTS *models.TimeSeries) {
-	var total float64
-	var count int64
-	var startBucket int64
-
-	destTS.Mutex.Lock()
-	defer destTS.Mutex.Unlock()
-
-	for _, sample := range sourceTS.Samples {
-		if startBucket == 0 {
-			startBucket = sample.Timestamp
-		}
-
-		total += sample.Value
-		count++
-
-		if sample.Timestamp >= startBucket+rule.BucketSize {
-			destTS.Samples = append(destTS.Samples, models.TimeSeriesSample{
-				Timestamp: startBucket,
-				Value:     aggregate(rule.AggregationType, total, count),
-			})
-			startBucket = sample.Timestamp
-			total = 0
-			count = 0
-		}
-	}
-
-	if count > 0 {
-		destTS.Samples = append(destTS.Samples, models.TimeSeriesSample{
-			Timestamp: startBucket,
-			Value:     aggregate(rule.AggregationType, total, count),
-		})
-	}
-}
-
-func aggregate(aggregationType string, total float64, count int64) float64 {
-	switch aggregationType {
-	case "avg":
-		return total / float64(count)
-	case "sum":
-		return total
-	case "min":
-		return total
-	case "max":
-		return total
-	default:
-		return 0
-	}
-}
-
-func (c *MemoryCache) TSMGet(filters map[string]string) (map[string]*models.TimeSeriesSample, error) {
-	results := make(map[string]*models.TimeSeriesSample)
-
-	c.timeSeries.Range(func(key, value interface{}) bool {
-		ts := value.(*models.TimeSeries)
-
-		// Filtre kontrolü
-		matches := true
-		for k, v := range filters {
-			if tsValue, ok := ts.Labels[k]; !ok || tsValue != v {
-				matches = false
-				break
-			}
-		}
-
-		if matches {
-			ts.Mutex.Lock()
-			if len(ts.Samples) > 0 {
-				results[key.(string)] = &ts.Samples[len(ts.Samples)-1]
-			}
-			ts.Mutex.Unlock()
-		}
-
-		return true
-	})
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("ERR no matching time series found")
-	}
-
-	return results, nil
-}
-
 func (c *MemoryCache) TSDeleteRule(sourceKey, destinationKey string) error {
 	tsI, exists := c.timeSeries.Load(sourceKey)
 	if !exists {
@@ -361,115 +236,77 @@ func (c *MemoryCache) TSDeleteRule(sourceKey, destinationKey string) error {
 	}
 	sourceTS := tsI.(*models.TimeSeries)
 
-	sourceTS.Mutex.Lock()
-	defer sourceTS.Mutex.Unlock()
-
-	newRules := []models.TimeSeriesRule{}
-	for _, rule := range sourceTS.Rules {
-		if rule.DestinationKey != destinationKey {
-			newRules = append(newRules, rule)
-		}
-	}
-
-	if len(newRules) == len(sourceTS.Rules) {
+	if !sourceTS.DeleteRule(destinationKey) {
 		return fmt.Errorf("ERR no such rule exists for destination: %s", destinationKey)
 	}
-
-	sourceTS.Rules = newRules
+	if destTSI, exists := c.timeSeries.Load(destinationKey); exists {
+		destTS := destTSI.(*models.TimeSeries)
+		destTS.SetSourceKey("")
+	}
 	return nil
 }
 
-func (c *MemoryCache) TSQueryIndex(filters map[string]string) ([]string, error) {
-	var results []string
-
-	c.timeSeries.Range(func(key, value interface{}) bool {
-		ts := value.(*models.TimeSeries)
-
-		// Filtreleri kontrol et
-		matches := true
-		for k, v := range filters {
-			if tsValue, ok := ts.Labels[k]; !ok || tsValue != v {
-				matches = false
-				break
-			}
-		}
+func (c *MemoryCache) TSRevRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error) {
+	return c.tsQuery(key, from, to, opts, true)
+}
 
-		if matches {
-			results = append(results, key.(string))
+// tsSelect returns the keys and series passing filters, ordered by key
+func (c *MemoryCache) tsSelect(filters []models.TimeSeriesFilter) ([]string, []*models.TimeSeries) {
+	var keys []string
+	var series []*models.TimeSeries
+	for _, key := range c.tsIndex.Query(filters) {
+		// The index may briefly hold keys being deleted
+		if tsI, exists := c.timeSeries.Load(key); exists {
+			keys = append(keys, key)
+			series = append(series, tsI.(*models.TimeSeries))
 		}
-
-		return true
-	})
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("ERR no matching time series found")
 	}
-
-	return results, nil
+	return keys, series
 }
 
-func (c *MemoryCache) TSRevRange(key string, from, to int64) ([]models.TimeSeriesSample, error) {
-	tsI, exists := c.timeSeries.Load(key)
-	if !exists {
-		return nil, fmt.Errorf("ERR no such time series")
-	}
-	ts := tsI.(*models.TimeSeries)
-
-	ts.Mutex.Lock()
-	defer ts.Mutex.Unlock()
+func (c *MemoryCache) TSQueryIndex(filters []models.TimeSeriesFilter) ([]string, error) {
+	keys, _ := c.tsSelect(filters)
+	return keys, nil
+}
 
-	var results []models.TimeSeriesSample
-	for i := len(ts.Samples) - 1; i >= 0; i-- {
-		sample := ts.Samples[i]
-		if sample.Timestamp >= from && sample.Timestamp <= to {
-			results = append(results, sample)
+// TSMGet returns the newest sample of every series passing filters, or of
+// the open bucket of a compaction destination if latest is set. Series
+// without samples have no Samples.
+func (c *MemoryCache) TSMGet(filters []models.TimeSeriesFilter, latest bool) ([]models.TimeSeriesResult, error) {
+	keys, series := c.tsSelect(filters)
+	results := make([]models.TimeSeriesResult, len(keys))
+	for i, ts := range series {
+		results[i] = models.TimeSeriesResult{Key: keys[i], Labels: ts.Labels()}
+		sample, ok := ts.Get()
+		if latest {
+			if open, openOK := c.tsLatest(keys[i], ts); openOK && (!ok || open.Timestamp > sample.Timestamp) {
+				sample, ok = open, true
+			}
+		}
+		if ok {
+			results[i].Samples = []models.TimeSeriesSample{sample}
 		}
 	}
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("ERR no samples in the specified range")
-	}
-
 	return results, nil
 }
 
-func (c *MemoryCache) TSMRevRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error) {
-	results := make(map[string][]models.TimeSeriesSample)
-
-	c.timeSeries.Range(func(key, value interface{}) bool {
-		ts := value.(*models.TimeSeries)
-
-		// Filtre kontrolü
-		matches := true
-		for k, v := range filters {
-			if tsValue, ok := ts.Labels[k]; !ok || tsValue != v {
-				matches = false
-				break
-			}
-		}
+func (c *MemoryCache) TSMRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error) {
+	return c.tsMultiQuery(filters, from, to, opts, false), nil
+}
 
-		if matches {
-			ts.Mutex.Lock()
-			var rangeSamples []models.TimeSeriesSample
-			for i := len(ts.Samples) - 1; i >= 0; i-- {
-				sample := ts.Samples[i]
-				if sample.Timestamp >= from && sample.Timestamp <= to {
-					rangeSamples = append(rangeSamples, sample)
-				}
-			}
-			ts.Mutex.Unlock()
+func (c *MemoryCache) TSMRevRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error) {
+	return c.tsMultiQuery(filters, from, to, opts, true), nil
+}
 
-			if len(rangeSamples) > 0 {
-				results[key.(string)] = rangeSamples
-			}
+func (c *MemoryCache) tsMultiQuery(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions, reverse bool) []models.TimeSeriesResult {
+	keys, series := c.tsSelect(filters)
+	results := make([]models.TimeSeriesResult, len(keys))
+	for i, ts := range series {
+		results[i] = models.TimeSeriesResult{
+			Key:     keys[i],
+			Labels:  ts.Labels(),
+			Samples: c.tsQuerySeries(keys[i], ts, from, to, opts, reverse),
 		}
-
-		return true
-	})
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("ERR no matching time series found")
 	}
-
-	return results, nil
+	return results
 }
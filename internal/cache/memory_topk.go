@@ -6,21 +6,23 @@ import (
 	"github.com/genc-murat/crystalcache/internal/core/models"
 )
 
-// TOPKReserve initializes a TopK sketch
+// TOPKReserve initializes a TopK sketch tracking topk items in a
+// width×depth HeavyKeeper sketch
 func (c *MemoryCache) TOPKReserve(key string, topk, width, depth int, decay float64) error {
 	// Validate parameters
 	if topk <= 0 || width <= 0 || depth <= 0 || decay < 0 || decay > 1 {
 		return fmt.Errorf("ERR invalid parameters")
 	}
 
-	sketch := models.NewTopK(topk, width*depth, decay)
+	sketch := models.NewTopK(topk, width, depth, decay)
 	c.topks.Store(key, sketch)
 	c.incrementKeyVersion(key)
 	return nil
 }
 
-// TOPKAdd adds items to a TopK sketch
-func (c *MemoryCache) TOPKAdd(key string, items ...string) ([]bool, error) {
+// TOPKAdd adds items to a TopK sketch and returns, per item, the item it
+// expelled from the top k, or nil
+func (c *MemoryCache) TOPKAdd(key string, items ...string) ([]*string, error) {
 	sketchI, exists := c.topks.Load(key)
 	if !exists {
 		return nil, fmt.Errorf("ERR key does not exist")
@@ -32,19 +34,22 @@ func (c *MemoryCache) TOPKAdd(key string, items ...string) ([]bool, error) {
 	return results, nil
 }
 
-// TOPKIncrBy increases counts of items in a TopK sketch
-func (c *MemoryCache) TOPKIncrBy(key string, itemsWithCount map[string]int64) ([]bool, error) {
+// TOPKIncrBy increases the counts of items by the matching increments and
+// returns, per item, the item it expelled from the top k, or nil
+func (c *MemoryCache) TOPKIncrBy(key string, items []string, increments []int64) ([]*string, error) {
+	if len(items) != len(increments) {
+		return nil, fmt.Errorf("ERR number of items and increments must match")
+	}
+
 	sketchI, exists := c.topks.Load(key)
 	if !exists {
 		return nil, fmt.Errorf("ERR key does not exist")
 	}
 
 	sketch := sketchI.(*models.TopK)
-	results := make([]bool, len(itemsWithCount))
-	i := 0
-	for item, count := range itemsWithCount {
-		results[i] = sketch.IncrBy(item, count)
-		i++
+	results := make([]*string, len(items))
+	for i, item := range items {
+		results[i] = sketch.IncrBy(item, increments[i])
 	}
 	c.incrementKeyVersion(key)
 	return results, nil
@@ -61,7 +66,7 @@ func (c *MemoryCache) TOPKQuery(key string, items ...string) ([]bool, error) {
 	return sketch.Query(items...), nil
 }
 
-// TOPKCount returns counts of items in a TopK sketch
+// TOPKCount returns the estimated counts of items in a TopK sketch
 func (c *MemoryCache) TOPKCount(key string, items ...string) ([]int64, error) {
 	sketchI, exists := c.topks.Load(key)
 	if !exists {
@@ -72,7 +77,7 @@ func (c *MemoryCache) TOPKCount(key string, items ...string) ([]int64, error) {
 	return sketch.Count(items...), nil
 }
 
-// TOPKList returns the full list of items in a TopK sketch
+// TOPKList returns the top k items of a TopK sketch, highest count first
 func (c *MemoryCache) TOPKList(key string) ([]struct {
 	Item  string
 	Count int64
@@ -7,6 +7,8 @@ import (
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/internal/search"
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
 )
 
 type RetryDecorator struct {
@@ -89,6 +91,10 @@ func (rd *RetryDecorator) IncrCommandCount() {
 	rd.cache.IncrCommandCount()
 }
 
+func (rd *RetryDecorator) ResetStats() {
+	rd.cache.ResetStats()
+}
+
 func (rd *RetryDecorator) Pipeline() *models.Pipeline {
 	return rd.cache.Pipeline()
 }
@@ -466,6 +472,23 @@ func (rd *RetryDecorator) Set(key string, value string) error {
 	})
 }
 
+func (rd *RetryDecorator) SetWithOptions(key string, value string, opts models.SetOptions) (models.SetResult, error) {
+	var result models.SetResult
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		result, err = rd.cache.SetWithOptions(key, value, opts)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return models.SetResult{}, err
+	}
+	return result, finalErr
+}
+
 func (rd *RetryDecorator) HSet(hash string, key string, value string) error {
 	return rd.executeWithRetry(func() error {
 		return rd.cache.HSet(hash, key, value)
@@ -798,6 +821,39 @@ func (rd *RetryDecorator) SetJSON(key string, value interface{}) error {
 	})
 }
 
+// Add GetJSONDocument with retry logic
+func (rd *RetryDecorator) GetJSONDocument(key string) (*jsonUtil.Document, bool) {
+	var doc *jsonUtil.Document
+	var exists bool
+
+	err := rd.executeWithRetry(func() error {
+		doc, exists = rd.cache.GetJSONDocument(key)
+		if exists {
+			return nil
+		}
+		return errors.New("json key not found")
+	})
+
+	if err != nil {
+		return nil, false
+	}
+	return doc, exists
+}
+
+// Add SetJSONDocument with retry logic
+func (rd *RetryDecorator) SetJSONDocument(key string, doc *jsonUtil.Document) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.SetJSONDocument(key, doc)
+	})
+}
+
+// Add UpdateJSON with retry logic
+func (rd *RetryDecorator) UpdateJSON(key string, fn func(doc *jsonUtil.Document) (*jsonUtil.Document, error)) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.UpdateJSON(key, fn)
+	})
+}
+
 // Add DeleteJSON with retry logic
 func (rd *RetryDecorator) DeleteJSON(key string) bool {
 	var deleted bool
@@ -811,6 +867,32 @@ func (rd *RetryDecorator) DeleteJSON(key string) bool {
 	return deleted
 }
 
+func (rd *RetryDecorator) JSONSchemaSet(pattern string, schema *jsonUtil.Schema) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.JSONSchemaSet(pattern, schema)
+	})
+}
+
+func (rd *RetryDecorator) JSONSchemaGet(pattern string) (*jsonUtil.Schema, bool) {
+	return rd.cache.JSONSchemaGet(pattern)
+}
+
+func (rd *RetryDecorator) JSONSchemaDel(pattern string) bool {
+	return rd.cache.JSONSchemaDel(pattern)
+}
+
+func (rd *RetryDecorator) JSONSchemaList() []string {
+	return rd.cache.JSONSchemaList()
+}
+
+func (rd *RetryDecorator) JSONSchemaCovers(key string) bool {
+	return rd.cache.JSONSchemaCovers(key)
+}
+
+func (rd *RetryDecorator) JSONSchemaCheck(key string, value interface{}) error {
+	return rd.cache.JSONSchemaCheck(key, value)
+}
+
 func (rd *RetryDecorator) ZDiff(keys ...string) []string {
 	var result []string
 	rd.executeWithRetry(func() error {
@@ -1346,6 +1428,78 @@ func (rd *RetryDecorator) BitPos(key string, bit int, start, end int64, reverse
 	return pos, err
 }
 
+func (rd *RetryDecorator) RSetBit(key string, offset int64, value int) (int, error) {
+	var oldBit int
+	err := rd.executeWithRetry(func() error {
+		var err error
+		oldBit, err = rd.cache.RSetBit(key, offset, value)
+		return err
+	})
+	return oldBit, err
+}
+
+func (rd *RetryDecorator) RSetIntArray(key string, offsets []int64) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.RSetIntArray(key, offsets)
+	})
+}
+
+func (rd *RetryDecorator) RBitOp(operation string, destkey string, keys ...string) (int64, error) {
+	var card int64
+	err := rd.executeWithRetry(func() error {
+		var err error
+		card, err = rd.cache.RBitOp(operation, destkey, keys...)
+		return err
+	})
+	return card, err
+}
+
+func (rd *RetryDecorator) RCard(key string) int64 {
+	var card int64
+	rd.executeWithRetry(func() error {
+		card = rd.cache.RCard(key)
+		return nil
+	})
+	return card
+}
+
+func (rd *RetryDecorator) RRange(key string, start, end int64) ([]int64, error) {
+	var offsets []int64
+	err := rd.executeWithRetry(func() error {
+		var err error
+		offsets, err = rd.cache.RRange(key, start, end)
+		return err
+	})
+	return offsets, err
+}
+
+func (rd *RetryDecorator) RGetIntArray(key string) []int64 {
+	var offsets []int64
+	rd.executeWithRetry(func() error {
+		offsets = rd.cache.RGetIntArray(key)
+		return nil
+	})
+	return offsets
+}
+
+func (rd *RetryDecorator) RMin(key string) int64 {
+	var min int64
+	rd.executeWithRetry(func() error {
+		min = rd.cache.RMin(key)
+		return nil
+	})
+	return min
+}
+
+func (rd *RetryDecorator) RMax(key string) int64 {
+	var max int64
+	rd.executeWithRetry(func() error {
+		max = rd.cache.RMax(key)
+		return nil
+	})
+	return max
+}
+
 // LIndex returns an element from a list by its index with retry logic
 func (rd *RetryDecorator) LIndex(key string, index int) (string, bool) {
 	var value string
@@ -1487,14 +1641,13 @@ func (rd *RetryDecorator) GeoSearchStore(destKey string, srcKey string, options
 	return stored, finalErr
 }
 
-// Add suggestion methods to RetryDecorator
-func (rd *RetryDecorator) FTSugAdd(key, str string, score float64, opts ...string) (bool, error) {
+func (rd *RetryDecorator) GeoFenceAdd(key string, fence models.GeoFence) (bool, error) {
 	var added bool
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		added, err = rd.cache.FTSugAdd(key, str, score, opts...)
+		added, err = rd.cache.GeoFenceAdd(key, fence)
 		finalErr = err
 		return err
 	})
@@ -1505,6 +1658,42 @@ func (rd *RetryDecorator) FTSugAdd(key, str string, score float64, opts ...strin
 	return added, finalErr
 }
 
+func (rd *RetryDecorator) GeoFenceDel(key string, names ...string) int {
+	var removed int
+	rd.executeWithRetry(func() error {
+		removed = rd.cache.GeoFenceDel(key, names...)
+		return nil
+	})
+	return removed
+}
+
+func (rd *RetryDecorator) GeoFenceList(key string) []models.GeoFence {
+	var fences []models.GeoFence
+	rd.executeWithRetry(func() error {
+		fences = rd.cache.GeoFenceList(key)
+		return nil
+	})
+	return fences
+}
+
+// Add suggestion methods to RetryDecorator
+func (rd *RetryDecorator) FTSugAdd(key, str string, score float64, incr bool, payload *string) (int64, error) {
+	var size int64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		size, err = rd.cache.FTSugAdd(key, str, score, incr, payload)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return size, finalErr
+}
+
 func (rd *RetryDecorator) FTSugDel(key, str string) (bool, error) {
 	var deleted bool
 	var finalErr error
@@ -1556,6 +1745,73 @@ func (rd *RetryDecorator) FTSugLen(key string) (int64, error) {
 	return length, finalErr
 }
 
+func (rd *RetryDecorator) FTCreate(def *search.IndexDefinition) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.FTCreate(def)
+	})
+}
+
+func (rd *RetryDecorator) FTDropIndex(name string, deleteDocs bool) error {
+	return rd.executeWithRetry(func() error {
+		return rd.cache.FTDropIndex(name, deleteDocs)
+	})
+}
+
+func (rd *RetryDecorator) FTInfo(name string) (*search.IndexInfo, error) {
+	var info *search.IndexInfo
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		info, err = rd.cache.FTInfo(name)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return info, finalErr
+}
+
+func (rd *RetryDecorator) FTList() []string {
+	return rd.cache.FTList()
+}
+
+func (rd *RetryDecorator) FTSearch(index, query string, opts *search.SearchOptions) (*search.SearchResult, error) {
+	var result *search.SearchResult
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		result, err = rd.cache.FTSearch(index, query, opts)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, finalErr
+}
+
+func (rd *RetryDecorator) FTAggregate(index string, req *search.AggregateRequest) (*search.AggregateResult, error) {
+	var result *search.AggregateResult
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		result, err = rd.cache.FTAggregate(index, req)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, finalErr
+}
+
 func (rd *RetryDecorator) CMSInitByDim(key string, width, depth uint) error {
 	return rd.executeWithRetry(func() error {
 		return rd.cache.CMSInitByDim(key, width, depth)
@@ -1615,9 +1871,9 @@ func (rd *RetryDecorator) CMSInfo(key string) (map[string]interface{}, error) {
 }
 
 // Cuckoo Filter operations for RetryDecorator
-func (rd *RetryDecorator) CFReserve(key string, capacity uint64) error {
+func (rd *RetryDecorator) CFReserve(key string, opts models.CuckooFilterOptions) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.CFReserve(key, capacity)
+		return rd.cache.CFReserve(key, opts)
 	})
 }
 
@@ -1655,13 +1911,13 @@ func (rd *RetryDecorator) CFAddNX(key string, item string) (bool, error) {
 	return added, finalErr
 }
 
-func (rd *RetryDecorator) CFInsert(key string, items []string) ([]bool, error) {
-	var results []bool
+func (rd *RetryDecorator) CFInsert(key string, capacity uint64, noCreate bool, items []string) ([]int, error) {
+	var results []int
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.CFInsert(key, items)
+		results, err = rd.cache.CFInsert(key, capacity, noCreate, items)
 		finalErr = err
 		return err
 	})
@@ -1672,13 +1928,13 @@ func (rd *RetryDecorator) CFInsert(key string, items []string) ([]bool, error) {
 	return results, finalErr
 }
 
-func (rd *RetryDecorator) CFInsertNX(key string, items []string) ([]bool, error) {
-	var results []bool
+func (rd *RetryDecorator) CFInsertNX(key string, capacity uint64, noCreate bool, items []string) ([]int, error) {
+	var results []int
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.CFInsertNX(key, items)
+		results, err = rd.cache.CFInsertNX(key, capacity, noCreate, items)
 		finalErr = err
 		return err
 	})
@@ -1873,9 +2129,9 @@ func (rd *RetryDecorator) TDigestAdd(key string, values ...float64) error {
 	})
 }
 
-func (rd *RetryDecorator) TDigestMerge(destKey string, sourceKeys []string, weights []float64) error {
+func (rd *RetryDecorator) TDigestMerge(destKey string, sourceKeys []string, compression float64, override bool) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.TDigestMerge(destKey, sourceKeys, weights)
+		return rd.cache.TDigestMerge(destKey, sourceKeys, compression, override)
 	})
 }
 
@@ -1902,6 +2158,74 @@ func (rd *RetryDecorator) TDigestQuantile(key string, quantiles ...float64) ([]f
 	return results, finalErr
 }
 
+func (rd *RetryDecorator) TDigestRank(key string, values ...float64) ([]int64, error) {
+	var results []int64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		results, err = rd.cache.TDigestRank(key, values...)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return results, finalErr
+}
+
+func (rd *RetryDecorator) TDigestRevRank(key string, values ...float64) ([]int64, error) {
+	var results []int64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		results, err = rd.cache.TDigestRevRank(key, values...)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return results, finalErr
+}
+
+func (rd *RetryDecorator) TDigestByRank(key string, ranks ...int64) ([]float64, error) {
+	var results []float64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		results, err = rd.cache.TDigestByRank(key, ranks...)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return results, finalErr
+}
+
+func (rd *RetryDecorator) TDigestByRevRank(key string, ranks ...int64) ([]float64, error) {
+	var results []float64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		results, err = rd.cache.TDigestByRevRank(key, ranks...)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return results, finalErr
+}
+
 func (rd *RetryDecorator) TDigestMin(key string) (float64, error) {
 	var min float64
 	var finalErr error
@@ -2024,9 +2348,9 @@ func (rd *RetryDecorator) BFExists(key string, item string) (bool, error) {
 }
 
 // BFReserve with retry logic
-func (rd *RetryDecorator) BFReserve(key string, errorRate float64, capacity uint) error {
+func (rd *RetryDecorator) BFReserve(key string, opts models.BloomFilterOptions) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.BFReserve(key, errorRate, capacity)
+		return rd.cache.BFReserve(key, opts)
 	})
 }
 
@@ -2067,8 +2391,8 @@ func (rd *RetryDecorator) BFMExists(key string, items []string) ([]bool, error)
 }
 
 // BFInfo with retry logic
-func (rd *RetryDecorator) BFInfo(key string) (map[string]interface{}, error) {
-	var info map[string]interface{}
+func (rd *RetryDecorator) BFInfo(key string) (*models.BloomInfo, error) {
+	var info *models.BloomInfo
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
@@ -2138,13 +2462,13 @@ func (rd *RetryDecorator) PTTL(key string) int64 {
 }
 
 // Add BFInsert to RetryDecorator
-func (rd *RetryDecorator) BFInsert(key string, errorRate float64, capacity uint, items []string) ([]bool, error) {
+func (rd *RetryDecorator) BFInsert(key string, opts models.BloomFilterOptions, noCreate bool, items []string) ([]bool, error) {
 	var results []bool
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.BFInsert(key, errorRate, capacity, items)
+		results, err = rd.cache.BFInsert(key, opts, noCreate, items)
 		finalErr = err
 		return err
 	})
@@ -2163,8 +2487,8 @@ func (rd *RetryDecorator) TOPKReserve(key string, topk, width, depth int, decay
 }
 
 // TOPKAdd with retry logic
-func (rd *RetryDecorator) TOPKAdd(key string, items ...string) ([]bool, error) {
-	var results []bool
+func (rd *RetryDecorator) TOPKAdd(key string, items ...string) ([]*string, error) {
+	var results []*string
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
@@ -2181,13 +2505,13 @@ func (rd *RetryDecorator) TOPKAdd(key string, items ...string) ([]bool, error) {
 }
 
 // TOPKIncrBy with retry logic
-func (rd *RetryDecorator) TOPKIncrBy(key string, itemsWithCount map[string]int64) ([]bool, error) {
-	var results []bool
+func (rd *RetryDecorator) TOPKIncrBy(key string, items []string, increments []int64) ([]*string, error) {
+	var results []*string
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.TOPKIncrBy(key, itemsWithCount)
+		results, err = rd.cache.TOPKIncrBy(key, items, increments)
 		finalErr = err
 		return err
 	})
@@ -2277,26 +2601,37 @@ func (rd *RetryDecorator) TOPKInfo(key string) (map[string]interface{}, error) {
 }
 
 // TSCreate with retry logic
-func (rd *RetryDecorator) TSCreate(key string, labels map[string]string) error {
+func (rd *RetryDecorator) TSCreate(key string, opts models.TimeSeriesOptions) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.TSCreate(key, labels)
+		return rd.cache.TSCreate(key, opts)
 	})
 }
 
 // TSAdd with retry logic
-func (rd *RetryDecorator) TSAdd(key string, timestamp int64, value float64) error {
-	return rd.executeWithRetry(func() error {
-		return rd.cache.TSAdd(key, timestamp, value)
+func (rd *RetryDecorator) TSAdd(key string, timestamp int64, value float64, opts models.TimeSeriesOptions, onDuplicate string) (int64, error) {
+	var added int64
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		added, err = rd.cache.TSAdd(key, timestamp, value, opts, onDuplicate)
+		finalErr = err
+		return err
 	})
+
+	if err != nil {
+		return 0, err
+	}
+	return added, finalErr
 }
 
-func (rd *RetryDecorator) TSMGet(filters map[string]string) (map[string]*models.TimeSeriesSample, error) {
-	var results map[string]*models.TimeSeriesSample
+func (rd *RetryDecorator) TSMGet(filters []models.TimeSeriesFilter, latest bool) ([]models.TimeSeriesResult, error) {
+	var results []models.TimeSeriesResult
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.TSMGet(filters)
+		results, err = rd.cache.TSMGet(filters, latest)
 		finalErr = err
 		return err
 	})
@@ -2351,13 +2686,13 @@ func (rd *RetryDecorator) TSDel(key string, from, to int64) (int, error) {
 }
 
 // TSRange with retry logic
-func (rd *RetryDecorator) TSRange(key string, from, to int64) ([]models.TimeSeriesSample, error) {
+func (rd *RetryDecorator) TSRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error) {
 	var samples []models.TimeSeriesSample
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		samples, err = rd.cache.TSRange(key, from, to)
+		samples, err = rd.cache.TSRange(key, from, to, opts)
 		finalErr = err
 		return err
 	})
@@ -2369,13 +2704,13 @@ func (rd *RetryDecorator) TSRange(key string, from, to int64) ([]models.TimeSeri
 }
 
 // TSMRange with retry logic
-func (rd *RetryDecorator) TSMRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error) {
-	var results map[string][]models.TimeSeriesSample
+func (rd *RetryDecorator) TSMRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error) {
+	var results []models.TimeSeriesResult
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.TSMRange(filters, from, to)
+		results, err = rd.cache.TSMRange(filters, from, to, opts)
 		finalErr = err
 		return err
 	})
@@ -2386,13 +2721,13 @@ func (rd *RetryDecorator) TSMRange(filters map[string]string, from, to int64) (m
 	return results, finalErr
 }
 
-func (rd *RetryDecorator) TSRevRange(key string, from, to int64) ([]models.TimeSeriesSample, error) {
+func (rd *RetryDecorator) TSRevRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error) {
 	var results []models.TimeSeriesSample
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.TSRevRange(key, from, to)
+		results, err = rd.cache.TSRevRange(key, from, to, opts)
 		finalErr = err
 		return err
 	})
@@ -2403,7 +2738,7 @@ func (rd *RetryDecorator) TSRevRange(key string, from, to int64) ([]models.TimeS
 	return results, finalErr
 }
 
-func (rd *RetryDecorator) TSQueryIndex(filters map[string]string) ([]string, error) {
+func (rd *RetryDecorator) TSQueryIndex(filters []models.TimeSeriesFilter) ([]string, error) {
 	var results []string
 	var finalErr error
 
@@ -2420,13 +2755,13 @@ func (rd *RetryDecorator) TSQueryIndex(filters map[string]string) ([]string, err
 	return results, finalErr
 }
 
-func (rd *RetryDecorator) TSMRevRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error) {
-	var results map[string][]models.TimeSeriesSample
+func (rd *RetryDecorator) TSMRevRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error) {
+	var results []models.TimeSeriesResult
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		results, err = rd.cache.TSMRevRange(filters, from, to)
+		results, err = rd.cache.TSMRevRange(filters, from, to, opts)
 		finalErr = err
 		return err
 	})
@@ -2452,13 +2787,13 @@ func (rd *RetryDecorator) TSDecrBy(key string, decrement float64) error {
 }
 
 // TSInfo with retry logic
-func (rd *RetryDecorator) TSInfo(key string) (*models.TimeSeriesStats, error) {
-	var stats *models.TimeSeriesStats
+func (rd *RetryDecorator) TSInfo(key string, debug bool) (*models.TimeSeriesInfo, error) {
+	var stats *models.TimeSeriesInfo
 	var finalErr error
 
 	err := rd.executeWithRetry(func() error {
 		var err error
-		stats, err = rd.cache.TSInfo(key)
+		stats, err = rd.cache.TSInfo(key, debug)
 		finalErr = err
 		return err
 	})
@@ -2469,15 +2804,15 @@ func (rd *RetryDecorator) TSInfo(key string) (*models.TimeSeriesStats, error) {
 	return stats, finalErr
 }
 
-func (rd *RetryDecorator) TSAlter(key string, labels map[string]string) error {
+func (rd *RetryDecorator) TSAlter(key string, opts models.TimeSeriesAlterOptions) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.TSAlter(key, labels)
+		return rd.cache.TSAlter(key, opts)
 	})
 }
 
-func (rd *RetryDecorator) TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize int64) error {
+func (rd *RetryDecorator) TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize, alignTimestamp int64) error {
 	return rd.executeWithRetry(func() error {
-		return rd.cache.TSCreateRule(sourceKey, destKey, aggregationType, bucketSize)
+		return rd.cache.TSCreateRule(sourceKey, destKey, aggregationType, bucketSize, alignTimestamp)
 	})
 }
 
@@ -2742,6 +3077,23 @@ func (rd *RetryDecorator) PExpireAt(key string, timestampMs int64) error {
 	})
 }
 
+func (rd *RetryDecorator) PExpire(key string, milliseconds int64, condition string) (bool, error) {
+	var success bool
+	var finalErr error
+
+	err := rd.executeWithRetry(func() error {
+		var err error
+		success, err = rd.cache.PExpire(key, milliseconds, condition)
+		finalErr = err
+		return err
+	})
+
+	if err != nil {
+		return false, err
+	}
+	return success, finalErr
+}
+
 func (rd *RetryDecorator) SEExpire(key string, seconds int, condition string) (bool, error) {
 	var success bool
 	var finalErr error
@@ -2968,6 +3320,26 @@ func (rd *RetryDecorator) Touch(keys ...string) (int, error) {
 	return count, finalErr
 }
 
+func (rd *RetryDecorator) ObjectEncoding(key string) (string, bool) {
+	var encoding string
+	var exists bool
+	rd.executeWithRetry(func() error {
+		encoding, exists = rd.cache.ObjectEncoding(key)
+		return nil
+	})
+	return encoding, exists
+}
+
+func (rd *RetryDecorator) ObjectIdleTime(key string) (int64, bool) {
+	var idle int64
+	var exists bool
+	rd.executeWithRetry(func() error {
+		idle, exists = rd.cache.ObjectIdleTime(key)
+		return nil
+	})
+	return idle, exists
+}
+
 func (rd *RetryDecorator) WithRetry(strategy models.RetryStrategy) ports.Cache {
 	return NewRetryDecorator(rd.cache, strategy)
 }
@@ -2,6 +2,7 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,13 +12,18 @@ import (
 )
 
 type Config struct {
-	Server      ServerConfig  `yaml:"server"`
-	Cache       CacheConfig   `yaml:"cache"`
-	Storage     StorageConfig `yaml:"storage"`
-	Pool        PoolConfig    `yaml:"pool"`
-	Metrics     MetricsConfig `yaml:"metrics"`
-	Pprof       PprofConfig   `yaml:"pprof"`
-	Environment string        `yaml:"environment"`
+	Server      ServerConfig     `yaml:"server"`
+	Cache       CacheConfig      `yaml:"cache"`
+	Storage     StorageConfig    `yaml:"storage"`
+	Pool        PoolConfig       `yaml:"pool"`
+	Metrics     MetricsConfig    `yaml:"metrics"`
+	Prometheus  PrometheusConfig `yaml:"prometheus"`
+	Pprof       PprofConfig      `yaml:"pprof"`
+	SlowLog     SlowLogConfig    `yaml:"slowlog"`
+	Latency     LatencyConfig    `yaml:"latency"`
+	Environment string           `yaml:"environment"`
+
+	path string // file the configuration was loaded from
 }
 
 type ServerConfig struct {
@@ -32,12 +38,23 @@ type ServerConfig struct {
 type CacheConfig struct {
 	DefragInterval  time.Duration `yaml:"defrag_interval"`
 	DefragThreshold float64       `yaml:"defrag_threshold"`
+	// MaxMemory is the eviction limit in bytes; zero means no limit.
+	MaxMemory            int64  `yaml:"maxmemory"`
+	NotifyKeyspaceEvents string `yaml:"notify_keyspace_events"`
+	// ListMaxListpackSize bounds the nodes of lists: a positive value is a
+	// number of elements, -1 to -5 a size of 4 kb to 64 kb.
+	ListMaxListpackSize int `yaml:"list_max_listpack_size"`
+	// ListCompressDepth is the number of nodes at each end of a list left
+	// uncompressed; zero disables compression.
+	ListCompressDepth int `yaml:"list_compress_depth"`
 }
 
 type StorageConfig struct {
 	SyncInterval time.Duration `yaml:"sync_interval"`
-	Type         string        `yaml:"type"`
-	Path         string        `yaml:"path"`
+	// SyncStrategy is the AOF fsync policy: "always", "everysec" or "no".
+	SyncStrategy string `yaml:"sync_strategy"`
+	Type         string `yaml:"type"`
+	Path         string `yaml:"path"`
 }
 
 type PoolConfig struct {
@@ -56,11 +73,33 @@ type MetricsConfig struct {
 	Path    string `yaml:"path"`
 }
 
+// PrometheusConfig is the listener serving Prometheus remote write and
+// remote read requests against the time series.
+type PrometheusConfig struct {
+	Port      int    `yaml:"port"`
+	Enabled   bool   `yaml:"enabled"`
+	WritePath string `yaml:"write_path"`
+	ReadPath  string `yaml:"read_path"`
+}
+
 type PprofConfig struct {
 	Port    int  `yaml:"port"`
 	Enabled bool `yaml:"enabled"`
 }
 
+// SlowLogConfig mirrors Redis' slowlog-log-slower-than (microseconds, negative
+// disables the log) and slowlog-max-len settings.
+type SlowLogConfig struct {
+	LogSlowerThan int64 `yaml:"log_slower_than"`
+	MaxLen        int   `yaml:"max_len"`
+}
+
+// LatencyConfig mirrors Redis' latency-monitor-threshold (milliseconds, zero
+// disables the monitor).
+type LatencyConfig struct {
+	MonitorThreshold int64 `yaml:"monitor_threshold"`
+}
+
 func findProjectRoot() (string, error) {
 	// Start from the current working directory
 	dir, err := os.Getwd()
@@ -112,6 +151,108 @@ func LoadConfig(env string) (*Config, error) {
 
 	// Set environment
 	config.Environment = env
+	config.path = configPath
+	if config.Storage.SyncStrategy == "" {
+		config.Storage.SyncStrategy = "everysec"
+	}
+	if config.Cache.ListMaxListpackSize == 0 {
+		config.Cache.ListMaxListpackSize = -2
+	}
 
 	return &config, nil
 }
+
+// Path returns the file the configuration was loaded from.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Save writes the configuration to path. Values already present in the
+// file are only touched when they changed, so comments, formatting and
+// unknown keys survive.
+func (c *Config) Save(path string) error {
+	var doc yaml.Node
+	var loaded Config
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("error parsing config file: %v", err)
+		}
+		if err := yaml.Unmarshal(data, &loaded); err != nil {
+			return fmt.Errorf("error parsing config file: %v", err)
+		}
+	}
+
+	var previous, current yaml.Node
+	if err := previous.Encode(&loaded); err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	if err := current.Encode(c); err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&current}}
+	} else {
+		mergeYAML(doc.Content[0], &previous, &current)
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	encoder.Close()
+
+	// Write to a temporary file first so a crash never leaves a truncated config
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	return nil
+}
+
+// mergeYAML copies the values of the current mapping that differ from the
+// previous one into dst, recursing into nested mappings and appending keys
+// dst does not have yet.
+func mergeYAML(dst, previous, current *yaml.Node) {
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		key, value := current.Content[i], current.Content[i+1]
+		old := mappingValue(previous, key.Value)
+
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			if old == nil {
+				old = &yaml.Node{Kind: yaml.MappingNode}
+			}
+			mergeYAML(existing, old, value)
+		case old == nil || old.Kind != value.Kind || old.Value != value.Value:
+			lineComment := existing.LineComment
+			*existing = *value
+			existing.LineComment = lineComment
+		}
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
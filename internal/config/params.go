@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genc-murat/crystalcache/pkg/utils/pattern"
+)
+
+// ParamType describes how a runtime parameter is parsed and rendered.
+type ParamType int
+
+const (
+	ParamInt ParamType = iota
+	ParamFloat
+	ParamDuration
+	ParamMemory
+	ParamEnum
+	ParamString
+)
+
+// Param is a configuration parameter exposed through CONFIG GET/SET. Get and
+// Set operate on a Config value; Set validates its argument and leaves the
+// Config untouched on error. Immutable parameters can only be read.
+type Param struct {
+	Name      string
+	Type      ParamType
+	Immutable bool
+	Get       func(c *Config) string
+	Set       func(c *Config, value string) error
+}
+
+// ApplyFunc pushes a changed configuration into the running server. It
+// receives the configuration as it will be once the change is committed.
+type ApplyFunc func(c *Config) error
+
+// Registry binds the runtime parameters to a Config. Components register
+// apply hooks for the parameters they own so that CONFIG SET takes effect
+// immediately.
+type Registry struct {
+	mu     sync.RWMutex
+	config Config
+	path   string
+	params map[string]*Param
+	hooks  map[string][]ApplyFunc
+}
+
+// NewRegistry creates a registry over a copy of cfg with the default
+// parameter set. The file cfg was loaded from, if any, is the target of
+// Rewrite.
+func NewRegistry(cfg *Config) *Registry {
+	r := &Registry{
+		config: *cfg,
+		path:   cfg.path,
+		params: make(map[string]*Param),
+		hooks:  make(map[string][]ApplyFunc),
+	}
+	for _, p := range defaultParams() {
+		r.params[p.Name] = p
+	}
+	return r
+}
+
+// OnChange registers fn to run whenever the named parameter is set.
+func (r *Registry) OnChange(name string, fn ApplyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks[name] = append(r.hooks[name], fn)
+}
+
+// Config returns a copy of the current configuration.
+func (r *Registry) Config() Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// Get returns the name/value pairs of every parameter matching the glob
+// pattern, sorted by name. Matching is case-insensitive.
+func (r *Registry) Get(glob string) [][2]string {
+	glob = strings.ToLower(glob)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result [][2]string
+	for name, p := range r.params {
+		if pattern.Match(glob, name) {
+			result = append(result, [2]string{name, p.Get(&r.config)})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// Set changes one or more parameters atomically: either every value is
+// validated and applied, or the configuration is left unchanged. pairs
+// alternates parameter names and values.
+func (r *Registry) Set(pairs ...string) error {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next := r.config
+	var changed []string
+	seen := make(map[string]bool)
+	for i := 0; i < len(pairs); i += 2 {
+		name := strings.ToLower(pairs[i])
+		p, exists := r.params[name]
+		if !exists {
+			return &ParamError{Name: pairs[i], Unknown: true}
+		}
+		if seen[name] {
+			return &ParamError{Name: name, Reason: "duplicate parameter"}
+		}
+		seen[name] = true
+		if p.Immutable {
+			return &ParamError{Name: name, Reason: "can't set immutable config"}
+		}
+		if err := p.Set(&next, pairs[i+1]); err != nil {
+			return &ParamError{Name: name, Reason: err.Error()}
+		}
+		changed = append(changed, name)
+	}
+
+	// Apply the new values, undoing the hooks already run if one fails
+	var applied []string
+	for _, name := range changed {
+		for _, hook := range r.hooks[name] {
+			if err := hook(&next); err != nil {
+				for _, undo := range append(applied, name) {
+					for _, h := range r.hooks[undo] {
+						_ = h(&r.config)
+					}
+				}
+				return &ParamError{Name: name, Reason: err.Error()}
+			}
+		}
+		applied = append(applied, name)
+	}
+
+	r.config = next
+	return nil
+}
+
+// Rewrite persists the current configuration to the file it was loaded
+// from, keeping comments and unknown keys in place.
+func (r *Registry) Rewrite() error {
+	r.mu.RLock()
+	cfg := r.config
+	path := r.path
+	r.mu.RUnlock()
+
+	if path == "" {
+		return fmt.Errorf("the server is running without a config file")
+	}
+	return cfg.Save(path)
+}
+
+// ParamError reports a parameter that could not be set.
+type ParamError struct {
+	Name    string
+	Reason  string
+	Unknown bool
+}
+
+func (e *ParamError) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", e.Name)
+	}
+	return fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", e.Name, e.Reason)
+}
+
+func defaultParams() []*Param {
+	return []*Param{
+		readOnlyParam("bind", func(c *Config) string { return c.Server.Host }),
+		readOnlyParam("port", func(c *Config) string { return strconv.Itoa(c.Server.Port) }),
+		readOnlyParam("appendfilename", func(c *Config) string { return c.Storage.Path }),
+
+		durationParam("timeout", 0, func(c *Config) *time.Duration { return &c.Server.IdleTimeout }),
+		// Reads are bounded by timeout; read_timeout is only reported
+		readOnlyParam("read-timeout", func(c *Config) string { return c.Server.ReadTimeout.String() }),
+		durationParam("write-timeout", 0, func(c *Config) *time.Duration { return &c.Server.WriteTimeout }),
+		intParam("maxclients", 1, func(c *Config) *int { return &c.Server.MaxConnections }),
+		{
+			Name: "appendfsync",
+			Type: ParamEnum,
+			Get:  func(c *Config) string { return c.Storage.SyncStrategy },
+			Set: func(c *Config, value string) error {
+				value = strings.ToLower(value)
+				switch value {
+				case "always", "everysec", "no":
+					c.Storage.SyncStrategy = value
+					return nil
+				}
+				return fmt.Errorf("argument(s) must be one of the following: always, everysec, no")
+			},
+		},
+		durationParam("active-defrag-interval", time.Second, func(c *Config) *time.Duration { return &c.Cache.DefragInterval }),
+		{
+			Name: "active-defrag-threshold",
+			Type: ParamFloat,
+			Get: func(c *Config) string {
+				return strconv.FormatFloat(c.Cache.DefragThreshold, 'f', -1, 64)
+			},
+			Set: func(c *Config, value string) error {
+				f, err := strconv.ParseFloat(value, 64)
+				if err != nil || f < 0 || f > 1 {
+					return fmt.Errorf("argument must be a ratio between 0 and 1")
+				}
+				c.Cache.DefragThreshold = f
+				return nil
+			},
+		},
+		{
+			Name: "slowlog-log-slower-than",
+			Type: ParamInt,
+			Get:  func(c *Config) string { return strconv.FormatInt(c.SlowLog.LogSlowerThan, 10) },
+			Set: func(c *Config, value string) error {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return fmt.Errorf("argument couldn't be parsed into an integer")
+				}
+				c.SlowLog.LogSlowerThan = n
+				return nil
+			},
+		},
+		intParam("slowlog-max-len", 0, func(c *Config) *int { return &c.SlowLog.MaxLen }),
+		{
+			Name: "latency-monitor-threshold",
+			Type: ParamInt,
+			Get:  func(c *Config) string { return strconv.FormatInt(c.Latency.MonitorThreshold, 10) },
+			Set: func(c *Config, value string) error {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n < 0 {
+					return fmt.Errorf("argument must be a non-negative integer")
+				}
+				c.Latency.MonitorThreshold = n
+				return nil
+			},
+		},
+		{
+			Name: "maxmemory",
+			Type: ParamMemory,
+			Get:  func(c *Config) string { return strconv.FormatInt(c.Cache.MaxMemory, 10) },
+			Set: func(c *Config, value string) error {
+				n, err := ParseMemory(value)
+				if err != nil {
+					return err
+				}
+				c.Cache.MaxMemory = n
+				return nil
+			},
+		},
+		{
+			Name: "notify-keyspace-events",
+			Type: ParamString,
+			Get:  func(c *Config) string { return c.Cache.NotifyKeyspaceEvents },
+			Set: func(c *Config, value string) error {
+				for _, ch := range value {
+					if !strings.ContainsRune(keyspaceEventFlags, ch) {
+						return fmt.Errorf("invalid event class character '%c'", ch)
+					}
+				}
+				c.Cache.NotifyKeyspaceEvents = value
+				return nil
+			},
+		},
+		{
+			Name: "list-max-listpack-size",
+			Type: ParamInt,
+			Get:  func(c *Config) string { return strconv.Itoa(c.Cache.ListMaxListpackSize) },
+			Set: func(c *Config, value string) error {
+				n, err := strconv.Atoi(value)
+				if err != nil || n == 0 || n < -5 {
+					return fmt.Errorf("argument must be a positive integer or between -5 and -1")
+				}
+				c.Cache.ListMaxListpackSize = n
+				return nil
+			},
+		},
+		intParam("list-compress-depth", 0, func(c *Config) *int { return &c.Cache.ListCompressDepth }),
+	}
+}
+
+// keyspaceEventFlags are the classes accepted by notify-keyspace-events.
+const keyspaceEventFlags = "KEg$lshzxetmndA"
+
+func readOnlyParam(name string, get func(c *Config) string) *Param {
+	return &Param{Name: name, Type: ParamString, Immutable: true, Get: get}
+}
+
+func intParam(name string, min int, field func(c *Config) *int) *Param {
+	return &Param{
+		Name: name,
+		Type: ParamInt,
+		Get:  func(c *Config) string { return strconv.Itoa(*field(c)) },
+		Set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("argument couldn't be parsed into an integer")
+			}
+			if n < min {
+				return fmt.Errorf("argument must be at least %d", min)
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// durationParam accepts Go durations ("1m30s") as well as plain integers,
+// which are taken as seconds like in Redis.
+func durationParam(name string, min time.Duration, field func(c *Config) *time.Duration) *Param {
+	return &Param{
+		Name: name,
+		Type: ParamDuration,
+		Get:  func(c *Config) string { return field(c).String() },
+		Set: func(c *Config, value string) error {
+			d, err := ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			if d < min {
+				return fmt.Errorf("argument must be at least %s", min)
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+// ParseDuration parses a Go duration or a number of seconds.
+func ParseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("argument must not be negative")
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("argument couldn't be parsed into a duration")
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("argument must not be negative")
+	}
+	return d, nil
+}
+
+// ParseMemory parses a byte count with an optional Redis-style unit suffix
+// (k, kb, m, mb, g, gb; the single-letter forms are powers of 1000).
+func ParseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			multiplier = u.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("argument must be a memory value")
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("argument must be a memory value")
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Host:           "0.0.0.0",
+			Port:           6379,
+			MaxConnections: 1000,
+			IdleTimeout:    time.Minute,
+		},
+		Storage: StorageConfig{SyncStrategy: "everysec"},
+		SlowLog: SlowLogConfig{LogSlowerThan: 10000, MaxLen: 128},
+	}
+}
+
+func TestRegistryGet(t *testing.T) {
+	r := NewRegistry(testConfig())
+
+	t.Run("Test Glob", func(t *testing.T) {
+		result := r.Get("slowlog-*")
+		assert.Equal(t, [][2]string{
+			{"slowlog-log-slower-than", "10000"},
+			{"slowlog-max-len", "128"},
+		}, result)
+	})
+
+	t.Run("Test Case Insensitive", func(t *testing.T) {
+		assert.Equal(t, [][2]string{{"maxclients", "1000"}}, r.Get("MAXCLIENTS"))
+	})
+
+	t.Run("Test No Match", func(t *testing.T) {
+		assert.Empty(t, r.Get("nonexistent"))
+	})
+}
+
+func TestRegistrySet(t *testing.T) {
+	t.Run("Test Apply Hook", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		var applied time.Duration
+		r.OnChange("timeout", func(c *Config) error {
+			applied = c.Server.IdleTimeout
+			return nil
+		})
+
+		require.NoError(t, r.Set("timeout", "30"))
+		assert.Equal(t, 30*time.Second, applied)
+		assert.Equal(t, [][2]string{{"timeout", "30s"}}, r.Get("timeout"))
+	})
+
+	t.Run("Test Validation Is Atomic", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		err := r.Set("maxclients", "10", "appendfsync", "sometimes")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "'appendfsync'")
+		assert.Equal(t, 1000, r.Config().Server.MaxConnections)
+	})
+
+	t.Run("Test Failed Hook Rolls Back", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		current := 128
+		r.OnChange("slowlog-max-len", func(c *Config) error {
+			current = c.SlowLog.MaxLen
+			return nil
+		})
+		r.OnChange("maxmemory", func(c *Config) error {
+			return errors.New("cannot apply")
+		})
+
+		assert.Error(t, r.Set("slowlog-max-len", "5", "maxmemory", "1mb"))
+		assert.Equal(t, 128, current)
+		assert.Equal(t, int64(0), r.Config().Cache.MaxMemory)
+	})
+
+	t.Run("Test Immutable And Unknown", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		assert.ErrorContains(t, r.Set("port", "7000"), "immutable")
+		assert.ErrorContains(t, r.Set("nosuchparam", "1"), "Unknown option")
+	})
+
+	t.Run("Test Memory Units", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		require.NoError(t, r.Set("maxmemory", "2mb"))
+		assert.Equal(t, int64(2<<20), r.Config().Cache.MaxMemory)
+		require.NoError(t, r.Set("maxmemory", "1g"))
+		assert.Equal(t, int64(1000*1000*1000), r.Config().Cache.MaxMemory)
+		assert.Error(t, r.Set("maxmemory", "-1"))
+		assert.Error(t, r.Set("maxmemory", "9999999999gb"))
+		assert.Equal(t, int64(1000*1000*1000), r.Config().Cache.MaxMemory)
+	})
+
+	t.Run("Test Read Timeout Is Read Only", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		assert.ErrorContains(t, r.Set("read-timeout", "5s"), "immutable")
+	})
+
+	t.Run("Test Keyspace Event Flags", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		assert.NoError(t, r.Set("notify-keyspace-events", "KEA"))
+		assert.Error(t, r.Set("notify-keyspace-events", "Kq"))
+		assert.Equal(t, "KEA", r.Config().Cache.NotifyKeyspaceEvents)
+	})
+
+	t.Run("Test List Settings", func(t *testing.T) {
+		r := NewRegistry(testConfig())
+		require.NoError(t, r.Set("list-max-listpack-size", "-4", "list-compress-depth", "1"))
+		assert.Equal(t, -4, r.Config().Cache.ListMaxListpackSize)
+		assert.Equal(t, 1, r.Config().Cache.ListCompressDepth)
+		require.NoError(t, r.Set("list-max-listpack-size", "128"))
+		assert.Error(t, r.Set("list-max-listpack-size", "0"))
+		assert.Error(t, r.Set("list-max-listpack-size", "-6"))
+		assert.Error(t, r.Set("list-compress-depth", "-1"))
+		assert.Equal(t, 128, r.Config().Cache.ListMaxListpackSize)
+	})
+}
+
+func TestRegistryRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yml")
+	original := "# crystalcache test config\nserver:\n  port: 6379 # client port\n  max_connections: 1000\ncustom:\n  kept: true\n"
+	require.NoError(t, os.WriteFile(path, []byte(original), 0644))
+
+	cfg := testConfig()
+	cfg.path = path
+	r := NewRegistry(cfg)
+	require.NoError(t, r.Set("maxclients", "42"))
+	require.NoError(t, r.Rewrite())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	out := string(data)
+	assert.Contains(t, out, "# crystalcache test config")
+	assert.Contains(t, out, "port: 6379 # client port")
+	assert.Contains(t, out, "max_connections: 42")
+	assert.Contains(t, out, "kept: true")
+	assert.Contains(t, out, "sync_strategy: everysec")
+}
@@ -89,6 +89,7 @@ var readOnlyCommands = map[string]bool{
 	"LLEN":   true,
 	"LINDEX": true,
 	"LRANGE": true,
+	"LPOS":   true,
 
 	// Set Commands
 	"SCARD":     true,
@@ -242,7 +243,7 @@ func isWriteCommand(cmd string) bool {
 // - Server Management: ACL, CONFIG, FLUSHALL, FLUSHDB, SHUTDOWN, DEBUG, MONITOR, SAVE, BGSAVE, LASTSAVE
 // - Replication Commands: REPLICAOF, SLAVEOF, ROLE, SYNC, PSYNC, REPLCONF
 // - Client Management: CLIENT, KILL
-// - Other Admin Commands: SLOWLOG, MEMORY, SWAPDB, MODULE, SCRIPT, FUNCTION, CLUSTER, SENTINEL, COMMAND
+// - Other Admin Commands: SLOWLOG, LATENCY, MEMORY, SWAPDB, MODULE, SCRIPT, FUNCTION, CLUSTER, SENTINEL, COMMAND
 //
 // Parameters:
 // - cmd: The command to check.
@@ -277,6 +278,7 @@ func isAdminCommand(cmd string) bool {
 
 		// Other Admin Commands
 		"SLOWLOG":  true,
+		"LATENCY":  true,
 		"MEMORY":   true,
 		"SWAPDB":   true,
 		"MODULE":   true,
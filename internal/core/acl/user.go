@@ -388,6 +388,9 @@ func getAllCommands() map[string]bool {
 		"SETEX":       true,
 		"PSETEX":      true,
 		"SETNX":       true,
+		"SUBSTR":      true,
+		"GETEX":       true,
+		"GETDEL":      true,
 
 		// Key Commands
 		"DEL":       true,
@@ -405,6 +408,7 @@ func getAllCommands() map[string]bool {
 		"RENAMENX":  true,
 		"KEYS":      true,
 		"SCAN":      true,
+		"OBJECT":    true,
 
 		// List Commands
 		"RPUSH":     true,
@@ -418,6 +422,7 @@ func getAllCommands() map[string]bool {
 		"LSET":      true,
 		"LRANGE":    true,
 		"LTRIM":     true,
+		"LPOS":      true,
 		"LINSERT":   true,
 		"LREM":      true,
 		"BLPOP":     true,
@@ -503,13 +508,22 @@ func getAllCommands() map[string]bool {
 		"XINFO STREAM": true,
 
 		// Bitmap Commands
-		"SETBIT":      true,
-		"GETBIT":      true,
-		"BITCOUNT":    true,
-		"BITFIELD":    true,
-		"BITFIELD_RO": true,
-		"BITOP":       true,
-		"BITPOS":      true,
+		"SETBIT":        true,
+		"GETBIT":        true,
+		"BITCOUNT":      true,
+		"BITFIELD":      true,
+		"BITFIELD_RO":   true,
+		"BITOP":         true,
+		"BITPOS":        true,
+		"R.SETBIT":      true,
+		"R.GETBIT":      true,
+		"R.BITOP":       true,
+		"R.CARD":        true,
+		"R.RANGE":       true,
+		"R.SETINTARRAY": true,
+		"R.GETINTARRAY": true,
+		"R.MIN":         true,
+		"R.MAX":         true,
 
 		// HyperLogLog Commands
 		"PFADD":   true,
@@ -523,6 +537,7 @@ func getAllCommands() map[string]bool {
 		"GEOPOS":            true,
 		"GEORADIUS":         true,
 		"GEORADIUSBYMEMBER": true,
+		"GEOFENCE":          true,
 
 		// Transaction Commands
 		"MULTI":   true,
@@ -570,6 +585,7 @@ func getAllCommands() map[string]bool {
 		"MONITOR":          true,
 		"DEBUG":            true,
 		"SLOWLOG":          true,
+		"LATENCY":          true,
 
 		// ACL Commands
 		"ACL LOAD":    true,
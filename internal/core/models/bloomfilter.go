@@ -4,13 +4,14 @@ import (
 	"fmt"
 	"hash/fnv"
 	"math"
+	"math/bits"
 	"sync"
 )
 
 type BloomFilter struct {
 	count     uint64
 	mu        sync.RWMutex
-	bitset    []bool
+	bitset    []uint64
 	size      uint
 	hashCount uint
 	config    BloomFilterConfig
@@ -26,7 +27,7 @@ func NewBloomFilter(config BloomFilterConfig) *BloomFilter {
 	hashCount := optimalHashCount(size, config.ExpectedItems)
 
 	return &BloomFilter{
-		bitset:    make([]bool, size),
+		bitset:    make([]uint64, (size+63)/64),
 		size:      size,
 		hashCount: hashCount,
 		count:     0,
@@ -46,51 +47,75 @@ func optimalHashCount(size uint, n uint) uint {
 	return uint(math.Ceil(float64(size) / float64(n) * math.Log(2)))
 }
 
-func (bf *BloomFilter) getHashValues(data []byte) []uint {
-	hashValues := make([]uint, bf.hashCount)
-	h1 := fnv.New64()
-	h2 := fnv.New64a()
-
-	h1.Write(data)
-	hash1 := h1.Sum64()
-
-	h2.Write(data)
-	hash2 := h2.Sum64()
+// bloomHashes returns the two hashes the bit positions of data are
+// derived from, so that they are computed once for every filter checked.
+// FNV alone spreads similar keys poorly, so its result is run through the
+// MurmurHash3 finalizer.
+func bloomHashes(data []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(data)
+	sum := h.Sum64()
+	return fmix64(sum), fmix64(sum^0x9e3779b97f4a7c15) | 1
+}
+
+// fmix64 is the MurmurHash3 64-bit finalizer.
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// setHashes sets the bits of an item; the caller holds the lock.
+func (bf *BloomFilter) setHashes(hash1, hash2 uint64) {
+	for i := uint64(0); i < uint64(bf.hashCount); i++ {
+		bit := (hash1 + i*hash2) % uint64(bf.size)
+		bf.bitset[bit/64] |= 1 << (bit % 64)
+	}
+	bf.count++
+}
 
-	for i := uint(0); i < bf.hashCount; i++ {
-		hashValues[i] = uint((hash1 + uint64(i)*hash2) % uint64(bf.size))
+// testHashes reports whether all bits of an item are set; the caller holds
+// the lock.
+func (bf *BloomFilter) testHashes(hash1, hash2 uint64) bool {
+	for i := uint64(0); i < uint64(bf.hashCount); i++ {
+		bit := (hash1 + i*hash2) % uint64(bf.size)
+		if bf.bitset[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
 	}
+	return true
+}
 
-	return hashValues
+func (bf *BloomFilter) setBits() uint64 {
+	setCount := uint64(0)
+	for _, word := range bf.bitset {
+		setCount += uint64(bits.OnesCount64(word))
+	}
+	return setCount
 }
 
 func (bf *BloomFilter) Add(item []byte) {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
 
-	for _, hash := range bf.getHashValues(item) {
-		bf.bitset[hash] = true
-	}
-	bf.count++
+	bf.setHashes(bloomHashes(item))
 }
 
 func (bf *BloomFilter) Contains(item []byte) bool {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
 
-	for _, hash := range bf.getHashValues(item) {
-		if !bf.bitset[hash] {
-			return false
-		}
-	}
-	return true
+	return bf.testHashes(bloomHashes(item))
 }
 
 func (bf *BloomFilter) Clear() {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
 
-	bf.bitset = make([]bool, bf.size)
+	bf.bitset = make([]uint64, len(bf.bitset))
 	bf.count = 0
 }
 
@@ -98,12 +123,7 @@ func (bf *BloomFilter) ApproximateCount() uint {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
 
-	setCount := uint(0)
-	for _, bit := range bf.bitset {
-		if bit {
-			setCount++
-		}
-	}
+	setCount := bf.setBits()
 
 	return uint(-(float64(bf.size) / float64(bf.hashCount)) * math.Log(1-float64(setCount)/float64(bf.size)))
 }
@@ -112,15 +132,11 @@ func (bf *BloomFilter) FalsePositiveRate() float64 {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
 
-	setCount := 0
-	for _, bit := range bf.bitset {
-		if bit {
-			setCount++
-		}
-	}
+	return bf.falsePositiveRate()
+}
 
-	probability := math.Pow(float64(setCount)/float64(bf.size), float64(bf.hashCount))
-	return probability
+func (bf *BloomFilter) falsePositiveRate() float64 {
+	return math.Pow(float64(bf.setBits())/float64(bf.size), float64(bf.hashCount))
 }
 
 type BloomFilterStats struct {
@@ -137,21 +153,14 @@ func (bf *BloomFilter) Stats() BloomFilterStats {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
 
-	setBits := uint64(0)
-	for _, bit := range bf.bitset {
-		if bit {
-			setBits++
-		}
-	}
-
 	return BloomFilterStats{
 		Size:              bf.size,
 		HashCount:         bf.hashCount,
 		Count:             bf.count,
-		BitsetSize:        uint(len(bf.bitset)),
-		SetBits:           setBits,
-		FalsePositiveRate: bf.FalsePositiveRate(),
-		MemoryUsage:       uint(len(bf.bitset) / 8), // bits to bytes
+		BitsetSize:        bf.size,
+		SetBits:           bf.setBits(),
+		FalsePositiveRate: bf.falsePositiveRate(),
+		MemoryUsage:       uint(len(bf.bitset) * 8),
 	}
 }
 
@@ -159,29 +168,39 @@ func (bf *BloomFilter) SerializeBitSet() ([]byte, error) {
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
 
-	bitSetSizeBytes := (len(bf.bitset) + 7) / 8
-	data := make([]byte, bitSetSizeBytes)
-	for i, bit := range bf.bitset {
-		if bit {
-			data[i/8] |= 1 << (i % 8)
-		}
-	}
-	return data, nil
+	return bf.readBits(nil, 0, bf.byteSize()), nil
 }
 
 func (bf *BloomFilter) DeserializeBitSet(data []byte) error {
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
 
-	if len(data)*8 < len(bf.bitset) {
+	if uint(len(data)) < bf.byteSize() {
 		return fmt.Errorf("data size is smaller than expected for bitset")
 	}
-	for i := 0; i < len(bf.bitset); i++ {
-		if (data[i/8] & (1 << (i % 8))) != 0 {
-			bf.bitset[i] = true
-		} else {
-			bf.bitset[i] = false
-		}
-	}
+	bf.writeBits(0, data[:bf.byteSize()])
 	return nil
 }
+
+// byteSize is the length of the serialized bitset: bit i is bit i%8 of
+// byte i/8.
+func (bf *BloomFilter) byteSize() uint {
+	return (bf.size + 7) / 8
+}
+
+// readBits appends bytes [from, to) of the serialized bitset to dst.
+func (bf *BloomFilter) readBits(dst []byte, from, to uint) []byte {
+	for i := from; i < to; i++ {
+		dst = append(dst, byte(bf.bitset[i/8]>>(8*(i%8))))
+	}
+	return dst
+}
+
+// writeBits overwrites the serialized bitset starting at byte offset.
+func (bf *BloomFilter) writeBits(offset uint, data []byte) {
+	for j, b := range data {
+		i := offset + uint(j)
+		shift := 8 * (i % 8)
+		bf.bitset[i/8] = bf.bitset[i/8]&^(0xff<<shift) | uint64(b)<<shift
+	}
+}
@@ -1,247 +1,497 @@
 package models
 
 import (
-	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
-	"math"
+	"math/bits"
+	"math/rand"
+	"sync"
+	"unsafe"
 )
 
 const (
-	bucketSize = 4   // Number of entries per bucket
-	fingerBits = 8   // Number of bits for each fingerprint
-	maxKicks   = 500 // Maximum number of kicks before declaring filter full
+	// Defaults of CF.RESERVE and of filters created by CF.INSERT
+	CuckooDefaultCapacity        = 1024
+	CuckooDefaultBucketSize      = 2
+	CuckooDefaultMaxIterations   = 20
+	CuckooDefaultExpansion       = 1
+	CuckooDefaultFingerprintBits = 8
+
+	// cuckooAltMultiplier scrambles a fingerprint into the offset between
+	// the two buckets of an item.
+	cuckooAltMultiplier = 0x5bd1e995
+
+	cuckooDumpVersion    = 1
+	cuckooDumpHeaderSize = 28
+	cuckooDumpLayerSize  = 8
 )
 
-// CuckooFilter represents a Cuckoo Filter data structure
+// ErrCuckooFilterFull is returned when an item cannot be placed in a
+// filter that is not allowed to grow.
+var ErrCuckooFilterFull = fmt.Errorf("ERR Filter is full")
+
+// CuckooFilterOptions configures a cuckoo filter.
+type CuckooFilterOptions struct {
+	Capacity        uint64
+	BucketSize      int
+	MaxIterations   int
+	Expansion       int
+	FingerprintBits int
+}
+
+// DefaultCuckooFilterOptions returns the options of CF.RESERVE without
+// modifiers.
+func DefaultCuckooFilterOptions() CuckooFilterOptions {
+	return CuckooFilterOptions{
+		Capacity:        CuckooDefaultCapacity,
+		BucketSize:      CuckooDefaultBucketSize,
+		MaxIterations:   CuckooDefaultMaxIterations,
+		Expansion:       CuckooDefaultExpansion,
+		FingerprintBits: CuckooDefaultFingerprintBits,
+	}
+}
+
+// Validate checks that the options describe a usable filter.
+func (o CuckooFilterOptions) Validate() error {
+	switch {
+	case o.Capacity == 0:
+		return fmt.Errorf("ERR capacity must be positive")
+	case o.BucketSize < 1 || o.BucketSize > 255:
+		return fmt.Errorf("ERR bucket size must be between 1 and 255")
+	case o.MaxIterations < 1 || o.MaxIterations > 65535:
+		return fmt.Errorf("ERR max iterations must be between 1 and 65535")
+	case o.Expansion < 0 || o.Expansion > 32768:
+		return fmt.Errorf("ERR expansion must be between 0 and 32768")
+	case o.FingerprintBits < 4 || o.FingerprintBits > 32:
+		return fmt.Errorf("ERR fingerprint bits must be between 4 and 32")
+	}
+	return nil
+}
+
+// CuckooFilter is a scalable cuckoo filter: a chain of cuckoo hash tables
+// of fingerprints. Each table has a power of two number of buckets, so the
+// two candidate buckets of an item are related by an XOR with a value
+// derived from its fingerprint, and a fingerprint can be moved between
+// them without the item. Items go into the newest table; when it cannot
+// place one within MaxIterations evictions the evictions are undone and a
+// table Expansion times larger is appended, unless Expansion is 0.
 type CuckooFilter struct {
-	capacity  uint64
-	itemCount uint64
-	buckets   [][]byte
-	tagMask   byte
+	mu              sync.RWMutex
+	layers          []*cuckooLayer
+	bucketSize      int
+	maxIterations   int
+	expansion       int
+	fingerprintBits int
+	inserted        uint64
+	deleted         uint64
+}
+
+// cuckooLayer is one table of the chain. Slot i of bucket b is stored at
+// slot index b*bucketSize+i, every slot taking fpBytes little endian bytes;
+// a zero slot is empty.
+type cuckooLayer struct {
+	numBuckets uint64
+	data       []byte
 }
 
 // CuckooInfo represents information about a Cuckoo Filter
 type CuckooInfo struct {
-	Size         uint64
-	ItemCount    uint64
-	FilterFilled float64
-	BucketSize   int
-	Expansion    int
+	Size            int64
+	NumBuckets      uint64
+	NumFilters      int
+	ItemsInserted   uint64
+	ItemsDeleted    uint64
+	BucketSize      int
+	Expansion       int
+	MaxIterations   int
+	FingerprintBits int
 }
 
-// NewCuckooFilter creates a new Cuckoo Filter with a given capacity
-func NewCuckooFilter(capacity uint64) *CuckooFilter {
-	// Round up to next power of 2
-	capacity = uint64(math.Pow(2, math.Ceil(math.Log2(float64(capacity)))))
-
+// NewCuckooFilter creates a cuckoo filter sized for opts.Capacity items.
+// The options must be valid.
+func NewCuckooFilter(opts CuckooFilterOptions) *CuckooFilter {
 	cf := &CuckooFilter{
-		capacity: capacity,
-		buckets:  make([][]byte, capacity),
-		tagMask:  byte(math.Pow(2, fingerBits) - 1),
+		bucketSize:      opts.BucketSize,
+		maxIterations:   opts.MaxIterations,
+		expansion:       opts.Expansion,
+		fingerprintBits: opts.FingerprintBits,
 	}
+	buckets := (opts.Capacity + uint64(opts.BucketSize) - 1) / uint64(opts.BucketSize)
+	cf.layers = []*cuckooLayer{cf.newLayer(nextPowerOfTwo(buckets))}
+	return cf
+}
 
-	// Initialize buckets
-	for i := range cf.buckets {
-		cf.buckets[i] = make([]byte, bucketSize)
+func nextPowerOfTwo(n uint64) uint64 {
+	if n <= 1 {
+		return 1
 	}
+	return 1 << bits.Len64(n-1)
+}
 
-	return cf
+func (cf *CuckooFilter) fpBytes() int {
+	return (cf.fingerprintBits + 7) / 8
 }
 
-// GetMemoryUsage returns the memory usage of CuckooFilter in bytes
-func (cf *CuckooFilter) GetMemoryUsage() int64 {
-	var size int64
-	for _, bucket := range cf.buckets {
-		size += int64(len(bucket))
+func (cf *CuckooFilter) newLayer(numBuckets uint64) *cuckooLayer {
+	return &cuckooLayer{
+		numBuckets: numBuckets,
+		data:       make([]byte, numBuckets*uint64(cf.bucketSize*cf.fpBytes())),
 	}
-	return size
 }
 
-// generateIndex creates the first index for an item
-func (cf *CuckooFilter) generateIndex(item string) uint64 {
+// hash returns the fingerprint of item, never zero, and the hash its
+// first bucket is taken from.
+func (cf *CuckooFilter) hash(item string) (uint32, uint64) {
 	h := fnv.New64a()
 	h.Write([]byte(item))
-	return h.Sum64() % cf.capacity
+	sum := fmix64(h.Sum64())
+	fp := uint32(sum>>32)%(uint32(1<<cf.fingerprintBits-1)) + 1
+	return fp, sum
 }
 
-// generateFingerprint creates a fingerprint for an item
-func (cf *CuckooFilter) generateFingerprint(item string) byte {
-	h := fnv.New32a()
-	h.Write([]byte(item))
-	return byte(h.Sum32() & uint32(cf.tagMask))
+// altIndex returns the other bucket of a fingerprint stored in bucket i.
+func (l *cuckooLayer) altIndex(i uint64, fp uint32) uint64 {
+	return (i ^ uint64(fp)*cuckooAltMultiplier) & (l.numBuckets - 1)
 }
 
-// alternateIndex calculates the alternate index for a given index and fingerprint
-func (cf *CuckooFilter) alternateIndex(index uint64, fingerprint byte) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte{fingerprint})
-	altIndex := h.Sum64()
-	return (index ^ altIndex) % cf.capacity
+func (cf *CuckooFilter) slot(l *cuckooLayer, bucket uint64, i int) uint32 {
+	n := cf.fpBytes()
+	off := (int(bucket)*cf.bucketSize + i) * n
+	var fp uint32
+	for j := n - 1; j >= 0; j-- {
+		fp = fp<<8 | uint32(l.data[off+j])
+	}
+	return fp
 }
 
-// Add adds an item to the filter
-func (cf *CuckooFilter) Add(item string) bool {
-	// Generate fingerprint and initial index
-	fingerprint := cf.generateFingerprint(item)
-	i1 := cf.generateIndex(item)
-	i2 := cf.alternateIndex(i1, fingerprint)
-
-	// Try to insert in either bucket
-	if cf.insertIntoBucket(i1, fingerprint) || cf.insertIntoBucket(i2, fingerprint) {
-		cf.itemCount++
-		return true
+func (cf *CuckooFilter) setSlot(l *cuckooLayer, bucket uint64, i int, fp uint32) {
+	n := cf.fpBytes()
+	off := (int(bucket)*cf.bucketSize + i) * n
+	for j := 0; j < n; j++ {
+		l.data[off+j] = byte(fp >> (8 * j))
 	}
+}
 
-	// Need to relocate existing items
-	currIndex := i1
-	currFingerprint := fingerprint
-	for k := 0; k < maxKicks; k++ {
-		// Randomly select bucket and entry
-		bucket := cf.buckets[currIndex]
-		randPos := randomInt(bucketSize)
-
-		// Swap fingerprints
-		currFingerprint, bucket[randPos] = bucket[randPos], currFingerprint
+// insertIntoBucket stores fp in a free slot of bucket.
+func (cf *CuckooFilter) insertIntoBucket(l *cuckooLayer, bucket uint64, fp uint32) bool {
+	for i := 0; i < cf.bucketSize; i++ {
+		if cf.slot(l, bucket, i) == 0 {
+			cf.setSlot(l, bucket, i, fp)
+			return true
+		}
+	}
+	return false
+}
 
-		// Calculate alternate location for displaced fingerprint
-		currIndex = cf.alternateIndex(currIndex, currFingerprint)
+func (cf *CuckooFilter) countInBucket(l *cuckooLayer, bucket uint64, fp uint32) int {
+	count := 0
+	for i := 0; i < cf.bucketSize; i++ {
+		if cf.slot(l, bucket, i) == fp {
+			count++
+		}
+	}
+	return count
+}
 
-		// Try to insert displaced fingerprint
-		if cf.insertIntoBucket(currIndex, currFingerprint) {
-			cf.itemCount++
+func (cf *CuckooFilter) deleteFromBucket(l *cuckooLayer, bucket uint64, fp uint32) bool {
+	for i := 0; i < cf.bucketSize; i++ {
+		if cf.slot(l, bucket, i) == fp {
+			cf.setSlot(l, bucket, i, 0)
 			return true
 		}
 	}
+	return false
+}
 
-	return false // Filter is too full
+// GetMemoryUsage returns the memory usage of CuckooFilter in bytes
+func (cf *CuckooFilter) GetMemoryUsage() int64 {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return cf.memoryUsage()
 }
 
-// AddNX adds an item if it doesn't exist
-func (cf *CuckooFilter) AddNX(item string) bool {
-	if cf.Exists(item) {
-		return false
+func (cf *CuckooFilter) memoryUsage() int64 {
+	size := int64(unsafe.Sizeof(*cf))
+	for _, l := range cf.layers {
+		size += int64(unsafe.Sizeof(*l)) + int64(len(l.data))
 	}
-	return cf.Add(item)
+	return size
 }
 
-// Exists checks if an item might be in the filter
-func (cf *CuckooFilter) Exists(item string) bool {
-	fingerprint := cf.generateFingerprint(item)
-	i1 := cf.generateIndex(item)
-	i2 := cf.alternateIndex(i1, fingerprint)
+// Add adds an item to the filter. It fails with ErrCuckooFilterFull when
+// the item cannot be placed and the filter may not grow.
+func (cf *CuckooFilter) Add(item string) error {
+	fp, h := cf.hash(item)
 
-	return cf.findInBucket(i1, fingerprint) || cf.findInBucket(i2, fingerprint)
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	return cf.add(fp, h)
 }
 
-// Delete removes an item from the filter if it exists
-func (cf *CuckooFilter) Delete(item string) bool {
-	fingerprint := cf.generateFingerprint(item)
-	i1 := cf.generateIndex(item)
-	i2 := cf.alternateIndex(i1, fingerprint)
+// AddNX adds an item unless it may already be present, and reports
+// whether it was added.
+func (cf *CuckooFilter) AddNX(item string) (bool, error) {
+	fp, h := cf.hash(item)
 
-	if cf.deleteFromBucket(i1, fingerprint) || cf.deleteFromBucket(i2, fingerprint) {
-		cf.itemCount--
-		return true
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if cf.exists(fp, h) {
+		return false, nil
 	}
-	return false
+	return true, cf.add(fp, h)
 }
 
-// Count returns the number of copies of an item in the filter
-func (cf *CuckooFilter) Count(item string) int {
-	fingerprint := cf.generateFingerprint(item)
-	i1 := cf.generateIndex(item)
-	i2 := cf.alternateIndex(i1, fingerprint)
-
-	count := 0
-	count += cf.countInBucket(i1, fingerprint)
-	count += cf.countInBucket(i2, fingerprint)
-	return count
-}
+func (cf *CuckooFilter) add(fp uint32, h uint64) error {
+	l := cf.layers[len(cf.layers)-1]
+	if cf.insert(l, fp, h) {
+		cf.inserted++
+		return nil
+	}
+	if cf.expansion == 0 {
+		return ErrCuckooFilterFull
+	}
 
-// Info returns information about the filter
-func (cf *CuckooFilter) Info() CuckooInfo {
-	return CuckooInfo{
-		Size:         cf.capacity,
-		BucketSize:   bucketSize,
-		ItemCount:    cf.itemCount,
-		FilterFilled: float64(cf.itemCount) / float64(cf.capacity*uint64(bucketSize)),
-		Expansion:    0, // Not implemented yet
+	l = cf.newLayer(l.numBuckets * nextPowerOfTwo(uint64(cf.expansion)))
+	cf.layers = append(cf.layers, l)
+	if !cf.insert(l, fp, h) {
+		return ErrCuckooFilterFull
 	}
+	cf.inserted++
+	return nil
 }
 
-// Helper functions
+// insert places fp in one of its buckets of l, evicting resident
+// fingerprints to their other bucket as needed. If that does not succeed
+// within maxIterations the evictions are rolled back and l is unchanged.
+func (cf *CuckooFilter) insert(l *cuckooLayer, fp uint32, h uint64) bool {
+	i1 := h & (l.numBuckets - 1)
+	i2 := l.altIndex(i1, fp)
+	if cf.insertIntoBucket(l, i1, fp) || cf.insertIntoBucket(l, i2, fp) {
+		return true
+	}
 
-func (cf *CuckooFilter) insertIntoBucket(index uint64, fingerprint byte) bool {
-	bucket := cf.buckets[index]
-	for i := 0; i < bucketSize; i++ {
-		if bucket[i] == 0 {
-			bucket[i] = fingerprint
+	type eviction struct {
+		bucket uint64
+		slot   int
+	}
+	path := make([]eviction, 0, cf.maxIterations)
+	bucket := []uint64{i1, i2}[rand.Intn(2)]
+	current := fp
+	for k := 0; k < cf.maxIterations; k++ {
+		s := rand.Intn(cf.bucketSize)
+		victim := cf.slot(l, bucket, s)
+		cf.setSlot(l, bucket, s, current)
+		path = append(path, eviction{bucket, s})
+		current = victim
+
+		bucket = l.altIndex(bucket, current)
+		if cf.insertIntoBucket(l, bucket, current) {
 			return true
 		}
 	}
+
+	// Walk the evictions back: every slot on the path gets the fingerprint
+	// it held before, and the one still in hand is the original fp
+	for k := len(path) - 1; k >= 0; k-- {
+		e := path[k]
+		previous := cf.slot(l, e.bucket, e.slot)
+		cf.setSlot(l, e.bucket, e.slot, current)
+		current = previous
+	}
 	return false
 }
 
-func (cf *CuckooFilter) findInBucket(index uint64, fingerprint byte) bool {
-	bucket := cf.buckets[index]
-	for i := 0; i < bucketSize; i++ {
-		if bucket[i] == fingerprint {
+// Exists checks if an item might be in the filter
+func (cf *CuckooFilter) Exists(item string) bool {
+	fp, h := cf.hash(item)
+
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return cf.exists(fp, h)
+}
+
+func (cf *CuckooFilter) exists(fp uint32, h uint64) bool {
+	for i := len(cf.layers) - 1; i >= 0; i-- {
+		l := cf.layers[i]
+		i1 := h & (l.numBuckets - 1)
+		if cf.countInBucket(l, i1, fp) > 0 || cf.countInBucket(l, l.altIndex(i1, fp), fp) > 0 {
 			return true
 		}
 	}
 	return false
 }
 
-func (cf *CuckooFilter) deleteFromBucket(index uint64, fingerprint byte) bool {
-	bucket := cf.buckets[index]
-	for i := 0; i < bucketSize; i++ {
-		if bucket[i] == fingerprint {
-			bucket[i] = 0
+// Delete removes one copy of an item from the filter if it exists,
+// looking in the newest table first
+func (cf *CuckooFilter) Delete(item string) bool {
+	fp, h := cf.hash(item)
+
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	for i := len(cf.layers) - 1; i >= 0; i-- {
+		l := cf.layers[i]
+		i1 := h & (l.numBuckets - 1)
+		if cf.deleteFromBucket(l, i1, fp) || cf.deleteFromBucket(l, l.altIndex(i1, fp), fp) {
+			cf.deleted++
 			return true
 		}
 	}
 	return false
 }
 
-func (cf *CuckooFilter) countInBucket(index uint64, fingerprint byte) int {
+// Count returns the number of copies of an item in the filter
+func (cf *CuckooFilter) Count(item string) int {
+	fp, h := cf.hash(item)
+
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+
 	count := 0
-	bucket := cf.buckets[index]
-	for i := 0; i < bucketSize; i++ {
-		if bucket[i] == fingerprint {
-			count++
+	for _, l := range cf.layers {
+		i1 := h & (l.numBuckets - 1)
+		count += cf.countInBucket(l, i1, fp)
+		if i2 := l.altIndex(i1, fp); i2 != i1 {
+			count += cf.countInBucket(l, i2, fp)
 		}
 	}
 	return count
 }
 
-// ScanDump returns a part of the filter for serialization
-func (cf *CuckooFilter) ScanDump(iter uint64) (uint64, []byte) {
-	if iter >= cf.capacity {
+// Info returns information about the filter
+func (cf *CuckooFilter) Info() CuckooInfo {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+
+	info := CuckooInfo{
+		Size:            cf.memoryUsage(),
+		NumFilters:      len(cf.layers),
+		ItemsInserted:   cf.inserted - cf.deleted,
+		ItemsDeleted:    cf.deleted,
+		BucketSize:      cf.bucketSize,
+		Expansion:       cf.expansion,
+		MaxIterations:   cf.maxIterations,
+		FingerprintBits: cf.fingerprintBits,
+	}
+	for _, l := range cf.layers {
+		info.NumBuckets += l.numBuckets
+	}
+	return info
+}
+
+// ScanDump returns the chunk of the serialized filter following iter and
+// the iterator to pass next; 0 means the dump is complete. The first
+// chunk is a header describing the tables, the following ones are at most
+// maxChunk bytes of their buckets in order.
+func (cf *CuckooFilter) ScanDump(iter uint64, maxChunk int) (uint64, []byte) {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+
+	if iter == 0 {
+		return 1, cf.header()
+	}
+
+	offset := iter - 1
+	var chunk []byte
+	start := uint64(0)
+	for _, l := range cf.layers {
+		end := start + uint64(len(l.data))
+		if offset < end && len(chunk) < maxChunk {
+			from := max(offset, start) - start
+			to := min(end-start, from+uint64(maxChunk-len(chunk)))
+			chunk = append(chunk, l.data[from:to]...)
+		}
+		start = end
+	}
+	if len(chunk) == 0 {
 		return 0, nil
 	}
+	return iter + uint64(len(chunk)), chunk
+}
 
-	// Return current bucket and next iterator
-	return iter + 1, cf.buckets[iter]
+// header layout, little endian: version (1), fingerprint bits (1), bucket
+// size (1), unused (1), max iterations (2), expansion (2), items inserted
+// (8), items deleted (8), layer count (4), then the bucket count (8) of
+// every layer.
+func (cf *CuckooFilter) header() []byte {
+	buf := make([]byte, cuckooDumpHeaderSize, cuckooDumpHeaderSize+len(cf.layers)*cuckooDumpLayerSize)
+	buf[0] = cuckooDumpVersion
+	buf[1] = byte(cf.fingerprintBits)
+	buf[2] = byte(cf.bucketSize)
+	binary.LittleEndian.PutUint16(buf[4:], uint16(cf.maxIterations))
+	binary.LittleEndian.PutUint16(buf[6:], uint16(cf.expansion))
+	binary.LittleEndian.PutUint64(buf[8:], cf.inserted)
+	binary.LittleEndian.PutUint64(buf[16:], cf.deleted)
+	binary.LittleEndian.PutUint32(buf[24:], uint32(len(cf.layers)))
+	for _, l := range cf.layers {
+		buf = binary.LittleEndian.AppendUint64(buf, l.numBuckets)
+	}
+	return buf
 }
 
-// LoadChunk loads a part of the filter from serialization
-func (cf *CuckooFilter) LoadChunk(iter uint64, data []byte) error {
-	if iter >= cf.capacity {
-		return fmt.Errorf("invalid iterator")
+// LoadCuckooHeader creates an empty filter from the header chunk of a
+// dump.
+func LoadCuckooHeader(data []byte) (*CuckooFilter, error) {
+	invalid := fmt.Errorf("ERR invalid cuckoo filter header")
+	if len(data) < cuckooDumpHeaderSize || data[0] != cuckooDumpVersion {
+		return nil, invalid
 	}
-	if len(data) != bucketSize {
-		return fmt.Errorf("invalid chunk size")
+	numLayers := int(binary.LittleEndian.Uint32(data[24:]))
+	if numLayers == 0 || len(data) != cuckooDumpHeaderSize+numLayers*cuckooDumpLayerSize {
+		return nil, invalid
 	}
 
-	copy(cf.buckets[iter], data)
-	return nil
+	cf := &CuckooFilter{
+		fingerprintBits: int(data[1]),
+		bucketSize:      int(data[2]),
+		maxIterations:   int(binary.LittleEndian.Uint16(data[4:])),
+		expansion:       int(binary.LittleEndian.Uint16(data[6:])),
+		inserted:        binary.LittleEndian.Uint64(data[8:]),
+		deleted:         binary.LittleEndian.Uint64(data[16:]),
+	}
+	opts := CuckooFilterOptions{
+		Capacity:        1,
+		BucketSize:      cf.bucketSize,
+		MaxIterations:   cf.maxIterations,
+		Expansion:       cf.expansion,
+		FingerprintBits: cf.fingerprintBits,
+	}
+	if opts.Validate() != nil {
+		return nil, invalid
+	}
+	for i := 0; i < numLayers; i++ {
+		numBuckets := binary.LittleEndian.Uint64(data[cuckooDumpHeaderSize+i*cuckooDumpLayerSize:])
+		if numBuckets == 0 || numBuckets&(numBuckets-1) != 0 || numBuckets > 1<<32 {
+			return nil, invalid
+		}
+		cf.layers = append(cf.layers, cf.newLayer(numBuckets))
+	}
+	return cf, nil
 }
 
-// Helper function to generate random numbers
-func randomInt(max int) int {
-	b := make([]byte, 8)
-	rand.Read(b)
-	return int(binary.LittleEndian.Uint64(b) % uint64(max))
+// LoadChunk restores a bucket chunk returned by ScanDump together with
+// iter.
+func (cf *CuckooFilter) LoadChunk(iter uint64, data []byte) error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if iter <= uint64(len(data)) {
+		return fmt.Errorf("ERR invalid iterator")
+	}
+	offset := iter - 1 - uint64(len(data))
+	start := uint64(0)
+	for _, l := range cf.layers {
+		end := start + uint64(len(l.data))
+		if offset < end && len(data) > 0 {
+			n := copy(l.data[offset-start:], data)
+			data = data[n:]
+			offset += uint64(n)
+		}
+		start = end
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("ERR chunk exceeds the filter size")
+	}
+	return nil
 }
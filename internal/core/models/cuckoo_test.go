@@ -0,0 +1,124 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCuckooFilterGrowth(t *testing.T) {
+	opts := DefaultCuckooFilterOptions()
+	opts.Capacity = 1000
+	opts.Expansion = 2
+	cf := NewCuckooFilter(opts)
+
+	const n = 10000
+	for i := 0; i < n; i++ {
+		require.NoError(t, cf.Add("item-"+strconv.Itoa(i)))
+	}
+
+	info := cf.Info()
+	assert.Greater(t, info.NumFilters, 1)
+	assert.Equal(t, uint64(n), info.ItemsInserted)
+	assert.Equal(t, 2, info.BucketSize)
+	for i := 0; i < n; i++ {
+		require.True(t, cf.Exists("item-"+strconv.Itoa(i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 100000; i++ {
+		if cf.Exists("other-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	// Every table adds up to 2*BucketSize/255 to the rate of 8 bit fingerprints
+	assert.Less(t, float64(falsePositives)/100000, 0.02*float64(info.NumFilters))
+}
+
+func TestCuckooFilterNoExpansion(t *testing.T) {
+	opts := DefaultCuckooFilterOptions()
+	opts.Capacity = 64
+	opts.Expansion = 0
+	cf := NewCuckooFilter(opts)
+
+	var err error
+	added := 0
+	for ; err == nil; added++ {
+		err = cf.Add(strconv.Itoa(added))
+	}
+	assert.ErrorIs(t, err, ErrCuckooFilterFull)
+	assert.Equal(t, 1, cf.Info().NumFilters)
+
+	// A failed insertion rolls its evictions back, so nothing is lost
+	for i := 0; i < added-1; i++ {
+		require.True(t, cf.Exists(strconv.Itoa(i)), "item %d", i)
+	}
+	assert.Equal(t, uint64(added-1), cf.Info().ItemsInserted)
+}
+
+func TestCuckooFilterDelete(t *testing.T) {
+	opts := DefaultCuckooFilterOptions()
+	opts.FingerprintBits = 16
+	opts.BucketSize = 4
+	cf := NewCuckooFilter(opts)
+
+	require.NoError(t, cf.Add("a"))
+	require.NoError(t, cf.Add("a"))
+	assert.Equal(t, 2, cf.Count("a"))
+	added, err := cf.AddNX("a")
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	assert.True(t, cf.Delete("a"))
+	assert.True(t, cf.Exists("a"))
+	assert.True(t, cf.Delete("a"))
+	assert.False(t, cf.Exists("a"))
+	assert.False(t, cf.Delete("a"))
+
+	info := cf.Info()
+	assert.Equal(t, uint64(0), info.ItemsInserted)
+	assert.Equal(t, uint64(2), info.ItemsDeleted)
+}
+
+func TestCuckooFilterScanDump(t *testing.T) {
+	opts := DefaultCuckooFilterOptions()
+	opts.Capacity = 100
+	opts.FingerprintBits = 12
+	opts.Expansion = 4
+	cf := NewCuckooFilter(opts)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, cf.Add(strconv.Itoa(i)))
+	}
+	for i := 0; i < 100; i++ {
+		require.True(t, cf.Delete(strconv.Itoa(i)))
+	}
+	require.Greater(t, cf.Info().NumFilters, 1)
+
+	iter, header := cf.ScanDump(0, 64)
+	restored, err := LoadCuckooHeader(header)
+	require.NoError(t, err)
+	chunks := 0
+	for {
+		var chunk []byte
+		iter, chunk = cf.ScanDump(iter, 64)
+		if iter == 0 {
+			break
+		}
+		require.LessOrEqual(t, len(chunk), 64)
+		require.NoError(t, restored.LoadChunk(iter, chunk))
+		chunks++
+	}
+	assert.Greater(t, chunks, 1)
+
+	assert.Equal(t, cf.Info(), restored.Info())
+	for i := 0; i < 4000; i++ {
+		item := strconv.Itoa(i)
+		require.Equal(t, cf.Count(item), restored.Count(item), "item %d", i)
+	}
+
+	_, err = LoadCuckooHeader(header[:len(header)-1])
+	assert.Error(t, err)
+	assert.Error(t, restored.LoadChunk(1<<30, []byte{1}))
+}
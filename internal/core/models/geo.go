@@ -6,7 +6,10 @@ type GeoPoint struct {
 	Latitude  float64
 	Distance  float64
 	Name      string
-	GeoHash   string
+	// GeoHash is the standard 11 character geohash of the point
+	GeoHash string
+	// Hash is the 52 bit geohash the point is scored with in its geo set
+	Hash uint64
 }
 
 // GeoSearchOptions represents search criteria for GeoSearch operations
@@ -22,8 +25,29 @@ type GeoSearchOptions struct {
 	Count      int
 	ByBox      bool
 	ByRadius   bool
-	WithCoord  bool
-	WithDist   bool
-	WithHash   bool
-	CountAny   bool
+	// ByPolygon searches the polygon of the longitude, latitude pairs in
+	// Polygon. Distances are still measured from the center.
+	ByPolygon bool
+	Polygon   [][2]float64
+	WithCoord bool
+	WithDist  bool
+	WithHash  bool
+	CountAny  bool
+	// StoreDist makes GeoSearchStore score the points with their distance
+	// instead of their geohash
+	StoreDist bool
+}
+
+// GeoFence is an area of a geo set. Members of the set entering or leaving
+// it are published as events.
+type GeoFence struct {
+	Name string
+	// Polygon holds the longitude, latitude vertices of a polygon fence.
+	// Without them the fence is a circle of Radius around Longitude,
+	// Latitude.
+	Polygon   [][2]float64
+	Longitude float64
+	Latitude  float64
+	Radius    float64
+	Unit      string
 }
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHyperLogLogEmptyEncoding(t *testing.T) {
+	hll := NewHyperLogLog()
+	assert.Equal(t, []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"), hll.Bytes())
+	assert.Equal(t, uint64(0), hll.Count())
+}
+
+func TestHyperLogLogRedisEncoding(t *testing.T) {
+	hll := NewHyperLogLog()
+	for _, element := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		hll.Add([]byte(element))
+	}
+	assert.Equal(t, uint64(7), hll.Count())
+	// GET of the same key in Redis after PFADD and PFCOUNT
+	expected := "HYLL\x01\x00\x00\x00\x07\x00\x00\x00\x00\x00\x00\x00" +
+		"Fm\x80V\x0c\x80D<\x848\x80P\xb1\x84I\x8c\x80Bm\x80BZ"
+	assert.Equal(t, []byte(expected), hll.Bytes())
+}
+
+func TestHyperLogLogAccuracy(t *testing.T) {
+	hll := NewHyperLogLog()
+	n := 0
+	for _, target := range []int{10, 100, 1000, 10000, 100000} {
+		for ; n < target; n++ {
+			hll.Add([]byte("element:" + strconv.Itoa(n)))
+		}
+		assert.InEpsilon(t, n, hll.Count(), 0.03, "cardinality %d", n)
+		if n <= 100 {
+			assert.Equal(t, "sparse", hll.Debug()["encoding"])
+		}
+	}
+	assert.Equal(t, "dense", hll.Debug()["encoding"])
+	assert.Len(t, hll.Bytes(), hllDenseSize)
+}
+
+func TestHyperLogLogSparseMatchesDense(t *testing.T) {
+	sparse := NewHyperLogLog()
+	dense := NewHyperLogLog()
+	dense.toDense()
+	for i := 0; i < 500; i++ {
+		element := []byte(strconv.Itoa(i * 7919))
+		assert.Equal(t, dense.Add(element), sparse.Add(element))
+	}
+	require.Equal(t, "sparse", sparse.Debug()["encoding"])
+
+	var sparseRegisters, denseRegisters [hllM]uint8
+	sparse.registers(&sparseRegisters)
+	dense.registers(&denseRegisters)
+	assert.Equal(t, denseRegisters, sparseRegisters)
+	assert.Equal(t, dense.Count(), sparse.Count())
+
+	// The opcodes still cover exactly the registers
+	var histogram [64]int
+	require.True(t, sparseHistogram(sparse.Bytes()[hllHeaderSize:], &histogram))
+}
+
+func TestHyperLogLogCachedCardinality(t *testing.T) {
+	hll := NewHyperLogLog()
+	hll.Add([]byte("a"))
+	assert.NotZero(t, hll.Bytes()[15]&0x80)
+
+	count := hll.Count()
+	data := hll.Bytes()
+	assert.Equal(t, byte(count), data[8])
+	assert.Zero(t, data[15]&0x80)
+
+	assert.False(t, hll.Add([]byte("a")))
+	assert.Zero(t, hll.Bytes()[15]&0x80)
+}
+
+func TestHyperLogLogParse(t *testing.T) {
+	hll := NewHyperLogLog()
+	for i := 0; i < 50; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	parsed, err := ParseHyperLogLog(hll.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, hll.Count(), parsed.Count())
+
+	_, err = ParseHyperLogLog([]byte("not an hll at all"))
+	assert.ErrorIs(t, err, ErrInvalidHyperLogLog)
+	dense := NewHyperLogLog()
+	dense.toDense()
+	_, err = ParseHyperLogLog(dense.Bytes()[:hllDenseSize-1])
+	assert.ErrorIs(t, err, ErrInvalidHyperLogLog)
+	_, err = ParseHyperLogLog(append(hll.Bytes(), 0x00))
+	assert.ErrorIs(t, err, ErrCorruptHyperLogLog)
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b, union := NewHyperLogLog(), NewHyperLogLog(), NewHyperLogLog()
+	for i := 0; i < 3000; i++ {
+		element := []byte(strconv.Itoa(i))
+		if i < 2000 {
+			a.Add(element)
+		}
+		if i >= 1000 {
+			b.Add(element)
+		}
+		union.Add(element)
+	}
+
+	assert.Equal(t, union.Count(), CountMerged(a, b))
+
+	dest := NewHyperLogLog()
+	dest.Merge(a, b)
+	assert.Equal(t, union.Count(), dest.Count())
+	assert.InEpsilon(t, 3000, dest.Count(), 0.03)
+}
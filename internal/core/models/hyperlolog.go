@@ -1,127 +1,572 @@
 package models
 
 import (
+	"encoding/binary"
+	"fmt"
 	"math"
-	"math/bits"
+	"sync"
+	"unsafe"
 )
 
+// The HyperLogLog is kept in the string representation Redis uses, so the
+// bytes can be exchanged with Redis through GET and SET. A 16 byte header
+//
+//	"HYLL" | encoding (1) | unused (3) | cached cardinality (8, little endian)
+//
+// is followed by the registers, either sparse or dense. The most significant
+// bit of the last cardinality byte marks the cached value as stale.
+//
+// Dense registers are 6 bit fields packed from the least significant bit of
+// each byte. The sparse encoding is a run length encoding of the registers
+// with three opcodes:
+//
+//	ZERO  00xxxxxx          1-64 registers set to 0
+//	XZERO 01xxxxxx yyyyyyyy 1-16384 registers set to 0
+//	VAL   1vvvvvxx          1-4 registers set to 1-32
+//
+// A sparse HLL is promoted to dense when a register exceeds 32 or the
+// representation grows past hllSparseMaxBytes.
 const (
-	hllP                       = 14                                   // Precision parameter
-	hllM                       = 1 << hllP                            // Number of registers
-	hllAlpha                   = 0.7213 / (1.0 + 1.079/float64(hllM)) // Alpha constant for bias correction
-	thresholdForLinearCounting = float64(hllM * 5 / 2)                // Threshold for switching to linear counting
+	hllP        = 14        // Precision parameter
+	hllQ        = 64 - hllP // Hash bits used for the run length of zeros
+	hllM        = 1 << hllP // Number of registers
+	hllBits     = 6
+	hllRegMax   = 1<<hllBits - 1
+	hllAlphaInf = 0.721347520444481703680 // Bias constant of the improved estimator
+
+	hllHeaderSize = 16
+	hllDenseSize  = hllHeaderSize + (hllM*hllBits+7)/8
+	hllDense      = 0
+	hllSparse     = 1
+
+	hllSparseZeroMaxLen  = 64
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseMaxBytes    = 3000
+
+	hllHashSeed = 0xadc83b19
+)
+
+var (
+	// ErrInvalidHyperLogLog is returned for strings that are not HLLs.
+	ErrInvalidHyperLogLog = fmt.Errorf("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrCorruptHyperLogLog is returned for sparse HLLs whose opcodes do not
+	// cover exactly the registers.
+	ErrCorruptHyperLogLog = fmt.Errorf("INVALIDOBJ Corrupted HLL object detected")
 )
 
 // HyperLogLog represents the HyperLogLog probabilistic data structure
 type HyperLogLog struct {
-	size      uint64
-	registers []byte
+	mu   sync.Mutex
+	data []byte
 }
 
-// NewHyperLogLog creates a new HyperLogLog with default precision
+// NewHyperLogLog creates an empty sparse HyperLogLog
 func NewHyperLogLog() *HyperLogLog {
-	return &HyperLogLog{
-		registers: make([]byte, hllM),
-		size:      0,
+	data := make([]byte, hllHeaderSize, hllHeaderSize+2)
+	copy(data, "HYLL")
+	data[4] = hllSparse
+	data = append(data, 0, 0)
+	sparseSetXZero(data[hllHeaderSize:], hllM)
+	return &HyperLogLog{data: data}
+}
+
+// ParseHyperLogLog creates a HyperLogLog from its string representation.
+func ParseHyperLogLog(data []byte) (*HyperLogLog, error) {
+	if len(data) < hllHeaderSize || string(data[:4]) != "HYLL" || data[4] > hllSparse {
+		return nil, ErrInvalidHyperLogLog
 	}
+	if data[4] == hllDense && len(data) != hllDenseSize {
+		return nil, ErrInvalidHyperLogLog
+	}
+	if data[4] == hllSparse {
+		var histogram [64]int
+		if !sparseHistogram(data[hllHeaderSize:], &histogram) {
+			return nil, ErrCorruptHyperLogLog
+		}
+	}
+	return &HyperLogLog{data: append([]byte(nil), data...)}, nil
+}
+
+// Bytes returns a copy of the string representation
+func (hll *HyperLogLog) Bytes() []byte {
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+	return append([]byte(nil), hll.data...)
 }
 
 // GetMemoryUsage returns the memory usage of HyperLogLog in bytes
 func (hll *HyperLogLog) GetMemoryUsage() int64 {
-	return int64(len(hll.registers))
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+	return int64(unsafe.Sizeof(*hll)) + int64(cap(hll.data))
 }
 
-// Add adds a value to the HyperLogLog
-func (hll *HyperLogLog) Add(value uint64) bool {
-	// Get the bucket index and pattern from the hash
-	bucket := value & (hllM - 1)
-	pattern := value >> hllP
+// Add adds an element and reports whether a register changed
+func (hll *HyperLogLog) Add(element []byte) bool {
+	index, count := hllPatLen(element)
+
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+
+	if !hll.set(index, count) {
+		return false
+	}
+	hll.invalidateCache()
+	return true
+}
 
-	// Count trailing zeros + 1
-	zeros := uint8(1)
-	if pattern != 0 {
-		zeros = uint8(bits.TrailingZeros64(pattern)) + 1
+// hllPatLen returns the register of element and the length of the run of
+// zeros in its hash, plus one, exactly as Redis computes them.
+func hllPatLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, hllHashSeed)
+	index := int(hash & (hllM - 1))
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
 	}
+	return index, count
+}
 
-	// Update register if new value is larger
-	if zeros > hll.registers[bucket] {
-		hll.registers[bucket] = zeros
-		hll.size = 0 // Reset cached size
-		return true
+// murmurHash64A is the 64 bit MurmurHash2 variant used by Redis, reading
+// blocks as little endian.
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ uint64(len(key))*m
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * i)
+		}
+		h *= m
 	}
-	return false
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
 }
 
-// Count returns the estimated cardinality
-func (hll *HyperLogLog) Count() uint64 {
-	if hll.size > 0 {
-		return hll.size
+func (hll *HyperLogLog) invalidateCache() {
+	hll.data[15] |= 0x80
+}
+
+func (hll *HyperLogLog) set(index int, count uint8) bool {
+	if hll.data[4] == hllDense {
+		return denseSet(hll.data[hllHeaderSize:], index, count)
 	}
+	return hll.sparseSet(index, count)
+}
 
-	// Calculate harmonicMean
-	sum := 0.0
-	zeros := 0
-	for _, val := range hll.registers {
-		if val == 0 {
-			zeros++
-			continue
+func denseGet(registers []byte, index int) uint8 {
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	v := uint(registers[b]) >> fb
+	if b+1 < len(registers) {
+		v |= uint(registers[b+1]) << (8 - fb)
+	}
+	return uint8(v & hllRegMax)
+}
+
+func denseSet(registers []byte, index int, count uint8) bool {
+	if denseGet(registers, index) >= count {
+		return false
+	}
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	v := uint(count)
+	registers[b] &^= byte(hllRegMax << fb)
+	registers[b] |= byte(v << fb)
+	if b+1 < len(registers) {
+		registers[b+1] &^= byte(hllRegMax >> (8 - fb))
+		registers[b+1] |= byte(v >> (8 - fb))
+	}
+	return true
+}
+
+func sparseIsZero(p byte) bool  { return p&0xc0 == 0 }
+func sparseIsXZero(p byte) bool { return p&0xc0 == 0x40 }
+func sparseIsVal(p byte) bool   { return p&0x80 != 0 }
+
+func sparseZeroLen(p byte) int       { return int(p&0x3f) + 1 }
+func sparseXZeroLen(p, q byte) int   { return int(p&0x3f)<<8 | int(q) + 1 }
+func sparseValValue(p byte) uint8    { return (p>>2)&0x1f + 1 }
+func sparseValLen(p byte) int        { return int(p&0x3) + 1 }
+func sparseVal(v uint8, n int) byte  { return byte(int(v-1)<<2|(n-1)) | 0x80 }
+func sparseZero(n int) byte          { return byte(n - 1) }
+func sparseSetXZero(p []byte, n int) { p[0], p[1] = byte((n-1)>>8)|0x40, byte(n-1) }
+
+// sparseSet follows the Redis algorithm step by step, so applying the same
+// updates to the same sparse string yields the same bytes as Redis.
+func (hll *HyperLogLog) sparseSet(index int, count uint8) bool {
+	if count > hllSparseValMaxValue {
+		return hll.promote(index, count)
+	}
+
+	// Find the opcode covering index
+	sparse := hll.data[hllHeaderSize:]
+	p, prev := 0, -1
+	first, span := 0, 0
+	for p < len(sparse) {
+		oplen := 1
+		switch {
+		case sparseIsZero(sparse[p]):
+			span = sparseZeroLen(sparse[p])
+		case sparseIsVal(sparse[p]):
+			span = sparseValLen(sparse[p])
+		default:
+			span = sparseXZeroLen(sparse[p], sparse[p+1])
+			oplen = 2
 		}
-		sum += math.Pow(2.0, -float64(val))
+		if index <= first+span-1 {
+			break
+		}
+		prev = p
+		p += oplen
+		first += span
+	}
+	if span == 0 || p >= len(sparse) {
+		return false
 	}
 
-	// Apply bias correction
-	estimate := hllAlpha * float64(hllM*hllM) / sum
+	op := sparse[p]
+	isVal, isXZero := sparseIsVal(op), sparseIsXZero(op)
+	if isVal {
+		if sparseValValue(op) >= count {
+			return false
+		}
+		if sparseValLen(op) == 1 {
+			sparse[p] = sparseVal(count, 1)
+			hll.sparseMerge(prev)
+			return true
+		}
+	} else if !isXZero && sparseZeroLen(op) == 1 {
+		sparse[p] = sparseVal(count, 1)
+		hll.sparseMerge(prev)
+		return true
+	}
 
-	// Linear counting for small cardinalities
-	if zeros > 0 {
-		linearEst := float64(hllM) * math.Log(float64(hllM)/float64(zeros))
-		if linearEst <= thresholdForLinearCounting {
-			estimate = linearEst
+	// Replace the opcode by up to three covering the registers before
+	// index, index itself and the registers after it
+	seq := make([]byte, 0, 5)
+	last := first + span - 1
+	if isVal {
+		curval := sparseValValue(op)
+		if index != first {
+			seq = append(seq, sparseVal(curval, index-first))
+		}
+		seq = append(seq, sparseVal(count, 1))
+		if index != last {
+			seq = append(seq, sparseVal(curval, last-index))
+		}
+	} else {
+		appendZeros := func(n int) {
+			if n > hllSparseZeroMaxLen {
+				seq = append(seq, 0, 0)
+				sparseSetXZero(seq[len(seq)-2:], n)
+			} else {
+				seq = append(seq, sparseZero(n))
+			}
+		}
+		if index != first {
+			appendZeros(index - first)
 		}
+		seq = append(seq, sparseVal(count, 1))
+		if index != last {
+			appendZeros(last - index)
+		}
+	}
+
+	oldlen := 1
+	if isXZero {
+		oldlen = 2
+	}
+	if len(hll.data)+len(seq)-oldlen > hllSparseMaxBytes && len(seq) > oldlen {
+		return hll.promote(index, count)
 	}
 
-	hll.size = uint64(estimate)
-	return hll.size
+	data := make([]byte, 0, len(hll.data)+len(seq)-oldlen)
+	data = append(data, hll.data[:hllHeaderSize+p]...)
+	data = append(data, seq...)
+	data = append(data, hll.data[hllHeaderSize+p+oldlen:]...)
+	hll.data = data
+	hll.sparseMerge(prev)
+	return true
 }
 
-// Merge combines another HyperLogLog into this one
-func (hll *HyperLogLog) Merge(other *HyperLogLog) {
-	for i := 0; i < hllM; i++ {
-		if other.registers[i] > hll.registers[i] {
-			hll.registers[i] = other.registers[i]
-			hll.size = 0 // Reset cached size
+// sparseMerge joins adjacent VAL opcodes of equal value around the opcode
+// that changed, scanning up to five opcodes from the one before it.
+func (hll *HyperLogLog) sparseMerge(prev int) {
+	p := max(prev, 0) + hllHeaderSize
+	for scan := 5; p < len(hll.data) && scan > 0; scan-- {
+		op := hll.data[p]
+		if sparseIsXZero(op) {
+			p += 2
+			continue
+		}
+		if sparseIsZero(op) {
+			p++
+			continue
 		}
+		if p+1 < len(hll.data) && sparseIsVal(hll.data[p+1]) {
+			next := hll.data[p+1]
+			if v := sparseValValue(op); v == sparseValValue(next) {
+				if n := sparseValLen(op) + sparseValLen(next); n <= hllSparseValMaxLen {
+					hll.data[p+1] = sparseVal(v, n)
+					hll.data = append(hll.data[:p], hll.data[p+1:]...)
+					// Try merging the result with the opcode on its right
+					continue
+				}
+			}
+		}
+		p++
 	}
 }
 
-// Debug returns internal state for debugging
-func (hll *HyperLogLog) Debug() map[string]interface{} {
-	return map[string]interface{}{
-		"encoding":    "raw",
-		"size":        len(hll.registers),
-		"regwidth":    8,
-		"sparseness":  calculateSparseness(hll.registers),
-		"nonZeroRegs": countNonZeroRegisters(hll.registers),
+// promote converts the registers to the dense encoding and sets index.
+func (hll *HyperLogLog) promote(index int, count uint8) bool {
+	hll.toDense()
+	return denseSet(hll.data[hllHeaderSize:], index, count)
+}
+
+func (hll *HyperLogLog) toDense() {
+	if hll.data[4] == hllDense {
+		return
 	}
+	dense := make([]byte, hllDenseSize)
+	copy(dense, hll.data[:hllHeaderSize])
+	dense[4] = hllDense
+	registers := dense[hllHeaderSize:]
+
+	sparse := hll.data[hllHeaderSize:]
+	index := 0
+	for p := 0; p < len(sparse); {
+		op := sparse[p]
+		switch {
+		case sparseIsZero(op):
+			index += sparseZeroLen(op)
+			p++
+		case sparseIsXZero(op):
+			index += sparseXZeroLen(op, sparse[p+1])
+			p += 2
+		default:
+			n, v := sparseValLen(op), sparseValValue(op)
+			for i := 0; i < n && index < hllM; i++ {
+				denseSet(registers, index, v)
+				index++
+			}
+			p++
+		}
+	}
+	hll.data = dense
 }
 
-// Helper functions
-func calculateSparseness(registers []byte) float64 {
-	nonZero := 0
-	for _, reg := range registers {
-		if reg != 0 {
-			nonZero++
+// sparseHistogram adds the registers of a sparse encoding to histogram and
+// reports whether the opcodes cover exactly hllM registers.
+func sparseHistogram(sparse []byte, histogram *[64]int) bool {
+	index := 0
+	for p := 0; p < len(sparse); {
+		op := sparse[p]
+		switch {
+		case sparseIsZero(op):
+			n := sparseZeroLen(op)
+			histogram[0] += n
+			index += n
+			p++
+		case sparseIsXZero(op):
+			if p+1 >= len(sparse) {
+				return false
+			}
+			n := sparseXZeroLen(op, sparse[p+1])
+			histogram[0] += n
+			index += n
+			p += 2
+		default:
+			n := sparseValLen(op)
+			histogram[sparseValValue(op)] += n
+			index += n
+			p++
+		}
+	}
+	return index == hllM
+}
+
+// registers returns the value of every register.
+func (hll *HyperLogLog) registers(out *[hllM]uint8) {
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+
+	if hll.data[4] == hllDense {
+		registers := hll.data[hllHeaderSize:]
+		for i := range out {
+			out[i] = max(out[i], denseGet(registers, i))
+		}
+		return
+	}
+	sparse := hll.data[hllHeaderSize:]
+	index := 0
+	for p := 0; p < len(sparse); {
+		op := sparse[p]
+		switch {
+		case sparseIsZero(op):
+			index += sparseZeroLen(op)
+			p++
+		case sparseIsXZero(op):
+			index += sparseXZeroLen(op, sparse[p+1])
+			p += 2
+		default:
+			n, v := sparseValLen(op), sparseValValue(op)
+			for i := 0; i < n && index < hllM; i++ {
+				out[index] = max(out[index], v)
+				index++
+			}
+			p++
 		}
 	}
-	return 1.0 - float64(nonZero)/float64(len(registers))
 }
 
-func countNonZeroRegisters(registers []byte) int {
-	count := 0
-	for _, reg := range registers {
-		if reg != 0 {
-			count++
+// Count returns the estimated cardinality. The estimate is cached in the
+// header until the next change.
+func (hll *HyperLogLog) Count() uint64 {
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+
+	if hll.data[15]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(hll.data[8:])
+	}
+
+	var histogram [64]int
+	if hll.data[4] == hllDense {
+		registers := hll.data[hllHeaderSize:]
+		for i := 0; i < hllM; i++ {
+			histogram[denseGet(registers, i)]++
 		}
+	} else {
+		sparseHistogram(hll.data[hllHeaderSize:], &histogram)
 	}
+	count := hllEstimate(&histogram)
+	binary.LittleEndian.PutUint64(hll.data[8:], count)
 	return count
 }
+
+// CountMerged returns the estimated cardinality of the union of hlls
+// without modifying them.
+func CountMerged(hlls ...*HyperLogLog) uint64 {
+	var registers [hllM]uint8
+	for _, hll := range hlls {
+		hll.registers(&registers)
+	}
+	var histogram [64]int
+	for _, v := range registers {
+		histogram[v]++
+	}
+	return hllEstimate(&histogram)
+}
+
+// hllEstimate is the improved estimator of Otmar Ertl, "New cardinality
+// estimation algorithms for HyperLogLog sketches", computed from the
+// histogram of the register values.
+func hllEstimate(histogram *[64]int) uint64 {
+	m := float64(hllM)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// Merge sets every register to its maximum over this HyperLogLog and
+// others. Like PFMERGE the result is dense if any input is.
+func (hll *HyperLogLog) Merge(others ...*HyperLogLog) {
+	var registers [hllM]uint8
+	dense := false
+	for _, other := range append([]*HyperLogLog{hll}, others...) {
+		other.registers(&registers)
+		other.mu.Lock()
+		dense = dense || other.data[4] == hllDense
+		other.mu.Unlock()
+	}
+
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+	if dense {
+		hll.toDense()
+	}
+	for i, v := range registers {
+		if v > 0 {
+			hll.set(i, v)
+		}
+	}
+	hll.invalidateCache()
+}
+
+// Debug returns internal state for debugging
+func (hll *HyperLogLog) Debug() map[string]interface{} {
+	var registers [hllM]uint8
+	hll.registers(&registers)
+
+	hll.mu.Lock()
+	defer hll.mu.Unlock()
+	encoding := "sparse"
+	if hll.data[4] == hllDense {
+		encoding = "dense"
+	}
+	nonZero := 0
+	for _, v := range registers {
+		if v != 0 {
+			nonZero++
+		}
+	}
+	return map[string]interface{}{
+		"encoding":    encoding,
+		"size":        len(hll.data),
+		"regwidth":    hllBits,
+		"sparseness":  1.0 - float64(nonZero)/hllM,
+		"nonZeroRegs": nonZero,
+	}
+}
@@ -0,0 +1,716 @@
+package models
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// quickListSizeLimits are the node sizes in bytes selected by the negative
+// fill factors -1 to -5
+var quickListSizeLimits = [...]int{4096, 8192, 16384, 32768, 65536}
+
+const (
+	// DefaultListMaxListpackSize is the default fill factor: 8 kb nodes
+	DefaultListMaxListpackSize = -2
+	// quickListSafetyLimit caps the node size of positive fill factors
+	quickListSafetyLimit = 8192
+	// quickListMinCompress is the size below which nodes are not worth
+	// compressing
+	quickListMinCompress = 48
+)
+
+// QuickList is a list stored like Redis stores lists: a doubly linked list
+// of nodes, each packing several elements into one byte slice. Pushes and
+// pops at both ends are O(1), and indexing skips whole nodes. It is not
+// safe for concurrent use.
+//
+// The fill factor bounds the nodes as list-max-listpack-size does: a
+// positive one is a number of elements, -1 to -5 a size of 4 kb to 64 kb.
+// With a compress depth of n, as list-compress-depth, all but the n nodes
+// at each end are kept compressed.
+type QuickList struct {
+	head, tail *quickListNode
+	count      int
+	nodes      int
+	fill       int
+	depth      int
+}
+
+// quickListNode holds its elements packed listpack style: each is its
+// length as a uvarint, its bytes, then the size of both as a uvarint
+// stored backwards, so the packed slice can be walked from either end.
+type quickListNode struct {
+	prev, next *quickListNode
+	// entries holds the packed elements, deflated if compressed
+	entries    []byte
+	count      int
+	size       int // size of the packed elements
+	compressed bool
+}
+
+// NewQuickList returns an empty list with the given fill factor and
+// compress depth. A zero fill factor selects the default.
+func NewQuickList(fill, compressDepth int) *QuickList {
+	if fill == 0 {
+		fill = DefaultListMaxListpackSize
+	}
+	if fill < -len(quickListSizeLimits) {
+		fill = -len(quickListSizeLimits)
+	}
+	if compressDepth < 0 {
+		compressDepth = 0
+	}
+	return &QuickList{fill: fill, depth: compressDepth}
+}
+
+// Len returns the number of elements.
+func (l *QuickList) Len() int {
+	return l.count
+}
+
+// Nodes returns the number of nodes.
+func (l *QuickList) Nodes() int {
+	return l.nodes
+}
+
+// PushFront inserts value at the head of the list.
+func (l *QuickList) PushFront(value string) {
+	entry := appendEntry(nil, value)
+	if h := l.head; h != nil && l.fits(h.count+1, h.size+len(entry)) {
+		h.decompress()
+		h.entries = append(entry, h.entries...)
+		h.count++
+		h.size += len(entry)
+	} else {
+		l.linkAfter(nil, &quickListNode{entries: entry, count: 1, size: len(entry)})
+		l.recompress(nil)
+	}
+	l.count++
+}
+
+// PushBack inserts value at the tail of the list.
+func (l *QuickList) PushBack(value string) {
+	if t := l.tail; t != nil && l.fits(t.count+1, t.size+entrySize(value)) {
+		t.decompress()
+		t.entries = appendEntry(t.entries, value)
+		t.count++
+		t.size = len(t.entries)
+	} else {
+		entry := appendEntry(nil, value)
+		l.linkAfter(l.tail, &quickListNode{entries: entry, count: 1, size: len(entry)})
+		l.recompress(nil)
+	}
+	l.count++
+}
+
+// PopFront removes and returns the head of the list.
+func (l *QuickList) PopFront() (string, bool) {
+	h := l.head
+	if h == nil {
+		return "", false
+	}
+	h.decompress()
+	value, next := readEntry(h.entries, 0)
+	h.entries = h.entries[next:]
+	h.count--
+	h.size -= next
+	l.count--
+	if h.count == 0 {
+		l.unlink(h)
+		l.recompress(nil)
+	}
+	return value, true
+}
+
+// PopBack removes and returns the tail of the list.
+func (l *QuickList) PopBack() (string, bool) {
+	t := l.tail
+	if t == nil {
+		return "", false
+	}
+	t.decompress()
+	start := prevEntry(t.entries, len(t.entries))
+	value, _ := readEntry(t.entries, start)
+	t.entries = t.entries[:start]
+	t.count--
+	t.size = start
+	l.count--
+	if t.count == 0 {
+		l.unlink(t)
+		l.recompress(nil)
+	}
+	return value, true
+}
+
+// Index returns the element at index, counting from the tail if negative.
+func (l *QuickList) Index(index int) (string, bool) {
+	index, ok := l.normalize(index)
+	if !ok {
+		return "", false
+	}
+	n, i := l.locate(index)
+	buf := n.raw()
+	value, _ := readEntry(buf, entryOffset(buf, n.count, i))
+	return value, true
+}
+
+// Set replaces the element at index, counting from the tail if negative.
+// It reports whether index is in range.
+func (l *QuickList) Set(index int, value string) bool {
+	index, ok := l.normalize(index)
+	if !ok {
+		return false
+	}
+	n, i := l.locate(index)
+	n.decompress()
+	start := entryOffset(n.entries, n.count, i)
+	n.entries = splice(n.entries, start, nextEntry(n.entries, start), appendEntry(nil, value))
+	n.size = len(n.entries)
+	l.split(n)
+	l.recompress(n)
+	return true
+}
+
+// Range returns the elements from start to stop included, with the
+// semantics of LRANGE for negative and out of range indexes.
+func (l *QuickList) Range(start, stop int) []string {
+	start, stop, ok := l.clamp(start, stop)
+	if !ok {
+		return []string{}
+	}
+
+	result := make([]string, 0, stop-start+1)
+	n, i := l.locate(start)
+	buf := n.raw()
+	p := entryOffset(buf, n.count, i)
+	for len(result) < cap(result) {
+		if i == n.count {
+			n, i, p = n.next, 0, 0
+			buf = n.raw()
+		}
+		var value string
+		value, p = readEntry(buf, p)
+		result = append(result, value)
+		i++
+	}
+	return result
+}
+
+// Insert inserts values before or after the first occurrence of pivot and
+// reports whether pivot was found.
+func (l *QuickList) Insert(pivot string, values []string, before bool) bool {
+	for n := l.head; n != nil; n = n.next {
+		buf := n.raw()
+		for i, p := 0, 0; i < n.count; i++ {
+			next := nextEntry(buf, p)
+			if !entryEquals(buf, p, pivot) {
+				p = next
+				continue
+			}
+
+			at := next
+			if before {
+				at = p
+			}
+			var chunk []byte
+			for _, value := range values {
+				chunk = appendEntry(chunk, value)
+			}
+			n.entries = splice(buf, at, at, chunk)
+			n.compressed = false
+			n.count += len(values)
+			n.size = len(n.entries)
+			l.count += len(values)
+			l.split(n)
+			l.recompress(n)
+			return true
+		}
+	}
+	return false
+}
+
+// Remove removes the elements equal to value, as LREM does: the first
+// count of them from the head if count is positive, the last -count from
+// the tail if it is negative, and all of them if it is zero. It returns the
+// number of elements removed.
+func (l *QuickList) Remove(count int, value string) int {
+	limit, fromTail := count, false
+	if count < 0 {
+		limit, fromTail = -count, true
+	}
+
+	removed := 0
+	n := l.head
+	if fromTail {
+		n = l.tail
+	}
+	for n != nil && (limit == 0 || removed < limit) {
+		next := n.next
+		if fromTail {
+			next = n.prev
+		}
+
+		buf := n.raw()
+		var matches []int
+		for i, p := 0, 0; i < n.count; i++ {
+			if entryEquals(buf, p, value) {
+				matches = append(matches, p)
+			}
+			p = nextEntry(buf, p)
+		}
+		if limit > 0 && len(matches) > limit-removed {
+			if fromTail {
+				matches = matches[len(matches)-(limit-removed):]
+			} else {
+				matches = matches[:limit-removed]
+			}
+		}
+
+		if len(matches) > 0 {
+			entries := make([]byte, 0, len(buf))
+			last := 0
+			for _, p := range matches {
+				entries = append(entries, buf[last:p]...)
+				last = nextEntry(buf, p)
+			}
+			entries = append(entries, buf[last:]...)
+
+			n.entries, n.compressed = entries, false
+			n.count -= len(matches)
+			n.size = len(entries)
+			l.count -= len(matches)
+			removed += len(matches)
+			if n.count == 0 {
+				l.unlink(n)
+			} else {
+				l.recompress(n)
+			}
+		}
+		n = next
+	}
+	l.recompress(nil)
+	return removed
+}
+
+// Trim keeps the elements from start to stop included, with the semantics
+// of LTRIM.
+func (l *QuickList) Trim(start, stop int) {
+	start, stop, ok := l.clamp(start, stop)
+	if !ok {
+		l.head, l.tail, l.count, l.nodes = nil, nil, 0, 0
+		return
+	}
+	l.trimBack(l.count - 1 - stop)
+	l.trimFront(start)
+	l.recompress(nil)
+}
+
+// trimFront removes the first k elements.
+func (l *QuickList) trimFront(k int) {
+	for k > 0 {
+		h := l.head
+		if k >= h.count {
+			k -= h.count
+			l.count -= h.count
+			l.unlink(h)
+			continue
+		}
+		h.decompress()
+		p := entryOffset(h.entries, h.count, k)
+		h.entries = append([]byte(nil), h.entries[p:]...)
+		h.count -= k
+		h.size = len(h.entries)
+		l.count -= k
+		return
+	}
+}
+
+// trimBack removes the last k elements.
+func (l *QuickList) trimBack(k int) {
+	for k > 0 {
+		t := l.tail
+		if k >= t.count {
+			k -= t.count
+			l.count -= t.count
+			l.unlink(t)
+			continue
+		}
+		t.decompress()
+		p := entryOffset(t.entries, t.count, t.count-k)
+		t.entries = t.entries[:p:p]
+		t.count -= k
+		t.size = p
+		l.count -= k
+		return
+	}
+}
+
+// Pos returns the index of the first element equal to value.
+func (l *QuickList) Pos(value string) (int, bool) {
+	index := 0
+	for n := l.head; n != nil; n = n.next {
+		buf := n.raw()
+		for i, p := 0, 0; i < n.count; i++ {
+			if entryEquals(buf, p, value) {
+				return index + i, true
+			}
+			p = nextEntry(buf, p)
+		}
+		index += n.count
+	}
+	return 0, false
+}
+
+// Clone returns a deep copy of the list.
+func (l *QuickList) Clone() *QuickList {
+	clone := &QuickList{fill: l.fill, depth: l.depth}
+	for n := l.head; n != nil; n = n.next {
+		clone.linkAfter(clone.tail, &quickListNode{
+			entries:    append([]byte(nil), n.entries...),
+			count:      n.count,
+			size:       n.size,
+			compressed: n.compressed,
+		})
+	}
+	clone.count = l.count
+	return clone
+}
+
+// Compact merges neighbouring nodes that fit in one, such as those left
+// half empty by removals inside the list.
+func (l *QuickList) Compact() {
+	for n := l.head; n != nil && n.next != nil; {
+		next := n.next
+		if !l.fits(n.count+next.count, n.size+next.size) {
+			n = next
+			continue
+		}
+		entries := make([]byte, 0, n.size+next.size)
+		entries = append(entries, n.raw()...)
+		entries = append(entries, next.raw()...)
+		n.entries, n.compressed = entries, false
+		n.count += next.count
+		n.size = len(entries)
+		l.unlink(next)
+	}
+
+	i := 0
+	for n := l.head; n != nil; n = n.next {
+		if l.depth > 0 && i >= l.depth && i < l.nodes-l.depth {
+			n.compress()
+		} else {
+			n.decompress()
+		}
+		i++
+	}
+}
+
+// SizeInBytes estimates the memory used by the list.
+func (l *QuickList) SizeInBytes() int64 {
+	size := int64(64)
+	for n := l.head; n != nil; n = n.next {
+		size += 64 + int64(cap(n.entries))
+	}
+	return size
+}
+
+// fits reports whether a node of count elements packed in size bytes
+// respects the fill factor. A single element always fits.
+func (l *QuickList) fits(count, size int) bool {
+	if count <= 1 {
+		return true
+	}
+	if l.fill > 0 {
+		return count <= l.fill && size <= quickListSafetyLimit
+	}
+	return size <= quickListSizeLimits[-l.fill-1]
+}
+
+// split halves n until its parts respect the fill factor.
+func (l *QuickList) split(n *quickListNode) {
+	if l.fits(n.count, n.size) {
+		return
+	}
+	mid := n.count / 2
+	p := entryOffset(n.entries, n.count, mid)
+	second := &quickListNode{
+		entries: append([]byte(nil), n.entries[p:]...),
+		count:   n.count - mid,
+		size:    n.size - p,
+	}
+	n.entries = n.entries[:p:p]
+	n.count = mid
+	n.size = p
+	l.linkAfter(n, second)
+
+	l.split(n)
+	l.split(second)
+	l.recompress(n)
+	l.recompress(second)
+}
+
+// recompress restores the compression of the nodes after changed, which
+// may be nil, was modified or nodes were added or removed: the depth nodes
+// at each end are decompressed, the next ones compressed.
+func (l *QuickList) recompress(changed *quickListNode) {
+	if l.depth == 0 {
+		return
+	}
+
+	interior := changed != nil
+	front, back := l.head, l.tail
+	for i := 0; i < l.depth && front != nil; i++ {
+		if front == changed {
+			interior = false
+		}
+		front.decompress()
+		front = front.next
+	}
+	for i := 0; i < l.depth && back != nil; i++ {
+		if back == changed {
+			interior = false
+		}
+		back.decompress()
+		back = back.prev
+	}
+
+	if l.nodes <= 2*l.depth {
+		return
+	}
+	front.compress()
+	back.compress()
+	if interior {
+		changed.compress()
+	}
+}
+
+// normalize converts a possibly negative index to its position from the
+// head, reporting whether it is in range.
+func (l *QuickList) normalize(index int) (int, bool) {
+	if index < 0 {
+		index += l.count
+	}
+	return index, index >= 0 && index < l.count
+}
+
+// clamp converts a start and stop range as LRANGE takes it to positions
+// from the head, reporting whether the range is not empty.
+func (l *QuickList) clamp(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += l.count
+	}
+	if stop < 0 {
+		stop += l.count
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= l.count {
+		stop = l.count - 1
+	}
+	return start, stop, start <= stop
+}
+
+// locate returns the node holding the element at index, and the position
+// of the element in the node, walking from the nearest end.
+func (l *QuickList) locate(index int) (*quickListNode, int) {
+	if index < l.count/2 {
+		n := l.head
+		for index >= n.count {
+			index -= n.count
+			n = n.next
+		}
+		return n, index
+	}
+	back := l.count - 1 - index
+	n := l.tail
+	for back >= n.count {
+		back -= n.count
+		n = n.prev
+	}
+	return n, n.count - 1 - back
+}
+
+// linkAfter links n after prev, or at the head if prev is nil.
+func (l *QuickList) linkAfter(prev, n *quickListNode) {
+	n.prev = prev
+	if prev == nil {
+		n.next = l.head
+		l.head = n
+	} else {
+		n.next = prev.next
+		prev.next = n
+	}
+	if n.next == nil {
+		l.tail = n
+	} else {
+		n.next.prev = n
+	}
+	l.nodes++
+}
+
+func (l *QuickList) unlink(n *quickListNode) {
+	if n.prev == nil {
+		l.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		l.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev, n.next = nil, nil
+	l.nodes--
+}
+
+// raw returns the packed elements of the node, decompressing them into a
+// new slice if needed.
+func (n *quickListNode) raw() []byte {
+	if !n.compressed {
+		return n.entries
+	}
+	return inflate(n.entries, n.size)
+}
+
+func (n *quickListNode) decompress() {
+	if n.compressed {
+		n.entries, n.compressed = inflate(n.entries, n.size), false
+	}
+}
+
+// compress deflates the node, unless that does not make it smaller.
+func (n *quickListNode) compress() {
+	if n.compressed || n.size < quickListMinCompress {
+		return
+	}
+	if packed := deflate(n.entries); len(packed) < n.size {
+		n.entries, n.compressed = packed, true
+	}
+}
+
+// appendEntry packs value at the end of buf.
+func appendEntry(buf []byte, value string) []byte {
+	start := len(buf)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	buf = append(buf, value...)
+
+	var backlen [binary.MaxVarintLen64]byte
+	k := binary.PutUvarint(backlen[:], uint64(len(buf)-start))
+	for i := k - 1; i >= 0; i-- {
+		buf = append(buf, backlen[i])
+	}
+	return buf
+}
+
+// entrySize returns the packed size of value.
+func entrySize(value string) int {
+	size := uvarintLen(uint64(len(value))) + len(value)
+	return size + uvarintLen(uint64(size))
+}
+
+// readEntry returns the element packed at p and the position of the next.
+func readEntry(buf []byte, p int) (string, int) {
+	n, k := binary.Uvarint(buf[p:])
+	end := p + k + int(n)
+	return string(buf[p+k : end]), end + uvarintLen(uint64(k)+n)
+}
+
+// entryEquals reports whether the element packed at p is value.
+func entryEquals(buf []byte, p int, value string) bool {
+	n, k := binary.Uvarint(buf[p:])
+	return int(n) == len(value) && string(buf[p+k:p+k+int(n)]) == value
+}
+
+// nextEntry returns the position of the element after the one at p.
+func nextEntry(buf []byte, p int) int {
+	n, k := binary.Uvarint(buf[p:])
+	size := uint64(k) + n
+	return p + int(size) + uvarintLen(size)
+}
+
+// prevEntry returns the position of the element ending at p.
+func prevEntry(buf []byte, p int) int {
+	var size uint64
+	i, shift := p-1, 0
+	for {
+		b := buf[i]
+		size |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		i--
+		shift += 7
+	}
+	return i - int(size)
+}
+
+// entryOffset returns the position of the element at index among the
+// count packed in buf, walking from the nearest end.
+func entryOffset(buf []byte, count, index int) int {
+	if index < count/2 {
+		p := 0
+		for ; index > 0; index-- {
+			p = nextEntry(buf, p)
+		}
+		return p
+	}
+	p := len(buf)
+	for i := count; i > index; i-- {
+		p = prevEntry(buf, p)
+	}
+	return p
+}
+
+// splice returns a copy of buf with buf[start:end] replaced by insert.
+func splice(buf []byte, start, end int, insert []byte) []byte {
+	result := make([]byte, 0, len(buf)-(end-start)+len(insert))
+	result = append(result, buf[:start]...)
+	result = append(result, insert...)
+	return append(result, buf[end:]...)
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+var (
+	flateWriters = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}}
+	flateReaders sync.Pool
+)
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	w.Write(data)
+	w.Close()
+	flateWriters.Put(w)
+	return buf.Bytes()
+}
+
+// inflate decompresses data, which deflate produced from size bytes.
+func inflate(data []byte, size int) []byte {
+	src := bytes.NewReader(data)
+	r, _ := flateReaders.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(src)
+	} else {
+		r.(flate.Resetter).Reset(src, nil)
+	}
+	result := make([]byte, size)
+	io.ReadFull(r, result)
+	flateReaders.Put(r)
+	return result
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkQuickList compares l to the expected elements and checks its nodes
+func checkQuickList(t *testing.T, l *QuickList, expected []string) {
+	t.Helper()
+	require.Equal(t, len(expected), l.Len())
+	if len(expected) == 0 {
+		require.Equal(t, []string{}, l.Range(0, -1))
+		require.Equal(t, 0, l.Nodes())
+		return
+	}
+	require.Equal(t, expected, l.Range(0, -1))
+
+	count, nodes := 0, 0
+	var prev *quickListNode
+	for n := l.head; n != nil; n = n.next {
+		require.Same(t, prev, n.prev)
+		require.Positive(t, n.count)
+		require.True(t, l.fits(n.count, n.size), "node of %d elements in %d bytes", n.count, n.size)
+		if !n.compressed {
+			require.Len(t, n.entries, n.size)
+		}
+		count += n.count
+		nodes++
+		prev = n
+	}
+	require.Same(t, prev, l.tail)
+	require.Equal(t, len(expected), count)
+	require.Equal(t, nodes, l.Nodes())
+}
+
+func randomValue(r *rand.Rand) string {
+	if r.Intn(20) == 0 {
+		return strings.Repeat("v", 100+r.Intn(3000))
+	}
+	return strconv.Itoa(r.Intn(50))
+}
+
+func TestQuickListPushPop(t *testing.T) {
+	l := NewQuickList(-1, 0)
+	var expected []string
+	for i := 0; i < 5000; i++ {
+		l.PushBack("b" + strconv.Itoa(i))
+		l.PushFront("f" + strconv.Itoa(i))
+		expected = append([]string{"f" + strconv.Itoa(i)}, expected...)
+		expected = append(expected, "b"+strconv.Itoa(i))
+	}
+	checkQuickList(t, l, expected)
+	assert.Greater(t, l.Nodes(), 1)
+
+	for len(expected) > 0 {
+		value, ok := l.PopFront()
+		require.True(t, ok)
+		require.Equal(t, expected[0], value)
+		value, ok = l.PopBack()
+		require.True(t, ok)
+		require.Equal(t, expected[len(expected)-1], value)
+		expected = expected[1 : len(expected)-1]
+	}
+	checkQuickList(t, l, nil)
+	_, ok := l.PopFront()
+	assert.False(t, ok)
+	_, ok = l.PopBack()
+	assert.False(t, ok)
+}
+
+func TestQuickListFill(t *testing.T) {
+	l := NewQuickList(3, 0)
+	for i := 0; i < 10; i++ {
+		l.PushBack(strconv.Itoa(i))
+	}
+	assert.Equal(t, 4, l.Nodes())
+
+	// A single element larger than the node size still gets its own node
+	l = NewQuickList(-1, 0)
+	l.PushBack(strings.Repeat("x", 10000))
+	l.PushBack("a")
+	l.PushFront("b")
+	assert.Equal(t, 3, l.Nodes())
+	assert.Equal(t, "a", l.Range(-1, -1)[0])
+}
+
+func TestQuickListCompression(t *testing.T) {
+	l := NewQuickList(-1, 1)
+	var expected []string
+	for i := 0; i < 2000; i++ {
+		value := strings.Repeat(strconv.Itoa(i%10), 100)
+		l.PushBack(value)
+		expected = append(expected, value)
+	}
+
+	compressed := 0
+	for n := l.head; n != nil; n = n.next {
+		if n.compressed {
+			compressed++
+		}
+	}
+	assert.False(t, l.head.compressed)
+	assert.False(t, l.tail.compressed)
+	assert.Equal(t, l.Nodes()-2, compressed)
+	checkQuickList(t, l, expected)
+
+	value, ok := l.Index(1000)
+	require.True(t, ok)
+	assert.Equal(t, expected[1000], value)
+	assert.Less(t, l.SizeInBytes(), int64(2000*100/2))
+}
+
+func TestQuickListOperations(t *testing.T) {
+	l := NewQuickList(0, 0)
+	for _, value := range []string{"a", "b", "c", "b", "d"} {
+		l.PushBack(value)
+	}
+
+	assert.True(t, l.Insert("b", []string{"x"}, true))
+	assert.True(t, l.Insert("d", []string{"y", "z"}, false))
+	assert.False(t, l.Insert("missing", []string{"x"}, true))
+	checkQuickList(t, l, []string{"a", "x", "b", "c", "b", "d", "y", "z"})
+
+	assert.Equal(t, 1, l.Remove(-1, "b"))
+	checkQuickList(t, l, []string{"a", "x", "b", "c", "d", "y", "z"})
+
+	assert.True(t, l.Set(-1, "last"))
+	assert.False(t, l.Set(7, "none"))
+	pos, ok := l.Pos("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, pos)
+
+	l.Trim(1, -2)
+	checkQuickList(t, l, []string{"x", "b", "c", "d", "y"})
+	assert.Equal(t, []string{"c", "d"}, l.Range(-3, -2))
+	assert.Equal(t, []string{}, l.Range(3, 1))
+
+	clone := l.Clone()
+	l.Trim(5, 10)
+	checkQuickList(t, l, nil)
+	checkQuickList(t, clone, []string{"x", "b", "c", "d", "y"})
+}
+
+// TestQuickListRandom runs random operations against a slice
+func TestQuickListRandom(t *testing.T) {
+	for _, config := range [][2]int{{-1, 0}, {-2, 1}, {4, 0}, {5, 2}, {-5, 3}} {
+		r := rand.New(rand.NewSource(int64(config[0]*10 + config[1])))
+		l := NewQuickList(config[0], config[1])
+		var expected []string
+
+		for i := 0; i < 5000; i++ {
+			value := randomValue(r)
+			index := 0
+			if len(expected) > 0 {
+				index = r.Intn(len(expected)*2) - len(expected)
+			}
+			switch r.Intn(11) {
+			case 0, 1:
+				l.PushBack(value)
+				expected = append(expected, value)
+			case 2, 3:
+				l.PushFront(value)
+				expected = append([]string{value}, expected...)
+			case 4:
+				got, ok := l.PopFront()
+				require.Equal(t, len(expected) > 0, ok)
+				if ok {
+					require.Equal(t, expected[0], got)
+					expected = expected[1:]
+				}
+			case 5:
+				got, ok := l.PopBack()
+				require.Equal(t, len(expected) > 0, ok)
+				if ok {
+					require.Equal(t, expected[len(expected)-1], got)
+					expected = expected[:len(expected)-1]
+				}
+			case 6:
+				require.Equal(t, len(expected) > 0, l.Set(index, value))
+				if len(expected) > 0 {
+					if index < 0 {
+						index += len(expected)
+					}
+					expected[index] = value
+				}
+			case 7:
+				pivot := strconv.Itoa(r.Intn(50))
+				before := r.Intn(2) == 0
+				at := -1
+				for j, e := range expected {
+					if e == pivot {
+						at = j
+						break
+					}
+				}
+				require.Equal(t, at >= 0, l.Insert(pivot, []string{value}, before))
+				if at >= 0 {
+					if !before {
+						at++
+					}
+					expected = append(expected[:at], append([]string{value}, expected[at:]...)...)
+				}
+			case 8:
+				target := strconv.Itoa(r.Intn(50))
+				count := r.Intn(5) - 2
+				removed := 0
+				var kept []string
+				if count >= 0 {
+					for _, e := range expected {
+						if e == target && (count == 0 || removed < count) {
+							removed++
+							continue
+						}
+						kept = append(kept, e)
+					}
+				} else {
+					for j := len(expected) - 1; j >= 0; j-- {
+						if expected[j] == target && removed < -count {
+							removed++
+							continue
+						}
+						kept = append([]string{expected[j]}, kept...)
+					}
+				}
+				require.Equal(t, removed, l.Remove(count, target))
+				expected = kept
+			case 9:
+				if r.Intn(10) == 0 {
+					start := r.Intn(len(expected)+2) - 1
+					stop := len(expected) - r.Intn(len(expected)+2)
+					l.Trim(start, stop)
+					expected = trimSlice(expected, start, stop)
+				}
+			case 10:
+				start := r.Intn(len(expected)+4) - 2
+				stop := r.Intn(len(expected)+4) - 2
+				require.Equal(t, trimSlice(expected, start, stop), l.Range(start, stop))
+				if len(expected) > 0 {
+					got, ok := l.Index(index)
+					require.True(t, ok)
+					if index < 0 {
+						index += len(expected)
+					}
+					require.Equal(t, expected[index], got)
+				}
+			}
+			if i%100 == 0 {
+				checkQuickList(t, l, expected)
+			}
+		}
+		checkQuickList(t, l, expected)
+		l.Compact()
+		checkQuickList(t, l, expected)
+	}
+}
+
+// trimSlice returns the elements of s from start to stop as LRANGE does
+func trimSlice(s []string, start, stop int) []string {
+	if start < 0 {
+		start += len(s)
+	}
+	if stop < 0 {
+		stop += len(s)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= len(s) {
+		stop = len(s) - 1
+	}
+	if start > stop {
+		return []string{}
+	}
+	return append([]string{}, s[start:stop+1]...)
+}
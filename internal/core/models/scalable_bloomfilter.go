@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// BloomDefaultCapacity, BloomDefaultErrorRate and BloomDefaultExpansion
+	// are used for filters created implicitly by BF.ADD and BF.INSERT.
+	BloomDefaultCapacity  = 100
+	BloomDefaultErrorRate = 0.01
+	BloomDefaultExpansion = 2
+
+	// bloomTighteningRatio scales the error rate of every added layer, so
+	// the compound error rate stays below twice the requested one.
+	bloomTighteningRatio = 0.5
+
+	bloomDumpVersion    = 1
+	bloomDumpHeaderSize = 10
+	bloomDumpLayerSize  = 36
+)
+
+// ErrBloomFilterFull is returned when adding to a full non-scaling filter.
+var ErrBloomFilterFull = fmt.Errorf("ERR non scaling filter is full")
+
+// BloomFilterOptions configures a scalable Bloom filter.
+type BloomFilterOptions struct {
+	Capacity   uint
+	ErrorRate  float64
+	Expansion  uint
+	NonScaling bool
+}
+
+// DefaultBloomFilterOptions returns the options of implicitly created
+// filters.
+func DefaultBloomFilterOptions() BloomFilterOptions {
+	return BloomFilterOptions{
+		Capacity:  BloomDefaultCapacity,
+		ErrorRate: BloomDefaultErrorRate,
+		Expansion: BloomDefaultExpansion,
+	}
+}
+
+// BloomInfo represents information about a scalable Bloom filter
+type BloomInfo struct {
+	Capacity  uint64
+	Size      int64
+	Filters   int
+	Items     uint64
+	Expansion uint
+}
+
+// ScalableBloomFilter is a chain of Bloom filters. Items go into the
+// newest layer; once it holds its capacity a layer Expansion times larger
+// with half the error rate is appended, so the false positive rate stays
+// bounded however many items are added. A non-scaling filter refuses new
+// items instead.
+type ScalableBloomFilter struct {
+	mu         sync.RWMutex
+	layers     []*BloomFilter
+	expansion  uint
+	nonScaling bool
+}
+
+// NewScalableBloomFilter creates a scalable Bloom filter with one layer.
+func NewScalableBloomFilter(opts BloomFilterOptions) *ScalableBloomFilter {
+	sb := &ScalableBloomFilter{expansion: opts.Expansion, nonScaling: opts.NonScaling}
+	if sb.expansion == 0 {
+		sb.expansion = BloomDefaultExpansion
+	}
+	sb.layers = []*BloomFilter{NewBloomFilter(BloomFilterConfig{
+		ExpectedItems:     opts.Capacity,
+		FalsePositiveRate: opts.ErrorRate,
+	})}
+	return sb
+}
+
+// Add inserts item and reports whether it was not already present.
+func (sb *ScalableBloomFilter) Add(item []byte) (bool, error) {
+	h1, h2 := bloomHashes(item)
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.contains(h1, h2) {
+		return false, nil
+	}
+	last := sb.layers[len(sb.layers)-1]
+	if last.count >= uint64(last.config.ExpectedItems) {
+		if sb.nonScaling {
+			return false, ErrBloomFilterFull
+		}
+		last = NewBloomFilter(BloomFilterConfig{
+			ExpectedItems:     last.config.ExpectedItems * sb.expansion,
+			FalsePositiveRate: last.config.FalsePositiveRate * bloomTighteningRatio,
+		})
+		sb.layers = append(sb.layers, last)
+	}
+	last.setHashes(h1, h2)
+	return true, nil
+}
+
+// Contains reports whether item may have been added.
+func (sb *ScalableBloomFilter) Contains(item []byte) bool {
+	h1, h2 := bloomHashes(item)
+
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.contains(h1, h2)
+}
+
+func (sb *ScalableBloomFilter) contains(h1, h2 uint64) bool {
+	// Newer layers are larger and hold the more recent items
+	for i := len(sb.layers) - 1; i >= 0; i-- {
+		if sb.layers[i].testHashes(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of items added.
+func (sb *ScalableBloomFilter) Count() uint64 {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	count := uint64(0)
+	for _, layer := range sb.layers {
+		count += layer.count
+	}
+	return count
+}
+
+// Info returns information about the filter
+func (sb *ScalableBloomFilter) Info() BloomInfo {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	info := BloomInfo{Filters: len(sb.layers), Size: sb.memoryUsage()}
+	for _, layer := range sb.layers {
+		info.Capacity += uint64(layer.config.ExpectedItems)
+		info.Items += layer.count
+	}
+	if !sb.nonScaling {
+		info.Expansion = sb.expansion
+	}
+	return info
+}
+
+// GetMemoryUsage returns an estimation of memory usage in bytes
+func (sb *ScalableBloomFilter) GetMemoryUsage() int64 {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+	return sb.memoryUsage()
+}
+
+func (sb *ScalableBloomFilter) memoryUsage() int64 {
+	size := int64(unsafe.Sizeof(*sb))
+	for _, layer := range sb.layers {
+		size += int64(unsafe.Sizeof(*layer)) + int64(len(layer.bitset))*8
+	}
+	return size
+}
+
+// ScanDump returns the chunk of the serialized filter following iter and
+// the iterator to pass next; 0 means the dump is complete. The first
+// chunk is a header describing the layers, the following ones are at most
+// maxChunk bytes of the layer bitsets in order.
+func (sb *ScalableBloomFilter) ScanDump(iter uint64, maxChunk int) (uint64, []byte) {
+	sb.mu.RLock()
+	defer sb.mu.RUnlock()
+
+	if iter == 0 {
+		return 1, sb.header()
+	}
+
+	offset := uint(iter - 1)
+	var chunk []byte
+	start := uint(0)
+	for _, layer := range sb.layers {
+		end := start + layer.byteSize()
+		if offset < end && len(chunk) < maxChunk {
+			from := max(offset, start) - start
+			to := min(end-start, from+uint(maxChunk-len(chunk)))
+			chunk = layer.readBits(chunk, from, to)
+		}
+		start = end
+	}
+	if len(chunk) == 0 {
+		return 0, nil
+	}
+	return iter + uint64(len(chunk)), chunk
+}
+
+// header layout, little endian: version (1), non-scaling flag (1),
+// expansion (4), layer count (4), then per layer capacity (8), error rate
+// (8), items (8), hash count (4) and bit count (8).
+func (sb *ScalableBloomFilter) header() []byte {
+	buf := make([]byte, bloomDumpHeaderSize, bloomDumpHeaderSize+len(sb.layers)*bloomDumpLayerSize)
+	buf[0] = bloomDumpVersion
+	if sb.nonScaling {
+		buf[1] = 1
+	}
+	binary.LittleEndian.PutUint32(buf[2:], uint32(sb.expansion))
+	binary.LittleEndian.PutUint32(buf[6:], uint32(len(sb.layers)))
+	for _, layer := range sb.layers {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(layer.config.ExpectedItems))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(layer.config.FalsePositiveRate))
+		buf = binary.LittleEndian.AppendUint64(buf, layer.count)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(layer.hashCount))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(layer.size))
+	}
+	return buf
+}
+
+// LoadScalableBloomHeader creates an empty filter from the header chunk of
+// a dump.
+func LoadScalableBloomHeader(data []byte) (*ScalableBloomFilter, error) {
+	if len(data) < bloomDumpHeaderSize || data[0] != bloomDumpVersion {
+		return nil, fmt.Errorf("ERR invalid bloom filter header")
+	}
+	numLayers := int(binary.LittleEndian.Uint32(data[6:]))
+	if numLayers == 0 || len(data) != bloomDumpHeaderSize+numLayers*bloomDumpLayerSize {
+		return nil, fmt.Errorf("ERR invalid bloom filter header")
+	}
+
+	sb := &ScalableBloomFilter{
+		nonScaling: data[1] == 1,
+		expansion:  uint(binary.LittleEndian.Uint32(data[2:])),
+		layers:     make([]*BloomFilter, numLayers),
+	}
+	if sb.expansion == 0 {
+		sb.expansion = BloomDefaultExpansion
+	}
+	for i := range sb.layers {
+		rec := data[bloomDumpHeaderSize+i*bloomDumpLayerSize:]
+		capacity := binary.LittleEndian.Uint64(rec)
+		errorRate := math.Float64frombits(binary.LittleEndian.Uint64(rec[8:]))
+		hashCount := binary.LittleEndian.Uint32(rec[24:])
+		size := binary.LittleEndian.Uint64(rec[28:])
+		if capacity == 0 || !(errorRate > 0 && errorRate < 1) || hashCount == 0 || size == 0 || size > 1<<40 {
+			return nil, fmt.Errorf("ERR invalid bloom filter header")
+		}
+		sb.layers[i] = &BloomFilter{
+			count:     binary.LittleEndian.Uint64(rec[16:]),
+			bitset:    make([]uint64, (size+63)/64),
+			size:      uint(size),
+			hashCount: uint(hashCount),
+			config:    BloomFilterConfig{ExpectedItems: uint(capacity), FalsePositiveRate: errorRate},
+		}
+	}
+	return sb, nil
+}
+
+// LoadChunk restores a bitset chunk returned by ScanDump together with
+// iter.
+func (sb *ScalableBloomFilter) LoadChunk(iter uint64, data []byte) error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if iter <= uint64(len(data)) {
+		return fmt.Errorf("ERR invalid iterator")
+	}
+	offset := uint(iter - 1 - uint64(len(data)))
+	start := uint(0)
+	for _, layer := range sb.layers {
+		end := start + layer.byteSize()
+		if offset < end && len(data) > 0 {
+			n := min(end-offset, uint(len(data)))
+			layer.writeBits(offset-start, data[:n])
+			data = data[n:]
+			offset += n
+		}
+		start = end
+	}
+	if len(data) > 0 {
+		return fmt.Errorf("ERR chunk exceeds the filter size")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScalableBloomFilterGrowth(t *testing.T) {
+	sb := NewScalableBloomFilter(BloomFilterOptions{Capacity: 1000, ErrorRate: 0.01, Expansion: 2})
+	const n = 20000
+	for i := 0; i < n; i++ {
+		_, err := sb.Add([]byte("item-" + strconv.Itoa(i)))
+		require.NoError(t, err)
+	}
+
+	info := sb.Info()
+	// 1000 + 2000 + 4000 + 8000 + 16000 holds the items
+	assert.Equal(t, 5, info.Filters)
+	assert.Equal(t, uint64(31000), info.Capacity)
+	assert.LessOrEqual(t, info.Items, uint64(n))
+	// Items already reported present are false positives and not counted
+	assert.Greater(t, info.Items, uint64(n*98/100))
+	assert.Equal(t, uint(2), info.Expansion)
+
+	for i := 0; i < n; i++ {
+		require.True(t, sb.Contains([]byte("item-"+strconv.Itoa(i))))
+	}
+	falsePositives := 0
+	for i := 0; i < 100000; i++ {
+		if sb.Contains([]byte("other-" + strconv.Itoa(i))) {
+			falsePositives++
+		}
+	}
+	// The tightening layers keep the compound rate under twice the target
+	assert.Less(t, float64(falsePositives)/100000, 0.02)
+}
+
+func TestScalableBloomFilterNonScaling(t *testing.T) {
+	sb := NewScalableBloomFilter(BloomFilterOptions{Capacity: 10, ErrorRate: 0.001, NonScaling: true})
+	for i := 0; i < 10; i++ {
+		added, err := sb.Add([]byte(strconv.Itoa(i)))
+		require.NoError(t, err)
+		require.True(t, added)
+	}
+	added, err := sb.Add([]byte("0"))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	_, err = sb.Add([]byte("new"))
+	assert.ErrorIs(t, err, ErrBloomFilterFull)
+	assert.Equal(t, uint(0), sb.Info().Expansion)
+}
+
+func TestScalableBloomFilterScanDump(t *testing.T) {
+	sb := NewScalableBloomFilter(BloomFilterOptions{Capacity: 100, ErrorRate: 0.01, Expansion: 3})
+	for i := 0; i < 1000; i++ {
+		_, _ = sb.Add([]byte(strconv.Itoa(i)))
+	}
+	require.Greater(t, sb.Info().Filters, 2)
+
+	iter, header := sb.ScanDump(0, 64)
+	restored, err := LoadScalableBloomHeader(header)
+	require.NoError(t, err)
+	chunks := 0
+	for {
+		var chunk []byte
+		iter, chunk = sb.ScanDump(iter, 64)
+		if iter == 0 {
+			break
+		}
+		require.LessOrEqual(t, len(chunk), 64)
+		require.NoError(t, restored.LoadChunk(iter, chunk))
+		chunks++
+	}
+	assert.Greater(t, chunks, 1)
+
+	assert.Equal(t, sb.Info(), restored.Info())
+	for i := 0; i < 2000; i++ {
+		item := []byte(strconv.Itoa(i))
+		require.Equal(t, sb.Contains(item), restored.Contains(item), "item %d", i)
+	}
+
+	_, err = LoadScalableBloomHeader(header[:len(header)-1])
+	assert.Error(t, err)
+	assert.Error(t, restored.LoadChunk(1<<30, []byte{1}))
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SetOptions holds the options of a SET command
+type SetOptions struct {
+	// NX only sets the key if it does not exist, XX only if it does
+	NX bool
+	XX bool
+	// Get returns the old string value, failing on keys of other types
+	Get bool
+	// KeepTTL retains the time to live of the key. Otherwise the key gets
+	// ExpireAt as its expiry, or none if it is zero.
+	KeepTTL  bool
+	ExpireAt time.Time
+}
+
+// SetResult is the outcome of a SET command
+type SetResult struct {
+	// Previous is the old string value of the key, if Existed
+	Previous string
+	Existed  bool
+	// Written reports whether the NX or XX condition let the value be set
+	Written bool
+}
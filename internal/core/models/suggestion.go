@@ -1,5 +1,12 @@
 package models
 
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"unicode"
+)
+
 // Suggestion represents an autocomplete suggestion entry
 type Suggestion struct {
 	Score   float64
@@ -7,14 +14,291 @@ type Suggestion struct {
 	Payload string
 }
 
-// SuggestionDict represents a dictionary of suggestions
+// SuggestionDict is an autocomplete dictionary stored as a prefix trie over
+// case-folded runes. Every node records the best score in its subtree, so
+// the highest scored completions of a prefix are found without visiting
+// the rest of the subtree.
 type SuggestionDict struct {
-	Entries map[string]*Suggestion
+	mu   sync.RWMutex
+	root *suggestionNode
+	size int
+}
+
+type suggestionNode struct {
+	children map[rune]*suggestionNode
+	entry    *Suggestion
+	maxScore float64
 }
 
 // NewSuggestionDict creates a new suggestion dictionary
 func NewSuggestionDict() *SuggestionDict {
-	return &SuggestionDict{
-		Entries: make(map[string]*Suggestion),
+	return &SuggestionDict{root: newSuggestionNode()}
+}
+
+func newSuggestionNode() *suggestionNode {
+	return &suggestionNode{maxScore: math.Inf(-1)}
+}
+
+// foldRunes returns s with every rune case folded, so that strings that
+// differ only in case share a trie path.
+func foldRunes(s string) []rune {
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		runes = append(runes, unicode.ToLower(unicode.ToUpper(r)))
+	}
+	return runes
+}
+
+// Add stores str with score, or updates it if a string equal to it up to
+// case is already present. With incr the score is added to the existing
+// one. A nil payload keeps the payload already stored. It returns the
+// number of suggestions in the dictionary.
+func (d *SuggestionDict) Add(str string, score float64, incr bool, payload *string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := []*suggestionNode{d.root}
+	n := d.root
+	for _, r := range foldRunes(str) {
+		child, ok := n.children[r]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[rune]*suggestionNode)
+			}
+			child = newSuggestionNode()
+			n.children[r] = child
+		}
+		n = child
+		path = append(path, n)
+	}
+
+	if n.entry == nil {
+		n.entry = &Suggestion{}
+		d.size++
+	} else if incr {
+		score += n.entry.Score
+	}
+	n.entry.String = str
+	n.entry.Score = score
+	if payload != nil {
+		n.entry.Payload = *payload
+	}
+
+	updateMaxScores(path)
+	return d.size
+}
+
+// Delete removes the suggestion equal to str up to case.
+func (d *SuggestionDict) Delete(str string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := foldRunes(str)
+	path := []*suggestionNode{d.root}
+	n := d.root
+	for _, r := range key {
+		if n = n.children[r]; n == nil {
+			return false
+		}
+		path = append(path, n)
+	}
+	if n.entry == nil {
+		return false
+	}
+	n.entry = nil
+	d.size--
+
+	// Drop the nodes that no longer lead to a suggestion
+	for i := len(path) - 1; i > 0; i-- {
+		if path[i].entry != nil || len(path[i].children) > 0 {
+			break
+		}
+		delete(path[i-1].children, key[i-1])
+		path = path[:i]
+	}
+	updateMaxScores(path)
+	return true
+}
+
+// updateMaxScores recomputes the subtree maximum of the nodes on path,
+// deepest first.
+func updateMaxScores(path []*suggestionNode) {
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
+		n.maxScore = math.Inf(-1)
+		if n.entry != nil {
+			n.maxScore = n.entry.Score
+		}
+		for _, child := range n.children {
+			n.maxScore = math.Max(n.maxScore, child.maxScore)
+		}
+	}
+}
+
+// Len returns the number of suggestions in the dictionary.
+func (d *SuggestionDict) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.size
+}
+
+// Range calls fn for every suggestion until fn returns false.
+func (d *SuggestionDict) Range(fn func(sug Suggestion) bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stack := []*suggestionNode{d.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.entry != nil && !fn(*n.entry) {
+			return
+		}
+		for _, child := range n.children {
+			stack = append(stack, child)
+		}
+	}
+}
+
+// Get returns up to max suggestions completing prefix, highest score
+// first; max <= 0 returns all of them. With fuzzy, completions of any
+// string within Levenshtein distance 1 of prefix are returned as well.
+func (d *SuggestionDict) Get(prefix string, fuzzy bool, max int) []Suggestion {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	key := foldRunes(prefix)
+	var roots []*suggestionNode
+	if fuzzy {
+		a := levenshteinAutomaton{pattern: key, max: 1}
+		roots = a.matchPrefixes(d.root, a.start(), roots)
+	} else {
+		n := d.root
+		for _, r := range key {
+			if n = n.children[r]; n == nil {
+				return nil
+			}
+		}
+		roots = append(roots, n)
+	}
+
+	// Best-first search: a node is expanded only once its subtree maximum
+	// is the best score left, so results come out in score order
+	q := make(suggestionQueue, 0, len(roots))
+	for _, n := range roots {
+		q = append(q, suggestionCandidate{node: n, score: n.maxScore})
+	}
+	heap.Init(&q)
+
+	var results []Suggestion
+	for q.Len() > 0 && (max <= 0 || len(results) < max) {
+		c := heap.Pop(&q).(suggestionCandidate)
+		if c.node == nil {
+			results = append(results, *c.entry)
+			continue
+		}
+		if c.node.entry != nil {
+			heap.Push(&q, suggestionCandidate{entry: c.node.entry, score: c.node.entry.Score})
+		}
+		for _, child := range c.node.children {
+			heap.Push(&q, suggestionCandidate{node: child, score: child.maxScore})
+		}
+	}
+	return results
+}
+
+// suggestionCandidate is a suggestion or a subtree still to be expanded.
+type suggestionCandidate struct {
+	node  *suggestionNode
+	entry *Suggestion
+	score float64
+}
+
+type suggestionQueue []suggestionCandidate
+
+func (q suggestionQueue) Len() int { return len(q) }
+
+func (q suggestionQueue) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score > q[j].score
+	}
+	// Emit suggestions before expanding subtrees of the same score, in a
+	// stable order
+	if (q[i].node == nil) != (q[j].node == nil) {
+		return q[i].node == nil
+	}
+	return q[i].entry != nil && q[j].entry != nil && q[i].entry.String < q[j].entry.String
+}
+
+func (q suggestionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *suggestionQueue) Push(x interface{}) { *q = append(*q, x.(suggestionCandidate)) }
+
+func (q *suggestionQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// levenshteinAutomaton accepts the strings within max edits of pattern.
+// A state is one row of the edit distance matrix: the distance between
+// each prefix of the pattern and the input read so far. Stepping it along
+// trie edges evaluates every stored prefix once, and states that can no
+// longer match prune whole subtrees.
+type levenshteinAutomaton struct {
+	pattern []rune
+	max     int
+}
+
+func (a levenshteinAutomaton) start() []int {
+	row := make([]int, len(a.pattern)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return row
+}
+
+func (a levenshteinAutomaton) step(row []int, r rune) []int {
+	next := make([]int, len(row))
+	next[0] = row[0] + 1
+	for i := 1; i < len(row); i++ {
+		cost := 1
+		if a.pattern[i-1] == r {
+			cost = 0
+		}
+		next[i] = min(next[i-1]+1, row[i]+1, row[i-1]+cost)
+	}
+	return next
+}
+
+// isMatch reports whether the input read so far is within max edits of
+// the whole pattern.
+func (a levenshteinAutomaton) isMatch(row []int) bool {
+	return row[len(row)-1] <= a.max
+}
+
+// canMatch reports whether some continuation of the input can still match.
+func (a levenshteinAutomaton) canMatch(row []int) bool {
+	for _, d := range row {
+		if d <= a.max {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefixes appends the highest trie nodes below n whose path matches
+// the pattern. Everything under such a node completes a matching prefix.
+func (a levenshteinAutomaton) matchPrefixes(n *suggestionNode, row []int, out []*suggestionNode) []*suggestionNode {
+	if a.isMatch(row) {
+		return append(out, n)
+	}
+	if !a.canMatch(row) {
+		return out
+	}
+	for r, child := range n.children {
+		out = a.matchPrefixes(child, a.step(row, r), out)
 	}
+	return out
 }
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func suggestionStrings(sugs []Suggestion) []string {
+	strs := make([]string, len(sugs))
+	for i, sug := range sugs {
+		strs[i] = sug.String
+	}
+	return strs
+}
+
+func TestSuggestionIncrAndPayload(t *testing.T) {
+	d := NewSuggestionDict()
+	first, second := "first", "second"
+
+	assert.Equal(t, 1, d.Add("hello", 1, false, &first))
+	assert.Equal(t, 1, d.Add("hello", 2, true, nil))
+	assert.Equal(t, 1, d.Add("hello", 0.5, true, nil))
+
+	sugs := d.Get("hello", false, 0)
+	require.Len(t, sugs, 1)
+	assert.Equal(t, 3.5, sugs[0].Score)
+	// A nil payload keeps the stored one
+	assert.Equal(t, "first", sugs[0].Payload)
+
+	// Without INCR the score is replaced, as is a given payload
+	assert.Equal(t, 1, d.Add("hello", 7, false, &second))
+	sugs = d.Get("hello", false, 0)
+	require.Len(t, sugs, 1)
+	assert.Equal(t, 7.0, sugs[0].Score)
+	assert.Equal(t, "second", sugs[0].Payload)
+}
+
+func TestSuggestionCaseInsensitive(t *testing.T) {
+	d := NewSuggestionDict()
+	d.Add("Hello World", 1, false, nil)
+
+	for _, prefix := range []string{"hello", "HELLO w", "hElLo WoRlD"} {
+		assert.Equal(t, []string{"Hello World"}, suggestionStrings(d.Get(prefix, false, 0)), prefix)
+	}
+
+	// A string equal up to case updates the entry and keeps the new spelling
+	assert.Equal(t, 1, d.Add("HELLO WORLD", 2, true, nil))
+	sugs := d.Get("hello", false, 0)
+	require.Len(t, sugs, 1)
+	assert.Equal(t, "HELLO WORLD", sugs[0].String)
+	assert.Equal(t, 3.0, sugs[0].Score)
+
+	assert.True(t, d.Delete("hello world"))
+	assert.Equal(t, 0, d.Len())
+}
+
+func TestSuggestionFuzzy(t *testing.T) {
+	d := NewSuggestionDict()
+	for _, str := range []string{"hello", "jello", "ello", "shello", "help", "world"} {
+		d.Add(str, 1, false, nil)
+	}
+
+	assert.Empty(t, d.Get("hxllo", false, 0))
+
+	tests := []struct {
+		prefix   string
+		expected []string
+	}{
+		// Exact, then one substitution (jello), insertion (shello) and
+		// deletion (ello), all at the first rune
+		{"hello", []string{"hello", "jello", "shello", "ello"}},
+		{"xello", []string{"hello", "jello", "ello"}},
+		// Substitute in the middle, as a prefix of longer words
+		{"hxl", []string{"hello", "help"}},
+	}
+	for _, tt := range tests {
+		got := suggestionStrings(d.Get(tt.prefix, true, 0))
+		for _, str := range tt.expected {
+			assert.Contains(t, got, str, "fuzzy %q", tt.prefix)
+		}
+		assert.NotContains(t, got, "world", "fuzzy %q", tt.prefix)
+	}
+
+	// Two edits are too many
+	assert.Empty(t, d.Get("hxxlo", true, 0))
+}
+
+func TestSuggestionScoreOrderAndMax(t *testing.T) {
+	d := NewSuggestionDict()
+	for i, str := range []string{"apple", "apricot", "application", "apply", "banana"} {
+		d.Add(str, float64(i+1), false, nil)
+	}
+
+	assert.Equal(t, []string{"apply", "application", "apricot", "apple"}, suggestionStrings(d.Get("ap", false, 0)))
+	assert.Equal(t, []string{"apply", "application"}, suggestionStrings(d.Get("ap", false, 2)))
+	assert.Equal(t, []string{"banana", "apply"}, suggestionStrings(d.Get("", false, 2)))
+
+	// Raising a score reorders the results
+	d.Add("apple", 10, true, nil)
+	assert.Equal(t, []string{"apple", "apply"}, suggestionStrings(d.Get("ap", false, 2)))
+}
+
+func TestSuggestionDeleteSharedPrefix(t *testing.T) {
+	d := NewSuggestionDict()
+	d.Add("car", 5, false, nil)
+	d.Add("cart", 3, false, nil)
+	d.Add("carton", 1, false, nil)
+
+	assert.False(t, d.Delete("ca"))
+	assert.False(t, d.Delete("cartons"))
+
+	// Deleting an inner word keeps the longer ones
+	assert.True(t, d.Delete("cart"))
+	assert.False(t, d.Delete("cart"))
+	assert.Equal(t, 2, d.Len())
+	assert.Equal(t, []string{"car", "carton"}, suggestionStrings(d.Get("car", false, 0)))
+
+	// Deleting a leaf keeps its prefix, and the subtree scores follow
+	assert.True(t, d.Delete("carton"))
+	assert.Equal(t, []string{"car"}, suggestionStrings(d.Get("c", false, 0)))
+	assert.Empty(t, d.Get("cart", false, 0))
+
+	d.Add("cab", 1, false, nil)
+	assert.True(t, d.Delete("car"))
+	assert.Equal(t, []string{"cab"}, suggestionStrings(d.Get("ca", false, 0)))
+	assert.Equal(t, 1, d.Len())
+}
+
+func TestSuggestionConcurrentAccess(t *testing.T) {
+	d := NewSuggestionDict()
+	var wg sync.WaitGroup
+
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				d.Add("word"+strconv.Itoa(w)+"-"+strconv.Itoa(i), float64(i), false, nil)
+				d.Add("shared", 1, true, nil)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				d.Get("word", i%2 == 0, 5)
+				d.Len()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 4*200+1, d.Len())
+	sugs := d.Get("shared", false, 0)
+	require.Len(t, sugs, 1)
+	assert.Equal(t, 800.0, sugs[0].Score)
+}
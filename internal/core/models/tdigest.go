@@ -3,6 +3,8 @@ package models
 import (
 	"math"
 	"sort"
+	"sync"
+	"unsafe"
 )
 
 // Centroid represents a cluster in the T-Digest
@@ -11,25 +13,45 @@ type Centroid struct {
 	Weight float64
 }
 
-// TDigest represents a T-Digest data structure
+// TDigest is a merging t-digest. Incoming values are appended to a buffer
+// and folded into the sorted centroid list in one merge pass once the
+// buffer fills or a query needs them, so insertion is amortized O(1) and
+// queries never sort.
+//
+// Centroid sizes follow the k1 scale function k(q) = δ/(2π)·asin(2q−1):
+// every centroid spans at most one unit of k, which keeps at most about
+// δ/2 centroids and makes them small near the tails. For the default
+// compression of 100 the estimated quantile q is a value whose true rank
+// is within 0.01 of q in the body of the distribution, and within 0.001
+// below q = 0.01 or above q = 0.99; CDF is within the same bounds of the
+// true rank of a value. Both bounds tighten linearly with larger
+// compression. Values repeated many times occupy a range of ranks and the
+// bounds hold against the nearest of them.
 type TDigest struct {
-	compression float64
-	count       float64
-	min         float64
-	max         float64
-	Centroids   []Centroid
+	mu           sync.Mutex
+	compression  float64
+	count        float64
+	min          float64
+	max          float64
+	centroids    []Centroid
+	buffer       []Centroid
+	compressions int64
 }
 
 // NewTDigest creates a new T-Digest with given compression parameter
 func NewTDigest(compression float64) *TDigest {
 	return &TDigest{
-		Centroids:   make([]Centroid, 0),
 		compression: compression,
 		min:         math.Inf(1),  // Positive infinity
 		max:         math.Inf(-1), // Negative infinity
 	}
 }
 
+// bufferCapacity is the number of values buffered between merge passes.
+func (td *TDigest) bufferCapacity() int {
+	return int(6*td.compression) + 10
+}
+
 // Add adds a new value to the T-Digest
 func (td *TDigest) Add(value float64) {
 	td.AddWeighted(value, 1.0)
@@ -37,184 +59,394 @@ func (td *TDigest) Add(value float64) {
 
 // AddWeighted adds a new value with a specified weight
 func (td *TDigest) AddWeighted(value, weight float64) {
-	if weight <= 0 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.add(value, weight)
+}
+
+func (td *TDigest) add(value, weight float64) {
+	if weight <= 0 || math.IsNaN(value) {
 		return
 	}
-
 	if value < td.min {
 		td.min = value
 	}
 	if value > td.max {
 		td.max = value
 	}
-
 	td.count += weight
-
-	// Find the closest centroid
-	var closest *Centroid
-	minDistance := math.Inf(1)
-
-	for i := range td.Centroids {
-		dist := math.Abs(td.Centroids[i].Mean - value)
-		if dist < minDistance {
-			minDistance = dist
-			closest = &td.Centroids[i]
-		}
+	td.buffer = append(td.buffer, Centroid{Mean: value, Weight: weight})
+	if len(td.buffer) >= td.bufferCapacity() {
+		td.flush()
 	}
+}
 
-	if closest == nil {
-		td.Centroids = append(td.Centroids, Centroid{Mean: value, Weight: weight})
-	} else {
-		// Merge with closest centroid
-		totalWeight := closest.Weight + weight
-		closest.Mean = (closest.Mean*closest.Weight + value*weight) / totalWeight
-		closest.Weight = totalWeight
-	}
+// kScale maps a quantile to the k1 scale.
+func (td *TDigest) kScale(q float64) float64 {
+	return td.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
 
-	// Compress if needed
-	if float64(len(td.Centroids)) > 20*td.compression {
-		td.compress()
-	}
+// kInverse maps a value of the k1 scale back to a quantile.
+func (td *TDigest) kInverse(k float64) float64 {
+	k = math.Max(-td.compression/4, math.Min(td.compression/4, k))
+	return (math.Sin(k*2*math.Pi/td.compression) + 1) / 2
 }
 
-// compress reduces the number of centroids
-func (td *TDigest) compress() {
-	if len(td.Centroids) <= 1 {
+// flush merges the buffered values into the centroid list.
+func (td *TDigest) flush() {
+	if len(td.buffer) == 0 {
 		return
 	}
-
-	// Sort centroids by mean
-	sort.Slice(td.Centroids, func(i, j int) bool {
-		return td.Centroids[i].Mean < td.Centroids[j].Mean
+	all := append(td.buffer, td.centroids...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Mean < all[j].Mean
 	})
 
-	newCentroids := make([]Centroid, 0)
-	current := td.Centroids[0]
-
-	for i := 1; i < len(td.Centroids); i++ {
-		if current.Weight+td.Centroids[i].Weight <= td.compression {
-			// Merge centroids
-			totalWeight := current.Weight + td.Centroids[i].Weight
-			current.Mean = (current.Mean*current.Weight + td.Centroids[i].Mean*td.Centroids[i].Weight) / totalWeight
-			current.Weight = totalWeight
-		} else {
-			newCentroids = append(newCentroids, current)
-			current = td.Centroids[i]
+	merged := make([]Centroid, 0, len(td.centroids)+1)
+	current := all[0]
+	weightSoFar := 0.0
+	limit := td.count * td.kInverse(td.kScale(0)+1)
+	for _, c := range all[1:] {
+		if weightSoFar+current.Weight+c.Weight <= limit {
+			current.Weight += c.Weight
+			current.Mean += (c.Mean - current.Mean) * c.Weight / current.Weight
+			continue
 		}
+		weightSoFar += current.Weight
+		merged = append(merged, current)
+		limit = td.count * td.kInverse(td.kScale(weightSoFar/td.count)+1)
+		current = c
 	}
-	newCentroids = append(newCentroids, current)
-	td.Centroids = newCentroids
+	td.centroids = append(merged, current)
+	td.buffer = td.buffer[:0]
+	td.compressions++
 }
 
 // Quantile returns the approximate value at a given quantile
 func (td *TDigest) Quantile(q float64) float64 {
-	if q < 0 || q > 1 {
-		return math.NaN()
-	}
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	return td.quantile(q)
+}
 
-	if len(td.Centroids) == 0 {
+// quantile interpolates between centroid centers, treating each centroid
+// as spread evenly around its mean and singletons as exact points.
+func (td *TDigest) quantile(q float64) float64 {
+	if q < 0 || q > 1 || len(td.centroids) == 0 {
 		return math.NaN()
 	}
+	cs := td.centroids
+	n := len(cs)
+	if n == 1 {
+		return cs[0].Mean
+	}
 
-	if q == 0 {
+	index := q * td.count
+	if index < 1 {
 		return td.min
 	}
-	if q == 1 {
+	if cs[0].Weight > 1 && index < cs[0].Weight/2 {
+		return td.min + (index-1)/(cs[0].Weight/2-1)*(cs[0].Mean-td.min)
+	}
+	if index > td.count-1 {
 		return td.max
 	}
+	last := cs[n-1]
+	if last.Weight > 1 && td.count-index <= last.Weight/2 {
+		return td.max - (td.count-index-1)/(last.Weight/2-1)*(td.max-last.Mean)
+	}
 
-	sort.Slice(td.Centroids, func(i, j int) bool {
-		return td.Centroids[i].Mean < td.Centroids[j].Mean
-	})
-
-	targetWeight := q * td.count
-	cumWeight := 0.0
-
-	for i, c := range td.Centroids {
-		cumWeight += c.Weight
-		if cumWeight >= targetWeight {
-			if i == 0 {
-				return c.Mean
+	weightSoFar := cs[0].Weight / 2
+	for i := 0; i < n-1; i++ {
+		dw := (cs[i].Weight + cs[i+1].Weight) / 2
+		if weightSoFar+dw > index {
+			leftUnit := 0.0
+			if cs[i].Weight == 1 {
+				if index-weightSoFar < 0.5 {
+					return cs[i].Mean
+				}
+				leftUnit = 0.5
+			}
+			rightUnit := 0.0
+			if cs[i+1].Weight == 1 {
+				if weightSoFar+dw-index <= 0.5 {
+					return cs[i+1].Mean
+				}
+				rightUnit = 0.5
 			}
-			// Linear interpolation between centroids
-			prev := td.Centroids[i-1]
-			weightDelta := cumWeight - c.Weight - (cumWeight - targetWeight)
-			return prev.Mean + (c.Mean-prev.Mean)*(weightDelta/c.Weight)
+			z1 := index - weightSoFar - leftUnit
+			z2 := weightSoFar + dw - index - rightUnit
+			return weightedAverage(cs[i].Mean, z2, cs[i+1].Mean, z1)
 		}
+		weightSoFar += dw
 	}
 
-	return td.max
+	z1 := index - td.count - last.Weight/2
+	z2 := last.Weight/2 - z1
+	return weightedAverage(last.Mean, z1, td.max, z2)
+}
+
+// weightedAverage returns the weighted mean of x1 and x2, kept between them
+// despite rounding.
+func weightedAverage(x1, w1, x2, w2 float64) float64 {
+	lo, hi := math.Min(x1, x2), math.Max(x1, x2)
+	return math.Max(lo, math.Min(hi, (x1*w1+x2*w2)/(w1+w2)))
 }
 
 // CDF returns the approximate cumulative distribution function
 func (td *TDigest) CDF(x float64) float64 {
-	if len(td.Centroids) == 0 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	return td.cdf(x)
+}
+
+// cdf returns the estimated fraction of values below x plus half of those
+// equal to it.
+func (td *TDigest) cdf(x float64) float64 {
+	cs := td.centroids
+	n := len(cs)
+	if n == 0 || math.IsNaN(x) {
 		return math.NaN()
 	}
-
-	if x <= td.min {
+	if x < td.min {
 		return 0
 	}
-	if x >= td.max {
+	if x > td.max {
 		return 1
 	}
+	if n == 1 {
+		if td.max == td.min {
+			return 0.5
+		}
+		return (x - td.min) / (td.max - td.min)
+	}
 
-	sort.Slice(td.Centroids, func(i, j int) bool {
-		return td.Centroids[i].Mean < td.Centroids[j].Mean
-	})
+	if x < cs[0].Mean {
+		if cs[0].Mean-td.min <= 0 {
+			return 0
+		}
+		if x == td.min {
+			return 0.5 / td.count
+		}
+		return (1 + (x-td.min)/(cs[0].Mean-td.min)*(cs[0].Weight/2-1)) / td.count
+	}
+	last := cs[n-1]
+	if x > last.Mean {
+		if td.max-last.Mean <= 0 {
+			return 1
+		}
+		if x == td.max {
+			return 1 - 0.5/td.count
+		}
+		return 1 - (1+(td.max-x)/(td.max-last.Mean)*(last.Weight/2-1))/td.count
+	}
 
-	cumWeight := 0.0
-	for _, c := range td.Centroids {
-		if c.Mean <= x {
-			cumWeight += c.Weight
-		} else {
-			break
+	weightSoFar := 0.0
+	for i := 0; i < n-1; i++ {
+		if cs[i].Mean == x {
+			dw := 0.0
+			for ; i < n && cs[i].Mean == x; i++ {
+				dw += cs[i].Weight
+			}
+			return (weightSoFar + dw/2) / td.count
+		}
+		if cs[i].Mean < x && x < cs[i+1].Mean {
+			leftExcluded, rightExcluded := 0.0, 0.0
+			if cs[i].Weight == 1 {
+				if cs[i+1].Weight == 1 {
+					return (weightSoFar + 1) / td.count
+				}
+				leftExcluded = 0.5
+			} else if cs[i+1].Weight == 1 {
+				rightExcluded = 0.5
+			}
+			dw := (cs[i].Weight+cs[i+1].Weight)/2 - leftExcluded - rightExcluded
+			base := weightSoFar + cs[i].Weight/2 + leftExcluded
+			return (base + dw*(x-cs[i].Mean)/(cs[i+1].Mean-cs[i].Mean)) / td.count
 		}
+		weightSoFar += cs[i].Weight
 	}
+	// x equals the mean of the last centroid
+	return 1 - last.Weight/2/td.count
+}
+
+// Rank returns the estimated number of values smaller than value plus half
+// of those equal to it, rounded half down. It is -1 below the minimum, the count
+// above the maximum and -2 for an empty digest.
+func (td *TDigest) Rank(value float64) int64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	switch {
+	case td.count == 0:
+		return -2
+	case value < td.min:
+		return -1
+	case value > td.max:
+		return int64(td.count)
+	}
+	return roundHalfDown(td.cdf(value) * td.count)
+}
+
+// RevRank is Rank counted from the largest value down: -1 above the
+// maximum and the count below the minimum.
+func (td *TDigest) RevRank(value float64) int64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	switch {
+	case td.count == 0:
+		return -2
+	case value > td.max:
+		return -1
+	case value < td.min:
+		return int64(td.count)
+	}
+	return roundHalfDown(td.count - td.cdf(value)*td.count)
+}
+
+// roundHalfDown rounds to the nearest integer with halves rounded down, so
+// the smallest value ranks 0 rather than the 0.5 given by its own half.
+func roundHalfDown(x float64) int64 {
+	return int64(math.Ceil(x - 0.5))
+}
+
+// ByRank returns the estimated value with the given rank, where rank 0 is
+// the minimum. Ranks at or past the count give +Inf, and an empty digest
+// gives NaN.
+func (td *TDigest) ByRank(rank int64) float64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	return td.byRank(rank, false)
+}
 
-	return cumWeight / td.count
+// ByRevRank is ByRank counted from the largest value down; ranks at or
+// past the count give -Inf.
+func (td *TDigest) ByRevRank(rank int64) float64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+	return td.byRank(rank, true)
+}
+
+func (td *TDigest) byRank(rank int64, reverse bool) float64 {
+	switch {
+	case td.count == 0 || rank < 0:
+		return math.NaN()
+	case float64(rank) >= td.count:
+		if reverse {
+			return math.Inf(-1)
+		}
+		return math.Inf(1)
+	case rank == 0:
+		if reverse {
+			return td.max
+		}
+		return td.min
+	case float64(rank) == td.count-1:
+		if reverse {
+			return td.min
+		}
+		return td.max
+	}
+	q := (float64(rank) + 0.5) / td.count
+	if reverse {
+		q = 1 - q
+	}
+	return td.quantile(q)
 }
 
 // Count returns the total number of points
 func (td *TDigest) Count() float64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
 	return td.count
 }
 
+// Compression returns the compression parameter
+func (td *TDigest) Compression() float64 {
+	return td.compression
+}
+
 // Min returns the minimum value
 func (td *TDigest) Min() float64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if td.count == 0 {
+		return math.NaN()
+	}
 	return td.min
 }
 
 // Max returns the maximum value
 func (td *TDigest) Max() float64 {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	if td.count == 0 {
+		return math.NaN()
+	}
 	return td.max
 }
 
 // Reset resets the T-Digest to its initial state
 func (td *TDigest) Reset() {
-	td.Centroids = make([]Centroid, 0)
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.centroids = nil
+	td.buffer = nil
 	td.count = 0
 	td.min = math.Inf(1)
 	td.max = math.Inf(-1)
+	td.compressions = 0
 }
 
 // Merge merges another T-Digest into this one
 func (td *TDigest) Merge(other *TDigest) {
-	if other == nil || len(other.Centroids) == 0 {
+	if other == nil || other == td {
 		return
 	}
+	centroids, min, max := other.snapshot()
 
-	// Update min/max
-	if other.min < td.min {
-		td.min = other.min
-	}
-	if other.max > td.max {
-		td.max = other.max
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.mergeCentroids(centroids, min, max)
+}
+
+// MergeTDigests returns a new digest with the given compression holding
+// the values of all digests.
+func MergeTDigests(compression float64, digests ...*TDigest) *TDigest {
+	td := NewTDigest(compression)
+	for _, d := range digests {
+		centroids, min, max := d.snapshot()
+		td.mergeCentroids(centroids, min, max)
 	}
+	td.flush()
+	return td
+}
 
-	// Merge centroids
-	for _, c := range other.Centroids {
-		td.AddWeighted(c.Mean, c.Weight)
+// snapshot returns a copy of the digest's centroids, buffered values
+// included, and its bounds.
+func (td *TDigest) snapshot() ([]Centroid, float64, float64) {
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	centroids := make([]Centroid, 0, len(td.centroids)+len(td.buffer))
+	centroids = append(centroids, td.centroids...)
+	centroids = append(centroids, td.buffer...)
+	return centroids, td.min, td.max
+}
+
+// mergeCentroids adds whole centroids of another digest; the bounds are
+// taken over because the centroid means lie strictly inside them.
+func (td *TDigest) mergeCentroids(centroids []Centroid, min, max float64) {
+	for _, c := range centroids {
+		td.add(c.Mean, c.Weight)
+	}
+	if len(centroids) > 0 {
+		td.min = math.Min(td.min, min)
+		td.max = math.Max(td.max, max)
 	}
 }
 
@@ -224,20 +456,23 @@ func (td *TDigest) TrimmedMean(lowQuantile, highQuantile float64) float64 {
 		return math.NaN()
 	}
 
-	sort.Slice(td.Centroids, func(i, j int) bool {
-		return td.Centroids[i].Mean < td.Centroids[j].Mean
-	})
-
-	lowValue := td.Quantile(lowQuantile)
-	highValue := td.Quantile(highQuantile)
-
-	sum := 0.0
-	weight := 0.0
-
-	for _, c := range td.Centroids {
-		if c.Mean >= lowValue && c.Mean <= highValue {
-			sum += c.Mean * c.Weight
-			weight += c.Weight
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	td.flush()
+
+	// Each centroid covers a range of ranks; count the part of it that
+	// falls inside the kept range
+	low, high := lowQuantile*td.count, highQuantile*td.count
+	sum, weight, cum := 0.0, 0.0, 0.0
+	for _, c := range td.centroids {
+		overlap := math.Min(cum+c.Weight, high) - math.Max(cum, low)
+		if overlap > 0 {
+			sum += c.Mean * overlap
+			weight += overlap
+		}
+		cum += c.Weight
+		if cum >= high {
+			break
 		}
 	}
 
@@ -250,18 +485,30 @@ func (td *TDigest) TrimmedMean(lowQuantile, highQuantile float64) float64 {
 
 // GetMemoryUsage returns an estimation of memory usage in bytes
 func (td *TDigest) GetMemoryUsage() int64 {
-	// Each centroid uses 16 bytes (2 float64s)
-	return int64(len(td.Centroids) * 16)
+	td.mu.Lock()
+	defer td.mu.Unlock()
+	return td.memoryUsage()
+}
+
+func (td *TDigest) memoryUsage() int64 {
+	centroidSize := int64(unsafe.Sizeof(Centroid{}))
+	return int64(unsafe.Sizeof(*td)) + int64(cap(td.centroids)+cap(td.buffer))*centroidSize
 }
 
 // Info returns information about the T-Digest
 func (td *TDigest) Info() map[string]interface{} {
+	td.mu.Lock()
+	defer td.mu.Unlock()
 	return map[string]interface{}{
-		"compression":   td.compression,
-		"count":         td.count,
-		"min":           td.min,
-		"max":           td.max,
-		"num_centroids": len(td.Centroids),
-		"memory_usage":  td.GetMemoryUsage(),
+		"compression":        td.compression,
+		"capacity":           td.bufferCapacity(),
+		"count":              td.count,
+		"min":                td.min,
+		"max":                td.max,
+		"num_centroids":      len(td.centroids) + len(td.buffer),
+		"merged_nodes":       len(td.centroids),
+		"unmerged_nodes":     len(td.buffer),
+		"total_compressions": td.compressions,
+		"memory_usage":       td.memoryUsage(),
 	}
 }
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tdigestDistributions = map[string]func(rng *rand.Rand) float64{
+	"uniform":     func(rng *rand.Rand) float64 { return rng.Float64() },
+	"normal":      func(rng *rand.Rand) float64 { return rng.NormFloat64()*10 + 50 },
+	"exponential": func(rng *rand.Rand) float64 { return rng.ExpFloat64() },
+	"lognormal":   func(rng *rand.Rand) float64 { return math.Exp(rng.NormFloat64() * 2) },
+	"discrete":    func(rng *rand.Rand) float64 { return float64(rng.Intn(20)) },
+}
+
+// exactRank returns the fraction of sorted values below x plus half of
+// those equal to it.
+func exactRank(sorted []float64, x float64) float64 {
+	below := sort.SearchFloat64s(sorted, x)
+	upTo := sort.Search(len(sorted), func(i int) bool { return sorted[i] > x })
+	return (float64(below) + float64(upTo-below)/2) / float64(len(sorted))
+}
+
+// rankBound is the documented accuracy of a digest with compression 100.
+func rankBound(q float64) float64 {
+	if q < 0.01 || q > 0.99 {
+		return 0.001
+	}
+	return 0.01
+}
+
+func TestTDigestAccuracy(t *testing.T) {
+	const n = 100000
+	qs := []float64{0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 0.95, 0.99, 0.995, 0.999, 0.9999}
+
+	for name, sample := range tdigestDistributions {
+		t.Run(name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(42))
+			td := NewTDigest(100)
+			values := make([]float64, n)
+			for i := range values {
+				values[i] = sample(rng)
+				td.Add(values[i])
+			}
+			sort.Float64s(values)
+
+			for _, q := range qs {
+				est := td.Quantile(q)
+				// Ties make a whole range of ranks correct for a value
+				lo := float64(sort.SearchFloat64s(values, est)) / n
+				hi := float64(sort.Search(n, func(i int) bool { return values[i] > est })) / n
+				err := math.Max(0, math.Max(lo-q, q-hi))
+				assert.LessOrEqual(t, err, rankBound(q), "quantile %v = %v", q, est)
+
+				x := values[int(q*n)]
+				lo = float64(sort.SearchFloat64s(values, x)) / n
+				hi = float64(sort.Search(n, func(i int) bool { return values[i] > x })) / n
+				cdf := td.CDF(x)
+				err = math.Max(0, math.Max(lo-cdf, cdf-hi))
+				assert.LessOrEqual(t, err, rankBound(q)+0.5/n, "cdf at quantile %v = %v", q, cdf)
+			}
+
+			assert.Equal(t, values[0], td.Min())
+			assert.Equal(t, values[n-1], td.Max())
+			assert.Equal(t, values[0], td.Quantile(0))
+			assert.Equal(t, values[n-1], td.Quantile(1))
+			assert.LessOrEqual(t, len(td.centroids), 100)
+		})
+	}
+}
+
+func TestTDigestMergeAccuracy(t *testing.T) {
+	const parts, perPart = 10, 10000
+	rng := rand.New(rand.NewSource(7))
+	var values []float64
+	digests := make([]*TDigest, parts)
+	for p := range digests {
+		digests[p] = NewTDigest(100)
+		// Each part sees a shifted slice of the distribution
+		for i := 0; i < perPart; i++ {
+			v := rng.NormFloat64() + float64(p)
+			values = append(values, v)
+			digests[p].Add(v)
+		}
+	}
+	sort.Float64s(values)
+
+	merged := MergeTDigests(100, digests...)
+	require.Equal(t, float64(parts*perPart), merged.Count())
+	for _, q := range []float64{0.001, 0.01, 0.1, 0.5, 0.9, 0.99, 0.999} {
+		rank := exactRank(values, merged.Quantile(q))
+		assert.InDelta(t, q, rank, 2*rankBound(q), "quantile %v", q)
+	}
+	assert.Equal(t, values[0], merged.Min())
+	assert.Equal(t, values[len(values)-1], merged.Max())
+}
+
+func TestTDigestSmall(t *testing.T) {
+	td := NewTDigest(100)
+	assert.True(t, math.IsNaN(td.Quantile(0.5)))
+	assert.True(t, math.IsNaN(td.CDF(1)))
+	assert.Equal(t, int64(-2), td.Rank(1))
+	assert.True(t, math.IsNaN(td.ByRank(0)))
+
+	for _, v := range []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10} {
+		td.Add(v)
+	}
+	// Few values are kept exactly
+	assert.Equal(t, 1.0, td.Quantile(0))
+	assert.Equal(t, 3.0, td.Quantile(0.25))
+	assert.Equal(t, 6.0, td.Quantile(0.5))
+	assert.Equal(t, 10.0, td.Quantile(1))
+	assert.Equal(t, 0.25, td.CDF(3))
+	assert.Equal(t, 0.0, td.CDF(0))
+	assert.Equal(t, 1.0, td.CDF(11))
+
+	assert.Equal(t, int64(-1), td.Rank(0))
+	assert.Equal(t, int64(10), td.Rank(11))
+	assert.Equal(t, int64(0), td.Rank(1))
+	assert.Equal(t, int64(4), td.Rank(4.5))
+	assert.Equal(t, int64(-1), td.RevRank(11))
+	assert.Equal(t, int64(10), td.RevRank(0))
+	assert.Equal(t, int64(0), td.RevRank(10))
+
+	assert.Equal(t, 1.0, td.ByRank(0))
+	assert.Equal(t, 10.0, td.ByRank(9))
+	assert.Equal(t, 4.0, td.ByRank(3))
+	assert.Equal(t, math.Inf(1), td.ByRank(10))
+	assert.Equal(t, 10.0, td.ByRevRank(0))
+	assert.Equal(t, 7.0, td.ByRevRank(3))
+	assert.Equal(t, math.Inf(-1), td.ByRevRank(10))
+
+	assert.InDelta(t, 5.5, td.TrimmedMean(0, 1), 1e-9)
+	assert.InDelta(t, 5.5, td.TrimmedMean(0.1, 0.9), 1e-9)
+	assert.InDelta(t, 2.0, td.TrimmedMean(0, 0.3), 1e-9)
+}
+
+func TestTDigestBuffering(t *testing.T) {
+	td := NewTDigest(100)
+	for i := 0; i < td.bufferCapacity()-1; i++ {
+		td.Add(float64(i))
+	}
+	info := td.Info()
+	assert.Equal(t, 0, info["merged_nodes"])
+	assert.Equal(t, td.bufferCapacity()-1, info["unmerged_nodes"])
+
+	td.Add(-1)
+	info = td.Info()
+	assert.Equal(t, 0, info["unmerged_nodes"])
+	assert.Equal(t, int64(1), info["total_compressions"])
+	assert.Equal(t, -1.0, td.Min())
+}
@@ -1,28 +1,504 @@
 package models
 
-import "sync"
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+)
 
-type TimeSeries struct {
-	Mutex   sync.Mutex
-	Labels  map[string]string
-	Rules   []TimeSeriesRule
-	Samples []TimeSeriesSample
-}
+const (
+	// TimeSeriesDefaultChunkSize is the size in bytes of the chunks of a
+	// series created without CHUNK_SIZE.
+	TimeSeriesDefaultChunkSize = 4096
+	TimeSeriesMinChunkSize     = 48
+	TimeSeriesMaxChunkSize     = 1048576
+
+	TimeSeriesEncodingCompressed   = "COMPRESSED"
+	TimeSeriesEncodingUncompressed = "UNCOMPRESSED"
+
+	// Duplicate policies deciding what a sample with the timestamp of an
+	// existing one does
+	DuplicatePolicyBlock = "BLOCK"
+	DuplicatePolicyFirst = "FIRST"
+	DuplicatePolicyLast  = "LAST"
+	DuplicatePolicyMin   = "MIN"
+	DuplicatePolicyMax   = "MAX"
+	DuplicatePolicySum   = "SUM"
+)
+
+var (
+	ErrTimeSeriesDuplicate = fmt.Errorf("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+	ErrTimeSeriesTooOld    = fmt.Errorf("ERR TSDB: Timestamp is older than retention")
+)
 
 type TimeSeriesSample struct {
 	Timestamp int64
 	Value     float64
 }
 
-type TimeSeriesStats struct {
-	MaxValue     float64
-	MinValue     float64
-	AvgValue     float64
-	TotalSamples int
-}
-
+// TimeSeriesRule compacts a series into DestinationKey, one sample per
+// bucket of BucketSize starting at multiples of it plus AlignTimestamp.
 type TimeSeriesRule struct {
 	BucketSize      int64
 	AggregationType string
 	DestinationKey  string
+	AlignTimestamp  int64
+}
+
+// TimeSeriesOptions configures a time series. Retention is in the unit of
+// the timestamps, 0 keeping every sample.
+type TimeSeriesOptions struct {
+	Retention       int64
+	Encoding        string
+	ChunkSize       int
+	DuplicatePolicy string
+	Labels          map[string]string
+}
+
+// DefaultTimeSeriesOptions returns the options of TS.CREATE without
+// arguments.
+func DefaultTimeSeriesOptions() TimeSeriesOptions {
+	return TimeSeriesOptions{
+		Encoding:        TimeSeriesEncodingCompressed,
+		ChunkSize:       TimeSeriesDefaultChunkSize,
+		DuplicatePolicy: DuplicatePolicyBlock,
+		Labels:          map[string]string{},
+	}
+}
+
+// ValidateChunkSize checks a CHUNK_SIZE argument.
+func ValidateChunkSize(size int) error {
+	if size < TimeSeriesMinChunkSize || size > TimeSeriesMaxChunkSize || size%8 != 0 {
+		return fmt.Errorf("ERR TSDB: CHUNK_SIZE value must be a multiple of 8 in the range [%d .. %d]", TimeSeriesMinChunkSize, TimeSeriesMaxChunkSize)
+	}
+	return nil
+}
+
+// ParseDuplicatePolicy returns the canonical name of a duplicate policy.
+func ParseDuplicatePolicy(policy string) (string, error) {
+	switch p := strings.ToUpper(policy); p {
+	case DuplicatePolicyBlock, DuplicatePolicyFirst, DuplicatePolicyLast,
+		DuplicatePolicyMin, DuplicatePolicyMax, DuplicatePolicySum:
+		return p, nil
+	}
+	return "", fmt.Errorf("ERR TSDB: Unknown DUPLICATE_POLICY")
+}
+
+// TimeSeriesAlterOptions lists the options TS.ALTER changes; nil fields and
+// empty strings are left as they are.
+type TimeSeriesAlterOptions struct {
+	Retention       *int64
+	Encoding        string
+	ChunkSize       *int
+	DuplicatePolicy string
+	Labels          map[string]string
+}
+
+// TimeSeriesInfo describes a time series for TS.INFO
+type TimeSeriesInfo struct {
+	TotalSamples    int
+	MemoryUsage     int64
+	FirstTimestamp  int64
+	LastTimestamp   int64
+	RetentionTime   int64
+	ChunkCount      int
+	ChunkSize       int
+	ChunkType       string
+	DuplicatePolicy string
+	Labels          map[string]string
+	SourceKey       string
+	Rules           []TimeSeriesRule
+	Chunks          []TimeSeriesChunkInfo
+}
+
+// TimeSeriesChunkInfo describes one chunk of a time series
+type TimeSeriesChunkInfo struct {
+	StartTimestamp int64
+	EndTimestamp   int64
+	Samples        int
+	Size           int
+	BytesPerSample float64
+}
+
+// TimeSeries stores samples in chunks covering consecutive time ranges.
+// Appending newer samples only touches the last chunk; a sample with an
+// older timestamp is merged into the chunk covering it, which is rebuilt
+// and split if it no longer fits. Once the series holds samples older than
+// its retention before the newest one, the chunks made only of those are
+// dropped and reads skip the rest.
+type TimeSeries struct {
+	mu              sync.RWMutex
+	retention       int64
+	compressed      bool
+	chunkSize       int
+	duplicatePolicy string
+	labels          map[string]string
+	sourceKey       string
+	rules           []*timeSeriesCompaction
+	compacted       []TimeSeriesCompaction
+	chunks          []*timeSeriesChunk
+}
+
+// NewTimeSeries creates an empty time series. The options must be valid.
+func NewTimeSeries(opts TimeSeriesOptions) *TimeSeries {
+	ts := &TimeSeries{
+		retention:       opts.Retention,
+		compressed:      opts.Encoding != TimeSeriesEncodingUncompressed,
+		chunkSize:       opts.ChunkSize,
+		duplicatePolicy: opts.DuplicatePolicy,
+		labels:          make(map[string]string, len(opts.Labels)),
+	}
+	if ts.chunkSize == 0 {
+		ts.chunkSize = TimeSeriesDefaultChunkSize
+	}
+	if ts.duplicatePolicy == "" {
+		ts.duplicatePolicy = DuplicatePolicyBlock
+	}
+	for k, v := range opts.Labels {
+		ts.labels[k] = v
+	}
+	return ts
+}
+
+// Add inserts a sample. A sample with the timestamp of an existing one is
+// resolved by policy, or the duplicate policy of the series if policy is
+// empty. It returns the timestamp of the sample.
+func (ts *TimeSeries) Add(timestamp int64, value float64, policy string) (int64, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if policy == "" {
+		policy = ts.duplicatePolicy
+	}
+	s := TimeSeriesSample{Timestamp: timestamp, Value: value}
+	last, ok := ts.lastSample()
+	if err := ts.upsert(s, policy); err != nil {
+		return 0, err
+	}
+	ts.compact(s, last, ok)
+	ts.trim()
+	return timestamp, nil
+}
+
+// IncrBy adds delta to the newest value and stores the result at timestamp,
+// which must not be older than the newest sample. It returns the new value.
+func (ts *TimeSeries) IncrBy(timestamp int64, delta float64) (float64, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	value := delta
+	if last, ok := ts.lastSample(); ok {
+		if timestamp < last.Timestamp {
+			return 0, fmt.Errorf("ERR TSDB: timestamp must be equal to or higher than the maximum existing timestamp")
+		}
+		value += last.Value
+	}
+	s := TimeSeriesSample{Timestamp: timestamp, Value: value}
+	last, ok := ts.lastSample()
+	if err := ts.upsert(s, DuplicatePolicyLast); err != nil {
+		return 0, err
+	}
+	ts.compact(s, last, ok)
+	ts.trim()
+	return value, nil
+}
+
+func (ts *TimeSeries) lastSample() (TimeSeriesSample, bool) {
+	if len(ts.chunks) == 0 {
+		return TimeSeriesSample{}, false
+	}
+	c := ts.chunks[len(ts.chunks)-1]
+	return TimeSeriesSample{Timestamp: c.last, Value: c.lastVal}, true
+}
+
+func (ts *TimeSeries) upsert(s TimeSeriesSample, policy string) error {
+	last, ok := ts.lastSample()
+	if ok && ts.retention > 0 && s.Timestamp < last.Timestamp-ts.retention {
+		return ErrTimeSeriesTooOld
+	}
+
+	if !ok || s.Timestamp > last.Timestamp {
+		if !ok || !ts.chunks[len(ts.chunks)-1].append(s) {
+			c := ts.newChunk()
+			c.append(s)
+			ts.chunks = append(ts.chunks, c)
+		}
+		return nil
+	}
+
+	// The chunk covering the timestamp is the last one starting at or
+	// before it, or the first one
+	i := sort.Search(len(ts.chunks), func(i int) bool { return ts.chunks[i].first > s.Timestamp })
+	i = max(i-1, 0)
+	samples := ts.chunks[i].all()
+	j := sort.Search(len(samples), func(j int) bool { return samples[j].Timestamp >= s.Timestamp })
+	if j < len(samples) && samples[j].Timestamp == s.Timestamp {
+		old := samples[j].Value
+		switch policy {
+		case DuplicatePolicyBlock:
+			return ErrTimeSeriesDuplicate
+		case DuplicatePolicyFirst:
+			return nil
+		case DuplicatePolicyLast:
+			samples[j].Value = s.Value
+		case DuplicatePolicyMin:
+			samples[j].Value = math.Min(old, s.Value)
+		case DuplicatePolicyMax:
+			samples[j].Value = math.Max(old, s.Value)
+		case DuplicatePolicySum:
+			samples[j].Value = old + s.Value
+		}
+	} else {
+		samples = append(samples, TimeSeriesSample{})
+		copy(samples[j+1:], samples[j:])
+		samples[j] = s
+	}
+	ts.replaceChunk(i, samples)
+	return nil
+}
+
+func (ts *TimeSeries) newChunk() *timeSeriesChunk {
+	return newTimeSeriesChunk(ts.compressed, ts.chunkSize)
+}
+
+// replaceChunk replaces chunk i by chunks holding samples, none if it is
+// empty.
+func (ts *TimeSeries) replaceChunk(i int, samples []TimeSeriesSample) {
+	var rebuilt []*timeSeriesChunk
+	for _, s := range samples {
+		if len(rebuilt) == 0 || !rebuilt[len(rebuilt)-1].append(s) {
+			c := ts.newChunk()
+			c.append(s)
+			rebuilt = append(rebuilt, c)
+		}
+	}
+	chunks := make([]*timeSeriesChunk, 0, len(ts.chunks)-1+len(rebuilt))
+	chunks = append(chunks, ts.chunks[:i]...)
+	chunks = append(chunks, rebuilt...)
+	ts.chunks = append(chunks, ts.chunks[i+1:]...)
+}
+
+// trim drops the chunks whose samples are all past the retention.
+func (ts *TimeSeries) trim() {
+	minTimestamp, ok := ts.minTimestamp()
+	if !ok {
+		return
+	}
+	n := 0
+	for n < len(ts.chunks)-1 && ts.chunks[n].last < minTimestamp {
+		n++
+	}
+	if n > 0 {
+		ts.chunks = append([]*timeSeriesChunk(nil), ts.chunks[n:]...)
+	}
+}
+
+// minTimestamp returns the oldest timestamp within the retention.
+func (ts *TimeSeries) minTimestamp() (int64, bool) {
+	last, ok := ts.lastSample()
+	if !ok || ts.retention == 0 {
+		return 0, false
+	}
+	return last.Timestamp - ts.retention, true
+}
+
+// Get returns the newest sample
+func (ts *TimeSeries) Get() (TimeSeriesSample, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.lastSample()
+}
+
+// Range returns the samples with timestamps in [from, to], oldest first
+func (ts *TimeSeries) Range(from, to int64) []TimeSeriesSample {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if minTimestamp, ok := ts.minTimestamp(); ok {
+		from = max(from, minTimestamp)
+	}
+	return ts.rangeSamples(from, to)
+}
+
+// rangeSamples returns the stored samples with timestamps in [from, to],
+// retention aside
+func (ts *TimeSeries) rangeSamples(from, to int64) []TimeSeriesSample {
+	var results []TimeSeriesSample
+	for _, c := range ts.chunks {
+		if c.last < from || c.first > to {
+			continue
+		}
+		for _, s := range c.all() {
+			if s.Timestamp >= from && s.Timestamp <= to {
+				results = append(results, s)
+			}
+		}
+	}
+	return results
+}
+
+// RevRange returns the samples with timestamps in [from, to], newest first
+func (ts *TimeSeries) RevRange(from, to int64) []TimeSeriesSample {
+	results := ts.Range(from, to)
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	return results
+}
+
+// Delete removes the samples with timestamps in [from, to] and returns how
+// many there were
+func (ts *TimeSeries) Delete(from, to int64) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	deleted := 0
+	buckets := make([]map[int64]struct{}, len(ts.rules))
+	for i := range buckets {
+		buckets[i] = make(map[int64]struct{})
+	}
+	for i := len(ts.chunks) - 1; i >= 0; i-- {
+		c := ts.chunks[i]
+		if c.last < from || c.first > to {
+			continue
+		}
+		samples := c.all()
+		kept := samples[:0]
+		for _, s := range samples {
+			if s.Timestamp < from || s.Timestamp > to {
+				kept = append(kept, s)
+				continue
+			}
+			for j, r := range ts.rules {
+				buckets[j][r.bucketStart(s.Timestamp)] = struct{}{}
+			}
+		}
+		deleted += len(samples) - len(kept)
+		ts.replaceChunk(i, kept)
+	}
+	for i, r := range ts.rules {
+		ts.recompact(r, buckets[i])
+	}
+	return deleted
+}
+
+// Alter changes the options of the series. Encoding and chunk size apply
+// to the chunks created from now on.
+func (ts *TimeSeries) Alter(opts TimeSeriesAlterOptions) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if opts.Retention != nil {
+		ts.retention = *opts.Retention
+	}
+	if opts.Encoding != "" {
+		ts.compressed = opts.Encoding != TimeSeriesEncodingUncompressed
+	}
+	if opts.ChunkSize != nil {
+		ts.chunkSize = *opts.ChunkSize
+	}
+	if opts.DuplicatePolicy != "" {
+		ts.duplicatePolicy = opts.DuplicatePolicy
+	}
+	if opts.Labels != nil {
+		ts.labels = make(map[string]string, len(opts.Labels))
+		for k, v := range opts.Labels {
+			ts.labels[k] = v
+		}
+	}
+	ts.trim()
+}
+
+// Labels returns a copy of the labels of the series
+func (ts *TimeSeries) Labels() map[string]string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	labels := make(map[string]string, len(ts.labels))
+	for k, v := range ts.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// MatchLabels reports whether the series has every label of filters with
+// the given value
+func (ts *TimeSeries) MatchLabels(filters map[string]string) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	for k, v := range filters {
+		if value, ok := ts.labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Info returns information about the series, including its chunks if
+// debug is set
+func (ts *TimeSeries) Info(debug bool) TimeSeriesInfo {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	info := TimeSeriesInfo{
+		MemoryUsage:     ts.memoryUsage(),
+		RetentionTime:   ts.retention,
+		ChunkCount:      len(ts.chunks),
+		ChunkSize:       ts.chunkSize,
+		ChunkType:       "compressed",
+		DuplicatePolicy: ts.duplicatePolicy,
+		Labels:          make(map[string]string, len(ts.labels)),
+		SourceKey:       ts.sourceKey,
+		Rules:           ts.ruleList(),
+	}
+	if !ts.compressed {
+		info.ChunkType = "uncompressed"
+	}
+	for k, v := range ts.labels {
+		info.Labels[k] = v
+	}
+	if len(ts.chunks) > 0 {
+		info.FirstTimestamp = ts.chunks[0].first
+		info.LastTimestamp = ts.chunks[len(ts.chunks)-1].last
+	}
+	for _, c := range ts.chunks {
+		info.TotalSamples += c.count
+		if debug {
+			size := c.size()
+			info.Chunks = append(info.Chunks, TimeSeriesChunkInfo{
+				StartTimestamp: c.first,
+				EndTimestamp:   c.last,
+				Samples:        c.count,
+				Size:           size,
+				BytesPerSample: float64(size) / float64(max(c.count, 1)),
+			})
+		}
+	}
+	return info
+}
+
+// GetMemoryUsage returns an estimation of memory usage in bytes
+func (ts *TimeSeries) GetMemoryUsage() int64 {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.memoryUsage()
+}
+
+func (ts *TimeSeries) memoryUsage() int64 {
+	size := int64(unsafe.Sizeof(*ts))
+	for k, v := range ts.labels {
+		size += int64(len(k) + len(v))
+	}
+	size += int64(len(ts.sourceKey))
+	for _, r := range ts.rules {
+		size += int64(unsafe.Sizeof(*r)) + int64(len(r.rule.DestinationKey))
+	}
+	for _, c := range ts.chunks {
+		size += int64(unsafe.Sizeof(*c)) + int64(c.size())
+	}
+	return size
 }
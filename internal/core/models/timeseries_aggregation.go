@@ -0,0 +1,380 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Aggregators of compaction rules and TS.RANGE
+const (
+	TimeSeriesAggAvg   = "avg"
+	TimeSeriesAggSum   = "sum"
+	TimeSeriesAggMin   = "min"
+	TimeSeriesAggMax   = "max"
+	TimeSeriesAggRange = "range"
+	TimeSeriesAggCount = "count"
+	TimeSeriesAggFirst = "first"
+	TimeSeriesAggLast  = "last"
+	TimeSeriesAggStdP  = "std.p"
+	TimeSeriesAggStdS  = "std.s"
+	TimeSeriesAggVarP  = "var.p"
+	TimeSeriesAggVarS  = "var.s"
+	TimeSeriesAggTWA   = "twa"
+
+	// Timestamps reported for a bucket: its start, its end or its middle
+	BucketTimestampStart = "-"
+	BucketTimestampEnd   = "+"
+	BucketTimestampMid   = "~"
+)
+
+// ParseTimeSeriesAggregator returns the canonical name of an aggregator.
+func ParseTimeSeriesAggregator(name string) (string, error) {
+	switch agg := strings.ToLower(name); agg {
+	case TimeSeriesAggAvg, TimeSeriesAggSum, TimeSeriesAggMin, TimeSeriesAggMax,
+		TimeSeriesAggRange, TimeSeriesAggCount, TimeSeriesAggFirst, TimeSeriesAggLast,
+		TimeSeriesAggStdP, TimeSeriesAggStdS, TimeSeriesAggVarP, TimeSeriesAggVarS,
+		TimeSeriesAggTWA:
+		return agg, nil
+	}
+	return "", fmt.Errorf("ERR TSDB: Unknown aggregation type")
+}
+
+// ParseBucketTimestamp returns the canonical form of a BUCKETTIMESTAMP
+// argument.
+func ParseBucketTimestamp(arg string) (string, error) {
+	switch strings.ToLower(arg) {
+	case "-", "start":
+		return BucketTimestampStart, nil
+	case "+", "end":
+		return BucketTimestampEnd, nil
+	case "~", "mid":
+		return BucketTimestampMid, nil
+	}
+	return "", fmt.Errorf("ERR TSDB: unknown BUCKETTIMESTAMP parameter")
+}
+
+// TimeSeriesAggregation aggregates samples into buckets of BucketDuration
+// starting at multiples of it plus Align.
+type TimeSeriesAggregation struct {
+	Type            string
+	BucketDuration  int64
+	Align           int64
+	BucketTimestamp string
+	Empty           bool
+}
+
+// TimeSeriesRangeOptions are the options of TS.RANGE and TS.REVRANGE.
+// Filters apply before the aggregation and Count after it; a Count of 0
+// returns every sample.
+type TimeSeriesRangeOptions struct {
+	Latest        bool
+	FilterByTS    []int64
+	FilterByValue *[2]float64
+	Count         int
+	Aggregation   *TimeSeriesAggregation
+}
+
+// bucketStart returns the start of the bucket holding timestamp.
+func bucketStart(timestamp, duration, align int64) int64 {
+	offset := (timestamp - align) % duration
+	if offset < 0 {
+		offset += duration
+	}
+	return timestamp - offset
+}
+
+// timeSeriesAggregator accumulates the samples of a bucket, oldest first.
+type timeSeriesAggregator struct {
+	kind    string
+	count   int
+	sum     float64
+	min     float64
+	max     float64
+	first   TimeSeriesSample
+	last    TimeSeriesSample
+	mean    float64
+	m2      float64
+	twaArea float64
+}
+
+func newTimeSeriesAggregator(kind string) timeSeriesAggregator {
+	return timeSeriesAggregator{kind: kind}
+}
+
+func (a *timeSeriesAggregator) add(s TimeSeriesSample) {
+	v := s.Value
+	if a.count == 0 {
+		a.first, a.min, a.max = s, v, v
+	} else {
+		a.min = math.Min(a.min, v)
+		a.max = math.Max(a.max, v)
+		a.twaArea += (a.last.Value + v) / 2 * float64(s.Timestamp-a.last.Timestamp)
+	}
+	a.last = s
+	a.count++
+	a.sum += v
+
+	// Welford's online variance
+	delta := v - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (v - a.mean)
+}
+
+// result returns the aggregate of the bucket [start, end). prev and next
+// are the samples around the bucket, if known; they only matter to twa
+// and to empty buckets.
+func (a *timeSeriesAggregator) result(start, end int64, prev, next *TimeSeriesSample) float64 {
+	if a.count == 0 {
+		switch a.kind {
+		case TimeSeriesAggSum, TimeSeriesAggCount:
+			return 0
+		case TimeSeriesAggLast:
+			if prev != nil {
+				return prev.Value
+			}
+		case TimeSeriesAggTWA:
+			if prev != nil && next != nil {
+				return (interpolate(*prev, *next, start) + interpolate(*prev, *next, end)) / 2
+			}
+		}
+		return math.NaN()
+	}
+
+	switch a.kind {
+	case TimeSeriesAggAvg:
+		return a.sum / float64(a.count)
+	case TimeSeriesAggSum:
+		return a.sum
+	case TimeSeriesAggMin:
+		return a.min
+	case TimeSeriesAggMax:
+		return a.max
+	case TimeSeriesAggRange:
+		return a.max - a.min
+	case TimeSeriesAggCount:
+		return float64(a.count)
+	case TimeSeriesAggFirst:
+		return a.first.Value
+	case TimeSeriesAggLast:
+		return a.last.Value
+	case TimeSeriesAggStdP:
+		return math.Sqrt(a.m2 / float64(a.count))
+	case TimeSeriesAggStdS:
+		return math.Sqrt(a.sampleVariance())
+	case TimeSeriesAggVarP:
+		return a.m2 / float64(a.count)
+	case TimeSeriesAggVarS:
+		return a.sampleVariance()
+	case TimeSeriesAggTWA:
+		return a.twa(start, end, prev, next)
+	}
+	return math.NaN()
+}
+
+func (a *timeSeriesAggregator) sampleVariance() float64 {
+	if a.count < 2 {
+		return 0
+	}
+	return a.m2 / float64(a.count-1)
+}
+
+// twa returns the time weighted average of the bucket, the samples being
+// joined by straight lines. The line is extended to the bounds of the
+// bucket towards prev and next when they are known.
+func (a *timeSeriesAggregator) twa(start, end int64, prev, next *TimeSeriesSample) float64 {
+	area := a.twaArea
+	from, to := a.first.Timestamp, a.last.Timestamp
+	if prev != nil && from > start {
+		v := interpolate(*prev, a.first, start)
+		area += (v + a.first.Value) / 2 * float64(from-start)
+		from = start
+	}
+	if next != nil && to < end {
+		v := interpolate(a.last, *next, end)
+		area += (a.last.Value + v) / 2 * float64(end-to)
+		to = end
+	}
+	if to == from {
+		return a.last.Value
+	}
+	return area / float64(to-from)
+}
+
+// interpolate returns the value at timestamp of the line through a and b.
+func interpolate(a, b TimeSeriesSample, timestamp int64) float64 {
+	if a.Timestamp == b.Timestamp {
+		return b.Value
+	}
+	return a.Value + (b.Value-a.Value)*float64(timestamp-a.Timestamp)/float64(b.Timestamp-a.Timestamp)
+}
+
+// QueryTimeSeries applies the filters, aggregation and count of opts to
+// samples, which must be oldest first. Samples are returned newest first if
+// reverse is set.
+func QueryTimeSeries(samples []TimeSeriesSample, opts TimeSeriesRangeOptions, reverse bool) []TimeSeriesSample {
+	if len(opts.FilterByTS) > 0 || opts.FilterByValue != nil {
+		samples = filterSamples(samples, opts)
+	}
+	if opts.Aggregation != nil {
+		samples = aggregateSamples(samples, *opts.Aggregation)
+	} else {
+		samples = append([]TimeSeriesSample(nil), samples...)
+	}
+
+	if reverse {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if opts.Count > 0 && len(samples) > opts.Count {
+		samples = samples[:opts.Count]
+	}
+	return samples
+}
+
+func filterSamples(samples []TimeSeriesSample, opts TimeSeriesRangeOptions) []TimeSeriesSample {
+	var timestamps map[int64]struct{}
+	if len(opts.FilterByTS) > 0 {
+		timestamps = make(map[int64]struct{}, len(opts.FilterByTS))
+		for _, ts := range opts.FilterByTS {
+			timestamps[ts] = struct{}{}
+		}
+	}
+
+	filtered := make([]TimeSeriesSample, 0, len(samples))
+	for _, s := range samples {
+		if timestamps != nil {
+			if _, ok := timestamps[s.Timestamp]; !ok {
+				continue
+			}
+		}
+		if opts.FilterByValue != nil && (s.Value < opts.FilterByValue[0] || s.Value > opts.FilterByValue[1]) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+// aggregateSamples returns one sample per bucket holding samples, and per
+// bucket between them too if agg.Empty is set.
+func aggregateSamples(samples []TimeSeriesSample, agg TimeSeriesAggregation) []TimeSeriesSample {
+	var results []TimeSeriesSample
+	emit := func(start int64, a *timeSeriesAggregator, prev, next *TimeSeriesSample) {
+		timestamp := start
+		switch agg.BucketTimestamp {
+		case BucketTimestampEnd:
+			timestamp = start + agg.BucketDuration
+		case BucketTimestampMid:
+			timestamp = start + agg.BucketDuration/2
+		}
+		value := a.result(start, start+agg.BucketDuration, prev, next)
+		results = append(results, TimeSeriesSample{Timestamp: timestamp, Value: value})
+	}
+
+	var prev *TimeSeriesSample
+	for i := 0; i < len(samples); {
+		start := bucketStart(samples[i].Timestamp, agg.BucketDuration, agg.Align)
+		end := start + agg.BucketDuration
+
+		if agg.Empty && prev != nil {
+			for empty := bucketStart(prev.Timestamp, agg.BucketDuration, agg.Align) + agg.BucketDuration; empty < start; empty += agg.BucketDuration {
+				a := newTimeSeriesAggregator(agg.Type)
+				emit(empty, &a, prev, &samples[i])
+			}
+		}
+
+		a := newTimeSeriesAggregator(agg.Type)
+		j := i
+		for ; j < len(samples) && samples[j].Timestamp < end; j++ {
+			a.add(samples[j])
+		}
+		var next *TimeSeriesSample
+		if j < len(samples) {
+			next = &samples[j]
+		}
+		emit(start, &a, prev, next)
+
+		prev = &samples[j-1]
+		i = j
+	}
+	return results
+}
+
+// TimeSeriesResult is a series matched by TS.MRANGE or TS.MGET
+type TimeSeriesResult struct {
+	Key     string
+	Labels  map[string]string
+	Samples []TimeSeriesSample
+}
+
+// TimeSeriesGroup is the series reduced from the results sharing the value
+// of the GROUPBY label
+type TimeSeriesGroup struct {
+	Label   string
+	Value   string
+	Reducer string
+	Sources []string
+	Samples []TimeSeriesSample
+}
+
+// ParseTimeSeriesReducer returns the canonical name of a GROUPBY reducer.
+func ParseTimeSeriesReducer(name string) (string, error) {
+	switch reducer := strings.ToLower(name); reducer {
+	case TimeSeriesAggAvg, TimeSeriesAggSum, TimeSeriesAggMin, TimeSeriesAggMax,
+		TimeSeriesAggRange, TimeSeriesAggCount, TimeSeriesAggStdP, TimeSeriesAggStdS,
+		TimeSeriesAggVarP, TimeSeriesAggVarS:
+		return reducer, nil
+	}
+	return "", fmt.Errorf("ERR TSDB: invalid reducer")
+}
+
+// GroupTimeSeries groups results by their value of label, which results
+// without it are left out of, and reduces the values each group has at
+// every timestamp. Groups are sorted by value and their samples are newest
+// first if reverse is set.
+func GroupTimeSeries(results []TimeSeriesResult, label, reducer string, reverse bool) []TimeSeriesGroup {
+	byValue := make(map[string][]TimeSeriesResult)
+	for _, r := range results {
+		if value, ok := r.Labels[label]; ok {
+			byValue[value] = append(byValue[value], r)
+		}
+	}
+	values := make([]string, 0, len(byValue))
+	for value := range byValue {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	groups := make([]TimeSeriesGroup, 0, len(values))
+	for _, value := range values {
+		group := TimeSeriesGroup{Label: label, Value: value, Reducer: reducer}
+		reduced := make(map[int64]*timeSeriesAggregator)
+		for _, r := range byValue[value] {
+			group.Sources = append(group.Sources, r.Key)
+			for _, s := range r.Samples {
+				agg, ok := reduced[s.Timestamp]
+				if !ok {
+					a := newTimeSeriesAggregator(reducer)
+					agg = &a
+					reduced[s.Timestamp] = agg
+				}
+				agg.add(s)
+			}
+		}
+		for timestamp, agg := range reduced {
+			value := agg.result(timestamp, timestamp, nil, nil)
+			group.Samples = append(group.Samples, TimeSeriesSample{Timestamp: timestamp, Value: value})
+		}
+		sort.Slice(group.Samples, func(i, j int) bool {
+			if reverse {
+				return group.Samples[i].Timestamp > group.Samples[j].Timestamp
+			}
+			return group.Samples[i].Timestamp < group.Samples[j].Timestamp
+		})
+		groups = append(groups, group)
+	}
+	return groups
+}
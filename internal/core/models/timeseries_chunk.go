@@ -0,0 +1,277 @@
+package models
+
+import (
+	"math"
+	"math/bits"
+	"unsafe"
+)
+
+// timeSeriesChunk holds the samples of a time range, in timestamp order.
+// An uncompressed chunk keeps them as they are. A compressed chunk keeps a
+// Gorilla bit stream: the first sample verbatim, then every timestamp as
+// the delta of its delta from the previous one and every value as the XOR
+// with the previous value, both with variable length codes. A chunk is
+// full once the next sample would take it past its size in bytes.
+type timeSeriesChunk struct {
+	compressed bool
+	maxSize    int
+	count      int
+	first      int64
+	last       int64
+
+	samples []TimeSeriesSample
+
+	stream  bitStream
+	enc     gorillaState
+	lastVal float64
+}
+
+// gorillaState is what encoding the next sample depends on.
+type gorillaState struct {
+	prevDelta int64
+	prevBits  uint64
+	leading   uint8
+	trailing  uint8
+	window    bool
+}
+
+// bitStream is an append only sequence of bits, most significant first.
+// Bits past len are always zero.
+type bitStream struct {
+	data []byte
+	len  int
+}
+
+func (b *bitStream) writeBit(bit bool) {
+	if b.len%8 == 0 {
+		b.data = append(b.data, 0)
+	}
+	if bit {
+		b.data[b.len/8] |= 0x80 >> (b.len % 8)
+	}
+	b.len++
+}
+
+func (b *bitStream) writeBits(v uint64, n int) {
+	for n > 0 {
+		if b.len%8 == 0 {
+			b.data = append(b.data, 0)
+		}
+		free := 8 - b.len%8
+		take := min(free, n)
+		chunk := byte(v>>(n-take)) & byte(1<<take-1)
+		b.data[b.len/8] |= chunk << (free - take)
+		b.len += take
+		n -= take
+	}
+}
+
+// truncate drops the bits from n on.
+func (b *bitStream) truncate(n int) {
+	b.data = b.data[:(n+7)/8]
+	if n%8 != 0 {
+		b.data[n/8] &= byte(0xff << (8 - n%8))
+	}
+	b.len = n
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) readBit() bool {
+	bit := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return bit
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for n > 0 {
+		avail := 8 - r.pos%8
+		take := min(avail, n)
+		chunk := r.data[r.pos/8] >> (avail - take) & byte(1<<take-1)
+		v = v<<take | uint64(chunk)
+		r.pos += take
+		n -= take
+	}
+	return v
+}
+
+// Timestamp delta of delta classes: a prefix of ones closed by a zero (none
+// for the last class) followed by a two's complement value of that width.
+var gorillaDODClasses = []struct {
+	prefix, prefixLen, bits int
+}{
+	{0b10, 2, 7},
+	{0b110, 3, 9},
+	{0b1110, 4, 12},
+	{0b11110, 5, 32},
+	{0b11111, 5, 64},
+}
+
+// newTimeSeriesChunk allocates a chunk of maxSize bytes up front, as every
+// chunk but the newest is full anyway.
+func newTimeSeriesChunk(compressed bool, maxSize int) *timeSeriesChunk {
+	c := &timeSeriesChunk{compressed: compressed, maxSize: maxSize}
+	if compressed {
+		c.stream.data = make([]byte, 0, maxSize)
+	} else {
+		c.samples = make([]TimeSeriesSample, 0, maxSize/int(unsafe.Sizeof(TimeSeriesSample{})))
+	}
+	return c
+}
+
+// append adds a sample newer than every sample of the chunk and reports
+// whether it fit.
+func (c *timeSeriesChunk) append(s TimeSeriesSample) bool {
+	if !c.compressed {
+		if c.count > 0 && (c.count+1)*int(unsafe.Sizeof(s)) > c.maxSize {
+			return false
+		}
+		c.samples = append(c.samples, s)
+	} else if !c.encode(s) {
+		return false
+	}
+
+	if c.count == 0 {
+		c.first = s.Timestamp
+	}
+	c.last = s.Timestamp
+	c.lastVal = s.Value
+	c.count++
+	return true
+}
+
+func (c *timeSeriesChunk) encode(s TimeSeriesSample) bool {
+	valueBits := math.Float64bits(s.Value)
+	if c.count == 0 {
+		c.stream.writeBits(uint64(s.Timestamp), 64)
+		c.stream.writeBits(valueBits, 64)
+		c.enc = gorillaState{prevBits: valueBits}
+		return true
+	}
+
+	mark, saved := c.stream.len, c.enc
+	delta := s.Timestamp - c.last
+	c.writeDOD(delta - c.enc.prevDelta)
+	c.enc.prevDelta = delta
+	c.writeXOR(valueBits)
+
+	if len(c.stream.data) > c.maxSize {
+		c.stream.truncate(mark)
+		c.enc = saved
+		// Writing past maxSize grew the buffer
+		if cap(c.stream.data) > c.maxSize {
+			c.stream.data = append(make([]byte, 0, c.maxSize), c.stream.data...)
+		}
+		return false
+	}
+	return true
+}
+
+func (c *timeSeriesChunk) writeDOD(dod int64) {
+	if dod == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	for _, class := range gorillaDODClasses {
+		limit := int64(1) << (class.bits - 1)
+		if class.bits == 64 || (dod >= -limit && dod < limit) {
+			c.stream.writeBits(uint64(class.prefix), class.prefixLen)
+			c.stream.writeBits(uint64(dod)&(1<<class.bits-1), class.bits)
+			return
+		}
+	}
+}
+
+func (c *timeSeriesChunk) writeXOR(valueBits uint64) {
+	xor := valueBits ^ c.enc.prevBits
+	c.enc.prevBits = valueBits
+	if xor == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	c.stream.writeBit(true)
+
+	leading := uint8(min(bits.LeadingZeros64(xor), 31))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if c.enc.window && leading >= c.enc.leading && trailing >= c.enc.trailing {
+		// The meaningful bits fit in the previous window
+		c.stream.writeBit(false)
+		c.stream.writeBits(xor>>c.enc.trailing, 64-int(c.enc.leading)-int(c.enc.trailing))
+		return
+	}
+
+	c.stream.writeBit(true)
+	significant := 64 - int(leading) - int(trailing)
+	c.stream.writeBits(uint64(leading), 5)
+	// 64 significant bits are written as 0
+	c.stream.writeBits(uint64(significant)&0x3f, 6)
+	c.stream.writeBits(xor>>trailing, significant)
+	c.enc.leading, c.enc.trailing, c.enc.window = leading, trailing, true
+}
+
+// all returns the samples of the chunk.
+func (c *timeSeriesChunk) all() []TimeSeriesSample {
+	if !c.compressed {
+		return append([]TimeSeriesSample(nil), c.samples...)
+	}
+
+	samples := make([]TimeSeriesSample, 0, c.count)
+	if c.count == 0 {
+		return samples
+	}
+	r := bitReader{data: c.stream.data}
+	ts := int64(r.readBits(64))
+	valueBits := r.readBits(64)
+	samples = append(samples, TimeSeriesSample{Timestamp: ts, Value: math.Float64frombits(valueBits)})
+
+	var delta int64
+	var leading, trailing int
+	for i := 1; i < c.count; i++ {
+		delta += readDOD(&r)
+		ts += delta
+
+		if r.readBit() {
+			if r.readBit() {
+				leading = int(r.readBits(5))
+				significant := int(r.readBits(6))
+				if significant == 0 {
+					significant = 64
+				}
+				trailing = 64 - leading - significant
+			}
+			valueBits ^= r.readBits(64-leading-trailing) << trailing
+		}
+		samples = append(samples, TimeSeriesSample{Timestamp: ts, Value: math.Float64frombits(valueBits)})
+	}
+	return samples
+}
+
+func readDOD(r *bitReader) int64 {
+	if !r.readBit() {
+		return 0
+	}
+	for i, class := range gorillaDODClasses {
+		// The prefix of the last class has no closing zero
+		last := i == len(gorillaDODClasses)-1
+		if last || !r.readBit() {
+			v := r.readBits(class.bits)
+			if class.bits < 64 && v&(1<<(class.bits-1)) != 0 {
+				v |= ^uint64(0) << class.bits
+			}
+			return int64(v)
+		}
+	}
+	return 0
+}
+
+// size returns the bytes taken by the samples of the chunk.
+func (c *timeSeriesChunk) size() int {
+	if !c.compressed {
+		return cap(c.samples) * int(unsafe.Sizeof(TimeSeriesSample{}))
+	}
+	return cap(c.stream.data)
+}
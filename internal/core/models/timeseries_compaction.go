@@ -0,0 +1,212 @@
+package models
+
+// TimeSeriesCompaction is a sample a compaction rule writes into its
+// destination, or removes from it if Deleted is set.
+type TimeSeriesCompaction struct {
+	DestinationKey string
+	Sample         TimeSeriesSample
+	Deleted        bool
+}
+
+// timeSeriesCompaction is a compaction rule and its open bucket, the one
+// holding the newest sample. The open bucket is aggregated as samples are
+// appended and written once a sample of a later bucket arrives. Changes to
+// older buckets rewrite them from the samples of the source.
+type timeSeriesCompaction struct {
+	rule  TimeSeriesRule
+	open  bool
+	start int64
+	agg   timeSeriesAggregator
+	// prev is the newest sample before the open bucket
+	prev *TimeSeriesSample
+}
+
+func (r *timeSeriesCompaction) bucketStart(timestamp int64) int64 {
+	return bucketStart(timestamp, r.rule.BucketSize, r.rule.AlignTimestamp)
+}
+
+// AddRule adds a compaction rule. Its first bucket is the one of the next
+// sample.
+func (ts *TimeSeries) AddRule(rule TimeSeriesRule) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.rules = append(ts.rules, &timeSeriesCompaction{rule: rule})
+}
+
+// DeleteRule removes the compaction rules into destinationKey and reports
+// whether there was any
+func (ts *TimeSeries) DeleteRule(destinationKey string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	rules := make([]*timeSeriesCompaction, 0, len(ts.rules))
+	for _, r := range ts.rules {
+		if r.rule.DestinationKey != destinationKey {
+			rules = append(rules, r)
+		}
+	}
+	deleted := len(rules) != len(ts.rules)
+	ts.rules = rules
+	return deleted
+}
+
+// Rules returns the compaction rules of the series
+func (ts *TimeSeries) Rules() []TimeSeriesRule {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.ruleList()
+}
+
+func (ts *TimeSeries) ruleList() []TimeSeriesRule {
+	rules := make([]TimeSeriesRule, len(ts.rules))
+	for i, r := range ts.rules {
+		rules[i] = r.rule
+	}
+	return rules
+}
+
+// SetSourceKey records the series compacted into this one, "" for none
+func (ts *TimeSeries) SetSourceKey(key string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.sourceKey = key
+}
+
+// SourceKey returns the series compacted into this one
+func (ts *TimeSeries) SourceKey() string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.sourceKey
+}
+
+// TakeCompactions returns the samples the compaction rules produced since
+// the last call, for the caller to write into their destinations.
+func (ts *TimeSeries) TakeCompactions() []TimeSeriesCompaction {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	compacted := ts.compacted
+	ts.compacted = nil
+	return compacted
+}
+
+// OpenBucket returns the aggregate so far of the open bucket of the rule
+// into destinationKey
+func (ts *TimeSeries) OpenBucket(destinationKey string) (TimeSeriesSample, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	for _, r := range ts.rules {
+		if r.rule.DestinationKey == destinationKey && r.open {
+			value := r.agg.result(r.start, r.start+r.rule.BucketSize, r.prev, nil)
+			return TimeSeriesSample{Timestamp: r.start, Value: value}, true
+		}
+	}
+	return TimeSeriesSample{}, false
+}
+
+// compact feeds the compaction rules with s, which was just upserted. last
+// is the newest sample before it, if hadLast.
+func (ts *TimeSeries) compact(s, last TimeSeriesSample, hadLast bool) {
+	appended := !hadLast || s.Timestamp > last.Timestamp
+	for _, r := range ts.rules {
+		start := r.bucketStart(s.Timestamp)
+		switch {
+		case !appended:
+			ts.recompact(r, map[int64]struct{}{start: {}})
+		case !r.open:
+			r.open, r.start = true, start
+			ts.reopen(r)
+		case start > r.start:
+			value := r.agg.result(r.start, r.start+r.rule.BucketSize, r.prev, &s)
+			ts.emit(r, TimeSeriesSample{Timestamp: r.start, Value: value}, false)
+			prev := r.agg.last
+			r.prev = &prev
+			r.start, r.agg = start, newTimeSeriesAggregator(r.rule.AggregationType)
+			r.agg.add(s)
+		default:
+			r.agg.add(s)
+		}
+	}
+}
+
+// recompact rewrites the buckets of r starting at the given timestamps
+// after their samples changed.
+func (ts *TimeSeries) recompact(r *timeSeriesCompaction, buckets map[int64]struct{}) {
+	for start := range buckets {
+		if r.open && start == r.start {
+			ts.reopen(r)
+			continue
+		}
+
+		end := start + r.rule.BucketSize
+		samples := ts.rangeSamples(start, end-1)
+		if len(samples) == 0 {
+			ts.emit(r, TimeSeriesSample{Timestamp: start}, true)
+			continue
+		}
+		agg := newTimeSeriesAggregator(r.rule.AggregationType)
+		for _, s := range samples {
+			agg.add(s)
+		}
+		value := agg.result(start, end, ts.sampleBefore(start), ts.sampleFrom(end))
+		ts.emit(r, TimeSeriesSample{Timestamp: start, Value: value}, false)
+	}
+	if r.open {
+		r.prev = ts.sampleBefore(r.start)
+	}
+}
+
+// reopen aggregates the open bucket of r again from the samples of the
+// series, closing it if there is none.
+func (ts *TimeSeries) reopen(r *timeSeriesCompaction) {
+	samples := ts.rangeSamples(r.start, r.start+r.rule.BucketSize-1)
+	if len(samples) == 0 {
+		r.open, r.prev = false, nil
+		return
+	}
+	r.agg = newTimeSeriesAggregator(r.rule.AggregationType)
+	for _, s := range samples {
+		r.agg.add(s)
+	}
+	r.prev = ts.sampleBefore(r.start)
+}
+
+func (ts *TimeSeries) emit(r *timeSeriesCompaction, s TimeSeriesSample, deleted bool) {
+	ts.compacted = append(ts.compacted, TimeSeriesCompaction{
+		DestinationKey: r.rule.DestinationKey,
+		Sample:         s,
+		Deleted:        deleted,
+	})
+}
+
+// sampleBefore returns the newest sample older than timestamp
+func (ts *TimeSeries) sampleBefore(timestamp int64) *TimeSeriesSample {
+	for i := len(ts.chunks) - 1; i >= 0; i-- {
+		if ts.chunks[i].first >= timestamp {
+			continue
+		}
+		samples := ts.chunks[i].all()
+		for j := len(samples) - 1; j >= 0; j-- {
+			if samples[j].Timestamp < timestamp {
+				return &samples[j]
+			}
+		}
+	}
+	return nil
+}
+
+// sampleFrom returns the oldest sample not older than timestamp
+func (ts *TimeSeries) sampleFrom(timestamp int64) *TimeSeriesSample {
+	for _, c := range ts.chunks {
+		if c.last < timestamp {
+			continue
+		}
+		samples := c.all()
+		for j := range samples {
+			if samples[j].Timestamp >= timestamp {
+				return &samples[j]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TimeSeriesFilter is a label filter of TS.MRANGE, TS.MGET and
+// TS.QUERYINDEX:
+//
+//	label=value       the label is value
+//	label!=value      the label is not value or is missing
+//	label=            the label is missing
+//	label!=           the label is present
+//	label=(a,b)       the label is one of a and b
+//	label!=(a,b)      the label is neither a nor b, or is missing
+type TimeSeriesFilter struct {
+	Label  string
+	Negate bool
+	Values []string
+}
+
+// ParseTimeSeriesFilter parses a label filter expression.
+func ParseTimeSeriesFilter(expr string) (TimeSeriesFilter, error) {
+	var f TimeSeriesFilter
+	i := strings.IndexByte(expr, '=')
+	if i <= 0 || (i == 1 && expr[0] == '!') {
+		return f, fmt.Errorf("ERR TSDB: failed parsing labels")
+	}
+	f.Label, f.Negate = expr[:i], expr[i-1] == '!'
+	if f.Negate {
+		f.Label = expr[:i-1]
+	}
+
+	value := expr[i+1:]
+	switch {
+	case value == "":
+	case strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")"):
+		for _, v := range strings.Split(value[1:len(value)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				f.Values = append(f.Values, v)
+			}
+		}
+		if len(f.Values) == 0 {
+			return f, fmt.Errorf("ERR TSDB: failed parsing labels")
+		}
+	default:
+		f.Values = []string{value}
+	}
+	return f, nil
+}
+
+// ParseTimeSeriesFilters parses the filter expressions of a query, which
+// needs at least one label=value or label=(a,b) filter.
+func ParseTimeSeriesFilters(exprs []string) ([]TimeSeriesFilter, error) {
+	filters := make([]TimeSeriesFilter, 0, len(exprs))
+	matcher := false
+	for _, expr := range exprs {
+		f, err := ParseTimeSeriesFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		matcher = matcher || f.isMatcher()
+		filters = append(filters, f)
+	}
+	if !matcher {
+		return nil, fmt.Errorf("ERR TSDB: please provide at least one matcher")
+	}
+	return filters, nil
+}
+
+// isMatcher reports whether the filter only accepts given label values, so
+// the series it accepts can be looked up in the index
+func (f TimeSeriesFilter) isMatcher() bool {
+	return !f.Negate && len(f.Values) > 0
+}
+
+// Matches reports whether a series with the given labels passes the filter
+func (f TimeSeriesFilter) Matches(labels map[string]string) bool {
+	v, ok := labels[f.Label]
+	if len(f.Values) == 0 {
+		return ok == f.Negate
+	}
+	in := false
+	if ok {
+		for _, value := range f.Values {
+			if value == v {
+				in = true
+				break
+			}
+		}
+	}
+	return in != f.Negate
+}
+
+// TimeSeriesIndex maps label values to the keys of the series having them.
+type TimeSeriesIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]map[string]struct{} // label -> value -> keys
+	labels   map[string]map[string]string              // key -> labels
+}
+
+func NewTimeSeriesIndex() *TimeSeriesIndex {
+	return &TimeSeriesIndex{
+		postings: make(map[string]map[string]map[string]struct{}),
+		labels:   make(map[string]map[string]string),
+	}
+}
+
+// Set indexes the series at key under labels, replacing its previous labels
+func (idx *TimeSeriesIndex) Set(key string, labels map[string]string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(key)
+	copied := make(map[string]string, len(labels))
+	for label, value := range labels {
+		copied[label] = value
+		values, ok := idx.postings[label]
+		if !ok {
+			values = make(map[string]map[string]struct{})
+			idx.postings[label] = values
+		}
+		keys, ok := values[value]
+		if !ok {
+			keys = make(map[string]struct{})
+			values[value] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	idx.labels[key] = copied
+}
+
+// Remove drops the series at key from the index
+func (idx *TimeSeriesIndex) Remove(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(key)
+}
+
+func (idx *TimeSeriesIndex) remove(key string) {
+	for label, value := range idx.labels[key] {
+		keys := idx.postings[label][value]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(idx.postings[label], value)
+			if len(idx.postings[label]) == 0 {
+				delete(idx.postings, label)
+			}
+		}
+	}
+	delete(idx.labels, key)
+}
+
+// Query returns the keys of the series passing every filter, sorted. The
+// filters must hold a matcher.
+func (idx *TimeSeriesIndex) Query(filters []TimeSeriesFilter) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Start from the matcher accepting the fewest series
+	var candidates map[string]struct{}
+	first := true
+	for _, f := range filters {
+		if !f.isMatcher() {
+			continue
+		}
+		keys := idx.lookup(f)
+		if first || len(keys) < len(candidates) {
+			candidates, first = keys, false
+		}
+	}
+
+	var keys []string
+	for key := range candidates {
+		seriesLabels := idx.labels[key]
+		matches := true
+		for _, f := range filters {
+			if !f.Matches(seriesLabels) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookup returns the keys of the series a matcher accepts
+func (idx *TimeSeriesIndex) lookup(f TimeSeriesFilter) map[string]struct{} {
+	values := idx.postings[f.Label]
+	if len(f.Values) == 1 {
+		return values[f.Values[0]]
+	}
+	keys := make(map[string]struct{})
+	for _, value := range f.Values {
+		for key := range values[value] {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,356 @@
+package models
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeSeriesChunkRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := []float64{0, -0.0, 1, 1, 1.5, math.MaxFloat64, math.SmallestNonzeroFloat64,
+		math.Inf(1), math.Inf(-1), -42.125, 3}
+	var samples []TimeSeriesSample
+	ts := int64(1_700_000_000_000)
+	deltas := []int64{1000, 1000, 1001, 999, 1, 64, -63, 300, 4000, 1 << 40, 1}
+	for i, delta := range deltas {
+		ts += delta
+		samples = append(samples, TimeSeriesSample{Timestamp: ts, Value: values[i]})
+	}
+	for i := 0; i < 500; i++ {
+		ts += rng.Int63n(100000)
+		samples = append(samples, TimeSeriesSample{Timestamp: ts, Value: rng.NormFloat64() * 1e6})
+	}
+	samples = append(samples, TimeSeriesSample{Timestamp: math.MaxInt64, Value: math.NaN()})
+
+	c := newTimeSeriesChunk(true, TimeSeriesMaxChunkSize)
+	for _, s := range samples {
+		require.True(t, c.append(s))
+	}
+	decoded := c.all()
+	require.Len(t, decoded, len(samples))
+	for i, s := range samples {
+		assert.Equal(t, s.Timestamp, decoded[i].Timestamp)
+		assert.Equal(t, math.Float64bits(s.Value), math.Float64bits(decoded[i].Value), "sample %d", i)
+	}
+}
+
+func TestTimeSeriesChunkCompression(t *testing.T) {
+	c := newTimeSeriesChunk(true, TimeSeriesDefaultChunkSize)
+	n := 0
+	for c.append(TimeSeriesSample{Timestamp: int64(n) * 1000, Value: 20}) {
+		n++
+	}
+	// A regular series takes two bits per sample
+	assert.Greater(t, n, 4*(TimeSeriesDefaultChunkSize-32))
+	assert.Len(t, c.all(), n)
+	assert.LessOrEqual(t, len(c.stream.data), TimeSeriesDefaultChunkSize)
+}
+
+func TestTimeSeriesSplitsChunks(t *testing.T) {
+	for _, encoding := range []string{TimeSeriesEncodingCompressed, TimeSeriesEncodingUncompressed} {
+		opts := DefaultTimeSeriesOptions()
+		opts.Encoding = encoding
+		opts.ChunkSize = 128
+		ts := NewTimeSeries(opts)
+
+		rng := rand.New(rand.NewSource(2))
+		for _, i := range rng.Perm(1000) {
+			_, err := ts.Add(int64(i), rng.Float64(), "")
+			require.NoError(t, err)
+		}
+
+		samples := ts.Range(0, math.MaxInt64)
+		require.Len(t, samples, 1000, encoding)
+		for i, s := range samples {
+			assert.Equal(t, int64(i), s.Timestamp)
+		}
+
+		info := ts.Info(true)
+		assert.Equal(t, 1000, info.TotalSamples)
+		assert.Greater(t, info.ChunkCount, 1)
+		require.Len(t, info.Chunks, info.ChunkCount)
+		for _, chunk := range info.Chunks {
+			assert.Equal(t, 128, chunk.Size)
+			assert.LessOrEqual(t, chunk.StartTimestamp, chunk.EndTimestamp)
+		}
+	}
+}
+
+func TestTimeSeriesDuplicatePolicies(t *testing.T) {
+	expected := map[string]float64{
+		DuplicatePolicyFirst: 5,
+		DuplicatePolicyLast:  3,
+		DuplicatePolicyMin:   3,
+		DuplicatePolicyMax:   5,
+		DuplicatePolicySum:   8,
+	}
+	for policy, value := range expected {
+		opts := DefaultTimeSeriesOptions()
+		opts.DuplicatePolicy = policy
+		ts := NewTimeSeries(opts)
+		for i := int64(0); i < 3; i++ {
+			_, err := ts.Add(i*10, 5, "")
+			require.NoError(t, err)
+		}
+		// Both in the middle and at the end of the series
+		_, err := ts.Add(10, 3, "")
+		require.NoError(t, err)
+		_, err = ts.Add(20, 3, "")
+		require.NoError(t, err)
+
+		samples := ts.Range(0, 100)
+		require.Len(t, samples, 3, policy)
+		assert.Equal(t, value, samples[1].Value, policy)
+		assert.Equal(t, value, samples[2].Value, policy)
+	}
+
+	ts := NewTimeSeries(DefaultTimeSeriesOptions())
+	_, err := ts.Add(10, 1, "")
+	require.NoError(t, err)
+	_, err = ts.Add(10, 2, "")
+	assert.ErrorIs(t, err, ErrTimeSeriesDuplicate)
+	_, err = ts.Add(10, 2, DuplicatePolicyLast)
+	require.NoError(t, err)
+	sample, _ := ts.Get()
+	assert.Equal(t, 2.0, sample.Value)
+}
+
+func TestTimeSeriesRetention(t *testing.T) {
+	opts := DefaultTimeSeriesOptions()
+	opts.Retention = 100
+	opts.ChunkSize = 64
+	ts := NewTimeSeries(opts)
+	for i := int64(0); i <= 1000; i++ {
+		_, err := ts.Add(i, float64(i), "")
+		require.NoError(t, err)
+	}
+
+	samples := ts.Range(0, 1000)
+	require.Len(t, samples, 101)
+	assert.Equal(t, int64(900), samples[0].Timestamp)
+
+	// Only the chunks holding nothing but expired samples are dropped
+	info := ts.Info(true)
+	assert.Less(t, info.TotalSamples, 200)
+	assert.LessOrEqual(t, info.FirstTimestamp, int64(900))
+	assert.Less(t, info.Chunks[0].EndTimestamp-info.Chunks[0].StartTimestamp, int64(100))
+
+	_, err := ts.Add(899, 1, "")
+	assert.ErrorIs(t, err, ErrTimeSeriesTooOld)
+	_, err = ts.Add(950, 1, DuplicatePolicySum)
+	require.NoError(t, err)
+	samples = ts.Range(950, 950)
+	require.Len(t, samples, 1)
+	assert.Equal(t, 951.0, samples[0].Value)
+}
+
+func TestTimeSeriesDeleteAndIncrBy(t *testing.T) {
+	opts := DefaultTimeSeriesOptions()
+	opts.ChunkSize = 48
+	ts := NewTimeSeries(opts)
+	for i := int64(0); i < 100; i++ {
+		_, err := ts.Add(i, 1, "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 50, ts.Delete(25, 74))
+	assert.Len(t, ts.Range(0, 100), 50)
+	assert.Empty(t, ts.Range(25, 74))
+
+	value, err := ts.IncrBy(99, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, value)
+	_, err = ts.IncrBy(50, 1)
+	assert.Error(t, err)
+
+	assert.Equal(t, 50, ts.Delete(0, 100))
+	_, ok := ts.Get()
+	assert.False(t, ok)
+	assert.Zero(t, ts.Info(false).ChunkCount)
+}
+
+func TestTimeSeriesAggregators(t *testing.T) {
+	samples := []TimeSeriesSample{{10, 2}, {12, 4}, {15, 4}, {18, 5}, {25, 7}}
+	expected := map[string]float64{
+		TimeSeriesAggAvg:   3.75,
+		TimeSeriesAggSum:   15,
+		TimeSeriesAggMin:   2,
+		TimeSeriesAggMax:   5,
+		TimeSeriesAggRange: 3,
+		TimeSeriesAggCount: 4,
+		TimeSeriesAggFirst: 2,
+		TimeSeriesAggLast:  5,
+		TimeSeriesAggVarP:  1.1875,
+		TimeSeriesAggVarS:  1.1875 * 4 / 3,
+		TimeSeriesAggStdP:  math.Sqrt(1.1875),
+		TimeSeriesAggStdS:  math.Sqrt(1.1875 * 4 / 3),
+		// Area 6 + 12 + 13.5 up to 18, then up to 5+4/7 at 20 on the way to 25
+		TimeSeriesAggTWA: (6 + 12 + 13.5 + (5 + 5 + 4.0/7)) / 10,
+	}
+	for agg, value := range expected {
+		results := QueryTimeSeries(samples, TimeSeriesRangeOptions{
+			Aggregation: &TimeSeriesAggregation{Type: agg, BucketDuration: 10},
+		}, false)
+		require.Len(t, results, 2, agg)
+		assert.Equal(t, int64(10), results[0].Timestamp)
+		assert.InDelta(t, value, results[0].Value, 1e-9, agg)
+	}
+}
+
+func TestTimeSeriesQueryOptions(t *testing.T) {
+	var samples []TimeSeriesSample
+	for i := int64(0); i < 10; i++ {
+		samples = append(samples, TimeSeriesSample{Timestamp: i * 10, Value: float64(i)})
+	}
+
+	results := QueryTimeSeries(samples, TimeSeriesRangeOptions{
+		FilterByTS:    []int64{10, 20, 30, 45},
+		FilterByValue: &[2]float64{2, 9},
+	}, false)
+	assert.Equal(t, []TimeSeriesSample{{20, 2}, {30, 3}}, results)
+
+	results = QueryTimeSeries(samples, TimeSeriesRangeOptions{Count: 3}, true)
+	assert.Equal(t, []TimeSeriesSample{{90, 9}, {80, 8}, {70, 7}}, results)
+
+	// Buckets [-5, 20), [20, 45)... reported at their middle
+	results = QueryTimeSeries(samples, TimeSeriesRangeOptions{
+		Aggregation: &TimeSeriesAggregation{
+			Type: TimeSeriesAggSum, BucketDuration: 25, Align: 20, BucketTimestamp: BucketTimestampMid,
+		},
+	}, false)
+	assert.Equal(t, []TimeSeriesSample{{7, 1}, {32, 9}, {57, 11}, {82, 24}}, results)
+
+	// Empty buckets between the ones holding samples
+	sparse := []TimeSeriesSample{{0, 1}, {35, 3}}
+	for agg, value := range map[string]float64{TimeSeriesAggCount: 0, TimeSeriesAggLast: 1, TimeSeriesAggTWA: 1 + 2*25.0/35} {
+		results = QueryTimeSeries(sparse, TimeSeriesRangeOptions{
+			Aggregation: &TimeSeriesAggregation{Type: agg, BucketDuration: 10, Empty: true},
+		}, false)
+		require.Len(t, results, 4, agg)
+		assert.Equal(t, int64(10), results[1].Timestamp)
+		assert.InDelta(t, value, results[2].Value, 1e-9, agg)
+	}
+	results = QueryTimeSeries(sparse, TimeSeriesRangeOptions{
+		Aggregation: &TimeSeriesAggregation{Type: TimeSeriesAggMax, BucketDuration: 10, Empty: true},
+	}, false)
+	assert.True(t, math.IsNaN(results[1].Value))
+}
+
+func TestTimeSeriesCompaction(t *testing.T) {
+	ts := NewTimeSeries(DefaultTimeSeriesOptions())
+	ts.AddRule(TimeSeriesRule{DestinationKey: "min", AggregationType: TimeSeriesAggMin, BucketSize: 10})
+	ts.AddRule(TimeSeriesRule{DestinationKey: "avg", AggregationType: TimeSeriesAggAvg, BucketSize: 10, AlignTimestamp: 5})
+
+	for _, s := range []TimeSeriesSample{{1, 5}, {4, 3}, {8, 9}, {12, 1}, {31, 2}} {
+		_, err := ts.Add(s.Timestamp, s.Value, "")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []TimeSeriesCompaction{
+		{DestinationKey: "avg", Sample: TimeSeriesSample{-5, 4}},
+		{DestinationKey: "min", Sample: TimeSeriesSample{0, 3}},
+		{DestinationKey: "min", Sample: TimeSeriesSample{10, 1}},
+		{DestinationKey: "avg", Sample: TimeSeriesSample{5, 5}},
+	}, ts.TakeCompactions())
+	assert.Empty(t, ts.TakeCompactions())
+
+	open, ok := ts.OpenBucket("min")
+	require.True(t, ok)
+	assert.Equal(t, TimeSeriesSample{30, 2}, open)
+
+	// Changing a closed bucket rewrites it
+	_, err := ts.Add(2, 0, DuplicatePolicyLast)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []TimeSeriesCompaction{
+		{DestinationKey: "min", Sample: TimeSeriesSample{0, 0}},
+		{DestinationKey: "avg", Sample: TimeSeriesSample{-5, 8.0 / 3}},
+	}, ts.TakeCompactions())
+
+	assert.Equal(t, 1, ts.Delete(10, 15))
+	assert.ElementsMatch(t, []TimeSeriesCompaction{
+		{DestinationKey: "min", Sample: TimeSeriesSample{Timestamp: 10}, Deleted: true},
+		{DestinationKey: "avg", Sample: TimeSeriesSample{5, 9}},
+	}, ts.TakeCompactions())
+
+	require.True(t, ts.DeleteRule("avg"))
+	assert.Equal(t, []TimeSeriesRule{{DestinationKey: "min", AggregationType: TimeSeriesAggMin, BucketSize: 10}}, ts.Rules())
+}
+
+func TestTimeSeriesFilters(t *testing.T) {
+	labels := map[string]string{"region": "eu", "host": "a"}
+	for expr, expected := range map[string]bool{
+		"region=eu":        true,
+		"region=us":        false,
+		"region!=us":       true,
+		"region!=eu":       false,
+		"zone!=x":          true,
+		"zone=":            true,
+		"host=":            false,
+		"host!=":           true,
+		"zone!=":           false,
+		"region=(us,eu)":   true,
+		"region=(us, ap)":  false,
+		"region!=(us,eu)":  false,
+		"region!=(us,ap)":  true,
+		"zone!=(eu,other)": true,
+	} {
+		f, err := ParseTimeSeriesFilter(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, expected, f.Matches(labels), expr)
+	}
+
+	for _, expr := range []string{"region", "=eu", "!=eu", "region=()"} {
+		_, err := ParseTimeSeriesFilter(expr)
+		assert.Error(t, err, expr)
+	}
+	_, err := ParseTimeSeriesFilters([]string{"region!=eu", "host="})
+	assert.Error(t, err)
+}
+
+func TestTimeSeriesIndex(t *testing.T) {
+	idx := NewTimeSeriesIndex()
+	idx.Set("cpu:a", map[string]string{"metric": "cpu", "host": "a", "dc": "eu"})
+	idx.Set("cpu:b", map[string]string{"metric": "cpu", "host": "b", "dc": "us"})
+	idx.Set("mem:a", map[string]string{"metric": "mem", "host": "a"})
+
+	query := func(exprs ...string) []string {
+		filters, err := ParseTimeSeriesFilters(exprs)
+		require.NoError(t, err)
+		return idx.Query(filters)
+	}
+	assert.Equal(t, []string{"cpu:a", "cpu:b"}, query("metric=cpu"))
+	assert.Equal(t, []string{"cpu:a", "mem:a"}, query("host=a"))
+	assert.Equal(t, []string{"cpu:b"}, query("metric=cpu", "dc!=eu"))
+	assert.Equal(t, []string{"mem:a"}, query("host=(a,b)", "dc="))
+	assert.Empty(t, query("metric=disk", "host=a"))
+
+	idx.Set("cpu:a", map[string]string{"metric": "cpu", "host": "c"})
+	assert.Equal(t, []string{"mem:a"}, query("host=a"))
+	idx.Remove("cpu:b")
+	assert.Equal(t, []string{"cpu:a"}, query("metric=cpu"))
+	idx.Remove("cpu:a")
+	idx.Remove("mem:a")
+	assert.Empty(t, idx.postings)
+}
+
+func TestGroupTimeSeries(t *testing.T) {
+	results := []TimeSeriesResult{
+		{Key: "a", Labels: map[string]string{"dc": "eu"}, Samples: []TimeSeriesSample{{1, 1}, {2, 2}}},
+		{Key: "b", Labels: map[string]string{"dc": "eu"}, Samples: []TimeSeriesSample{{2, 5}, {3, 1}}},
+		{Key: "c", Labels: map[string]string{"dc": "us"}, Samples: []TimeSeriesSample{{1, 4}}},
+		{Key: "d", Labels: map[string]string{}, Samples: []TimeSeriesSample{{1, 9}}},
+	}
+
+	groups := GroupTimeSeries(results, "dc", TimeSeriesAggMax, false)
+	require.Len(t, groups, 2)
+	assert.Equal(t, TimeSeriesGroup{
+		Label: "dc", Value: "eu", Reducer: TimeSeriesAggMax, Sources: []string{"a", "b"},
+		Samples: []TimeSeriesSample{{1, 1}, {2, 5}, {3, 1}},
+	}, groups[0])
+	assert.Equal(t, "us", groups[1].Value)
+
+	groups = GroupTimeSeries(results, "dc", TimeSeriesAggCount, true)
+	assert.Equal(t, []TimeSeriesSample{{3, 1}, {2, 2}, {1, 1}}, groups[0].Samples)
+}
@@ -1,64 +1,171 @@
 package models
 
 import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"sort"
 	"sync"
+	"unsafe"
 )
 
-// TopK structure to track frequent items
+// topkDecayTable is the number of precomputed decay powers.
+const topkDecayTable = 256
+
+// TopK tracks the most frequent items of a stream with a HeavyKeeper
+// sketch. The sketch is depth rows of width buckets, each holding an item
+// fingerprint and a counter. An item increments its bucket in every row
+// when the bucket is empty or already holds its fingerprint; otherwise it
+// decays the resident counter with probability decay^count and takes the
+// bucket over once the counter reaches zero. Large counters are almost
+// never decayed, so heavy hitters keep their buckets while the long tail
+// evicts itself. The k items with the highest estimates are kept in a
+// min-heap, so memory is fixed at width×depth counters plus k items no
+// matter how many distinct items are seen.
 type TopK struct {
-	mu       sync.RWMutex
-	items    map[string]int64
-	decay    float64
-	k        int
-	capacity int
+	mu      sync.RWMutex
+	k       int
+	width   int
+	depth   int
+	decay   float64
+	powers  []float64
+	buckets []topkBucket
+	heap    topkHeap
+}
+
+type topkBucket struct {
+	fingerprint uint32
+	count       uint32
 }
 
-// NewTopK creates a new TopK structure
-func NewTopK(k, capacity int, decay float64) *TopK {
+// NewTopK creates a new TopK tracking k items in a width×depth sketch
+func NewTopK(k, width, depth int, decay float64) *TopK {
+	powers := make([]float64, topkDecayTable)
+	for i := range powers {
+		powers[i] = math.Pow(decay, float64(i))
+	}
 	return &TopK{
-		k:        k,
-		capacity: capacity,
-		decay:    decay,
-		items:    make(map[string]int64),
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		powers:  powers,
+		buckets: make([]topkBucket, width*depth),
+		heap:    topkHeap{index: make(map[string]int, k)},
 	}
 }
 
-// Add items to the TopK structure with a count of 1
-func (tk *TopK) Add(items ...string) []bool {
-	results := make([]bool, len(items))
+// topkHash returns the fingerprint of item and the two hashes its bucket
+// in each row is derived from.
+func topkHash(item string) (fingerprint uint32, h1, h2 uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	h1 = sum
+	h2 = sum>>32 | sum<<32 | 1
+	return uint32(sum >> 32), h1, h2
+}
+
+// Add increments each item by 1 and returns, per item, the item expelled
+// from the top k to make room for it, or nil.
+func (tk *TopK) Add(items ...string) []*string {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+
+	results := make([]*string, len(items))
 	for i, item := range items {
-		results[i] = tk.IncrBy(item, 1)
+		results[i] = tk.incrBy(item, 1)
 	}
 	return results
 }
 
-// IncrBy increases the count of items by specified amounts
-func (tk *TopK) IncrBy(item string, increment int64) bool {
+// IncrBy increases the count of item by increment and returns the item
+// expelled from the top k to make room for it, or nil.
+func (tk *TopK) IncrBy(item string, increment int64) *string {
 	tk.mu.Lock()
 	defer tk.mu.Unlock()
+	return tk.incrBy(item, increment)
+}
 
-	// Decay existing counts
-	tk.decay_()
-
-	// If item exists, increment it
-	if count, exists := tk.items[item]; exists {
-		tk.items[item] = count + increment
-		return true
+func (tk *TopK) incrBy(item string, increment int64) *string {
+	if increment <= 0 {
+		return nil
 	}
+	fingerprint, h1, h2 := topkHash(item)
 
-	// If we're at capacity and the item isn't in the lowest k items, don't add it
-	if len(tk.items) >= tk.capacity {
-		if !tk.shouldAdd_(increment) {
-			return false
+	var maxCount uint32
+	for row := 0; row < tk.depth; row++ {
+		b := &tk.buckets[row*tk.width+int((h1+uint64(row)*h2)%uint64(tk.width))]
+		switch {
+		case b.count == 0:
+			b.fingerprint = fingerprint
+			b.count = saturatingAdd(0, increment)
+		case b.fingerprint == fingerprint:
+			b.count = saturatingAdd(b.count, increment)
+		default:
+			// Every unit of the increment gets one chance to decay the
+			// resident; what is left over claims the bucket if it empties
+			for left := increment; left > 0; left-- {
+				if rand.Float64() < tk.decayPower(b.count) {
+					b.count--
+					if b.count == 0 {
+						b.fingerprint = fingerprint
+						b.count = saturatingAdd(0, left)
+						break
+					}
+				}
+			}
 		}
-		// Remove lowest item to make space
-		tk.removeLeastFrequent_()
+		if b.fingerprint == fingerprint && b.count > maxCount {
+			maxCount = b.count
+		}
+	}
+
+	return tk.updateHeap(item, int64(maxCount))
+}
+
+// decayPower returns the probability that a counter of the given size is
+// decayed.
+func (tk *TopK) decayPower(count uint32) float64 {
+	if count < topkDecayTable {
+		return tk.powers[count]
 	}
+	return tk.powers[topkDecayTable-1] * math.Pow(tk.decay, float64(count-topkDecayTable+1))
+}
 
-	// Add new item
-	tk.items[item] = increment
-	return true
+func saturatingAdd(count uint32, increment int64) uint32 {
+	if sum := int64(count) + increment; sum < math.MaxUint32 {
+		return uint32(sum)
+	}
+	return math.MaxUint32
+}
+
+// updateHeap records the new estimate of item in the top k.
+func (tk *TopK) updateHeap(item string, count int64) *string {
+	if count == 0 {
+		return nil
+	}
+	if i, ok := tk.heap.index[item]; ok {
+		if count > tk.heap.entries[i].count {
+			tk.heap.entries[i].count = count
+			heap.Fix(&tk.heap, i)
+		}
+		return nil
+	}
+	if tk.heap.Len() < tk.k {
+		heap.Push(&tk.heap, topkEntry{item: item, count: count})
+		return nil
+	}
+	if count <= tk.heap.entries[0].count {
+		return nil
+	}
+	expelled := tk.heap.entries[0].item
+	delete(tk.heap.index, expelled)
+	tk.heap.entries[0] = topkEntry{item: item, count: count}
+	tk.heap.index[item] = 0
+	heap.Fix(&tk.heap, 0)
+	return &expelled
 }
 
 // Query checks if items are in the top-k list
@@ -68,19 +175,25 @@ func (tk *TopK) Query(items ...string) []bool {
 
 	results := make([]bool, len(items))
 	for i, item := range items {
-		_, results[i] = tk.items[item]
+		_, results[i] = tk.heap.index[item]
 	}
 	return results
 }
 
-// Count returns the count of items
+// Count returns the sketch estimate of each item's count
 func (tk *TopK) Count(items ...string) []int64 {
 	tk.mu.RLock()
 	defer tk.mu.RUnlock()
 
 	counts := make([]int64, len(items))
 	for i, item := range items {
-		counts[i] = tk.items[item]
+		fingerprint, h1, h2 := topkHash(item)
+		for row := 0; row < tk.depth; row++ {
+			b := tk.buckets[row*tk.width+int((h1+uint64(row)*h2)%uint64(tk.width))]
+			if b.fingerprint == fingerprint && int64(b.count) > counts[i] {
+				counts[i] = int64(b.count)
+			}
+		}
 	}
 	return counts
 }
@@ -93,89 +206,81 @@ func (tk *TopK) List() []struct {
 	tk.mu.RLock()
 	defer tk.mu.RUnlock()
 
-	// Create slice of items
 	items := make([]struct {
 		Item  string
 		Count int64
-	}, 0, len(tk.items))
-
-	for item, count := range tk.items {
-		items = append(items, struct {
-			Item  string
-			Count int64
-		}{item, count})
+	}, len(tk.heap.entries))
+	for i, e := range tk.heap.entries {
+		items[i].Item = e.item
+		items[i].Count = e.count
 	}
 
 	// Sort by count in descending order
 	sort.Slice(items, func(i, j int) bool {
-		return items[i].Count > items[j].Count
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Item < items[j].Item
 	})
-
-	// Return top k items
-	if len(items) > tk.k {
-		return items[:tk.k]
-	}
 	return items
 }
 
 // Info returns information about the TopK structure
 func (tk *TopK) Info() map[string]interface{} {
+	return map[string]interface{}{
+		"k":     tk.k,
+		"width": tk.width,
+		"depth": tk.depth,
+		"decay": tk.decay,
+	}
+}
+
+// GetMemoryUsage returns an estimation of memory usage in bytes
+func (tk *TopK) GetMemoryUsage() int64 {
 	tk.mu.RLock()
 	defer tk.mu.RUnlock()
 
-	return map[string]interface{}{
-		"k":        tk.k,
-		"capacity": tk.capacity,
-		"decay":    tk.decay,
-		"size":     len(tk.items),
+	size := int64(unsafe.Sizeof(*tk))
+	size += int64(len(tk.powers)) * 8
+	size += int64(len(tk.buckets)) * int64(unsafe.Sizeof(topkBucket{}))
+	for _, e := range tk.heap.entries {
+		// The item is held by the entry and the index
+		size += int64(unsafe.Sizeof(e)) + int64(len(e.item)) + 16 + 8
 	}
+	return size
 }
 
-// Internal helper methods
+type topkEntry struct {
+	item  string
+	count int64
+}
 
-// decay_ applies decay factor to all counts
-func (tk *TopK) decay_() {
-	if tk.decay >= 1.0 {
-		return
-	}
-	for item := range tk.items {
-		tk.items[item] = int64(float64(tk.items[item]) * tk.decay)
-		if tk.items[item] <= 0 {
-			delete(tk.items, item)
-		}
-	}
+// topkHeap is a min-heap of the top k entries that tracks the position of
+// every item.
+type topkHeap struct {
+	entries []topkEntry
+	index   map[string]int
 }
 
-// shouldAdd_ checks if a new item with given count should be added
-func (tk *TopK) shouldAdd_(count int64) bool {
-	if len(tk.items) < tk.k {
-		return true
-	}
+func (h topkHeap) Len() int { return len(h.entries) }
 
-	// Find kth largest count
-	counts := make([]int64, 0, len(tk.items))
-	for _, c := range tk.items {
-		counts = append(counts, c)
-	}
-	sort.Slice(counts, func(i, j int) bool {
-		return counts[i] > counts[j]
-	})
+func (h topkHeap) Less(i, j int) bool { return h.entries[i].count < h.entries[j].count }
 
-	kthCount := counts[tk.k-1]
-	return count > kthCount
+func (h topkHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].item] = i
+	h.index[h.entries[j].item] = j
 }
 
-// removeLeastFrequent_ removes the item with lowest count
-func (tk *TopK) removeLeastFrequent_() {
-	var minItem string
-	var minCount int64 = 1<<63 - 1
-
-	for item, count := range tk.items {
-		if count < minCount {
-			minCount = count
-			minItem = item
-		}
-	}
+func (h *topkHeap) Push(x interface{}) {
+	e := x.(topkEntry)
+	h.index[e.item] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
 
-	delete(tk.items, minItem)
+func (h *topkHeap) Pop() interface{} {
+	e := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	delete(h.index, e.item)
+	return e
 }
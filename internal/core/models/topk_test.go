@@ -0,0 +1,68 @@
+package models
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopKExpelled(t *testing.T) {
+	tk := NewTopK(2, 50, 4, 0.9)
+
+	assert.Equal(t, []*string{nil, nil, nil}, tk.Add("a", "b", "a"))
+	// c ties b at 1, which is not enough to take its place
+	assert.Nil(t, tk.IncrBy("c", 1))
+	expelled := tk.IncrBy("c", 5)
+	require.NotNil(t, expelled)
+	assert.Equal(t, "b", *expelled)
+
+	assert.Equal(t, []bool{true, false, true}, tk.Query("a", "b", "c"))
+	assert.Equal(t, []int64{2, 1, 6}, tk.Count("a", "b", "c"))
+
+	list := tk.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "c", list[0].Item)
+	assert.Equal(t, int64(6), list[0].Count)
+	assert.Equal(t, "a", list[1].Item)
+}
+
+func TestTopKZipfStream(t *testing.T) {
+	const k = 10
+	rng := rand.New(rand.NewSource(3))
+	zipf := rand.NewZipf(rng, 1.2, 1, 1000000)
+
+	tk := NewTopK(k, 100, 5, 0.9)
+	memory := tk.GetMemoryUsage()
+	exact := map[string]int64{}
+	for i := 0; i < 200000; i++ {
+		item := strconv.FormatUint(zipf.Uint64(), 10)
+		exact[item]++
+		tk.Add(item)
+	}
+
+	items := make([]string, 0, len(exact))
+	for item := range exact {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return exact[items[i]] > exact[items[j]] })
+
+	found := map[string]int64{}
+	for _, e := range tk.List() {
+		found[e.Item] = e.Count
+	}
+	for _, item := range items[:k] {
+		count, ok := found[item]
+		if assert.True(t, ok, "item %s with count %d missing", item, exact[item]) {
+			// HeavyKeeper only underestimates
+			assert.LessOrEqual(t, count, exact[item])
+			assert.InEpsilon(t, exact[item], count, 0.05)
+		}
+	}
+
+	// Only the k entries of the heap grow with the stream
+	assert.Less(t, tk.GetMemoryUsage()-memory, int64(k*100))
+}
@@ -4,10 +4,13 @@ import (
 	"time"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/search"
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
 )
 
 type Cache interface {
 	Set(key string, value string) error
+	SetWithOptions(key string, value string, opts models.SetOptions) (models.SetResult, error)
 	Get(key string) (string, bool)
 	HSet(hash string, key string, value string) error
 	HGet(hash string, key string) (string, bool)
@@ -15,6 +18,7 @@ type Cache interface {
 	Incr(key string) (int, error)
 	Expire(key string, seconds int) error
 	PExpireAt(key string, timestampMs int64) error
+	PExpire(key string, milliseconds int64, condition string) (bool, error)
 	Del(key string) (bool, error)
 	Keys(pattern string) []string
 	TTL(key string) int // TTL in seconds, -2 if not exists, -1 if no expire
@@ -55,10 +59,13 @@ type Cache interface {
 	Pipeline() *models.Pipeline
 	ExecPipeline(pipeline *models.Pipeline) []models.Value
 	IncrCommandCount()
+	ResetStats()
 	Persist(key string) (bool, error)
 	WithRetry(strategy models.RetryStrategy) Cache
 	ZAdd(key string, score float64, member string) error
 	Touch(keys ...string) (int, error)
+	ObjectEncoding(key string) (string, bool)
+	ObjectIdleTime(key string) (int64, bool)
 	ZCard(key string) int
 	ZCount(key string, min, max float64) int
 	ZRange(key string, start, stop int) []string
@@ -82,6 +89,21 @@ type Cache interface {
 	SetJSON(key string, value interface{}) error
 	GetJSON(key string) (interface{}, bool)
 	DeleteJSON(key string) bool
+	SetJSONDocument(key string, doc *jsonUtil.Document) error
+	GetJSONDocument(key string) (*jsonUtil.Document, bool)
+	// UpdateJSON replaces the document at key with the one fn derives
+	// from it, with no other update of key in between. fn gets nil for a
+	// missing key and returns the document unchanged to leave the key
+	// alone, or nil to delete it.
+	UpdateJSON(key string, fn func(doc *jsonUtil.Document) (*jsonUtil.Document, error)) error
+
+	// JSON schema operations
+	JSONSchemaSet(pattern string, schema *jsonUtil.Schema) error
+	JSONSchemaGet(pattern string) (*jsonUtil.Schema, bool)
+	JSONSchemaDel(pattern string) bool
+	JSONSchemaList() []string
+	JSONSchemaCovers(key string) bool
+	JSONSchemaCheck(key string, value interface{}) error
 	ZDiff(keys ...string) []string
 	ZDiffStore(destination string, keys ...string) (int, error)
 	ZInter(keys ...string) []string
@@ -135,14 +157,25 @@ type Cache interface {
 	BitFieldRO(key string, commands []models.BitFieldCommand) ([]int64, error)
 	BitOp(operation string, destkey string, keys ...string) (int64, error)
 	BitPos(key string, bit int, start, end int64, reverse bool) (int64, error)
+	RSetBit(key string, offset int64, value int) (int, error)
+	RSetIntArray(key string, offsets []int64) error
+	RBitOp(operation string, destkey string, keys ...string) (int64, error)
+	RCard(key string) int64
+	RRange(key string, start, end int64) ([]int64, error)
+	RGetIntArray(key string) []int64
+	RMin(key string) int64
+	RMax(key string) int64
 	GeoAdd(key string, items ...models.GeoPoint) (int, error)
 	GeoDist(key, member1, member2, unit string) (float64, error)
 	GeoPos(key string, members ...string) ([]*models.GeoPoint, error)
 	GeoRadius(key string, longitude, latitude, radius float64, unit string, withDist, withCoord, withHash bool, count int, sort string) ([]models.GeoPoint, error)
 	GeoSearch(key string, options *models.GeoSearchOptions) ([]models.GeoPoint, error)
 	GeoSearchStore(destKey, srcKey string, options *models.GeoSearchOptions) (int, error)
+	GeoFenceAdd(key string, fence models.GeoFence) (bool, error)
+	GeoFenceDel(key string, names ...string) int
+	GeoFenceList(key string) []models.GeoFence
 	// FTSugAdd adds a suggestion string to an auto-complete suggestion dictionary
-	FTSugAdd(key, str string, score float64, opts ...string) (bool, error)
+	FTSugAdd(key, str string, score float64, incr bool, payload *string) (int64, error)
 
 	// FTSugDel deletes a suggestion string from a suggestion dictionary
 	FTSugDel(key, str string) (bool, error)
@@ -153,6 +186,14 @@ type Cache interface {
 	// FTSugLen gets the size of an auto-complete suggestion dictionary
 	FTSugLen(key string) (int64, error)
 
+	// Search index operations
+	FTCreate(def *search.IndexDefinition) error
+	FTDropIndex(name string, deleteDocs bool) error
+	FTInfo(name string) (*search.IndexInfo, error)
+	FTList() []string
+	FTSearch(index, query string, opts *search.SearchOptions) (*search.SearchResult, error)
+	FTAggregate(index string, req *search.AggregateRequest) (*search.AggregateResult, error)
+
 	// Count-Min Sketch operations
 	CMSInitByDim(key string, width, depth uint) error
 	CMSInitByProb(key string, epsilon, delta float64) error
@@ -161,11 +202,11 @@ type Cache interface {
 	CMSMerge(destination string, sources []string, weights []float64) error
 	CMSInfo(key string) (map[string]interface{}, error)
 
-	CFReserve(key string, capacity uint64) error
+	CFReserve(key string, opts models.CuckooFilterOptions) error
 	CFAdd(key string, item string) (bool, error)
 	CFAddNX(key string, item string) (bool, error)
-	CFInsert(key string, items []string) ([]bool, error)
-	CFInsertNX(key string, items []string) ([]bool, error)
+	CFInsert(key string, capacity uint64, noCreate bool, items []string) ([]int, error)
+	CFInsertNX(key string, capacity uint64, noCreate bool, items []string) ([]int, error)
 	CFDel(key string, item string) (bool, error)
 	CFCount(key string, item string) (int, error)
 	CFExists(key string, item string) (bool, error)
@@ -182,9 +223,13 @@ type Cache interface {
 
 	TDigestCreate(key string, compression float64) error
 	TDigestAdd(key string, values ...float64) error
-	TDigestMerge(destKey string, sourceKeys []string, weights []float64) error
+	TDigestMerge(destKey string, sourceKeys []string, compression float64, override bool) error
 	TDigestReset(key string) error
 	TDigestQuantile(key string, quantiles ...float64) ([]float64, error)
+	TDigestRank(key string, values ...float64) ([]int64, error)
+	TDigestRevRank(key string, values ...float64) ([]int64, error)
+	TDigestByRank(key string, ranks ...int64) ([]float64, error)
+	TDigestByRevRank(key string, ranks ...int64) ([]float64, error)
 	TDigestMin(key string) (float64, error)
 	TDigestMax(key string) (float64, error)
 	TDigestInfo(key string) (map[string]interface{}, error)
@@ -194,19 +239,19 @@ type Cache interface {
 	// Bloom Filter Operations
 	BFAdd(key string, item string) (bool, error)
 	BFExists(key string, item string) (bool, error)
-	BFReserve(key string, errorRate float64, capacity uint) error
+	BFReserve(key string, opts models.BloomFilterOptions) error
 	BFMAdd(key string, items []string) ([]bool, error)
 	BFMExists(key string, items []string) ([]bool, error)
-	BFInfo(key string) (map[string]interface{}, error)
+	BFInfo(key string) (*models.BloomInfo, error)
 	BFCard(key string) (uint, error)
 	BFScanDump(key string, iterator int) (int, []byte, error)
 	BFLoadChunk(key string, iterator int, data []byte) error
-	BFInsert(key string, errorRate float64, capacity uint, items []string) ([]bool, error)
+	BFInsert(key string, opts models.BloomFilterOptions, noCreate bool, items []string) ([]bool, error)
 
 	// TopK Operations
 	TOPKReserve(key string, topk, width, depth int, decay float64) error
-	TOPKAdd(key string, items ...string) ([]bool, error)
-	TOPKIncrBy(key string, itemsWithCount map[string]int64) ([]bool, error)
+	TOPKAdd(key string, items ...string) ([]*string, error)
+	TOPKIncrBy(key string, items []string, increments []int64) ([]*string, error)
 	TOPKQuery(key string, items ...string) ([]bool, error)
 	TOPKCount(key string, items ...string) ([]int64, error)
 	TOPKList(key string) ([]struct {
@@ -215,23 +260,23 @@ type Cache interface {
 	}, error)
 	TOPKInfo(key string) (map[string]interface{}, error)
 
-	TSCreate(key string, labels map[string]string) error
-	TSAdd(key string, timestamp int64, value float64) error
+	TSCreate(key string, opts models.TimeSeriesOptions) error
+	TSAdd(key string, timestamp int64, value float64, opts models.TimeSeriesOptions, onDuplicate string) (int64, error)
 	TSGet(key string) (*models.TimeSeriesSample, error)
 	TSMAdd(entries map[string][]models.TimeSeriesSample) error
 	TSDel(key string, from, to int64) (int, error)
-	TSRange(key string, from, to int64) ([]models.TimeSeriesSample, error)
-	TSMRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error)
+	TSRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error)
+	TSMRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error)
 	TSIncrBy(key string, increment float64) error
 	TSDecrBy(key string, decrement float64) error
-	TSInfo(key string) (*models.TimeSeriesStats, error)
-	TSAlter(key string, labels map[string]string) error
-	TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize int64) error
+	TSInfo(key string, debug bool) (*models.TimeSeriesInfo, error)
+	TSAlter(key string, opts models.TimeSeriesAlterOptions) error
+	TSCreateRule(sourceKey, destKey string, aggregationType string, bucketSize, alignTimestamp int64) error
 	TSDeleteRule(sourceKey, destinationKey string) error
-	TSMGet(filters map[string]string) (map[string]*models.TimeSeriesSample, error)
-	TSMRevRange(filters map[string]string, from, to int64) (map[string][]models.TimeSeriesSample, error)
-	TSQueryIndex(filters map[string]string) ([]string, error)
-	TSRevRange(key string, from, to int64) ([]models.TimeSeriesSample, error)
+	TSMGet(filters []models.TimeSeriesFilter, latest bool) ([]models.TimeSeriesResult, error)
+	TSMRevRange(filters []models.TimeSeriesFilter, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesResult, error)
+	TSQueryIndex(filters []models.TimeSeriesFilter) ([]string, error)
+	TSRevRange(key string, from, to int64, opts models.TimeSeriesRangeOptions) ([]models.TimeSeriesSample, error)
 
 	// Sort Commands
 	Sort(key string, desc bool, alpha bool, limit bool, start int, count int, store string) ([]string, error)
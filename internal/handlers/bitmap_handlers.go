@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -357,3 +358,184 @@ func (h *BitMapHandlers) parseBitFieldCommands(args []models.Value) ([]models.Bi
 	}
 	return commands, nil
 }
+
+// parseROffset parses a bit offset of an R.* command, which ranges from 0
+// to 2^32-1.
+func parseROffset(arg models.Value) (int64, error) {
+	offset, err := strconv.ParseInt(arg.Bulk, 10, 64)
+	if err != nil || offset < 0 || offset > math.MaxUint32 {
+		return 0, fmt.Errorf("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// offsetsReply returns the offsets as an array of integers.
+func offsetsReply(offsets []int64) models.Value {
+	result := make([]models.Value, len(offsets))
+	for i, offset := range offsets {
+		result[i] = models.Value{Type: "integer", Num: int(offset)}
+	}
+	return models.Value{Type: "array", Array: result}
+}
+
+// HandleRSetBit handles the 'r.setbit' command, which sets or clears a bit
+// like SETBIT but always stores the bitmap compressed as a roaring bitmap.
+// It returns the old bit value.
+func (h *BitMapHandlers) HandleRSetBit(args []models.Value) models.Value {
+	if len(args) != 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.setbit' command"}
+	}
+
+	offset, err := parseROffset(args[1])
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	value, err := strconv.Atoi(args[2].Bulk)
+	if err != nil || (value != 0 && value != 1) {
+		return models.Value{Type: "error", Str: "ERR bit is not an integer or out of range"}
+	}
+
+	oldBit, err := h.cache.RSetBit(args[0].Bulk, offset, value)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	return models.Value{Type: "integer", Num: oldBit}
+}
+
+// HandleRGetBit handles the 'r.getbit' command, which returns the bit value
+// at the specified offset whichever way the bitmap is stored.
+func (h *BitMapHandlers) HandleRGetBit(args []models.Value) models.Value {
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.getbit' command"}
+	}
+
+	offset, err := parseROffset(args[1])
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	bit, err := h.cache.GetBit(args[0].Bulk, offset)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	return models.Value{Type: "integer", Num: bit}
+}
+
+// HandleRBitOp handles the 'r.bitop' command, which performs a bitwise
+// operation like BITOP and stores the result as a roaring bitmap. Unlike
+// BITOP it returns the number of bits set in the result.
+//
+// Args:
+//
+//	args ([]models.Value): The operation (AND, OR, XOR, NOT), the destination
+//	  key and the source keys.
+func (h *BitMapHandlers) HandleRBitOp(args []models.Value) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.bitop' command"}
+	}
+
+	operation := strings.ToUpper(args[0].Bulk)
+	destkey := args[1].Bulk
+
+	sourceKeys := make([]string, len(args)-2)
+	for i := 2; i < len(args); i++ {
+		sourceKeys[i-2] = args[i].Bulk
+	}
+
+	card, err := h.cache.RBitOp(operation, destkey, sourceKeys...)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	return models.Value{Type: "integer", Num: int(card)}
+}
+
+// HandleRCard handles the 'r.card' command, which returns the number of
+// bits set in the bitmap.
+func (h *BitMapHandlers) HandleRCard(args []models.Value) models.Value {
+	if len(args) != 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.card' command"}
+	}
+
+	return models.Value{Type: "integer", Num: int(h.cache.RCard(args[0].Bulk))}
+}
+
+// HandleRRange handles the 'r.range' command, which returns the offsets of
+// the bits set from start to end, both included.
+func (h *BitMapHandlers) HandleRRange(args []models.Value) models.Value {
+	if len(args) != 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.range' command"}
+	}
+
+	start, err := parseROffset(args[1])
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	end, err := parseROffset(args[2])
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	offsets, err := h.cache.RRange(args[0].Bulk, start, end)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	return offsetsReply(offsets)
+}
+
+// HandleRSetIntArray handles the 'r.setintarray' command, which replaces the
+// bitmap at key by a roaring bitmap with the bits at the given offsets set.
+func (h *BitMapHandlers) HandleRSetIntArray(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.setintarray' command"}
+	}
+
+	offsets := make([]int64, len(args)-1)
+	for i, arg := range args[1:] {
+		offset, err := parseROffset(arg)
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
+		}
+		offsets[i] = offset
+	}
+
+	if err := h.cache.RSetIntArray(args[0].Bulk, offsets); err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	return models.Value{Type: "string", Str: "OK"}
+}
+
+// HandleRGetIntArray handles the 'r.getintarray' command, which returns the
+// offsets of all the bits set in the bitmap.
+func (h *BitMapHandlers) HandleRGetIntArray(args []models.Value) models.Value {
+	if len(args) != 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.getintarray' command"}
+	}
+
+	return offsetsReply(h.cache.RGetIntArray(args[0].Bulk))
+}
+
+// HandleRMin handles the 'r.min' command, which returns the offset of the
+// first bit set, or -1 if the bitmap is empty.
+func (h *BitMapHandlers) HandleRMin(args []models.Value) models.Value {
+	if len(args) != 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.min' command"}
+	}
+
+	return models.Value{Type: "integer", Num: int(h.cache.RMin(args[0].Bulk))}
+}
+
+// HandleRMax handles the 'r.max' command, which returns the offset of the
+// last bit set, or -1 if the bitmap is empty.
+func (h *BitMapHandlers) HandleRMax(args []models.Value) models.Value {
+	if len(args) != 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'r.max' command"}
+	}
+
+	return models.Value{Type: "integer", Num: int(h.cache.RMax(args[0].Bulk))}
+}
@@ -1,8 +1,8 @@
 package handlers
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
@@ -39,7 +39,7 @@ func (h *BloomFilterHandlers) HandleBFAdd(args []models.Value) models.Value {
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -49,59 +49,74 @@ func (h *BloomFilterHandlers) HandleBFAdd(args []models.Value) models.Value {
 	}
 }
 
-// HandleBFInsert handles the 'BF.INSERT' command for inserting items into a Bloom filter.
-// It expects at least 4 arguments: the key, error rate, capacity, and one or more items to insert.
+// HandleBFInsert handles the 'BF.INSERT' command for inserting items into a Bloom filter:
+//
+//	BF.INSERT key [CAPACITY capacity] [ERROR error] [EXPANSION expansion] [NOCREATE] [NONSCALING] ITEMS item [item ...]
+//
+// The options only apply when the filter is created; with NOCREATE a missing filter is an error.
 //
 // Args:
 //
 //	args ([]models.Value): A slice of Value objects representing the command arguments.
-//	  - args[0]: The key for the Bloom filter.
-//	  - args[1]: The error rate for the Bloom filter (must be a float between 0 and 1).
-//	  - args[2]: The capacity of the Bloom filter (must be a positive integer).
-//	  - args[3...]: The items to insert into the Bloom filter.
 //
 // Returns:
 //
-//	models.Value: A Value object representing the result of the insertion.
-//	  - If the number of arguments is less than 4, returns an error Value with a message indicating the wrong number of arguments.
-//	  - If the error rate is invalid, returns an error Value with a message indicating the error rate must be between 0 and 1.
-//	  - If the capacity is invalid, returns an error Value with a message indicating the capacity must be a positive integer.
-//	  - If the insertion is successful, returns an array Value containing integer Values indicating whether each item was added (1) or already existed (0).
-//	  - If there is an error during insertion, returns an error Value with the error message.
+//	models.Value: An array of integers indicating whether each item was added (1) or already existed (0),
+//	or an error Value if the arguments are invalid or the insertion fails.
 func (h *BloomFilterHandlers) HandleBFInsert(args []models.Value) models.Value {
-	if len(args) < 4 {
+	if len(args) < 3 {
 		return models.Value{
 			Type: "error",
 			Str:  "ERR wrong number of arguments for 'BF.INSERT' command",
 		}
 	}
 
-	errorRate, err := strconv.ParseFloat(args[1].Bulk, 64)
-	if err != nil {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR invalid error rate. Must be between 0 and 1",
+	opts := models.DefaultBloomFilterOptions()
+	noCreate := false
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		if option == "ITEMS" {
+			i++
+			break
+		}
+		switch option {
+		case "NOCREATE":
+			noCreate = true
+			continue
+		case "NONSCALING":
+			opts.NonScaling = true
+			continue
+		case "CAPACITY", "ERROR", "EXPANSION":
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
-	}
 
-	capacity, err := strconv.ParseUint(args[2].Bulk, 10, 64)
-	if err != nil {
+		if i+1 >= len(args) {
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
+		i++
+		if errValue := parseBloomOption(option, args[i].Bulk, &opts); errValue != nil {
+			return *errValue
+		}
+	}
+	if i >= len(args) || i == 1 {
 		return models.Value{
 			Type: "error",
-			Str:  "ERR invalid capacity. Must be a positive integer",
+			Str:  "ERR wrong number of arguments for 'BF.INSERT' command",
 		}
 	}
 
-	items := make([]string, len(args)-3)
-	for i := 3; i < len(args); i++ {
-		items[i-3] = args[i].Bulk
+	items := make([]string, len(args)-i)
+	for j := range items {
+		items[j] = args[i+j].Bulk
 	}
 
-	results, err := h.cache.BFInsert(args[0].Bulk, errorRate, uint(capacity), items)
+	results, err := h.cache.BFInsert(args[0].Bulk, opts, noCreate, items)
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -119,6 +134,32 @@ func (h *BloomFilterHandlers) HandleBFInsert(args []models.Value) models.Value {
 	}
 }
 
+// parseBloomOption parses the value of a CAPACITY, ERROR or EXPANSION option into
+// opts and returns an error Value if it is invalid.
+func parseBloomOption(option, value string, opts *models.BloomFilterOptions) *models.Value {
+	switch option {
+	case "CAPACITY":
+		capacity, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || capacity == 0 {
+			return &models.Value{Type: "error", Str: "ERR invalid capacity. Must be a positive integer"}
+		}
+		opts.Capacity = uint(capacity)
+	case "ERROR":
+		errorRate, err := strconv.ParseFloat(value, 64)
+		if err != nil || errorRate <= 0 || errorRate >= 1 {
+			return &models.Value{Type: "error", Str: "ERR invalid error rate. Must be between 0 and 1"}
+		}
+		opts.ErrorRate = errorRate
+	case "EXPANSION":
+		expansion, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || expansion == 0 {
+			return &models.Value{Type: "error", Str: "ERR invalid expansion. Must be a positive integer"}
+		}
+		opts.Expansion = uint(expansion)
+	}
+	return nil
+}
+
 // HandleBFExists handles the 'BF.EXISTS' command for checking the existence of an element in a Bloom filter.
 // It expects exactly two arguments: the key of the Bloom filter and the element to check for existence.
 // If the number of arguments is incorrect, it returns an error.
@@ -136,7 +177,7 @@ func (h *BloomFilterHandlers) HandleBFExists(args []models.Value) models.Value {
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -146,10 +187,12 @@ func (h *BloomFilterHandlers) HandleBFExists(args []models.Value) models.Value {
 	}
 }
 
-// HandleBFReserve handles the 'BF.RESERVE' command which initializes a Bloom Filter with a specified error rate and capacity.
-// It expects three arguments: the key for the Bloom Filter, the desired error rate (a float between 0 and 1), and the capacity (a positive integer).
-// If the number of arguments is incorrect, or if the error rate or capacity are invalid, it returns an error.
-// On successful initialization, it returns an "OK" string.
+// HandleBFReserve handles the 'BF.RESERVE' command which creates a scalable Bloom filter:
+//
+//	BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+//
+// The first layer holds capacity items at error_rate; when it fills, a layer expansion times
+// larger is added unless NONSCALING is given. On success, it returns an "OK" string.
 //
 // Args:
 //
@@ -159,34 +202,42 @@ func (h *BloomFilterHandlers) HandleBFExists(args []models.Value) models.Value {
 //
 //	models.Value: A Value object indicating the result of the command execution.
 func (h *BloomFilterHandlers) HandleBFReserve(args []models.Value) models.Value {
-	if len(args) != 3 {
+	if len(args) < 3 {
 		return models.Value{
 			Type: "error",
 			Str:  "ERR wrong number of arguments for 'BF.RESERVE' command",
 		}
 	}
 
-	errorRate, err := strconv.ParseFloat(args[1].Bulk, 64)
-	if err != nil {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR invalid error rate. Must be between 0 and 1",
-		}
+	opts := models.DefaultBloomFilterOptions()
+	if errValue := parseBloomOption("ERROR", args[1].Bulk, &opts); errValue != nil {
+		return *errValue
 	}
-
-	capacity, err := strconv.ParseUint(args[2].Bulk, 10, 64)
-	if err != nil {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR invalid capacity. Must be a positive integer",
+	if errValue := parseBloomOption("CAPACITY", args[2].Bulk, &opts); errValue != nil {
+		return *errValue
+	}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "NONSCALING":
+			opts.NonScaling = true
+		case "EXPANSION":
+			if i+1 >= len(args) {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
+			}
+			i++
+			if errValue := parseBloomOption("EXPANSION", args[i].Bulk, &opts); errValue != nil {
+				return *errValue
+			}
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
 	}
 
-	err = h.cache.BFReserve(args[0].Bulk, errorRate, uint(capacity))
+	err := h.cache.BFReserve(args[0].Bulk, opts)
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -227,7 +278,7 @@ func (h *BloomFilterHandlers) HandleBFMAdd(args []models.Value) models.Value {
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -276,7 +327,7 @@ func (h *BloomFilterHandlers) HandleBFMExists(args []models.Value) models.Value
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -294,8 +345,11 @@ func (h *BloomFilterHandlers) HandleBFMExists(args []models.Value) models.Value
 	}
 }
 
-// HandleBFInfo processes the 'BF.INFO' command and returns information about a Bloom filter.
-// It expects a single argument which is the key of the Bloom filter.
+// HandleBFInfo processes the 'BF.INFO' command and returns information about a Bloom filter:
+//
+//	BF.INFO key [CAPACITY | SIZE | FILTERS | ITEMS | EXPANSION]
+//
+// Without a field it returns all of them as name/value pairs; with one it returns only that value.
 //
 // Args:
 //
@@ -303,11 +357,10 @@ func (h *BloomFilterHandlers) HandleBFMExists(args []models.Value) models.Value
 //
 // Returns:
 //
-//	models.Value: A value containing the Bloom filter information in an array of key-value pairs,
-//	              or an error message if the number of arguments is incorrect or if there is an error
-//	              retrieving the Bloom filter information.
+//	models.Value: The Bloom filter information, or an error message if the number of arguments
+//	is incorrect or the filter does not exist.
 func (h *BloomFilterHandlers) HandleBFInfo(args []models.Value) models.Value {
-	if len(args) != 1 {
+	if len(args) != 1 && len(args) != 2 {
 		return models.Value{
 			Type: "error",
 			Str:  "ERR wrong number of arguments for 'BF.INFO' command",
@@ -318,17 +371,38 @@ func (h *BloomFilterHandlers) HandleBFInfo(args []models.Value) models.Value {
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
-	// Convert map to array of key-value pairs
-	response := make([]models.Value, 0, len(info)*2)
-	for k, v := range info {
-		response = append(response,
-			models.Value{Type: "bulk", Bulk: k},
-			models.Value{Type: "bulk", Bulk: fmt.Sprintf("%v", v)},
-		)
+	expansion := models.Value{Type: "null"}
+	if info.Expansion > 0 {
+		expansion = models.Value{Type: "integer", Num: int(info.Expansion)}
+	}
+	fields := []struct {
+		option string
+		name   string
+		value  models.Value
+	}{
+		{"CAPACITY", "Capacity", models.Value{Type: "integer", Num: int(info.Capacity)}},
+		{"SIZE", "Size", models.Value{Type: "integer", Num: int(info.Size)}},
+		{"FILTERS", "Number of filters", models.Value{Type: "integer", Num: info.Filters}},
+		{"ITEMS", "Number of items inserted", models.Value{Type: "integer", Num: int(info.Items)}},
+		{"EXPANSION", "Expansion rate", expansion},
+	}
+
+	response := make([]models.Value, 0, len(fields)*2)
+	for _, field := range fields {
+		if len(args) == 2 {
+			if strings.ToUpper(args[1].Bulk) == field.option {
+				return models.Value{Type: "array", Array: []models.Value{field.value}}
+			}
+			continue
+		}
+		response = append(response, models.Value{Type: "bulk", Bulk: field.name}, field.value)
+	}
+	if len(args) == 2 {
+		return models.Value{Type: "error", Str: "ERR syntax error"}
 	}
 
 	return models.Value{
@@ -337,7 +411,7 @@ func (h *BloomFilterHandlers) HandleBFInfo(args []models.Value) models.Value {
 	}
 }
 
-// HandleBFCard handles the 'BF.CARD' command which returns the cardinality of the Bloom filter.
+// HandleBFCard handles the 'BF.CARD' command which returns the number of items added to the Bloom filter.
 // It expects a single argument which is the key of the Bloom filter.
 // If the number of arguments is incorrect, it returns an error.
 // If the cardinality retrieval is successful, it returns the cardinality as an integer.
@@ -362,7 +436,7 @@ func (h *BloomFilterHandlers) HandleBFCard(args []models.Value) models.Value {
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -408,7 +482,7 @@ func (h *BloomFilterHandlers) HandleBFScanDump(args []models.Value) models.Value
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -455,7 +529,7 @@ func (h *BloomFilterHandlers) HandleBFLoadChunk(args []models.Value) models.Valu
 	if err != nil {
 		return models.Value{
 			Type: "error",
-			Str:  fmt.Sprintf("ERR %v", err),
+			Str:  err.Error(),
 		}
 	}
 
@@ -3,17 +3,26 @@ package handlers
 import (
 	"strings"
 
+	"github.com/genc-murat/crystalcache/internal/config"
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/internal/metrics"
 )
 
 type ConfigHandlers struct {
-	cache ports.Cache
+	cache   ports.Cache
+	params  *config.Registry
+	metrics *metrics.Metrics
 }
 
-func NewConfigHandlers(cache ports.Cache) *ConfigHandlers {
+// NewConfigHandlers creates the CONFIG handlers. params and cmdMetrics may
+// be nil, in which case no parameters are exposed and RESETSTAT only resets
+// the keyspace statistics.
+func NewConfigHandlers(cache ports.Cache, params *config.Registry, cmdMetrics *metrics.Metrics) *ConfigHandlers {
 	return &ConfigHandlers{
-		cache: cache,
+		cache:   cache,
+		params:  params,
+		metrics: cmdMetrics,
 	}
 }
 
@@ -25,48 +34,93 @@ func (h *ConfigHandlers) HandleConfig(args []models.Value) models.Value {
 	subCmd := strings.ToUpper(args[0].Bulk)
 	switch subCmd {
 	case "GET":
-		if len(args) != 2 {
+		if len(args) < 2 {
 			return models.Value{Type: "error", Str: "ERR wrong number of arguments for CONFIG GET"}
 		}
-		return h.handleConfigGet(args[1].Bulk)
+		return h.handleConfigGet(args[1:])
 	case "SET":
-		if len(args) != 3 {
+		if len(args) < 3 || len(args)%2 == 0 {
 			return models.Value{Type: "error", Str: "ERR wrong number of arguments for CONFIG SET"}
 		}
-		return h.handleConfigSet(args[1].Bulk, args[2].Bulk)
+		return h.handleConfigSet(args[1:])
+	case "REWRITE":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for CONFIG REWRITE"}
+		}
+		return h.handleConfigRewrite()
 	case "RESETSTAT":
-		return models.Value{Type: "string", Str: "OK"}
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for CONFIG RESETSTAT"}
+		}
+		return h.handleConfigResetStat()
+	case "HELP":
+		return stringsToArray([]string{
+			"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET <pattern> [<pattern> ...]",
+			"    Return parameters matching the glob-like <pattern> and their values.",
+			"SET <directive> <value> [<directive> <value> ...]",
+			"    Set the configuration <directive> to <value>.",
+			"RESETSTAT",
+			"    Reset statistics reported by the INFO command and the metrics endpoint.",
+			"REWRITE",
+			"    Rewrite the configuration file.",
+		})
 	default:
 		return models.Value{Type: "error", Str: "ERR unknown subcommand for CONFIG"}
 	}
 }
 
-func (h *ConfigHandlers) handleConfigGet(parameter string) models.Value {
-	configs := map[string]string{
-		"maxmemory":  "0",
-		"maxclients": "10000",
-		"databases":  "16",
+func (h *ConfigHandlers) handleConfigGet(patterns []models.Value) models.Value {
+	result := []models.Value{}
+	if h.params == nil {
+		return models.Value{Type: "array", Array: result}
 	}
 
-	if parameter == "*" {
-		result := make([]models.Value, 0, len(configs)*2)
-		for k, v := range configs {
-			result = append(result, models.Value{Type: "string", Str: k})
-			result = append(result, models.Value{Type: "string", Str: v})
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		for _, kv := range h.params.Get(p.Bulk) {
+			if seen[kv[0]] {
+				continue
+			}
+			seen[kv[0]] = true
+			result = append(result,
+				models.Value{Type: "bulk", Bulk: kv[0]},
+				models.Value{Type: "bulk", Bulk: kv[1]},
+			)
 		}
-		return models.Value{Type: "array", Array: result}
+	}
+	return models.Value{Type: "array", Array: result}
+}
+
+func (h *ConfigHandlers) handleConfigSet(args []models.Value) models.Value {
+	if h.params == nil {
+		return models.Value{Type: "error", Str: "ERR Unknown option or number of arguments for CONFIG SET - '" + args[0].Bulk + "'"}
 	}
 
-	if val, ok := configs[parameter]; ok {
-		return models.Value{Type: "array", Array: []models.Value{
-			{Type: "string", Str: parameter},
-			{Type: "string", Str: val},
-		}}
+	pairs := make([]string, len(args))
+	for i, arg := range args {
+		pairs[i] = arg.Bulk
 	}
+	if err := h.params.Set(pairs...); err != nil {
+		return models.Value{Type: "error", Str: "ERR " + err.Error()}
+	}
+	return models.Value{Type: "string", Str: "OK"}
+}
 
-	return models.Value{Type: "array", Array: []models.Value{}}
+func (h *ConfigHandlers) handleConfigRewrite() models.Value {
+	if h.params == nil {
+		return models.Value{Type: "error", Str: "ERR The server is running without a config file"}
+	}
+	if err := h.params.Rewrite(); err != nil {
+		return models.Value{Type: "error", Str: "ERR Rewriting config file: " + err.Error()}
+	}
+	return models.Value{Type: "string", Str: "OK"}
 }
 
-func (h *ConfigHandlers) handleConfigSet(parameter, value string) models.Value {
+func (h *ConfigHandlers) handleConfigResetStat() models.Value {
+	h.cache.ResetStats()
+	if h.metrics != nil {
+		h.metrics.Reset()
+	}
 	return models.Value{Type: "string", Str: "OK"}
 }
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
@@ -20,17 +21,39 @@ func NewCuckooHandlers(cache ports.Cache) *CuckooHandlers {
 
 // CF.RESERVE command
 func (h *CuckooHandlers) HandleCFReserve(args []models.Value) models.Value {
-	if len(args) != 2 {
+	if len(args) < 2 || len(args)%2 != 0 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'CF.RESERVE' command"}
 	}
 
 	key := args[0].Bulk
+	opts := models.DefaultCuckooFilterOptions()
 	capacity, err := strconv.ParseUint(args[1].Bulk, 10, 64)
-	if err != nil {
+	if err != nil || capacity == 0 {
 		return models.Value{Type: "error", Str: "ERR invalid capacity"}
 	}
-
-	err = h.cache.CFReserve(key, capacity)
+	opts.Capacity = capacity
+
+	for i := 2; i < len(args); i += 2 {
+		option := strings.ToUpper(args[i].Bulk)
+		value, err := strconv.Atoi(args[i+1].Bulk)
+		if err != nil {
+			return models.Value{Type: "error", Str: fmt.Sprintf("ERR invalid %s", strings.ToLower(option))}
+		}
+		switch option {
+		case "BUCKETSIZE":
+			opts.BucketSize = value
+		case "MAXITERATIONS":
+			opts.MaxIterations = value
+		case "EXPANSION":
+			opts.Expansion = value
+		case "FINGERPRINTBITS":
+			opts.FingerprintBits = value
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
+	}
+
+	err = h.cache.CFReserve(key, opts)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
@@ -74,49 +97,65 @@ func (h *CuckooHandlers) HandleCFAddNX(args []models.Value) models.Value {
 
 // CF.INSERT command
 func (h *CuckooHandlers) HandleCFInsert(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'CF.INSERT' command"}
-	}
-
-	key := args[0].Bulk
-	items := make([]string, len(args)-1)
-	for i := 1; i < len(args); i++ {
-		items[i-1] = args[i].Bulk
-	}
-
-	results, err := h.cache.CFInsert(key, items)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	response := make([]models.Value, len(results))
-	for i, result := range results {
-		response[i] = models.Value{Type: "integer", Num: boolToInt(result)}
-	}
-
-	return models.Value{Type: "array", Array: response}
+	return h.handleInsert("CF.INSERT", args, h.cache.CFInsert)
 }
 
 // CF.INSERTNX command
 func (h *CuckooHandlers) HandleCFInsertNX(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'CF.INSERTNX' command"}
-	}
+	return h.handleInsert("CF.INSERTNX", args, h.cache.CFInsertNX)
+}
 
-	key := args[0].Bulk
-	items := make([]string, len(args)-1)
-	for i := 1; i < len(args); i++ {
-		items[i-1] = args[i].Bulk
+// handleInsert parses key [CAPACITY capacity] [NOCREATE] ITEMS item [item ...]
+// and replies with the result of every item.
+func (h *CuckooHandlers) handleInsert(command string, args []models.Value, insert func(string, uint64, bool, []string) ([]int, error)) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)}
 	}
 
-	results, err := h.cache.CFInsertNX(key, items)
+	key := args[0].Bulk
+	capacity := uint64(0)
+	noCreate := false
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		if option == "ITEMS" {
+			i++
+			break
+		}
+		switch option {
+		case "NOCREATE":
+			noCreate = true
+		case "CAPACITY":
+			if i+1 >= len(args) {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
+			}
+			i++
+			var err error
+			capacity, err = strconv.ParseUint(args[i].Bulk, 10, 64)
+			if err != nil || capacity == 0 {
+				return models.Value{Type: "error", Str: "ERR invalid capacity"}
+			}
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
+	}
+	if i >= len(args) {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)}
+	}
+
+	items := make([]string, len(args)-i)
+	for j := range items {
+		items[j] = args[i+j].Bulk
+	}
+
+	results, err := insert(key, capacity, noCreate, items)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
 	response := make([]models.Value, len(results))
 	for i, result := range results {
-		response[i] = models.Value{Type: "integer", Num: boolToInt(result)}
+		response[i] = models.Value{Type: "integer", Num: result}
 	}
 
 	return models.Value{Type: "array", Array: response}
@@ -214,15 +253,21 @@ func (h *CuckooHandlers) HandleCFInfo(args []models.Value) models.Value {
 		{Type: "bulk", Bulk: "Size"},
 		{Type: "integer", Num: int(info.Size)},
 		{Type: "bulk", Bulk: "Number of buckets"},
-		{Type: "integer", Num: int(info.Size)},
-		{Type: "bulk", Bulk: "Number of items"},
-		{Type: "integer", Num: int(info.ItemCount)},
+		{Type: "integer", Num: int(info.NumBuckets)},
+		{Type: "bulk", Bulk: "Number of filters"},
+		{Type: "integer", Num: info.NumFilters},
+		{Type: "bulk", Bulk: "Number of items inserted"},
+		{Type: "integer", Num: int(info.ItemsInserted)},
+		{Type: "bulk", Bulk: "Number of items deleted"},
+		{Type: "integer", Num: int(info.ItemsDeleted)},
 		{Type: "bulk", Bulk: "Bucket size"},
 		{Type: "integer", Num: info.BucketSize},
 		{Type: "bulk", Bulk: "Expansion rate"},
 		{Type: "integer", Num: info.Expansion},
-		{Type: "bulk", Bulk: "Filter filled ratio"},
-		{Type: "bulk", Bulk: fmt.Sprintf("%.2f", info.FilterFilled)},
+		{Type: "bulk", Bulk: "Max iterations"},
+		{Type: "integer", Num: info.MaxIterations},
+		{Type: "bulk", Bulk: "Fingerprint bits"},
+		{Type: "integer", Num: info.FingerprintBits},
 	}
 
 	return models.Value{Type: "array", Array: response}
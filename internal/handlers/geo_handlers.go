@@ -7,6 +7,7 @@ import (
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/pkg/utils/geohash"
 )
 
 type GeoHandlers struct {
@@ -139,62 +140,73 @@ func (h *GeoHandlers) HandleGeoPos(args []models.Value) models.Value {
 	return models.Value{Type: "array", Array: results}
 }
 
+// geoCommand is a command searching a geo set, which determines the
+// options it takes
+type geoCommand int
+
+const (
+	geoRadius geoCommand = iota
+	geoRadiusRO
+	geoSearch
+	geoSearchStore
+)
+
 func (h *GeoHandlers) HandleGeoRadius(args []models.Value) models.Value {
-	if len(args) < 5 {
+	return h.handleGeoRadius(args, false, geoRadius)
+}
+
+func (h *GeoHandlers) HandleGeoRadiusRO(args []models.Value) models.Value {
+	return h.handleGeoRadius(args, false, geoRadiusRO)
+}
+
+func (h *GeoHandlers) HandleGeoRadiusByMember(args []models.Value) models.Value {
+	return h.handleGeoRadius(args, true, geoRadius)
+}
+
+func (h *GeoHandlers) HandleGeoRadiusByMemberRO(args []models.Value) models.Value {
+	return h.handleGeoRadius(args, true, geoRadiusRO)
+}
+
+// handleGeoRadius serves GEORADIUS key longitude latitude radius unit and
+// GEORADIUSBYMEMBER key member radius unit, followed by their options
+func (h *GeoHandlers) handleGeoRadius(args []models.Value, byMember bool, cmd geoCommand) models.Value {
+	minArgs := 5
+	if byMember {
+		minArgs = 4
+	}
+	if len(args) < minArgs {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
 	}
 
 	key := args[0].Bulk
-	lon, err := strconv.ParseFloat(args[1].Bulk, 64)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR longitude must be numeric"}
+	options := &models.GeoSearchOptions{ByRadius: true}
+	i := 1
+	if byMember {
+		options.FromMember = args[1].Bulk
+		i = 2
+	} else {
+		var err error
+		if options.FromLon, options.FromLat, err = parseGeoLonLat(args[1], args[2]); err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
+		}
+		i = 3
 	}
 
-	lat, err := strconv.ParseFloat(args[2].Bulk, 64)
+	radius, err := strconv.ParseFloat(args[i].Bulk, 64)
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR latitude must be numeric"}
+		return models.Value{Type: "error", Str: "ERR need numeric radius"}
 	}
-
-	radius, err := strconv.ParseFloat(args[3].Bulk, 64)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR radius must be numeric"}
-	}
-
-	unit := strings.ToLower(args[4].Bulk)
-
-	// Parse optional arguments
-	var withDist, withCoord, withHash bool
-	var count int
-	var sort string
-
-	for i := 5; i < len(args); i++ {
-		switch strings.ToUpper(args[i].Bulk) {
-		case "WITHCOORD":
-			withCoord = true
-		case "WITHDIST":
-			withDist = true
-		case "WITHHASH":
-			withHash = true
-		case "COUNT":
-			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR COUNT requires argument"}
-			}
-			count, err = strconv.Atoi(args[i+1].Bulk)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR COUNT must be numeric"}
-			}
-			i++
-		case "ASC", "DESC":
-			sort = strings.ToUpper(args[i].Bulk)
-		}
+	if radius < 0 {
+		return models.Value{Type: "error", Str: "ERR radius cannot be negative"}
 	}
+	options.Radius = radius
+	options.Unit = strings.ToLower(args[i+1].Bulk)
 
-	points, err := h.cache.GeoRadius(key, lon, lat, radius, unit, withDist, withCoord, withHash, count, sort)
+	storeKey, err := parseGeoOptions(args[i+2:], options, cmd)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	return h.formatGeoResults(points, withDist, withCoord, withHash, unit)
+	return h.geoSearch(key, storeKey, options)
 }
 
 func (h *GeoHandlers) HandleGeoSearch(args []models.Value) models.Value {
@@ -202,213 +214,216 @@ func (h *GeoHandlers) HandleGeoSearch(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
 	}
 
-	key := args[0].Bulk
 	options := &models.GeoSearchOptions{}
+	if _, err := parseGeoOptions(args[1:], options, geoSearch); err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	return h.geoSearch(args[0].Bulk, "", options)
+}
 
-	i := 1
-	for i < len(args) {
-		switch strings.ToUpper(args[i].Bulk) {
-		case "FROMMEMBER":
-			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR FROMMEMBER requires member name"}
-			}
-			options.FromMember = args[i+1].Bulk
-			i += 2
-
-		case "FROMLONLAT":
-			if i+2 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR FROMLONLAT requires longitude and latitude"}
-			}
-			var err error
-			options.FromLon, err = strconv.ParseFloat(args[i+1].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR longitude must be numeric"}
-			}
-			options.FromLat, err = strconv.ParseFloat(args[i+2].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR latitude must be numeric"}
-			}
-			i += 3
-
-		case "BYBOX":
-			if i+3 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR BYBOX requires width, height and unit"}
-			}
-			var err error
-			options.ByBox = true
-			options.BoxWidth, err = strconv.ParseFloat(args[i+1].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR width must be numeric"}
-			}
-			options.BoxHeight, err = strconv.ParseFloat(args[i+2].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR height must be numeric"}
-			}
-			options.Unit = strings.ToLower(args[i+3].Bulk)
-			i += 4
-
-		case "BYRADIUS":
-			if i+2 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR BYRADIUS requires radius and unit"}
-			}
-			var err error
-			options.ByRadius = true
-			options.Radius, err = strconv.ParseFloat(args[i+1].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR radius must be numeric"}
-			}
-			options.Unit = strings.ToLower(args[i+2].Bulk)
-			i += 3
-
-		case "ASC", "DESC":
-			options.Sort = strings.ToUpper(args[i].Bulk)
-			i++
-
-		case "COUNT":
-			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR COUNT requires argument"}
-			}
-			count, err := strconv.Atoi(args[i+1].Bulk)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR count must be numeric"}
-			}
-			options.Count = count
-			i += 2
-
-		case "WITHCOORD":
-			options.WithCoord = true
-			i++
-
-		case "WITHDIST":
-			options.WithDist = true
-			i++
+func (h *GeoHandlers) HandleGeoSearchStore(args []models.Value) models.Value {
+	if len(args) < 6 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
+	}
 
-		case "WITHHASH":
-			options.WithHash = true
-			i++
+	options := &models.GeoSearchOptions{}
+	if _, err := parseGeoOptions(args[2:], options, geoSearchStore); err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	return h.geoSearch(args[1].Bulk, args[0].Bulk, options)
+}
 
-		default:
-			return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown option %s", args[i].Bulk)}
+// geoSearch runs a search of the geo set at key, storing its results at
+// storeKey if set
+func (h *GeoHandlers) geoSearch(key, storeKey string, options *models.GeoSearchOptions) models.Value {
+	if storeKey != "" {
+		stored, err := h.cache.GeoSearchStore(storeKey, key, options)
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
 		}
+		return models.Value{Type: "integer", Num: stored}
 	}
 
 	points, err := h.cache.GeoSearch(key, options)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	return h.formatGeoResults(points, options.WithDist, options.WithCoord, options.WithHash, options.Unit)
+	return h.formatGeoResults(points, options.WithDist, options.WithCoord, options.WithHash)
 }
 
-func (h *GeoHandlers) HandleGeoSearchStore(args []models.Value) models.Value {
-	if len(args) < 6 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
-	}
+// parseGeoOptions parses the options of a search command into options. It
+// returns the key given to STORE or STOREDIST.
+func parseGeoOptions(args []models.Value, options *models.GeoSearchOptions, cmd geoCommand) (string, error) {
+	search := cmd == geoSearch || cmd == geoSearchStore
+	syntaxErr := fmt.Errorf("ERR syntax error")
+	var storeKey string
+	var from, by int
 
-	destKey := args[0].Bulk
-	srcKey := args[1].Bulk
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(args[i].Bulk)
+		remaining := len(args) - i - 1
 
-	// Parse search options
-	options := &models.GeoSearchOptions{}
-	i := 2 // Start from the third argument
+		switch {
+		case arg == "WITHCOORD" && cmd != geoSearchStore:
+			options.WithCoord = true
+		case arg == "WITHDIST" && cmd != geoSearchStore:
+			options.WithDist = true
+		case arg == "WITHHASH" && cmd != geoSearchStore:
+			options.WithHash = true
 
-	for i < len(args) {
-		switch strings.ToUpper(args[i].Bulk) {
-		case "FROMMEMBER":
-			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR FROMMEMBER requires member name"}
-			}
-			options.FromMember = args[i+1].Bulk
-			i += 2
+		case arg == "ASC" || arg == "DESC":
+			options.Sort = arg
 
-		case "FROMLONLAT":
-			if i+2 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR FROMLONLAT requires longitude and latitude"}
-			}
-			var err error
-			options.FromLon, err = strconv.ParseFloat(args[i+1].Bulk, 64)
+		case arg == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(args[i+1].Bulk)
 			if err != nil {
-				return models.Value{Type: "error", Str: "ERR longitude must be numeric"}
+				return "", fmt.Errorf("ERR value is not an integer or out of range")
 			}
-			options.FromLat, err = strconv.ParseFloat(args[i+2].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR latitude must be numeric"}
+			if count <= 0 {
+				return "", fmt.Errorf("ERR COUNT must be > 0")
 			}
-			i += 3
-
-		case "BYBOX":
-			if i+3 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR BYBOX requires width, height and unit"}
+			options.Count = count
+			i++
+			if i+1 < len(args) && strings.EqualFold(args[i+1].Bulk, "ANY") {
+				options.CountAny = true
+				i++
 			}
+		case arg == "ANY":
+			return "", fmt.Errorf("ERR the ANY argument requires COUNT argument")
+
+		case (arg == "STORE" || arg == "STOREDIST") && cmd == geoRadius && remaining >= 1:
+			storeKey = args[i+1].Bulk
+			options.StoreDist = arg == "STOREDIST"
+			i++
+		case arg == "STOREDIST" && cmd == geoSearchStore:
+			options.StoreDist = true
+
+		case arg == "FROMMEMBER" && search && remaining >= 1:
+			options.FromMember = args[i+1].Bulk
+			from++
+			i++
+		case arg == "FROMLONLAT" && search && remaining >= 2:
 			var err error
-			options.ByBox = true
-			options.BoxWidth, err = strconv.ParseFloat(args[i+1].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR width must be numeric"}
+			if options.FromLon, options.FromLat, err = parseGeoLonLat(args[i+1], args[i+2]); err != nil {
+				return "", err
 			}
-			options.BoxHeight, err = strconv.ParseFloat(args[i+2].Bulk, 64)
+			from++
+			i += 2
+		case arg == "BYRADIUS" && search && remaining >= 2:
+			radius, err := strconv.ParseFloat(args[i+1].Bulk, 64)
 			if err != nil {
-				return models.Value{Type: "error", Str: "ERR height must be numeric"}
+				return "", fmt.Errorf("ERR need numeric radius")
 			}
-			options.Unit = strings.ToLower(args[i+3].Bulk)
-			i += 4
-
-		case "BYRADIUS":
-			if i+2 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR BYRADIUS requires radius and unit"}
-			}
-			var err error
-			options.ByRadius = true
-			options.Radius, err = strconv.ParseFloat(args[i+1].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR radius must be numeric"}
+			if radius < 0 {
+				return "", fmt.Errorf("ERR radius cannot be negative")
 			}
+			options.ByRadius, options.Radius = true, radius
 			options.Unit = strings.ToLower(args[i+2].Bulk)
-			i += 3
-
-		case "ASC", "DESC":
-			options.Sort = strings.ToUpper(args[i].Bulk)
-			i++
-
-		case "COUNT":
-			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR COUNT requires argument"}
+			by++
+			i += 2
+		case arg == "BYBOX" && search && remaining >= 3:
+			width, err1 := strconv.ParseFloat(args[i+1].Bulk, 64)
+			height, err2 := strconv.ParseFloat(args[i+2].Bulk, 64)
+			if err1 != nil || err2 != nil {
+				return "", fmt.Errorf("ERR need numeric width and height")
 			}
-			count, err := strconv.Atoi(args[i+1].Bulk)
+			if width < 0 || height < 0 {
+				return "", fmt.Errorf("ERR height or width cannot be negative")
+			}
+			options.ByBox, options.BoxWidth, options.BoxHeight = true, width, height
+			options.Unit = strings.ToLower(args[i+3].Bulk)
+			by++
+			i += 3
+		case arg == "BYPOLYGON" && search && remaining >= 1:
+			vertices, err := parseGeoPolygon(args[i+1:])
 			if err != nil {
-				return models.Value{Type: "error", Str: "ERR count must be numeric"}
+				return "", err
 			}
-			options.Count = count
-			i += 2
+			// The vertex count, the coordinates and the unit
+			n := 2*len(vertices) + 2
+			if remaining < n {
+				return "", syntaxErr
+			}
+			options.ByPolygon, options.Polygon = true, vertices
+			options.Unit = strings.ToLower(args[i+n].Bulk)
+			by++
+			i += n
 
-		case "WITHCOORD":
-			options.WithCoord = true
-			i++
+		default:
+			return "", syntaxErr
+		}
+	}
 
-		case "WITHDIST":
-			options.WithDist = true
-			i++
+	if search {
+		name := "GEOSEARCH"
+		if cmd == geoSearchStore {
+			name = "GEOSEARCHSTORE"
+		}
+		// A polygon search may leave out its center, which is then the
+		// center of the polygon
+		if from > 1 || (from == 0 && !options.ByPolygon) {
+			return "", fmt.Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name)
+		}
+		if by != 1 {
+			return "", fmt.Errorf("ERR exactly one of BYRADIUS, BYBOX and BYPOLYGON can be specified for %s", name)
+		}
+		if from == 0 {
+			polygon, err := geohash.NewPolygon(options.Polygon)
+			if err != nil {
+				return "", err
+			}
+			options.FromLon, options.FromLat = polygon.Center()
+		}
+	}
+	if storeKey != "" && (options.WithDist || options.WithHash || options.WithCoord) {
+		return "", fmt.Errorf("ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	return storeKey, nil
+}
 
-		case "WITHHASH":
-			options.WithHash = true
-			i++
+// parseGeoPolygon parses the vertices of a polygon: their count followed
+// by their longitudes and latitudes. Arguments after them are left alone.
+func parseGeoPolygon(args []models.Value) ([][2]float64, error) {
+	n, err := strconv.Atoi(args[0].Bulk)
+	if err != nil {
+		return nil, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	if n < 3 {
+		return nil, fmt.Errorf("ERR a polygon needs at least 3 vertices")
+	}
+	if len(args) < 1+2*n {
+		return nil, fmt.Errorf("ERR syntax error")
+	}
 
-		default:
-			return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown option %s", args[i].Bulk)}
+	vertices := make([][2]float64, n)
+	for i := range vertices {
+		lon, lat, err := parseGeoLonLat(args[1+2*i], args[2+2*i])
+		if err != nil {
+			return nil, err
 		}
+		vertices[i] = [2]float64{lon, lat}
 	}
+	return vertices, nil
+}
 
-	// Store results
-	stored, err := h.cache.GeoSearchStore(destKey, srcKey, options)
+func parseGeoLonLat(lonArg, latArg models.Value) (float64, float64, error) {
+	lon, err := strconv.ParseFloat(lonArg.Bulk, 64)
 	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+		return 0, 0, fmt.Errorf("ERR longitude must be numeric")
 	}
-
-	return models.Value{Type: "integer", Num: stored}
+	lat, err := strconv.ParseFloat(latArg.Bulk, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ERR latitude must be numeric")
+	}
+	if !geohash.Valid(lon, lat) {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
 }
 
-// Helper function to format geo results
-func (h *GeoHandlers) formatGeoResults(points []models.GeoPoint, withDist, withCoord, withHash bool, unit string) models.Value {
+// formatGeoResults replies with the members found by a search, each with
+// its distance, score and coordinates if requested
+func (h *GeoHandlers) formatGeoResults(points []models.GeoPoint, withDist, withCoord, withHash bool) models.Value {
 	results := make([]models.Value, len(points))
 	for i, point := range points {
 		var result []models.Value
@@ -421,6 +436,11 @@ func (h *GeoHandlers) formatGeoResults(points []models.GeoPoint, withDist, withC
 			result = append(result, models.Value{Type: "bulk", Bulk: fmt.Sprintf("%.4f", point.Distance)})
 		}
 
+		// Add the score if requested
+		if withHash {
+			result = append(result, models.Value{Type: "integer", Num: int(point.Hash)})
+		}
+
 		// Add coordinates if requested
 		if withCoord {
 			coords := []models.Value{
@@ -430,11 +450,6 @@ func (h *GeoHandlers) formatGeoResults(points []models.GeoPoint, withDist, withC
 			result = append(result, models.Value{Type: "array", Array: coords})
 		}
 
-		// Add geohash if requested
-		if withHash {
-			result = append(result, models.Value{Type: "bulk", Bulk: point.GeoHash})
-		}
-
 		// If we're only returning the member name, don't wrap it in an array
 		if len(result) == 1 {
 			results[i] = result[0]
@@ -445,3 +460,113 @@ func (h *GeoHandlers) formatGeoResults(points []models.GeoPoint, withDist, withC
 
 	return models.Value{Type: "array", Array: results}
 }
+
+// HandleGeoFence serves the GEOFENCE subcommands managing the fences of a
+// geo set, whose crossings GEOADD publishes:
+//
+//	GEOFENCE ADD key name POLYGON numvertices longitude latitude [longitude latitude ...]
+//	GEOFENCE ADD key name CIRCLE longitude latitude radius unit
+//	GEOFENCE DEL key name [name ...]
+//	GEOFENCE LIST key
+func (h *GeoHandlers) HandleGeoFence(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
+	}
+
+	key := args[1].Bulk
+	switch strings.ToUpper(args[0].Bulk) {
+	case "ADD":
+		if len(args) < 5 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
+		}
+		fence := models.GeoFence{Name: args[2].Bulk}
+		switch strings.ToUpper(args[3].Bulk) {
+		case "POLYGON":
+			vertices, err := parseGeoPolygon(args[4:])
+			if err != nil {
+				return models.Value{Type: "error", Str: err.Error()}
+			}
+			if len(args) != 5+2*len(vertices) {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
+			}
+			fence.Polygon = vertices
+		case "CIRCLE":
+			if len(args) != 8 {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
+			}
+			var err error
+			if fence.Longitude, fence.Latitude, err = parseGeoLonLat(args[4], args[5]); err != nil {
+				return models.Value{Type: "error", Str: err.Error()}
+			}
+			if fence.Radius, err = strconv.ParseFloat(args[6].Bulk, 64); err != nil {
+				return models.Value{Type: "error", Str: "ERR need numeric radius"}
+			}
+			fence.Unit = strings.ToLower(args[7].Bulk)
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
+
+		added, err := h.cache.GeoFenceAdd(key, fence)
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
+		}
+		if added {
+			return models.Value{Type: "integer", Num: 1}
+		}
+		return models.Value{Type: "integer", Num: 0}
+
+	case "DEL":
+		if len(args) < 3 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
+		}
+		names := make([]string, len(args)-2)
+		for i, arg := range args[2:] {
+			names[i] = arg.Bulk
+		}
+		return models.Value{Type: "integer", Num: h.cache.GeoFenceDel(key, names...)}
+
+	case "LIST":
+		if len(args) != 2 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
+		}
+		fences := h.cache.GeoFenceList(key)
+		results := make([]models.Value, len(fences))
+		for i, fence := range fences {
+			results[i] = formatGeoFence(fence)
+		}
+		return models.Value{Type: "array", Array: results}
+
+	default:
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown subcommand '%s'", args[0].Bulk)}
+	}
+}
+
+// formatGeoFence replies with a fence the way it was added: its name, its
+// kind and its polygon vertices, or its circle center, radius and unit
+func formatGeoFence(fence models.GeoFence) models.Value {
+	coords := func(lon, lat float64) models.Value {
+		return models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: fmt.Sprintf("%.6f", lon)},
+			{Type: "bulk", Bulk: fmt.Sprintf("%.6f", lat)},
+		}}
+	}
+
+	if len(fence.Polygon) > 0 {
+		vertices := make([]models.Value, len(fence.Polygon))
+		for i, v := range fence.Polygon {
+			vertices[i] = coords(v[0], v[1])
+		}
+		return models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: fence.Name},
+			{Type: "bulk", Bulk: "polygon"},
+			{Type: "array", Array: vertices},
+		}}
+	}
+	return models.Value{Type: "array", Array: []models.Value{
+		{Type: "bulk", Bulk: fence.Name},
+		{Type: "bulk", Bulk: "circle"},
+		coords(fence.Longitude, fence.Latitude),
+		{Type: "bulk", Bulk: strconv.FormatFloat(fence.Radius, 'f', -1, 64)},
+		{Type: "bulk", Bulk: fence.Unit},
+	}}
+}
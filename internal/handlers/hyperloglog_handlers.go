@@ -19,7 +19,7 @@ func NewHLLHandlers(cache ports.Cache) *HLLHandlers {
 
 // HandlePFAdd handles the PFADD command
 func (h *HLLHandlers) HandlePFAdd(args []models.Value) models.Value {
-	if len(args) < 2 {
+	if len(args) < 1 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'pfadd' command"}
 	}
 
@@ -58,7 +58,7 @@ func (h *HLLHandlers) HandlePFCount(args []models.Value) models.Value {
 
 // HandlePFMerge handles the PFMERGE command
 func (h *HLLHandlers) HandlePFMerge(args []models.Value) models.Value {
-	if len(args) < 2 {
+	if len(args) < 1 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'pfmerge' command"}
 	}
 
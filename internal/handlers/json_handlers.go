@@ -17,7 +17,6 @@ type JSONHandlers struct {
 	cache          ports.Cache
 	compare        *jsonUtil.Compare
 	merge          *jsonUtil.Merge
-	pathUtil       *jsonUtil.PathUtil
 	respUtil       *jsonUtil.RespUtil
 	searchUtil     *jsonUtil.SearchUtil
 	validationUtil *jsonUtil.ValidationUtil
@@ -28,537 +27,578 @@ func NewJSONHandlers(cache ports.Cache) *JSONHandlers {
 		cache:          cache,
 		compare:        jsonUtil.NewCompare(),
 		merge:          jsonUtil.NewMerge(),
-		pathUtil:       jsonUtil.NewPathUtil(),
 		respUtil:       jsonUtil.NewRespUtil(),
 		searchUtil:     jsonUtil.NewSearchUtil(),
 		validationUtil: jsonUtil.NewValidationUtil(),
 	}
 }
 
-func (h *JSONHandlers) HandleJSON(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SET command"}
+// jsonDoc is a JSON key together with the nodes a path selects in it.
+type jsonDoc struct {
+	key     string
+	value   interface{}
+	path    *jsonUtil.Path
+	matches []*jsonUtil.Match
+}
+
+func compileJSONPath(expr string) (*jsonUtil.Path, error) {
+	path, err := jsonUtil.CompilePath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("ERR %v", err)
 	}
+	return path, nil
+}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	jsonStr := args[2].Bulk
+// load compiles expr and resolves it against the document stored at key.
+// It returns a nil document when the key does not exist.
+func (h *JSONHandlers) load(key, expr string) (*jsonDoc, error) {
+	path, err := compileJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	value, exists := h.cache.GetJSON(key)
+	if !exists {
+		return nil, nil
+	}
+	d := &jsonDoc{key: key, value: value, path: path}
+	d.matches = path.Find(&d.value)
+	return d, nil
+}
 
-	var value interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &value); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid JSON string"}
+// targets returns the nodes a command operates on: every match for $
+// paths, only the first one for legacy paths.
+func (d *jsonDoc) targets() []*jsonUtil.Match {
+	if d.path.IsLegacy() && len(d.matches) > 1 {
+		return d.matches[:1]
 	}
+	return d.matches
+}
 
-	// Handle root path
-	if path == "." {
-		if err := h.cache.SetJSON(key, value); err != nil {
-			return util.ToValue(err)
+// each runs fn for the selected nodes. Legacy paths reply with fn's result
+// for the first match; $ paths reply with an array holding one result per
+// match, in which errors such as type mismatches become nulls.
+func (d *jsonDoc) each(fn func(m *jsonUtil.Match) models.Value) models.Value {
+	if d.path.IsLegacy() {
+		if len(d.matches) == 0 {
+			return models.Value{Type: "error", Str: "ERR path does not exist"}
 		}
-		return models.Value{Type: "string", Str: "OK"}
+		return fn(d.matches[0])
 	}
 
-	// Get existing JSON if exists
-	existingValue, exists := h.cache.GetJSON(key)
-	var data map[string]interface{}
-
-	if exists {
-		if existingMap, ok := existingValue.(map[string]interface{}); ok {
-			data = existingMap
-		} else {
-			data = make(map[string]interface{})
+	results := make([]models.Value, len(d.matches))
+	for i, m := range d.matches {
+		results[i] = fn(m)
+		if results[i].Type == "error" {
+			results[i] = models.Value{Type: "null"}
 		}
-	} else {
-		data = make(map[string]interface{})
 	}
+	return models.Value{Type: "array", Array: results}
+}
 
-	// Set value at path
-	if err := h.setNestedValue(data, path, value); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+// eachJSON is like each but encodes the results as JSON: a single value for
+// legacy paths, an array of values for $ paths.
+func (d *jsonDoc) eachJSON(fn func(m *jsonUtil.Match) (interface{}, error)) models.Value {
+	var result interface{}
+	if d.path.IsLegacy() {
+		if len(d.matches) == 0 {
+			return models.Value{Type: "error", Str: "ERR path does not exist"}
+		}
+		v, err := fn(d.matches[0])
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
+		}
+		result = v
+	} else {
+		values := make([]interface{}, len(d.matches))
+		for i, m := range d.matches {
+			if v, err := fn(m); err == nil {
+				values[i] = v
+			}
+		}
+		result = values
 	}
 
-	// Store updated data
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return models.Value{Type: "error", Str: "ERR failed to encode result"}
 	}
-
-	return models.Value{Type: "string", Str: "OK"}
+	return models.Value{Type: "bulk", Bulk: string(encoded)}
 }
 
-func (h *JSONHandlers) setNestedValue(data map[string]interface{}, path string, value interface{}) error {
-	parts := h.pathUtil.ParsePath(path)
-	current := data
-
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		arrayIndex, isArray := h.pathUtil.ParseArrayIndex(part)
-
-		if isArray {
-			arr, ok := current[parts[i-1]].([]interface{})
-			if !ok {
-				return fmt.Errorf("ERR path element is not an array")
-			}
-			if arrayIndex >= len(arr) {
-				return fmt.Errorf("ERR array index out of range")
-			}
-			if nextMap, ok := arr[arrayIndex].(map[string]interface{}); ok {
-				current = nextMap
-			} else {
-				newMap := make(map[string]interface{})
-				arr[arrayIndex] = newMap
-				current = newMap
-			}
-		} else {
-			next, exists := current[part]
-			if !exists {
-				next = make(map[string]interface{})
-				current[part] = next
-			}
-			if nextMap, ok := next.(map[string]interface{}); ok {
-				current = nextMap
-			} else {
-				return fmt.Errorf("ERR path element is not an object")
-			}
-		}
+// update is load for commands that modify the document. fn gets the
+// document, or nil when the key does not exist, and reports whether it
+// modified it; the modified document is stored with no other update of
+// the key in between. The reply is fn's.
+func (h *JSONHandlers) update(key, expr string, fn func(d *jsonDoc) (bool, models.Value)) models.Value {
+	path, err := compileJSONPath(expr)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	lastPart := parts[len(parts)-1]
-	arrayIndex, isArray := h.pathUtil.ParseArrayIndex(lastPart)
-
-	if isArray {
-		arr, ok := current[parts[len(parts)-2]].([]interface{})
-		if !ok {
-			return fmt.Errorf("ERR path element is not an array")
+	var reply models.Value
+	err = h.cache.UpdateJSON(key, func(stored *jsonUtil.Document) (*jsonUtil.Document, error) {
+		var d *jsonDoc
+		if stored != nil {
+			d = &jsonDoc{key: key, value: stored.Decode(), path: path}
+			d.matches = path.Find(&d.value)
 		}
-		if arrayIndex >= len(arr) {
-			newArr := make([]interface{}, arrayIndex+1)
-			copy(newArr, arr)
-			arr = newArr
-			current[parts[len(parts)-2]] = arr
+		modified, r := fn(d)
+		reply = r
+		if !modified {
+			return stored, nil
 		}
-		arr[arrayIndex] = value
-	} else {
-		current[lastPart] = value
+		return encodeJSONDoc(d.value)
+	})
+	if err != nil {
+		return util.ToValue(err)
 	}
+	return reply
+}
 
-	return nil
+func encodeJSONDoc(value interface{}) (*jsonUtil.Document, error) {
+	doc, err := jsonUtil.EncodeDocument(value)
+	if err != nil {
+		return nil, fmt.Errorf("ERR %v", err)
+	}
+	return doc, nil
 }
 
-func (h *JSONHandlers) HandleJSONGet(args []models.Value) models.Value {
-	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.GET command"}
+func parseJSONArgs(args []models.Value) ([]interface{}, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if err := json.Unmarshal([]byte(arg.Bulk), &values[i]); err != nil {
+			return nil, fmt.Errorf("ERR invalid JSON value")
+		}
 	}
+	return values, nil
+}
 
-	key := args[0].Bulk
-	path := "."
-	if len(args) > 1 {
-		path = args[1].Bulk
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
 	}
+	return 0, false
+}
 
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
+// HandleJSON implements JSON.SET key path value [NX | XX]. NX only writes
+// paths that do not exist yet and XX only paths that do; a write skipped
+// for either condition replies with null. New keys must be created at the
+// root.
+func (h *JSONHandlers) HandleJSON(args []models.Value) models.Value {
+	if len(args) < 3 || len(args) > 4 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SET command"}
 	}
 
-	if path == "." {
-		result, err := json.Marshal(value)
-		if err != nil {
-			return models.Value{Type: "error", Str: "ERR failed to encode JSON"}
+	nx, xx := false, false
+	if len(args) == 4 {
+		switch strings.ToUpper(args[3].Bulk) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
-		return models.Value{Type: "bulk", Bulk: string(result)}
 	}
 
-	result, err := h.getNestedValue(value, path)
+	key := args[0].Bulk
+	path, err := compileJSONPath(args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	resultJSON, err := json.Marshal(result)
+	value, err := jsonUtil.ParseDocument([]byte(args[2].Bulk))
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode JSON"}
+		return models.Value{Type: "error", Str: "ERR invalid JSON string"}
 	}
 
-	return models.Value{Type: "bulk", Bulk: string(resultJSON)}
+	// A write skipped for NX or XX leaves the document as it is
+	skipped := false
+	err = h.cache.UpdateJSON(key, func(stored *jsonUtil.Document) (*jsonUtil.Document, error) {
+		skipped = false
+		if path.IsRoot() {
+			if (nx && stored != nil) || (xx && stored == nil) {
+				skipped = true
+				return stored, nil
+			}
+			return value, nil
+		}
+
+		if stored == nil {
+			if xx {
+				skipped = true
+				return nil, nil
+			}
+			return nil, fmt.Errorf("ERR new objects must be created at the root")
+		}
+
+		// Replacing a value a singular path selects splices the stored
+		// document without decoding it
+		if updated, ok := stored.Replace(path, value); ok {
+			if nx {
+				skipped = true
+				return stored, nil
+			}
+			return updated, nil
+		}
+
+		doc := stored.Decode()
+		if found := len(path.Find(&doc)) > 0; (nx && found) || (xx && !found) {
+			skipped = true
+			return stored, nil
+		}
+		if path.Set(&doc, value.Decode()) == 0 {
+			if path.IsLegacy() {
+				return nil, fmt.Errorf("ERR path does not exist or its parent is not an object")
+			}
+			skipped = true
+			return stored, nil
+		}
+		return encodeJSONDoc(doc)
+	})
+	if err != nil {
+		return util.ToValue(err)
+	}
+	if skipped {
+		return models.Value{Type: "null"}
+	}
+	return models.Value{Type: "string", Str: "OK"}
 }
 
-func (h *JSONHandlers) HandleJSONDel(args []models.Value) models.Value {
+// HandleJSONGet returns the values selected by one or more paths. With
+// several paths the reply is an object keyed by path.
+func (h *JSONHandlers) HandleJSONGet(args []models.Value) models.Value {
 	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.DEL command"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.GET command"}
 	}
 
 	key := args[0].Bulk
-	path := "."
+	exprs := []string{"."}
 	if len(args) > 1 {
-		path = args[1].Bulk
-	}
-
-	// If key doesn't exist, return 0
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "integer", Num: 0}
+		exprs = exprs[:0]
+		for _, arg := range args[1:] {
+			exprs = append(exprs, arg.Bulk)
+		}
 	}
 
-	// If root path, delete entire key
-	if path == "." {
-		deleted := h.cache.DeleteJSON(key)
-		if deleted {
-			return models.Value{Type: "integer", Num: 1}
+	paths := make([]*jsonUtil.Path, len(exprs))
+	legacy := true
+	for i, expr := range exprs {
+		path, err := compileJSONPath(expr)
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
 		}
-		return models.Value{Type: "integer", Num: 0}
+		paths[i] = path
+		legacy = legacy && path.IsLegacy()
 	}
 
-	// Handle nested deletion
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR key contains non-object JSON"}
+	doc, exists := h.cache.GetJSONDocument(key)
+	if !exists {
+		return models.Value{Type: "null"}
 	}
 
-	// Delete at path
-	ok, delErr := h.deleteNestedValue(data, path)
-	if delErr != nil {
-		return models.Value{Type: "error", Str: delErr.Error()}
-	}
-	if !ok {
-		return models.Value{Type: "integer", Num: 0}
+	singular := true
+	for _, path := range paths {
+		singular = singular && path.IsSingular()
 	}
-
-	// Store updated data
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
+	if singular {
+		return getJSONNodes(doc, exprs, paths, legacy)
 	}
 
-	return models.Value{Type: "integer", Num: 1}
-}
-
-// Helper method to delete values at nested paths (keep existing implementation)
-func (h *JSONHandlers) deleteNestedValue(data map[string]interface{}, path string) (bool, error) {
-	parts := h.pathUtil.ParsePath(path)
-	if len(parts) == 0 {
-		return false, fmt.Errorf("ERR invalid path")
+	value := doc.Decode()
+	selectValue := func(path *jsonUtil.Path) (interface{}, error) {
+		values := path.Query(value)
+		if !legacy {
+			if values == nil {
+				values = []interface{}{}
+			}
+			return values, nil
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("ERR path does not exist")
+		}
+		return values[0], nil
 	}
 
-	// If we're deleting a top-level key
-	if len(parts) == 1 {
-		if _, exists := data[parts[0]]; !exists {
-			return false, nil
+	var result interface{}
+	if len(paths) == 1 {
+		v, err := selectValue(paths[0])
+		if err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
 		}
-		delete(data, parts[0])
-		return true, nil
+		result = v
+	} else {
+		obj := make(map[string]interface{}, len(paths))
+		for i, path := range paths {
+			v, err := selectValue(path)
+			if err != nil {
+				return models.Value{Type: "error", Str: err.Error()}
+			}
+			obj[exprs[i]] = v
+		}
+		result = obj
 	}
 
-	// Navigate to the parent of the target to delete
-	current := data
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		arrayIndex, isArray := h.pathUtil.ParseArrayIndex(part)
-
-		if isArray {
-			// Handle array access
-			arr, ok := current[parts[i-1]].([]interface{})
-			if !ok {
-				return false, fmt.Errorf("ERR path element is not an array")
-			}
-			if arrayIndex >= len(arr) {
-				return false, fmt.Errorf("ERR array index out of range")
-			}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return models.Value{Type: "error", Str: "ERR failed to encode JSON"}
+	}
+	return models.Value{Type: "bulk", Bulk: string(encoded)}
+}
 
-			// Get the next object in the path
-			nextObj, ok := arr[arrayIndex].(map[string]interface{})
-			if !ok {
-				return false, fmt.Errorf("ERR path element is not an object")
-			}
-			current = nextObj
-		} else {
-			// Handle object access
-			next, exists := current[part]
-			if !exists {
-				return false, nil
-			}
-			nextObj, ok := next.(map[string]interface{})
-			if !ok {
-				return false, fmt.Errorf("ERR path element is not an object")
-			}
-			current = nextObj
+// getJSONNodes is JSON.GET for paths that select at most one node each.
+// The reply is copied straight from the stored document.
+func getJSONNodes(doc *jsonUtil.Document, exprs []string, paths []*jsonUtil.Path, legacy bool) models.Value {
+	var buf []byte
+	var err error
+	if len(paths) == 1 {
+		if buf, err = appendJSONNode(buf, doc, paths[0], legacy); err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
 		}
+		return models.Value{Type: "bulk", Bulk: string(buf)}
 	}
 
-	// Delete the target
-	lastPart := parts[len(parts)-1]
-	arrayIndex, isArray := h.pathUtil.ParseArrayIndex(lastPart)
+	// Members are written in key order, as for an encoded map
+	order := make([]int, len(exprs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return exprs[order[a]] < exprs[order[b]] })
 
-	if isArray {
-		// Handle array element deletion
-		parentKey := parts[len(parts)-2]
-		arr, ok := current[parentKey].([]interface{})
-		if !ok {
-			return false, fmt.Errorf("ERR path element is not an array")
+	buf = append(buf, '{')
+	for n, i := range order {
+		if n+1 < len(order) && exprs[order[n+1]] == exprs[i] {
+			continue
 		}
-		if arrayIndex >= len(arr) {
-			return false, fmt.Errorf("ERR array index out of range")
+		if len(buf) > 1 {
+			buf = append(buf, ',')
 		}
+		name, _ := json.Marshal(exprs[i])
+		buf = append(append(buf, name...), ':')
+		if buf, err = appendJSONNode(buf, doc, paths[i], legacy); err != nil {
+			return models.Value{Type: "error", Str: err.Error()}
+		}
+	}
+	buf = append(buf, '}')
+	return models.Value{Type: "bulk", Bulk: string(buf)}
+}
 
-		// Remove the element at the specified index
-		newArr := append(arr[:arrayIndex], arr[arrayIndex+1:]...)
-		current[parentKey] = newArr
-		return true, nil
-	} else {
-		// Handle object property deletion
-		if _, exists := current[lastPart]; !exists {
-			return false, nil
+// appendJSONNode appends the node a singular path selects: the node itself
+// for legacy paths, an array of zero or one node otherwise.
+func appendJSONNode(dst []byte, doc *jsonUtil.Document, path *jsonUtil.Path, legacy bool) ([]byte, error) {
+	n, found := doc.Lookup(path)
+	if legacy {
+		if !found {
+			return nil, fmt.Errorf("ERR path does not exist")
 		}
-		delete(current, lastPart)
-		return true, nil
+		return n.AppendJSON(dst), nil
+	}
+	dst = append(dst, '[')
+	if found {
+		dst = n.AppendJSON(dst)
 	}
+	return append(dst, ']'), nil
 }
 
-func (h *JSONHandlers) HandleJSONType(args []models.Value) models.Value {
+func (h *JSONHandlers) HandleJSONDel(args []models.Value) models.Value {
 	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.TYPE command"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.DEL command"}
 	}
 
 	key := args[0].Bulk
-	path := "."
+	expr := "."
 	if len(args) > 1 {
-		path = args[1].Bulk
+		expr = args[1].Bulk
 	}
 
-	// Get value from cache using native JSON storage
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
+	path, err := compileJSONPath(expr)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	// Get value at path
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var pathErr error
-		target, pathErr = h.getNestedValue(value, path)
-		if pathErr != nil {
-			return models.Value{Type: "error", Str: pathErr.Error()}
-		}
+	// Deleting the root removes the whole key
+	if path.IsRoot() {
+		return models.Value{Type: "integer", Num: btoi(h.cache.DeleteJSON(key))}
 	}
 
-	// Determine type
-	jsonType := "none"
-	switch v := target.(type) {
+	return h.update(key, expr, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "integer", Num: 0}
+		}
+
+		targets := d.targets()
+		jsonUtil.SortForDelete(targets)
+		deleted := 0
+		for _, m := range targets {
+			if m.Delete() {
+				deleted++
+			}
+		}
+
+		return deleted > 0, models.Value{Type: "integer", Num: deleted}
+	})
+}
+
+func jsonTypeName(v interface{}) (string, bool) {
+	switch v.(type) {
 	case nil:
-		jsonType = "null"
+		return "null", true
 	case bool:
-		jsonType = "boolean"
-	case float64:
-		jsonType = "number"
-	case int:
-		jsonType = "number"
-	case int64:
-		jsonType = "number"
+		return "boolean", true
+	case float64, int, int64:
+		return "number", true
 	case string:
-		jsonType = "string"
+		return "string", true
 	case []interface{}:
-		jsonType = "array"
+		return "array", true
 	case map[string]interface{}:
-		jsonType = "object"
-	default:
-		return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown JSON type: %T", v)}
-	}
-
-	return models.Value{Type: "bulk", Bulk: jsonType}
-}
-
-// Keep the existing getNestedValue helper as it works with interface{} types
-func (h *JSONHandlers) getNestedValue(data interface{}, path string) (interface{}, error) {
-	parts := h.pathUtil.ParsePath(path)
-	current := data
-
-	for _, part := range parts {
-		arrayIndex, isArray := h.pathUtil.ParseArrayIndex(part)
-
-		if isArray {
-			// Handle array access
-			arr, ok := current.([]interface{})
-			if !ok {
-				return nil, fmt.Errorf("ERR path element is not an array")
-			}
-			if arrayIndex >= len(arr) {
-				return nil, fmt.Errorf("ERR array index out of range")
-			}
-			current = arr[arrayIndex]
-		} else {
-			// Handle object access
-			obj, ok := current.(map[string]interface{})
-			if !ok {
-				return nil, fmt.Errorf("ERR path element is not an object")
-			}
-			var exists bool
-			current, exists = obj[part]
-			if !exists {
-				return nil, fmt.Errorf("ERR path does not exist")
-			}
-		}
+		return "object", true
 	}
-
-	return current, nil
+	return "", false
 }
 
-func (h *JSONHandlers) HandleJSONArrAppend(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRAPPEND command"}
+func (h *JSONHandlers) HandleJSONType(args []models.Value) models.Value {
+	if len(args) < 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.TYPE command"}
 	}
 
 	key := args[0].Bulk
-	path := args[1].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
+	expr := "."
+	if len(args) > 1 {
+		expr = args[1].Bulk
 	}
 
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(key, expr)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+	if d == nil {
+		return models.Value{Type: "null"}
 	}
 
-	// Append all values
-	for i := 2; i < len(args); i++ {
-		var valueToAppend interface{}
-		if err := json.Unmarshal([]byte(args[i].Bulk), &valueToAppend); err != nil {
-			return models.Value{Type: "error", Str: "ERR invalid JSON value"}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		name, ok := jsonTypeName(m.Value)
+		if !ok {
+			return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown JSON type: %T", m.Value)}
 		}
-		arr = append(arr, valueToAppend)
-	}
+		return models.Value{Type: "bulk", Bulk: name}
+	})
+}
 
-	// Update the array at path
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
+func (h *JSONHandlers) HandleJSONArrAppend(args []models.Value) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRAPPEND command"}
 	}
 
-	if err := h.setNestedValue(data, path, arr); err != nil {
+	values, err := parseJSONArgs(args[2:])
+	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
+		}
+
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			arr, ok := m.Value.([]interface{})
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+			}
+			for _, v := range values {
+				if modified {
+					v = jsonUtil.Clone(v)
+				}
+				arr = append(arr, v)
+			}
+			m.Replace(arr)
+			modified = true
+			return models.Value{Type: "integer", Num: len(arr)}
+		})
 
-	return models.Value{Type: "integer", Num: len(arr)}
+		return modified, reply
+	})
 }
 
-func (h *JSONHandlers) HandleJSONArrLen(args []models.Value) models.Value {
+// handleJSONLen implements the *LEN commands, which reply with null for a
+// missing key and default to the root path.
+func (h *JSONHandlers) handleJSONLen(args []models.Value, command string, length func(v interface{}) (int, bool), typeErr string) models.Value {
 	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRLEN command"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for " + command + " command"}
 	}
 
-	key := args[0].Bulk
-	path := "."
+	expr := "."
 	if len(args) > 1 {
-		path = args[1].Bulk
+		expr = args[1].Bulk
 	}
 
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
+	d, err := h.load(args[0].Bulk, expr)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	if d == nil {
 		return models.Value{Type: "null"}
 	}
 
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var err error
-		target, err = h.getNestedValue(value, path)
-		if err != nil {
-			return models.Value{Type: "error", Str: err.Error()}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		n, ok := length(m.Value)
+		if !ok {
+			return models.Value{Type: "error", Str: typeErr}
 		}
-	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
+		return models.Value{Type: "integer", Num: n}
+	})
+}
 
-	return models.Value{Type: "integer", Num: len(arr)}
+func (h *JSONHandlers) HandleJSONArrLen(args []models.Value) models.Value {
+	return h.handleJSONLen(args, "JSON.ARRLEN", func(v interface{}) (int, bool) {
+		arr, ok := v.([]interface{})
+		return len(arr), ok
+	}, "ERR path does not point to an array")
 }
 
 func (h *JSONHandlers) HandleJSONStrLen(args []models.Value) models.Value {
-	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.STRLEN command"}
-	}
+	return h.handleJSONLen(args, "JSON.STRLEN", func(v interface{}) (int, bool) {
+		str, ok := v.(string)
+		return len(str), ok
+	}, "ERR path does not point to a string")
+}
 
-	key := args[0].Bulk
-	path := "."
-	if len(args) > 1 {
-		path = args[1].Bulk
+func (h *JSONHandlers) HandleJSONObjLen(args []models.Value) models.Value {
+	return h.handleJSONLen(args, "JSON.OBJLEN", func(v interface{}) (int, bool) {
+		obj, ok := v.(map[string]interface{})
+		return len(obj), ok
+	}, "ERR path does not point to an object")
+}
+
+func (h *JSONHandlers) HandleJSONToggle(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.TOGGLE command"}
 	}
 
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
-	}
-
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var err error
-		target, err = h.getNestedValue(value, path)
-		if err != nil {
-			return models.Value{Type: "error", Str: err.Error()}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
 		}
-	}
-
-	str, ok := target.(string)
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to a string"}
-	}
-
-	return models.Value{Type: "integer", Num: len(str)}
-}
-
-func (h *JSONHandlers) HandleJSONToggle(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.TOGGLE command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
 
-	boolValue, ok := target.(bool)
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to a boolean"}
-	}
-
-	// Toggle the boolean value
-	if err := h.setNestedValue(data, path, !boolValue); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			boolValue, ok := m.Value.(bool)
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to a boolean"}
+			}
+			m.Replace(!boolValue)
+			modified = true
+			return models.Value{Type: "integer", Num: btoi(!boolValue)}
+		})
 
-	return models.Value{Type: "integer", Num: btoi(!boolValue)}
+		return modified, reply
+	})
 }
 
 // Helper function to convert boolean to int
@@ -574,41 +614,31 @@ func (h *JSONHandlers) HandleJSONArrIndex(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRINDEX command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	searchValue := args[2].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
+	var searchItem interface{}
+	if err := json.Unmarshal([]byte(args[2].Bulk), &searchItem); err != nil {
+		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
 	}
 
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Parse search value
-	var searchItem interface{}
-	if err := json.Unmarshal([]byte(searchValue), &searchItem); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
+	if d == nil {
+		return models.Value{Type: "null"}
 	}
 
-	// Search for value in array
-	for i, item := range arr {
-		if h.compare.Equal(item, searchItem) {
-			return models.Value{Type: "integer", Num: i}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		arr, ok := m.Value.([]interface{})
+		if !ok {
+			return models.Value{Type: "error", Str: "ERR path does not point to an array"}
 		}
-	}
-
-	return models.Value{Type: "integer", Num: -1}
+		for i, item := range arr {
+			if h.compare.Equal(item, searchItem) {
+				return models.Value{Type: "integer", Num: i}
+			}
+		}
+		return models.Value{Type: "integer", Num: -1}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONArrTrim(args []models.Value) models.Value {
@@ -616,221 +646,192 @@ func (h *JSONHandlers) HandleJSONArrTrim(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRTRIM command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	startStr := args[2].Bulk
-	stopStr := args[3].Bulk
-
-	start, err := strconv.Atoi(startStr)
+	start, err := strconv.Atoi(args[2].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: "ERR invalid start index"}
 	}
 
-	stop, err := strconv.Atoi(stopStr)
+	stop, err := strconv.Atoi(args[3].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: "ERR invalid stop index"}
 	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Handle negative indices
-	length := len(arr)
-	if start < 0 {
-		start = length + start
-	}
-	if stop < 0 {
-		stop = length + stop
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
+		}
 
-	// Boundary checks
-	if start < 0 {
-		start = 0
-	}
-	if stop >= length {
-		stop = length - 1
-	}
-	if start > stop {
-		arr = []interface{}{}
-	} else {
-		arr = arr[start : stop+1]
-	}
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			arr, ok := m.Value.([]interface{})
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+			}
 
-	// Update the array at path
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
+			// Handle negative indices
+			from, to := start, stop
+			length := len(arr)
+			if from < 0 {
+				from = length + from
+			}
+			if to < 0 {
+				to = length + to
+			}
 
-	if err := h.setNestedValue(data, path, arr); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
+			// Boundary checks
+			if from < 0 {
+				from = 0
+			}
+			if to >= length {
+				to = length - 1
+			}
+			if from > to {
+				arr = []interface{}{}
+			} else {
+				arr = arr[from : to+1]
+			}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+			m.Replace(arr)
+			modified = true
+			return models.Value{Type: "integer", Num: len(arr)}
+		})
 
-	return models.Value{Type: "integer", Num: len(arr)}
+		return modified, reply
+	})
 }
 
-func (h *JSONHandlers) HandleJSONNumIncrBy(args []models.Value) models.Value {
+// handleJSONNumOp applies op to every selected number and replies with the
+// new values encoded as JSON.
+func (h *JSONHandlers) handleJSONNumOp(args []models.Value, command, operandErr string, op func(a, b float64) float64) models.Value {
 	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.NUMINCRBY command"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for " + command + " command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	incrBy, err := strconv.ParseFloat(args[2].Bulk, 64)
+	operand, err := strconv.ParseFloat(args[2].Bulk, 64)
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR increment amount must be a valid number"}
-	}
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
+		return models.Value{Type: "error", Str: operandErr}
 	}
 
-	// Get number at path
-	target, err := h.getNestedValue(value, path)
+	path, err := compileJSONPath(args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	var numValue float64
-	switch v := target.(type) {
-	case float64:
-		numValue = v
-	case int:
-		numValue = float64(v)
-	default:
-		return models.Value{Type: "error", Str: "ERR path does not point to a number"}
-	}
-
-	// Perform increment
-	newValue := numValue + incrBy
-
-	// Update the value at path
-	if err := h.setNestedValue(data, path, newValue); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
-
-	result, err := json.Marshal(newValue)
+	// A number a singular path selects is updated by splicing the stored
+	// document; anything else goes through the decoded document
+	var reply models.Value
+	spliced := false
+	err = h.cache.UpdateJSON(args[0].Bulk, func(stored *jsonUtil.Document) (*jsonUtil.Document, error) {
+		spliced = false
+		if stored == nil {
+			return stored, nil
+		}
+		n, found := stored.Lookup(path)
+		if !found || n.Kind() != jsonUtil.KindNumber {
+			return stored, nil
+		}
+		spliced = true
+		updated, r := spliceJSONNumber(stored, path, op(n.Float(), operand))
+		reply = r
+		return updated, nil
+	})
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
+		return util.ToValue(err)
 	}
-
-	return models.Value{Type: "bulk", Bulk: string(result)}
-}
-
-func (h *JSONHandlers) HandleJSONObjKeys(args []models.Value) models.Value {
-	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.OBJKEYS command"}
+	if spliced {
+		return reply
 	}
 
-	key := args[0].Bulk
-	path := "."
-	if len(args) > 1 {
-		path = args[1].Bulk
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
+		}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
-	}
+		modified := false
+		reply := d.eachJSON(func(m *jsonUtil.Match) (interface{}, error) {
+			numValue, ok := toFloat(m.Value)
+			if !ok {
+				return nil, fmt.Errorf("ERR path does not point to a number")
+			}
+			newValue := op(numValue, operand)
+			m.Replace(newValue)
+			modified = true
+			return newValue, nil
+		})
 
-	// Get object at path
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var err error
-		target, err = h.getNestedValue(value, path)
-		if err != nil {
-			return models.Value{Type: "error", Str: err.Error()}
-		}
-	}
+		return modified, reply
+	})
+}
 
-	obj, ok := target.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an object"}
+// spliceJSONNumber returns doc with value stored at the number a singular
+// path selects, and the reply for it. A value that cannot be stored leaves
+// doc as it is and replies with an error.
+func spliceJSONNumber(doc *jsonUtil.Document, path *jsonUtil.Path, value float64) (*jsonUtil.Document, models.Value) {
+	encoded, err := jsonUtil.EncodeDocument(value)
+	if err != nil {
+		return doc, models.Value{Type: "error", Str: "ERR result is not a finite number"}
 	}
+	updated, _ := doc.Replace(path, encoded)
 
-	// Get all keys
-	keys := make([]string, 0, len(obj))
-	for k := range obj {
-		keys = append(keys, k)
+	reply := encoded.AppendJSON(nil)
+	if !path.IsLegacy() {
+		reply = append(append([]byte{'['}, reply...), ']')
 	}
+	return updated, models.Value{Type: "bulk", Bulk: string(reply)}
+}
 
-	// Sort keys for consistent output
-	sort.Strings(keys)
-
-	// Convert keys to JSON array
-	result, err := json.Marshal(keys)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode keys"}
-	}
+func (h *JSONHandlers) HandleJSONNumIncrBy(args []models.Value) models.Value {
+	return h.handleJSONNumOp(args, "JSON.NUMINCRBY", "ERR increment amount must be a valid number",
+		func(a, b float64) float64 { return a + b })
+}
 
-	return models.Value{Type: "bulk", Bulk: string(result)}
+func (h *JSONHandlers) HandleJSONNumMultBy(args []models.Value) models.Value {
+	return h.handleJSONNumOp(args, "JSON.NUMMULTBY", "ERR multiplier must be a valid number",
+		func(a, b float64) float64 { return a * b })
 }
 
-func (h *JSONHandlers) HandleJSONObjLen(args []models.Value) models.Value {
+// HandleJSONObjKeys replies with the sorted keys of the selected object,
+// encoded as a JSON array for legacy paths and as one array of keys per
+// match for $ paths.
+func (h *JSONHandlers) HandleJSONObjKeys(args []models.Value) models.Value {
 	if len(args) < 1 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.OBJLEN command"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.OBJKEYS command"}
 	}
 
-	key := args[0].Bulk
-	path := "."
+	expr := "."
 	if len(args) > 1 {
-		path = args[1].Bulk
+		expr = args[1].Bulk
 	}
 
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
+	d, err := h.load(args[0].Bulk, expr)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	if d == nil {
 		return models.Value{Type: "null"}
 	}
 
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var err error
-		target, err = h.getNestedValue(value, path)
-		if err != nil {
-			return models.Value{Type: "error", Str: err.Error()}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		obj, ok := m.Value.(map[string]interface{})
+		if !ok {
+			return models.Value{Type: "error", Str: "ERR path does not point to an object"}
 		}
-	}
 
-	obj, ok := target.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an object"}
-	}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
 
-	return models.Value{Type: "integer", Num: len(obj)}
+		if !d.path.IsLegacy() {
+			return stringsToArray(keys)
+		}
+		result, err := json.Marshal(keys)
+		if err != nil {
+			return models.Value{Type: "error", Str: "ERR failed to encode keys"}
+		}
+		return models.Value{Type: "bulk", Bulk: string(result)}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONArrPop(args []models.Value) models.Value {
@@ -838,8 +839,6 @@ func (h *JSONHandlers) HandleJSONArrPop(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRPOP command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
 	index := -1 // default to last element
 	if len(args) > 2 {
 		var err error
@@ -849,307 +848,235 @@ func (h *JSONHandlers) HandleJSONArrPop(args []models.Value) models.Value {
 		}
 	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "null"}
+		}
 
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			arr, ok := m.Value.([]interface{})
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+			}
+			if len(arr) == 0 {
+				return models.Value{Type: "null"}
+			}
 
-	if len(arr) == 0 {
-		return models.Value{Type: "null"}
-	}
+			i := index
+			if i < 0 {
+				i = len(arr) + i
+			}
+			if i < 0 || i >= len(arr) {
+				return models.Value{Type: "error", Str: "ERR index out of range"}
+			}
 
-	// Handle negative index
-	if index < 0 {
-		index = len(arr) + index
-	}
+			popped := arr[i]
+			updated := make([]interface{}, 0, len(arr)-1)
+			updated = append(updated, arr[:i]...)
+			updated = append(updated, arr[i+1:]...)
+			m.Replace(updated)
+			modified = true
 
-	// Check bounds
-	if index < 0 || index >= len(arr) {
-		return models.Value{Type: "error", Str: "ERR index out of range"}
-	}
+			result, err := json.Marshal(popped)
+			if err != nil {
+				return models.Value{Type: "error", Str: "ERR failed to encode popped value"}
+			}
+			return models.Value{Type: "bulk", Bulk: string(result)}
+		})
 
-	// Get the element to return
-	popped := arr[index]
+		return modified, reply
+	})
+}
 
-	// Remove the element
-	arr = append(arr[:index], arr[index+1:]...)
+// HandleJSONMerge implements JSON.MERGE key path value, applying value as
+// an RFC 7396 merge patch to every node the path selects: objects are merged
+// member by member, null members are deleted and other values replace the
+// node. A null value deletes the selected nodes. When nothing is selected
+// the patched value is added as JSON.SET would, and a missing key can be
+// created at the root.
+func (h *JSONHandlers) HandleJSONMerge(args []models.Value) models.Value {
+	if len(args) != 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.MERGE command"}
+	}
 
-	// Update the array
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
+	var patch interface{}
+	if err := json.Unmarshal([]byte(args[2].Bulk), &patch); err != nil {
+		return models.Value{Type: "error", Str: "ERR invalid JSON string"}
 	}
 
-	if err := h.setNestedValue(data, path, arr); err != nil {
+	key := args[0].Bulk
+	path, err := compileJSONPath(args[1].Bulk)
+	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
+	err = h.cache.UpdateJSON(key, func(stored *jsonUtil.Document) (*jsonUtil.Document, error) {
+		if stored == nil {
+			if !path.IsRoot() {
+				return nil, fmt.Errorf("ERR new objects must be created at the root")
+			}
+			if patch == nil {
+				return nil, nil
+			}
+			return encodeJSONDoc(h.merge.MergePatchValue(nil, patch))
+		}
+
+		value := stored.Decode()
+		targets := path.Find(&value)
+		if path.IsLegacy() && len(targets) > 1 {
+			targets = targets[:1]
+		}
+		switch {
+		case len(targets) == 0:
+			if patch == nil {
+				return stored, nil
+			}
+			if path.Set(&value, h.merge.MergePatchValue(nil, patch)) == 0 {
+				return nil, fmt.Errorf("ERR path does not exist")
+			}
+		case patch == nil:
+			if path.IsRoot() {
+				return nil, nil
+			}
+			jsonUtil.SortForDelete(targets)
+			for _, m := range targets {
+				m.Delete()
+			}
+		default:
+			for i, m := range targets {
+				target := patch
+				if i > 0 {
+					target = jsonUtil.Clone(patch)
+				}
+				m.Replace(h.merge.MergePatchValue(m.Value, target))
+			}
+		}
+		return encodeJSONDoc(value)
+	})
+	if err != nil {
 		return util.ToValue(err)
 	}
+	return models.Value{Type: "string", Str: "OK"}
+}
+
+// HandleJSONPatch implements JSON.PATCH key patch, applying an RFC 6902
+// operation list to the document. The operations run against a copy, so
+// the document only changes if every one of them succeeds.
+func (h *JSONHandlers) HandleJSONPatch(args []models.Value) models.Value {
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.PATCH command"}
+	}
 
-	// Return the popped element
-	result, err := json.Marshal(popped)
+	ops, err := jsonUtil.DecodePatch([]byte(args[1].Bulk))
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode popped value"}
+		return models.Value{Type: "error", Str: "ERR " + err.Error()}
 	}
 
-	return models.Value{Type: "bulk", Bulk: string(result)}
+	err = h.cache.UpdateJSON(args[0].Bulk, func(stored *jsonUtil.Document) (*jsonUtil.Document, error) {
+		if stored == nil {
+			return nil, fmt.Errorf("ERR key does not exist")
+		}
+		result, err := jsonUtil.ApplyPatch(stored.Decode(), ops)
+		if err != nil {
+			return nil, fmt.Errorf("ERR %v", err)
+		}
+		return encodeJSONDoc(result)
+	})
+	if err != nil {
+		return util.ToValue(err)
+	}
+	return models.Value{Type: "string", Str: "OK"}
 }
 
-func (h *JSONHandlers) HandleJSONMerge(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.MERGE command"}
+func (h *JSONHandlers) HandleJSONArrInsert(args []models.Value) models.Value {
+	if len(args) < 4 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRINSERT command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	jsonStr := args[2].Bulk
-
-	// Parse the JSON to merge
-	var mergeValue interface{}
-	if err := json.Unmarshal([]byte(jsonStr), &mergeValue); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid JSON string"}
+	index, err := strconv.Atoi(args[2].Bulk)
+	if err != nil {
+		return models.Value{Type: "error", Str: "ERR invalid index"}
 	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get target object
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	targetObj, ok := target.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an object"}
-	}
-
-	mergeObj, ok := mergeValue.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR can only merge objects"}
-	}
-
-	// Perform deep merge
-	merged := h.merge.DeepMerge(targetObj, mergeObj)
-
-	// Update the object
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	if err := h.setNestedValue(data, path, merged); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
-
-	return models.Value{Type: "string", Str: "OK"}
-}
-
-func (h *JSONHandlers) HandleJSONArrInsert(args []models.Value) models.Value {
-	if len(args) < 4 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRINSERT command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-	indexStr := args[2].Bulk
-
-	index, err := strconv.Atoi(indexStr)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid index"}
-	}
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	newValues, err := parseJSONArgs(args[3:])
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Handle negative index
-	if index < 0 {
-		index = len(arr) + index
-	}
-
-	// Check bounds
-	if index < 0 || index > len(arr) {
-		return models.Value{Type: "error", Str: "ERR index out of range"}
-	}
-
-	// Parse and insert all values
-	newValues := make([]interface{}, 0, len(args)-3)
-	for i := 3; i < len(args); i++ {
-		var val interface{}
-		if err := json.Unmarshal([]byte(args[i].Bulk), &val); err != nil {
-			return models.Value{Type: "error", Str: "ERR invalid JSON value"}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
 		}
-		newValues = append(newValues, val)
-	}
-
-	// Insert values at index
-	newArr := make([]interface{}, 0, len(arr)+len(newValues))
-	newArr = append(newArr, arr[:index]...)
-	newArr = append(newArr, newValues...)
-	newArr = append(newArr, arr[index:]...)
-
-	// Update the array
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	if err := h.setNestedValue(data, path, newArr); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
-
-	return models.Value{Type: "integer", Num: len(newArr)}
-}
-
-func (h *JSONHandlers) HandleJSONNumMultBy(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.NUMMULTBY command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-	multiplier, err := strconv.ParseFloat(args[2].Bulk, 64)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR multiplier must be a valid number"}
-	}
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	// Get number at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	var numValue float64
-	switch v := target.(type) {
-	case float64:
-		numValue = v
-	case int:
-		numValue = float64(v)
-	default:
-		return models.Value{Type: "error", Str: "ERR path does not point to a number"}
-	}
 
-	// Perform multiplication
-	newValue := numValue * multiplier
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			arr, ok := m.Value.([]interface{})
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+			}
 
-	// Update the value at path
-	if err := h.setNestedValue(data, path, newValue); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
+			i := index
+			if i < 0 {
+				i = len(arr) + i
+			}
+			if i < 0 || i > len(arr) {
+				return models.Value{Type: "error", Str: "ERR index out of range"}
+			}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+			inserted := newValues
+			if modified {
+				inserted = jsonUtil.Clone(newValues).([]interface{})
+			}
+			newArr := make([]interface{}, 0, len(arr)+len(inserted))
+			newArr = append(newArr, arr[:i]...)
+			newArr = append(newArr, inserted...)
+			newArr = append(newArr, arr[i:]...)
 
-	result, err := json.Marshal(newValue)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
-	}
+			m.Replace(newArr)
+			modified = true
+			return models.Value{Type: "integer", Num: len(newArr)}
+		})
 
-	return models.Value{Type: "bulk", Bulk: string(result)}
+		return modified, reply
+	})
 }
 
+// HandleJSONClear empties containers and resets scalars at the selected
+// locations, replying with the number of values cleared.
 func (h *JSONHandlers) HandleJSONClear(args []models.Value) models.Value {
 	if len(args) < 2 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.CLEAR command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "integer", Num: 0}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	// Get value at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	var clearedValue interface{}
-	switch target.(type) {
-	case []interface{}:
-		clearedValue = make([]interface{}, 0)
-	case map[string]interface{}:
-		clearedValue = make(map[string]interface{})
-	case string:
-		clearedValue = ""
-	case float64, int:
-		clearedValue = 0
-	case bool:
-		clearedValue = false
-	default:
-		clearedValue = nil
-	}
-
-	// Update the value at path
-	if err := h.setNestedValue(data, path, clearedValue); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "integer", Num: 0}
+		}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+		cleared := 0
+		for _, m := range d.targets() {
+			var clearedValue interface{}
+			switch m.Value.(type) {
+			case []interface{}:
+				clearedValue = make([]interface{}, 0)
+			case map[string]interface{}:
+				clearedValue = make(map[string]interface{})
+			case string:
+				clearedValue = ""
+			case float64, int:
+				clearedValue = 0
+			case bool:
+				clearedValue = false
+			default:
+				clearedValue = nil
+			}
+			m.Replace(clearedValue)
+			cleared++
+		}
 
-	return models.Value{Type: "integer", Num: 1}
+		return cleared > 0, models.Value{Type: "integer", Num: cleared}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONCompare(args []models.Value) models.Value {
@@ -1157,48 +1084,35 @@ func (h *JSONHandlers) HandleJSONCompare(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.COMPARE command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
 	op := args[2].Bulk
-	compareValue := args[3].Bulk
+	if op != "eq" && op != "lt" && op != "gt" {
+		return models.Value{Type: "error", Str: "ERR invalid comparison operator"}
+	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
+	var compareObj interface{}
+	if err := json.Unmarshal([]byte(args[3].Bulk), &compareObj); err != nil {
+		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
 	}
 
-	// Get value at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	// Parse comparison value
-	var compareObj interface{}
-	if err := json.Unmarshal([]byte(compareValue), &compareObj); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
+	if d == nil {
+		return models.Value{Type: "null"}
 	}
 
-	result := 0
-	switch op {
-	case "eq":
-		if h.compare.Equal(target, compareObj) {
-			result = 1
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		if op == "eq" {
+			return models.Value{Type: "integer", Num: btoi(h.compare.Equal(m.Value, compareObj))}
 		}
-	case "lt", "gt":
-		comp, err := h.compare.Compare(target, compareObj)
+		comp, err := h.compare.Compare(m.Value, compareObj)
 		if err != nil {
 			return models.Value{Type: "error", Str: err.Error()}
 		}
-		if (op == "lt" && comp == jsonUtil.Less) || (op == "gt" && comp == jsonUtil.Greater) {
-			result = 1
-		}
-	default:
-		return models.Value{Type: "error", Str: "ERR invalid comparison operator"}
-	}
-
-	return models.Value{Type: "integer", Num: result}
+		matched := (op == "lt" && comp == jsonUtil.Less) || (op == "gt" && comp == jsonUtil.Greater)
+		return models.Value{Type: "integer", Num: btoi(matched)}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONStrAppend(args []models.Value) models.Value {
@@ -1206,341 +1120,205 @@ func (h *JSONHandlers) HandleJSONStrAppend(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.STRAPPEND command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	appendStr := args[2].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	// Get string at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	targetStr, ok := target.(string)
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to a string"}
-	}
-
-	// Append string
-	newStr := targetStr + appendStr
-
-	// Update the string at path
-	if err := h.setNestedValue(data, path, newStr); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
-
-	return models.Value{Type: "integer", Num: len(newStr)}
-}
-
-func (h *JSONHandlers) HandleJSONContains(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.CONTAINS command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-	searchValue := args[2].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "integer", Num: 0}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Parse search value
-	var searchItem interface{}
-	if err := json.Unmarshal([]byte(searchValue), &searchItem); err != nil {
+	// The value is JSON, so appending x takes '"x"'
+	var value interface{}
+	if err := json.Unmarshal([]byte(args[2].Bulk), &value); err != nil {
 		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
 	}
-
-	// Check if array contains the value
-	for _, item := range arr {
-		if h.compare.Equal(item, searchItem) {
-			return models.Value{Type: "integer", Num: 1}
-		}
-	}
-
-	return models.Value{Type: "integer", Num: 0}
-}
-
-func (h *JSONHandlers) HandleJSONArrReverse(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRREVERSE command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	arr, ok := target.([]interface{})
+	appendStr, ok := value.(string)
 	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Reverse the array
-	for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
-		arr[i], arr[j] = arr[j], arr[i]
-	}
-
-	// Update the array at path
-	if err := h.setNestedValue(data, path, arr); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+		return models.Value{Type: "error", Str: "ERR value is not a JSON string"}
 	}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
-
-	return models.Value{Type: "integer", Num: len(arr)}
-}
-
-func (h *JSONHandlers) HandleJSONArrSort(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRSORT command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-	sortOrder := "ASC"
-	if len(args) > 2 {
-		sortOrder = strings.ToUpper(args[2].Bulk)
-	}
-
-	if sortOrder != "ASC" && sortOrder != "DESC" {
-		return models.Value{Type: "error", Str: "ERR sort order must be ASC or DESC"}
-	}
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	// Sort the array
-	sort.Slice(arr, func(i, j int) bool {
-		comp, err := h.compare.Compare(arr[i], arr[j])
-		if err != nil {
-			return false
-		}
-		if sortOrder == "ASC" {
-			return comp == jsonUtil.Less
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
 		}
-		return comp == jsonUtil.Greater
-	})
-
-	// Update the array at path
-	if err := h.setNestedValue(data, path, arr); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
 
-	return models.Value{Type: "integer", Num: len(arr)}
-}
-
-func (h *JSONHandlers) HandleJSONArrUnique(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRUNIQUE command"}
-	}
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			targetStr, ok := m.Value.(string)
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to a string"}
+			}
+			newStr := targetStr + appendStr
+			m.Replace(newStr)
+			modified = true
+			return models.Value{Type: "integer", Num: len(newStr)}
+		})
 
-	key := args[0].Bulk
-	path := args[1].Bulk
+		return modified, reply
+	})
+}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
+// handleJSONArrCount counts the elements of each selected array that equal
+// the JSON value in args[2].
+func (h *JSONHandlers) handleJSONArrCount(args []models.Value, command string, stopAtFirst bool) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for " + command + " command"}
 	}
 
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
+	var searchItem interface{}
+	if err := json.Unmarshal([]byte(args[2].Bulk), &searchItem); err != nil {
+		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
 	}
 
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+	if d == nil {
+		return models.Value{Type: "integer", Num: 0}
 	}
 
-	// Create unique array using map
-	seen := make(map[string]bool)
-	unique := make([]interface{}, 0)
-
-	for _, item := range arr {
-		jsonStr, err := json.Marshal(item)
-		if err != nil {
-			return models.Value{Type: "error", Str: "ERR failed to process array item"}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		arr, ok := m.Value.([]interface{})
+		if !ok {
+			return models.Value{Type: "error", Str: "ERR path does not point to an array"}
 		}
-
-		if !seen[string(jsonStr)] {
-			seen[string(jsonStr)] = true
-			unique = append(unique, item)
+		count := 0
+		for _, item := range arr {
+			if h.compare.Equal(item, searchItem) {
+				count++
+				if stopAtFirst {
+					break
+				}
+			}
 		}
-	}
-
-	// Update the array at path
-	if err := h.setNestedValue(data, path, unique); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+		return models.Value{Type: "integer", Num: count}
+	})
+}
 
-	return models.Value{Type: "integer", Num: len(unique)}
+func (h *JSONHandlers) HandleJSONContains(args []models.Value) models.Value {
+	return h.handleJSONArrCount(args, "JSON.CONTAINS", true)
 }
 
 func (h *JSONHandlers) HandleJSONCount(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.COUNT command"}
-	}
+	return h.handleJSONArrCount(args, "JSON.COUNT", false)
+}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
-	searchValue := args[2].Bulk
+// handleJSONArrRewrite replaces every selected array with rewrite's result
+// and replies with the new length.
+func (h *JSONHandlers) handleJSONArrRewrite(key, expr string, rewrite func(arr []interface{}) ([]interface{}, error)) models.Value {
+	return h.update(key, expr, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
+		}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "integer", Num: 0}
-	}
+		modified := false
+		reply := d.each(func(m *jsonUtil.Match) models.Value {
+			arr, ok := m.Value.([]interface{})
+			if !ok {
+				return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+			}
+			arr, err := rewrite(arr)
+			if err != nil {
+				return models.Value{Type: "error", Str: err.Error()}
+			}
+			m.Replace(arr)
+			modified = true
+			return models.Value{Type: "integer", Num: len(arr)}
+		})
 
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+		return modified, reply
+	})
+}
+
+func (h *JSONHandlers) HandleJSONArrReverse(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRREVERSE command"}
 	}
 
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+	return h.handleJSONArrRewrite(args[0].Bulk, args[1].Bulk, func(arr []interface{}) ([]interface{}, error) {
+		for i, j := 0, len(arr)-1; i < j; i, j = i+1, j-1 {
+			arr[i], arr[j] = arr[j], arr[i]
+		}
+		return arr, nil
+	})
+}
+
+func (h *JSONHandlers) HandleJSONArrSort(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRSORT command"}
 	}
 
-	// Parse search value
-	var searchItem interface{}
-	if err := json.Unmarshal([]byte(searchValue), &searchItem); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid JSON value"}
+	sortOrder := "ASC"
+	if len(args) > 2 {
+		sortOrder = strings.ToUpper(args[2].Bulk)
 	}
 
-	// Count occurrences
-	count := 0
-	for _, item := range arr {
-		if h.compare.Equal(item, searchItem) {
-			count++
-		}
+	if sortOrder != "ASC" && sortOrder != "DESC" {
+		return models.Value{Type: "error", Str: "ERR sort order must be ASC or DESC"}
 	}
 
-	return models.Value{Type: "integer", Num: count}
+	return h.handleJSONArrRewrite(args[0].Bulk, args[1].Bulk, func(arr []interface{}) ([]interface{}, error) {
+		sort.Slice(arr, func(i, j int) bool {
+			comp, err := h.compare.Compare(arr[i], arr[j])
+			if err != nil {
+				return false
+			}
+			if sortOrder == "ASC" {
+				return comp == jsonUtil.Less
+			}
+			return comp == jsonUtil.Greater
+		})
+		return arr, nil
+	})
 }
 
-func (h *JSONHandlers) HandleJSONSwap(args []models.Value) models.Value {
-	if len(args) < 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SWAP command"}
+func (h *JSONHandlers) HandleJSONArrUnique(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRUNIQUE command"}
 	}
 
-	key := args[0].Bulk
-	path1 := args[1].Bulk
-	path2 := args[2].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
+	return h.handleJSONArrRewrite(args[0].Bulk, args[1].Bulk, func(arr []interface{}) ([]interface{}, error) {
+		seen := make(map[string]bool)
+		unique := make([]interface{}, 0)
 
-	data, ok := value.(map[string]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR root must be an object"}
-	}
+		for _, item := range arr {
+			jsonStr, err := json.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("ERR failed to process array item")
+			}
 
-	// Get values at both paths
-	value1, err1 := h.getNestedValue(value, path1)
-	value2, err2 := h.getNestedValue(value, path2)
+			if !seen[string(jsonStr)] {
+				seen[string(jsonStr)] = true
+				unique = append(unique, item)
+			}
+		}
+		return unique, nil
+	})
+}
 
-	if err1 != nil || err2 != nil {
-		return models.Value{Type: "error", Str: "ERR invalid path"}
+// HandleJSONSwap exchanges the values at two paths. Each path must select
+// at least one node; only the first match of each is used.
+func (h *JSONHandlers) HandleJSONSwap(args []models.Value) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SWAP command"}
 	}
 
-	// Swap values
-	if err := h.setNestedValue(data, path1, value2); err != nil {
+	path2, err := compileJSONPath(args[2].Bulk)
+	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	if err := h.setNestedValue(data, path2, value1); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
+	return h.update(args[0].Bulk, args[1].Bulk, func(d *jsonDoc) (bool, models.Value) {
+		if d == nil {
+			return false, models.Value{Type: "error", Str: "ERR key does not exist"}
+		}
 
-	if err := h.cache.SetJSON(key, data); err != nil {
-		return util.ToValue(err)
-	}
+		matches2 := path2.Find(&d.value)
+		if len(d.matches) == 0 || len(matches2) == 0 || d.matches[0].IsRoot() || matches2[0].IsRoot() {
+			return false, models.Value{Type: "error", Str: "ERR invalid path"}
+		}
 
-	return models.Value{Type: "string", Str: "OK"}
+		m1, m2 := d.matches[0], matches2[0]
+		value1, value2 := m1.Value, m2.Value
+		m1.Replace(value2)
+		m2.Replace(value1)
+
+		return true, models.Value{Type: "string", Str: "OK"}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONValidate(args []models.Value) models.Value {
@@ -1558,114 +1336,109 @@ func (h *JSONHandlers) HandleJSONValidate(args []models.Value) models.Value {
 	}
 
 	// Parse schema
-	var schema jsonUtil.Schema
-	if err := json.Unmarshal([]byte(schemaStr), &schema); err != nil {
-		return models.Value{Type: "error", Str: "ERR invalid schema"}
+	schema, err := jsonUtil.CompileSchema([]byte(schemaStr))
+	if err != nil {
+		return models.Value{Type: "error", Str: "ERR " + err.Error()}
 	}
 
 	// Validate against schema
-	if err := h.validationUtil.Validate(value, &schema); err != nil {
+	if err := h.validationUtil.Validate(value, schema); err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
 	return models.Value{Type: "integer", Num: 1}
 }
 
-func (h *JSONHandlers) HandleJSONArrSum(args []models.Value) models.Value {
-	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRSUM command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
-	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
-	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
+// HandleJSONSchema manages the schemas enforced on JSON keys:
+//
+//	JSON.SCHEMA SET pattern schema | GET pattern | DEL pattern | LIST
+//
+// Writes to keys matching a pattern that would leave the document invalid
+// are rejected with the path of the first violation.
+func (h *JSONHandlers) HandleJSONSchema(args []models.Value) models.Value {
+	if len(args) < 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SCHEMA command"}
 	}
 
-	// Calculate sum
-	var sum float64
-	for _, item := range arr {
-		switch v := item.(type) {
-		case float64:
-			sum += v
-		case int:
-			sum += float64(v)
-		default:
-			return models.Value{Type: "error", Str: "ERR array contains non-numeric values"}
+	sub := strings.ToUpper(args[0].Bulk)
+	switch {
+	case sub == "SET" && len(args) == 3:
+		schema, err := jsonUtil.CompileSchema([]byte(args[2].Bulk))
+		if err != nil {
+			return models.Value{Type: "error", Str: "ERR " + err.Error()}
 		}
-	}
-
-	result, err := json.Marshal(sum)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
-	}
-
-	return models.Value{Type: "bulk", Bulk: string(result)}
+		if err := h.cache.JSONSchemaSet(args[1].Bulk, schema); err != nil {
+			return util.ToValue(err)
+		}
+		return models.Value{Type: "string", Str: "OK"}
+	case sub == "GET" && len(args) == 2:
+		schema, ok := h.cache.JSONSchemaGet(args[1].Bulk)
+		if !ok {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "bulk", Bulk: schema.Source()}
+	case sub == "DEL" && len(args) == 2:
+		return models.Value{Type: "integer", Num: btoi(h.cache.JSONSchemaDel(args[1].Bulk))}
+	case sub == "LIST" && len(args) == 1:
+		return util.ToValue(h.cache.JSONSchemaList())
+	case sub == "SET" || sub == "GET" || sub == "DEL" || sub == "LIST":
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SCHEMA " + sub + " command"}
+	}
+	return models.Value{Type: "error", Str: "ERR unknown subcommand '" + args[0].Bulk + "'"}
 }
 
-func (h *JSONHandlers) HandleJSONArrAvg(args []models.Value) models.Value {
+// handleJSONArrStat computes stat over each selected numeric array.
+func (h *JSONHandlers) handleJSONArrStat(args []models.Value, command string, stat func(nums []float64) (float64, error)) models.Value {
 	if len(args) < 2 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.ARRAVG command"}
-	}
-
-	key := args[0].Bulk
-	path := args[1].Bulk
-
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for " + command + " command"}
 	}
 
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	if len(arr) == 0 {
-		return models.Value{Type: "error", Str: "ERR array is empty"}
+	if d == nil {
+		return models.Value{Type: "error", Str: "ERR key does not exist"}
 	}
 
-	// Calculate average
-	var sum float64
-	for _, item := range arr {
-		switch v := item.(type) {
-		case float64:
-			sum += v
-		case int:
-			sum += float64(v)
-		default:
-			return models.Value{Type: "error", Str: "ERR array contains non-numeric values"}
+	return d.eachJSON(func(m *jsonUtil.Match) (interface{}, error) {
+		arr, ok := m.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("ERR path does not point to an array")
 		}
-	}
+		nums := make([]float64, len(arr))
+		for i, item := range arr {
+			n, ok := toFloat(item)
+			if !ok {
+				return nil, fmt.Errorf("ERR array contains non-numeric values")
+			}
+			nums[i] = n
+		}
+		return stat(nums)
+	})
+}
 
-	avg := sum / float64(len(arr))
-	result, err := json.Marshal(avg)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
-	}
+func (h *JSONHandlers) HandleJSONArrSum(args []models.Value) models.Value {
+	return h.handleJSONArrStat(args, "JSON.ARRSUM", func(nums []float64) (float64, error) {
+		var sum float64
+		for _, n := range nums {
+			sum += n
+		}
+		return sum, nil
+	})
+}
 
-	return models.Value{Type: "bulk", Bulk: string(result)}
+func (h *JSONHandlers) HandleJSONArrAvg(args []models.Value) models.Value {
+	return h.handleJSONArrStat(args, "JSON.ARRAVG", func(nums []float64) (float64, error) {
+		if len(nums) == 0 {
+			return 0, fmt.Errorf("ERR array is empty")
+		}
+		var sum float64
+		for _, n := range nums {
+			sum += n
+		}
+		return sum / float64(len(nums)), nil
+	})
 }
 
 func (h *JSONHandlers) HandleJSONSearch(args []models.Value) models.Value {
@@ -1673,8 +1446,6 @@ func (h *JSONHandlers) HandleJSONSearch(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.SEARCH command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
 	keyword := args[2].Bulk
 	caseSensitive := false
 
@@ -1682,44 +1453,31 @@ func (h *JSONHandlers) HandleJSONSearch(args []models.Value) models.Value {
 		caseSensitive = true
 	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get target value
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	// Assert target to string
-	jsonStr, ok := target.(string)
-	if !ok {
-		// If not string, try marshaling the target value to JSON
-		bytes, err := json.Marshal(target)
-		if err != nil {
-			return models.Value{Type: "error", Str: "ERR failed to process target JSON"}
-		}
-		jsonStr = string(bytes)
+	if d == nil {
+		return models.Value{Type: "error", Str: "ERR key does not exist"}
 	}
 
-	// Search in value
 	opts := &jsonUtil.SearchOptions{
 		CaseSensitive: caseSensitive,
 		IncludeKeys:   true,
 		IncludeValues: true,
 	}
-	paths := h.searchUtil.Search(jsonStr, keyword, opts)
-
-	// Convert result to JSON array
-	result, err := json.Marshal(paths)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
-	}
 
-	return models.Value{Type: "bulk", Bulk: string(result)}
+	return d.eachJSON(func(m *jsonUtil.Match) (interface{}, error) {
+		// A string target is searched as JSON text
+		if jsonStr, ok := m.Value.(string); ok {
+			return h.searchUtil.Search(jsonStr, keyword, opts), nil
+		}
+		doc, err := jsonUtil.EncodeDocument(m.Value)
+		if err != nil {
+			return nil, fmt.Errorf("ERR failed to process target JSON")
+		}
+		return h.searchUtil.SearchNode(doc.Root(), keyword, opts), nil
+	})
 }
 
 func (h *JSONHandlers) HandleJSONMinMax(args []models.Value) models.Value {
@@ -1727,54 +1485,40 @@ func (h *JSONHandlers) HandleJSONMinMax(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.MINMAX command"}
 	}
 
-	key := args[0].Bulk
-	path := args[1].Bulk
 	op := strings.ToUpper(args[2].Bulk)
-
 	if op != "MIN" && op != "MAX" {
 		return models.Value{Type: "error", Str: "ERR operation must be MIN or MAX"}
 	}
 
-	// Get existing JSON
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "error", Str: "ERR key does not exist"}
-	}
-
-	// Get array at path
-	target, err := h.getNestedValue(value, path)
+	d, err := h.load(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	arr, ok := target.([]interface{})
-	if !ok {
-		return models.Value{Type: "error", Str: "ERR path does not point to an array"}
-	}
-
-	if len(arr) == 0 {
-		return models.Value{Type: "error", Str: "ERR array is empty"}
+	if d == nil {
+		return models.Value{Type: "error", Str: "ERR key does not exist"}
 	}
 
-	// Find min/max value
-	var result interface{} = arr[0]
-	for _, item := range arr[1:] {
-		comp, err := h.compare.Compare(item, result)
-		if err != nil {
-			continue
+	return d.eachJSON(func(m *jsonUtil.Match) (interface{}, error) {
+		arr, ok := m.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("ERR path does not point to an array")
 		}
-		if (op == "MIN" && comp == jsonUtil.Less) || (op == "MAX" && comp == jsonUtil.Greater) {
-			result = item
+		if len(arr) == 0 {
+			return nil, fmt.Errorf("ERR array is empty")
 		}
-	}
-
-	// Convert result to JSON
-	resultJSON, err := json.Marshal(result)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to encode result"}
-	}
 
-	return models.Value{Type: "bulk", Bulk: string(resultJSON)}
+		result := arr[0]
+		for _, item := range arr[1:] {
+			comp, err := h.compare.Compare(item, result)
+			if err != nil {
+				continue
+			}
+			if (op == "MIN" && comp == jsonUtil.Less) || (op == "MAX" && comp == jsonUtil.Greater) {
+				result = item
+			}
+		}
+		return result, nil
+	})
 }
 
 func (h *JSONHandlers) HandleJSONDebug(args []models.Value) models.Value {
@@ -1795,19 +1539,34 @@ func (h *JSONHandlers) HandleJSONDebug(args []models.Value) models.Value {
 }
 
 func (h *JSONHandlers) handleJSONDebugMemory(args []models.Value) models.Value {
-	key := args[0].Bulk
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "integer", Num: 0}
+	expr := "."
+	if len(args) > 1 {
+		expr = args[1].Bulk
 	}
 
-	// Estimate memory size by marshaling to JSON
-	data, err := json.Marshal(value)
+	d, err := h.load(args[0].Bulk, expr)
 	if err != nil {
-		return models.Value{Type: "error", Str: "ERR failed to calculate memory size"}
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	if d == nil {
+		return models.Value{Type: "integer", Num: 0}
 	}
 
-	return models.Value{Type: "integer", Num: len(data)}
+	// Report the size the value takes in the stored document
+	if doc, exists := h.cache.GetJSONDocument(d.key); exists && d.path.IsSingular() {
+		if n, found := doc.Lookup(d.path); found {
+			return d.each(func(*jsonUtil.Match) models.Value {
+				return models.Value{Type: "integer", Num: n.Size()}
+			})
+		}
+	}
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		doc, err := jsonUtil.EncodeDocument(m.Value)
+		if err != nil {
+			return models.Value{Type: "error", Str: "ERR failed to calculate memory size"}
+		}
+		return models.Value{Type: "integer", Num: doc.Root().Size()}
+	})
 }
 
 func (h *JSONHandlers) HandleJSONForget(args []models.Value) models.Value {
@@ -1820,7 +1579,10 @@ func (h *JSONHandlers) HandleJSONMGet(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.MGET command"}
 	}
 
-	path := args[len(args)-1].Bulk
+	path, err := compileJSONPath(args[len(args)-1].Bulk)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
 	keys := args[:len(args)-1]
 
 	results := make([]interface{}, 0, len(keys))
@@ -1832,17 +1594,18 @@ func (h *JSONHandlers) HandleJSONMGet(args []models.Value) models.Value {
 			continue
 		}
 
-		if path == "." {
-			results = append(results, value)
-			continue
-		}
-
-		target, err := h.getNestedValue(value, path)
-		if err != nil {
+		values := path.Query(value)
+		switch {
+		case !path.IsLegacy():
+			if values == nil {
+				values = []interface{}{}
+			}
+			results = append(results, values)
+		case len(values) == 0:
 			results = append(results, nil)
-			continue
+		default:
+			results = append(results, values[0])
 		}
-		results = append(results, target)
 	}
 
 	resultJSON, err := json.Marshal(results)
@@ -1858,16 +1621,23 @@ func (h *JSONHandlers) HandleJSONMSet(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.MSET command"}
 	}
 
+	// Parse and check every document before storing any of them
+	docs := make([]*jsonUtil.Document, len(args)/2)
 	for i := 0; i < len(args); i += 2 {
-		key := args[i].Bulk
-		jsonStr := args[i+1].Bulk
-
-		var value interface{}
-		if err := json.Unmarshal([]byte(jsonStr), &value); err != nil {
+		doc, err := jsonUtil.ParseDocument([]byte(args[i+1].Bulk))
+		if err != nil {
 			return models.Value{Type: "error", Str: "ERR invalid JSON string"}
 		}
+		if h.cache.JSONSchemaCovers(args[i].Bulk) {
+			if err := h.cache.JSONSchemaCheck(args[i].Bulk, doc.Decode()); err != nil {
+				return util.ToValue(err)
+			}
+		}
+		docs[i/2] = doc
+	}
 
-		if err := h.cache.SetJSON(key, value); err != nil {
+	for i := 0; i < len(args); i += 2 {
+		if err := h.cache.SetJSONDocument(args[i].Bulk, docs[i/2]); err != nil {
 			return util.ToValue(err)
 		}
 	}
@@ -1880,28 +1650,21 @@ func (h *JSONHandlers) HandleJSONResp(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for JSON.RESP command"}
 	}
 
-	key := args[0].Bulk
-	path := "."
+	expr := "."
 	if len(args) > 1 {
-		path = args[1].Bulk
+		expr = args[1].Bulk
 	}
 
-	value, exists := h.cache.GetJSON(key)
-	if !exists {
-		return models.Value{Type: "null"}
+	d, err := h.load(args[0].Bulk, expr)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	var target interface{}
-	if path == "." {
-		target = value
-	} else {
-		var err error
-		target, err = h.getNestedValue(value, path)
-		if err != nil {
-			return models.Value{Type: "error", Str: err.Error()}
-		}
+	if d == nil {
+		return models.Value{Type: "null"}
 	}
 
 	// Convert to RESP format
-	return h.respUtil.JSONToRESP(target)
+	return d.each(func(m *jsonUtil.Match) models.Value {
+		return h.respUtil.JSONToRESP(m.Value)
+	})
 }
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+)
+
+type LatencyHandlers struct {
+	monitor *metrics.LatencyMonitor
+}
+
+func NewLatencyHandlers(monitor *metrics.LatencyMonitor) *LatencyHandlers {
+	return &LatencyHandlers{
+		monitor: monitor,
+	}
+}
+
+// HandleLatency handles LATENCY LATEST | HISTORY event | RESET [event ...] | DOCTOR
+func (h *LatencyHandlers) HandleLatency(args []models.Value) models.Value {
+	if len(args) == 0 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'latency' command"}
+	}
+
+	subCmd := strings.ToUpper(args[0].Bulk)
+	switch subCmd {
+	case "LATEST":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'latency|latest' command"}
+		}
+		return h.handleLatencyLatest()
+	case "HISTORY":
+		if len(args) != 2 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'latency|history' command"}
+		}
+		return h.handleLatencyHistory(args[1].Bulk)
+	case "RESET":
+		events := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			events = append(events, arg.Bulk)
+		}
+		return models.Value{Type: "integer", Num: h.monitor.Reset(events...)}
+	case "DOCTOR":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'latency|doctor' command"}
+		}
+		return models.Value{Type: "bulk", Bulk: h.monitor.Doctor()}
+	case "HELP":
+		return stringsToArray([]string{
+			"LATENCY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"DOCTOR",
+			"    Return a human readable latency analysis report.",
+			"HISTORY <event>",
+			"    Return time-latency samples for the <event> class.",
+			"LATEST",
+			"    Return the latest latency samples for all events.",
+			"RESET [<event> ...]",
+			"    Reset latency data of one or more <event> classes.",
+			"    (default: reset all data for all event classes)",
+		})
+	default:
+		return models.Value{Type: "error", Str: "ERR unknown subcommand '" + args[0].Bulk + "'. Try LATENCY HELP."}
+	}
+}
+
+func (h *LatencyHandlers) handleLatencyLatest() models.Value {
+	latest := h.monitor.Latest()
+
+	result := make([]models.Value, 0, len(latest))
+	for _, stat := range latest {
+		result = append(result, models.Value{
+			Type: "array",
+			Array: []models.Value{
+				{Type: "bulk", Bulk: stat.Event},
+				{Type: "integer", Num: int(stat.Timestamp.Unix())},
+				{Type: "integer", Num: int(stat.Latest.Milliseconds())},
+				{Type: "integer", Num: int(stat.Max.Milliseconds())},
+			},
+		})
+	}
+
+	return models.Value{Type: "array", Array: result}
+}
+
+func (h *LatencyHandlers) handleLatencyHistory(event string) models.Value {
+	history := h.monitor.History(event)
+
+	result := make([]models.Value, 0, len(history))
+	for _, sample := range history {
+		result = append(result, models.Value{
+			Type: "array",
+			Array: []models.Value{
+				{Type: "integer", Num: int(sample.Timestamp.Unix())},
+				{Type: "integer", Num: int(sample.Latency.Milliseconds())},
+			},
+		})
+	}
+
+	return models.Value{Type: "array", Array: result}
+}
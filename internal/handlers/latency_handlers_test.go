@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func latency(h *LatencyHandlers, args ...string) models.Value {
+	values := make([]models.Value, len(args))
+	for i, arg := range args {
+		values[i] = models.Value{Type: "bulk", Bulk: arg}
+	}
+	return h.HandleLatency(values)
+}
+
+func TestLatencyHandlers(t *testing.T) {
+	t.Run("Test Latest And History", func(t *testing.T) {
+		monitor := metrics.NewLatencyMonitor(5)
+		h := NewLatencyHandlers(monitor)
+		assert.Empty(t, latency(h, "LATEST").Array)
+
+		monitor.Observe(metrics.LatencyEventExpireCycle, 7*time.Millisecond)
+		monitor.Observe(metrics.LatencyEventCommand, 30*time.Millisecond)
+		monitor.Observe(metrics.LatencyEventCommand, 2*time.Millisecond)
+
+		latest := latency(h, "latest")
+		require.Equal(t, "array", latest.Type)
+		require.Len(t, latest.Array, 2)
+		command := latest.Array[0].Array
+		require.Len(t, command, 4)
+		assert.Equal(t, "command", command[0].Bulk)
+		assert.InDelta(t, time.Now().Unix(), command[1].Num, 2)
+		assert.Equal(t, 30, command[2].Num)
+		assert.Equal(t, 30, command[3].Num)
+		assert.Equal(t, "expire-cycle", latest.Array[1].Array[0].Bulk)
+
+		history := latency(h, "HISTORY", "command")
+		require.Len(t, history.Array, 1)
+		require.Len(t, history.Array[0].Array, 2)
+		assert.Equal(t, 30, history.Array[0].Array[1].Num)
+		assert.Empty(t, latency(h, "HISTORY", "aof-fsync").Array)
+	})
+
+	t.Run("Test Reset", func(t *testing.T) {
+		monitor := metrics.NewLatencyMonitor(1)
+		h := NewLatencyHandlers(monitor)
+		monitor.Observe(metrics.LatencyEventCommand, 5*time.Millisecond)
+		monitor.Observe(metrics.LatencyEventDefrag, 5*time.Millisecond)
+		monitor.Observe(metrics.LatencyEventEviction, 5*time.Millisecond)
+
+		assert.Equal(t, 1, latency(h, "RESET", "command", "unknown").Num)
+		assert.Len(t, latency(h, "LATEST").Array, 2)
+		assert.Equal(t, 2, latency(h, "RESET").Num)
+		assert.Empty(t, latency(h, "LATEST").Array)
+	})
+
+	t.Run("Test Doctor", func(t *testing.T) {
+		monitor := metrics.NewLatencyMonitor(5)
+		h := NewLatencyHandlers(monitor)
+		assert.Contains(t, latency(h, "DOCTOR").Bulk, "No latency spikes above 5ms")
+
+		monitor.Observe(metrics.LatencyEventCommand, 40*time.Millisecond)
+		report := latency(h, "DOCTOR")
+		assert.Equal(t, "bulk", report.Type)
+		assert.Contains(t, report.Bulk, "1. command: 1 latency spikes")
+	})
+
+	t.Run("Test Zero Threshold Disables Monitoring", func(t *testing.T) {
+		monitor := metrics.NewLatencyMonitor(0)
+		h := NewLatencyHandlers(monitor)
+		monitor.Observe(metrics.LatencyEventCommand, time.Second)
+
+		assert.Empty(t, latency(h, "LATEST").Array)
+		assert.Empty(t, latency(h, "HISTORY", "command").Array)
+		assert.Contains(t, latency(h, "DOCTOR").Bulk, "disabled")
+
+		// Raising the threshold again starts collecting
+		monitor.SetThreshold(1)
+		monitor.Observe(metrics.LatencyEventCommand, time.Second)
+		assert.Len(t, latency(h, "LATEST").Array, 1)
+
+		monitor.SetThreshold(0)
+		monitor.Observe(metrics.LatencyEventEviction, time.Second)
+		assert.Len(t, latency(h, "LATEST").Array, 1, "a disabled monitor should not record new events")
+	})
+
+	t.Run("Test Argument Errors", func(t *testing.T) {
+		h := NewLatencyHandlers(metrics.NewLatencyMonitor(1))
+		for _, args := range [][]string{
+			{},
+			{"LATEST", "extra"},
+			{"HISTORY"},
+			{"HISTORY", "command", "extra"},
+			{"DOCTOR", "extra"},
+			{"BOGUS"},
+		} {
+			assert.Equal(t, "error", latency(h, args...).Type, "LATENCY %q", args)
+		}
+		assert.NotEmpty(t, latency(h, "HELP").Array)
+	})
+}
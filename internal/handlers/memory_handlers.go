@@ -149,6 +149,77 @@ func (h *MemoryHandlers) HandleType(args []models.Value) models.Value {
 	return models.Value{Type: "string", Str: h.cache.Type(args[0].Bulk)}
 }
 
+// HandleObject handles the OBJECT command which inspects the value stored at a key
+//
+// Supports subcommands:
+//   - ENCODING: Returns the internal representation of the value
+//   - REFCOUNT: Returns the number of references to the value, always 1
+//   - IDLETIME: Returns the seconds since the key was last read or written
+//   - FREQ: Fails, as no LFU eviction policy tracks access frequencies
+//   - HELP: Returns the list of subcommands
+//
+// Returns nil for keys that do not exist
+func (h *MemoryHandlers) HandleObject(args []models.Value) models.Value {
+	if len(args) == 0 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'object' command"}
+	}
+
+	subcommand := strings.ToUpper(args[0].Bulk)
+	if subcommand == "HELP" {
+		lines := []string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+		}
+		result := make([]models.Value, len(lines))
+		for i, line := range lines {
+			result[i] = models.Value{Type: "string", Str: line}
+		}
+		return models.Value{Type: "array", Array: result}
+	}
+
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try OBJECT HELP.", args[0].Bulk)}
+	}
+	key := args[1].Bulk
+
+	switch subcommand {
+	case "ENCODING":
+		encoding, exists := h.cache.ObjectEncoding(key)
+		if !exists {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "bulk", Bulk: encoding}
+	case "REFCOUNT":
+		if !h.cache.Exists(key) {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "integer", Num: 1}
+	case "IDLETIME":
+		idle, exists := h.cache.ObjectIdleTime(key)
+		if !exists {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "integer", Num: int(idle)}
+	case "FREQ":
+		if !h.cache.Exists(key) {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "error", Str: "ERR An LFU maxmemory policy is not selected, access frequency not tracked."}
+	default:
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try OBJECT HELP.", args[0].Bulk)}
+	}
+}
+
 // HandleTTL handles the TTL command which returns the remaining time to live for a key
 // Parameters:
 //   - args: Array of Values containing the key to check
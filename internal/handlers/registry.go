@@ -27,6 +27,7 @@ type Registry struct {
 	bitMapHandlers      *BitMapHandlers
 	geoHandlers         *GeoHandlers
 	suggestionHandlers  *SuggestionHandlers
+	searchHandlers      *SearchHandlers
 	cmsHandlers         *CMSHandlers
 	cuckooHandlers      *CuckooHandlers
 	hllHandlers         *HLLHandlers
@@ -47,7 +48,7 @@ func NewRegistry(cache ports.Cache, clientManager *client.Manager) *Registry {
 		zsetHandlers:        NewZSetHandlers(cache),
 		adminHandlers:       NewAdminHandlers(cache, clientManager),
 		moduleHandlers:      NewModuleHandlers(cache),
-		configHandlers:      NewConfigHandlers(cache),
+		configHandlers:      NewConfigHandlers(cache, nil, nil),
 		scanHandlers:        NewScanHandlers(cache),
 		memoryHandlers:      NewMemoryHandlers(cache),
 		clusterHandlers:     NewClusterHandlers(cache),
@@ -57,6 +58,7 @@ func NewRegistry(cache ports.Cache, clientManager *client.Manager) *Registry {
 		bitMapHandlers:      NewBitMapHandlers(cache),
 		geoHandlers:         NewGeoHandlers(cache),
 		suggestionHandlers:  NewSuggestionHandlers(cache),
+		searchHandlers:      NewSearchHandlers(cache),
 		cmsHandlers:         NewCMSHandlers(cache),
 		cuckooHandlers:      NewCuckooHandlers(cache),
 		hllHandlers:         NewHLLHandlers(cache),
@@ -75,13 +77,18 @@ func (r *Registry) registerHandlers() {
 	// String Commands
 	r.handlers["SET"] = r.stringHandlers.HandleSet
 	r.handlers["SETEX"] = r.stringHandlers.HandleSetEx
+	r.handlers["PSETEX"] = r.stringHandlers.HandlePSetEx
+	r.handlers["SETNX"] = r.stringHandlers.HandleSetNX
+	r.handlers["GETSET"] = r.stringHandlers.HandleGetSet
 	r.handlers["GET"] = r.stringHandlers.HandleGet
 	r.handlers["INCR"] = r.stringHandlers.HandleIncr
 	r.handlers["DEL"] = r.stringHandlers.HandleDel
 	r.handlers["EXISTS"] = r.stringHandlers.HandleExists
 	r.handlers["EXPIRE"] = r.stringHandlers.HandleExpire
+	r.handlers["PEXPIRE"] = r.stringHandlers.HandlePExpire
 	r.handlers["STRLEN"] = r.stringHandlers.HandleStrlen
 	r.handlers["GETRANGE"] = r.stringHandlers.HandleGetRange
+	r.handlers["SUBSTR"] = r.stringHandlers.HandleGetRange
 	r.handlers["SETRANGE"] = r.stringHandlers.HandleSetRange
 	r.handlers["ECHO"] = r.stringHandlers.HandleEcho
 	r.handlers["MSET"] = r.stringHandlers.HandleMSet
@@ -151,6 +158,8 @@ func (r *Registry) registerHandlers() {
 	r.handlers["LINSERT"] = r.listHandlers.HandleLInsert
 	r.handlers["LMOVE"] = r.listHandlers.HandleLMove
 	r.handlers["LMPOP"] = r.listHandlers.HandleLMPop
+	r.handlers["LTRIM"] = r.listHandlers.HandleLTrim
+	r.handlers["LPOS"] = r.listHandlers.HandleLPos
 
 	// Set Commands
 	r.handlers["SADD"] = r.setHandlers.HandleSAdd
@@ -222,6 +231,7 @@ func (r *Registry) registerHandlers() {
 	r.handlers["MEMORY"] = r.memoryHandlers.HandleMemory
 	r.handlers["TYPE"] = r.memoryHandlers.HandleType
 	r.handlers["TTL"] = r.memoryHandlers.HandleTTL
+	r.handlers["OBJECT"] = r.memoryHandlers.HandleObject
 	r.handlers["RANDOMKEY"] = r.adminHandlers.HandleRandomKey
 
 	r.handlers["CLUSTER"] = r.clusterHandlers.HandleCluster
@@ -241,6 +251,7 @@ func (r *Registry) registerHandlers() {
 	r.handlers["JSON.OBJLEN"] = r.jsonHandlers.HandleJSONObjLen
 	r.handlers["JSON.ARRPOP"] = r.jsonHandlers.HandleJSONArrPop
 	r.handlers["JSON.MERGE"] = r.jsonHandlers.HandleJSONMerge
+	r.handlers["JSON.PATCH"] = r.jsonHandlers.HandleJSONPatch
 	r.handlers["JSON.ARRINSERT"] = r.jsonHandlers.HandleJSONArrInsert
 	r.handlers["JSON.NUMMULTBY"] = r.jsonHandlers.HandleJSONNumMultBy
 	r.handlers["JSON.CLEAR"] = r.jsonHandlers.HandleJSONClear
@@ -253,6 +264,7 @@ func (r *Registry) registerHandlers() {
 	r.handlers["JSON.COUNT"] = r.jsonHandlers.HandleJSONCount
 	r.handlers["JSON.SWAP"] = r.jsonHandlers.HandleJSONSwap
 	r.handlers["JSON.VALIDATE"] = r.jsonHandlers.HandleJSONValidate
+	r.handlers["JSON.SCHEMA"] = r.jsonHandlers.HandleJSONSchema
 	r.handlers["JSON.ARRSUM"] = r.jsonHandlers.HandleJSONArrSum
 	r.handlers["JSON.ARRAVG"] = r.jsonHandlers.HandleJSONArrAvg
 	r.handlers["JSON.SEARCH"] = r.jsonHandlers.HandleJSONSearch
@@ -289,6 +301,15 @@ func (r *Registry) registerHandlers() {
 	r.handlers["BITFIELD_RO"] = r.bitMapHandlers.HandleBitFieldRO
 	r.handlers["BITOP"] = r.bitMapHandlers.HandleBitOp
 	r.handlers["BITPOS"] = r.bitMapHandlers.HandleBitPos
+	r.handlers["R.SETBIT"] = r.bitMapHandlers.HandleRSetBit
+	r.handlers["R.GETBIT"] = r.bitMapHandlers.HandleRGetBit
+	r.handlers["R.BITOP"] = r.bitMapHandlers.HandleRBitOp
+	r.handlers["R.CARD"] = r.bitMapHandlers.HandleRCard
+	r.handlers["R.RANGE"] = r.bitMapHandlers.HandleRRange
+	r.handlers["R.SETINTARRAY"] = r.bitMapHandlers.HandleRSetIntArray
+	r.handlers["R.GETINTARRAY"] = r.bitMapHandlers.HandleRGetIntArray
+	r.handlers["R.MIN"] = r.bitMapHandlers.HandleRMin
+	r.handlers["R.MAX"] = r.bitMapHandlers.HandleRMax
 
 	// Suggestion Commands
 	r.handlers["FT.SUGADD"] = r.suggestionHandlers.HandleFTSugAdd
@@ -296,17 +317,26 @@ func (r *Registry) registerHandlers() {
 	r.handlers["FT.SUGGET"] = r.suggestionHandlers.HandleFTSugGet
 	r.handlers["FT.SUGLEN"] = r.suggestionHandlers.HandleFTSugLen
 
+	// Search Commands
+	r.handlers["FT.CREATE"] = r.searchHandlers.HandleFTCreate
+	r.handlers["FT.DROPINDEX"] = r.searchHandlers.HandleFTDropIndex
+	r.handlers["FT.INFO"] = r.searchHandlers.HandleFTInfo
+	r.handlers["FT._LIST"] = r.searchHandlers.HandleFTList
+	r.handlers["FT.SEARCH"] = r.searchHandlers.HandleFTSearch
+	r.handlers["FT.AGGREGATE"] = r.searchHandlers.HandleFTAggregate
+
 	// Geospatial Commands
 	r.handlers["GEOADD"] = r.geoHandlers.HandleGeoAdd
 	r.handlers["GEODIST"] = r.geoHandlers.HandleGeoDist
 	r.handlers["GEOPOS"] = r.geoHandlers.HandleGeoPos
 	r.handlers["GEORADIUS"] = r.geoHandlers.HandleGeoRadius
-	r.handlers["GEORADIUS_RO"] = r.geoHandlers.HandleGeoRadius      // Read-only variant uses same handler
-	r.handlers["GEORADIUSBYMEMBER"] = r.geoHandlers.HandleGeoRadius // Uses same radius logic
-	r.handlers["GEORADIUSBYMEMBER_RO"] = r.geoHandlers.HandleGeoRadius
+	r.handlers["GEORADIUS_RO"] = r.geoHandlers.HandleGeoRadiusRO
+	r.handlers["GEORADIUSBYMEMBER"] = r.geoHandlers.HandleGeoRadiusByMember
+	r.handlers["GEORADIUSBYMEMBER_RO"] = r.geoHandlers.HandleGeoRadiusByMemberRO
 	r.handlers["GEOSEARCH"] = r.geoHandlers.HandleGeoSearch
 	r.handlers["GEOSEARCHSTORE"] = r.geoHandlers.HandleGeoSearchStore
 	r.handlers["GEOHASH"] = r.geoHandlers.HandleGeoHash
+	r.handlers["GEOFENCE"] = r.geoHandlers.HandleGeoFence
 
 	// Count-Min Sketch Commands
 	r.handlers["CMS.INCRBY"] = r.cmsHandlers.HandleCMSIncrBy
@@ -341,6 +371,10 @@ func (r *Registry) registerHandlers() {
 	r.handlers["TDIGEST.CREATE"] = r.tdigestHandlers.HandleTDigestCreate
 	r.handlers["TDIGEST.ADD"] = r.tdigestHandlers.HandleTDigestAdd
 	r.handlers["TDIGEST.MERGE"] = r.tdigestHandlers.HandleTDigestMerge
+	r.handlers["TDIGEST.RANK"] = r.tdigestHandlers.HandleTDigestRank
+	r.handlers["TDIGEST.REVRANK"] = r.tdigestHandlers.HandleTDigestRevRank
+	r.handlers["TDIGEST.BYRANK"] = r.tdigestHandlers.HandleTDigestByRank
+	r.handlers["TDIGEST.BYREVRANK"] = r.tdigestHandlers.HandleTDigestByRevRank
 	r.handlers["TDIGEST.RESET"] = r.tdigestHandlers.HandleTDigestReset
 	r.handlers["TDIGEST.QUANTILE"] = r.tdigestHandlers.HandleTDigestQuantile
 	r.handlers["TDIGEST.MIN"] = r.tdigestHandlers.HandleTDigestMin
@@ -417,6 +451,18 @@ func (r *Registry) registerHandlers() {
 	r.handlers["SUNIONMULTI"] = r.setHandlers.HandleSUnionMulti
 }
 
+// AdminHandlers returns the admin handlers backing CLIENT and friends, so the
+// server can share their per-connection state.
+func (r *Registry) AdminHandlers() *AdminHandlers {
+	return r.adminHandlers
+}
+
+// Register adds or replaces the handler for cmd. It is used for commands
+// whose state lives outside the cache, such as server-level subsystems.
+func (r *Registry) Register(cmd string, handler CommandHandler) {
+	r.handlers[cmd] = handler
+}
+
 func (r *Registry) GetHandler(cmd string) (CommandHandler, bool) {
 	handler, exists := r.handlers[cmd]
 	if exists && cmd == "CLIENT" {
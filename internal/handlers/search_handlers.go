@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/internal/search"
+)
+
+type SearchHandlers struct {
+	cache ports.Cache
+}
+
+func NewSearchHandlers(cache ports.Cache) *SearchHandlers {
+	return &SearchHandlers{
+		cache: cache,
+	}
+}
+
+func bulkArgs(args []models.Value) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = arg.Bulk
+	}
+	return out
+}
+
+func searchError(err error) models.Value {
+	return models.Value{Type: "error", Str: "ERR " + err.Error()}
+}
+
+func bulkValue(s string) models.Value {
+	return models.Value{Type: "bulk", Bulk: s}
+}
+
+func (h *SearchHandlers) HandleFTCreate(args []models.Value) models.Value {
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft.create' command"}
+	}
+
+	def, err := search.ParseCreate(bulkArgs(args))
+	if err != nil {
+		return searchError(err)
+	}
+	if err := h.cache.FTCreate(def); err != nil {
+		return searchError(err)
+	}
+	return models.Value{Type: "string", Str: "OK"}
+}
+
+func (h *SearchHandlers) HandleFTDropIndex(args []models.Value) models.Value {
+	if len(args) < 1 || len(args) > 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft.dropindex' command"}
+	}
+
+	deleteDocs := false
+	if len(args) == 2 {
+		if !strings.EqualFold(args[1].Bulk, "DD") {
+			return models.Value{Type: "error", Str: "ERR Unknown argument `" + args[1].Bulk + "`"}
+		}
+		deleteDocs = true
+	}
+	if err := h.cache.FTDropIndex(args[0].Bulk, deleteDocs); err != nil {
+		return searchError(err)
+	}
+	return models.Value{Type: "string", Str: "OK"}
+}
+
+func (h *SearchHandlers) HandleFTList(args []models.Value) models.Value {
+	if len(args) != 0 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft._list' command"}
+	}
+
+	names := h.cache.FTList()
+	result := make([]models.Value, len(names))
+	for i, name := range names {
+		result[i] = bulkValue(name)
+	}
+	return models.Value{Type: "array", Array: result}
+}
+
+func (h *SearchHandlers) HandleFTInfo(args []models.Value) models.Value {
+	if len(args) != 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft.info' command"}
+	}
+
+	info, err := h.cache.FTInfo(args[0].Bulk)
+	if err != nil {
+		return searchError(err)
+	}
+	def := info.Definition
+
+	prefixes := make([]models.Value, len(def.Prefixes))
+	for i, p := range def.Prefixes {
+		prefixes[i] = bulkValue(p)
+	}
+	if len(prefixes) == 0 {
+		prefixes = append(prefixes, bulkValue(""))
+	}
+
+	attributes := make([]models.Value, len(def.Fields))
+	for i, f := range def.Fields {
+		attr := []models.Value{
+			bulkValue("identifier"), bulkValue(f.Identifier),
+			bulkValue("attribute"), bulkValue(f.Name),
+			bulkValue("type"), bulkValue(f.Type.String()),
+		}
+		switch f.Type {
+		case search.TextField:
+			attr = append(attr, bulkValue("WEIGHT"), bulkValue(strconv.FormatFloat(f.Weight, 'f', -1, 64)))
+			if f.NoStem {
+				attr = append(attr, bulkValue("NOSTEM"))
+			}
+		case search.TagField:
+			attr = append(attr, bulkValue("SEPARATOR"), bulkValue(f.Separator))
+			if f.CaseSensitive {
+				attr = append(attr, bulkValue("CASESENSITIVE"))
+			}
+		case search.VectorField:
+			v := f.Vector
+			attr = append(attr,
+				bulkValue("algorithm"), bulkValue(v.Algorithm),
+				bulkValue("data_type"), bulkValue(v.Type),
+				bulkValue("dim"), models.Value{Type: "integer", Num: v.Dim},
+				bulkValue("distance_metric"), bulkValue(v.Metric))
+			if v.Algorithm == search.VectorHNSW {
+				attr = append(attr,
+					bulkValue("M"), models.Value{Type: "integer", Num: v.M},
+					bulkValue("ef_construction"), models.Value{Type: "integer", Num: v.EFConstruction},
+					bulkValue("ef_runtime"), models.Value{Type: "integer", Num: v.EFRuntime})
+			}
+		}
+		if f.Sortable {
+			attr = append(attr, bulkValue("SORTABLE"))
+		}
+		if f.NoIndex {
+			attr = append(attr, bulkValue("NOINDEX"))
+		}
+		attributes[i] = models.Value{Type: "array", Array: attr}
+	}
+
+	return models.Value{Type: "array", Array: []models.Value{
+		bulkValue("index_name"), bulkValue(def.Name),
+		bulkValue("index_definition"), {Type: "array", Array: []models.Value{
+			bulkValue("key_type"), bulkValue(def.On.String()),
+			bulkValue("prefixes"), {Type: "array", Array: prefixes},
+			bulkValue("default_language"), bulkValue(def.Language),
+		}},
+		bulkValue("attributes"), {Type: "array", Array: attributes},
+		bulkValue("num_docs"), {Type: "integer", Num: info.NumDocs},
+		bulkValue("num_terms"), {Type: "integer", Num: info.NumTerms},
+		bulkValue("num_records"), {Type: "integer", Num: info.NumRecords},
+	}}
+}
+
+func (h *SearchHandlers) HandleFTSearch(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft.search' command"}
+	}
+
+	query, opts, err := search.ParseSearch(bulkArgs(args[1:]))
+	if err != nil {
+		return searchError(err)
+	}
+	result, err := h.cache.FTSearch(args[0].Bulk, query, opts)
+	if err != nil {
+		return searchError(err)
+	}
+
+	reply := []models.Value{{Type: "integer", Num: result.Total}}
+	for _, hit := range result.Hits {
+		reply = append(reply, bulkValue(hit.Key))
+		if opts.WithScores {
+			reply = append(reply, bulkValue(strconv.FormatFloat(hit.Score, 'g', -1, 64)))
+		}
+		if opts.NoContent {
+			continue
+		}
+		fields := make([]models.Value, 0, 2*len(hit.Fields))
+		for _, kv := range hit.Fields {
+			fields = append(fields, bulkValue(kv[0]), bulkValue(kv[1]))
+		}
+		reply = append(reply, models.Value{Type: "array", Array: fields})
+	}
+	return models.Value{Type: "array", Array: reply}
+}
+
+func (h *SearchHandlers) HandleFTAggregate(args []models.Value) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ft.aggregate' command"}
+	}
+
+	req, err := search.ParseAggregate(bulkArgs(args[1:]))
+	if err != nil {
+		return searchError(err)
+	}
+	result, err := h.cache.FTAggregate(args[0].Bulk, req)
+	if err != nil {
+		return searchError(err)
+	}
+
+	reply := []models.Value{{Type: "integer", Num: result.Total}}
+	for _, row := range result.Rows {
+		fields := make([]models.Value, 0, 2*len(row.Fields()))
+		for _, name := range row.Fields() {
+			v, _ := row.Get(name)
+			fields = append(fields, bulkValue(name), aggregateValue(v))
+		}
+		reply = append(reply, models.Value{Type: "array", Array: fields})
+	}
+	return models.Value{Type: "array", Array: reply}
+}
+
+func aggregateValue(v interface{}) models.Value {
+	switch t := v.(type) {
+	case nil:
+		return models.Value{Type: "null"}
+	case []interface{}:
+		items := make([]models.Value, len(t))
+		for i, item := range t {
+			items[i] = aggregateValue(item)
+		}
+		return models.Value{Type: "array", Array: items}
+	}
+	return bulkValue(search.FormatValue(v))
+}
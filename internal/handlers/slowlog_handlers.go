@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+)
+
+type SlowLogHandlers struct {
+	slowlog *metrics.SlowLog
+}
+
+func NewSlowLogHandlers(slowlog *metrics.SlowLog) *SlowLogHandlers {
+	return &SlowLogHandlers{
+		slowlog: slowlog,
+	}
+}
+
+// HandleSlowLog handles SLOWLOG GET [count] | LEN | RESET
+func (h *SlowLogHandlers) HandleSlowLog(args []models.Value) models.Value {
+	if len(args) == 0 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'slowlog' command"}
+	}
+
+	subCmd := strings.ToUpper(args[0].Bulk)
+	switch subCmd {
+	case "GET":
+		if len(args) > 2 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'slowlog|get' command"}
+		}
+		count := 10
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1].Bulk)
+			if err != nil || n < -1 {
+				return models.Value{Type: "error", Str: "ERR count should be greater than or equal to -1"}
+			}
+			count = n
+		}
+		return h.handleSlowLogGet(count)
+	case "LEN":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'slowlog|len' command"}
+		}
+		return models.Value{Type: "integer", Num: h.slowlog.Len()}
+	case "RESET":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'slowlog|reset' command"}
+		}
+		h.slowlog.Reset()
+		return models.Value{Type: "string", Str: "OK"}
+	case "HELP":
+		return stringsToArray([]string{
+			"SLOWLOG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET [<count>]",
+			"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+			"    Entries are made of:",
+			"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+			"    client name",
+			"LEN",
+			"    Return the length of the slowlog.",
+			"RESET",
+			"    Reset the slowlog.",
+		})
+	default:
+		return models.Value{Type: "error", Str: "ERR unknown subcommand '" + args[0].Bulk + "'. Try SLOWLOG HELP."}
+	}
+}
+
+func (h *SlowLogHandlers) handleSlowLogGet(count int) models.Value {
+	entries := h.slowlog.Get(count)
+
+	result := make([]models.Value, 0, len(entries))
+	for _, entry := range entries {
+		cmdArgs := make([]models.Value, len(entry.Args))
+		for i, arg := range entry.Args {
+			cmdArgs[i] = models.Value{Type: "bulk", Bulk: arg}
+		}
+
+		result = append(result, models.Value{
+			Type: "array",
+			Array: []models.Value{
+				{Type: "integer", Num: int(entry.ID)},
+				{Type: "integer", Num: int(entry.Timestamp.Unix())},
+				{Type: "integer", Num: int(entry.Duration.Microseconds())},
+				{Type: "array", Array: cmdArgs},
+				{Type: "bulk", Bulk: entry.ClientAddr},
+				{Type: "bulk", Bulk: entry.ClientName},
+			},
+		})
+	}
+
+	return models.Value{Type: "array", Array: result}
+}
+
+func stringsToArray(lines []string) models.Value {
+	result := make([]models.Value, len(lines))
+	for i, line := range lines {
+		result[i] = models.Value{Type: "string", Str: line}
+	}
+	return models.Value{Type: "array", Array: result}
+}
@@ -1,7 +1,8 @@
 package handlers
 
 import (
-	"log"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -22,94 +23,148 @@ func NewStringHandlers(cache ports.Cache) *StringHandlers {
 }
 
 // HandleSet processes the 'SET' command to store a key-value pair in the cache.
-// It supports optional arguments for conditional setting and expiration time.
+// The value is stored, and its old value read, atomically with the checks
+// of the options.
 //
 // Arguments:
 // - args: A slice of models.Value containing the command arguments.
 //
-// Returns:
-//   - models.Value: The result of the command execution. It returns an error message
-//     if the arguments are invalid or if there is an issue with setting the value.
-//     Otherwise, it returns "OK" if the value is successfully set.
-//
 // The command supports the following optional arguments:
-// - NX: Only set the key if it does not already exist.
-// - XX: Only set the key if it already exists.
-// - EX <seconds>: Set the specified expire time, in seconds, for the key.
+//   - NX: Only set the key if it does not already exist.
+//   - XX: Only set the key if it already exists.
+//   - GET: Return the old string value of the key, or nil if there was none.
+//   - EX <seconds>, PX <milliseconds>: Set the specified time to live.
+//   - EXAT <timestamp>, PXAT <timestamp>: Set the specified Unix expiry time,
+//     in seconds or milliseconds.
+//   - KEEPTTL: Retain the time to live of the key.
+//
+// Without an expiry option the key loses its time to live.
 //
 // Example usage:
-//   - SET key value NX EX 10
-//     This sets the key to the value only if the key does not exist and sets an expiration time of 10 seconds.
+//   - SET lock token NX PX 30000
+//     This takes a lock for 30 seconds, unless another client holds it.
 //
 // Returns:
-//   - models.Value: An object containing the result of the operation. If the
-//     operation is successful, it returns an integer type with value 1. If the
-//     operation fails, it returns an integer type with value 0. In case of an error,
-//     it returns an error type with an appropriate error message.
-//
-// The function performs the following steps:
-//  1. Validates the number of arguments.
-//  2. Parses the expiration time from the arguments.
-//  3. Optionally processes and validates the condition argument.
-//  4. Calls the SEExpire method on the cache with the provided key, expiration time,
-//     and condition.
-//  5. Returns the result of the operation as a models.Value object.
+//   - models.Value: "OK", or nil if NX or XX prevented the write. With GET,
+//     the old value instead. An error for invalid arguments, or for GET on a
+//     key of another type.
 func (h *StringHandlers) HandleSet(args []models.Value) models.Value {
 	if len(args) < 2 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'set' command"}
 	}
 
-	key := args[0].Bulk
-	value := args[1].Bulk
-	nx := false
-	xx := false
-	expireSeconds := -1
-
-	// Parse optional arguments
+	var opts models.SetOptions
+	expiry := ""
 	for i := 2; i < len(args); i++ {
-		switch strings.ToUpper(args[i].Bulk) {
-		case "NX":
-			nx = true
-		case "XX":
-			xx = true
-		case "EX":
-			if i+1 >= len(args) {
+		option := strings.ToUpper(args[i].Bulk)
+		switch option {
+		case "NX", "XX":
+			if opts.NX || opts.XX {
 				return models.Value{Type: "error", Str: "ERR syntax error"}
 			}
-			seconds, err := util.ParseInt(args[i+1])
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR value is not an integer or out of range"}
+			opts.NX, opts.XX = option == "NX", option == "XX"
+		case "GET":
+			opts.Get = true
+		case "KEEPTTL":
+			if expiry != "" {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
+			}
+			expiry = option
+			opts.KeepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expiry != "" || i+1 >= len(args) {
+				return models.Value{Type: "error", Str: "ERR syntax error"}
 			}
-			if seconds <= 0 {
-				return models.Value{Type: "error", Str: "ERR invalid expire time in set"}
+			expireAt, err := parseExpireOption(option, args[i+1], "set")
+			if err != nil {
+				return util.ToValue(err)
 			}
-			expireSeconds = seconds
+			expiry = option
+			opts.ExpireAt = expireAt
 			i++
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
 	}
 
-	// Check NX/XX conditions
-	exists := h.cache.Exists(key)
-	if (nx && exists) || (xx && !exists) {
+	result, err := h.cache.SetWithOptions(args[0].Bulk, args[1].Bulk, opts)
+	if err != nil {
+		return util.ToValue(err)
+	}
+
+	if opts.Get {
+		if !result.Existed {
+			return models.Value{Type: "null"}
+		}
+		return models.Value{Type: "bulk", Bulk: result.Previous}
+	}
+	if !result.Written {
 		return models.Value{Type: "null"}
 	}
+	return models.Value{Type: "string", Str: "OK"}
+}
 
-	// Set the value
-	err := h.cache.Set(key, value)
+// parseExpireOption returns the expiry time given by the argument of an EX,
+// PX, EXAT or PXAT option of command. Like Redis it rejects times that are
+// not positive, or that overflow.
+func parseExpireOption(option string, arg models.Value, command string) (time.Time, error) {
+	n, err := strconv.ParseInt(arg.Bulk, 10, 64)
 	if err != nil {
-		return util.ToValue(err)
+		return time.Time{}, fmt.Errorf("ERR value is not an integer or out of range")
 	}
 
-	// Set expiration if specified
-	if expireSeconds > 0 {
-		err = h.cache.Expire(key, expireSeconds)
-		if err != nil {
-			return util.ToValue(err)
+	invalid := fmt.Errorf("ERR invalid expire time in '%s' command", command)
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+	// Work in milliseconds
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
 		}
+		n *= 1000
 	}
 
-	log.Printf("[DEBUG] SET key=%s value=%s nx=%v xx=%v ex=%d", key, value, nx, xx, expireSeconds)
-	return models.Value{Type: "string", Str: "OK"}
+	if option == "EXAT" || option == "PXAT" {
+		return time.UnixMilli(n), nil
+	}
+	if n > math.MaxInt64/int64(time.Millisecond) {
+		return time.Time{}, invalid
+	}
+	return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+}
+
+// HandleSetNX handles the 'setnx' command, which sets a key only if it does
+// not exist. It returns 1 if the key was set, 0 otherwise.
+func (h *StringHandlers) HandleSetNX(args []models.Value) models.Value {
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'setnx' command"}
+	}
+
+	result, err := h.cache.SetWithOptions(args[0].Bulk, args[1].Bulk, models.SetOptions{NX: true})
+	if err != nil {
+		return util.ToValue(err)
+	}
+
+	return models.Value{Type: "integer", Num: boolToInt(result.Written)}
+}
+
+// HandleGetSet handles the 'getset' command, which sets a key and returns
+// its old string value, or nil if it did not exist.
+func (h *StringHandlers) HandleGetSet(args []models.Value) models.Value {
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'getset' command"}
+	}
+
+	result, err := h.cache.SetWithOptions(args[0].Bulk, args[1].Bulk, models.SetOptions{Get: true})
+	if err != nil {
+		return util.ToValue(err)
+	}
+
+	if !result.Existed {
+		return models.Value{Type: "null"}
+	}
+	return models.Value{Type: "bulk", Bulk: result.Previous}
 }
 
 func (h *StringHandlers) HandleGet(args []models.Value) models.Value {
@@ -166,22 +221,62 @@ func (h *StringHandlers) HandleExists(args []models.Value) models.Value {
 	return models.Value{Type: "integer", Num: 0}
 }
 
+// HandleExpire handles the 'expire' command, which sets a time to live in
+// seconds on a key, optionally only if it has none (NX), has one (XX), or
+// the new one is greater (GT) or less (LT). It returns 1 if the time to
+// live was set, 0 otherwise.
 func (h *StringHandlers) HandleExpire(args []models.Value) models.Value {
-	if err := util.ValidateArgs(args, 2); err != nil {
-		return util.ToValue(err)
+	return h.handleExpire(args, "expire", 1000, false)
+}
+
+// HandlePExpire handles the 'pexpire' command, which is EXPIRE with a time
+// to live in milliseconds.
+func (h *StringHandlers) HandlePExpire(args []models.Value) models.Value {
+	return h.handleExpire(args, "pexpire", 1, false)
+}
+
+// handleExpire serves EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT, whose time is
+// in units of unit milliseconds, and a Unix time if absolute is set.
+func (h *StringHandlers) handleExpire(args []models.Value, command string, unit int64, absolute bool) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)}
 	}
 
-	seconds, err := util.ParseInt(args[1])
+	ttl, err := strconv.ParseInt(args[1].Bulk, 10, 64)
 	if err != nil {
-		return util.ToValue(err)
+		return models.Value{Type: "error", Str: "ERR value is not an integer or out of range"}
+	}
+	if ttl > math.MaxInt64/int64(time.Millisecond)/unit || ttl < math.MinInt64/int64(time.Millisecond)/unit {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR invalid expire time in '%s' command", command)}
 	}
 
-	err = h.cache.Expire(args[0].Bulk, seconds)
+	condition := ""
+	for _, arg := range args[2:] {
+		option := strings.ToUpper(arg.Bulk)
+		switch option {
+		case "NX", "XX", "GT", "LT":
+		default:
+			return models.Value{Type: "error", Str: fmt.Sprintf("ERR Unsupported option %s", arg.Bulk)}
+		}
+		if condition != "" && condition != option {
+			if condition == "GT" && option == "LT" || condition == "LT" && option == "GT" {
+				return models.Value{Type: "error", Str: "ERR GT and LT options at the same time are not compatible"}
+			}
+			return models.Value{Type: "error", Str: "ERR NX and XX, GT or LT options at the same time are not compatible"}
+		}
+		condition = option
+	}
+
+	ttl *= unit
+	if absolute {
+		ttl -= time.Now().UnixMilli()
+	}
+	success, err := h.cache.PExpire(args[0].Bulk, ttl, condition)
 	if err != nil {
 		return util.ToValue(err)
 	}
 
-	return models.Value{Type: "integer", Num: 1}
+	return models.Value{Type: "integer", Num: boolToInt(success)}
 }
 
 func (h *StringHandlers) HandleStrlen(args []models.Value) models.Value {
@@ -435,6 +530,8 @@ func (h *StringHandlers) HandleSetRange(args []models.Value) models.Value {
 	return models.Value{Type: "integer", Num: len(result)}
 }
 
+// HandleGetEx handles the 'getex' command, which returns the value of a key
+// and sets its expiry with EX, PX, EXAT or PXAT, or removes it with PERSIST.
 func (h *StringHandlers) HandleGetEx(args []models.Value) models.Value {
 	if len(args) < 1 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'getex' command"}
@@ -442,83 +539,47 @@ func (h *StringHandlers) HandleGetEx(args []models.Value) models.Value {
 
 	key := args[0].Bulk
 
-	// Get the value first
-	value, exists := h.cache.Get(key)
-	if !exists {
-		return models.Value{Type: "null"}
-	}
-
-	// If no expiry arguments provided, just return the value
-	if len(args) == 1 {
-		return models.Value{Type: "bulk", Bulk: value}
-	}
-
-	// Handle expiry options
+	// Validate the options before touching the key
+	option := ""
+	var expireAt time.Time
 	if len(args) >= 2 {
-		switch strings.ToUpper(args[1].Bulk) {
+		option = strings.ToUpper(args[1].Bulk)
+		switch option {
 		case "EX", "PX", "EXAT", "PXAT":
 			if len(args) != 3 {
 				return models.Value{Type: "error", Str: "ERR syntax error"}
 			}
-
-			timeValue, err := util.ParseInt(args[2])
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR value is not an integer or out of range"}
-			}
-
-			switch strings.ToUpper(args[1].Bulk) {
-			case "EX":
-				// Seconds from now
-				if timeValue <= 0 {
-					return models.Value{Type: "error", Str: "ERR invalid expire time in getex"}
-				}
-				err = h.cache.Expire(key, timeValue)
-
-			case "PX":
-				// Milliseconds from now - convert to seconds (rounded up)
-				if timeValue <= 0 {
-					return models.Value{Type: "error", Str: "ERR invalid expire time in getex"}
-				}
-				seconds := (timeValue + 999) / 1000 // Round up milliseconds to seconds
-				err = h.cache.Expire(key, seconds)
-
-			case "EXAT":
-				// Unix timestamp in seconds
-				now := time.Now().Unix()
-				if int64(timeValue) <= now {
-					return models.Value{Type: "error", Str: "ERR invalid expire time in getex"}
-				}
-				seconds := int(int64(timeValue) - now)
-				err = h.cache.Expire(key, seconds)
-
-			case "PXAT":
-				// Unix timestamp in milliseconds
-				nowMs := time.Now().UnixMilli()
-				if int64(timeValue) <= nowMs {
-					return models.Value{Type: "error", Str: "ERR invalid expire time in getex"}
-				}
-				seconds := int((int64(timeValue) - nowMs + 999) / 1000) // Round up to seconds
-				err = h.cache.Expire(key, seconds)
-			}
-
+			var err error
+			expireAt, err = parseExpireOption(option, args[2], "getex")
 			if err != nil {
 				return util.ToValue(err)
 			}
-
 		case "PERSIST":
 			if len(args) != 2 {
 				return models.Value{Type: "error", Str: "ERR syntax error"}
 			}
-			err := h.cache.Expire(key, -1) // Remove expiration
-			if err != nil {
-				return util.ToValue(err)
-			}
-
 		default:
 			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
 	}
 
+	value, exists := h.cache.Get(key)
+	if !exists {
+		return models.Value{Type: "null"}
+	}
+
+	switch option {
+	case "PERSIST":
+		if _, err := h.cache.Persist(key); err != nil {
+			return util.ToValue(err)
+		}
+	case "":
+	default:
+		if err := h.cache.PExpireAt(key, expireAt.UnixMilli()); err != nil {
+			return util.ToValue(err)
+		}
+	}
+
 	return models.Value{Type: "bulk", Bulk: value}
 }
 
@@ -804,104 +865,17 @@ func (h *StringHandlers) HandleMGetType(args []models.Value) models.Value {
 	}
 }
 
-// HandleExpireAt sets an expiration time on a key.
-//
-// Args:
-//
-//	args ([]models.Value): A slice of Value objects where the first element is the key
-//	                       and the second element is the expiration timestamp.
-//
-// Returns:
-//
-//	models.Value: A Value object indicating the result of the operation. If the number
-//	              of arguments is incorrect, it returns an error Value. If the key does
-//	              not exist, it returns an integer Value with Num set to 0. If the
-//	              expiration is successfully set, it returns an integer Value with Num
-//	              set to 1.
+// HandleExpireAt handles the 'expireat' command, which is EXPIRE with the
+// expiry given as a Unix time in seconds. A time in the past deletes the
+// key.
 func (h *StringHandlers) HandleExpireAt(args []models.Value) models.Value {
-	if len(args) != 2 {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR wrong number of arguments for 'expireat' command",
-		}
-	}
-
-	key := args[0].Bulk
-	timestamp, err := strconv.ParseInt(args[1].Bulk, 10, 64)
-	if err != nil {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR value is not an integer or out of range",
-		}
-	}
-
-	// Check if key exists
-	if !h.cache.Exists(key) {
-		return models.Value{
-			Type: "integer",
-			Num:  0,
-		}
-	}
-
-	err = h.cache.ExpireAt(key, timestamp)
-	if err != nil {
-		return models.Value{
-			Type: "integer",
-			Num:  0,
-		}
-	}
-
-	return models.Value{
-		Type: "integer",
-		Num:  1,
-	}
+	return h.handleExpire(args, "expireat", 1000, true)
 }
 
-// HandlePExpireAt handles the 'pexpireat' command which sets the expiration time of a key to a specific timestamp in milliseconds.
-//
-// Arguments:
-// - args: A slice of models.Value containing the key and the timestamp in milliseconds.
-//
-// Returns:
-//   - models.Value: An object representing the result of the operation. It returns an error if the number of arguments is incorrect or if the timestamp is not a valid integer.
-//     If the key does not exist, it returns an integer value of 0. If the expiration is successfully set, it returns an integer value of 1.
+// HandlePExpireAt handles the 'pexpireat' command, which is EXPIREAT with a
+// Unix time in milliseconds.
 func (h *StringHandlers) HandlePExpireAt(args []models.Value) models.Value {
-	if len(args) != 2 {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR wrong number of arguments for 'pexpireat' command",
-		}
-	}
-
-	key := args[0].Bulk
-	timestampMs, err := strconv.ParseInt(args[1].Bulk, 10, 64)
-	if err != nil {
-		return models.Value{
-			Type: "error",
-			Str:  "ERR value is not an integer or out of range",
-		}
-	}
-
-	// Check if key exists
-	if !h.cache.Exists(key) {
-		return models.Value{
-			Type: "integer",
-			Num:  0,
-		}
-	}
-
-	err = h.cache.PExpireAt(key, timestampMs)
-	if err != nil {
-		return models.Value{
-			Type: "integer",
-			Num:  0,
-		}
-	}
-
-	return models.Value{
-		Type: "integer",
-		Num:  1,
-	}
+	return h.handleExpire(args, "pexpireat", 1, true)
 }
 
 // HandleSEExpire processes the 'seexpire' command which sets an expiration
@@ -980,31 +954,32 @@ func (h *StringHandlers) HandleSEExpire(args []models.Value) models.Value {
 	}
 }
 
+// HandleSetEx handles the 'setex' command, which sets a key with a time to
+// live in seconds.
 func (h *StringHandlers) HandleSetEx(args []models.Value) models.Value {
-	if len(args) != 3 {
-		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'setex' command"}
-	}
+	return h.handleSetExpiring(args, "setex", "EX")
+}
 
-	key := args[0].Bulk
-	seconds, err := strconv.Atoi(args[1].Bulk)
-	if err != nil {
-		return models.Value{Type: "error", Str: "ERR value is not an integer or out of range"}
-	}
+// HandlePSetEx handles the 'psetex' command, which sets a key with a time
+// to live in milliseconds.
+func (h *StringHandlers) HandlePSetEx(args []models.Value) models.Value {
+	return h.handleSetExpiring(args, "psetex", "PX")
+}
 
-	if seconds <= 0 {
-		return models.Value{Type: "error", Str: "ERR invalid expire time in setex"}
+// handleSetExpiring serves SETEX and PSETEX, which are SET key value with
+// the expiry option option.
+func (h *StringHandlers) handleSetExpiring(args []models.Value, command string, option string) models.Value {
+	if len(args) != 3 {
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", command)}
 	}
 
-	value := args[2].Bulk
-
-	// Set the value
-	if err := h.cache.Set(key, value); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+	expireAt, err := parseExpireOption(option, args[1], command)
+	if err != nil {
+		return util.ToValue(err)
 	}
 
-	// Set expiration
-	if err := h.cache.Expire(key, seconds); err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+	if _, err := h.cache.SetWithOptions(args[0].Bulk, args[2].Bulk, models.SetOptions{ExpireAt: expireAt}); err != nil {
+		return util.ToValue(err)
 	}
 
 	return models.Value{Type: "string", Str: "OK"}
@@ -18,6 +18,8 @@ func NewSuggestionHandlers(cache ports.Cache) *SuggestionHandlers {
 	}
 }
 
+// HandleFTSugAdd implements FT.SUGADD key string score [INCR] [PAYLOAD payload]
+// and replies with the size of the dictionary.
 func (h *SuggestionHandlers) HandleFTSugAdd(args []models.Value) models.Value {
 	if len(args) < 3 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
@@ -31,21 +33,29 @@ func (h *SuggestionHandlers) HandleFTSugAdd(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: "ERR score must be a valid float"}
 	}
 
-	// Handle optional arguments
-	var opts []string
+	incr := false
+	var payload *string
 	for i := 3; i < len(args); i++ {
-		opts = append(opts, args[i].Bulk)
+		switch strings.ToUpper(args[i].Bulk) {
+		case "INCR":
+			incr = true
+		case "PAYLOAD":
+			if i+1 >= len(args) {
+				return models.Value{Type: "error", Str: "ERR PAYLOAD requires argument"}
+			}
+			payload = &args[i+1].Bulk
+			i++
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
 	}
 
-	added, err := h.cache.FTSugAdd(key, str, score, opts...)
+	size, err := h.cache.FTSugAdd(key, str, score, incr, payload)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	if added {
-		return models.Value{Type: "string", Str: "OK"}
-	}
-	return models.Value{Type: "null"}
+	return models.Value{Type: "integer", Num: int(size)}
 }
 
 func (h *SuggestionHandlers) HandleFTSugDel(args []models.Value) models.Value {
@@ -67,6 +77,10 @@ func (h *SuggestionHandlers) HandleFTSugDel(args []models.Value) models.Value {
 	return models.Value{Type: "integer", Num: 0}
 }
 
+// HandleFTSugGet implements
+// FT.SUGGET key prefix [FUZZY] [WITHSCORES] [WITHPAYLOADS] [MAX max]. The reply
+// lists each suggestion followed by its score and payload when requested.
+// At most 5 suggestions are returned unless MAX says otherwise.
 func (h *SuggestionHandlers) HandleFTSugGet(args []models.Value) models.Value {
 	if len(args) < 2 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments"}
@@ -74,24 +88,30 @@ func (h *SuggestionHandlers) HandleFTSugGet(args []models.Value) models.Value {
 
 	key := args[0].Bulk
 	prefix := args[1].Bulk
-	fuzzy := false
-	max := 0
+	fuzzy, withScores, withPayloads := false, false, false
+	max := 5
 
 	// Parse options
 	for i := 2; i < len(args); i++ {
 		switch strings.ToUpper(args[i].Bulk) {
 		case "FUZZY":
 			fuzzy = true
+		case "WITHSCORES":
+			withScores = true
+		case "WITHPAYLOADS":
+			withPayloads = true
 		case "MAX":
 			if i+1 >= len(args) {
 				return models.Value{Type: "error", Str: "ERR MAX requires argument"}
 			}
 			var err error
 			max, err = strconv.Atoi(args[i+1].Bulk)
-			if err != nil {
+			if err != nil || max < 0 {
 				return models.Value{Type: "error", Str: "ERR MAX must be numeric"}
 			}
 			i++
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
 	}
 
@@ -101,16 +121,19 @@ func (h *SuggestionHandlers) HandleFTSugGet(args []models.Value) models.Value {
 	}
 
 	// Format results
-	results := make([]models.Value, len(suggestions))
-	for i, sug := range suggestions {
-		result := []models.Value{
-			{Type: "bulk", Bulk: sug.String},
-			{Type: "bulk", Bulk: strconv.FormatFloat(sug.Score, 'f', -1, 64)},
+	results := make([]models.Value, 0, len(suggestions))
+	for _, sug := range suggestions {
+		results = append(results, models.Value{Type: "bulk", Bulk: sug.String})
+		if withScores {
+			results = append(results, models.Value{Type: "bulk", Bulk: strconv.FormatFloat(sug.Score, 'f', -1, 64)})
 		}
-		if sug.Payload != "" {
-			result = append(result, models.Value{Type: "bulk", Bulk: sug.Payload})
+		if withPayloads {
+			if sug.Payload == "" {
+				results = append(results, models.Value{Type: "null"})
+			} else {
+				results = append(results, models.Value{Type: "bulk", Bulk: sug.Payload})
+			}
 		}
-		results[i] = models.Value{Type: "array", Array: result}
 	}
 
 	return models.Value{Type: "array", Array: results}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
@@ -26,9 +28,16 @@ func (h *TDigestHandlers) HandleTDigestCreate(args []models.Value) models.Value
 	key := args[0].Bulk
 	compression := 100.0 // default compression
 
-	if len(args) > 1 {
+	rest := args[1:]
+	if len(rest) == 2 && strings.ToUpper(rest[0].Bulk) == "COMPRESSION" {
+		rest = rest[1:]
+	}
+	if len(rest) > 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'TDIGEST.CREATE'"}
+	}
+	if len(rest) == 1 {
 		var err error
-		compression, err = strconv.ParseFloat(args[1].Bulk, 64)
+		compression, err = strconv.ParseFloat(rest[0].Bulk, 64)
 		if err != nil {
 			return models.Value{Type: "error", Str: "ERR invalid compression value"}
 		}
@@ -67,38 +76,48 @@ func (h *TDigestHandlers) HandleTDigestAdd(args []models.Value) models.Value {
 	return models.Value{Type: "string", Str: "OK"}
 }
 
-// HandleTDigestMerge handles TDIGEST.MERGE command
+// HandleTDigestMerge handles TDIGEST.MERGE command:
+// TDIGEST.MERGE destkey numkeys sourcekey [sourcekey ...] [COMPRESSION compression] [OVERRIDE]
 func (h *TDigestHandlers) HandleTDigestMerge(args []models.Value) models.Value {
 	if len(args) < 3 {
 		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'TDIGEST.MERGE'"}
 	}
 
 	destKey := args[0].Bulk
-	weights := make([]float64, 0)
-	sourceKeys := make([]string, 0)
+	numKeys, err := strconv.Atoi(args[1].Bulk)
+	if err != nil || numKeys <= 0 {
+		return models.Value{Type: "error", Str: "ERR invalid numkeys"}
+	}
+	if len(args) < 2+numKeys {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'TDIGEST.MERGE'"}
+	}
+
+	sourceKeys := make([]string, numKeys)
+	for i := range sourceKeys {
+		sourceKeys[i] = args[2+i].Bulk
+	}
 
-	i := 1
-	if args[i].Bulk == "WEIGHTS" {
-		i++
-		for ; i < len(args); i += 2 {
+	compression := 0.0
+	override := false
+	for i := 2 + numKeys; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "COMPRESSION":
 			if i+1 >= len(args) {
-				return models.Value{Type: "error", Str: "ERR weight not specified"}
+				return models.Value{Type: "error", Str: "ERR syntax error"}
 			}
-			w, err := strconv.ParseFloat(args[i].Bulk, 64)
-			if err != nil {
-				return models.Value{Type: "error", Str: "ERR invalid weight"}
+			i++
+			compression, err = strconv.ParseFloat(args[i].Bulk, 64)
+			if err != nil || compression <= 0 {
+				return models.Value{Type: "error", Str: "ERR invalid compression value"}
 			}
-			weights = append(weights, w)
-			sourceKeys = append(sourceKeys, args[i+1].Bulk)
-		}
-	} else {
-		for ; i < len(args); i++ {
-			weights = append(weights, 1.0)
-			sourceKeys = append(sourceKeys, args[i].Bulk)
+		case "OVERRIDE":
+			override = true
+		default:
+			return models.Value{Type: "error", Str: "ERR syntax error"}
 		}
 	}
 
-	err := h.cache.TDigestMerge(destKey, sourceKeys, weights)
+	err = h.cache.TDigestMerge(destKey, sourceKeys, compression, override)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
@@ -148,7 +167,7 @@ func (h *TDigestHandlers) HandleTDigestQuantile(args []models.Value) models.Valu
 
 	response := make([]models.Value, len(results))
 	for i, val := range results {
-		response[i] = models.Value{Type: "bulk", Bulk: strconv.FormatFloat(val, 'f', -1, 64)}
+		response[i] = models.Value{Type: "bulk", Bulk: formatTDigestFloat(val)}
 	}
 
 	return models.Value{Type: "array", Array: response}
@@ -166,7 +185,7 @@ func (h *TDigestHandlers) HandleTDigestMin(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	return models.Value{Type: "bulk", Bulk: strconv.FormatFloat(min, 'f', -1, 64)}
+	return models.Value{Type: "bulk", Bulk: formatTDigestFloat(min)}
 }
 
 // HandleTDigestMax handles TDIGEST.MAX command
@@ -181,7 +200,7 @@ func (h *TDigestHandlers) HandleTDigestMax(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	return models.Value{Type: "bulk", Bulk: strconv.FormatFloat(max, 'f', -1, 64)}
+	return models.Value{Type: "bulk", Bulk: formatTDigestFloat(max)}
 }
 
 // HandleTDigestInfo handles TDIGEST.INFO command
@@ -202,11 +221,19 @@ func (h *TDigestHandlers) HandleTDigestInfo(args []models.Value) models.Value {
 		{Type: "bulk", Bulk: "Count"},
 		{Type: "bulk", Bulk: strconv.FormatFloat(info["count"].(float64), 'f', -1, 64)},
 		{Type: "bulk", Bulk: "Min"},
-		{Type: "bulk", Bulk: strconv.FormatFloat(info["min"].(float64), 'f', -1, 64)},
+		{Type: "bulk", Bulk: formatTDigestFloat(info["min"].(float64))},
 		{Type: "bulk", Bulk: "Max"},
-		{Type: "bulk", Bulk: strconv.FormatFloat(info["max"].(float64), 'f', -1, 64)},
+		{Type: "bulk", Bulk: formatTDigestFloat(info["max"].(float64))},
 		{Type: "bulk", Bulk: "Centroids"},
 		{Type: "integer", Num: info["num_centroids"].(int)},
+		{Type: "bulk", Bulk: "Capacity"},
+		{Type: "integer", Num: info["capacity"].(int)},
+		{Type: "bulk", Bulk: "Merged nodes"},
+		{Type: "integer", Num: info["merged_nodes"].(int)},
+		{Type: "bulk", Bulk: "Unmerged nodes"},
+		{Type: "integer", Num: info["unmerged_nodes"].(int)},
+		{Type: "bulk", Bulk: "Total compressions"},
+		{Type: "integer", Num: int(info["total_compressions"].(int64))},
 		{Type: "bulk", Bulk: "Memory"},
 		{Type: "integer", Num: int(info["memory_usage"].(int64))},
 	}
@@ -238,7 +265,7 @@ func (h *TDigestHandlers) HandleTDigestCDF(args []models.Value) models.Value {
 
 	response := make([]models.Value, len(results))
 	for i, val := range results {
-		response[i] = models.Value{Type: "bulk", Bulk: strconv.FormatFloat(val, 'f', -1, 64)}
+		response[i] = models.Value{Type: "bulk", Bulk: formatTDigestFloat(val)}
 	}
 
 	return models.Value{Type: "array", Array: response}
@@ -266,5 +293,91 @@ func (h *TDigestHandlers) HandleTDigestTrimmedMean(args []models.Value) models.V
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	return models.Value{Type: "bulk", Bulk: strconv.FormatFloat(mean, 'f', -1, 64)}
+	return models.Value{Type: "bulk", Bulk: formatTDigestFloat(mean)}
+}
+
+// HandleTDigestRank handles TDIGEST.RANK command
+func (h *TDigestHandlers) HandleTDigestRank(args []models.Value) models.Value {
+	return h.handleRank(args, "TDIGEST.RANK", h.cache.TDigestRank)
+}
+
+// HandleTDigestRevRank handles TDIGEST.REVRANK command
+func (h *TDigestHandlers) HandleTDigestRevRank(args []models.Value) models.Value {
+	return h.handleRank(args, "TDIGEST.REVRANK", h.cache.TDigestRevRank)
+}
+
+// HandleTDigestByRank handles TDIGEST.BYRANK command
+func (h *TDigestHandlers) HandleTDigestByRank(args []models.Value) models.Value {
+	return h.handleByRank(args, "TDIGEST.BYRANK", h.cache.TDigestByRank)
+}
+
+// HandleTDigestByRevRank handles TDIGEST.BYREVRANK command
+func (h *TDigestHandlers) HandleTDigestByRevRank(args []models.Value) models.Value {
+	return h.handleByRank(args, "TDIGEST.BYREVRANK", h.cache.TDigestByRevRank)
+}
+
+func (h *TDigestHandlers) handleRank(args []models.Value, cmd string, rank func(string, ...float64) ([]int64, error)) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for '" + cmd + "'"}
+	}
+
+	values := make([]float64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		val, err := strconv.ParseFloat(arg.Bulk, 64)
+		if err != nil {
+			return models.Value{Type: "error", Str: "ERR invalid value"}
+		}
+		values = append(values, val)
+	}
+
+	results, err := rank(args[0].Bulk, values...)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	response := make([]models.Value, len(results))
+	for i, r := range results {
+		response[i] = models.Value{Type: "integer", Num: int(r)}
+	}
+	return models.Value{Type: "array", Array: response}
+}
+
+func (h *TDigestHandlers) handleByRank(args []models.Value, cmd string, byRank func(string, ...int64) ([]float64, error)) models.Value {
+	if len(args) < 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for '" + cmd + "'"}
+	}
+
+	ranks := make([]int64, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		r, err := strconv.ParseInt(arg.Bulk, 10, 64)
+		if err != nil || r < 0 {
+			return models.Value{Type: "error", Str: "ERR invalid rank"}
+		}
+		ranks = append(ranks, r)
+	}
+
+	results, err := byRank(args[0].Bulk, ranks...)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	response := make([]models.Value, len(results))
+	for i, val := range results {
+		response[i] = models.Value{Type: "bulk", Bulk: formatTDigestFloat(val)}
+	}
+	return models.Value{Type: "array", Array: response}
+}
+
+// formatTDigestFloat formats a t-digest estimate, spelling infinities and
+// the result of an empty sketch the way RedisBloom does.
+func formatTDigestFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
 }
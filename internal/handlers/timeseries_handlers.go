@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
@@ -16,25 +20,114 @@ func NewTimeSeriesHandlers(cache ports.Cache) *TimeSeriesHandlers {
 	return &TimeSeriesHandlers{cache: cache}
 }
 
-func parseLabels(args []models.Value) map[string]string {
-	labels := make(map[string]string)
+// tsOptions holds the options given to TS.CREATE, TS.ADD or TS.ALTER; nil
+// fields and empty strings were not given.
+type tsOptions struct {
+	retention       *int64
+	encoding        string
+	chunkSize       *int
+	duplicatePolicy string
+	onDuplicate     string
+	labels          map[string]string
+}
+
+// parseTSOptions parses the options following the key of a time series
+// command. ON_DUPLICATE is only accepted if onDuplicate is set.
+func parseTSOptions(args []models.Value, onDuplicate bool) (*tsOptions, error) {
+	opts := &tsOptions{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i].Bulk)
+		if option == "LABELS" {
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, fmt.Errorf("ERR TSDB: wrong number of arguments for LABELS")
+			}
+			opts.labels = make(map[string]string, len(rest)/2)
+			for j := 0; j < len(rest); j += 2 {
+				opts.labels[rest[j].Bulk] = rest[j+1].Bulk
+			}
+			return opts, nil
+		}
 
-	for i := 0; i < len(args); i += 2 {
-		if i+1 < len(args) {
-			key := args[i].Str
-			value := args[i+1].Str
-			labels[key] = value
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("ERR syntax error")
+		}
+		i++
+		value := args[i].Bulk
+
+		switch {
+		case option == "RETENTION":
+			retention, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || retention < 0 {
+				return nil, fmt.Errorf("ERR TSDB: invalid RETENTION value")
+			}
+			opts.retention = &retention
+		case option == "ENCODING":
+			switch encoding := strings.ToUpper(value); encoding {
+			case models.TimeSeriesEncodingCompressed, models.TimeSeriesEncodingUncompressed:
+				opts.encoding = encoding
+			default:
+				return nil, fmt.Errorf("ERR TSDB: unknown ENCODING parameter")
+			}
+		case option == "CHUNK_SIZE":
+			chunkSize, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("ERR TSDB: invalid CHUNK_SIZE value")
+			}
+			if err := models.ValidateChunkSize(chunkSize); err != nil {
+				return nil, err
+			}
+			opts.chunkSize = &chunkSize
+		case option == "DUPLICATE_POLICY", option == "ON_DUPLICATE" && onDuplicate:
+			policy, err := models.ParseDuplicatePolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			if option == "ON_DUPLICATE" {
+				opts.onDuplicate = policy
+			} else {
+				opts.duplicatePolicy = policy
+			}
+		default:
+			return nil, fmt.Errorf("ERR syntax error")
 		}
 	}
+	return opts, nil
+}
 
-	return labels
+// create returns the options of a series created with o
+func (o *tsOptions) create() models.TimeSeriesOptions {
+	opts := models.DefaultTimeSeriesOptions()
+	if o.retention != nil {
+		opts.Retention = *o.retention
+	}
+	if o.encoding != "" {
+		opts.Encoding = o.encoding
+	}
+	if o.chunkSize != nil {
+		opts.ChunkSize = *o.chunkSize
+	}
+	if o.duplicatePolicy != "" {
+		opts.DuplicatePolicy = o.duplicatePolicy
+	}
+	if o.labels != nil {
+		opts.Labels = o.labels
+	}
+	return opts
 }
 
 // TS.CREATE Handler
 func (h *TimeSeriesHandlers) HandleTSCreate(args []models.Value) models.Value {
-	key := args[0].Str
-	labels := parseLabels(args[1:])
-	if err := h.cache.TSCreate(key, labels); err != nil {
+	if len(args) < 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.create' command"}
+	}
+
+	key := args[0].Bulk
+	opts, err := parseTSOptions(args[1:], false)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	if err := h.cache.TSCreate(key, opts.create()); err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 	return models.Value{Type: "string", Str: "OK"}
@@ -42,23 +135,45 @@ func (h *TimeSeriesHandlers) HandleTSCreate(args []models.Value) models.Value {
 
 // TS.ADD Handler
 func (h *TimeSeriesHandlers) HandleTSAdd(args []models.Value) models.Value {
-	key := args[0].Str
-	timestamp, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	value, _ := strconv.ParseFloat(args[2].Str, 64)
+	if len(args) < 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.add' command"}
+	}
+
+	key := args[0].Bulk
+	var timestamp int64
+	if args[1].Bulk == "*" {
+		timestamp = time.Now().UnixMilli()
+	} else {
+		var err error
+		timestamp, err = strconv.ParseInt(args[1].Bulk, 10, 64)
+		if err != nil || timestamp < 0 {
+			return models.Value{Type: "error", Str: "ERR TSDB: invalid timestamp"}
+		}
+	}
+	value, err := strconv.ParseFloat(args[2].Bulk, 64)
+	if err != nil {
+		return models.Value{Type: "error", Str: "ERR TSDB: invalid value"}
+	}
 
-	if err := h.cache.TSAdd(key, timestamp, value); err != nil {
+	opts, err := parseTSOptions(args[3:], true)
+	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-	return models.Value{Type: "string", Str: "OK"}
+
+	added, err := h.cache.TSAdd(key, timestamp, value, opts.create(), opts.onDuplicate)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	return models.Value{Type: "integer", Num: int(added)}
 }
 
 // TS.MADD Handler
 func (h *TimeSeriesHandlers) HandleTSMAdd(args []models.Value) models.Value {
 	entries := make(map[string][]models.TimeSeriesSample)
 	for i := 0; i < len(args); i += 3 {
-		key := args[i].Str
-		timestamp, _ := strconv.ParseInt(args[i+1].Str, 10, 64)
-		value, _ := strconv.ParseFloat(args[i+2].Str, 64)
+		key := args[i].Bulk
+		timestamp, _ := strconv.ParseInt(args[i+1].Bulk, 10, 64)
+		value, _ := strconv.ParseFloat(args[i+2].Bulk, 64)
 		entries[key] = append(entries[key], models.TimeSeriesSample{Timestamp: timestamp, Value: value})
 	}
 
@@ -70,15 +185,169 @@ func (h *TimeSeriesHandlers) HandleTSMAdd(args []models.Value) models.Value {
 
 // TS.RANGE Handler
 func (h *TimeSeriesHandlers) HandleTSRange(args []models.Value) models.Value {
-	key := args[0].Str
-	from, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	to, _ := strconv.ParseInt(args[2].Str, 10, 64)
+	return h.handleRange(args, false)
+}
+
+func (h *TimeSeriesHandlers) handleRange(args []models.Value, reverse bool) models.Value {
+	if len(args) < 3 {
+		cmd := "ts.range"
+		if reverse {
+			cmd = "ts.revrange"
+		}
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd)}
+	}
 
-	samples, err := h.cache.TSRange(key, from, to)
+	key := args[0].Bulk
+	from, to, err := parseTSRangeBounds(args[1].Bulk, args[2].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
+	opts, err := parseTSRangeOptions(args[3:], from, to)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	var samples []models.TimeSeriesSample
+	if reverse {
+		samples, err = h.cache.TSRevRange(key, from, to, opts)
+	} else {
+		samples, err = h.cache.TSRange(key, from, to, opts)
+	}
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	return samplesToValue(samples)
+}
 
+// parseTSRangeBounds parses the from and to arguments of a range, where "-"
+// and "+" stand for the oldest and newest samples.
+func parseTSRangeBounds(fromArg, toArg string) (int64, int64, error) {
+	from, to := int64(0), int64(math.MaxInt64)
+	var err error
+	if fromArg != "-" {
+		if from, err = strconv.ParseInt(fromArg, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("ERR TSDB: invalid fromTimestamp")
+		}
+	}
+	if toArg != "+" {
+		if to, err = strconv.ParseInt(toArg, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("ERR TSDB: invalid toTimestamp")
+		}
+	}
+	return from, to, nil
+}
+
+// parseTSRangeOptions parses the options of TS.RANGE and TS.REVRANGE
+// following the range [from, to].
+func parseTSRangeOptions(args []models.Value, from, to int64) (models.TimeSeriesRangeOptions, error) {
+	var opts models.TimeSeriesRangeOptions
+	var align string
+	var bucketTimestamp string
+	empty := false
+
+	for i := 0; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i].Bulk); option {
+		case "LATEST":
+			opts.Latest = true
+		case "EMPTY":
+			empty = true
+		case "FILTER_BY_TS":
+			for i+1 < len(args) {
+				timestamp, err := strconv.ParseInt(args[i+1].Bulk, 10, 64)
+				if err != nil {
+					break
+				}
+				opts.FilterByTS = append(opts.FilterByTS, timestamp)
+				i++
+			}
+			if len(opts.FilterByTS) == 0 {
+				return opts, fmt.Errorf("ERR TSDB: FILTER_BY_TS one or more arguments are missing")
+			}
+		case "FILTER_BY_VALUE":
+			if i+2 >= len(args) {
+				return opts, fmt.Errorf("ERR TSDB: FILTER_BY_VALUE one or more arguments are missing")
+			}
+			minValue, err1 := strconv.ParseFloat(args[i+1].Bulk, 64)
+			maxValue, err2 := strconv.ParseFloat(args[i+2].Bulk, 64)
+			if err1 != nil || err2 != nil {
+				return opts, fmt.Errorf("ERR TSDB: cannot parse value filter")
+			}
+			opts.FilterByValue = &[2]float64{minValue, maxValue}
+			i += 2
+		case "COUNT":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("ERR TSDB: COUNT argument is missing")
+			}
+			count, err := strconv.Atoi(args[i+1].Bulk)
+			if err != nil || count <= 0 {
+				return opts, fmt.Errorf("ERR TSDB: Couldn't parse COUNT")
+			}
+			opts.Count = count
+			i++
+		case "ALIGN":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("ERR TSDB: ALIGN argument is missing")
+			}
+			align = args[i+1].Bulk
+			i++
+		case "BUCKETTIMESTAMP":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("ERR TSDB: BUCKETTIMESTAMP argument is missing")
+			}
+			bt, err := models.ParseBucketTimestamp(args[i+1].Bulk)
+			if err != nil {
+				return opts, err
+			}
+			bucketTimestamp = bt
+			i++
+		case "AGGREGATION":
+			if i+2 >= len(args) {
+				return opts, fmt.Errorf("ERR TSDB: missing aggregation arguments")
+			}
+			agg, err := models.ParseTimeSeriesAggregator(args[i+1].Bulk)
+			if err != nil {
+				return opts, err
+			}
+			duration, err := strconv.ParseInt(args[i+2].Bulk, 10, 64)
+			if err != nil || duration <= 0 {
+				return opts, fmt.Errorf("ERR TSDB: bucketDuration must be greater than zero")
+			}
+			opts.Aggregation = &models.TimeSeriesAggregation{Type: agg, BucketDuration: duration}
+			i += 2
+		default:
+			return opts, fmt.Errorf("ERR TSDB: unknown argument '%s'", args[i].Bulk)
+		}
+	}
+
+	if opts.Aggregation == nil {
+		if align != "" || bucketTimestamp != "" || empty {
+			return opts, fmt.Errorf("ERR TSDB: ALIGN, BUCKETTIMESTAMP and EMPTY require AGGREGATION")
+		}
+		return opts, nil
+	}
+
+	opts.Aggregation.BucketTimestamp = bucketTimestamp
+	if opts.Aggregation.BucketTimestamp == "" {
+		opts.Aggregation.BucketTimestamp = models.BucketTimestampStart
+	}
+	opts.Aggregation.Empty = empty
+	switch strings.ToLower(align) {
+	case "":
+	case "-", "start":
+		opts.Aggregation.Align = from
+	case "+", "end":
+		opts.Aggregation.Align = to
+	default:
+		alignTimestamp, err := strconv.ParseInt(align, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("ERR TSDB: unknown ALIGN parameter")
+		}
+		opts.Aggregation.Align = alignTimestamp
+	}
+	return opts, nil
+}
+
+func samplesToValue(samples []models.TimeSeriesSample) models.Value {
 	result := make([]models.Value, len(samples))
 	for i, sample := range samples {
 		result[i] = models.Value{Type: "array", Array: []models.Value{
@@ -91,29 +360,105 @@ func (h *TimeSeriesHandlers) HandleTSRange(args []models.Value) models.Value {
 
 // TS.INFO Handler
 func (h *TimeSeriesHandlers) HandleTSInfo(args []models.Value) models.Value {
-	key := args[0].Str
+	if len(args) < 1 || len(args) > 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.info' command"}
+	}
+
+	key := args[0].Bulk
+	debug := false
+	if len(args) == 2 {
+		if !strings.EqualFold(args[1].Bulk, "DEBUG") {
+			return models.Value{Type: "error", Str: "ERR syntax error"}
+		}
+		debug = true
+	}
 
-	stats, err := h.cache.TSInfo(key)
+	info, err := h.cache.TSInfo(key, debug)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	return models.Value{Type: "array", Array: []models.Value{
-		{Type: "string", Str: "total_samples"},
-		{Type: "integer", Num: stats.TotalSamples},
-		{Type: "string", Str: "max_value"},
-		{Type: "double", Double: stats.MaxValue},
-		{Type: "string", Str: "min_value"},
-		{Type: "double", Double: stats.MinValue},
-		{Type: "string", Str: "avg_value"},
-		{Type: "double", Double: stats.AvgValue},
-	}}
+	labelNames := make([]string, 0, len(info.Labels))
+	for name := range info.Labels {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+	labels := make([]models.Value, 0, len(labelNames))
+	for _, name := range labelNames {
+		labels = append(labels, labelPair(name, info.Labels[name]))
+	}
+
+	rules := make([]models.Value, 0, len(info.Rules))
+	for _, rule := range info.Rules {
+		rules = append(rules, models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: rule.DestinationKey},
+			{Type: "integer", Num: int(rule.BucketSize)},
+			{Type: "bulk", Bulk: strings.ToUpper(rule.AggregationType)},
+			{Type: "integer", Num: int(rule.AlignTimestamp)},
+		}})
+	}
+
+	sourceKey := models.Value{Type: "null"}
+	if info.SourceKey != "" {
+		sourceKey = models.Value{Type: "bulk", Bulk: info.SourceKey}
+	}
+
+	result := []models.Value{
+		{Type: "bulk", Bulk: "totalSamples"},
+		{Type: "integer", Num: info.TotalSamples},
+		{Type: "bulk", Bulk: "memoryUsage"},
+		{Type: "integer", Num: int(info.MemoryUsage)},
+		{Type: "bulk", Bulk: "firstTimestamp"},
+		{Type: "integer", Num: int(info.FirstTimestamp)},
+		{Type: "bulk", Bulk: "lastTimestamp"},
+		{Type: "integer", Num: int(info.LastTimestamp)},
+		{Type: "bulk", Bulk: "retentionTime"},
+		{Type: "integer", Num: int(info.RetentionTime)},
+		{Type: "bulk", Bulk: "chunkCount"},
+		{Type: "integer", Num: info.ChunkCount},
+		{Type: "bulk", Bulk: "chunkSize"},
+		{Type: "integer", Num: info.ChunkSize},
+		{Type: "bulk", Bulk: "chunkType"},
+		{Type: "bulk", Bulk: info.ChunkType},
+		{Type: "bulk", Bulk: "duplicatePolicy"},
+		{Type: "bulk", Bulk: strings.ToLower(info.DuplicatePolicy)},
+		{Type: "bulk", Bulk: "labels"},
+		{Type: "array", Array: labels},
+		{Type: "bulk", Bulk: "sourceKey"},
+		sourceKey,
+		{Type: "bulk", Bulk: "rules"},
+		{Type: "array", Array: rules},
+	}
+
+	if debug {
+		chunks := make([]models.Value, 0, len(info.Chunks))
+		for _, chunk := range info.Chunks {
+			chunks = append(chunks, models.Value{Type: "array", Array: []models.Value{
+				{Type: "bulk", Bulk: "startTimestamp"},
+				{Type: "integer", Num: int(chunk.StartTimestamp)},
+				{Type: "bulk", Bulk: "endTimestamp"},
+				{Type: "integer", Num: int(chunk.EndTimestamp)},
+				{Type: "bulk", Bulk: "samples"},
+				{Type: "integer", Num: chunk.Samples},
+				{Type: "bulk", Bulk: "size"},
+				{Type: "integer", Num: chunk.Size},
+				{Type: "bulk", Bulk: "bytesPerSample"},
+				{Type: "bulk", Bulk: strconv.FormatFloat(chunk.BytesPerSample, 'f', -1, 64)},
+			}})
+		}
+		result = append(result,
+			models.Value{Type: "bulk", Bulk: "Chunks"},
+			models.Value{Type: "array", Array: chunks},
+		)
+	}
+
+	return models.Value{Type: "array", Array: result}
 }
 
 // TS.INCRBY Handler
 func (h *TimeSeriesHandlers) HandleTSIncrBy(args []models.Value) models.Value {
-	key := args[0].Str
-	increment, _ := strconv.ParseFloat(args[1].Str, 64)
+	key := args[0].Bulk
+	increment, _ := strconv.ParseFloat(args[1].Bulk, 64)
 
 	if err := h.cache.TSIncrBy(key, increment); err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
@@ -123,8 +468,8 @@ func (h *TimeSeriesHandlers) HandleTSIncrBy(args []models.Value) models.Value {
 
 // TS.DECRBY Handler
 func (h *TimeSeriesHandlers) HandleTSDecrBy(args []models.Value) models.Value {
-	key := args[0].Str
-	decrement, _ := strconv.ParseFloat(args[1].Str, 64)
+	key := args[0].Bulk
+	decrement, _ := strconv.ParseFloat(args[1].Bulk, 64)
 
 	if err := h.cache.TSDecrBy(key, decrement); err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
@@ -134,9 +479,9 @@ func (h *TimeSeriesHandlers) HandleTSDecrBy(args []models.Value) models.Value {
 
 // TS.DEL Handler
 func (h *TimeSeriesHandlers) HandleTSDel(args []models.Value) models.Value {
-	key := args[0].Str
-	from, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	to, _ := strconv.ParseInt(args[2].Str, 10, 64)
+	key := args[0].Bulk
+	from, _ := strconv.ParseInt(args[1].Bulk, 10, 64)
+	to, _ := strconv.ParseInt(args[2].Bulk, 10, 64)
 
 	count, err := h.cache.TSDel(key, from, to)
 	if err != nil {
@@ -146,10 +491,23 @@ func (h *TimeSeriesHandlers) HandleTSDel(args []models.Value) models.Value {
 }
 
 func (h *TimeSeriesHandlers) HandleTSAlter(args []models.Value) models.Value {
-	key := args[0].Str
-	labels := parseLabels(args[1:])
+	if len(args) < 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.alter' command"}
+	}
 
-	err := h.cache.TSAlter(key, labels)
+	key := args[0].Bulk
+	opts, err := parseTSOptions(args[1:], false)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+
+	err = h.cache.TSAlter(key, models.TimeSeriesAlterOptions{
+		Retention:       opts.retention,
+		Encoding:        opts.encoding,
+		ChunkSize:       opts.chunkSize,
+		DuplicatePolicy: opts.duplicatePolicy,
+		Labels:          opts.labels,
+	})
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
@@ -157,15 +515,38 @@ func (h *TimeSeriesHandlers) HandleTSAlter(args []models.Value) models.Value {
 }
 
 func (h *TimeSeriesHandlers) HandleTSCreateRule(args []models.Value) models.Value {
-	sourceKey := args[0].Str
-	destKey := args[1].Str
-	aggregationType := args[2].Str
-	bucketSize, err := strconv.ParseInt(args[3].Str, 10, 64)
+	if len(args) < 4 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.createrule' command"}
+	}
+
+	sourceKey := args[0].Bulk
+	destKey := args[1].Bulk
+	// The AGGREGATION keyword used to be left out
+	rest := args[2:]
+	if strings.EqualFold(rest[0].Bulk, "AGGREGATION") {
+		rest = rest[1:]
+	}
+	if len(rest) < 2 || len(rest) > 3 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.createrule' command"}
+	}
+
+	aggregationType, err := models.ParseTimeSeriesAggregator(rest[0].Bulk)
 	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	bucketSize, err := strconv.ParseInt(rest[1].Bulk, 10, 64)
+	if err != nil || bucketSize <= 0 {
 		return models.Value{Type: "error", Str: "ERR invalid bucket size"}
 	}
+	var alignTimestamp int64
+	if len(rest) == 3 {
+		alignTimestamp, err = strconv.ParseInt(rest[2].Bulk, 10, 64)
+		if err != nil {
+			return models.Value{Type: "error", Str: "ERR TSDB: invalid alignTimestamp"}
+		}
+	}
 
-	err = h.cache.TSCreateRule(sourceKey, destKey, aggregationType, bucketSize)
+	err = h.cache.TSCreateRule(sourceKey, destKey, aggregationType, bucketSize, alignTimestamp)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
@@ -173,7 +554,7 @@ func (h *TimeSeriesHandlers) HandleTSCreateRule(args []models.Value) models.Valu
 }
 
 func (h *TimeSeriesHandlers) HandleTSGet(args []models.Value) models.Value {
-	key := args[0].Str
+	key := args[0].Bulk
 
 	sample, err := h.cache.TSGet(key)
 	if err != nil {
@@ -187,136 +568,231 @@ func (h *TimeSeriesHandlers) HandleTSGet(args []models.Value) models.Value {
 }
 
 func (h *TimeSeriesHandlers) HandleTSMGet(args []models.Value) models.Value {
-	filters := make(map[string]string)
-
-	for _, arg := range args {
-		keyValue := strings.SplitN(arg.Str, "=", 2)
-		if len(keyValue) == 2 {
-			filters[keyValue[0]] = keyValue[1]
+	query, err := parseTSMultiQuery(args)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
+	}
+	latest := false
+	for _, arg := range query.rest {
+		if !strings.EqualFold(arg.Bulk, "LATEST") {
+			return models.Value{Type: "error", Str: fmt.Sprintf("ERR TSDB: unknown argument '%s'", arg.Bulk)}
 		}
+		latest = true
+	}
+	if query.groupBy != "" {
+		return models.Value{Type: "error", Str: "ERR TSDB: GROUPBY is not supported by TS.MGET"}
 	}
 
-	results, err := h.cache.TSMGet(filters)
+	results, err := h.cache.TSMGet(query.filters, latest)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	resultArray := []models.Value{}
-	for key, sample := range results {
-		resultArray = append(resultArray, models.Value{Type: "array", Array: []models.Value{
-			{Type: "string", Str: key},
-			{Type: "integer", Num: int(sample.Timestamp)},
-			{Type: "double", Double: sample.Value},
-		}})
+	resultArray := make([]models.Value, len(results))
+	for i, result := range results {
+		sample := []models.Value{}
+		if len(result.Samples) > 0 {
+			sample = []models.Value{
+				{Type: "integer", Num: int(result.Samples[0].Timestamp)},
+				{Type: "double", Double: result.Samples[0].Value},
+			}
+		}
+		resultArray[i] = models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: result.Key},
+			query.labelsValue(result.Labels),
+			{Type: "array", Array: sample},
+		}}
 	}
-
 	return models.Value{Type: "array", Array: resultArray}
 }
 
 func (h *TimeSeriesHandlers) HandleTSMRange(args []models.Value) models.Value {
-	from, _ := strconv.ParseInt(args[0].Str, 10, 64)
-	to, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	filters := make(map[string]string)
-
-	// Filtreleri ayıkla
-	for _, arg := range args[2:] {
-		keyValue := strings.SplitN(arg.Str, "=", 2)
-		if len(keyValue) == 2 {
-			filters[keyValue[0]] = keyValue[1]
+	return h.handleMultiRange(args, false)
+}
+
+func (h *TimeSeriesHandlers) HandleTSMRevRange(args []models.Value) models.Value {
+	return h.handleMultiRange(args, true)
+}
+
+func (h *TimeSeriesHandlers) handleMultiRange(args []models.Value, reverse bool) models.Value {
+	if len(args) < 4 {
+		cmd := "ts.mrange"
+		if reverse {
+			cmd = "ts.mrevrange"
 		}
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd)}
 	}
 
-	results, err := h.cache.TSMRange(filters, from, to)
+	from, to, err := parseTSRangeBounds(args[0].Bulk, args[1].Bulk)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	// Sonuçları dönüştür
-	resultArray := []models.Value{}
-	for key, samples := range results {
-		sampleArray := []models.Value{}
-		for _, sample := range samples {
-			sampleArray = append(sampleArray, models.Value{Type: "array", Array: []models.Value{
-				{Type: "integer", Num: int(sample.Timestamp)},
-				{Type: "double", Double: sample.Value},
-			}})
-		}
-		resultArray = append(resultArray, models.Value{Type: "array", Array: []models.Value{
-			{Type: "string", Str: key},
-			{Type: "array", Array: sampleArray},
-		}})
+	query, err := parseTSMultiQuery(args[2:])
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
-
-	return models.Value{Type: "array", Array: resultArray}
-}
-
-func (h *TimeSeriesHandlers) HandleTSMRevRange(args []models.Value) models.Value {
-	from, _ := strconv.ParseInt(args[0].Str, 10, 64)
-	to, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	filters := make(map[string]string)
-
-	// Filtreleri ayıkla
-	for _, arg := range args[2:] {
-		keyValue := strings.SplitN(arg.Str, "=", 2)
-		if len(keyValue) == 2 {
-			filters[keyValue[0]] = keyValue[1]
-		}
+	opts, err := parseTSRangeOptions(query.rest, from, to)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	results, err := h.cache.TSMRevRange(filters, from, to)
+	var results []models.TimeSeriesResult
+	if reverse {
+		results, err = h.cache.TSMRevRange(query.filters, from, to, opts)
+	} else {
+		results, err = h.cache.TSMRange(query.filters, from, to, opts)
+	}
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	// Sonuçları dönüştür
-	resultArray := []models.Value{}
-	for key, samples := range results {
-		sampleArray := []models.Value{}
-		for _, sample := range samples {
-			sampleArray = append(sampleArray, models.Value{Type: "array", Array: []models.Value{
-				{Type: "integer", Num: int(sample.Timestamp)},
-				{Type: "double", Double: sample.Value},
-			}})
+	if query.groupBy != "" {
+		groups := models.GroupTimeSeries(results, query.groupBy, query.reducer, reverse)
+		resultArray := make([]models.Value, len(groups))
+		for i, group := range groups {
+			resultArray[i] = models.Value{Type: "array", Array: []models.Value{
+				{Type: "bulk", Bulk: group.Label + "=" + group.Value},
+				{Type: "array", Array: []models.Value{
+					labelPair(group.Label, group.Value),
+					labelPair("__reducer__", group.Reducer),
+					labelPair("__source__", strings.Join(group.Sources, ",")),
+				}},
+				samplesToValue(group.Samples),
+			}}
 		}
-		resultArray = append(resultArray, models.Value{Type: "array", Array: []models.Value{
-			{Type: "string", Str: key},
-			{Type: "array", Array: sampleArray},
-		}})
+		return models.Value{Type: "array", Array: resultArray}
 	}
 
+	resultArray := make([]models.Value, len(results))
+	for i, result := range results {
+		resultArray[i] = models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: result.Key},
+			query.labelsValue(result.Labels),
+			samplesToValue(result.Samples),
+		}}
+	}
 	return models.Value{Type: "array", Array: resultArray}
 }
 
-func (h *TimeSeriesHandlers) HandleTSRevRange(args []models.Value) models.Value {
-	key := args[0].Str
-	from, _ := strconv.ParseInt(args[1].Str, 10, 64)
-	to, _ := strconv.ParseInt(args[2].Str, 10, 64)
+// tsMultiQuery holds the arguments of TS.MGET, TS.MRANGE and TS.MREVRANGE
+// choosing series and their labels; rest are the other arguments.
+type tsMultiQuery struct {
+	filters        []models.TimeSeriesFilter
+	withLabels     bool
+	selectedLabels []string
+	groupBy        string
+	reducer        string
+	rest           []models.Value
+}
 
-	samples, err := h.cache.TSRevRange(key, from, to)
+// tsQueryKeywords end the label list of SELECTED_LABELS
+var tsQueryKeywords = map[string]bool{
+	"LATEST": true, "FILTER_BY_TS": true, "FILTER_BY_VALUE": true, "COUNT": true,
+	"ALIGN": true, "AGGREGATION": true, "BUCKETTIMESTAMP": true, "EMPTY": true,
+	"WITHLABELS": true, "SELECTED_LABELS": true, "FILTER": true, "GROUPBY": true,
+}
+
+func parseTSMultiQuery(args []models.Value) (*tsMultiQuery, error) {
+	query := &tsMultiQuery{}
+	var exprs []string
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "WITHLABELS":
+			query.withLabels = true
+		case "SELECTED_LABELS":
+			for i+1 < len(args) && !tsQueryKeywords[strings.ToUpper(args[i+1].Bulk)] {
+				query.selectedLabels = append(query.selectedLabels, args[i+1].Bulk)
+				i++
+			}
+			if len(query.selectedLabels) == 0 {
+				return nil, fmt.Errorf("ERR TSDB: SELECTED_LABELS requires at least one label")
+			}
+		case "FILTER":
+			for i+1 < len(args) && !strings.EqualFold(args[i+1].Bulk, "GROUPBY") {
+				exprs = append(exprs, args[i+1].Bulk)
+				i++
+			}
+		case "GROUPBY":
+			if i+3 >= len(args) || !strings.EqualFold(args[i+2].Bulk, "REDUCE") {
+				return nil, fmt.Errorf("ERR TSDB: GROUPBY requires a label and REDUCE reducer")
+			}
+			reducer, err := models.ParseTimeSeriesReducer(args[i+3].Bulk)
+			if err != nil {
+				return nil, err
+			}
+			query.groupBy, query.reducer = args[i+1].Bulk, reducer
+			i += 3
+		default:
+			query.rest = append(query.rest, args[i])
+		}
+	}
+
+	if query.withLabels && len(query.selectedLabels) > 0 {
+		return nil, fmt.Errorf("ERR TSDB: cannot accept WITHLABELS and SELECT_LABELS together")
+	}
+	if len(exprs) == 0 {
+		return nil, fmt.Errorf("ERR TSDB: missing FILTER argument")
+	}
+	filters, err := models.ParseTimeSeriesFilters(exprs)
 	if err != nil {
-		return models.Value{Type: "error", Str: err.Error()}
+		return nil, err
 	}
+	query.filters = filters
+	return query, nil
+}
 
-	resultArray := make([]models.Value, len(samples))
-	for i, sample := range samples {
-		resultArray[i] = models.Value{Type: "array", Array: []models.Value{
-			{Type: "integer", Num: int(sample.Timestamp)},
-			{Type: "double", Double: sample.Value},
-		}}
+// labelsValue returns the labels of a series to report, all of them with
+// WITHLABELS, the selected ones with SELECTED_LABELS and none otherwise
+func (q *tsMultiQuery) labelsValue(labels map[string]string) models.Value {
+	pairs := []models.Value{}
+	switch {
+	case q.withLabels:
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pairs = append(pairs, labelPair(name, labels[name]))
+		}
+	case len(q.selectedLabels) > 0:
+		for _, name := range q.selectedLabels {
+			if value, ok := labels[name]; ok {
+				pairs = append(pairs, labelPair(name, value))
+			} else {
+				pairs = append(pairs, models.Value{Type: "array", Array: []models.Value{
+					{Type: "bulk", Bulk: name},
+					{Type: "null"},
+				}})
+			}
+		}
 	}
+	return models.Value{Type: "array", Array: pairs}
+}
 
-	return models.Value{Type: "array", Array: resultArray}
+func labelPair(name, value string) models.Value {
+	return models.Value{Type: "array", Array: []models.Value{
+		{Type: "bulk", Bulk: name},
+		{Type: "bulk", Bulk: value},
+	}}
+}
+
+func (h *TimeSeriesHandlers) HandleTSRevRange(args []models.Value) models.Value {
+	return h.handleRange(args, true)
 }
 
 func (h *TimeSeriesHandlers) HandleTSQueryIndex(args []models.Value) models.Value {
-	filters := make(map[string]string)
+	if len(args) < 1 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'ts.queryindex' command"}
+	}
 
-	// Filtreleri ayıkla
-	for _, arg := range args {
-		keyValue := strings.SplitN(arg.Str, "=", 2)
-		if len(keyValue) == 2 {
-			filters[keyValue[0]] = keyValue[1]
-		}
+	exprs := make([]string, len(args))
+	for i, arg := range args {
+		exprs[i] = arg.Bulk
+	}
+	filters, err := models.ParseTimeSeriesFilters(exprs)
+	if err != nil {
+		return models.Value{Type: "error", Str: err.Error()}
 	}
 
 	keys, err := h.cache.TSQueryIndex(filters)
@@ -324,17 +800,16 @@ func (h *TimeSeriesHandlers) HandleTSQueryIndex(args []models.Value) models.Valu
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	resultArray := []models.Value{}
-	for _, key := range keys {
-		resultArray = append(resultArray, models.Value{Type: "string", Str: key})
+	resultArray := make([]models.Value, len(keys))
+	for i, key := range keys {
+		resultArray[i] = models.Value{Type: "bulk", Bulk: key}
 	}
-
 	return models.Value{Type: "array", Array: resultArray}
 }
 
 func (h *TimeSeriesHandlers) HandleTSDeleteRule(args []models.Value) models.Value {
-	sourceKey := args[0].Str
-	destinationKey := args[1].Str
+	sourceKey := args[0].Bulk
+	destinationKey := args[1].Bulk
 
 	err := h.cache.TSDeleteRule(sourceKey, destinationKey)
 	if err != nil {
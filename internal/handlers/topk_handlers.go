@@ -1,13 +1,17 @@
 package handlers
 
 import (
-	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
 )
 
+// maxTOPKIncrement bounds TOPK.INCRBY increments; decaying a bucket costs
+// one step per unit of the increment.
+const maxTOPKIncrement = 100000
+
 type TopKHandlers struct {
 	cache ports.Cache
 }
@@ -93,16 +97,7 @@ func (h *TopKHandlers) HandleTOPKAdd(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	response := make([]models.Value, len(results))
-	for i, added := range results {
-		if added {
-			response[i] = models.Value{Type: "integer", Num: 1}
-		} else {
-			response[i] = models.Value{Type: "integer", Num: 0}
-		}
-	}
-
-	return models.Value{Type: "array", Array: response}
+	return expelledItems(results)
 }
 
 // HandleTOPKIncrBy handles TOPK.INCRBY command
@@ -114,26 +109,34 @@ func (h *TopKHandlers) HandleTOPKIncrBy(args []models.Value) models.Value {
 		}
 	}
 
-	itemsWithCount := make(map[string]int64)
+	items := make([]string, 0, len(args)/2)
+	increments := make([]int64, 0, len(args)/2)
 	for i := 1; i < len(args); i += 2 {
 		count, err := strconv.ParseInt(args[i+1].Bulk, 10, 64)
-		if err != nil {
+		if err != nil || count < 1 || count > maxTOPKIncrement {
 			return models.Value{Type: "error", Str: "ERR invalid increment"}
 		}
-		itemsWithCount[args[i].Bulk] = count
+		items = append(items, args[i].Bulk)
+		increments = append(increments, count)
 	}
 
-	results, err := h.cache.TOPKIncrBy(args[0].Bulk, itemsWithCount)
+	results, err := h.cache.TOPKIncrBy(args[0].Bulk, items, increments)
 	if err != nil {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
+	return expelledItems(results)
+}
+
+// expelledItems replies with the item each addition expelled from the top
+// k, or null where nothing was expelled.
+func expelledItems(results []*string) models.Value {
 	response := make([]models.Value, len(results))
-	for i, added := range results {
-		if added {
-			response[i] = models.Value{Type: "integer", Num: 1}
+	for i, expelled := range results {
+		if expelled != nil {
+			response[i] = models.Value{Type: "bulk", Bulk: *expelled}
 		} else {
-			response[i] = models.Value{Type: "integer", Num: 0}
+			response[i] = models.Value{Type: "null"}
 		}
 	}
 
@@ -200,7 +203,8 @@ func (h *TopKHandlers) HandleTOPKCount(args []models.Value) models.Value {
 
 // HandleTOPKList handles TOPK.LIST command
 func (h *TopKHandlers) HandleTOPKList(args []models.Value) models.Value {
-	if len(args) != 1 {
+	withCount := len(args) == 2 && strings.ToUpper(args[1].Bulk) == "WITHCOUNT"
+	if len(args) != 1 && !withCount {
 		return models.Value{
 			Type: "error",
 			Str:  "ERR wrong number of arguments for 'TOPK.LIST' command",
@@ -212,15 +216,12 @@ func (h *TopKHandlers) HandleTOPKList(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	// Return array of arrays, where each inner array contains [item, count]
-	response := make([]models.Value, len(items))
-	for i, item := range items {
-		response[i] = models.Value{
-			Type: "array",
-			Array: []models.Value{
-				{Type: "bulk", Bulk: item.Item},
-				{Type: "integer", Num: int(item.Count)},
-			},
+	// Items highest count first, each followed by its count with WITHCOUNT
+	response := make([]models.Value, 0, len(items)*2)
+	for _, item := range items {
+		response = append(response, models.Value{Type: "bulk", Bulk: item.Item})
+		if withCount {
+			response = append(response, models.Value{Type: "integer", Num: int(item.Count)})
 		}
 	}
 
@@ -241,14 +242,14 @@ func (h *TopKHandlers) HandleTOPKInfo(args []models.Value) models.Value {
 		return models.Value{Type: "error", Str: err.Error()}
 	}
 
-	// Convert info map to array of key-value pairs
-	response := make([]models.Value, 0, len(info)*2)
-	for key, value := range info {
-		response = append(response,
-			models.Value{Type: "bulk", Bulk: key},
-			models.Value{Type: "bulk", Bulk: fmt.Sprintf("%v", value)},
-		)
-	}
-
-	return models.Value{Type: "array", Array: response}
+	return models.Value{Type: "array", Array: []models.Value{
+		{Type: "bulk", Bulk: "k"},
+		{Type: "integer", Num: info["k"].(int)},
+		{Type: "bulk", Bulk: "width"},
+		{Type: "integer", Num: info["width"].(int)},
+		{Type: "bulk", Bulk: "depth"},
+		{Type: "integer", Num: info["depth"].(int)},
+		{Type: "bulk", Bulk: "decay"},
+		{Type: "bulk", Bulk: strconv.FormatFloat(info["decay"].(float64), 'f', -1, 64)},
+	}}
 }
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, used for command
+// and fsync latency histograms.
+var DefaultLatencyBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+// Histogram is a lock-free fixed bucket histogram of durations.
+type Histogram struct {
+	bounds   []float64
+	counts   []uint64 // per bucket, the last slot is +Inf
+	sumNanos int64
+}
+
+// HistogramSnapshot is a consistent-enough copy of a histogram with
+// cumulative bucket counts, ready for exposition.
+type HistogramSnapshot struct {
+	Bounds     []float64
+	Cumulative []uint64 // len(Bounds)+1, the last entry is the +Inf bucket
+	Count      uint64
+	Sum        float64 // seconds
+}
+
+// NewHistogram creates a histogram with the given bucket upper bounds in
+// seconds. The bounds are sorted and an implicit +Inf bucket is added.
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records a single duration.
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	idx := sort.SearchFloat64s(h.bounds, seconds)
+	atomic.AddUint64(&h.counts[idx], 1)
+	atomic.AddInt64(&h.sumNanos, d.Nanoseconds())
+}
+
+// Snapshot returns the cumulative bucket counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		Bounds:     h.bounds,
+		Cumulative: make([]uint64, len(h.counts)),
+	}
+
+	var total uint64
+	for i := range h.counts {
+		total += atomic.LoadUint64(&h.counts[i])
+		snapshot.Cumulative[i] = total
+	}
+	snapshot.Count = total
+	snapshot.Sum = time.Duration(atomic.LoadInt64(&h.sumNanos)).Seconds()
+	return snapshot
+}
+
+// Reset clears every bucket.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sumNanos, 0)
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Latency event classes tracked by the latency monitor.
+const (
+	LatencyEventCommand     = "command"
+	LatencyEventAOFFsync    = "aof-fsync"
+	LatencyEventExpireCycle = "expire-cycle"
+	LatencyEventEviction    = "eviction-cycle"
+	LatencyEventDefrag      = "active-defrag-cycle"
+	latencyHistoryLen       = 160
+)
+
+// LatencySample is a single latency spike. Samples falling in the same
+// second are folded together keeping the worst latency.
+type LatencySample struct {
+	Timestamp time.Time
+	Latency   time.Duration
+}
+
+// LatencyStats summarizes an event class for LATENCY LATEST.
+type LatencyStats struct {
+	Event     string
+	Timestamp time.Time
+	Latest    time.Duration
+	Max       time.Duration
+}
+
+type latencyEvent struct {
+	samples [latencyHistoryLen]LatencySample
+	idx     int
+	max     time.Duration
+}
+
+// LatencyMonitor records latency spikes above a configurable threshold per
+// event class, mirroring Redis' LATENCY subsystem. A nil monitor is valid
+// and records nothing.
+type LatencyMonitor struct {
+	mu        sync.Mutex
+	threshold int64 // milliseconds, zero disables monitoring
+	events    map[string]*latencyEvent
+}
+
+// NewLatencyMonitor creates a monitor recording events that take at least
+// thresholdMs milliseconds.
+func NewLatencyMonitor(thresholdMs int64) *LatencyMonitor {
+	return &LatencyMonitor{
+		threshold: thresholdMs,
+		events:    make(map[string]*latencyEvent),
+	}
+}
+
+// Threshold returns the current threshold in milliseconds.
+func (m *LatencyMonitor) Threshold() int64 {
+	return atomic.LoadInt64(&m.threshold)
+}
+
+// SetThreshold changes the threshold; zero disables monitoring.
+func (m *LatencyMonitor) SetThreshold(ms int64) {
+	atomic.StoreInt64(&m.threshold, ms)
+}
+
+// Observe records d for event if it reaches the threshold.
+func (m *LatencyMonitor) Observe(event string, d time.Duration) {
+	m.observeAt(event, d, time.Now())
+}
+
+func (m *LatencyMonitor) observeAt(event string, d time.Duration, at time.Time) {
+	if m == nil {
+		return
+	}
+	threshold := atomic.LoadInt64(&m.threshold)
+	if threshold <= 0 || d.Milliseconds() < threshold {
+		return
+	}
+
+	now := at.Truncate(time.Second)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ev, exists := m.events[event]
+	if !exists {
+		ev = &latencyEvent{}
+		m.events[event] = ev
+	}
+
+	if d > ev.max {
+		ev.max = d
+	}
+
+	prev := (ev.idx + latencyHistoryLen - 1) % latencyHistoryLen
+	if ev.samples[prev].Timestamp.Equal(now) {
+		if d > ev.samples[prev].Latency {
+			ev.samples[prev].Latency = d
+		}
+		return
+	}
+
+	ev.samples[ev.idx] = LatencySample{Timestamp: now, Latency: d}
+	ev.idx = (ev.idx + 1) % latencyHistoryLen
+}
+
+// Latest returns the most recent spike and all-time maximum of every event
+// class, sorted by event name.
+func (m *LatencyMonitor) Latest() []LatencyStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]LatencyStats, 0, len(m.events))
+	for name, ev := range m.events {
+		last := ev.samples[(ev.idx+latencyHistoryLen-1)%latencyHistoryLen]
+		stats = append(stats, LatencyStats{
+			Event:     name,
+			Timestamp: last.Timestamp,
+			Latest:    last.Latency,
+			Max:       ev.max,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Event < stats[j].Event })
+	return stats
+}
+
+// History returns the recorded samples of event, oldest first.
+func (m *LatencyMonitor) History(event string) []LatencySample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ev, exists := m.events[event]
+	if !exists {
+		return nil
+	}
+
+	history := make([]LatencySample, 0, latencyHistoryLen)
+	for i := 0; i < latencyHistoryLen; i++ {
+		sample := ev.samples[(ev.idx+i)%latencyHistoryLen]
+		if !sample.Timestamp.IsZero() {
+			history = append(history, sample)
+		}
+	}
+	return history
+}
+
+// Reset drops the history of the given events, or of every event when none
+// is given, and returns the number of event classes reset.
+func (m *LatencyMonitor) Reset(events ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(events) == 0 {
+		n := len(m.events)
+		m.events = make(map[string]*latencyEvent)
+		return n
+	}
+
+	n := 0
+	for _, event := range events {
+		if _, exists := m.events[event]; exists {
+			delete(m.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+// Doctor produces a human readable analysis of the recorded spikes.
+func (m *LatencyMonitor) Doctor() string {
+	threshold := m.Threshold()
+	if threshold <= 0 {
+		return "The latency monitor is disabled. Set latency-monitor-threshold " +
+			"to a value in milliseconds to collect samples.\n"
+	}
+
+	latest := m.Latest()
+	if len(latest) == 0 {
+		return fmt.Sprintf("No latency spikes above %dms were observed. "+
+			"The instance looks healthy.\n", threshold)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Latency spikes above %dms were observed for the following events:\n\n", threshold)
+
+	for i, stat := range latest {
+		history := m.History(stat.Event)
+		var sum time.Duration
+		for _, sample := range history {
+			sum += sample.Latency
+		}
+		avg := time.Duration(0)
+		if len(history) > 0 {
+			avg = sum / time.Duration(len(history))
+		}
+
+		period := time.Duration(0)
+		if len(history) > 1 {
+			period = history[len(history)-1].Timestamp.Sub(history[0].Timestamp) / time.Duration(len(history)-1)
+		}
+
+		fmt.Fprintf(&b, "%d. %s: %d latency spikes (average %dms, worst %dms, mean period between spikes %ds). Last spike %ds ago.\n",
+			i+1, stat.Event, len(history), avg.Milliseconds(), stat.Max.Milliseconds(),
+			int64(period.Seconds()), int64(time.Since(stat.Timestamp).Seconds()))
+	}
+
+	b.WriteString("\nI have a few advices for you:\n\n")
+	for _, stat := range latest {
+		switch stat.Event {
+		case LatencyEventCommand:
+			b.WriteString("- Check SLOWLOG GET to find the slow commands. Avoid O(N) commands such as KEYS, SMEMBERS or LRANGE on large values.\n")
+		case LatencyEventAOFFsync:
+			b.WriteString("- The disk is slow to fsync the AOF. Consider the 'everysec' sync strategy or a faster disk.\n")
+		case LatencyEventExpireCycle:
+			b.WriteString("- Many keys are expiring at the same time. Spread expire times with some randomness.\n")
+		case LatencyEventEviction:
+			b.WriteString("- Eviction is expensive. Consider raising maxmemory or using smaller values.\n")
+		case LatencyEventDefrag:
+			b.WriteString("- Defragmentation cycles are slow. Raise the defrag threshold or increase the defrag interval.\n")
+		}
+	}
+
+	return b.String()
+}
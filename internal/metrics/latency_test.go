@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyMonitor(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+
+	t.Run("Test Threshold", func(t *testing.T) {
+		m := NewLatencyMonitor(10)
+		m.Observe(LatencyEventCommand, 9*time.Millisecond)
+		assert.Empty(t, m.Latest())
+		assert.Contains(t, m.Doctor(), "No latency spikes above 10ms")
+
+		m.Observe(LatencyEventCommand, 10*time.Millisecond)
+		assert.Len(t, m.History(LatencyEventCommand), 1)
+
+		// Zero disables the monitor
+		m.SetThreshold(0)
+		m.Reset()
+		m.Observe(LatencyEventCommand, time.Second)
+		assert.Empty(t, m.Latest())
+		assert.Equal(t, int64(0), m.Threshold())
+
+		var disabled *LatencyMonitor
+		assert.NotPanics(t, func() { disabled.Observe(LatencyEventCommand, time.Second) })
+	})
+
+	t.Run("Test Samples In The Same Second Fold", func(t *testing.T) {
+		m := NewLatencyMonitor(1)
+		m.observeAt(LatencyEventCommand, 5*time.Millisecond, base)
+		m.observeAt(LatencyEventCommand, 20*time.Millisecond, base.Add(300*time.Millisecond))
+		m.observeAt(LatencyEventCommand, 7*time.Millisecond, base.Add(900*time.Millisecond))
+		m.observeAt(LatencyEventCommand, 3*time.Millisecond, base.Add(time.Second))
+
+		history := m.History(LatencyEventCommand)
+		require.Len(t, history, 2)
+		assert.Equal(t, LatencySample{Timestamp: base, Latency: 20 * time.Millisecond}, history[0])
+		assert.Equal(t, LatencySample{Timestamp: base.Add(time.Second), Latency: 3 * time.Millisecond}, history[1])
+
+		latest := m.Latest()
+		require.Len(t, latest, 1)
+		assert.Equal(t, 3*time.Millisecond, latest[0].Latest)
+		assert.Equal(t, 20*time.Millisecond, latest[0].Max)
+		assert.Equal(t, base.Add(time.Second), latest[0].Timestamp)
+	})
+
+	t.Run("Test History Keeps Newest", func(t *testing.T) {
+		m := NewLatencyMonitor(1)
+		for i := 0; i < latencyHistoryLen+10; i++ {
+			m.observeAt(LatencyEventExpireCycle, time.Duration(i+1)*time.Millisecond, base.Add(time.Duration(i)*time.Second))
+		}
+
+		history := m.History(LatencyEventExpireCycle)
+		require.Len(t, history, latencyHistoryLen)
+		assert.Equal(t, base.Add(10*time.Second), history[0].Timestamp, "oldest samples should be dropped")
+		assert.Equal(t, base.Add(time.Duration(latencyHistoryLen+9)*time.Second), history[len(history)-1].Timestamp)
+		assert.Nil(t, m.History(LatencyEventAOFFsync))
+	})
+
+	t.Run("Test Latest And Reset", func(t *testing.T) {
+		m := NewLatencyMonitor(1)
+		m.Observe(LatencyEventExpireCycle, 5*time.Millisecond)
+		m.Observe(LatencyEventCommand, 8*time.Millisecond)
+		m.Observe(LatencyEventEviction, 2*time.Millisecond)
+
+		latest := m.Latest()
+		require.Len(t, latest, 3)
+		assert.Equal(t, LatencyEventCommand, latest[0].Event, "events should be sorted by name")
+		assert.Equal(t, LatencyEventEviction, latest[1].Event)
+		assert.Equal(t, LatencyEventExpireCycle, latest[2].Event)
+
+		assert.Equal(t, 1, m.Reset(LatencyEventCommand, "unknown"))
+		assert.Len(t, m.Latest(), 2)
+		assert.Equal(t, 2, m.Reset())
+		assert.Empty(t, m.Latest())
+	})
+
+	t.Run("Test Doctor", func(t *testing.T) {
+		m := NewLatencyMonitor(0)
+		assert.Contains(t, m.Doctor(), "disabled")
+
+		m.SetThreshold(5)
+		assert.Contains(t, m.Doctor(), "No latency spikes above 5ms")
+
+		m.Observe(LatencyEventCommand, 40*time.Millisecond)
+		m.Observe(LatencyEventEviction, 6*time.Millisecond)
+		report := m.Doctor()
+		assert.Contains(t, report, "1. command: 1 latency spikes (average 40ms, worst 40ms")
+		assert.Contains(t, report, "2. eviction-cycle: 1 latency spikes (average 6ms, worst 6ms")
+		assert.Contains(t, report, "SLOWLOG GET")
+		assert.Contains(t, report, "raising maxmemory")
+		assert.NotContains(t, report, "fsync")
+	})
+}
@@ -1,30 +1,46 @@
 package metrics
 
 import (
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type Metrics struct {
-	mu            sync.RWMutex
-	startTime     time.Time
-	cmdCount      int64
-	totalCommands int64
-	activeConns   int32
-	commandStats  map[string]*CommandStats
+	mu             sync.RWMutex
+	startTime      time.Time
+	cmdCount       int64
+	totalCommands  int64
+	activeConns    int32
+	blockedClients int32
+	totalConns     int64
+	commandStats   map[string]*CommandStats
+	aclDenials     map[string]*int64
 }
 
 type CommandStats struct {
 	Calls        int64
+	Errors       int64
 	TotalTime    int64
 	LastExecTime time.Time
+	Latency      *Histogram
 }
 
+// ACL denial reasons reported by IncrACLDenials.
+const (
+	ACLDeniedAuth    = "auth"
+	ACLDeniedCommand = "command"
+)
+
 func NewMetrics() *Metrics {
 	return &Metrics{
 		startTime:    time.Now(),
 		commandStats: make(map[string]*CommandStats),
+		aclDenials: map[string]*int64{
+			ACLDeniedAuth:    new(int64),
+			ACLDeniedCommand: new(int64),
+		},
 	}
 }
 
@@ -37,18 +53,86 @@ func (m *Metrics) GetCommandCount() int64 {
 }
 
 func (m *Metrics) AddCommandExecution(cmd string, duration time.Duration) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.recordCommand(cmd, duration, false)
+}
 
+// AddFailedCommandExecution records a command that replied with an error.
+func (m *Metrics) AddFailedCommandExecution(cmd string, duration time.Duration) {
+	m.recordCommand(cmd, duration, true)
+}
+
+func (m *Metrics) recordCommand(cmd string, duration time.Duration, failed bool) {
+	m.mu.Lock()
 	stats, exists := m.commandStats[cmd]
 	if !exists {
-		stats = &CommandStats{}
+		stats = &CommandStats{Latency: NewHistogram(DefaultLatencyBuckets)}
 		m.commandStats[cmd] = stats
 	}
 
 	stats.Calls++
+	if failed {
+		stats.Errors++
+	}
 	stats.TotalTime += duration.Nanoseconds()
 	stats.LastExecTime = time.Now()
+	m.mu.Unlock()
+
+	stats.Latency.Observe(duration)
+}
+
+// IncrActiveConns registers a newly accepted client connection.
+func (m *Metrics) IncrActiveConns() {
+	atomic.AddInt32(&m.activeConns, 1)
+	atomic.AddInt64(&m.totalConns, 1)
+}
+
+// DecrActiveConns unregisters a closed client connection.
+func (m *Metrics) DecrActiveConns() {
+	atomic.AddInt32(&m.activeConns, -1)
+}
+
+// IncrBlockedClients marks a client as waiting in a blocking command.
+func (m *Metrics) IncrBlockedClients() {
+	atomic.AddInt32(&m.blockedClients, 1)
+}
+
+// DecrBlockedClients marks a blocked client as released.
+func (m *Metrics) DecrBlockedClients() {
+	atomic.AddInt32(&m.blockedClients, -1)
+}
+
+// IncrACLDenials counts a rejected authentication or command.
+func (m *Metrics) IncrACLDenials(reason string) {
+	m.mu.RLock()
+	counter, exists := m.aclDenials[reason]
+	m.mu.RUnlock()
+	if exists {
+		atomic.AddInt64(counter, 1)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if counter, exists = m.aclDenials[reason]; !exists {
+		counter = new(int64)
+		m.aclDenials[reason] = counter
+	}
+	atomic.AddInt64(counter, 1)
+}
+
+// Reset clears the command statistics and counters, as CONFIG RESETSTAT
+// does. Gauges such as the number of connected clients are preserved.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	atomic.StoreInt64(&m.cmdCount, 0)
+	atomic.StoreInt64(&m.totalCommands, 0)
+	atomic.StoreInt64(&m.totalConns, 0)
+	m.commandStats = make(map[string]*CommandStats)
+	for _, counter := range m.aclDenials {
+		atomic.StoreInt64(counter, 0)
+	}
 }
 
 func (m *Metrics) GetStats() map[string]interface{} {
@@ -59,11 +143,14 @@ func (m *Metrics) GetStats() map[string]interface{} {
 	stats["uptime_in_seconds"] = int(time.Since(m.startTime).Seconds())
 	stats["total_commands_processed"] = m.GetCommandCount()
 	stats["connected_clients"] = atomic.LoadInt32(&m.activeConns)
+	stats["blocked_clients"] = atomic.LoadInt32(&m.blockedClients)
+	stats["total_connections_received"] = atomic.LoadInt64(&m.totalConns)
 
 	cmdStats := make(map[string]map[string]interface{})
 	for cmd, stat := range m.commandStats {
 		cmdStats[cmd] = map[string]interface{}{
 			"calls":          stat.Calls,
+			"failed_calls":   stat.Errors,
 			"total_time_us":  stat.TotalTime / 1000,
 			"avg_time_us":    stat.TotalTime / stat.Calls / 1000,
 			"last_exec_time": stat.LastExecTime,
@@ -73,3 +160,53 @@ func (m *Metrics) GetStats() map[string]interface{} {
 
 	return stats
 }
+
+// Collect implements Collector for the command and client statistics.
+func (m *Metrics) Collect(w *OpenMetricsWriter) {
+	m.mu.RLock()
+	cmds := make([]string, 0, len(m.commandStats))
+	for cmd := range m.commandStats {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	calls := make([]Sample, 0, len(cmds))
+	errors := make([]Sample, 0, len(cmds))
+	latencies := make([]HistogramSample, 0, len(cmds))
+	for _, cmd := range cmds {
+		stat := m.commandStats[cmd]
+		labels := []Label{{Name: "cmd", Value: cmd}}
+		calls = append(calls, Sample{Labels: labels, Value: float64(stat.Calls)})
+		errors = append(errors, Sample{Labels: labels, Value: float64(stat.Errors)})
+		latencies = append(latencies, HistogramSample{Labels: labels, Snapshot: stat.Latency.Snapshot()})
+	}
+
+	reasons := make([]string, 0, len(m.aclDenials))
+	for reason := range m.aclDenials {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	denials := make([]Sample, 0, len(reasons))
+	for _, reason := range reasons {
+		denials = append(denials, Sample{
+			Labels: []Label{{Name: "reason", Value: reason}},
+			Value:  float64(atomic.LoadInt64(m.aclDenials[reason])),
+		})
+	}
+	m.mu.RUnlock()
+
+	w.Gauge("crystalcache_uptime_seconds", "Number of seconds since the server started.",
+		Sample{Value: time.Since(m.startTime).Seconds()})
+	w.Counter("crystalcache_commands_processed", "Total number of commands processed.",
+		Sample{Value: float64(m.GetCommandCount())})
+	w.Counter("crystalcache_command_calls", "Total number of calls per command.", calls...)
+	w.Counter("crystalcache_command_errors", "Total number of calls per command that replied with an error.", errors...)
+	w.Histogram("crystalcache_command_duration_seconds", "Command execution latency.", latencies...)
+	w.Gauge("crystalcache_connected_clients", "Number of client connections.",
+		Sample{Value: float64(atomic.LoadInt32(&m.activeConns))})
+	w.Gauge("crystalcache_blocked_clients", "Number of clients waiting in a blocking command.",
+		Sample{Value: float64(atomic.LoadInt32(&m.blockedClients))})
+	w.Counter("crystalcache_connections_received", "Total number of connections accepted.",
+		Sample{Value: float64(atomic.LoadInt64(&m.totalConns))})
+	w.Counter("crystalcache_acl_denials", "Total number of requests rejected by ACL checks.", denials...)
+}
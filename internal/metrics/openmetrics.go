@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// OpenMetricsContentType is the content type of the text exposition written
+// by OpenMetricsWriter.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Collector contributes metric families to an exposition. The server, the
+// cache and the storage each implement it for the state they own.
+type Collector interface {
+	Collect(w *OpenMetricsWriter)
+}
+
+// Label is a single name/value pair attached to a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a counter or gauge family.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// HistogramSample is one labelled histogram of a histogram family.
+type HistogramSample struct {
+	Labels   []Label
+	Snapshot HistogramSnapshot
+}
+
+// OpenMetricsWriter writes metric families in the OpenMetrics text format.
+// Write errors are sticky and reported by Close.
+type OpenMetricsWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewOpenMetricsWriter creates a writer emitting to w.
+func NewOpenMetricsWriter(w io.Writer) *OpenMetricsWriter {
+	return &OpenMetricsWriter{w: bufio.NewWriter(w)}
+}
+
+// Counter writes a counter family. Sample names get the _total suffix.
+func (w *OpenMetricsWriter) Counter(name, help string, samples ...Sample) {
+	w.header(name, "counter", help)
+	for _, s := range samples {
+		w.sample(name+"_total", s.Labels, formatFloat(s.Value))
+	}
+}
+
+// Gauge writes a gauge family.
+func (w *OpenMetricsWriter) Gauge(name, help string, samples ...Sample) {
+	w.header(name, "gauge", help)
+	for _, s := range samples {
+		w.sample(name, s.Labels, formatFloat(s.Value))
+	}
+}
+
+// Histogram writes a histogram family with cumulative buckets, _count and
+// _sum samples.
+func (w *OpenMetricsWriter) Histogram(name, help string, samples ...HistogramSample) {
+	w.header(name, "histogram", help)
+	for _, s := range samples {
+		snap := s.Snapshot
+		for i, bound := range snap.Bounds {
+			w.sample(name+"_bucket", withLabel(s.Labels, "le", formatFloat(bound)), strconv.FormatUint(snap.Cumulative[i], 10))
+		}
+		w.sample(name+"_bucket", withLabel(s.Labels, "le", "+Inf"), strconv.FormatUint(snap.Count, 10))
+		w.sample(name+"_count", s.Labels, strconv.FormatUint(snap.Count, 10))
+		w.sample(name+"_sum", s.Labels, formatFloat(snap.Sum))
+	}
+}
+
+// Close terminates the exposition with the mandatory EOF marker and
+// flushes it.
+func (w *OpenMetricsWriter) Close() error {
+	w.writeString("# EOF\n")
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *OpenMetricsWriter) header(name, typ, help string) {
+	w.writeString("# TYPE " + name + " " + typ + "\n")
+	w.writeString("# HELP " + name + " " + escapeText(help) + "\n")
+}
+
+func (w *OpenMetricsWriter) sample(name string, labels []Label, value string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l.Name)
+			b.WriteString(`="`)
+			b.WriteString(escapeText(l.Value))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(value)
+	b.WriteByte('\n')
+	w.writeString(b.String())
+}
+
+func (w *OpenMetricsWriter) writeString(s string) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.WriteString(s)
+}
+
+func withLabel(labels []Label, name, value string) []Label {
+	out := make([]Label, 0, len(labels)+1)
+	out = append(out, labels...)
+	return append(out, Label{Name: name, Value: value})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeText escapes label values and help texts.
+func escapeText(s string) string {
+	if !strings.ContainsAny(s, "\\\"\n") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
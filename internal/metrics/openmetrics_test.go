@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMetricsWriter(t *testing.T) {
+	t.Run("Test Counter And Gauge", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewOpenMetricsWriter(&buf)
+		w.Counter("test_calls", "Calls per command.", Sample{Labels: []Label{{Name: "cmd", Value: `ge"t`}}, Value: 3})
+		w.Gauge("test_clients", "Connected clients.", Sample{Value: 2})
+		assert.NoError(t, w.Close())
+
+		assert.Equal(t, strings.Join([]string{
+			"# TYPE test_calls counter",
+			"# HELP test_calls Calls per command.",
+			`test_calls_total{cmd="ge\"t"} 3`,
+			"# TYPE test_clients gauge",
+			"# HELP test_clients Connected clients.",
+			"test_clients 2",
+			"# EOF",
+			"",
+		}, "\n"), buf.String())
+	})
+
+	t.Run("Test Histogram", func(t *testing.T) {
+		h := NewHistogram([]float64{0.001, 0.01})
+		h.Observe(500 * time.Microsecond)
+		h.Observe(5 * time.Millisecond)
+		h.Observe(time.Second)
+
+		var buf bytes.Buffer
+		w := NewOpenMetricsWriter(&buf)
+		w.Histogram("test_seconds", "Latency.", HistogramSample{Snapshot: h.Snapshot()})
+		assert.NoError(t, w.Close())
+
+		out := buf.String()
+		assert.Contains(t, out, `test_seconds_bucket{le="0.001"} 1`)
+		assert.Contains(t, out, `test_seconds_bucket{le="0.01"} 2`)
+		assert.Contains(t, out, `test_seconds_bucket{le="+Inf"} 3`)
+		assert.Contains(t, out, "test_seconds_count 3\n")
+		assert.Contains(t, out, "test_seconds_sum 1.0055\n")
+
+		h.Reset()
+		assert.Equal(t, uint64(0), h.Snapshot().Count)
+	})
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSlowLogSlowerThan is the default threshold in microseconds.
+	DefaultSlowLogSlowerThan = 10000
+	// DefaultSlowLogMaxLen is the default number of entries kept.
+	DefaultSlowLogMaxLen = 128
+
+	slowLogMaxArgc   = 32
+	slowLogMaxArgLen = 128
+)
+
+// SlowLogEntry describes a command whose execution exceeded the threshold.
+type SlowLogEntry struct {
+	ID         int64
+	Timestamp  time.Time
+	Duration   time.Duration
+	Args       []string
+	ClientAddr string
+	ClientName string
+}
+
+// SlowLog keeps the most recent slow commands in a fixed size ring buffer.
+type SlowLog struct {
+	mu         sync.Mutex
+	slowerThan int64 // microseconds, negative disables logging
+	nextID     int64
+	entries    []SlowLogEntry
+	head       int // index of the next slot to write
+	size       int
+	maxLen     int
+}
+
+// NewSlowLog creates a slow log that records commands slower than
+// slowerThan microseconds and keeps at most maxLen entries.
+func NewSlowLog(slowerThan int64, maxLen int) *SlowLog {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	return &SlowLog{
+		slowerThan: slowerThan,
+		entries:    make([]SlowLogEntry, maxLen),
+		maxLen:     maxLen,
+	}
+}
+
+// SlowerThan returns the current threshold in microseconds.
+func (s *SlowLog) SlowerThan() int64 {
+	return atomic.LoadInt64(&s.slowerThan)
+}
+
+// SetSlowerThan changes the threshold. A negative value disables the log and
+// zero logs every command.
+func (s *SlowLog) SetSlowerThan(us int64) {
+	atomic.StoreInt64(&s.slowerThan, us)
+}
+
+// MaxLen returns the capacity of the log.
+func (s *SlowLog) MaxLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxLen
+}
+
+// SetMaxLen resizes the log, keeping the newest entries.
+func (s *SlowLog) SetMaxLen(maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.newestLocked(maxLen)
+	s.entries = make([]SlowLogEntry, maxLen)
+	s.maxLen = maxLen
+	s.size = 0
+	s.head = 0
+	for i := len(kept) - 1; i >= 0; i-- {
+		s.appendLocked(kept[i])
+	}
+}
+
+// Record adds a command to the log if its duration reaches the threshold.
+// It reports whether the command was logged.
+func (s *SlowLog) Record(args []string, duration time.Duration, clientAddr, clientName string) bool {
+	threshold := atomic.LoadInt64(&s.slowerThan)
+	if threshold < 0 || duration.Microseconds() < threshold {
+		return false
+	}
+
+	entry := SlowLogEntry{
+		Timestamp:  time.Now(),
+		Duration:   duration,
+		Args:       trimSlowLogArgs(args),
+		ClientAddr: clientAddr,
+		ClientName: clientName,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxLen == 0 {
+		return false
+	}
+	entry.ID = s.nextID
+	s.nextID++
+	s.appendLocked(entry)
+	return true
+}
+
+// Get returns up to count entries, newest first. A negative count returns
+// every entry.
+func (s *SlowLog) Get(count int) []SlowLogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count < 0 || count > s.size {
+		count = s.size
+	}
+	return s.newestLocked(count)
+}
+
+// Len returns the number of entries currently stored.
+func (s *SlowLog) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Reset removes every entry. Entry IDs keep increasing across resets.
+func (s *SlowLog) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.entries {
+		s.entries[i] = SlowLogEntry{}
+	}
+	s.size = 0
+	s.head = 0
+}
+
+func (s *SlowLog) appendLocked(entry SlowLogEntry) {
+	if s.maxLen == 0 {
+		return
+	}
+	s.entries[s.head] = entry
+	s.head = (s.head + 1) % s.maxLen
+	if s.size < s.maxLen {
+		s.size++
+	}
+}
+
+func (s *SlowLog) newestLocked(count int) []SlowLogEntry {
+	if count > s.size {
+		count = s.size
+	}
+	result := make([]SlowLogEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		idx := (s.head - i + len(s.entries)) % len(s.entries)
+		result = append(result, s.entries[idx])
+	}
+	return result
+}
+
+// trimSlowLogArgs bounds the memory used by a single entry the same way
+// Redis does: at most 32 arguments, each at most 128 bytes.
+func trimSlowLogArgs(args []string) []string {
+	argc := len(args)
+	if argc > slowLogMaxArgc {
+		argc = slowLogMaxArgc
+	}
+
+	trimmed := make([]string, argc)
+	for i := 0; i < argc; i++ {
+		if i == slowLogMaxArgc-1 && len(args) > slowLogMaxArgc {
+			trimmed[i] = fmt.Sprintf("... (%d more arguments)", len(args)-slowLogMaxArgc+1)
+			break
+		}
+		arg := args[i]
+		if len(arg) > slowLogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowLogMaxArgLen], len(arg)-slowLogMaxArgLen)
+		}
+		trimmed[i] = arg
+	}
+	return trimmed
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLog(t *testing.T) {
+	t.Run("Test Threshold", func(t *testing.T) {
+		log := NewSlowLog(1000, 10)
+		assert.False(t, log.Record([]string{"GET", "a"}, 500*time.Microsecond, "127.0.0.1:1", ""))
+		assert.True(t, log.Record([]string{"GET", "a"}, 2*time.Millisecond, "127.0.0.1:1", "worker"))
+		assert.Equal(t, 1, log.Len())
+
+		log.SetSlowerThan(-1)
+		assert.False(t, log.Record([]string{"GET", "a"}, time.Second, "127.0.0.1:1", ""))
+	})
+
+	t.Run("Test Ring Buffer Keeps Newest", func(t *testing.T) {
+		log := NewSlowLog(0, 3)
+		for i := 0; i < 5; i++ {
+			log.Record([]string{"CMD", string(rune('a' + i))}, time.Millisecond, "", "")
+		}
+
+		entries := log.Get(-1)
+		assert.Len(t, entries, 3)
+		assert.Equal(t, int64(4), entries[0].ID, "newest entry should come first")
+		assert.Equal(t, "e", entries[0].Args[1])
+		assert.Equal(t, int64(2), entries[2].ID)
+
+		assert.Len(t, log.Get(2), 2)
+	})
+
+	t.Run("Test Resize And Reset", func(t *testing.T) {
+		log := NewSlowLog(0, 5)
+		for i := 0; i < 5; i++ {
+			log.Record([]string{"CMD"}, time.Millisecond, "", "")
+		}
+
+		log.SetMaxLen(2)
+		entries := log.Get(-1)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, int64(4), entries[0].ID)
+		assert.Equal(t, int64(3), entries[1].ID)
+
+		log.Reset()
+		assert.Equal(t, 0, log.Len())
+		log.Record([]string{"CMD"}, time.Millisecond, "", "")
+		assert.Equal(t, int64(5), log.Get(1)[0].ID, "IDs should keep increasing after a reset")
+	})
+
+	t.Run("Test Argument Trimming", func(t *testing.T) {
+		args := make([]string, 40)
+		for i := range args {
+			args[i] = "x"
+		}
+		args[1] = strings.Repeat("y", 200)
+
+		trimmed := trimSlowLogArgs(args)
+		assert.Len(t, trimmed, slowLogMaxArgc)
+		assert.Equal(t, "... (9 more arguments)", trimmed[slowLogMaxArgc-1])
+		assert.True(t, strings.HasSuffix(trimmed[1], "... (72 more bytes)"))
+	})
+}
@@ -0,0 +1,462 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// The messages of the remote write and remote read protocols, with the
+// fields the server uses. Unknown fields are skipped when decoding.
+// Reference: https://github.com/prometheus/prometheus/blob/main/prompb
+
+// WriteRequest is prometheus.WriteRequest
+type WriteRequest struct {
+	Timeseries []TimeSeries // 1
+}
+
+// TimeSeries is prometheus.TimeSeries
+type TimeSeries struct {
+	Labels  []Label  // 1
+	Samples []Sample // 2
+}
+
+// Label is prometheus.Label
+type Label struct {
+	Name  string // 1
+	Value string // 2
+}
+
+// Sample is prometheus.Sample
+type Sample struct {
+	Value     float64 // 1
+	Timestamp int64   // 2
+}
+
+// ReadRequest is prometheus.ReadRequest
+type ReadRequest struct {
+	Queries               []Query        // 1
+	AcceptedResponseTypes []ResponseType // 2
+}
+
+// ResponseType is prometheus.ReadRequest.ResponseType
+type ResponseType int32
+
+const (
+	ResponseTypeSamples           ResponseType = 0
+	ResponseTypeStreamedXORChunks ResponseType = 1
+)
+
+// Query is prometheus.Query
+type Query struct {
+	StartTimestampMs int64          // 1
+	EndTimestampMs   int64          // 2
+	Matchers         []LabelMatcher // 3
+}
+
+// MatchType is prometheus.LabelMatcher.Type
+type MatchType int32
+
+const (
+	MatchEqual     MatchType = 0
+	MatchNotEqual  MatchType = 1
+	MatchRegexp    MatchType = 2
+	MatchNotRegexp MatchType = 3
+)
+
+// LabelMatcher is prometheus.LabelMatcher
+type LabelMatcher struct {
+	Type  MatchType // 1
+	Name  string    // 2
+	Value string    // 3
+}
+
+// ReadResponse is prometheus.ReadResponse
+type ReadResponse struct {
+	Results []QueryResult // 1
+}
+
+// QueryResult is prometheus.QueryResult
+type QueryResult struct {
+	Timeseries []TimeSeries // 1
+}
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoReader walks the fields of a message
+type protoReader struct {
+	buf []byte
+	err error
+}
+
+// next reads the key of the next field and reports whether there is one
+func (r *protoReader) next() (field int, wire int, ok bool) {
+	if r.err != nil || len(r.buf) == 0 {
+		return 0, 0, false
+	}
+	key := r.varint()
+	if r.err != nil {
+		return 0, 0, false
+	}
+	if key>>3 == 0 || key>>3 > math.MaxInt32 {
+		r.err = errMalformed
+		return 0, 0, false
+	}
+	return int(key >> 3), int(key & 0x07), true
+}
+
+func (r *protoReader) varint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = errMalformed
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *protoReader) fixed64() uint64 {
+	if len(r.buf) < 8 {
+		r.err = errMalformed
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *protoReader) bytes() []byte {
+	n := r.varint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = errMalformed
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// skip drops the value of a field of the given wire type
+func (r *protoReader) skip(wire int) {
+	switch wire {
+	case wireVarint:
+		r.varint()
+	case wireFixed64:
+		r.fixed64()
+	case wireBytes:
+		r.bytes()
+	case wireFixed32:
+		if len(r.buf) < 4 {
+			r.err = errMalformed
+			return
+		}
+		r.buf = r.buf[4:]
+	default:
+		r.err = errMalformed
+	}
+}
+
+// expect reports whether a known field has the wire type it is declared
+// with, failing the read if not
+func (r *protoReader) expect(wire, want int) bool {
+	if wire != want {
+		r.err = errMalformed
+		return false
+	}
+	return true
+}
+
+// UnmarshalWriteRequest decodes a WriteRequest.
+func UnmarshalWriteRequest(data []byte) (*WriteRequest, error) {
+	req := &WriteRequest{}
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		if field == 1 && r.expect(wire, wireBytes) {
+			ts, err := unmarshalTimeSeries(r.bytes())
+			if err != nil {
+				return nil, err
+			}
+			req.Timeseries = append(req.Timeseries, ts)
+		} else {
+			r.skip(wire)
+		}
+	}
+	return req, r.err
+}
+
+func unmarshalTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireBytes):
+			label, err := unmarshalLabel(r.bytes())
+			if err != nil {
+				return ts, err
+			}
+			ts.Labels = append(ts.Labels, label)
+		case field == 2 && r.expect(wire, wireBytes):
+			sample, err := unmarshalSample(r.bytes())
+			if err != nil {
+				return ts, err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		default:
+			r.skip(wire)
+		}
+	}
+	return ts, r.err
+}
+
+func unmarshalLabel(data []byte) (Label, error) {
+	var label Label
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireBytes):
+			label.Name = string(r.bytes())
+		case field == 2 && r.expect(wire, wireBytes):
+			label.Value = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return label, r.err
+}
+
+func unmarshalSample(data []byte) (Sample, error) {
+	var sample Sample
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireFixed64):
+			sample.Value = math.Float64frombits(r.fixed64())
+		case field == 2 && r.expect(wire, wireVarint):
+			sample.Timestamp = int64(r.varint())
+		default:
+			r.skip(wire)
+		}
+	}
+	return sample, r.err
+}
+
+// UnmarshalReadRequest decodes a ReadRequest.
+func UnmarshalReadRequest(data []byte) (*ReadRequest, error) {
+	req := &ReadRequest{}
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireBytes):
+			query, err := unmarshalQuery(r.bytes())
+			if err != nil {
+				return nil, err
+			}
+			req.Queries = append(req.Queries, query)
+		case field == 2 && wire == wireVarint:
+			req.AcceptedResponseTypes = append(req.AcceptedResponseTypes, ResponseType(r.varint()))
+		case field == 2 && r.expect(wire, wireBytes):
+			// Packed
+			packed := protoReader{buf: r.bytes()}
+			for len(packed.buf) > 0 && packed.err == nil {
+				req.AcceptedResponseTypes = append(req.AcceptedResponseTypes, ResponseType(packed.varint()))
+			}
+			if packed.err != nil {
+				return nil, packed.err
+			}
+		default:
+			r.skip(wire)
+		}
+	}
+	return req, r.err
+}
+
+func unmarshalQuery(data []byte) (Query, error) {
+	var query Query
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireVarint):
+			query.StartTimestampMs = int64(r.varint())
+		case field == 2 && r.expect(wire, wireVarint):
+			query.EndTimestampMs = int64(r.varint())
+		case field == 3 && r.expect(wire, wireBytes):
+			matcher, err := unmarshalLabelMatcher(r.bytes())
+			if err != nil {
+				return query, err
+			}
+			query.Matchers = append(query.Matchers, matcher)
+		default:
+			r.skip(wire)
+		}
+	}
+	return query, r.err
+}
+
+func unmarshalLabelMatcher(data []byte) (LabelMatcher, error) {
+	var matcher LabelMatcher
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && r.expect(wire, wireVarint):
+			matcher.Type = MatchType(r.varint())
+		case field == 2 && r.expect(wire, wireBytes):
+			matcher.Name = string(r.bytes())
+		case field == 3 && r.expect(wire, wireBytes):
+			matcher.Value = string(r.bytes())
+		default:
+			r.skip(wire)
+		}
+	}
+	return matcher, r.err
+}
+
+// UnmarshalReadResponse decodes a ReadResponse.
+func UnmarshalReadResponse(data []byte) (*ReadResponse, error) {
+	resp := &ReadResponse{}
+	r := protoReader{buf: data}
+	for {
+		field, wire, ok := r.next()
+		if !ok {
+			break
+		}
+		if field == 1 && r.expect(wire, wireBytes) {
+			var result QueryResult
+			rr := protoReader{buf: r.bytes()}
+			for {
+				field, wire, ok := rr.next()
+				if !ok {
+					break
+				}
+				if field == 1 && rr.expect(wire, wireBytes) {
+					ts, err := unmarshalTimeSeries(rr.bytes())
+					if err != nil {
+						return nil, err
+					}
+					result.Timeseries = append(result.Timeseries, ts)
+				} else {
+					rr.skip(wire)
+				}
+			}
+			if rr.err != nil {
+				return nil, rr.err
+			}
+			resp.Results = append(resp.Results, result)
+		} else {
+			r.skip(wire)
+		}
+	}
+	return resp, r.err
+}
+
+// protoWriter appends fields to a message
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) key(field, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (w *protoWriter) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.key(field, wireVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) double(field int, v float64) {
+	bits := math.Float64bits(v)
+	if bits == 0 {
+		return
+	}
+	w.key(field, wireFixed64)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, bits)
+}
+
+func (w *protoWriter) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	w.key(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// message appends an embedded message written by fn
+func (w *protoWriter) message(field int, fn func(w *protoWriter)) {
+	var inner protoWriter
+	fn(&inner)
+	w.key(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(inner.buf)))
+	w.buf = append(w.buf, inner.buf...)
+}
+
+func (w *protoWriter) timeSeries(field int, ts TimeSeries) {
+	w.message(field, func(w *protoWriter) {
+		for _, label := range ts.Labels {
+			w.message(1, func(w *protoWriter) {
+				w.string(1, label.Name)
+				w.string(2, label.Value)
+			})
+		}
+		for _, sample := range ts.Samples {
+			w.message(2, func(w *protoWriter) {
+				w.double(1, sample.Value)
+				w.varint(2, uint64(sample.Timestamp))
+			})
+		}
+	})
+}
+
+// Marshal encodes the response.
+func (resp *ReadResponse) Marshal() []byte {
+	var w protoWriter
+	for _, result := range resp.Results {
+		w.message(1, func(w *protoWriter) {
+			for _, ts := range result.Timeseries {
+				w.timeSeries(1, ts)
+			}
+		})
+	}
+	return w.buf
+}
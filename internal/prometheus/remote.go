@@ -0,0 +1,368 @@
+// Package prometheus serves the Prometheus remote write and remote read
+// protocols over the time series of the cache, so the cache can be the
+// remote storage of a Prometheus server.
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/core/ports"
+	"github.com/genc-murat/crystalcache/pkg/utils/snappy"
+)
+
+const (
+	// maxBodySize bounds the compressed body of a request
+	maxBodySize = 32 << 20
+	// maxDecodedSize bounds the body of a request once decompressed
+	maxDecodedSize = 128 << 20
+
+	metricNameLabel = "__name__"
+)
+
+// staleNaN is the value Prometheus writes to mark a series as gone
+const staleNaN = 0x7ff0000000000002
+
+// WriteHandler serves remote write requests. Every series is written to
+// the key built from its labels, created with them if it does not exist.
+// Each write is passed to record, if not nil, as the TS.CREATE or TS.MADD
+// command that repeats it, so it can be persisted and replicated like
+// writes made over a connection.
+func WriteHandler(cache ports.Cache, record func(cmd models.Value)) http.Handler {
+	if record == nil {
+		record = func(models.Value) {}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, status, err := readBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		req, err := UnmarshalWriteRequest(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entries := make(map[string][]models.TimeSeriesSample, len(req.Timeseries))
+		for _, ts := range req.Timeseries {
+			labels := labelMap(ts.Labels)
+			key := SeriesKey(labels)
+			if _, ok := entries[key]; !ok {
+				if err := createSeries(cache, key, labels, record); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			samples := entries[key]
+			for _, s := range ts.Samples {
+				if math.Float64bits(s.Value) == staleNaN {
+					continue
+				}
+				samples = append(samples, models.TimeSeriesSample{Timestamp: s.Timestamp, Value: s.Value})
+			}
+			entries[key] = samples
+		}
+
+		// Series are added one at a time and recorded even when a sample
+		// is rejected: the samples before it were added, and repeating
+		// the command adds the same ones. Rejected samples are not
+		// retried, which a 4xx status tells Prometheus.
+		for key, samples := range entries {
+			if len(samples) == 0 {
+				continue
+			}
+			err := cache.TSMAdd(map[string][]models.TimeSeriesSample{key: samples})
+			record(maddCommand(key, samples))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// createSeries creates the series of a remote write at key unless it
+// exists. Prometheus resends samples it is not sure were written, so
+// duplicates keep the last value.
+func createSeries(cache ports.Cache, key string, labels map[string]string, record func(cmd models.Value)) error {
+	opts := models.DefaultTimeSeriesOptions()
+	opts.DuplicatePolicy = models.DuplicatePolicyLast
+	opts.Labels = labels
+	if err := cache.TSCreate(key, opts); err != nil {
+		if strings.HasSuffix(err.Error(), "key already exists") {
+			return nil
+		}
+		return err
+	}
+
+	args := []string{"TS.CREATE", key, "DUPLICATE_POLICY", models.DuplicatePolicyLast}
+	if len(labels) > 0 {
+		args = append(args, "LABELS")
+		for _, label := range labelList(labels) {
+			args = append(args, label.Name, label.Value)
+		}
+	}
+	record(command(args...))
+	return nil
+}
+
+// maddCommand is the TS.MADD command adding samples to the series at key.
+func maddCommand(key string, samples []models.TimeSeriesSample) models.Value {
+	args := make([]string, 0, 1+3*len(samples))
+	args = append(args, "TS.MADD")
+	for _, s := range samples {
+		args = append(args, key, strconv.FormatInt(s.Timestamp, 10), strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+	return command(args...)
+}
+
+func command(args ...string) models.Value {
+	values := make([]models.Value, len(args))
+	for i, arg := range args {
+		values[i] = models.Value{Type: "bulk", Bulk: arg}
+	}
+	return models.Value{Type: "array", Array: values}
+}
+
+// ReadHandler serves remote read requests with sampled responses. A query
+// needs an equality matcher on a non-empty value to be looked up in the
+// label index.
+func ReadHandler(cache ports.Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, status, err := readBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		req, err := UnmarshalReadRequest(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !acceptsSamples(req.AcceptedResponseTypes) {
+			http.Error(w, "only the SAMPLES response type is supported", http.StatusBadRequest)
+			return
+		}
+
+		resp := &ReadResponse{Results: make([]QueryResult, len(req.Queries))}
+		for i, query := range req.Queries {
+			result, err := runQuery(cache, query)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp.Results[i] = result
+		}
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		w.Write(snappy.Encode(resp.Marshal()))
+	})
+}
+
+// acceptsSamples reports whether the client takes sampled responses, which
+// it does when it names no response type
+func acceptsSamples(types []ResponseType) bool {
+	for _, t := range types {
+		if t == ResponseTypeSamples {
+			return true
+		}
+	}
+	return len(types) == 0
+}
+
+func runQuery(cache ports.Cache, query Query) (QueryResult, error) {
+	var result QueryResult
+	filters, regexps, err := convertMatchers(query.Matchers)
+	if err != nil {
+		return result, err
+	}
+
+	series, err := cache.TSMRange(filters, query.StartTimestampMs, query.EndTimestampMs, models.TimeSeriesRangeOptions{})
+	if err != nil {
+		return result, err
+	}
+
+	for _, s := range series {
+		if len(s.Samples) == 0 || !regexps.matches(s.Labels) {
+			continue
+		}
+		ts := TimeSeries{
+			Labels:  labelList(s.Labels),
+			Samples: make([]Sample, len(s.Samples)),
+		}
+		for i, sample := range s.Samples {
+			ts.Samples[i] = Sample{Value: sample.Value, Timestamp: sample.Timestamp}
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, nil
+}
+
+// regexpMatcher is a regular expression matcher, applied to the series
+// the label filters select. A missing label matches as the empty string.
+type regexpMatcher struct {
+	label  string
+	negate bool
+	re     *regexp.Regexp
+}
+
+type regexpMatchers []regexpMatcher
+
+func (m regexpMatchers) matches(labels map[string]string) bool {
+	for _, matcher := range m {
+		if matcher.re.MatchString(labels[matcher.label]) == matcher.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// convertMatchers turns the matchers of a query into label filters, and
+// the regular expressions the filters cannot express into matchers over
+// their results. An alternation of literals is a filter of its values.
+func convertMatchers(matchers []LabelMatcher) ([]models.TimeSeriesFilter, regexpMatchers, error) {
+	var filters []models.TimeSeriesFilter
+	var regexps regexpMatchers
+	indexed := false
+
+	for _, m := range matchers {
+		switch m.Type {
+		case MatchEqual, MatchNotEqual:
+			f := models.TimeSeriesFilter{Label: m.Name, Negate: m.Type == MatchNotEqual}
+			if m.Value != "" {
+				f.Values = []string{m.Value}
+			}
+			indexed = indexed || (!f.Negate && len(f.Values) > 0)
+			filters = append(filters, f)
+
+		case MatchRegexp, MatchNotRegexp:
+			negate := m.Type == MatchNotRegexp
+			if values, ok := literalAlternation(m.Value); ok {
+				filters = append(filters, models.TimeSeriesFilter{Label: m.Name, Negate: negate, Values: values})
+				indexed = indexed || !negate
+				continue
+			}
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid regular expression %q: %v", m.Value, err)
+			}
+			regexps = append(regexps, regexpMatcher{label: m.Name, negate: negate, re: re})
+
+		default:
+			return nil, nil, fmt.Errorf("unknown label matcher type %d", m.Type)
+		}
+	}
+
+	if !indexed {
+		return nil, nil, fmt.Errorf("a query needs at least one equality matcher with a non-empty value")
+	}
+	return filters, regexps, nil
+}
+
+// literalAlternation returns the values of a regular expression made of
+// non-empty literals separated by |
+func literalAlternation(expr string) ([]string, bool) {
+	if expr == "" {
+		return nil, false
+	}
+	values := strings.Split(expr, "|")
+	for _, v := range values {
+		// Filter values cannot hold the characters of the filter syntax
+		if v == "" || regexp.QuoteMeta(v) != v || strings.ContainsAny(v, ",() ") {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// readBody returns the decompressed body of a request, or the status to
+// fail it with.
+func readBody(r *http.Request) ([]byte, int, error) {
+	if r.Method != http.MethodPost {
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+	compressed, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if len(compressed) > maxBodySize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxBodySize)
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if n > maxDecodedSize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("decompressed request body exceeds %d bytes", maxDecodedSize)
+	}
+	data, err := snappy.Decode(compressed)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return data, 0, nil
+}
+
+// SeriesKey returns the key of the series with the given labels, in the
+// exposition format: the metric name then the other labels sorted by name,
+// as in up{instance="localhost:9090",job="prometheus"}.
+func SeriesKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if name != metricNameLabel {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(labels[metricNameLabel])
+	if len(names) == 0 {
+		return b.String()
+	}
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// labelMap returns the labels of a series, without the empty ones which
+// Prometheus treats as missing
+func labelMap(labels []Label) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		if label.Value != "" {
+			m[label.Name] = label.Value
+		}
+	}
+	return m
+}
+
+// labelList returns labels sorted by name, as Prometheus expects them
+func labelList(labels map[string]string) []Label {
+	list := make([]Label, 0, len(labels))
+	for name, value := range labels {
+		list = append(list, Label{Name: name, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
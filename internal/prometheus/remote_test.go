@@ -0,0 +1,205 @@
+package prometheus
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/genc-murat/crystalcache/internal/cache"
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/handlers"
+	"github.com/genc-murat/crystalcache/pkg/utils/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The payloads under testdata are requests as Prometheus sends them,
+// snappy compressed protobuf messages
+const t0 = 1700000000000
+
+func post(t *testing.T, handler http.Handler, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	return rec
+}
+
+func payload(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+func TestRemoteWrite(t *testing.T) {
+	c := cache.NewMemoryCache()
+	handler := WriteHandler(c, nil)
+
+	rec := post(t, handler, payload(t, "write_request.snappy"))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	samples, err := c.TSRange(`up{instance="localhost:9090",job="prometheus"}`, 0, t0+60000, models.TimeSeriesRangeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeSeriesSample{{Timestamp: t0, Value: 1}, {Timestamp: t0 + 15000, Value: 1}}, samples)
+
+	// The stale marker is not stored
+	key := `http_requests_total{code="200",job="api",method="GET"}`
+	samples, err = c.TSRange(key, 0, t0+60000, models.TimeSeriesRangeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeSeriesSample{{Timestamp: t0, Value: 10}, {Timestamp: t0 + 15000, Value: 12}}, samples)
+
+	info, err := c.TSInfo(key, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.DuplicatePolicyLast, info.DuplicatePolicy)
+	assert.Equal(t, map[string]string{"__name__": "http_requests_total", "code": "200", "job": "api", "method": "GET"}, info.Labels)
+
+	// Empty labels are dropped, and the series is found by its labels
+	keys, err := c.TSQueryIndex([]models.TimeSeriesFilter{{Label: "code", Values: []string{"500"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`http_requests_total{code="500",job="api",method="GET"}`}, keys)
+
+	// Resent samples overwrite the ones written
+	rec = post(t, handler, payload(t, "write_request.snappy"))
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	samples, err = c.TSRange(key, 0, t0+60000, models.TimeSeriesRangeOptions{})
+	require.NoError(t, err)
+	assert.Len(t, samples, 2)
+}
+
+func TestRemoteWriteIsRecorded(t *testing.T) {
+	c := cache.NewMemoryCache()
+	var recorded []models.Value
+	handler := WriteHandler(c, func(cmd models.Value) { recorded = append(recorded, cmd) })
+	require.Equal(t, http.StatusNoContent, post(t, handler, payload(t, "write_request.snappy")).Code)
+
+	// The series are created before their samples are added
+	up := `up{instance="localhost:9090",job="prometheus"}`
+	var upCommands [][]string
+	for _, cmd := range recorded {
+		if cmd.Array[1].Bulk == up {
+			args := make([]string, len(cmd.Array))
+			for i, arg := range cmd.Array {
+				args[i] = arg.Bulk
+			}
+			upCommands = append(upCommands, args)
+		}
+	}
+	assert.Equal(t, [][]string{
+		{"TS.CREATE", up, "DUPLICATE_POLICY", "LAST", "LABELS", "__name__", "up", "instance", "localhost:9090", "job", "prometheus"},
+		{"TS.MADD", up, "1700000000000", "1", up, "1700000015000", "1"},
+	}, upCommands)
+
+	// Replaying the commands rebuilds the series, as loading the AOF does
+	replica := cache.NewMemoryCache()
+	ts := handlers.NewTimeSeriesHandlers(replica)
+	creates := 0
+	for _, cmd := range recorded {
+		var reply models.Value
+		switch cmd.Array[0].Bulk {
+		case "TS.CREATE":
+			creates++
+			reply = ts.HandleTSCreate(cmd.Array[1:])
+		case "TS.MADD":
+			reply = ts.HandleTSMAdd(cmd.Array[1:])
+		default:
+			t.Fatalf("unexpected command %s", cmd.Array[0].Bulk)
+		}
+		require.NotEqual(t, "error", reply.Type, reply.Str)
+	}
+
+	keys, err := c.TSQueryIndex([]models.TimeSeriesFilter{{Label: "job", Values: []string{"api"}}})
+	require.NoError(t, err)
+	require.NotEmpty(t, keys)
+	assert.Equal(t, len(keys)+1, creates, "one TS.CREATE per series")
+	for _, key := range append(keys, `up{instance="localhost:9090",job="prometheus"}`) {
+		want, err := c.TSRange(key, 0, t0+60000, models.TimeSeriesRangeOptions{})
+		require.NoError(t, err)
+		got, err := replica.TSRange(key, 0, t0+60000, models.TimeSeriesRangeOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, want, got, key)
+
+		info, err := replica.TSInfo(key, false)
+		require.NoError(t, err)
+		assert.Equal(t, models.DuplicatePolicyLast, info.DuplicatePolicy)
+	}
+
+	// Series that exist are not created again
+	recorded = nil
+	require.Equal(t, http.StatusNoContent, post(t, handler, payload(t, "write_request.snappy")).Code)
+	for _, cmd := range recorded {
+		assert.Equal(t, "TS.MADD", cmd.Array[0].Bulk)
+	}
+}
+
+func TestRemoteRead(t *testing.T) {
+	c := cache.NewMemoryCache()
+	require.Equal(t, http.StatusNoContent, post(t, WriteHandler(c, nil), payload(t, "write_request.snappy")).Code)
+
+	rec := post(t, ReadHandler(c), payload(t, "read_request.snappy"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/x-protobuf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "snappy", rec.Header().Get("Content-Encoding"))
+
+	data, err := snappy.Decode(rec.Body.Bytes())
+	require.NoError(t, err)
+	resp, err := UnmarshalReadResponse(data)
+	require.NoError(t, err)
+
+	labels := func(code string) []Label {
+		return []Label{{"__name__", "http_requests_total"}, {"code", code}, {"job", "api"}, {"method", "GET"}}
+	}
+	assert.Equal(t, &ReadResponse{Results: []QueryResult{{Timeseries: []TimeSeries{
+		{Labels: labels("200"), Samples: []Sample{{Value: 10, Timestamp: t0}, {Value: 12, Timestamp: t0 + 15000}}},
+		{Labels: labels("500"), Samples: []Sample{{Value: 2, Timestamp: t0}, {Value: 3, Timestamp: t0 + 15000}}},
+	}}}}, resp)
+}
+
+func TestConvertMatchers(t *testing.T) {
+	filters, regexps, err := convertMatchers([]LabelMatcher{
+		{Type: MatchEqual, Name: "__name__", Value: "up"},
+		{Type: MatchEqual, Name: "env", Value: ""},
+		{Type: MatchNotEqual, Name: "job", Value: "node"},
+		{Type: MatchRegexp, Name: "instance", Value: "a:1|b:2"},
+		{Type: MatchNotRegexp, Name: "zone", Value: "eu-.*"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []models.TimeSeriesFilter{
+		{Label: "__name__", Values: []string{"up"}},
+		{Label: "env"},
+		{Label: "job", Negate: true, Values: []string{"node"}},
+		{Label: "instance", Values: []string{"a:1", "b:2"}},
+	}, filters)
+	require.Len(t, regexps, 1)
+	assert.True(t, regexps.matches(map[string]string{"zone": "us-east"}))
+	assert.True(t, regexps.matches(map[string]string{}))
+	assert.False(t, regexps.matches(map[string]string{"zone": "eu-west"}))
+
+	// The label index needs a matcher
+	_, _, err = convertMatchers([]LabelMatcher{{Type: MatchRegexp, Name: "__name__", Value: "up.*"}})
+	assert.Error(t, err)
+	_, _, err = convertMatchers([]LabelMatcher{{Type: MatchRegexp, Name: "job", Value: "("}})
+	assert.Error(t, err)
+}
+
+func TestRemoteErrors(t *testing.T) {
+	c := cache.NewMemoryCache()
+
+	rec := httptest.NewRecorder()
+	WriteHandler(c, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	// Not snappy, and snappy but not protobuf
+	assert.Equal(t, http.StatusBadRequest, post(t, WriteHandler(c, nil), []byte("\xff\xff\xff\xff\xff\xff")).Code)
+	assert.Equal(t, http.StatusBadRequest, post(t, WriteHandler(c, nil), snappy.Encode([]byte{0x0a, 0x05, 0x01})).Code)
+
+	// Streamed chunks only
+	rec = post(t, ReadHandler(c), snappy.Encode([]byte{0x10, 0x01}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSeriesKey(t *testing.T) {
+	assert.Equal(t, "up", SeriesKey(map[string]string{"__name__": "up"}))
+	assert.Equal(t, `up{a="1",b="x\"y"}`, SeriesKey(map[string]string{"b": `x"y`, "__name__": "up", "a": "1"}))
+}
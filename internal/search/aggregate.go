@@ -0,0 +1,432 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Row is one record flowing through an aggregation pipeline. Fields keep
+// the order in which they were first set.
+type Row struct {
+	names  []string
+	values map[string]interface{}
+}
+
+func newRow() *Row {
+	return &Row{values: make(map[string]interface{})}
+}
+
+// Set stores a field value; nil values are reported as null.
+func (r *Row) Set(name string, value interface{}) {
+	if _, ok := r.values[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.values[name] = value
+}
+
+// Get returns the value of a field.
+func (r *Row) Get(name string) (interface{}, bool) {
+	v, ok := r.values[name]
+	return v, ok
+}
+
+// Fields returns the field names in insertion order.
+func (r *Row) Fields() []string {
+	return r.names
+}
+
+// FormatValue renders a scalar row value the way FT.AGGREGATE replies
+// with it.
+func FormatValue(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		if math.IsNaN(t) {
+			return "nan"
+		}
+		if math.IsInf(t, 0) {
+			if t > 0 {
+				return "inf"
+			}
+			return "-inf"
+		}
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// AggregateRequest is the parsed form of FT.AGGREGATE.
+type AggregateRequest struct {
+	Query    string
+	Verbatim bool
+	Load     []string
+	LoadAll  bool
+	Params   map[string]string
+	steps    []aggregateStep
+}
+
+// AggregateResult is the reply of FT.AGGREGATE.
+type AggregateResult struct {
+	Total int
+	Rows  []*Row
+}
+
+type aggregateStep interface {
+	run(rows []*Row, total *int) ([]*Row, error)
+}
+
+// ParseAggregate parses the arguments of FT.AGGREGATE following the index
+// name:
+//
+//	query [VERBATIM] [LOAD count field ... | LOAD *]
+//	      [GROUPBY n property ... [REDUCE func n arg ... [AS name]] ...]
+//	      [APPLY expr AS name] [FILTER expr]
+//	      [SORTBY n property [ASC|DESC] ... [MAX num]] [LIMIT offset num]
+//	      [PARAMS count name value ...] [DIALECT n]
+//
+// Pipeline steps run in the order they are given.
+func ParseAggregate(args []string) (*AggregateRequest, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'FT.AGGREGATE' command")
+	}
+	req := &AggregateRequest{Query: args[0]}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "VERBATIM":
+			req.Verbatim = true
+		case "LOAD":
+			if i+1 < len(args) && args[i+1] == "*" {
+				req.LoadAll = true
+				i++
+				continue
+			}
+			values, next, err := countedArgs(args, i, "LOAD")
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				req.Load = append(req.Load, strings.TrimPrefix(v, "@"))
+			}
+			i = next
+		case "GROUPBY":
+			step, next, err := parseGroupBy(args, i)
+			if err != nil {
+				return nil, err
+			}
+			req.steps = append(req.steps, step)
+			i = next
+		case "APPLY":
+			if i+3 >= len(args) || !strings.EqualFold(args[i+2], "AS") {
+				return nil, fmt.Errorf("Bad arguments for APPLY: expected expression AS name")
+			}
+			e, err := parseExpr(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			req.steps = append(req.steps, &applyStep{expr: e, as: args[i+3]})
+			i += 3
+		case "FILTER":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("FILTER requires an expression")
+			}
+			e, err := parseExpr(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			req.steps = append(req.steps, &filterStep{expr: e})
+			i++
+		case "SORTBY":
+			step, next, err := parseSortBy(args, i)
+			if err != nil {
+				return nil, err
+			}
+			req.steps = append(req.steps, step)
+			i = next
+		case "LIMIT":
+			offset, num, err := parseLimit(args, i)
+			if err != nil {
+				return nil, err
+			}
+			req.steps = append(req.steps, &limitStep{offset: offset, num: num})
+			i += 2
+		case "PARAMS":
+			params, next, err := parseParams(args, i)
+			if err != nil {
+				return nil, err
+			}
+			req.Params = params
+			i = next
+		case "DIALECT", "TIMEOUT":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires an argument", strings.ToUpper(args[i]))
+			}
+			i++
+		default:
+			return nil, fmt.Errorf("Unknown argument `%s`", args[i])
+		}
+	}
+	return req, nil
+}
+
+// property strips the @ prefix from a property reference.
+func property(arg string) (string, error) {
+	if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+		return "", fmt.Errorf("Bad arguments: property `%s` must start with @", arg)
+	}
+	return arg[1:], nil
+}
+
+// run executes the pipeline over rows.
+func (req *AggregateRequest) run(rows []*Row) (*AggregateResult, error) {
+	total := -1
+	var err error
+	for _, step := range req.steps {
+		if rows, err = step.run(rows, &total); err != nil {
+			return nil, err
+		}
+	}
+	if total < 0 {
+		total = len(rows)
+	}
+	return &AggregateResult{Total: total, Rows: rows}, nil
+}
+
+// GROUPBY
+
+type groupStep struct {
+	by       []string
+	reducers []*reducerSpec
+}
+
+type reducerSpec struct {
+	name  string
+	args  []string
+	alias string
+}
+
+func parseGroupBy(args []string, i int) (*groupStep, int, error) {
+	values, next, err := countedArgs(args, i, "GROUPBY")
+	if err != nil {
+		return nil, 0, err
+	}
+	step := &groupStep{}
+	for _, v := range values {
+		name, err := property(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		step.by = append(step.by, name)
+	}
+
+	i = next
+	for i+1 < len(args) && strings.EqualFold(args[i+1], "REDUCE") {
+		if i+2 >= len(args) {
+			return nil, 0, fmt.Errorf("REDUCE requires a function")
+		}
+		spec := &reducerSpec{name: strings.ToUpper(args[i+2])}
+		reducerArgs, last, err := countedArgs(args, i+2, "REDUCE")
+		if err != nil {
+			return nil, 0, err
+		}
+		spec.args = reducerArgs
+		i = last
+		if i+2 < len(args) && strings.EqualFold(args[i+1], "AS") {
+			spec.alias = args[i+2]
+			i += 2
+		} else {
+			spec.alias = "__generated_alias" + strings.ToLower(spec.name) +
+				strings.ToLower(strings.ReplaceAll(strings.Join(spec.args, ","), "@", ""))
+		}
+		if _, err := newReducer(spec); err != nil {
+			return nil, 0, err
+		}
+		step.reducers = append(step.reducers, spec)
+	}
+	return step, i, nil
+}
+
+func (s *groupStep) run(rows []*Row, _ *int) ([]*Row, error) {
+	type group struct {
+		row      *Row
+		reducers []reducer
+	}
+	groups := make(map[string]*group)
+	var order []*group
+
+	for _, row := range rows {
+		keyParts := make([]string, len(s.by))
+		for i, name := range s.by {
+			v, _ := row.Get(name)
+			if v == nil {
+				keyParts[i] = "\x00null"
+			} else {
+				keyParts[i] = FormatValue(v)
+			}
+		}
+		key := strings.Join(keyParts, "\x01")
+
+		g, ok := groups[key]
+		if !ok {
+			g = &group{row: newRow()}
+			for _, name := range s.by {
+				v, _ := row.Get(name)
+				g.row.Set(name, v)
+			}
+			for _, spec := range s.reducers {
+				r, _ := newReducer(spec)
+				g.reducers = append(g.reducers, r)
+			}
+			groups[key] = g
+			order = append(order, g)
+		}
+		for _, r := range g.reducers {
+			r.add(row)
+		}
+	}
+
+	out := make([]*Row, 0, len(order))
+	for _, g := range order {
+		for i, spec := range s.reducers {
+			g.row.Set(spec.alias, g.reducers[i].result())
+		}
+		out = append(out, g.row)
+	}
+	return out, nil
+}
+
+// APPLY and FILTER
+
+type applyStep struct {
+	expr expr
+	as   string
+}
+
+func (s *applyStep) run(rows []*Row, _ *int) ([]*Row, error) {
+	for _, row := range rows {
+		row.Set(s.as, s.expr(row))
+	}
+	return rows, nil
+}
+
+type filterStep struct {
+	expr expr
+}
+
+func (s *filterStep) run(rows []*Row, _ *int) ([]*Row, error) {
+	out := rows[:0]
+	for _, row := range rows {
+		if truthy(s.expr(row)) {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// SORTBY
+
+type sortKey struct {
+	name string
+	desc bool
+}
+
+type sortStep struct {
+	keys []sortKey
+	max  int
+}
+
+func parseSortBy(args []string, i int) (*sortStep, int, error) {
+	values, next, err := countedArgs(args, i, "SORTBY")
+	if err != nil {
+		return nil, 0, err
+	}
+	step := &sortStep{}
+	for _, v := range values {
+		switch strings.ToUpper(v) {
+		case "ASC", "DESC":
+			if len(step.keys) == 0 {
+				return nil, 0, fmt.Errorf("Bad arguments for SORTBY: %s without a property", v)
+			}
+			step.keys[len(step.keys)-1].desc = strings.EqualFold(v, "DESC")
+			continue
+		}
+		name, err := property(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		step.keys = append(step.keys, sortKey{name: name})
+	}
+	if len(step.keys) == 0 {
+		return nil, 0, fmt.Errorf("Bad arguments for SORTBY: no properties")
+	}
+	if next+2 < len(args) && strings.EqualFold(args[next+1], "MAX") {
+		n, err := strconv.Atoi(args[next+2])
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("Bad arguments for SORTBY MAX")
+		}
+		step.max = n
+		next += 2
+	}
+	return step, next, nil
+}
+
+func (s *sortStep) run(rows []*Row, _ *int) ([]*Row, error) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range s.keys {
+			a, _ := rows[i].Get(k.name)
+			b, _ := rows[j].Get(k.name)
+			c := compareValues(sortable(a), sortable(b))
+			if c == 0 {
+				continue
+			}
+			if k.desc && a != nil && b != nil {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	if s.max > 0 && len(rows) > s.max {
+		rows = rows[:s.max]
+	}
+	return rows, nil
+}
+
+// sortable converts numeric strings so that loaded hash fields sort by
+// value.
+func sortable(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	if _, ok := v.([]interface{}); ok {
+		return FormatValue(v)
+	}
+	return v
+}
+
+// LIMIT
+
+type limitStep struct {
+	offset, num int
+}
+
+func (s *limitStep) run(rows []*Row, total *int) ([]*Row, error) {
+	*total = len(rows)
+	start := s.offset
+	if start > len(rows) {
+		start = len(rows)
+	}
+	end := start + s.num
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[start:end], nil
+}
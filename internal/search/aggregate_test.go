@@ -0,0 +1,148 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func aggregate(t *testing.T, e *Engine, index string, args ...string) *AggregateResult {
+	t.Helper()
+	req, err := ParseAggregate(args)
+	require.NoError(t, err)
+	res, err := e.Aggregate(index, req)
+	require.NoError(t, err)
+	return res
+}
+
+func rowValues(rows []*Row, name string) []interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i], _ = row.Get(name)
+	}
+	return values
+}
+
+func salesEngine(t *testing.T) *Engine {
+	src := newMemSource()
+	src.hashes["sale:1"] = map[string]string{"city": "Paris", "amount": "10", "item": "tea"}
+	src.hashes["sale:2"] = map[string]string{"city": "Paris", "amount": "30", "item": "coffee"}
+	src.hashes["sale:3"] = map[string]string{"city": "Berlin", "amount": "20", "item": "tea"}
+	src.hashes["sale:4"] = map[string]string{"city": "Rome", "amount": "5", "item": "tea"}
+	src.hashes["sale:5"] = map[string]string{"city": "Berlin", "amount": "50", "item": "cake"}
+
+	e := NewEngine(src)
+	createIndex(t, e, "sales", "PREFIX", "1", "sale:", "SCHEMA",
+		"city", "TAG", "amount", "NUMERIC", "item", "TEXT")
+	return e
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+	e := salesEngine(t)
+
+	res := aggregate(t, e, "sales", "*",
+		"GROUPBY", "1", "@city",
+		"REDUCE", "COUNT", "0", "AS", "n",
+		"REDUCE", "SUM", "1", "@amount", "AS", "total",
+		"REDUCE", "AVG", "1", "@amount",
+		"SORTBY", "2", "@total", "DESC")
+
+	require.Len(t, res.Rows, 3)
+	assert.Equal(t, []interface{}{"berlin", "paris", "rome"}, rowValues(res.Rows, "city"))
+	assert.Equal(t, []interface{}{2.0, 2.0, 1.0}, rowValues(res.Rows, "n"))
+	assert.Equal(t, []interface{}{70.0, 40.0, 5.0}, rowValues(res.Rows, "total"))
+	assert.Equal(t, []interface{}{35.0, 20.0, 5.0}, rowValues(res.Rows, "__generated_aliasavgamount"))
+}
+
+func TestAggregateReducers(t *testing.T) {
+	e := salesEngine(t)
+
+	res := aggregate(t, e, "sales", "*",
+		"GROUPBY", "0",
+		"REDUCE", "MIN", "1", "@amount", "AS", "min",
+		"REDUCE", "MAX", "1", "@amount", "AS", "max",
+		"REDUCE", "COUNT_DISTINCT", "1", "@item", "AS", "items",
+		"REDUCE", "QUANTILE", "2", "@amount", "0.5", "AS", "median",
+		"REDUCE", "STDDEV", "1", "@amount", "AS", "stddev",
+		"REDUCE", "FIRST_VALUE", "4", "@city", "BY", "@amount", "DESC", "AS", "top",
+		"REDUCE", "TOLIST", "1", "@item", "AS", "list")
+
+	require.Len(t, res.Rows, 1)
+	row := res.Rows[0]
+	get := func(name string) interface{} {
+		v, _ := row.Get(name)
+		return v
+	}
+	assert.Equal(t, 5.0, get("min"))
+	assert.Equal(t, 50.0, get("max"))
+	assert.Equal(t, 3.0, get("items"))
+	assert.Equal(t, 20.0, get("median"))
+	assert.InDelta(t, 17.89, get("stddev"), 0.01)
+	assert.Equal(t, "berlin", get("top"))
+	assert.ElementsMatch(t, []interface{}{"tea", "coffee", "cake"}, get("list"))
+}
+
+func TestAggregateApplyFilterLimit(t *testing.T) {
+	e := salesEngine(t)
+
+	res := aggregate(t, e, "sales", "@city:{paris|berlin}",
+		"LOAD", "2", "@__key", "@item",
+		"APPLY", "@amount * 2", "AS", "double",
+		"APPLY", "upper(@item)", "AS", "label",
+		"FILTER", "@double >= 40 && @label != 'CAKE'",
+		"SORTBY", "2", "@double", "ASC",
+		"LIMIT", "0", "1")
+
+	assert.Equal(t, 2, res.Total)
+	require.Len(t, res.Rows, 1)
+	key, _ := res.Rows[0].Get("__key")
+	assert.Equal(t, "sale:3", key)
+	label, _ := res.Rows[0].Get("label")
+	assert.Equal(t, "TEA", label)
+}
+
+func TestParseAggregateErrors(t *testing.T) {
+	tests := [][]string{
+		{"*", "GROUPBY", "1", "city"},
+		{"*", "GROUPBY", "1", "@city", "REDUCE", "NOPE", "0"},
+		{"*", "GROUPBY", "1", "@city", "REDUCE", "SUM", "0"},
+		{"*", "APPLY", "@a +", "AS", "x"},
+		{"*", "APPLY", "nope(@a)", "AS", "x"},
+		{"*", "SORTBY", "1", "DESC"},
+		{"*", "LIMIT", "0"},
+		{"*", "BOGUS"},
+	}
+	for _, args := range tests {
+		_, err := ParseAggregate(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	row := newRow()
+	row.Set("a", 7.0)
+	row.Set("s", "Hello")
+
+	tests := map[string]interface{}{
+		"@a + 3 * 2":           13.0,
+		"(@a + 3) * 2":         20.0,
+		"@a % 4":               3.0,
+		"2 ^ 3":                8.0,
+		"-@a":                  -7.0,
+		"@a > 5 && @a < 10":    1.0,
+		"!(@a == 7) || 0":      0.0,
+		"lower(@s)":            "hello",
+		"strlen(@s)":           5.0,
+		"substr(@s, 1, 3)":     "ell",
+		"startswith(@s, 'He')": 1.0,
+		"floor(7.8)":           7.0,
+		"exists(@missing)":     0.0,
+		"@s == \"Hello\"":      1.0,
+	}
+	for src, want := range tests {
+		e, err := parseExpr(src)
+		require.NoError(t, err, src)
+		assert.Equal(t, want, e(row), src)
+	}
+}
@@ -0,0 +1,227 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Source gives the engine read access to the keyspace. Loads are made
+// with an index lock held and must not wait for keyspace writes, which
+// notify the engine.
+type Source interface {
+	LoadHash(key string) (map[string]string, bool)
+	LoadJSON(key string) (interface{}, bool)
+	// Keys calls fn for every key holding a value of the given type.
+	Keys(on SourceType, fn func(key string))
+}
+
+// IndexInfo summarizes an index for FT.INFO.
+type IndexInfo struct {
+	Definition *IndexDefinition
+	NumDocs    int
+	NumTerms   int
+	NumRecords int
+}
+
+// Engine owns the indexes of a keyspace and keeps them in sync with it.
+type Engine struct {
+	source Source
+
+	mu      sync.RWMutex
+	indexes map[string]*Index
+	count   atomic.Int32 // len(indexes), read without the lock on every write
+}
+
+// NewEngine creates an engine reading documents from source.
+func NewEngine(source Source) *Engine {
+	return &Engine{
+		source:  source,
+		indexes: make(map[string]*Index),
+	}
+}
+
+// Create registers a new index and indexes the existing keys it covers.
+func (e *Engine) Create(def *IndexDefinition) error {
+	e.mu.Lock()
+	if _, exists := e.indexes[def.Name]; exists {
+		e.mu.Unlock()
+		return fmt.Errorf("Index already exists")
+	}
+	idx := newIndex(def)
+	e.indexes[def.Name] = idx
+	e.count.Store(int32(len(e.indexes)))
+	e.mu.Unlock()
+
+	e.source.Keys(def.On, func(key string) {
+		if def.matches(key) {
+			e.reload(idx, key)
+		}
+	})
+	return nil
+}
+
+// Drop removes an index and returns the keys it covered.
+func (e *Engine) Drop(name string) ([]string, error) {
+	e.mu.Lock()
+	idx, exists := e.indexes[name]
+	if exists {
+		delete(e.indexes, name)
+		e.count.Store(int32(len(e.indexes)))
+	}
+	e.mu.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Unknown Index name")
+	}
+	return idx.keyList(), nil
+}
+
+// Reset drops every index, as FLUSHALL does.
+func (e *Engine) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.indexes = make(map[string]*Index)
+	e.count.Store(0)
+}
+
+// List returns the index names in sorted order.
+func (e *Engine) List() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	names := make([]string, 0, len(e.indexes))
+	for name := range e.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Engine) index(name string) (*Index, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	idx, ok := e.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: no such index", name)
+	}
+	return idx, nil
+}
+
+// Info describes an index.
+func (e *Engine) Info(name string) (*IndexInfo, error) {
+	idx, err := e.index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	info := &IndexInfo{
+		Definition: idx.def,
+		NumDocs:    len(idx.docs),
+		NumTerms:   len(idx.terms),
+	}
+	for _, postings := range idx.terms {
+		info.NumRecords += len(postings)
+	}
+	return info, nil
+}
+
+// Notify re-indexes key after it was written or deleted.
+func (e *Engine) Notify(key string) {
+	if e.count.Load() == 0 {
+		return
+	}
+
+	e.mu.RLock()
+	var targets []*Index
+	for _, idx := range e.indexes {
+		if idx.def.matches(key) {
+			targets = append(targets, idx)
+		}
+	}
+	e.mu.RUnlock()
+
+	for _, idx := range targets {
+		e.reload(idx, key)
+	}
+}
+
+// reload reads key from the keyspace and indexes or removes it. The key is
+// read under the index lock: of two writes racing to reload it, the one
+// that updates the index last also read it last, so the index is left
+// with the latest version.
+func (e *Engine) reload(idx *Index, key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.def.On == OnHash {
+		if hash, ok := e.source.LoadHash(key); ok {
+			idx.putLocked(key, hash, nil)
+			return
+		}
+	} else if doc, ok := e.source.LoadJSON(key); ok {
+		idx.putLocked(key, nil, doc)
+		return
+	}
+	idx.removeLocked(key)
+}
+
+// Search runs an FT.SEARCH query against the named index.
+func (e *Engine) Search(name, query string, opts *SearchOptions) (*SearchResult, error) {
+	idx, err := e.index(name)
+	if err != nil {
+		return nil, err
+	}
+	return idx.search(e.source, query, opts)
+}
+
+// Aggregate runs an FT.AGGREGATE pipeline against the named index.
+func (e *Engine) Aggregate(name string, req *AggregateRequest) (*AggregateResult, error) {
+	idx, err := e.index(name)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	docs, knn, err := idx.match(req.Query, req.Params, req.Verbatim)
+	if err != nil {
+		idx.mu.RUnlock()
+		return nil, err
+	}
+	rows := make([]*Row, len(docs))
+	for i, d := range docs {
+		row := newRow()
+		values := idx.docs[d.id].values
+		for _, f := range idx.def.Fields {
+			if v, ok := values[f.Name]; ok {
+				row.Set(f.Name, v)
+			}
+		}
+		if knn != nil {
+			row.Set(knn.alias, d.score)
+		}
+		rows[i] = row
+	}
+	idx.mu.RUnlock()
+
+	if req.LoadAll || len(req.Load) > 0 {
+		var names []string
+		if !req.LoadAll {
+			names = req.Load
+		}
+		for i, d := range docs {
+			for _, kv := range idx.loadFields(e.source, d.key, names) {
+				rows[i].Set(kv[0], kv[1])
+			}
+			for _, name := range names {
+				if name == "__key" {
+					rows[i].Set(name, d.key)
+				}
+			}
+		}
+	}
+	return req.run(rows)
+}
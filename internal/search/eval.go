@@ -0,0 +1,342 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// resultSet maps matching document ids to their relevance score.
+type resultSet map[uint32]float64
+
+// evaluator runs a parsed query against an index. The caller holds the
+// index read lock.
+type evaluator struct {
+	idx      *Index
+	verbatim bool
+}
+
+const allTextFields = ^uint64(0)
+
+func (ev *evaluator) eval(n queryNode, mask uint64) (resultSet, error) {
+	switch n := n.(type) {
+	case *allNode:
+		out := make(resultSet, len(ev.idx.docs))
+		for id := range ev.idx.docs {
+			out[id] = 0
+		}
+		return out, nil
+	case *termNode:
+		return ev.evalTerm(n, mask), nil
+	case *phraseNode:
+		return ev.evalPhrase(n, mask), nil
+	case *intersectNode:
+		return ev.evalIntersect(n, mask)
+	case *unionNode:
+		out := make(resultSet)
+		for _, child := range n.children {
+			res, err := ev.eval(child, mask)
+			if err != nil {
+				return nil, err
+			}
+			for id, score := range res {
+				out[id] += score
+			}
+		}
+		return out, nil
+	case *notNode:
+		res, err := ev.eval(n.child, mask)
+		if err != nil {
+			return nil, err
+		}
+		out := make(resultSet)
+		for id := range ev.idx.docs {
+			if _, excluded := res[id]; !excluded {
+				out[id] = 0
+			}
+		}
+		return out, nil
+	case *fieldNode:
+		return ev.evalField(n)
+	case *numericNode:
+		return ev.evalNumeric(n)
+	case *tagNode:
+		return ev.evalTag(n)
+	case *geoNode:
+		return ev.evalGeo(n)
+	}
+	return nil, fmt.Errorf("unsupported query node %T", n)
+}
+
+func (ev *evaluator) evalIntersect(n *intersectNode, mask uint64) (resultSet, error) {
+	results := make([]resultSet, 0, len(n.children))
+	for _, child := range n.children {
+		res, err := ev.eval(child, mask)
+		if err != nil {
+			return nil, err
+		}
+		if len(res) == 0 {
+			return resultSet{}, nil
+		}
+		results = append(results, res)
+	}
+
+	// Walk the smallest set and probe the others
+	sort.Slice(results, func(i, j int) bool { return len(results[i]) < len(results[j]) })
+	out := make(resultSet)
+	for id, score := range results[0] {
+		total := score
+		matched := true
+		for _, other := range results[1:] {
+			s, ok := other[id]
+			if !ok {
+				matched = false
+				break
+			}
+			total += s
+		}
+		if matched {
+			out[id] = total
+		}
+	}
+	return out, nil
+}
+
+// expandTerm returns the index terms a query term stands for: the term
+// itself plus its stem expansions, every term with the prefix, or every
+// term within the fuzzy distance.
+func (ev *evaluator) expandTerm(n *termNode) []string {
+	switch {
+	case n.prefix:
+		terms := ev.idx.termList()
+		start := sort.SearchStrings(terms, n.term)
+		var out []string
+		for _, t := range terms[start:] {
+			if !strings.HasPrefix(t, n.term) {
+				break
+			}
+			out = append(out, t)
+		}
+		return out
+	case n.fuzzy > 0:
+		var out []string
+		for _, t := range ev.idx.termList() {
+			if !strings.HasPrefix(t, "+") && levenshtein(t, n.term, n.fuzzy) <= n.fuzzy {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+
+	out := []string{n.term}
+	if !ev.verbatim && ev.idx.stemming {
+		stem := Stem(n.term)
+		out = append(out, "+"+stem)
+		if stem != n.term {
+			out = append(out, stem)
+		}
+	}
+	return out
+}
+
+func (ev *evaluator) evalTerm(n *termNode, mask uint64) resultSet {
+	out := make(resultSet)
+	for _, term := range ev.expandTerm(n) {
+		postings := ev.idx.terms[term]
+		for id, p := range postings {
+			if p.fieldMask&mask == 0 {
+				continue
+			}
+			out[id] += ev.idx.bm25(len(postings), p, ev.idx.docs[id])
+		}
+	}
+	return out
+}
+
+// evalPhrase matches documents where the terms appear at consecutive
+// positions.
+func (ev *evaluator) evalPhrase(n *phraseNode, mask uint64) resultSet {
+	lists := make([]map[uint32]*posting, len(n.terms))
+	for i, term := range n.terms {
+		lists[i] = ev.idx.terms[term]
+		if len(lists[i]) == 0 {
+			return resultSet{}
+		}
+	}
+
+	out := make(resultSet)
+	for id, first := range lists[0] {
+		if first.fieldMask&mask == 0 {
+			continue
+		}
+		postings := []*posting{first}
+		for _, list := range lists[1:] {
+			p, ok := list[id]
+			if !ok || p.fieldMask&mask == 0 {
+				break
+			}
+			postings = append(postings, p)
+		}
+		if len(postings) != len(lists) || !consecutive(postings) {
+			continue
+		}
+		score := 0.0
+		for i, p := range postings {
+			score += ev.idx.bm25(len(lists[i]), p, ev.idx.docs[id])
+		}
+		out[id] = score
+	}
+	return out
+}
+
+func consecutive(postings []*posting) bool {
+	for _, start := range postings[0].positions {
+		found := true
+		for i, p := range postings[1:] {
+			if !containsInt(p.positions, start+i+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (ev *evaluator) field(name string, want FieldType) (*Field, error) {
+	f := ev.idx.def.Field(name)
+	if f == nil {
+		return nil, fmt.Errorf("Unknown field `%s`", name)
+	}
+	if f.Type != want {
+		return nil, fmt.Errorf("Field `%s` is not a %s field", name, want)
+	}
+	return f, nil
+}
+
+func (ev *evaluator) evalField(n *fieldNode) (resultSet, error) {
+	mask := uint64(0)
+	for _, name := range n.fields {
+		f, err := ev.field(name, TextField)
+		if err != nil {
+			return nil, err
+		}
+		mask |= ev.idx.textFieldMask(f.Name)
+	}
+	return ev.eval(n.child, mask)
+}
+
+func (ev *evaluator) evalNumeric(n *numericNode) (resultSet, error) {
+	f, err := ev.field(n.field, NumericField)
+	if err != nil {
+		return nil, err
+	}
+	out := make(resultSet)
+	ev.idx.numeric[f.Name].search(n.r, func(doc uint32) {
+		out[doc] = 0
+	})
+	return out, nil
+}
+
+func (ev *evaluator) evalTag(n *tagNode) (resultSet, error) {
+	f, err := ev.field(n.field, TagField)
+	if err != nil {
+		return nil, err
+	}
+	tags := ev.idx.tags[f.Name]
+	out := make(resultSet)
+	for _, t := range n.tags {
+		value := f.normalizeTag(t.value)
+		if !t.prefix {
+			for id := range tags[value] {
+				out[id] = 0
+			}
+			continue
+		}
+		for tag, docs := range tags {
+			if strings.HasPrefix(tag, value) {
+				for id := range docs {
+					out[id] = 0
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+func (ev *evaluator) evalGeo(n *geoNode) (resultSet, error) {
+	f, err := ev.field(n.field, GeoField)
+	if err != nil {
+		return nil, err
+	}
+	out := make(resultSet)
+	for id, p := range ev.idx.geo[f.Name] {
+		if haversine(n.lon, n.lat, p.lon, p.lat) <= n.radius {
+			out[id] = 0
+		}
+	}
+	return out, nil
+}
+
+// haversine returns the distance in meters between two points.
+func haversine(lon1, lat1, lon2, lat2 float64) float64 {
+	const earthRadius = 6372797.560856 // meters, as used by Redis
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// levenshtein returns the edit distance between a and b, giving up with
+// max+1 as soon as the distance is known to exceed max.
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > max || -d > max {
+		return max + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,441 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// expr is a compiled APPLY or FILTER expression. It evaluates to a float64,
+// a string or nil.
+type expr func(row *Row) interface{}
+
+// exprParser parses aggregation expressions:
+//
+//	@price * 1.2          arithmetic with + - * / % ^
+//	@age >= 18 && !@ban   comparisons and boolean logic
+//	upper(@name)          function calls
+//	"text"  'text'        string literals
+type exprParser struct {
+	src string
+	pos int
+}
+
+func parseExpr(src string) (expr, error) {
+	p := &exprParser{src: src}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return nil, fmt.Errorf("Syntax error in expression at offset %d", p.pos)
+	}
+	return e, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes op if it is next in the input.
+func (p *exprParser) accept(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row *Row) interface{} { return boolValue(truthy(l(row)) || truthy(right(row))) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row *Row) interface{} { return boolValue(truthy(l(row)) && truthy(right(row))) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		op := op
+		return func(row *Row) interface{} {
+			c := compareLoose(left(row), right(row))
+			switch op {
+			case "==":
+				return boolValue(c == 0)
+			case "!=":
+				return boolValue(c != 0)
+			case "<=":
+				return boolValue(c <= 0)
+			case ">=":
+				return boolValue(c >= 0)
+			case "<":
+				return boolValue(c < 0)
+			}
+			return boolValue(c > 0)
+		}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (expr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *exprParser) parseMultiplicative() (expr, error) {
+	return p.parseBinary(p.parsePower, "*", "/", "%")
+}
+
+func (p *exprParser) parsePower() (expr, error) {
+	return p.parseBinary(p.parseUnary, "^")
+}
+
+// parseBinary parses a left-associative chain of arithmetic operators.
+func (p *exprParser) parseBinary(next func() (expr, error), ops ...string) (expr, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range ops {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+func arithmetic(op string, left, right expr) expr {
+	return func(row *Row) interface{} {
+		a, aok := toNumber(left(row))
+		b, bok := toNumber(right(row))
+		if !aok || !bok {
+			return nil
+		}
+		switch op {
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		case "/":
+			if b == 0 {
+				return math.NaN()
+			}
+			return a / b
+		case "%":
+			if int64(b) == 0 {
+				return math.NaN()
+			}
+			return float64(int64(a) % int64(b))
+		}
+		return math.Pow(a, b)
+	}
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(row *Row) interface{} { return boolValue(!truthy(operand(row))) }, nil
+	}
+	if p.accept("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(row *Row) interface{} {
+			if n, ok := toNumber(operand(row)); ok {
+				return -n
+			}
+			return nil
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, fmt.Errorf("Syntax error in expression: unexpected end")
+	}
+
+	switch c := p.src[p.pos]; {
+	case c == '(':
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("Syntax error in expression: missing ')'")
+		}
+		return e, nil
+	case c == '@':
+		p.pos++
+		name := p.readIdent()
+		if name == "" {
+			return nil, fmt.Errorf("Syntax error in expression: expected property name")
+		}
+		return func(row *Row) interface{} {
+			v, _ := row.Get(name)
+			return v
+		}, nil
+	case c == '"' || c == '\'':
+		s, err := p.readString(c)
+		if err != nil {
+			return nil, err
+		}
+		return func(*Row) interface{} { return s }, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || strings.IndexByte(".eE", p.src[p.pos]) >= 0 ||
+			(p.src[p.pos] == '-' || p.src[p.pos] == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("Syntax error in expression: bad number %q", p.src[start:p.pos])
+		}
+		return func(*Row) interface{} { return n }, nil
+	}
+
+	name := p.readIdent()
+	if name == "" {
+		return nil, fmt.Errorf("Syntax error in expression at offset %d", p.pos)
+	}
+	if !p.accept("(") {
+		return nil, fmt.Errorf("Syntax error in expression: unknown symbol %s", name)
+	}
+	var args []expr
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, fmt.Errorf("Syntax error in expression: expected ',' or ')'")
+			}
+		}
+	}
+	return callFunction(strings.ToLower(name), args)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *exprParser) readIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *exprParser) readString(quote byte) (string, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src):
+			b.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+			continue
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return "", fmt.Errorf("Syntax error in expression: unterminated string")
+}
+
+// exprFunctions maps function names to their arity and implementation.
+var exprFunctions = map[string]struct {
+	arity int
+	fn    func(args []interface{}) interface{}
+}{
+	"upper":    {1, stringFunc(strings.ToUpper)},
+	"lower":    {1, stringFunc(strings.ToLower)},
+	"strlen":   {1, func(a []interface{}) interface{} { return float64(len(FormatValue(a[0]))) }},
+	"substr":   {3, substr},
+	"contains": {2, func(a []interface{}) interface{} { return float64(strings.Count(FormatValue(a[0]), FormatValue(a[1]))) }},
+	"startswith": {2, func(a []interface{}) interface{} {
+		return boolValue(strings.HasPrefix(FormatValue(a[0]), FormatValue(a[1])))
+	}},
+	"exists": {1, func(a []interface{}) interface{} { return boolValue(a[0] != nil) }},
+	"floor":  {1, mathFunc(math.Floor)},
+	"ceil":   {1, mathFunc(math.Ceil)},
+	"abs":    {1, mathFunc(math.Abs)},
+	"sqrt":   {1, mathFunc(math.Sqrt)},
+	"log":    {1, mathFunc(math.Log)},
+	"log2":   {1, mathFunc(math.Log2)},
+	"exp":    {1, mathFunc(math.Exp)},
+}
+
+func callFunction(name string, args []expr) (expr, error) {
+	f, ok := exprFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown function name '%s'", name)
+	}
+	if len(args) != f.arity {
+		return nil, fmt.Errorf("Function '%s' expects %d arguments", name, f.arity)
+	}
+	return func(row *Row) interface{} {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg(row)
+		}
+		return f.fn(values)
+	}, nil
+}
+
+func stringFunc(fn func(string) string) func([]interface{}) interface{} {
+	return func(a []interface{}) interface{} {
+		if a[0] == nil {
+			return nil
+		}
+		return fn(FormatValue(a[0]))
+	}
+}
+
+func mathFunc(fn func(float64) float64) func([]interface{}) interface{} {
+	return func(a []interface{}) interface{} {
+		n, ok := toNumber(a[0])
+		if !ok {
+			return nil
+		}
+		return fn(n)
+	}
+}
+
+func substr(a []interface{}) interface{} {
+	s := FormatValue(a[0])
+	offset, ok1 := toNumber(a[1])
+	length, ok2 := toNumber(a[2])
+	if !ok1 || !ok2 {
+		return nil
+	}
+	start := int(offset)
+	if start < 0 {
+		start += len(s)
+	}
+	if start < 0 || start > len(s) {
+		return ""
+	}
+	end := len(s)
+	if length >= 0 && start+int(length) < end {
+		end = start + int(length)
+	}
+	return s[start:end]
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		n, err := strconv.ParseFloat(t, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case float64:
+		return t != 0 && !math.IsNaN(t)
+	case string:
+		return t != ""
+	}
+	return false
+}
+
+func boolValue(b bool) interface{} {
+	if b {
+		return float64(1)
+	}
+	return float64(0)
+}
+
+// compareLoose compares numerically when both sides are numbers or numeric
+// strings and as strings otherwise.
+func compareLoose(a, b interface{}) int {
+	an, aok := toNumber(a)
+	bn, bok := toNumber(b)
+	if aok && bok {
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(FormatValue(a), FormatValue(b))
+}
@@ -0,0 +1,297 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswNode is a vector and its neighbor lists, one per layer it lives on.
+type hnswNode struct {
+	vec       []float32
+	neighbors [][]uint32
+}
+
+// hnswIndex is a Hierarchical Navigable Small World graph (Malkov and
+// Yashunin, 2016). Each vector lives on layers 0..level, with the level
+// drawn from an exponential distribution; searches descend greedily from
+// the sparse top layer and finish with a best-first search of layer 0.
+type hnswIndex struct {
+	dist           distanceFunc
+	m              int // neighbors per node on layers above 0
+	m0             int // neighbors per node on layer 0
+	efConstruction int
+	levelMult      float64
+	rng            *rand.Rand
+
+	nodes    map[uint32]*hnswNode
+	entry    uint32
+	maxLevel int
+}
+
+func newHNSW(dist distanceFunc, m, efConstruction int, seed int64) *hnswIndex {
+	if m < 2 {
+		m = 2
+	}
+	return &hnswIndex{
+		dist:           dist,
+		m:              m,
+		m0:             2 * m,
+		efConstruction: efConstruction,
+		levelMult:      1 / math.Log(float64(m)),
+		rng:            rand.New(rand.NewSource(seed)),
+		nodes:          make(map[uint32]*hnswNode),
+		maxLevel:       -1,
+	}
+}
+
+func (h *hnswIndex) len() int { return len(h.nodes) }
+
+func (h *hnswIndex) maxConn(level int) int {
+	if level == 0 {
+		return h.m0
+	}
+	return h.m
+}
+
+func (h *hnswIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *hnswIndex) add(id uint32, v []float32) {
+	if _, exists := h.nodes[id]; exists {
+		h.remove(id)
+	}
+	level := h.randomLevel()
+	node := &hnswNode{vec: v, neighbors: make([][]uint32, level+1)}
+
+	if h.maxLevel < 0 {
+		h.nodes[id] = node
+		h.entry, h.maxLevel = id, level
+		return
+	}
+
+	ep := vectorHit{id: h.entry, dist: h.dist(v, h.nodes[h.entry].vec)}
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedy(v, ep, l)
+	}
+	h.nodes[id] = node
+
+	entries := []vectorHit{ep}
+	for l := minInt(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(v, entries, h.efConstruction, l, nil)
+		selected := h.selectNeighbors(candidates, h.m)
+		node.neighbors[l] = make([]uint32, len(selected))
+		for i, c := range selected {
+			node.neighbors[l][i] = c.id
+			h.link(c.id, id, l)
+		}
+		entries = candidates
+	}
+
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+// greedy walks layer l towards q, returning the closest node it reaches.
+func (h *hnswIndex) greedy(q []float32, ep vectorHit, l int) vectorHit {
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.layer(ep.id, l) {
+			n := h.nodes[nb]
+			if n == nil {
+				continue
+			}
+			if d := h.dist(q, n.vec); d < ep.dist {
+				ep = vectorHit{id: nb, dist: d}
+				changed = true
+			}
+		}
+	}
+	return ep
+}
+
+func (h *hnswIndex) layer(id uint32, l int) []uint32 {
+	n := h.nodes[id]
+	if n == nil || l >= len(n.neighbors) {
+		return nil
+	}
+	return n.neighbors[l]
+}
+
+// searchLayer runs a best-first search of layer l from the entry points and
+// returns up to ef nodes closest first. With a filter, rejected nodes are
+// still traversed but never returned.
+func (h *hnswIndex) searchLayer(q []float32, entries []vectorHit, ef, l int, filter func(uint32) bool) []vectorHit {
+	visited := make(map[uint32]struct{}, ef*4)
+	candidates := &hitHeap{}
+	results := &hitHeap{max: true}
+
+	for _, e := range entries {
+		if _, seen := visited[e.id]; seen {
+			continue
+		}
+		visited[e.id] = struct{}{}
+		heap.Push(candidates, e)
+		if filter == nil || filter(e.id) {
+			heap.Push(results, e)
+			if results.Len() > ef {
+				heap.Pop(results)
+			}
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(vectorHit)
+		if results.Len() >= ef && c.dist > results.top().dist {
+			break
+		}
+		for _, nb := range h.layer(c.id, l) {
+			if _, seen := visited[nb]; seen {
+				continue
+			}
+			visited[nb] = struct{}{}
+			n := h.nodes[nb]
+			if n == nil {
+				continue
+			}
+			d := h.dist(q, n.vec)
+			if results.Len() >= ef && d >= results.top().dist {
+				continue
+			}
+			heap.Push(candidates, vectorHit{id: nb, dist: d})
+			if filter == nil || filter(nb) {
+				heap.Push(results, vectorHit{id: nb, dist: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+	return results.sorted()
+}
+
+// selectNeighbors picks up to m neighbors from candidates (closest first)
+// with the diversity heuristic: a candidate is skipped when it is closer to
+// an already selected neighbor than to the base node. Skipped candidates
+// fill any remaining slots.
+func (h *hnswIndex) selectNeighbors(candidates []vectorHit, m int) []vectorHit {
+	if len(candidates) <= m {
+		return candidates
+	}
+	selected := make([]vectorHit, 0, m)
+	var pruned []vectorHit
+	for _, c := range candidates {
+		if len(selected) == m {
+			break
+		}
+		cv := h.nodes[c.id].vec
+		diverse := true
+		for _, s := range selected {
+			if h.dist(cv, h.nodes[s.id].vec) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) == m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// link adds an edge from -> to on layer l, shrinking the neighbor list of
+// from when it overflows.
+func (h *hnswIndex) link(from, to uint32, l int) {
+	n := h.nodes[from]
+	if n == nil || l >= len(n.neighbors) {
+		return
+	}
+	n.neighbors[l] = append(n.neighbors[l], to)
+	if len(n.neighbors[l]) > h.maxConn(l) {
+		n.neighbors[l] = h.prune(n, n.neighbors[l], l)
+	}
+}
+
+// prune reduces ids to the best maxConn(l) neighbors of n.
+func (h *hnswIndex) prune(n *hnswNode, ids []uint32, l int) []uint32 {
+	candidates := make([]vectorHit, 0, len(ids))
+	for _, id := range ids {
+		if other := h.nodes[id]; other != nil {
+			candidates = append(candidates, vectorHit{id: id, dist: h.dist(n.vec, other.vec)})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	selected := h.selectNeighbors(candidates, h.maxConn(l))
+	out := make([]uint32, len(selected))
+	for i, c := range selected {
+		out[i] = c.id
+	}
+	return out
+}
+
+// remove deletes a node and reconnects its neighbors to each other so the
+// graph stays navigable.
+func (h *hnswIndex) remove(id uint32) {
+	node := h.nodes[id]
+	if node == nil {
+		return
+	}
+	delete(h.nodes, id)
+
+	for l, neighbors := range node.neighbors {
+		for _, nb := range neighbors {
+			n := h.nodes[nb]
+			if n == nil || l >= len(n.neighbors) {
+				continue
+			}
+			seen := map[uint32]bool{nb: true, id: true}
+			var ids []uint32
+			for _, c := range append(append([]uint32(nil), n.neighbors[l]...), neighbors...) {
+				if !seen[c] {
+					seen[c] = true
+					ids = append(ids, c)
+				}
+			}
+			n.neighbors[l] = h.prune(n, ids, l)
+		}
+	}
+
+	if id != h.entry {
+		return
+	}
+	h.maxLevel = -1
+	for other, n := range h.nodes {
+		if len(n.neighbors)-1 > h.maxLevel {
+			h.entry, h.maxLevel = other, len(n.neighbors)-1
+		}
+	}
+}
+
+func (h *hnswIndex) search(q []float32, k, ef int, filter func(uint32) bool) []vectorHit {
+	if h.maxLevel < 0 || k <= 0 {
+		return nil
+	}
+	if ef < k {
+		ef = k
+	}
+	ep := vectorHit{id: h.entry, dist: h.dist(q, h.nodes[h.entry].vec)}
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.greedy(q, ep, l)
+	}
+	hits := h.searchLayer(q, []vectorHit{ep}, ef, 0, filter)
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
@@ -0,0 +1,426 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// fieldGap separates the token positions of different text values so that
+// phrases never match across them.
+const fieldGap = 1000
+
+type geoPoint struct {
+	lon, lat float64
+}
+
+// posting records the occurrences of a term in one document.
+type posting struct {
+	freq      float64 // occurrences weighted by field weight
+	fieldMask uint64
+	positions []int
+}
+
+type document struct {
+	id      uint32
+	key     string
+	values  map[string]interface{} // attribute name -> string or float64
+	terms   []string
+	tags    map[string][]string
+	numbers map[string][]float64
+	vectors map[string][]float32
+	length  int
+}
+
+// Index is a secondary index over the hash or JSON keys matching a set of
+// prefixes.
+type Index struct {
+	def       *IndexDefinition
+	stopwords map[string]bool
+	stemming  bool
+
+	mu          sync.RWMutex
+	nextID      uint32
+	docs        map[uint32]*document
+	keys        map[string]*document
+	terms       map[string]map[uint32]*posting
+	termsMu     sync.Mutex // guards the lazily sorted term list under the read lock
+	sortedTerms []string
+	termsDirty  bool
+	tags        map[string]map[string]map[uint32]struct{}
+	numeric     map[string]*rangeTree
+	geo         map[string]map[uint32]geoPoint
+	vectors     map[string]vectorIndex
+	totalLength int
+}
+
+func newIndex(def *IndexDefinition) *Index {
+	idx := &Index{
+		def:       def,
+		stopwords: stopwordSet(def.Stopwords),
+		stemming:  def.Language == "" || def.Language == "english",
+		docs:      make(map[uint32]*document),
+		keys:      make(map[string]*document),
+		terms:     make(map[string]map[uint32]*posting),
+		tags:      make(map[string]map[string]map[uint32]struct{}),
+		numeric:   make(map[string]*rangeTree),
+		geo:       make(map[string]map[uint32]geoPoint),
+		vectors:   make(map[string]vectorIndex),
+	}
+	for _, f := range def.Fields {
+		switch f.Type {
+		case TagField:
+			idx.tags[f.Name] = make(map[string]map[uint32]struct{})
+		case NumericField:
+			idx.numeric[f.Name] = newRangeTree()
+		case GeoField:
+			idx.geo[f.Name] = make(map[uint32]geoPoint)
+		case VectorField:
+			idx.vectors[f.Name] = newVectorIndex(f.Vector)
+		}
+	}
+	return idx
+}
+
+// Definition returns the definition the index was created with.
+func (idx *Index) Definition() *IndexDefinition {
+	return idx.def
+}
+
+// textFieldMask returns the bit identifying a TEXT attribute in postings.
+func (idx *Index) textFieldMask(name string) uint64 {
+	bit := 0
+	for _, f := range idx.def.Fields {
+		if f.Type != TextField {
+			continue
+		}
+		if strings.EqualFold(f.Name, name) {
+			return 1 << uint(bit%64)
+		}
+		bit++
+	}
+	return 0
+}
+
+// extract returns the raw values of f in a hash or JSON document.
+func (f *Field) extract(hash map[string]string, doc interface{}) []interface{} {
+	if f.path == nil {
+		if v, ok := hash[f.Identifier]; ok {
+			return []interface{}{v}
+		}
+		return nil
+	}
+
+	var values []interface{}
+	for _, v := range f.path.Query(doc) {
+		// Arrays of scalars are indexed element by element
+		if arr, ok := v.([]interface{}); ok && f.Type != GeoField && f.Type != VectorField {
+			values = append(values, arr...)
+		} else {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func stringValue(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	return "", false
+}
+
+func numberValue(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return n, err == nil && !math.IsNaN(n)
+	}
+	return 0, false
+}
+
+func parseGeoValue(v interface{}) (geoPoint, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return geoPoint{}, false
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return geoPoint{}, false
+	}
+	lon, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lat, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || lon < -180 || lon > 180 || lat < -85.05112878 || lat > 85.05112878 {
+		return geoPoint{}, false
+	}
+	return geoPoint{lon: lon, lat: lat}, true
+}
+
+// normalizeTag trims a tag and folds its case unless the field is case
+// sensitive.
+func (f *Field) normalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if !f.CaseSensitive {
+		tag = strings.ToLower(tag)
+	}
+	return tag
+}
+
+// putLocked indexes a document, replacing any previous version of key. The
+// caller holds idx.mu.
+func (idx *Index) putLocked(key string, hash map[string]string, raw interface{}) {
+	idx.removeLocked(key)
+
+	idx.nextID++
+	doc := &document{
+		id:      idx.nextID,
+		key:     key,
+		values:  make(map[string]interface{}),
+		tags:    make(map[string][]string),
+		numbers: make(map[string][]float64),
+		vectors: make(map[string][]float32),
+	}
+
+	offset := 0
+	bit := 0
+	for _, f := range idx.def.Fields {
+		values := f.extract(hash, raw)
+		mask := uint64(0)
+		if f.Type == TextField {
+			mask = 1 << uint(bit%64)
+			bit++
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		switch f.Type {
+		case TextField:
+			if s, ok := stringValue(values[0]); ok {
+				doc.values[f.Name] = s
+			}
+			if f.NoIndex {
+				continue
+			}
+			for _, v := range values {
+				s, ok := stringValue(v)
+				if !ok {
+					continue
+				}
+				tokens := tokenize(s, idx.stopwords)
+				for _, tok := range tokens {
+					idx.addTerm(doc, tok.term, offset+tok.pos, f.Weight, mask)
+					if idx.stemming && !f.NoStem {
+						if stem := Stem(tok.term); stem != tok.term {
+							idx.addTerm(doc, "+"+stem, offset+tok.pos, f.Weight, mask)
+						}
+					}
+				}
+				doc.length += len(tokens)
+				offset += len(tokens) + fieldGap
+			}
+
+		case TagField:
+			var all []string
+			for _, v := range values {
+				s, ok := stringValue(v)
+				if !ok {
+					continue
+				}
+				parts := []string{s}
+				if f.path == nil {
+					parts = strings.Split(s, f.Separator)
+				}
+				for _, p := range parts {
+					if tag := f.normalizeTag(p); tag != "" {
+						all = append(all, tag)
+					}
+				}
+			}
+			if len(all) == 0 {
+				continue
+			}
+			doc.values[f.Name] = strings.Join(all, f.Separator)
+			if f.NoIndex {
+				continue
+			}
+			for _, tag := range all {
+				docs := idx.tags[f.Name][tag]
+				if docs == nil {
+					docs = make(map[uint32]struct{})
+					idx.tags[f.Name][tag] = docs
+				}
+				docs[doc.id] = struct{}{}
+			}
+			doc.tags[f.Name] = all
+
+		case NumericField:
+			var nums []float64
+			for _, v := range values {
+				if n, ok := numberValue(v); ok {
+					nums = append(nums, n)
+				}
+			}
+			if len(nums) == 0 {
+				continue
+			}
+			doc.values[f.Name] = nums[0]
+			if f.NoIndex {
+				continue
+			}
+			for _, n := range nums {
+				idx.numeric[f.Name].insert(n, doc.id)
+			}
+			doc.numbers[f.Name] = nums
+
+		case GeoField:
+			p, ok := parseGeoValue(values[0])
+			if !ok {
+				continue
+			}
+			doc.values[f.Name] = values[0]
+			if !f.NoIndex {
+				idx.geo[f.Name][doc.id] = p
+			}
+
+		case VectorField:
+			vec, ok := f.Vector.parseVector(values[0])
+			if !ok || f.NoIndex {
+				continue
+			}
+			vec = f.Vector.prepare(vec)
+			idx.vectors[f.Name].add(doc.id, vec)
+			doc.vectors[f.Name] = vec
+		}
+	}
+
+	idx.docs[doc.id] = doc
+	idx.keys[key] = doc
+	idx.totalLength += doc.length
+}
+
+func (idx *Index) addTerm(doc *document, term string, pos int, weight float64, mask uint64) {
+	postings := idx.terms[term]
+	if postings == nil {
+		postings = make(map[uint32]*posting)
+		idx.terms[term] = postings
+		idx.termsDirty = true
+	}
+	p := postings[doc.id]
+	if p == nil {
+		p = &posting{}
+		postings[doc.id] = p
+		doc.terms = append(doc.terms, term)
+	}
+	p.freq += weight
+	p.fieldMask |= mask
+	p.positions = append(p.positions, pos)
+}
+
+func (idx *Index) removeLocked(key string) {
+	doc, ok := idx.keys[key]
+	if !ok {
+		return
+	}
+
+	for _, term := range doc.terms {
+		postings := idx.terms[term]
+		delete(postings, doc.id)
+		if len(postings) == 0 {
+			delete(idx.terms, term)
+			idx.termsDirty = true
+		}
+	}
+	for field, tags := range doc.tags {
+		for _, tag := range tags {
+			docs := idx.tags[field][tag]
+			delete(docs, doc.id)
+			if len(docs) == 0 {
+				delete(idx.tags[field], tag)
+			}
+		}
+	}
+	for field, nums := range doc.numbers {
+		for _, n := range nums {
+			idx.numeric[field].remove(n, doc.id)
+		}
+	}
+	for _, points := range idx.geo {
+		delete(points, doc.id)
+	}
+	for field := range doc.vectors {
+		idx.vectors[field].remove(doc.id)
+	}
+
+	idx.totalLength -= doc.length
+	delete(idx.docs, doc.id)
+	delete(idx.keys, key)
+}
+
+// clear drops every document.
+func (idx *Index) clear() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for key := range idx.keys {
+		idx.removeLocked(key)
+	}
+}
+
+// keyList returns the keys of all indexed documents.
+func (idx *Index) keyList() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keys := make([]string, 0, len(idx.keys))
+	for key := range idx.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// termList returns the indexed terms in sorted order. It is called with at
+// least the read lock held; the list is rebuilt lazily after writes.
+func (idx *Index) termList() []string {
+	idx.termsMu.Lock()
+	defer idx.termsMu.Unlock()
+
+	if idx.termsDirty || idx.sortedTerms == nil {
+		terms := make([]string, 0, len(idx.terms))
+		for t := range idx.terms {
+			terms = append(terms, t)
+		}
+		sort.Strings(terms)
+		idx.sortedTerms = terms
+		idx.termsDirty = false
+	}
+	return idx.sortedTerms
+}
+
+// bm25 scores one term occurrence list against its document.
+func (idx *Index) bm25(docFreq int, p *posting, doc *document) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+	avgLen := 1.0
+	if len(idx.docs) > 0 && idx.totalLength > 0 {
+		avgLen = float64(idx.totalLength) / n
+	}
+	tf := p.freq
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLen))
+}
@@ -0,0 +1,147 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// knnQuery is the vector part of a hybrid query:
+//
+//	filter=>[KNN k @field $blob [EF_RUNTIME ef] [AS alias]]
+type knnQuery struct {
+	k     int
+	field string
+	blob  string
+	ef    int
+	alias string
+}
+
+// bruteForceLimit is the filtered set size below which a hybrid query scans
+// the matching vectors instead of searching the HNSW graph.
+const bruteForceLimit = 1000
+
+// splitKNN separates the pre-filter from a trailing KNN clause. Queries
+// without one are returned unchanged with a nil clause.
+func splitKNN(src string, params map[string]string) (string, *knnQuery, error) {
+	arrow := strings.LastIndex(src, "=>")
+	if arrow < 0 {
+		return src, nil, nil
+	}
+	clause := strings.TrimSpace(src[arrow+2:])
+	if !strings.HasPrefix(clause, "[") || !strings.HasSuffix(clause, "]") {
+		return src, nil, nil
+	}
+	filter := strings.TrimSpace(src[:arrow])
+	if filter == "" {
+		return "", nil, fmt.Errorf("Syntax error: missing KNN pre-filter")
+	}
+
+	args := strings.Fields(clause[1 : len(clause)-1])
+	resolve := func(s string) (string, error) {
+		if !strings.HasPrefix(s, "$") {
+			return s, nil
+		}
+		v, ok := params[s[1:]]
+		if !ok {
+			return "", fmt.Errorf("No such parameter `%s`", s[1:])
+		}
+		return v, nil
+	}
+
+	if len(args) < 4 || !strings.EqualFold(args[0], "KNN") || !strings.HasPrefix(args[2], "@") || !strings.HasPrefix(args[3], "$") {
+		return "", nil, fmt.Errorf("Syntax error: expected [KNN k @field $blob]")
+	}
+	q := &knnQuery{field: args[2][1:]}
+	kArg, err := resolve(args[1])
+	if err != nil {
+		return "", nil, err
+	}
+	if q.k, err = strconv.Atoi(kArg); err != nil || q.k < 0 {
+		return "", nil, fmt.Errorf("Syntax error: invalid KNN k `%s`", kArg)
+	}
+	if q.blob, err = resolve(args[3]); err != nil {
+		return "", nil, err
+	}
+
+	for i := 4; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", nil, fmt.Errorf("Syntax error: %s requires a value", args[i])
+		}
+		value, err := resolve(args[i+1])
+		if err != nil {
+			return "", nil, err
+		}
+		switch strings.ToUpper(args[i]) {
+		case "EF_RUNTIME":
+			if q.ef, err = strconv.Atoi(value); err != nil || q.ef <= 0 {
+				return "", nil, fmt.Errorf("Syntax error: invalid EF_RUNTIME `%s`", value)
+			}
+		case "AS":
+			q.alias = value
+		default:
+			return "", nil, fmt.Errorf("Syntax error: unknown KNN argument `%s`", args[i])
+		}
+	}
+	if q.alias == "" {
+		q.alias = "__" + q.field + "_score"
+	}
+	return filter, q, nil
+}
+
+// knnSearch returns the k nearest documents among res, closest first, with
+// their distance as score. The caller holds the read lock.
+func (idx *Index) knnSearch(q *knnQuery, filterAll bool, res resultSet) ([]scoredDoc, error) {
+	f := idx.def.Field(q.field)
+	if f == nil {
+		return nil, fmt.Errorf("Unknown field `%s`", q.field)
+	}
+	if f.Type != VectorField {
+		return nil, fmt.Errorf("Field `%s` is not a VECTOR field", q.field)
+	}
+	vec, ok := decodeVectorBlob(q.blob, f.Vector.Dim)
+	if !ok {
+		return nil, fmt.Errorf("Error parsing vector similarity query: query vector blob size (%d) does not match index's expected size (%d).",
+			len(q.blob), 4*f.Vector.Dim)
+	}
+	vec = f.Vector.prepare(vec)
+
+	vi := idx.vectors[f.Name]
+	ef := q.ef
+	if ef == 0 {
+		ef = f.Vector.EFRuntime
+	}
+
+	var hits []vectorHit
+	switch {
+	case filterAll:
+		hits = vi.search(vec, q.k, ef, nil)
+	case len(res) <= bruteForceLimit || len(res)*20 < vi.len():
+		// Small filtered sets are cheaper and exact to scan directly
+		hits = bruteForce(vec, q.k, f.Vector.distance(), nil, func(fn func(uint32, []float32)) {
+			for id := range res {
+				if v, ok := idx.docs[id].vectors[f.Name]; ok {
+					fn(id, v)
+				}
+			}
+		})
+	default:
+		hits = vi.search(vec, q.k, ef, func(id uint32) bool {
+			_, ok := res[id]
+			return ok
+		})
+	}
+
+	docs := make([]scoredDoc, len(hits))
+	for i, h := range hits {
+		docs[i] = scoredDoc{id: h.id, key: idx.docs[h.id].key, score: distValue(h.dist)}
+	}
+	return docs, nil
+}
+
+// distValue widens a distance, dropping the spurious digits float32 values
+// gain as float64.
+func distValue(d float32) float64 {
+	v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(d), 'g', -1, 32), 64)
+	return v
+}
@@ -0,0 +1,134 @@
+package search
+
+import "sort"
+
+// maxRangeLeaf is the number of entries a leaf holds before it is split.
+const maxRangeLeaf = 64
+
+type numericEntry struct {
+	value float64
+	doc   uint32
+}
+
+// rangeNode is a node of a numeric range tree. Leaves hold entries; inner
+// nodes send values below split to the left and the rest to the right.
+type rangeNode struct {
+	split       float64
+	left, right *rangeNode
+	entries     []numericEntry
+}
+
+// rangeTree indexes numeric values for range queries. Leaves are split at
+// their median once they grow past maxRangeLeaf entries.
+type rangeTree struct {
+	root *rangeNode
+	size int
+}
+
+func newRangeTree() *rangeTree {
+	return &rangeTree{root: &rangeNode{}}
+}
+
+func (n *rangeNode) leaf() bool {
+	return n.left == nil
+}
+
+func (t *rangeTree) insert(value float64, doc uint32) {
+	n := t.root
+	for !n.leaf() {
+		if value < n.split {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	n.entries = append(n.entries, numericEntry{value: value, doc: doc})
+	t.size++
+	if len(n.entries) > maxRangeLeaf {
+		n.splitLeaf()
+	}
+}
+
+// splitLeaf turns a full leaf into an inner node. A leaf whose entries all
+// share one value cannot be split and simply keeps growing.
+func (n *rangeNode) splitLeaf() {
+	sort.Slice(n.entries, func(i, j int) bool { return n.entries[i].value < n.entries[j].value })
+	mid := len(n.entries) / 2
+	split := n.entries[mid].value
+	// Move the split point to the first entry holding the median value so
+	// that equal values end up on the same side.
+	for mid > 0 && n.entries[mid-1].value == split {
+		mid--
+	}
+	if mid == 0 {
+		for mid < len(n.entries) && n.entries[mid].value == split {
+			mid++
+		}
+		if mid == len(n.entries) {
+			return
+		}
+		split = n.entries[mid].value
+	}
+
+	n.split = split
+	n.left = &rangeNode{entries: append([]numericEntry(nil), n.entries[:mid]...)}
+	n.right = &rangeNode{entries: append([]numericEntry(nil), n.entries[mid:]...)}
+	n.entries = nil
+}
+
+func (t *rangeTree) remove(value float64, doc uint32) {
+	n := t.root
+	for !n.leaf() {
+		if value < n.split {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	for i, e := range n.entries {
+		if e.doc == doc && e.value == value {
+			n.entries[i] = n.entries[len(n.entries)-1]
+			n.entries = n.entries[:len(n.entries)-1]
+			t.size--
+			return
+		}
+	}
+}
+
+// numericRange is an interval with optionally exclusive bounds.
+type numericRange struct {
+	min, max         float64
+	minExcl, maxExcl bool
+}
+
+func (r numericRange) contains(v float64) bool {
+	if v < r.min || r.minExcl && v == r.min {
+		return false
+	}
+	if v > r.max || r.maxExcl && v == r.max {
+		return false
+	}
+	return true
+}
+
+// search calls fn for every entry within r.
+func (t *rangeTree) search(r numericRange, fn func(doc uint32)) {
+	var visit func(n *rangeNode)
+	visit = func(n *rangeNode) {
+		if n.leaf() {
+			for _, e := range n.entries {
+				if r.contains(e.value) {
+					fn(e.doc)
+				}
+			}
+			return
+		}
+		if r.min < n.split {
+			visit(n.left)
+		}
+		if r.max >= n.split {
+			visit(n.right)
+		}
+	}
+	visit(t.root)
+}
@@ -0,0 +1,492 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Query AST. Text nodes are resolved against the inverted index; the other
+// nodes filter on TAG, NUMERIC and GEO attributes.
+type queryNode interface{}
+
+type allNode struct{}
+
+type termNode struct {
+	term   string
+	prefix bool
+	fuzzy  int // maximum edit distance, 0 for exact terms
+}
+
+type phraseNode struct {
+	terms []string
+}
+
+type intersectNode struct {
+	children []queryNode
+}
+
+type unionNode struct {
+	children []queryNode
+}
+
+type notNode struct {
+	child queryNode
+}
+
+// fieldNode restricts the text nodes below it to the named attributes.
+type fieldNode struct {
+	fields []string
+	child  queryNode
+}
+
+type numericNode struct {
+	field string
+	r     numericRange
+}
+
+type tagTerm struct {
+	value  string
+	prefix bool
+}
+
+type tagNode struct {
+	field string
+	tags  []tagTerm
+}
+
+type geoNode struct {
+	field    string
+	lon, lat float64
+	radius   float64 // meters
+}
+
+// queryParser parses the RediSearch query syntax:
+//
+//	hello world          intersection
+//	hello | world        union
+//	-hello               negation
+//	"hello world"        exact phrase
+//	hel*  %helo%         prefix and fuzzy (one % per edit) terms
+//	@title:hello         attribute restriction, also @a|b:(...)
+//	@price:[10 (20]      numeric range, -inf and +inf allowed
+//	@tags:{a | b*}       tag match
+//	@loc:[lon lat r km]  geo radius
+//	*                    every document
+type queryParser struct {
+	src       string
+	pos       int
+	params    map[string]string
+	stopwords map[string]bool
+}
+
+func parseQuery(src string, params map[string]string, stopwords map[string]bool) (queryNode, error) {
+	p := &queryParser{src: src, params: params, stopwords: stopwords}
+	p.skipSpace()
+	if p.pos == len(p.src) {
+		return nil, fmt.Errorf("Syntax error: empty query")
+	}
+	node, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.src) {
+		return nil, p.errorf("unexpected '%c'", p.src[p.pos])
+	}
+	if node == nil {
+		// Only stopwords: nothing can match
+		return &unionNode{}, nil
+	}
+	return node, nil
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Syntax error at offset %d near %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *queryParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *queryParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.errorf("expected '%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *queryParser) parseUnion() (queryNode, error) {
+	var children []queryNode
+	for {
+		node, err := p.parseIntersect()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, node)
+		}
+		p.skipSpace()
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return &unionNode{children: children}, nil
+}
+
+func (p *queryParser) parseIntersect() (queryNode, error) {
+	var children []queryNode
+	for {
+		p.skipSpace()
+		if c := p.peek(); c == 0 || c == '|' || c == ')' {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, node)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return &intersectNode{children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case '-':
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	case '~':
+		// Optional terms only affect scoring; treat them as required
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (queryNode, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		node, err := p.parseUnion()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(')')
+	case c == '@':
+		return p.parseField()
+	case c == '"':
+		return p.parsePhrase()
+	case c == '*' && (p.pos+1 == len(p.src) || !p.isWordByte(p.pos+1)):
+		p.pos++
+		return &allNode{}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) isWordByte(i int) bool {
+	r, _ := utf8.DecodeRuneInString(p.src[i:])
+	return isTokenRune(r) || r == '\\' || r == '$'
+}
+
+// readWord reads a run of word characters, honouring backslash escapes.
+func (p *queryParser) readWord() string {
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) {
+			r, size := utf8.DecodeRuneInString(p.src[p.pos+1:])
+			b.WriteRune(r)
+			p.pos += 1 + size
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !isTokenRune(r) {
+			break
+		}
+		b.WriteRune(r)
+		p.pos += size
+	}
+	return b.String()
+}
+
+// readParam resolves $name against the PARAMS of the query.
+func (p *queryParser) readParam() (string, error) {
+	p.pos++
+	name := p.readWord()
+	v, ok := p.params[name]
+	if !ok {
+		return "", fmt.Errorf("No such parameter `%s`", name)
+	}
+	return v, nil
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	fuzzy := 0
+	for p.peek() == '%' {
+		fuzzy++
+		p.pos++
+	}
+
+	var word string
+	if p.peek() == '$' {
+		v, err := p.readParam()
+		if err != nil {
+			return nil, err
+		}
+		word = v
+	} else {
+		word = p.readWord()
+	}
+	if word == "" {
+		if p.pos < len(p.src) {
+			return nil, p.errorf("'%c'", p.src[p.pos])
+		}
+		return nil, p.errorf("end of query")
+	}
+	word = strings.ToLower(word)
+
+	if fuzzy > 0 {
+		for i := 0; i < fuzzy; i++ {
+			if p.peek() != '%' {
+				return nil, p.errorf("unbalanced fuzzy term")
+			}
+			p.pos++
+		}
+		if fuzzy > 3 {
+			return nil, p.errorf("fuzzy distance too large")
+		}
+		return &termNode{term: word, fuzzy: fuzzy}, nil
+	}
+
+	if p.peek() == '*' {
+		p.pos++
+		return &termNode{term: word, prefix: true}, nil
+	}
+	if p.stopwords[word] {
+		return nil, nil
+	}
+	return &termNode{term: word}, nil
+}
+
+func (p *queryParser) parsePhrase() (queryNode, error) {
+	p.pos++ // opening quote
+	end := strings.IndexByte(p.src[p.pos:], '"')
+	if end < 0 {
+		return nil, p.errorf("unterminated phrase")
+	}
+	text := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	var terms []string
+	for _, tok := range tokenize(text, p.stopwords) {
+		terms = append(terms, tok.term)
+	}
+	switch len(terms) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &termNode{term: terms[0]}, nil
+	}
+	return &phraseNode{terms: terms}, nil
+}
+
+func (p *queryParser) parseField() (queryNode, error) {
+	p.pos++ // '@'
+	var fields []string
+	for {
+		name := p.readWord()
+		if name == "" {
+			return nil, p.errorf("expected attribute name")
+		}
+		fields = append(fields, name)
+		if p.peek() != '|' {
+			break
+		}
+		p.pos++
+	}
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+
+	switch p.peek() {
+	case '[':
+		if len(fields) != 1 {
+			return nil, p.errorf("range on several attributes")
+		}
+		return p.parseRange(fields[0])
+	case '{':
+		if len(fields) != 1 {
+			return nil, p.errorf("tags on several attributes")
+		}
+		return p.parseTags(fields[0])
+	}
+
+	child, err := p.parseUnary()
+	if err != nil || child == nil {
+		return nil, err
+	}
+	return &fieldNode{fields: fields, child: child}, nil
+}
+
+// rangeArgs reads the whitespace separated values between [ and ].
+func (p *queryParser) rangeArgs() ([]string, error) {
+	p.pos++ // '['
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return nil, p.errorf("unterminated range")
+	}
+	args := strings.Fields(p.src[p.pos : p.pos+end])
+	p.pos += end + 1
+	for i, a := range args {
+		if strings.HasPrefix(a, "$") {
+			v, ok := p.params[a[1:]]
+			if !ok {
+				return nil, fmt.Errorf("No such parameter `%s`", a[1:])
+			}
+			args[i] = v
+		}
+	}
+	return args, nil
+}
+
+func (p *queryParser) parseRange(field string) (queryNode, error) {
+	args, err := p.rangeArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(args) {
+	case 2:
+		r := numericRange{}
+		if r.min, r.minExcl, err = parseRangeBound(args[0]); err != nil {
+			return nil, err
+		}
+		if r.max, r.maxExcl, err = parseRangeBound(args[1]); err != nil {
+			return nil, err
+		}
+		return &numericNode{field: field, r: r}, nil
+	case 4:
+		lon, err1 := strconv.ParseFloat(args[0], 64)
+		lat, err2 := strconv.ParseFloat(args[1], 64)
+		radius, err3 := strconv.ParseFloat(args[2], 64)
+		meters, ok := unitToMeters(args[3])
+		if err1 != nil || err2 != nil || err3 != nil || !ok || radius < 0 {
+			return nil, fmt.Errorf("Invalid GeoFilter")
+		}
+		return &geoNode{field: field, lon: lon, lat: lat, radius: radius * meters}, nil
+	}
+	return nil, p.errorf("expected numeric or geo range")
+}
+
+func parseRangeBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "inf", "+inf":
+		return math.Inf(1), exclusive, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("Expected a number in numeric range, got `%s`", s)
+	}
+	return v, exclusive, nil
+}
+
+func unitToMeters(unit string) (float64, bool) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, true
+	case "km":
+		return 1000, true
+	case "mi":
+		return 1609.34, true
+	case "ft":
+		return 0.3048, true
+	}
+	return 0, false
+}
+
+func (p *queryParser) parseTags(field string) (queryNode, error) {
+	p.pos++ // '{'
+	node := &tagNode{field: field}
+	var cur strings.Builder
+	flush := func() {
+		value := strings.TrimSpace(cur.String())
+		cur.Reset()
+		if value == "" {
+			return
+		}
+		t := tagTerm{value: value}
+		if strings.HasSuffix(value, "*") {
+			t.value = strings.TrimSuffix(value, "*")
+			t.prefix = true
+		}
+		if strings.HasPrefix(t.value, "$") {
+			if v, ok := p.params[t.value[1:]]; ok {
+				t.value = v
+			}
+		}
+		node.tags = append(node.tags, t)
+	}
+
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.src):
+			cur.WriteByte(p.src[p.pos+1])
+			p.pos += 2
+			continue
+		case c == '|':
+			flush()
+		case c == '}':
+			flush()
+			p.pos++
+			if len(node.tags) == 0 {
+				return nil, p.errorf("empty tag list")
+			}
+			return node, nil
+		default:
+			cur.WriteByte(c)
+		}
+		p.pos++
+	}
+	return nil, p.errorf("unterminated tag list")
+}
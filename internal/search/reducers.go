@@ -0,0 +1,272 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reducer accumulates the rows of one group.
+type reducer interface {
+	add(row *Row)
+	result() interface{}
+}
+
+// newReducer validates a REDUCE clause and returns a fresh accumulator.
+func newReducer(spec *reducerSpec) (reducer, error) {
+	arity := func(n int) error {
+		if len(spec.args) != n {
+			return fmt.Errorf("Bad arguments for reducer %s: expected %d arguments", spec.name, n)
+		}
+		return nil
+	}
+	field := func() (string, error) {
+		if len(spec.args) == 0 {
+			return "", fmt.Errorf("Bad arguments for reducer %s: missing property", spec.name)
+		}
+		return property(spec.args[0])
+	}
+
+	switch spec.name {
+	case "COUNT":
+		if err := arity(0); err != nil {
+			return nil, err
+		}
+		return &countReducer{}, nil
+	case "COUNT_DISTINCT", "COUNT_DISTINCTISH":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		return &distinctReducer{field: name, seen: make(map[string]struct{})}, nil
+	case "SUM", "MIN", "MAX", "AVG", "STDDEV":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		return &numericReducer{fn: spec.name, field: name, min: math.Inf(1), max: math.Inf(-1)}, nil
+	case "QUANTILE":
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		q, err := strconv.ParseFloat(spec.args[1], 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, fmt.Errorf("Quantile must be between 0 and 1")
+		}
+		return &quantileReducer{field: name, q: q}, nil
+	case "TOLIST":
+		if err := arity(1); err != nil {
+			return nil, err
+		}
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		return &toListReducer{field: name, seen: make(map[string]struct{})}, nil
+	case "FIRST_VALUE":
+		r := &firstValueReducer{}
+		switch len(spec.args) {
+		case 1, 3, 4:
+		default:
+			return nil, fmt.Errorf("Bad arguments for reducer FIRST_VALUE")
+		}
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		r.field = name
+		if len(spec.args) >= 3 {
+			if !strings.EqualFold(spec.args[1], "BY") {
+				return nil, fmt.Errorf("Bad arguments for reducer FIRST_VALUE: expected BY")
+			}
+			if r.by, err = property(spec.args[2]); err != nil {
+				return nil, err
+			}
+			r.asc = true
+			if len(spec.args) == 4 {
+				switch strings.ToUpper(spec.args[3]) {
+				case "ASC":
+				case "DESC":
+					r.asc = false
+				default:
+					return nil, fmt.Errorf("Bad arguments for reducer FIRST_VALUE: expected ASC or DESC")
+				}
+			}
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("Unknown reducer `%s`", spec.name)
+}
+
+type countReducer struct {
+	n int
+}
+
+func (r *countReducer) add(*Row)            { r.n++ }
+func (r *countReducer) result() interface{} { return float64(r.n) }
+
+type distinctReducer struct {
+	field string
+	seen  map[string]struct{}
+}
+
+func (r *distinctReducer) add(row *Row) {
+	if v, _ := row.Get(r.field); v != nil {
+		r.seen[FormatValue(v)] = struct{}{}
+	}
+}
+
+func (r *distinctReducer) result() interface{} { return float64(len(r.seen)) }
+
+// numericReducer implements SUM, MIN, MAX, AVG and STDDEV, skipping values
+// that are not numbers.
+type numericReducer struct {
+	fn         string
+	field      string
+	n          int
+	sum, sumSq float64
+	min, max   float64
+}
+
+func (r *numericReducer) add(row *Row) {
+	v, _ := row.Get(r.field)
+	n, ok := toNumber(v)
+	if !ok {
+		return
+	}
+	r.n++
+	r.sum += n
+	r.sumSq += n * n
+	r.min = math.Min(r.min, n)
+	r.max = math.Max(r.max, n)
+}
+
+func (r *numericReducer) result() interface{} {
+	switch r.fn {
+	case "SUM":
+		return r.sum
+	case "MIN":
+		if r.n == 0 {
+			return nil
+		}
+		return r.min
+	case "MAX":
+		if r.n == 0 {
+			return nil
+		}
+		return r.max
+	case "AVG":
+		if r.n == 0 {
+			return float64(0)
+		}
+		return r.sum / float64(r.n)
+	}
+	// Sample standard deviation, as RediSearch computes it
+	if r.n < 2 {
+		return float64(0)
+	}
+	mean := r.sum / float64(r.n)
+	variance := (r.sumSq - float64(r.n)*mean*mean) / float64(r.n-1)
+	return math.Sqrt(math.Max(variance, 0))
+}
+
+type quantileReducer struct {
+	field  string
+	q      float64
+	values []float64
+}
+
+func (r *quantileReducer) add(row *Row) {
+	v, _ := row.Get(r.field)
+	if n, ok := toNumber(v); ok {
+		r.values = append(r.values, n)
+	}
+}
+
+func (r *quantileReducer) result() interface{} {
+	if len(r.values) == 0 {
+		return nil
+	}
+	sort.Float64s(r.values)
+	pos := r.q * float64(len(r.values)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return r.values[lo] + (r.values[hi]-r.values[lo])*(pos-float64(lo))
+}
+
+// toListReducer collects the distinct values of a property.
+type toListReducer struct {
+	field  string
+	seen   map[string]struct{}
+	values []interface{}
+}
+
+func (r *toListReducer) add(row *Row) {
+	v, _ := row.Get(r.field)
+	if v == nil {
+		return
+	}
+	key := FormatValue(v)
+	if _, dup := r.seen[key]; dup {
+		return
+	}
+	r.seen[key] = struct{}{}
+	r.values = append(r.values, v)
+}
+
+func (r *toListReducer) result() interface{} {
+	if r.values == nil {
+		return []interface{}{}
+	}
+	return r.values
+}
+
+type firstValueReducer struct {
+	field string
+	by    string
+	asc   bool
+
+	value interface{}
+	key   interface{}
+	set   bool
+}
+
+func (r *firstValueReducer) add(row *Row) {
+	v, _ := row.Get(r.field)
+	if r.by == "" {
+		if !r.set {
+			r.value, r.set = v, true
+		}
+		return
+	}
+	k, _ := row.Get(r.by)
+	if k == nil {
+		if !r.set {
+			r.value, r.set = v, true
+		}
+		return
+	}
+	k = sortable(k)
+	if !r.set || r.key == nil {
+		r.value, r.key, r.set = v, k, true
+		return
+	}
+	c := compareValues(k, r.key)
+	if r.asc && c < 0 || !r.asc && c > 0 {
+		r.value, r.key = v, k
+	}
+}
+
+func (r *firstValueReducer) result() interface{} { return r.value }
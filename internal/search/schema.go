@@ -0,0 +1,274 @@
+// Package search implements secondary indexes over hash and JSON keys and
+// the query engine behind FT.SEARCH and FT.AGGREGATE.
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
+)
+
+// SourceType is the kind of key an index covers.
+type SourceType int
+
+const (
+	OnHash SourceType = iota
+	OnJSON
+)
+
+func (t SourceType) String() string {
+	if t == OnJSON {
+		return "JSON"
+	}
+	return "HASH"
+}
+
+// FieldType is the type of an indexed attribute.
+type FieldType int
+
+const (
+	TextField FieldType = iota
+	TagField
+	NumericField
+	GeoField
+	VectorField
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case TagField:
+		return "TAG"
+	case NumericField:
+		return "NUMERIC"
+	case GeoField:
+		return "GEO"
+	case VectorField:
+		return "VECTOR"
+	}
+	return "TEXT"
+}
+
+// Field describes one attribute of an index schema.
+type Field struct {
+	// Identifier is the hash field name or JSON path the value is read from.
+	Identifier string
+	// Name is the attribute name used in queries; it defaults to Identifier.
+	Name string
+	Type FieldType
+
+	Weight        float64 // TEXT
+	NoStem        bool    // TEXT
+	Separator     string  // TAG
+	CaseSensitive bool    // TAG
+	Sortable      bool
+	NoIndex       bool
+	Vector        *VectorParams // VECTOR
+
+	path *jsonUtil.Path
+}
+
+// IndexDefinition is the parsed form of an FT.CREATE command.
+type IndexDefinition struct {
+	Name      string
+	On        SourceType
+	Prefixes  []string
+	Language  string
+	Stopwords []string // nil means the default list
+	Fields    []*Field
+}
+
+// Field returns the attribute called name, matching case-insensitively
+// as RediSearch does.
+func (d *IndexDefinition) Field(name string) *Field {
+	for _, f := range d.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// matches reports whether key is covered by the index prefixes.
+func (d *IndexDefinition) matches(key string) bool {
+	if len(d.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range d.Prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCreate parses the arguments of FT.CREATE, starting with the index
+// name:
+//
+//	index [ON HASH|JSON] [PREFIX count prefix ...] [LANGUAGE lang]
+//	      [STOPWORDS count word ...] SCHEMA field [AS alias] type [options] ...
+func ParseCreate(args []string) (*IndexDefinition, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("wrong number of arguments for 'FT.CREATE' command")
+	}
+	def := &IndexDefinition{Name: args[0], Language: "english"}
+
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "ON":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("ON requires HASH or JSON")
+			}
+			i++
+			switch strings.ToUpper(args[i]) {
+			case "HASH":
+				def.On = OnHash
+			case "JSON":
+				def.On = OnJSON
+			default:
+				return nil, fmt.Errorf("Unknown argument `%s`", args[i])
+			}
+		case "PREFIX":
+			values, next, err := countedArgs(args, i, "PREFIX")
+			if err != nil {
+				return nil, err
+			}
+			def.Prefixes = values
+			i = next
+		case "LANGUAGE":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("LANGUAGE requires an argument")
+			}
+			i++
+			def.Language = strings.ToLower(args[i])
+		case "STOPWORDS":
+			values, next, err := countedArgs(args, i, "STOPWORDS")
+			if err != nil {
+				return nil, err
+			}
+			def.Stopwords = append([]string{}, values...)
+			i = next
+		case "SCHEMA":
+			fields, err := parseSchema(args[i+1:], def.On)
+			if err != nil {
+				return nil, err
+			}
+			def.Fields = fields
+			return def, nil
+		default:
+			return nil, fmt.Errorf("Unknown argument `%s`", args[i])
+		}
+	}
+	return nil, fmt.Errorf("No schema found")
+}
+
+// countedArgs reads "NAME count v1 ... vN" starting at args[i] and returns
+// the values and the index of the last one consumed.
+func countedArgs(args []string, i int, name string) ([]string, int, error) {
+	if i+1 >= len(args) {
+		return nil, 0, fmt.Errorf("%s requires a count", name)
+	}
+	n, err := strconv.Atoi(args[i+1])
+	if err != nil || n < 0 || i+2+n > len(args) {
+		return nil, 0, fmt.Errorf("Bad arguments for %s: expected a valid count", name)
+	}
+	values := append([]string(nil), args[i+2:i+2+n]...)
+	return values, i + 1 + n, nil
+}
+
+func parseSchema(args []string, on SourceType) ([]*Field, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Fields arguments are missing")
+	}
+
+	var fields []*Field
+	seen := make(map[string]bool)
+	for i := 0; i < len(args); {
+		f := &Field{Identifier: args[i], Weight: 1, Separator: ","}
+		f.Name = f.Identifier
+		i++
+		if i+1 < len(args) && strings.EqualFold(args[i], "AS") {
+			f.Name = args[i+1]
+			i += 2
+		}
+		if i >= len(args) {
+			return nil, fmt.Errorf("Field `%s` has no type", f.Identifier)
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "TEXT":
+			f.Type = TextField
+		case "TAG":
+			f.Type = TagField
+		case "NUMERIC":
+			f.Type = NumericField
+		case "GEO":
+			f.Type = GeoField
+		case "VECTOR":
+			f.Type = VectorField
+			params, next, err := parseVectorParams(args, i+1)
+			if err != nil {
+				return nil, fmt.Errorf("%v for field `%s`", err, f.Name)
+			}
+			f.Vector = params
+			i = next
+		default:
+			return nil, fmt.Errorf("Invalid field type for field `%s`", f.Identifier)
+		}
+		i++
+
+	options:
+		for i < len(args) {
+			switch strings.ToUpper(args[i]) {
+			case "WEIGHT":
+				if f.Type != TextField || i+1 >= len(args) {
+					return nil, fmt.Errorf("Bad arguments for WEIGHT on field `%s`", f.Name)
+				}
+				w, err := strconv.ParseFloat(args[i+1], 64)
+				if err != nil || w < 0 {
+					return nil, fmt.Errorf("Bad arguments for WEIGHT on field `%s`", f.Name)
+				}
+				f.Weight = w
+				i += 2
+			case "NOSTEM":
+				f.NoStem = true
+				i++
+			case "SEPARATOR":
+				if f.Type != TagField || i+1 >= len(args) || len(args[i+1]) != 1 {
+					return nil, fmt.Errorf("Bad arguments for SEPARATOR on field `%s`", f.Name)
+				}
+				f.Separator = args[i+1]
+				i += 2
+			case "CASESENSITIVE":
+				f.CaseSensitive = true
+				i++
+			case "SORTABLE":
+				f.Sortable = true
+				i++
+			case "NOINDEX":
+				f.NoIndex = true
+				i++
+			default:
+				break options
+			}
+		}
+
+		key := strings.ToLower(f.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("Duplicate field in schema - %s", f.Name)
+		}
+		seen[key] = true
+
+		if on == OnJSON {
+			path, err := jsonUtil.CompilePath(f.Identifier)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JSONPath '%s' in attribute '%s'", f.Identifier, f.Name)
+			}
+			f.path = path
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
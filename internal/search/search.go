@@ -0,0 +1,343 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonUtil "github.com/genc-murat/crystalcache/pkg/utils/json"
+)
+
+// SearchOptions holds the options of an FT.SEARCH command.
+type SearchOptions struct {
+	NoContent  bool
+	Verbatim   bool
+	WithScores bool
+	Return     []string // nil returns every field
+	SortBy     string
+	SortDesc   bool
+	Offset     int
+	Limit      int
+	Params     map[string]string
+	Dialect    int
+}
+
+// Hit is one document of a search result.
+type Hit struct {
+	Key    string
+	Score  float64
+	Fields [][2]string
+}
+
+// SearchResult is the reply of FT.SEARCH.
+type SearchResult struct {
+	Total int
+	Hits  []Hit
+}
+
+// ParseSearch parses the arguments of FT.SEARCH following the index name:
+//
+//	query [NOCONTENT] [VERBATIM] [WITHSCORES] [RETURN count field ...]
+//	      [SORTBY field [ASC|DESC]] [LIMIT offset num]
+//	      [PARAMS count name value ...] [DIALECT n]
+func ParseSearch(args []string) (string, *SearchOptions, error) {
+	if len(args) < 1 {
+		return "", nil, fmt.Errorf("wrong number of arguments for 'FT.SEARCH' command")
+	}
+	opts := &SearchOptions{Limit: 10, Dialect: 1}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOCONTENT":
+			opts.NoContent = true
+		case "VERBATIM":
+			opts.Verbatim = true
+		case "WITHSCORES":
+			opts.WithScores = true
+		case "NOSTOPWORDS":
+			// Accepted for compatibility; stopwords are dropped at parse time
+		case "RETURN":
+			values, next, err := countedArgs(args, i, "RETURN")
+			if err != nil {
+				return "", nil, err
+			}
+			opts.Return = values
+			i = next
+		case "SORTBY":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("SORTBY requires a field")
+			}
+			i++
+			opts.SortBy = strings.TrimPrefix(args[i], "@")
+			if i+1 < len(args) {
+				switch strings.ToUpper(args[i+1]) {
+				case "ASC":
+					i++
+				case "DESC":
+					opts.SortDesc = true
+					i++
+				}
+			}
+		case "LIMIT":
+			offset, num, err := parseLimit(args, i)
+			if err != nil {
+				return "", nil, err
+			}
+			opts.Offset, opts.Limit = offset, num
+			i += 2
+		case "PARAMS":
+			params, next, err := parseParams(args, i)
+			if err != nil {
+				return "", nil, err
+			}
+			opts.Params = params
+			i = next
+		case "DIALECT":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("DIALECT requires an argument")
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 1 || n > 4 {
+				return "", nil, fmt.Errorf("DIALECT requires a value between 1 and 4")
+			}
+			opts.Dialect = n
+		default:
+			return "", nil, fmt.Errorf("Unknown argument `%s`", args[i])
+		}
+	}
+	return args[0], opts, nil
+}
+
+func parseLimit(args []string, i int) (int, int, error) {
+	if i+2 >= len(args) {
+		return 0, 0, fmt.Errorf("LIMIT requires offset and num")
+	}
+	offset, err1 := strconv.Atoi(args[i+1])
+	num, err2 := strconv.Atoi(args[i+2])
+	if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+		return 0, 0, fmt.Errorf("Bad arguments for LIMIT")
+	}
+	return offset, num, nil
+}
+
+func parseParams(args []string, i int) (map[string]string, int, error) {
+	values, next, err := countedArgs(args, i, "PARAMS")
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(values)%2 != 0 {
+		return nil, 0, fmt.Errorf("Bad arguments for PARAMS: expected an even number of arguments")
+	}
+	params := make(map[string]string, len(values)/2)
+	for j := 0; j < len(values); j += 2 {
+		params[values[j]] = values[j+1]
+	}
+	return params, next, nil
+}
+
+type scoredDoc struct {
+	id    uint32
+	key   string
+	score float64
+	sort  interface{}
+}
+
+// match evaluates a query under the read lock and returns the matching
+// documents in id order, or closest first for KNN queries.
+func (idx *Index) match(query string, params map[string]string, verbatim bool) ([]scoredDoc, *knnQuery, error) {
+	filter, knn, err := splitKNN(query, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	node, err := parseQuery(filter, params, idx.stopwords)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ev := &evaluator{idx: idx, verbatim: verbatim}
+	res, err := ev.eval(node, allTextFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	if knn != nil {
+		_, all := node.(*allNode)
+		docs, err := idx.knnSearch(knn, all, res)
+		return docs, knn, err
+	}
+
+	docs := make([]scoredDoc, 0, len(res))
+	for id, score := range res {
+		docs = append(docs, scoredDoc{id: id, key: idx.docs[id].key, score: score})
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].id < docs[j].id })
+	return docs, nil, nil
+}
+
+// search runs an FT.SEARCH query. Document contents are loaded from src
+// after the index lock is released.
+func (idx *Index) search(src Source, query string, opts *SearchOptions) (*SearchResult, error) {
+	idx.mu.RLock()
+	docs, knn, err := idx.match(query, opts.Params, opts.Verbatim)
+	if err == nil && knn != nil && opts.SortBy == knn.alias {
+		for i := range docs {
+			docs[i].sort = docs[i].score
+		}
+	} else if err == nil && opts.SortBy != "" {
+		f := idx.def.Field(opts.SortBy)
+		if f == nil {
+			err = fmt.Errorf("Property `%s` not loaded nor in schema", opts.SortBy)
+		} else {
+			for i := range docs {
+				docs[i].sort = idx.docs[docs[i].id].values[f.Name]
+			}
+		}
+	}
+	idx.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.SortBy != "" {
+		sort.SliceStable(docs, func(i, j int) bool {
+			c := compareValues(docs[i].sort, docs[j].sort)
+			if opts.SortDesc {
+				// Missing values stay last in either direction
+				if docs[i].sort == nil || docs[j].sort == nil {
+					return c < 0
+				}
+				return c > 0
+			}
+			return c < 0
+		})
+	} else if knn == nil {
+		sort.SliceStable(docs, func(i, j int) bool { return docs[i].score > docs[j].score })
+	}
+
+	result := &SearchResult{Total: len(docs)}
+	start := opts.Offset
+	if start > len(docs) {
+		start = len(docs)
+	}
+	end := start + opts.Limit
+	if end > len(docs) {
+		end = len(docs)
+	}
+	for _, d := range docs[start:end] {
+		hit := Hit{Key: d.key, Score: d.score}
+		if !opts.NoContent {
+			hit.Fields = idx.loadFields(src, d.key, opts.Return)
+			if knn != nil && (opts.Return == nil || containsString(opts.Return, knn.alias)) {
+				hit.Fields = append(hit.Fields, [2]string{knn.alias, FormatValue(d.score)})
+			}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+// loadFields reads the requested fields of key from the keyspace. A nil
+// list returns the whole document.
+func (idx *Index) loadFields(src Source, key string, names []string) [][2]string {
+	fields := [][2]string{}
+
+	if idx.def.On == OnHash {
+		hash, ok := src.LoadHash(key)
+		if !ok {
+			return fields
+		}
+		if names == nil {
+			for name, value := range hash {
+				fields = append(fields, [2]string{name, value})
+			}
+			sort.Slice(fields, func(i, j int) bool { return fields[i][0] < fields[j][0] })
+			return fields
+		}
+		for _, name := range names {
+			id := name
+			if f := idx.def.Field(name); f != nil {
+				id = f.Identifier
+			}
+			if value, ok := hash[id]; ok {
+				fields = append(fields, [2]string{name, value})
+			}
+		}
+		return fields
+	}
+
+	doc, ok := src.LoadJSON(key)
+	if !ok {
+		return fields
+	}
+	if names == nil {
+		return append(fields, [2]string{"$", encodeJSON(doc)})
+	}
+	for _, name := range names {
+		var path *jsonUtil.Path
+		if f := idx.def.Field(name); f != nil {
+			path = f.path
+		} else if p, err := jsonUtil.CompilePath(name); err == nil {
+			path = p
+		}
+		if path == nil {
+			continue
+		}
+		if v, ok := path.First(doc); ok {
+			if s, isString := v.(string); isString {
+				fields = append(fields, [2]string{name, s})
+			} else {
+				fields = append(fields, [2]string{name, encodeJSON(v)})
+			}
+		}
+	}
+	return fields
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// compareValues orders numbers before strings and missing values last.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return 1
+		}
+		return -1
+	}
+	an, aNum := a.(float64)
+	bn, bNum := b.(float64)
+	switch {
+	case aNum && bNum:
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(FormatValue(a), FormatValue(b))
+}
@@ -0,0 +1,334 @@
+package search
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memSource is an in-memory Source for tests.
+type memSource struct {
+	hashes map[string]map[string]string
+	docs   map[string]interface{}
+}
+
+func newMemSource() *memSource {
+	return &memSource{
+		hashes: make(map[string]map[string]string),
+		docs:   make(map[string]interface{}),
+	}
+}
+
+func (s *memSource) LoadHash(key string) (map[string]string, bool) {
+	h, ok := s.hashes[key]
+	return h, ok
+}
+
+func (s *memSource) LoadJSON(key string) (interface{}, bool) {
+	d, ok := s.docs[key]
+	return d, ok
+}
+
+func (s *memSource) Keys(on SourceType, fn func(key string)) {
+	if on == OnJSON {
+		for k := range s.docs {
+			fn(k)
+		}
+		return
+	}
+	for k := range s.hashes {
+		fn(k)
+	}
+}
+
+func createIndex(t *testing.T, e *Engine, args ...string) {
+	t.Helper()
+	def, err := ParseCreate(args)
+	require.NoError(t, err)
+	require.NoError(t, e.Create(def))
+}
+
+func searchKeys(t *testing.T, e *Engine, index string, args ...string) []string {
+	t.Helper()
+	query, opts, err := ParseSearch(args)
+	require.NoError(t, err)
+	opts.Limit = 100
+	res, err := e.Search(index, query, opts)
+	require.NoError(t, err)
+	keys := make([]string, 0, len(res.Hits))
+	for _, h := range res.Hits {
+		keys = append(keys, h.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func productEngine(t *testing.T) (*Engine, *memSource) {
+	src := newMemSource()
+	src.hashes["product:1"] = map[string]string{"title": "Running shoes for trail runners", "price": "120", "tags": "sport,outdoor", "loc": "-122.41,37.77"}
+	src.hashes["product:2"] = map[string]string{"title": "Leather office shoes", "price": "80", "tags": "office", "loc": "2.35,48.85"}
+	src.hashes["product:3"] = map[string]string{"title": "Trail running jacket", "price": "200", "tags": "Sport,Winter", "loc": "-122.27,37.80"}
+	src.hashes["other:1"] = map[string]string{"title": "shoes"}
+
+	e := NewEngine(src)
+	createIndex(t, e, "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA",
+		"title", "TEXT", "WEIGHT", "2", "price", "NUMERIC", "SORTABLE", "tags", "TAG", "loc", "GEO")
+	return e, src
+}
+
+func TestParseCreate(t *testing.T) {
+	def, err := ParseCreate([]string{"idx", "ON", "JSON", "PREFIX", "2", "a:", "b:",
+		"SCHEMA", "$.name", "AS", "name", "TEXT", "NOSTEM", "$.tags[*]", "AS", "tags", "TAG", "SEPARATOR", ";"})
+	require.NoError(t, err)
+	assert.Equal(t, OnJSON, def.On)
+	assert.Equal(t, []string{"a:", "b:"}, def.Prefixes)
+	require.Len(t, def.Fields, 2)
+	assert.True(t, def.Fields[0].NoStem)
+	assert.Equal(t, ";", def.Fields[1].Separator)
+	assert.Equal(t, def.Fields[1], def.Field("TAGS"))
+
+	_, err = ParseCreate([]string{"idx", "SCHEMA", "a", "TEXT", "a", "TAG"})
+	assert.EqualError(t, err, "Duplicate field in schema - a")
+	_, err = ParseCreate([]string{"idx", "PREFIX", "3", "a"})
+	assert.Error(t, err)
+	_, err = ParseCreate([]string{"idx", "SCHEMA", "a", "VECTORISH"})
+	assert.Error(t, err)
+}
+
+func TestSearchQueries(t *testing.T) {
+	e, _ := productEngine(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Test Term", "shoes", []string{"product:1", "product:2"}},
+		{"Test Stemming", "run", []string{"product:1", "product:3"}},
+		{"Test Intersection", "trail shoes", []string{"product:1"}},
+		{"Test Union", "leather | jacket", []string{"product:2", "product:3"}},
+		{"Test Negation", "shoes -leather", []string{"product:1"}},
+		{"Test Phrase", `"trail running"`, []string{"product:3"}},
+		{"Test Prefix", "leath*", []string{"product:2"}},
+		{"Test Fuzzy", "%jaket%", []string{"product:3"}},
+		{"Test Field", "@title:office", []string{"product:2"}},
+		{"Test Numeric Range", "@price:[100 200]", []string{"product:1", "product:3"}},
+		{"Test Exclusive Range", "@price:[(80 (200]", []string{"product:1"}},
+		{"Test Infinite Range", "@price:[-inf 100]", []string{"product:2"}},
+		{"Test Tag", "@tags:{sport}", []string{"product:1", "product:3"}},
+		{"Test Tag Union", "@tags:{office | winter}", []string{"product:2", "product:3"}},
+		{"Test Tag Prefix", "@tags:{out*}", []string{"product:1"}},
+		{"Test Geo", "@loc:[-122.4 37.7 20 km]", []string{"product:1", "product:3"}},
+		{"Test Mixed", "trail @price:[-inf 150] @tags:{sport}", []string{"product:1"}},
+		{"Test All", "*", []string{"product:1", "product:2", "product:3"}},
+		{"Test Stopwords Only", "the", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, searchKeys(t, e, "products", tt.query))
+		})
+	}
+
+	t.Run("Test Verbatim", func(t *testing.T) {
+		assert.Empty(t, searchKeys(t, e, "products", "run", "VERBATIM"))
+	})
+	t.Run("Test Params", func(t *testing.T) {
+		keys := searchKeys(t, e, "products", "@price:[$lo $hi]", "PARAMS", "4", "lo", "0", "hi", "100", "DIALECT", "2")
+		assert.Equal(t, []string{"product:2"}, keys)
+	})
+	t.Run("Test Unknown Field", func(t *testing.T) {
+		_, err := e.Search("products", "@nope:[0 1]", &SearchOptions{Limit: 10})
+		assert.EqualError(t, err, "Unknown field `nope`")
+	})
+	t.Run("Test Syntax Error", func(t *testing.T) {
+		_, err := e.Search("products", "(shoes", &SearchOptions{Limit: 10})
+		assert.Error(t, err)
+	})
+	t.Run("Test Unknown Index", func(t *testing.T) {
+		_, err := e.Search("nope", "*", &SearchOptions{Limit: 10})
+		assert.Error(t, err)
+	})
+}
+
+func TestSearchOptions(t *testing.T) {
+	e, _ := productEngine(t)
+
+	t.Run("Test SortBy And Limit", func(t *testing.T) {
+		query, opts, err := ParseSearch([]string{"*", "SORTBY", "price", "DESC", "LIMIT", "0", "2", "RETURN", "1", "price"})
+		require.NoError(t, err)
+		res, err := e.Search("products", query, opts)
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.Total)
+		require.Len(t, res.Hits, 2)
+		assert.Equal(t, "product:3", res.Hits[0].Key)
+		assert.Equal(t, [][2]string{{"price", "200"}}, res.Hits[0].Fields)
+		assert.Equal(t, "product:1", res.Hits[1].Key)
+	})
+
+	t.Run("Test Scoring", func(t *testing.T) {
+		// product:1 mentions the stem twice (running, runners)
+		query, opts, err := ParseSearch([]string{"running", "WITHSCORES"})
+		require.NoError(t, err)
+		res, err := e.Search("products", query, opts)
+		require.NoError(t, err)
+		require.Len(t, res.Hits, 2)
+		assert.Greater(t, res.Hits[0].Score, 0.0)
+		assert.GreaterOrEqual(t, res.Hits[0].Score, res.Hits[1].Score)
+	})
+
+	t.Run("Test NoContent", func(t *testing.T) {
+		query, opts, err := ParseSearch([]string{"shoes", "NOCONTENT"})
+		require.NoError(t, err)
+		res, err := e.Search("products", query, opts)
+		require.NoError(t, err)
+		for _, h := range res.Hits {
+			assert.Nil(t, h.Fields)
+		}
+	})
+}
+
+func TestIncrementalUpdates(t *testing.T) {
+	e, src := productEngine(t)
+
+	src.hashes["product:4"] = map[string]string{"title": "Wool socks", "price": "15"}
+	e.Notify("product:4")
+	e.Notify("other:2") // outside the prefixes
+	assert.Equal(t, []string{"product:4"}, searchKeys(t, e, "products", "socks"))
+
+	src.hashes["product:4"]["title"] = "Cotton socks"
+	src.hashes["product:4"]["price"] = "150"
+	e.Notify("product:4")
+	assert.Equal(t, []string{"product:4"}, searchKeys(t, e, "products", "cotton"))
+	assert.Empty(t, searchKeys(t, e, "products", "wool"))
+	assert.Equal(t, []string{"product:1", "product:4"}, searchKeys(t, e, "products", "@price:[100 150]"))
+
+	delete(src.hashes, "product:4")
+	e.Notify("product:4")
+	assert.Empty(t, searchKeys(t, e, "products", "socks"))
+
+	info, err := e.Info("products")
+	require.NoError(t, err)
+	assert.Equal(t, 3, info.NumDocs)
+
+	keys, err := e.Drop("products")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"product:1", "product:2", "product:3"}, keys)
+	_, err = e.Drop("products")
+	assert.EqualError(t, err, "Unknown Index name")
+}
+
+// pausingSource is a hash Source whose next load waits for resume after
+// reading, like a write descheduled between reading a key and indexing it.
+type pausingSource struct {
+	memSource
+	mu     sync.Mutex
+	pause  bool
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (s *pausingSource) LoadHash(key string) (map[string]string, bool) {
+	s.mu.Lock()
+	h, ok := s.hashes[key]
+	pause := s.pause
+	s.pause = false
+	s.mu.Unlock()
+
+	if pause {
+		close(s.paused)
+		<-s.resume
+	}
+	return h, ok
+}
+
+func (s *pausingSource) set(key string, h map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[key] = h
+}
+
+func TestRacingReloadsKeepLatestVersion(t *testing.T) {
+	src := &pausingSource{memSource: *newMemSource(), paused: make(chan struct{}), resume: make(chan struct{})}
+	e := NewEngine(src)
+	createIndex(t, e, "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA", "title", "TEXT")
+
+	// The first write's reload reads the old title and stalls
+	src.set("product:1", map[string]string{"title": "old"})
+	src.pause = true
+	first := make(chan struct{})
+	go func() {
+		e.Notify("product:1")
+		close(first)
+	}()
+	<-src.paused
+
+	// The second write must not be overtaken by the stalled reload
+	src.set("product:1", map[string]string{"title": "new"})
+	second := make(chan struct{})
+	go func() {
+		e.Notify("product:1")
+		close(second)
+	}()
+	select {
+	case <-second:
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(src.resume)
+	<-first
+	<-second
+
+	assert.Equal(t, []string{"product:1"}, searchKeys(t, e, "products", "new"))
+	assert.Empty(t, searchKeys(t, e, "products", "old"))
+}
+
+func TestJSONIndex(t *testing.T) {
+	src := newMemSource()
+	src.docs["user:1"] = map[string]interface{}{
+		"name": "Alice Smith", "age": float64(31), "skills": []interface{}{"go", "rust"},
+	}
+	src.docs["user:2"] = map[string]interface{}{
+		"name": "Bob Stone", "age": float64(45), "skills": []interface{}{"python"},
+	}
+	e := NewEngine(src)
+	createIndex(t, e, "users", "ON", "JSON", "PREFIX", "1", "user:", "SCHEMA",
+		"$.name", "AS", "name", "TEXT", "$.age", "AS", "age", "NUMERIC", "$.skills[*]", "AS", "skills", "TAG")
+
+	assert.Equal(t, []string{"user:1"}, searchKeys(t, e, "users", "@skills:{rust}"))
+	assert.Equal(t, []string{"user:2"}, searchKeys(t, e, "users", "@age:[40 +inf]"))
+	assert.Equal(t, []string{"user:2"}, searchKeys(t, e, "users", "stone"))
+
+	query, opts, err := ParseSearch([]string{"alice", "RETURN", "2", "age", "$.skills"})
+	require.NoError(t, err)
+	res, err := e.Search("users", query, opts)
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, [][2]string{{"age", "31"}, {"$.skills", `["go","rust"]`}}, res.Hits[0].Fields)
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"caresses":    "caress",
+		"ponies":      "poni",
+		"running":     "run",
+		"runners":     "runner",
+		"agreed":      "agre",
+		"hopping":     "hop",
+		"happy":       "happi",
+		"relational":  "relat",
+		"conditional": "condit",
+		"hopefulness": "hope",
+		"electrical":  "electr",
+		"adjustment":  "adjust",
+		"controlling": "control",
+		"generalize":  "gener",
+		"go":          "go",
+		"Capital":     "Capital",
+	}
+	for word, want := range tests {
+		assert.Equal(t, want, Stem(word), word)
+	}
+}
@@ -0,0 +1,51 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultStopwords is the stopword list used when FT.CREATE has no
+// STOPWORDS clause; it matches RediSearch's default list.
+var DefaultStopwords = []string{
+	"a", "is", "the", "an", "and", "are", "as", "at", "be", "but", "by", "for",
+	"if", "in", "into", "it", "no", "not", "of", "on", "or", "such", "that",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will", "with",
+}
+
+type token struct {
+	term string
+	pos  int
+}
+
+func stopwordSet(words []string) map[string]bool {
+	if words == nil {
+		words = DefaultStopwords
+	}
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[strings.ToLower(w)] = true
+	}
+	return set
+}
+
+func isTokenRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// tokenize splits text into lower-cased terms, dropping stopwords. The
+// position counter only advances for kept terms so that phrases spanning a
+// stopword still match.
+func tokenize(text string, stopwords map[string]bool) []token {
+	var tokens []token
+	pos := 0
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isTokenRune(r) }) {
+		term := strings.ToLower(word)
+		if stopwords[term] {
+			continue
+		}
+		tokens = append(tokens, token{term: term, pos: pos})
+		pos++
+	}
+	return tokens
+}
@@ -0,0 +1,320 @@
+package search
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Vector index algorithms.
+const (
+	VectorFlat = "FLAT"
+	VectorHNSW = "HNSW"
+)
+
+// Vector distance metrics.
+const (
+	MetricL2     = "L2"
+	MetricIP     = "IP"
+	MetricCosine = "COSINE"
+)
+
+// HNSW defaults, matching RediSearch.
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEFConstruction = 200
+	defaultHNSWEFRuntime      = 10
+)
+
+// VectorParams describes a VECTOR attribute.
+type VectorParams struct {
+	Algorithm      string
+	Type           string
+	Dim            int
+	Metric         string
+	InitialCap     int
+	M              int // HNSW
+	EFConstruction int // HNSW
+	EFRuntime      int // HNSW
+}
+
+// parseVectorParams reads "FLAT|HNSW count name value ..." starting at
+// args[i] and returns the index of the last argument consumed.
+func parseVectorParams(args []string, i int) (*VectorParams, int, error) {
+	if i >= len(args) {
+		return nil, 0, fmt.Errorf("Missing vector similarity algorithm")
+	}
+	p := &VectorParams{
+		Algorithm:      strings.ToUpper(args[i]),
+		M:              defaultHNSWM,
+		EFConstruction: defaultHNSWEFConstruction,
+		EFRuntime:      defaultHNSWEFRuntime,
+	}
+	if p.Algorithm != VectorFlat && p.Algorithm != VectorHNSW {
+		return nil, 0, fmt.Errorf("Bad arguments for vector similarity algorithm `%s`", args[i])
+	}
+	values, last, err := countedArgs(args, i, p.Algorithm)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(values)%2 != 0 {
+		return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: expected name value pairs", p.Algorithm)
+	}
+
+	positive := func(name, value string) (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("Bad arguments for vector similarity %s: invalid %s", p.Algorithm, name)
+		}
+		return n, nil
+	}
+	for j := 0; j < len(values); j += 2 {
+		name, value := strings.ToUpper(values[j]), values[j+1]
+		switch name {
+		case "TYPE":
+			p.Type = strings.ToUpper(value)
+			if p.Type != "FLOAT32" {
+				return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: unsupported TYPE `%s`", p.Algorithm, value)
+			}
+		case "DIM":
+			p.Dim, err = positive(name, value)
+		case "DISTANCE_METRIC":
+			p.Metric = strings.ToUpper(value)
+			switch p.Metric {
+			case MetricL2, MetricIP, MetricCosine:
+			default:
+				return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: unknown DISTANCE_METRIC `%s`", p.Algorithm, value)
+			}
+		case "INITIAL_CAP":
+			p.InitialCap, err = positive(name, value)
+		case "BLOCK_SIZE":
+			_, err = positive(name, value)
+		case "M", "EF_CONSTRUCTION", "EF_RUNTIME":
+			if p.Algorithm != VectorHNSW {
+				return nil, 0, fmt.Errorf("Bad arguments for vector similarity FLAT: unknown argument `%s`", values[j])
+			}
+			var n int
+			n, err = positive(name, value)
+			switch name {
+			case "M":
+				p.M = n
+			case "EF_CONSTRUCTION":
+				p.EFConstruction = n
+			default:
+				p.EFRuntime = n
+			}
+		case "EPSILON":
+			// Range queries are not supported; accepted for compatibility
+		default:
+			return nil, 0, fmt.Errorf("Bad arguments for vector similarity %s: unknown argument `%s`", p.Algorithm, values[j])
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if p.Type == "" || p.Dim == 0 || p.Metric == "" {
+		return nil, 0, fmt.Errorf("Missing mandatory parameter: TYPE, DIM and DISTANCE_METRIC are required")
+	}
+	return p, last, nil
+}
+
+// distanceFunc returns the distance between two vectors; smaller is closer.
+type distanceFunc func(a, b []float32) float32
+
+// l2Distance is the squared Euclidean distance, as RediSearch reports it.
+func l2Distance(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+// ipDistance is 1 minus the inner product. Cosine distance uses it on
+// normalized vectors.
+func ipDistance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+func (p *VectorParams) distance() distanceFunc {
+	if p.Metric == MetricL2 {
+		return l2Distance
+	}
+	return ipDistance
+}
+
+// prepare copies v, normalizing it for the cosine metric.
+func (p *VectorParams) prepare(v []float32) []float32 {
+	out := append([]float32(nil), v...)
+	if p.Metric != MetricCosine {
+		return out
+	}
+	var norm float32
+	for _, x := range out {
+		norm += x * x
+	}
+	if norm == 0 {
+		return out
+	}
+	scale := float32(1 / math.Sqrt(float64(norm)))
+	for i := range out {
+		out[i] *= scale
+	}
+	return out
+}
+
+// parseVector decodes a vector from a hash blob of little-endian float32
+// values or from a JSON array of numbers.
+func (p *VectorParams) parseVector(v interface{}) ([]float32, bool) {
+	switch t := v.(type) {
+	case string:
+		return decodeVectorBlob(t, p.Dim)
+	case []interface{}:
+		if len(t) != p.Dim {
+			return nil, false
+		}
+		out := make([]float32, p.Dim)
+		for i, x := range t {
+			n, ok := x.(float64)
+			if !ok {
+				return nil, false
+			}
+			out[i] = float32(n)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func decodeVectorBlob(blob string, dim int) ([]float32, bool) {
+	if len(blob) != 4*dim {
+		return nil, false
+	}
+	out := make([]float32, dim)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(blob[4*i : 4*i+4])))
+	}
+	return out, true
+}
+
+// EncodeVector returns the blob form of a FLOAT32 vector, as stored in hash
+// fields and passed as a KNN query parameter.
+func EncodeVector(v []float32) string {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return string(buf)
+}
+
+// vectorHit is a search result of a vector index.
+type vectorHit struct {
+	id   uint32
+	dist float32
+}
+
+// vectorIndex is implemented by the FLAT and HNSW indexes. Callers
+// serialize add and remove against search with the index lock.
+type vectorIndex interface {
+	add(id uint32, v []float32)
+	remove(id uint32)
+	// search returns up to k nearest vectors accepted by filter (nil
+	// accepts everything), closest first. ef is the HNSW candidate list
+	// size and is ignored by FLAT.
+	search(q []float32, k, ef int, filter func(uint32) bool) []vectorHit
+	len() int
+}
+
+func newVectorIndex(p *VectorParams) vectorIndex {
+	if p.Algorithm == VectorHNSW {
+		return newHNSW(p.distance(), p.M, p.EFConstruction, 0)
+	}
+	return newFlat(p.distance(), p.InitialCap)
+}
+
+// hitHeap is a heap of hits. With max set it keeps the farthest hit on top,
+// which lets it act as a bounded list of the best results.
+type hitHeap struct {
+	hits []vectorHit
+	max  bool
+}
+
+func (h *hitHeap) Len() int { return len(h.hits) }
+func (h *hitHeap) Less(i, j int) bool {
+	if h.max {
+		return h.hits[i].dist > h.hits[j].dist
+	}
+	return h.hits[i].dist < h.hits[j].dist
+}
+func (h *hitHeap) Swap(i, j int)      { h.hits[i], h.hits[j] = h.hits[j], h.hits[i] }
+func (h *hitHeap) Push(x interface{}) { h.hits = append(h.hits, x.(vectorHit)) }
+func (h *hitHeap) Pop() interface{} {
+	last := h.hits[len(h.hits)-1]
+	h.hits = h.hits[:len(h.hits)-1]
+	return last
+}
+
+func (h *hitHeap) top() vectorHit { return h.hits[0] }
+
+// sorted drains the heap and returns its hits closest first.
+func (h *hitHeap) sorted() []vectorHit {
+	out := make([]vectorHit, len(h.hits))
+	for i := len(out) - 1; i >= 0 && h.max; i-- {
+		out[i] = heap.Pop(h).(vectorHit)
+	}
+	for i := 0; i < len(out) && !h.max; i++ {
+		out[i] = heap.Pop(h).(vectorHit)
+	}
+	return out
+}
+
+// flatIndex is an exact brute-force index.
+type flatIndex struct {
+	dist    distanceFunc
+	vectors map[uint32][]float32
+}
+
+func newFlat(dist distanceFunc, capacity int) *flatIndex {
+	return &flatIndex{dist: dist, vectors: make(map[uint32][]float32, capacity)}
+}
+
+func (f *flatIndex) add(id uint32, v []float32) { f.vectors[id] = v }
+func (f *flatIndex) remove(id uint32)           { delete(f.vectors, id) }
+func (f *flatIndex) len() int                   { return len(f.vectors) }
+
+func (f *flatIndex) search(q []float32, k, _ int, filter func(uint32) bool) []vectorHit {
+	return bruteForce(q, k, f.dist, filter, func(fn func(uint32, []float32)) {
+		for id, v := range f.vectors {
+			fn(id, v)
+		}
+	})
+}
+
+// bruteForce scans every vector produced by each and keeps the k closest.
+func bruteForce(q []float32, k int, dist distanceFunc, filter func(uint32) bool, each func(func(uint32, []float32))) []vectorHit {
+	if k <= 0 {
+		return nil
+	}
+	results := &hitHeap{max: true}
+	each(func(id uint32, v []float32) {
+		if filter != nil && !filter(id) {
+			return
+		}
+		d := dist(q, v)
+		if results.Len() < k {
+			heap.Push(results, vectorHit{id: id, dist: d})
+		} else if d < results.top().dist || d == results.top().dist && id < results.top().id {
+			results.hits[0] = vectorHit{id: id, dist: d}
+			heap.Fix(results, 0)
+		}
+	})
+	return results.sorted()
+}
@@ -0,0 +1,239 @@
+package search
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func randomVectors(rng *rand.Rand, n, dim int) [][]float32 {
+	out := make([][]float32, n)
+	for i := range out {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = rng.Float32()*2 - 1
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// recall returns the fraction of the exact neighbors found by approx.
+func recall(exact, approx []vectorHit) float64 {
+	want := make(map[uint32]bool, len(exact))
+	for _, h := range exact {
+		want[h.id] = true
+	}
+	found := 0
+	for _, h := range approx {
+		if want[h.id] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(exact))
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const (
+		n, dim, k, queries = 2000, 24, 10, 100
+	)
+	rng := rand.New(rand.NewSource(1))
+	vectors := randomVectors(rng, n, dim)
+
+	for _, metric := range []string{MetricL2, MetricIP, MetricCosine} {
+		t.Run("Test "+metric, func(t *testing.T) {
+			p := &VectorParams{Algorithm: VectorHNSW, Metric: metric, Dim: dim}
+			flat := newFlat(p.distance(), n)
+			hnsw := newHNSW(p.distance(), defaultHNSWM, defaultHNSWEFConstruction, 1)
+			for i, v := range vectors {
+				v = p.prepare(v)
+				flat.add(uint32(i), v)
+				hnsw.add(uint32(i), v)
+			}
+
+			total := 0.0
+			for _, q := range randomVectors(rng, queries, dim) {
+				q = p.prepare(q)
+				total += recall(flat.search(q, k, 0, nil), hnsw.search(q, k, 100, nil))
+			}
+			assert.GreaterOrEqual(t, total/queries, 0.95)
+		})
+	}
+}
+
+func TestHNSWRemove(t *testing.T) {
+	const n, dim, k = 1000, 16, 10
+	rng := rand.New(rand.NewSource(2))
+	vectors := randomVectors(rng, n, dim)
+
+	flat := newFlat(l2Distance, n)
+	hnsw := newHNSW(l2Distance, 8, 100, 2)
+	for i, v := range vectors {
+		flat.add(uint32(i), v)
+		hnsw.add(uint32(i), v)
+	}
+	// Remove every other vector, including the entry point
+	entry := hnsw.entry
+	hnsw.remove(entry)
+	flat.remove(entry)
+	for i := 0; i < n; i += 2 {
+		flat.remove(uint32(i))
+		hnsw.remove(uint32(i))
+	}
+	require.Equal(t, flat.len(), hnsw.len())
+
+	total := 0.0
+	for _, q := range randomVectors(rng, 50, dim) {
+		approx := hnsw.search(q, k, 100, nil)
+		for _, h := range approx {
+			_, ok := flat.vectors[h.id]
+			require.True(t, ok, "removed vector %d returned", h.id)
+		}
+		total += recall(flat.search(q, k, 0, nil), approx)
+	}
+	assert.GreaterOrEqual(t, total/50, 0.9)
+}
+
+func TestHNSWFilteredSearch(t *testing.T) {
+	const n, dim, k = 2000, 8, 5
+	rng := rand.New(rand.NewSource(3))
+	flat := newFlat(l2Distance, n)
+	hnsw := newHNSW(l2Distance, defaultHNSWM, defaultHNSWEFConstruction, 3)
+	for i, v := range randomVectors(rng, n, dim) {
+		flat.add(uint32(i), v)
+		hnsw.add(uint32(i), v)
+	}
+
+	even := func(id uint32) bool { return id%2 == 0 }
+	total := 0.0
+	for _, q := range randomVectors(rng, 50, dim) {
+		approx := hnsw.search(q, k, 50, even)
+		for _, h := range approx {
+			require.True(t, even(h.id))
+		}
+		total += recall(flat.search(q, k, 0, even), approx)
+	}
+	assert.GreaterOrEqual(t, total/50, 0.9)
+}
+
+func TestParseVectorParams(t *testing.T) {
+	def, err := ParseCreate([]string{"idx", "SCHEMA", "v", "VECTOR", "HNSW", "10",
+		"TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "cosine", "M", "8", "EF_RUNTIME", "20", "tag", "TAG"})
+	require.NoError(t, err)
+	require.Len(t, def.Fields, 2)
+	p := def.Fields[0].Vector
+	assert.Equal(t, &VectorParams{Algorithm: VectorHNSW, Type: "FLOAT32", Dim: 4, Metric: MetricCosine,
+		M: 8, EFConstruction: defaultHNSWEFConstruction, EFRuntime: 20}, p)
+
+	bad := [][]string{
+		{"idx", "SCHEMA", "v", "VECTOR", "IVF", "2", "DIM", "4"},
+		{"idx", "SCHEMA", "v", "VECTOR", "FLAT", "4", "TYPE", "FLOAT32", "DIM", "4"},
+		{"idx", "SCHEMA", "v", "VECTOR", "FLAT", "6", "TYPE", "FLOAT64", "DIM", "4", "DISTANCE_METRIC", "L2"},
+		{"idx", "SCHEMA", "v", "VECTOR", "FLAT", "8", "TYPE", "FLOAT32", "DIM", "4", "DISTANCE_METRIC", "L2", "M", "4"},
+		{"idx", "SCHEMA", "v", "VECTOR", "FLAT", "5", "TYPE", "FLOAT32", "DIM"},
+	}
+	for _, args := range bad {
+		_, err := ParseCreate(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestKNNQuery(t *testing.T) {
+	src := newMemSource()
+	points := map[string][]float32{
+		"item:1": {1, 0}, "item:2": {0.5, 0}, "item:3": {0, 1}, "item:4": {-1, 0},
+	}
+	colors := map[string]string{"item:1": "red", "item:2": "blue", "item:3": "red", "item:4": "blue"}
+	for key, v := range points {
+		src.hashes[key] = map[string]string{"vec": EncodeVector(v), "color": colors[key]}
+	}
+	src.docs["json:1"] = map[string]interface{}{"v": []interface{}{0.0, 1.0}}
+
+	e := NewEngine(src)
+	for _, algo := range []string{"FLAT", "HNSW"} {
+		createIndex(t, e, "idx"+algo, "PREFIX", "1", "item:", "SCHEMA", "color", "TAG",
+			"vec", "VECTOR", algo, "6", "TYPE", "FLOAT32", "DIM", "2", "DISTANCE_METRIC", "L2")
+	}
+	createIndex(t, e, "json", "ON", "JSON", "SCHEMA", "$.v", "AS", "v", "VECTOR", "FLAT", "6",
+		"TYPE", "FLOAT32", "DIM", "2", "DISTANCE_METRIC", "COSINE")
+
+	blob := EncodeVector([]float32{1, 0})
+	for _, algo := range []string{"FLAT", "HNSW"} {
+		t.Run("Test "+algo, func(t *testing.T) {
+			query, opts, err := ParseSearch([]string{"*=>[KNN 3 @vec $q AS dist]", "PARAMS", "2", "q", blob,
+				"RETURN", "1", "dist", "DIALECT", "2"})
+			require.NoError(t, err)
+			res, err := e.Search("idx"+algo, query, opts)
+			require.NoError(t, err)
+			require.Equal(t, 3, res.Total)
+			assert.Equal(t, "item:1", res.Hits[0].Key)
+			assert.Equal(t, [][2]string{{"dist", "0"}}, res.Hits[0].Fields)
+			assert.Equal(t, "item:2", res.Hits[1].Key)
+			assert.Equal(t, [][2]string{{"dist", "0.25"}}, res.Hits[1].Fields)
+			assert.Equal(t, "item:3", res.Hits[2].Key)
+
+			query, opts, err = ParseSearch([]string{"(@color:{blue})=>[KNN $k @vec $q]", "PARAMS", "4", "q", blob, "k", "5",
+				"RETURN", "1", "__vec_score"})
+			require.NoError(t, err)
+			res, err = e.Search("idx"+algo, query, opts)
+			require.NoError(t, err)
+			require.Len(t, res.Hits, 2)
+			assert.Equal(t, "item:2", res.Hits[0].Key)
+			assert.Equal(t, "item:4", res.Hits[1].Key)
+			assert.Equal(t, [][2]string{{"__vec_score", "4"}}, res.Hits[1].Fields)
+		})
+	}
+
+	t.Run("Test Aggregate", func(t *testing.T) {
+		res := aggregate(t, e, "idxFLAT", "*=>[KNN 2 @vec $q AS d]", "PARAMS", "2", "q", blob,
+			"SORTBY", "2", "@d", "DESC")
+		require.Len(t, res.Rows, 2)
+		assert.Equal(t, []interface{}{0.25, 0.0}, rowValues(res.Rows, "d"))
+	})
+
+	t.Run("Test Updates", func(t *testing.T) {
+		src.hashes["item:4"]["vec"] = EncodeVector([]float32{1, 0.01})
+		e.Notify("item:4")
+		keys := searchKeys(t, e, "idxHNSW", "*=>[KNN 1 @vec $q]", "PARAMS", "2", "q", EncodeVector([]float32{1, 0.02}))
+		assert.Equal(t, []string{"item:4"}, keys)
+	})
+
+	t.Run("Test JSON Cosine", func(t *testing.T) {
+		keys := searchKeys(t, e, "json", "*=>[KNN 1 @v $q]", "PARAMS", "2", "q", EncodeVector([]float32{0, 5}))
+		assert.Equal(t, []string{"json:1"}, keys)
+	})
+
+	t.Run("Test Errors", func(t *testing.T) {
+		for _, q := range []string{
+			"*=>[KNN 1 @color $q]",
+			"*=>[KNN 1 @vec $missing]",
+			"*=>[KNN x @vec $q]",
+			"*=>[KNN 1 @vec $short]",
+		} {
+			_, err := e.Search("idxFLAT", q, &SearchOptions{Limit: 10, Params: map[string]string{"q": blob, "short": "abc"}})
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func benchmarkVectors(b *testing.B, idx vectorIndex, ef int) {
+	rng := rand.New(rand.NewSource(1))
+	for i, v := range randomVectors(rng, 10000, 64) {
+		idx.add(uint32(i), v)
+	}
+	queries := randomVectors(rng, 100, 64)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.search(queries[i%len(queries)], 10, ef, nil)
+	}
+}
+
+func BenchmarkFlatSearch(b *testing.B) {
+	benchmarkVectors(b, newFlat(l2Distance, 10000), 0)
+}
+
+func BenchmarkHNSWSearch(b *testing.B) {
+	benchmarkVectors(b, newHNSW(l2Distance, defaultHNSWM, defaultHNSWEFConstruction, 1), 64)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
+	"github.com/genc-murat/crystalcache/pkg/resp"
+)
+
+// replicationStats tracks the replication offsets exposed as metrics. On a
+// master the offset grows with every byte propagated to replicas; on a
+// replica it grows with every byte received from the master.
+type replicationStats struct {
+	masterOffset  int64
+	replicaOffset int64
+	lastMasterIO  int64 // unix nanoseconds of the last read from the master
+}
+
+// byteCounter is an io.Writer that only counts what is written to it.
+type byteCounter int64
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
+
+// encodedSize returns the number of bytes value occupies on the wire.
+func encodedSize(value models.Value) int64 {
+	var counter byteCounter
+	if err := resp.NewWriter(&counter).Write(value); err != nil {
+		return 0
+	}
+	return int64(counter)
+}
+
+// isBlockingCommand reports whether a command may park the client until
+// data arrives.
+func isBlockingCommand(cmd string, args []models.Value) bool {
+	switch cmd {
+	case "BLPOP", "BRPOP", "BLMOVE", "BLMPOP", "BZPOPMIN", "BZPOPMAX", "BZMPOP", "BRPOPLPUSH":
+		return true
+	case "XREAD", "XREADGROUP":
+		for _, arg := range args {
+			if strings.EqualFold(arg.Bulk, "BLOCK") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MetricsHandler serves the server, cache and storage metrics in the
+// OpenMetrics text format.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metrics.OpenMetricsContentType)
+
+		exposition := metrics.NewOpenMetricsWriter(w)
+		s.metrics.Collect(exposition)
+		s.collectReplication(exposition)
+		if collector, ok := s.cache.(metrics.Collector); ok {
+			collector.Collect(exposition)
+		}
+		if collector, ok := s.storage.(metrics.Collector); ok {
+			collector.Collect(exposition)
+		}
+		if err := exposition.Close(); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+func (s *Server) collectReplication(w *metrics.OpenMetricsWriter) {
+	s.replMutex.RLock()
+	isMaster := s.isMaster
+	replicas := len(s.replicas)
+	linkUp := s.replConn != nil
+	s.replMutex.RUnlock()
+
+	role := "slave"
+	offset := atomic.LoadInt64(&s.repl.replicaOffset)
+	if isMaster {
+		role = "master"
+		offset = atomic.LoadInt64(&s.repl.masterOffset)
+	}
+
+	w.Gauge("crystalcache_replication_role", "Replication role of this instance.",
+		metrics.Sample{Labels: []metrics.Label{{Name: "role", Value: role}}, Value: 1})
+	w.Gauge("crystalcache_connected_replicas", "Number of connected replicas.",
+		metrics.Sample{Value: float64(replicas)})
+	w.Gauge("crystalcache_replication_offset_bytes", "Replication offset of this instance.",
+		metrics.Sample{Value: float64(offset)})
+
+	if isMaster {
+		return
+	}
+	lag := 0.0
+	if last := atomic.LoadInt64(&s.repl.lastMasterIO); last > 0 {
+		lag = time.Since(time.Unix(0, last)).Seconds()
+	}
+	up := 0.0
+	if linkUp {
+		up = 1
+	}
+	w.Gauge("crystalcache_master_link_up", "Whether the link to the master is up.",
+		metrics.Sample{Value: up})
+	w.Gauge("crystalcache_master_last_io_seconds", "Seconds since the last interaction with the master.",
+		metrics.Sample{Value: lag})
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+)
+
+// keyspaceAllClasses is what the A flag of notify-keyspace-events stands
+// for. Key miss (m) and new key (n) events are accepted but not raised.
+const keyspaceAllClasses = "g$lshzxetd"
+
+// keyspaceEvent is a notification raised by a command: key was changed by
+// event, which belongs to the class flag of notify-keyspace-events.
+type keyspaceEvent struct {
+	class byte
+	event string
+	key   string
+}
+
+// keyspaceRule returns the events a command raises given its reply.
+// Commands replying with a count raise nothing when it is zero. existing,
+// only used by DEL and UNLINK, reports which keys existed before the
+// command ran.
+type keyspaceRule func(args []models.Value, result models.Value, existing func(key string) bool) []keyspaceEvent
+
+// keyspaceRules maps the write commands to the events they raise, named as
+// in Redis.
+var keyspaceRules = map[string]keyspaceRule{
+	// Generic
+	"DEL":       deletedKeys,
+	"UNLINK":    deletedKeys,
+	"EXPIRE":    onCount('g', "expire", firstKey),
+	"PEXPIRE":   onCount('g', "expire", firstKey),
+	"EXPIREAT":  onCount('g', "expire", firstKey),
+	"PEXPIREAT": onCount('g', "expire", firstKey),
+	"PERSIST":   onCount('g', "persist", firstKey),
+	"RENAME":    both(on('g', "rename_from", firstKey), on('g', "rename_to", secondKey)),
+	"RENAMENX":  both(onCount('g', "rename_from", firstKey), onCount('g', "rename_to", secondKey)),
+	"COPY":      onCount('g', "copy_to", secondKey),
+
+	// Strings
+	"SET":         on('$', "set", firstKey),
+	"SETEX":       on('$', "set", firstKey),
+	"PSETEX":      on('$', "set", firstKey),
+	"GETSET":      on('$', "set", firstKey),
+	"SETNX":       onCount('$', "set", firstKey),
+	"MSET":        on('$', "set", pairKeys),
+	"MSETNX":      onCount('$', "set", pairKeys),
+	"SETRANGE":    on('$', "setrange", firstKey),
+	"APPEND":      on('$', "append", firstKey),
+	"INCR":        on('$', "incrby", firstKey),
+	"DECR":        on('$', "decrby", firstKey),
+	"INCRBY":      on('$', "incrby", firstKey),
+	"DECRBY":      on('$', "decrby", firstKey),
+	"INCRBYFLOAT": on('$', "incrbyfloat", firstKey),
+	"GETDEL":      on('g', "del", firstKey),
+	"SETBIT":      on('$', "setbit", firstKey),
+
+	// Lists
+	"LPUSH":     on('l', "lpush", firstKey),
+	"RPUSH":     on('l', "rpush", firstKey),
+	"LPUSHX":    onCount('l', "lpush", firstKey),
+	"RPUSHX":    onCount('l', "rpush", firstKey),
+	"LPOP":      on('l', "lpop", firstKey),
+	"RPOP":      on('l', "rpop", firstKey),
+	"BLPOP":     on('l', "lpop", poppedKey),
+	"BRPOP":     on('l', "rpop", poppedKey),
+	"LINSERT":   onCount('l', "linsert", firstKey),
+	"LSET":      on('l', "lset", firstKey),
+	"LREM":      onCount('l', "lrem", firstKey),
+	"LTRIM":     on('l', "ltrim", firstKey),
+	"RPOPLPUSH": both(on('l', "rpop", firstKey), on('l', "lpush", secondKey)),
+	"LMOVE":     moveEvents,
+	"BLMOVE":    moveEvents,
+
+	// Hashes
+	"HSET":         on('h', "hset", firstKey),
+	"HMSET":        on('h', "hset", firstKey),
+	"HSETNX":       onCount('h', "hset", firstKey),
+	"HDEL":         onCount('h', "hdel", firstKey),
+	"HINCRBY":      on('h', "hincrby", firstKey),
+	"HINCRBYFLOAT": on('h', "hincrbyfloat", firstKey),
+
+	// Sets
+	"SADD":        onCount('s', "sadd", firstKey),
+	"SREM":        onCount('s', "srem", firstKey),
+	"SPOP":        on('s', "spop", firstKey),
+	"SMOVE":       both(onCount('s', "srem", firstKey), onCount('s', "sadd", secondKey)),
+	"SINTERSTORE": on('s', "sinterstore", firstKey),
+	"SUNIONSTORE": on('s', "sunionstore", firstKey),
+	"SDIFFSTORE":  on('s', "sdiffstore", firstKey),
+
+	// Sorted sets
+	"ZADD":             on('z', "zadd", firstKey),
+	"ZINCRBY":          on('z', "zincr", firstKey),
+	"ZREM":             onCount('z', "zrem", firstKey),
+	"ZREMRANGEBYSCORE": onCount('z', "zremrangebyscore", firstKey),
+	"ZREMRANGEBYRANK":  onCount('z', "zremrangebyrank", firstKey),
+	"ZREMRANGEBYLEX":   onCount('z', "zremrangebylex", firstKey),
+	"ZPOPMIN":          on('z', "zpopmin", firstKey),
+	"ZPOPMAX":          on('z', "zpopmax", firstKey),
+
+	// Streams
+	"XADD":  on('t', "xadd", firstKey),
+	"XDEL":  onCount('t', "xdel", firstKey),
+	"XTRIM": onCount('t', "xtrim", firstKey),
+}
+
+// on raises event for keys unless the command replied with an error or nil.
+func on(class byte, event string, keys func(args []models.Value, result models.Value) []string) keyspaceRule {
+	return func(args []models.Value, result models.Value, _ func(string) bool) []keyspaceEvent {
+		if result.Type == "error" || result.Type == "null" {
+			return nil
+		}
+		var events []keyspaceEvent
+		for _, key := range keys(args, result) {
+			events = append(events, keyspaceEvent{class: class, event: event, key: key})
+		}
+		return events
+	}
+}
+
+// onCount is on for commands whose reply counts the changes made.
+func onCount(class byte, event string, keys func(args []models.Value, result models.Value) []string) keyspaceRule {
+	raise := on(class, event, keys)
+	return func(args []models.Value, result models.Value, existing func(string) bool) []keyspaceEvent {
+		if result.Type == "integer" && result.Num <= 0 {
+			return nil
+		}
+		return raise(args, result, existing)
+	}
+}
+
+func both(first, second keyspaceRule) keyspaceRule {
+	return func(args []models.Value, result models.Value, existing func(string) bool) []keyspaceEvent {
+		return append(first(args, result, existing), second(args, result, existing)...)
+	}
+}
+
+func firstKey(args []models.Value, _ models.Value) []string {
+	if len(args) < 1 {
+		return nil
+	}
+	return []string{args[0].Bulk}
+}
+
+func secondKey(args []models.Value, _ models.Value) []string {
+	if len(args) < 2 {
+		return nil
+	}
+	return []string{args[1].Bulk}
+}
+
+// pairKeys returns the keys of key value pairs, as MSET takes them
+func pairKeys(args []models.Value, _ models.Value) []string {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		keys = append(keys, args[i].Bulk)
+	}
+	return keys
+}
+
+// poppedKey returns the key a blocking pop replied with
+func poppedKey(_ []models.Value, result models.Value) []string {
+	if result.Type != "array" || len(result.Array) == 0 {
+		return nil
+	}
+	return []string{result.Array[0].Bulk}
+}
+
+func deletedKeys(args []models.Value, result models.Value, existing func(string) bool) []keyspaceEvent {
+	if result.Type != "integer" || result.Num <= 0 {
+		return nil
+	}
+	var events []keyspaceEvent
+	for _, arg := range args {
+		if existing(arg.Bulk) {
+			events = append(events, keyspaceEvent{class: 'g', event: "del", key: arg.Bulk})
+		}
+	}
+	return events
+}
+
+// moveEvents serves LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func moveEvents(args []models.Value, result models.Value, _ func(string) bool) []keyspaceEvent {
+	if len(args) < 4 || result.Type == "error" || result.Type == "null" {
+		return nil
+	}
+	pop, push := "rpop", "rpush"
+	if strings.EqualFold(args[2].Bulk, "LEFT") {
+		pop = "lpop"
+	}
+	if strings.EqualFold(args[3].Bulk, "LEFT") {
+		push = "lpush"
+	}
+	return []keyspaceEvent{
+		{class: 'l', event: pop, key: args[0].Bulk},
+		{class: 'l', event: push, key: args[1].Bulk},
+	}
+}
+
+// keyspaceNotifier holds the notify-keyspace-events flags, with A expanded.
+type keyspaceNotifier struct {
+	flags atomic.Pointer[string]
+}
+
+func (n *keyspaceNotifier) set(flags string) {
+	flags = strings.ReplaceAll(flags, "A", keyspaceAllClasses)
+	n.flags.Store(&flags)
+}
+
+// channels reports whether events of class are notified on the keyspace
+// and keyevent channels.
+func (n *keyspaceNotifier) channels(class byte) (keyspace, keyevent bool) {
+	flags := n.flags.Load()
+	if flags == nil || strings.IndexByte(*flags, class) < 0 {
+		return false, false
+	}
+	return strings.IndexByte(*flags, 'K') >= 0, strings.IndexByte(*flags, 'E') >= 0
+}
+
+// enabled reports whether any event can be notified at all.
+func (n *keyspaceNotifier) enabled() bool {
+	flags := n.flags.Load()
+	return flags != nil && strings.ContainsAny(*flags, "KE") && strings.ContainsAny(*flags, keyspaceAllClasses)
+}
+
+// SetKeyspaceEvents sets the classes of keyspace events to publish, in the
+// notify-keyspace-events format.
+func (s *Server) SetKeyspaceEvents(flags string) {
+	s.keyspace.set(flags)
+}
+
+// NotifyKeyspaceEvent publishes an event the cache raised by itself, such
+// as the expiry or eviction of a key.
+func (s *Server) NotifyKeyspaceEvent(class byte, event, key string) {
+	s.notifyKeyspaceEvent(0, keyspaceEvent{class: class, event: event, key: key})
+}
+
+// notifyKeyspaceEvent publishes e on __keyspace@<db>__:<key> and
+// __keyevent@<db>__:<event> as the flags allow.
+func (s *Server) notifyKeyspaceEvent(db int, e keyspaceEvent) {
+	keyspace, keyevent := s.keyspace.channels(e.class)
+	if keyspace {
+		s.Publish("__keyspace@"+strconv.Itoa(db)+"__:"+e.key, e.event)
+	}
+	if keyevent {
+		s.Publish("__keyevent@"+strconv.Itoa(db)+"__:"+e.event, e.key)
+	}
+}
+
+// prepareKeyspaceEvents returns the function publishing the events of a
+// command once it has run, or nil if it raises none.
+func (s *Server) prepareKeyspaceEvents(db int, cmd string, args []models.Value) func(result models.Value) {
+	if !s.keyspace.enabled() {
+		return nil
+	}
+	rule, exists := keyspaceRules[cmd]
+	if !exists {
+		return nil
+	}
+
+	// DEL only notifies the keys it actually removed
+	existed := map[string]bool{}
+	if cmd == "DEL" || cmd == "UNLINK" {
+		for _, arg := range args {
+			existed[arg.Bulk] = s.cache.Exists(arg.Bulk)
+		}
+	}
+
+	return func(result models.Value) {
+		for _, e := range rule(args, result, func(key string) bool { return existed[key] }) {
+			s.notifyKeyspaceEvent(db, e)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyspaceRules(t *testing.T) {
+	ok := models.Value{Type: "string", Str: "OK"}
+	one := models.Value{Type: "integer", Num: 1}
+	zero := models.Value{Type: "integer", Num: 0}
+	existing := func(key string) bool { return key != "missing" }
+
+	tests := []struct {
+		cmd      string
+		args     []string
+		result   models.Value
+		expected []keyspaceEvent
+	}{
+		{"SET", []string{"k", "v"}, ok, []keyspaceEvent{{'$', "set", "k"}}},
+		{"SET", []string{"k", "v", "NX"}, models.Value{Type: "null"}, nil},
+		{"SET", []string{"k"}, models.Value{Type: "error", Str: "ERR syntax error"}, nil},
+		{"MSET", []string{"a", "1", "b", "2"}, ok, []keyspaceEvent{{'$', "set", "a"}, {'$', "set", "b"}}},
+		{"MSETNX", []string{"a", "1", "b", "2"}, zero, nil},
+		{"INCR", []string{"k"}, zero, []keyspaceEvent{{'$', "incrby", "k"}}},
+		{"DEL", []string{"a", "missing", "b"}, models.Value{Type: "integer", Num: 2},
+			[]keyspaceEvent{{'g', "del", "a"}, {'g', "del", "b"}}},
+		{"DEL", []string{"missing"}, zero, nil},
+		{"EXPIRE", []string{"k", "10"}, one, []keyspaceEvent{{'g', "expire", "k"}}},
+		{"RENAME", []string{"a", "b"}, ok, []keyspaceEvent{{'g', "rename_from", "a"}, {'g', "rename_to", "b"}}},
+		{"LMOVE", []string{"src", "dst", "LEFT", "RIGHT"}, models.Value{Type: "bulk", Bulk: "x"},
+			[]keyspaceEvent{{'l', "lpop", "src"}, {'l', "rpush", "dst"}}},
+		{"BLPOP", []string{"a", "b", "0"}, models.Value{Type: "array", Array: []models.Value{{Type: "bulk", Bulk: "b"}, {Type: "bulk", Bulk: "x"}}},
+			[]keyspaceEvent{{'l', "lpop", "b"}}},
+		{"LINSERT", []string{"l", "BEFORE", "p", "v"}, models.Value{Type: "integer", Num: -1}, nil},
+		{"HSET", []string{"h", "f", "v"}, zero, []keyspaceEvent{{'h', "hset", "h"}}},
+		{"SADD", []string{"s", "m"}, zero, nil},
+		{"ZADD", []string{"z", "1", "m"}, one, []keyspaceEvent{{'z', "zadd", "z"}}},
+	}
+
+	for _, tt := range tests {
+		args := make([]models.Value, len(tt.args))
+		for i, arg := range tt.args {
+			args[i] = models.Value{Type: "bulk", Bulk: arg}
+		}
+		events := keyspaceRules[tt.cmd](args, tt.result, existing)
+		assert.Equal(t, tt.expected, events, "%s %q", tt.cmd, tt.args)
+	}
+}
+
+func TestKeyspaceNotifierFlags(t *testing.T) {
+	var n keyspaceNotifier
+	assert.False(t, n.enabled())
+
+	n.set("")
+	assert.False(t, n.enabled())
+
+	// A class without a channel type, or the reverse, notifies nothing
+	n.set("g$")
+	assert.False(t, n.enabled())
+	n.set("KE")
+	assert.False(t, n.enabled())
+
+	n.set("Kl")
+	assert.True(t, n.enabled())
+	keyspace, keyevent := n.channels('l')
+	assert.True(t, keyspace)
+	assert.False(t, keyevent)
+	keyspace, keyevent = n.channels('$')
+	assert.False(t, keyspace || keyevent)
+
+	n.set("EA")
+	for _, class := range []byte("g$lshzxetd") {
+		keyspace, keyevent = n.channels(class)
+		assert.False(t, keyspace)
+		assert.True(t, keyevent, "class %c", class)
+	}
+	keyspace, keyevent = n.channels('m')
+	assert.False(t, keyspace || keyevent)
+}
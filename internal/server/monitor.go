@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/pkg/resp"
+)
+
+// monitorBufferSize is the number of pending lines a monitor may lag behind
+// before new lines are dropped for it.
+const monitorBufferSize = 1024
+
+const redactedArg = "(redacted)"
+
+// monitorHub fans out executed commands to MONITOR connections. The number of
+// attached monitors is tracked atomically so the command path can skip all
+// formatting work when nobody is listening.
+type monitorHub struct {
+	mu       sync.RWMutex
+	count    int32
+	monitors map[net.Conn]*monitor
+}
+
+type monitor struct {
+	lines   chan models.Value
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newMonitorHub() *monitorHub {
+	return &monitorHub{
+		monitors: make(map[net.Conn]*monitor),
+	}
+}
+
+// active reports whether at least one MONITOR connection is attached.
+func (h *monitorHub) active() bool {
+	return atomic.LoadInt32(&h.count) > 0
+}
+
+// add registers conn as a monitor, acknowledges it with +OK and starts the
+// goroutine that streams lines to it. While in monitor mode every reply to
+// the connection must go through reply so it is serialized with the stream.
+func (h *monitorHub) add(conn net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, exists := h.monitors[conn]; exists {
+		return
+	}
+
+	m := &monitor{
+		lines:   make(chan models.Value, monitorBufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	m.lines <- models.Value{Type: "string", Str: "OK"}
+	h.monitors[conn] = m
+	atomic.AddInt32(&h.count, 1)
+
+	go m.run(resp.NewWriter(conn))
+}
+
+// remove detaches conn from the hub and waits for its writer goroutine to
+// exit, after which the caller owns the connection again. It is safe to call
+// for connections that were never monitors.
+func (h *monitorHub) remove(conn net.Conn) {
+	h.mu.Lock()
+	m, exists := h.monitors[conn]
+	if exists {
+		delete(h.monitors, conn)
+		atomic.AddInt32(&h.count, -1)
+		close(m.done)
+	}
+	h.mu.Unlock()
+
+	if exists {
+		<-m.stopped
+	}
+}
+
+// isMonitor reports whether conn is currently in MONITOR mode.
+func (h *monitorHub) isMonitor(conn net.Conn) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, exists := h.monitors[conn]
+	return exists
+}
+
+// reply queues a response to a command issued by a monitor connection.
+func (h *monitorHub) reply(conn net.Conn, value models.Value) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if m, exists := h.monitors[conn]; exists {
+		m.send(value)
+	}
+}
+
+// feed formats a command and delivers it to every attached monitor. Slow
+// monitors lose lines instead of stalling the command path.
+func (h *monitorHub) feed(addr string, db int, args []models.Value) {
+	line := models.Value{Type: "string", Str: formatMonitorLine(time.Now(), db, addr, args)}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, m := range h.monitors {
+		m.send(line)
+	}
+}
+
+func (m *monitor) send(line models.Value) {
+	select {
+	case m.lines <- line:
+	default:
+	}
+}
+
+func (m *monitor) run(writer *resp.Writer) {
+	defer close(m.stopped)
+	for {
+		select {
+		case <-m.done:
+			return
+		case line := <-m.lines:
+			if err := writer.Write(line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// formatMonitorLine renders a command the way Redis does:
+//
+//	1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func formatMonitorLine(t time.Time, db int, addr string, args []models.Value) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%d %s]", t.Unix(), t.Nanosecond()/1000, db, addr)
+	for _, arg := range redactArgs(args) {
+		b.WriteByte(' ')
+		b.WriteString(quoteMonitorArg(arg))
+	}
+	return b.String()
+}
+
+// redactArgs returns the command arguments as strings with credentials
+// replaced. AUTH hides every argument after the username, HELLO hides the
+// AUTH password and ACL SETUSER hides password rules (>pass, <pass, #hash,
+// !hash).
+func redactArgs(args []models.Value) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = arg.Bulk
+	}
+	if len(out) == 0 {
+		return out
+	}
+
+	switch strings.ToUpper(out[0]) {
+	case "AUTH":
+		// AUTH password | AUTH username password
+		for i := 1; i < len(out); i++ {
+			if i == 1 && len(out) == 3 {
+				continue
+			}
+			out[i] = redactedArg
+		}
+	case "HELLO":
+		for i := 1; i < len(out); i++ {
+			if strings.EqualFold(out[i], "AUTH") && i+2 < len(out) {
+				out[i+2] = redactedArg
+			}
+		}
+	case "ACL":
+		if len(out) > 1 && strings.EqualFold(out[1], "SETUSER") {
+			for i := 3; i < len(out); i++ {
+				if out[i] == "" {
+					continue
+				}
+				switch out[i][0] {
+				case '>', '<', '#', '!':
+					out[i] = out[i][:1] + redactedArg
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// quoteMonitorArg quotes s with the escaping rules of Redis' sdscatrepr.
+func quoteMonitorArg(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < 0x20 || c > 0x7e {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
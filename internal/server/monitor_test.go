@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/cache"
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/pkg/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func bulkArgs(args ...string) []models.Value {
+	values := make([]models.Value, len(args))
+	for i, arg := range args {
+		values[i] = models.Value{Type: "bulk", Bulk: arg}
+	}
+	return values
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"AUTH", "secret"}, []string{"AUTH", redactedArg}},
+		{[]string{"auth", "alice", "secret"}, []string{"auth", "alice", redactedArg}},
+		{
+			[]string{"HELLO", "3", "AUTH", "alice", "secret", "SETNAME", "c"},
+			[]string{"HELLO", "3", "AUTH", "alice", redactedArg, "SETNAME", "c"},
+		},
+		{[]string{"HELLO", "3"}, []string{"HELLO", "3"}},
+		{
+			[]string{"ACL", "SETUSER", "alice", "on", ">pass", "<old", "#abc", "!def", "~*", "+@all"},
+			[]string{"ACL", "SETUSER", "alice", "on", ">" + redactedArg, "<" + redactedArg, "#" + redactedArg, "!" + redactedArg, "~*", "+@all"},
+		},
+		// The username is not a password rule even if it looks like one
+		{[]string{"acl", "setuser", ">name", ""}, []string{"acl", "setuser", ">name", ""}},
+		{[]string{"ACL", "LIST"}, []string{"ACL", "LIST"}},
+		{[]string{"SET", ">k", "secret"}, []string{"SET", ">k", "secret"}},
+		{nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, redactArgs(bulkArgs(tt.args...)), "%q", tt.args)
+	}
+}
+
+func TestQuoteMonitorArg(t *testing.T) {
+	tests := map[string]string{
+		"plain":          `"plain"`,
+		`say "hi"`:       `"say \"hi\""`,
+		`back\slash`:     `"back\\slash"`,
+		"a\r\n\t\a\b":    `"a\r\n\t\a\b"`,
+		"\x00\x1f\x7f":   `"\x00\x1f\x7f"`,
+		"caf\xc3\xa9":    `"caf\xc3\xa9"`,
+		"":               `""`,
+		"space and ~!@#": `"space and ~!@#"`,
+	}
+
+	for arg, expected := range tests {
+		assert.Equal(t, expected, quoteMonitorArg(arg), "%q", arg)
+	}
+}
+
+func TestFormatMonitorLine(t *testing.T) {
+	at := time.Unix(1339518083, 107412000)
+	line := formatMonitorLine(at, 0, "127.0.0.1:60866", bulkArgs("AUTH", "secret"))
+	assert.Equal(t, `1339518083.107412 [0 127.0.0.1:60866] "AUTH" "(redacted)"`, line)
+}
+
+// readLine reads a simple string reply written to a monitor
+func readLine(t *testing.T, conn net.Conn, r *bufio.Reader) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+func TestMonitorHub(t *testing.T) {
+	hub := newMonitorHub()
+	assert.False(t, hub.active())
+
+	server, client := net.Pipe()
+	defer client.Close()
+	other, otherClient := net.Pipe()
+	defer otherClient.Close()
+	r := bufio.NewReader(client)
+
+	hub.add(server)
+	hub.add(server)
+	assert.True(t, hub.active())
+	assert.True(t, hub.isMonitor(server))
+	assert.False(t, hub.isMonitor(other))
+	assert.Equal(t, "+OK", readLine(t, client, r))
+
+	hub.feed("127.0.0.1:6000", 0, bulkArgs("SET", "k", "v"))
+	assert.Regexp(t, `^\+\d+\.\d{6} \[0 127\.0\.0\.1:6000\] "SET" "k" "v"$`, readLine(t, client, r))
+
+	// Replies and lines to other connections never reach the monitor
+	hub.reply(other, models.Value{Type: "string", Str: "IGNORED"})
+	hub.reply(server, models.Value{Type: "error", Str: "ERR only QUIT and RESET are allowed in MONITOR mode"})
+	assert.Equal(t, "-ERR only QUIT and RESET are allowed in MONITOR mode", readLine(t, client, r))
+
+	hub.remove(server)
+	hub.remove(other)
+	assert.False(t, hub.active())
+	assert.False(t, hub.isMonitor(server))
+
+	// A removed monitor no longer gets lines
+	hub.feed("127.0.0.1:6000", 0, bulkArgs("GET", "k"))
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := r.ReadString('\n')
+	assert.Error(t, err)
+}
+
+func TestMonitorHubClosedConnection(t *testing.T) {
+	hub := newMonitorHub()
+	server, client := net.Pipe()
+	hub.add(server)
+	require.Equal(t, "+OK", readLine(t, client, bufio.NewReader(client)))
+
+	// The writer stops on the failed write and removal does not block
+	client.Close()
+	hub.feed("127.0.0.1:6000", 0, bulkArgs("PING"))
+	done := make(chan struct{})
+	go func() {
+		hub.remove(server)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("remove blocked on a closed monitor")
+	}
+	assert.False(t, hub.active())
+	assert.False(t, hub.isMonitor(server))
+}
+
+func TestMonitorQuitRepliesBeforeClosing(t *testing.T) {
+	s := &Server{monitors: newMonitorHub()}
+	server, client := net.Pipe()
+	defer client.Close()
+	r := bufio.NewReader(client)
+
+	s.monitors.add(server)
+	require.Equal(t, "+OK", readLine(t, client, r))
+
+	// Fill the monitor's backlog so that nothing more can be queued
+	for i := 0; i < monitorBufferSize+10; i++ {
+		s.monitors.feed("127.0.0.1:6000", 0, bulkArgs("PING"))
+	}
+
+	closed := make(chan bool, 1)
+	go func() {
+		closed <- s.handleMonitorCommand(server, resp.NewWriter(server), "QUIT")
+	}()
+
+	// Monitor lines may still arrive, but the last line is the reply
+	var line string
+	for line != "+OK" {
+		line = readLine(t, client, r)
+	}
+	assert.True(t, <-closed)
+	assert.False(t, s.monitors.isMonitor(server))
+}
+
+func TestMonitorSkipsRejectedWrites(t *testing.T) {
+	s := NewServer(cache.NewMemoryCache(), nil, nil, ServerConfig{})
+	s.isMaster = false
+	server, client := net.Pipe()
+	defer client.Close()
+	r := bufio.NewReader(client)
+
+	s.monitors.add(server)
+	defer s.monitors.remove(server)
+	require.Equal(t, "+OK", readLine(t, client, r))
+
+	reply := s.handleCommand(nil, models.Value{Type: "array", Array: bulkArgs("SET", "k", "v")})
+	require.Equal(t, "error", reply.Type)
+	assert.Contains(t, reply.Str, "READONLY")
+
+	// The rejected write never reaches the monitor, so the next line is
+	// the read that follows it
+	s.handleCommand(nil, models.Value{Type: "array", Array: bulkArgs("GET", "k")})
+	assert.Regexp(t, `"GET" "k"$`, readLine(t, client, r))
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/pkg/resp"
+	"github.com/genc-murat/crystalcache/pkg/utils/pattern"
+)
+
+// pubsubBufferSize is the number of pending messages a subscriber may lag
+// behind before new messages are dropped for it.
+const pubsubBufferSize = 1024
+
+// pubsubHub delivers published messages to the connections subscribed to
+// their channel or to a pattern matching it. As with monitors, a subscribed
+// connection is written to by its own goroutine, so every reply to it must
+// go through the hub until its last subscription is gone.
+type pubsubHub struct {
+	mu          sync.RWMutex
+	subscribers map[net.Conn]*subscriber
+	channels    map[string]map[*subscriber]struct{}
+	patterns    map[string]map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	messages chan models.Value
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newPubSubHub() *pubsubHub {
+	return &pubsubHub{
+		subscribers: make(map[net.Conn]*subscriber),
+		channels:    make(map[string]map[*subscriber]struct{}),
+		patterns:    make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// isSubscriber reports whether conn has at least one subscription.
+func (h *pubsubHub) isSubscriber(conn net.Conn) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, exists := h.subscribers[conn]
+	return exists
+}
+
+// subscribe subscribes conn to channels, or to patterns if byPattern is
+// set, switching it into subscribed mode if it is not yet.
+func (h *pubsubHub) subscribe(conn net.Conn, names []string, byPattern bool) {
+	h.mu.Lock()
+	s, exists := h.subscribers[conn]
+	if !exists {
+		s = &subscriber{
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+			messages: make(chan models.Value, pubsubBufferSize),
+			done:     make(chan struct{}),
+			stopped:  make(chan struct{}),
+		}
+		h.subscribers[conn] = s
+		go s.run(resp.NewWriter(conn))
+	}
+
+	kind, own, all := "subscribe", s.channels, h.channels
+	if byPattern {
+		kind, own, all = "psubscribe", s.patterns, h.patterns
+	}
+	replies := make([]models.Value, len(names))
+	for i, name := range names {
+		own[name] = struct{}{}
+		if all[name] == nil {
+			all[name] = make(map[*subscriber]struct{})
+		}
+		all[name][s] = struct{}{}
+		replies[i] = pubsubReply(kind, name, s.count())
+	}
+	h.mu.Unlock()
+
+	for _, reply := range replies {
+		s.reply(reply)
+	}
+}
+
+// unsubscribe unsubscribes conn from channels, or patterns if byPattern is
+// set, and from all of them if names is empty. The connection leaves
+// subscribed mode with its last subscription, after which replies go to
+// writer again.
+func (h *pubsubHub) unsubscribe(conn net.Conn, names []string, byPattern bool, writer *resp.Writer) {
+	kind := "unsubscribe"
+	if byPattern {
+		kind = "punsubscribe"
+	}
+
+	h.mu.Lock()
+	s, exists := h.subscribers[conn]
+	if !exists {
+		h.mu.Unlock()
+		if len(names) == 0 {
+			writer.Write(pubsubReply(kind, "", 0))
+		}
+		for _, name := range names {
+			writer.Write(pubsubReply(kind, name, 0))
+		}
+		return
+	}
+
+	own, all := s.channels, h.channels
+	if byPattern {
+		own, all = s.patterns, h.patterns
+	}
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var replies []models.Value
+	if len(names) == 0 {
+		replies = append(replies, pubsubReply(kind, "", s.count()))
+	}
+	for _, name := range names {
+		delete(own, name)
+		if subscribers, ok := all[name]; ok {
+			delete(subscribers, s)
+			if len(subscribers) == 0 {
+				delete(all, name)
+			}
+		}
+		replies = append(replies, pubsubReply(kind, name, s.count()))
+	}
+	h.mu.Unlock()
+
+	for _, reply := range replies {
+		s.reply(reply)
+	}
+	if s.count() == 0 {
+		h.remove(conn)
+	}
+}
+
+// remove drops every subscription of conn and waits for its writer
+// goroutine to flush its pending messages and exit, after which the caller
+// owns the connection again. It is safe to call for connections that never
+// subscribed.
+func (h *pubsubHub) remove(conn net.Conn) {
+	h.mu.Lock()
+	s, exists := h.subscribers[conn]
+	if exists {
+		delete(h.subscribers, conn)
+		for name := range s.channels {
+			h.drop(h.channels, name, s)
+		}
+		for name := range s.patterns {
+			h.drop(h.patterns, name, s)
+		}
+		close(s.done)
+	}
+	h.mu.Unlock()
+
+	if exists {
+		<-s.stopped
+	}
+}
+
+func (h *pubsubHub) drop(all map[string]map[*subscriber]struct{}, name string, s *subscriber) {
+	delete(all[name], s)
+	if len(all[name]) == 0 {
+		delete(all, name)
+	}
+}
+
+// reply queues a response to a command issued by a subscribed connection.
+func (h *pubsubHub) reply(conn net.Conn, value models.Value) {
+	h.mu.RLock()
+	s, exists := h.subscribers[conn]
+	h.mu.RUnlock()
+	if exists {
+		s.reply(value)
+	}
+}
+
+// publish delivers message to the subscribers of channel and of the
+// patterns matching it, and returns the number of deliveries. Slow
+// subscribers lose messages instead of stalling the publisher.
+func (h *pubsubHub) publish(channel, message string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	receivers := 0
+	if subscribers, ok := h.channels[channel]; ok {
+		value := models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: "message"},
+			{Type: "bulk", Bulk: channel},
+			{Type: "bulk", Bulk: message},
+		}}
+		for s := range subscribers {
+			s.send(value)
+			receivers++
+		}
+	}
+	for p, subscribers := range h.patterns {
+		if !pattern.Match(p, channel) {
+			continue
+		}
+		value := models.Value{Type: "array", Array: []models.Value{
+			{Type: "bulk", Bulk: "pmessage"},
+			{Type: "bulk", Bulk: p},
+			{Type: "bulk", Bulk: channel},
+			{Type: "bulk", Bulk: message},
+		}}
+		for s := range subscribers {
+			s.send(value)
+			receivers++
+		}
+	}
+	return receivers
+}
+
+// activeChannels returns the channels with subscribers matching pat, all
+// of them if pat is empty.
+func (h *pubsubHub) activeChannels(pat string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var channels []string
+	for channel := range h.channels {
+		if pat == "" || pattern.Match(pat, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// numSub returns the number of subscribers of a channel.
+func (h *pubsubHub) numSub(channel string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.channels[channel])
+}
+
+// numPat returns the number of patterns subscribed to.
+func (h *pubsubHub) numPat() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.patterns)
+}
+
+// count returns the number of subscriptions. The hub lock must be held or
+// the subscriber owned by the caller.
+func (s *subscriber) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// reply queues a response, which unlike a message is never dropped.
+func (s *subscriber) reply(value models.Value) {
+	select {
+	case s.messages <- value:
+	case <-s.done:
+	}
+}
+
+func (s *subscriber) send(value models.Value) {
+	select {
+	case s.messages <- value:
+	default:
+	}
+}
+
+func (s *subscriber) run(writer *resp.Writer) {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.done:
+			// Flush what is queued, such as the replies to the
+			// unsubscribe that ended subscribed mode
+			for {
+				select {
+				case value := <-s.messages:
+					if err := writer.Write(value); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		case value := <-s.messages:
+			if err := writer.Write(value); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pubsubReply is the reply to a (un)subscription: its kind, the channel or
+// pattern, nil if there is none, and the remaining subscriptions.
+func pubsubReply(kind, name string, count int) models.Value {
+	channel := models.Value{Type: "bulk", Bulk: name}
+	if name == "" {
+		channel = models.Value{Type: "null"}
+	}
+	return models.Value{Type: "array", Array: []models.Value{
+		{Type: "bulk", Bulk: kind},
+		channel,
+		{Type: "integer", Num: count},
+	}}
+}
+
+// handlePubSub serves SUBSCRIBE, UNSUBSCRIBE, PSUBSCRIBE and PUNSUBSCRIBE.
+func (s *Server) handlePubSub(conn net.Conn, writer *resp.Writer, cmd string, args []models.Value) {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = arg.Bulk
+	}
+
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(names) == 0 {
+			err := models.Value{Type: "error", Str: fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))}
+			if s.pubsub.isSubscriber(conn) {
+				s.pubsub.reply(conn, err)
+			} else {
+				writer.Write(err)
+			}
+			return
+		}
+		s.pubsub.subscribe(conn, names, cmd == "PSUBSCRIBE")
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		s.pubsub.unsubscribe(conn, names, cmd == "PUNSUBSCRIBE", writer)
+	}
+}
+
+// isPubSubCommand reports whether cmd (un)subscribes the connection.
+func isPubSubCommand(cmd string) bool {
+	switch cmd {
+	case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+// Publish delivers a message to the subscribers of channel and returns the
+// number of deliveries, so that the cache can publish events.
+func (s *Server) Publish(channel, message string) int {
+	return s.pubsub.publish(channel, message)
+}
+
+// HandlePublish serves PUBLISH channel message.
+func (s *Server) HandlePublish(args []models.Value) models.Value {
+	if len(args) != 2 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'publish' command"}
+	}
+	return models.Value{Type: "integer", Num: s.Publish(args[0].Bulk, args[1].Bulk)}
+}
+
+// HandlePubSubInfo serves PUBSUB CHANNELS [pattern], PUBSUB NUMSUB
+// [channel ...] and PUBSUB NUMPAT.
+func (s *Server) HandlePubSubInfo(args []models.Value) models.Value {
+	if len(args) == 0 {
+		return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'pubsub' command"}
+	}
+
+	switch strings.ToUpper(args[0].Bulk) {
+	case "CHANNELS":
+		if len(args) > 2 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'pubsub|channels' command"}
+		}
+		pat := ""
+		if len(args) == 2 {
+			pat = args[1].Bulk
+		}
+		channels := s.pubsub.activeChannels(pat)
+		result := make([]models.Value, len(channels))
+		for i, channel := range channels {
+			result[i] = models.Value{Type: "bulk", Bulk: channel}
+		}
+		return models.Value{Type: "array", Array: result}
+	case "NUMSUB":
+		result := make([]models.Value, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			result = append(result,
+				models.Value{Type: "bulk", Bulk: arg.Bulk},
+				models.Value{Type: "integer", Num: s.pubsub.numSub(arg.Bulk)})
+		}
+		return models.Value{Type: "array", Array: result}
+	case "NUMPAT":
+		if len(args) != 1 {
+			return models.Value{Type: "error", Str: "ERR wrong number of arguments for 'pubsub|numpat' command"}
+		}
+		return models.Value{Type: "integer", Num: s.pubsub.numPat()}
+	default:
+		return models.Value{Type: "error", Str: fmt.Sprintf("ERR unknown subcommand '%s'. Try PUBSUB HELP.", args[0].Bulk)}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/pkg/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readPush reads an array written to a subscriber, with integers as
+// decimals and a missing channel as "(nil)"
+func readPush(t *testing.T, conn net.Conn, r *resp.Reader) []string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	value, err := r.Read()
+	require.NoError(t, err)
+	require.Equal(t, "array", value.Type, value.Str)
+
+	fields := make([]string, len(value.Array))
+	for i, v := range value.Array {
+		switch v.Type {
+		case "integer":
+			fields[i] = strconv.Itoa(v.Num)
+		case "null":
+			fields[i] = "(nil)"
+		default:
+			fields[i] = v.Bulk
+		}
+	}
+	return fields
+}
+
+func TestPubSubHub(t *testing.T) {
+	hub := newPubSubHub()
+	server, client := net.Pipe()
+	defer client.Close()
+	r := resp.NewReader(client)
+
+	t.Run("Test Subscribe", func(t *testing.T) {
+		hub.subscribe(server, []string{"news", "sport"}, false)
+		assert.True(t, hub.isSubscriber(server))
+		assert.Equal(t, []string{"subscribe", "news", "1"}, readPush(t, client, r))
+		assert.Equal(t, []string{"subscribe", "sport", "2"}, readPush(t, client, r))
+
+		// Subscribing twice keeps a single subscription
+		hub.subscribe(server, []string{"news"}, false)
+		assert.Equal(t, []string{"subscribe", "news", "2"}, readPush(t, client, r))
+		assert.Equal(t, 1, hub.numSub("news"))
+		assert.Equal(t, []string{"news", "sport"}, hub.activeChannels(""))
+		assert.Equal(t, []string{"sport"}, hub.activeChannels("s*"))
+	})
+
+	t.Run("Test PSubscribe", func(t *testing.T) {
+		hub.subscribe(server, []string{"n*"}, true)
+		assert.Equal(t, []string{"psubscribe", "n*", "3"}, readPush(t, client, r))
+		assert.Equal(t, 1, hub.numPat())
+	})
+
+	t.Run("Test Message Delivery", func(t *testing.T) {
+		assert.Equal(t, 2, hub.publish("news", "hello"))
+		assert.Equal(t, []string{"message", "news", "hello"}, readPush(t, client, r))
+		assert.Equal(t, []string{"pmessage", "n*", "news", "hello"}, readPush(t, client, r))
+
+		assert.Equal(t, 1, hub.publish("nature", "rain"))
+		assert.Equal(t, []string{"pmessage", "n*", "nature", "rain"}, readPush(t, client, r))
+
+		assert.Equal(t, 0, hub.publish("weather", "sun"))
+	})
+
+	t.Run("Test Unsubscribe", func(t *testing.T) {
+		hub.unsubscribe(server, []string{"news"}, false, nil)
+		assert.Equal(t, []string{"unsubscribe", "news", "2"}, readPush(t, client, r))
+		assert.Equal(t, 0, hub.numSub("news"))
+		assert.Equal(t, 1, hub.publish("news", "again"))
+		assert.Equal(t, []string{"pmessage", "n*", "news", "again"}, readPush(t, client, r))
+
+		hub.unsubscribe(server, nil, true, nil)
+		assert.Equal(t, []string{"punsubscribe", "n*", "1"}, readPush(t, client, r))
+		assert.Equal(t, 0, hub.numPat())
+
+		// The last unsubscription leaves subscribed mode once its reply
+		// is written
+		done := make(chan struct{})
+		go func() {
+			hub.unsubscribe(server, nil, false, nil)
+			close(done)
+		}()
+		assert.Equal(t, []string{"unsubscribe", "sport", "0"}, readPush(t, client, r))
+		<-done
+		assert.False(t, hub.isSubscriber(server))
+		assert.Empty(t, hub.activeChannels(""))
+		assert.Equal(t, 0, hub.publish("sport", "score"))
+	})
+
+	t.Run("Test Unsubscribe Without Subscriptions", func(t *testing.T) {
+		// The reply goes to the connection's own writer
+		go hub.unsubscribe(server, nil, false, resp.NewWriter(server))
+		assert.Equal(t, []string{"unsubscribe", "(nil)", "0"}, readPush(t, client, r))
+	})
+}
+
+func TestPubSubHubClosedConnection(t *testing.T) {
+	hub := newPubSubHub()
+	server, client := net.Pipe()
+	hub.subscribe(server, []string{"news"}, false)
+	require.Equal(t, []string{"subscribe", "news", "1"}, readPush(t, client, resp.NewReader(client)))
+
+	// The writer stops on the failed write and removal does not block
+	client.Close()
+	hub.publish("news", "hello")
+	done := make(chan struct{})
+	go func() {
+		hub.remove(server)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("remove blocked on a closed subscriber")
+	}
+	assert.False(t, hub.isSubscriber(server))
+	assert.Equal(t, 0, hub.publish("news", "hello"))
+}
@@ -8,9 +8,11 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/genc-murat/crystalcache/internal/client"
+	"github.com/genc-murat/crystalcache/internal/config"
 	"github.com/genc-murat/crystalcache/internal/core/acl"
 	"github.com/genc-murat/crystalcache/internal/core/models"
 	"github.com/genc-murat/crystalcache/internal/core/ports"
@@ -29,6 +31,8 @@ type Server struct {
 	storage  ports.Storage
 	pool     ports.Pool
 	metrics  *metrics.Metrics
+	slowlog  *metrics.SlowLog
+	latency  *metrics.LatencyMonitor
 	registry *handlers.Registry
 
 	clientManager *client.Manager
@@ -43,6 +47,16 @@ type Server struct {
 	aclManager    *acl.ACLManager
 	aclMiddleware *acl.Middleware
 
+	monitors *monitorHub
+	pubsub   *pubsubHub
+	keyspace keyspaceNotifier
+	repl     replicationStats
+
+	idleTimeout  atomic.Int64 // nanoseconds, zero disables
+	writeTimeout atomic.Int64 // nanoseconds, zero disables
+	maxClients   atomic.Int32 // zero means unlimited
+	clients      atomic.Int32 // connections holding a client slot
+
 	shutdown   chan struct{}
 	isMaster   bool
 	masterHost string
@@ -59,13 +73,26 @@ type ServerConfig struct {
 	WriteTimeout   time.Duration
 	IdleTimeout    time.Duration
 	MaxConnections int
+
+	// SlowLogSlowerThan is in microseconds; negative disables the slow log.
+	SlowLogSlowerThan int64
+	SlowLogMaxLen     int
+	// LatencyMonitorThreshold is in milliseconds; zero disables the monitor.
+	LatencyMonitorThreshold int64
+	// NotifyKeyspaceEvents selects the keyspace events to publish, as
+	// notify-keyspace-events does.
+	NotifyKeyspaceEvents string
+
+	// Params, when set, backs CONFIG GET/SET/REWRITE. The server registers
+	// apply hooks for the parameters it owns.
+	Params *config.Registry
 }
 
 func NewServer(cache ports.Cache, storage ports.Storage, pool ports.Pool, config ServerConfig) *Server {
-	metrics := metrics.NewMetrics()
+	cmdMetrics := metrics.NewMetrics()
 	clientManager := client.NewManager()
 	registry := handlers.NewRegistry(cache, clientManager)
-	adminHandlers := handlers.NewAdminHandlers(cache, clientManager)
+	adminHandlers := registry.AdminHandlers()
 
 	aclManager := acl.NewACLManager()
 	// Create default user with full permissions if it doesn't exist
@@ -76,11 +103,18 @@ func NewServer(cache ports.Cache, storage ports.Storage, pool ports.Pool, config
 
 	aclMiddleware := acl.NewMiddleware(aclManager)
 
-	return &Server{
+	slowlog := metrics.NewSlowLog(config.SlowLogSlowerThan, config.SlowLogMaxLen)
+	latency := metrics.NewLatencyMonitor(config.LatencyMonitorThreshold)
+	registry.Register("SLOWLOG", handlers.NewSlowLogHandlers(slowlog).HandleSlowLog)
+	registry.Register("LATENCY", handlers.NewLatencyHandlers(latency).HandleLatency)
+
+	s := &Server{
 		cache:         cache,
 		storage:       storage,
 		pool:          pool,
-		metrics:       metrics,
+		metrics:       cmdMetrics,
+		slowlog:       slowlog,
+		latency:       latency,
 		registry:      registry,
 		shutdown:      make(chan struct{}),
 		clientManager: clientManager,
@@ -89,10 +123,43 @@ func NewServer(cache ports.Cache, storage ports.Storage, pool ports.Pool, config
 		replicas:      make(map[string]*replica),
 		aclManager:    aclManager,
 		aclMiddleware: aclMiddleware,
+		monitors:      newMonitorHub(),
+		pubsub:        newPubSubHub(),
 	}
+	s.SetTimeouts(config.IdleTimeout, config.WriteTimeout)
+	s.SetMaxClients(config.MaxConnections)
+	s.SetKeyspaceEvents(config.NotifyKeyspaceEvents)
+
+	registry.Register("PUBLISH", s.HandlePublish)
+	registry.Register("PUBSUB", s.HandlePubSubInfo)
+	registry.Register("CONFIG", handlers.NewConfigHandlers(cache, config.Params, cmdMetrics).HandleConfig)
+	if config.Params != nil {
+		s.bindParams(config.Params)
+	}
+	return s
 }
 
-func isWriteCommand(cmd string) bool {
+func isWriteCommand(cmd string, args []models.Value) bool {
+	switch cmd {
+	case "GEORADIUS", "GEORADIUSBYMEMBER":
+		// These only write with STORE or STOREDIST, which follow the
+		// center and the radius
+		options := 5
+		if cmd == "GEORADIUSBYMEMBER" {
+			options = 4
+		}
+		for i := options; i < len(args); i++ {
+			switch strings.ToUpper(args[i].Bulk) {
+			case "STORE", "STOREDIST":
+				return true
+			}
+		}
+		return false
+	case "GEOFENCE":
+		// GEOFENCE LIST only reads the fences
+		return len(args) == 0 || !strings.EqualFold(args[0].Bulk, "LIST")
+	}
+
 	writeCommands := map[string]bool{
 		// String Commands
 		"SET":         true,
@@ -106,6 +173,11 @@ func isWriteCommand(cmd string) bool {
 		"DECRBY":      true,
 		"GETSET":      true,
 		"SETRANGE":    true,
+		"SETEX":       true,
+		"PSETEX":      true,
+		"SETNX":       true,
+		"GETEX":       true,
+		"GETDEL":      true,
 
 		// Key Commands
 		"DEL":       true,
@@ -114,6 +186,7 @@ func isWriteCommand(cmd string) bool {
 		"EXPIREAT":  true,
 		"PEXPIRE":   true,
 		"PEXPIREAT": true,
+		"PERSIST":   true,
 
 		// List Commands
 		"RPUSH":   true,
@@ -175,9 +248,12 @@ func isWriteCommand(cmd string) bool {
 		"XAUTOCLAIM": true,
 
 		// Bitmap Commands
-		"SETBIT":   true,
-		"BITOP":    true,
-		"BITFIELD": true,
+		"SETBIT":        true,
+		"BITOP":         true,
+		"BITFIELD":      true,
+		"R.SETBIT":      true,
+		"R.BITOP":       true,
+		"R.SETINTARRAY": true,
 
 		// JSON Commands
 		"JSON.SET":       true,
@@ -191,7 +267,65 @@ func isWriteCommand(cmd string) bool {
 		"JSON.NUMMULTBY": true,
 		"JSON.CLEAR":     true,
 		"JSON.MERGE":     true,
+		"JSON.PATCH":     true,
 		"JSON.MSET":      true,
+		"JSON.SCHEMA":    true,
+
+		// Search Commands
+		"FT.CREATE":    true,
+		"FT.DROPINDEX": true,
+		"FT.SUGADD":    true,
+		"FT.SUGDEL":    true,
+
+		// T-Digest Commands
+		"TDIGEST.CREATE": true,
+		"TDIGEST.ADD":    true,
+		"TDIGEST.MERGE":  true,
+		"TDIGEST.RESET":  true,
+
+		// Top-K and Count-Min Sketch Commands
+		"TOPK.RESERVE":   true,
+		"TOPK.ADD":       true,
+		"TOPK.INCRBY":    true,
+		"CMS.INITBYDIM":  true,
+		"CMS.INITBYPROB": true,
+		"CMS.INCRBY":     true,
+		"CMS.MERGE":      true,
+
+		// Bloom Filter Commands
+		"BF.RESERVE":   true,
+		"BF.ADD":       true,
+		"BF.MADD":      true,
+		"BF.INSERT":    true,
+		"BF.LOADCHUNK": true,
+
+		// Cuckoo Filter Commands
+		"CF.RESERVE":   true,
+		"CF.ADD":       true,
+		"CF.ADDNX":     true,
+		"CF.INSERT":    true,
+		"CF.INSERTNX":  true,
+		"CF.DEL":       true,
+		"CF.LOADCHUNK": true,
+
+		// HyperLogLog Commands
+		"PFADD":   true,
+		"PFMERGE": true,
+
+		// Time Series Commands
+		"TS.CREATE":     true,
+		"TS.ADD":        true,
+		"TS.MADD":       true,
+		"TS.INCRBY":     true,
+		"TS.DECRBY":     true,
+		"TS.DEL":        true,
+		"TS.ALTER":      true,
+		"TS.CREATERULE": true,
+		"TS.DELETERULE": true,
+
+		// Geo Commands
+		"GEOADD":         true,
+		"GEOSEARCHSTORE": true,
 
 		// Admin Commands
 		"FLUSHALL": true,
@@ -208,6 +342,10 @@ func (s *Server) propagateToReplicas(cmd models.Value) {
 	s.replMutex.RLock()
 	defer s.replMutex.RUnlock()
 
+	if len(s.replicas) > 0 {
+		atomic.AddInt64(&s.repl.masterOffset, encodedSize(cmd))
+	}
+
 	var wg sync.WaitGroup
 
 	for addr, rep := range s.replicas {
@@ -310,13 +448,15 @@ func (s *Server) handleReplication() {
 			s.StopReplication()
 			return
 		}
+		atomic.AddInt64(&s.repl.replicaOffset, encodedSize(value))
+		atomic.StoreInt64(&s.repl.lastMasterIO, time.Now().UnixNano())
 
 		// Process command
 		if value.Type == "array" && len(value.Array) > 0 {
 			cmd := strings.ToUpper(value.Array[0].Bulk)
 			// Skip certain commands in replica mode
 			if cmd != "INFO" && cmd != "REPLCONF" {
-				s.handleCommand(value)
+				s.handleCommand(nil, value)
 			}
 		}
 	}
@@ -350,7 +490,7 @@ func (s *Server) fullSync() {
 			break
 		}
 
-		s.handleCommand(value)
+		s.handleCommand(nil, value)
 	}
 }
 
@@ -370,6 +510,52 @@ func (s *Server) SetConnectionPool(pool ports.Pool) {
 	s.pool = pool
 }
 
+// SetTimeouts changes the idle and write timeouts of client connections.
+// Zero disables a timeout.
+func (s *Server) SetTimeouts(idle, write time.Duration) {
+	s.idleTimeout.Store(int64(idle))
+	s.writeTimeout.Store(int64(write))
+}
+
+// SetMaxClients limits the number of simultaneously connected clients.
+// Zero or a negative value removes the limit.
+func (s *Server) SetMaxClients(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.maxClients.Store(int32(n))
+}
+
+// bindParams makes CONFIG SET of server parameters take effect immediately.
+func (s *Server) bindParams(params *config.Registry) {
+	timeouts := func(c *config.Config) error {
+		s.SetTimeouts(c.Server.IdleTimeout, c.Server.WriteTimeout)
+		return nil
+	}
+	params.OnChange("timeout", timeouts)
+	params.OnChange("write-timeout", timeouts)
+	params.OnChange("maxclients", func(c *config.Config) error {
+		s.SetMaxClients(c.Server.MaxConnections)
+		return nil
+	})
+	params.OnChange("slowlog-log-slower-than", func(c *config.Config) error {
+		s.slowlog.SetSlowerThan(c.SlowLog.LogSlowerThan)
+		return nil
+	})
+	params.OnChange("slowlog-max-len", func(c *config.Config) error {
+		s.slowlog.SetMaxLen(c.SlowLog.MaxLen)
+		return nil
+	})
+	params.OnChange("latency-monitor-threshold", func(c *config.Config) error {
+		s.latency.SetThreshold(c.Latency.MonitorThreshold)
+		return nil
+	})
+	params.OnChange("notify-keyspace-events", func(c *config.Config) error {
+		s.SetKeyspaceEvents(c.Cache.NotifyKeyspaceEvents)
+		return nil
+	})
+}
+
 func (s *Server) Start(address string) error {
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
@@ -383,8 +569,11 @@ func (s *Server) Start(address string) error {
 	}
 
 	log.Printf("Server listening on %s", address)
+	return s.serve(listener)
+}
 
-	// Accept connections
+// serve accepts connections on listener until shutdown.
+func (s *Server) serve(listener net.Listener) error {
 	for {
 		select {
 		case <-s.shutdown:
@@ -396,12 +585,35 @@ func (s *Server) Start(address string) error {
 				continue
 			}
 
+			// The slot is taken before the connection goroutine starts, so
+			// a burst of connections cannot get past the limit
+			if !s.reserveClient() {
+				conn.SetWriteDeadline(time.Now().Add(time.Second))
+				resp.NewWriter(conn).Write(models.Value{Type: "error", Str: "ERR max number of clients reached"})
+				conn.Close()
+				continue
+			}
+
 			s.wg.Add(1)
 			go s.handleConnection(conn)
 		}
 	}
 }
 
+// reserveClient takes a client slot for a new connection, unless maxclients
+// connections hold one already. handleConnection releases the slot.
+func (s *Server) reserveClient() bool {
+	for {
+		n := s.clients.Load()
+		if max := s.maxClients.Load(); max > 0 && n >= max {
+			return false
+		}
+		if s.clients.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
 func (s *Server) loadData() error {
 	return s.storage.Read(func(value models.Value) {
 		if len(value.Array) == 0 {
@@ -438,10 +650,15 @@ func (s *Server) GetReplicaCount() int {
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 	defer s.wg.Done()
+	defer s.clients.Add(-1)
 
 	s.adminHandlers.HandleConnection(conn)
 	client := s.clientManager.AddClient(conn)
 	defer s.clientManager.RemoveClient(conn)
+	s.metrics.IncrActiveConns()
+	defer s.metrics.DecrActiveConns()
+	defer s.monitors.remove(conn)
+	defer s.pubsub.remove(conn)
 
 	reader := resp.NewReader(conn)
 	writer := resp.NewWriter(conn)
@@ -450,7 +667,19 @@ func (s *Server) handleConnection(conn net.Conn) {
 	authenticated := true // Default user is authenticated by default
 	username := "default" // Use default username
 
+	isReplica := false
+
 	for {
+		// Monitors, subscribers and replicas legitimately stay silent and are
+		// written to from other goroutines, so only regular clients get
+		// deadlines
+		exempt := isReplica || s.monitors.isMonitor(conn) || s.pubsub.isSubscriber(conn)
+		if idle := s.idleTimeout.Load(); idle > 0 && !exempt {
+			conn.SetReadDeadline(time.Now().Add(time.Duration(idle)))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+
 		value, err := reader.Read()
 		if err != nil {
 			return
@@ -462,8 +691,56 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 		cmd := strings.ToUpper(value.Array[0].Bulk)
 
+		if timeout := s.writeTimeout.Load(); timeout > 0 && !exempt && cmd != "MONITOR" {
+			conn.SetWriteDeadline(time.Now().Add(time.Duration(timeout)))
+		} else {
+			conn.SetWriteDeadline(time.Time{})
+		}
+
+		// A monitor connection only accepts commands that leave monitor mode
+		if s.monitors.isMonitor(conn) {
+			if s.handleMonitorCommand(conn, writer, cmd) {
+				return
+			}
+			continue
+		}
+
+		// A subscribed connection only accepts commands that manage its
+		// subscriptions or leave subscribed mode
+		if s.pubsub.isSubscriber(conn) {
+			switch cmd {
+			case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE":
+			case "PING":
+				message := ""
+				if len(value.Array) > 1 {
+					message = value.Array[1].Bulk
+				}
+				s.pubsub.reply(conn, models.Value{Type: "array", Array: []models.Value{
+					{Type: "bulk", Bulk: "pong"},
+					{Type: "bulk", Bulk: message},
+				}})
+				continue
+			case "QUIT":
+				s.pubsub.reply(conn, models.Value{Type: "string", Str: "OK"})
+				s.pubsub.remove(conn)
+				return
+			case "RESET":
+				s.pubsub.remove(conn)
+				writer.Write(models.Value{Type: "string", Str: "RESET"})
+				continue
+			default:
+				s.pubsub.reply(conn, models.Value{Type: "error", Str: fmt.Sprintf(
+					"ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context",
+					strings.ToLower(cmd))})
+				continue
+			}
+		}
+
 		// Special handling for AUTH command
 		if cmd == "AUTH" {
+			if s.monitors.active() {
+				s.monitors.feed(client.Addr, client.DB, value.Array)
+			}
 			switch len(value.Array) {
 			case 2: // Old style auth with just password
 				password := value.Array[1].Bulk
@@ -473,6 +750,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 					writer.Write(models.Value{Type: "string", Str: "OK"})
 				} else {
 					authenticated = false
+					s.metrics.IncrACLDenials(metrics.ACLDeniedAuth)
 					writer.Write(models.Value{Type: "error", Str: "ERR invalid password"})
 				}
 				continue
@@ -484,6 +762,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 					writer.Write(models.Value{Type: "string", Str: "OK"})
 				} else {
 					authenticated = false
+					s.metrics.IncrACLDenials(metrics.ACLDeniedAuth)
 					writer.Write(models.Value{Type: "error", Str: "ERR invalid username or password"})
 				}
 				continue
@@ -501,14 +780,14 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 		// Allow INFO without authentication
 		if cmd == "INFO" {
-			result := s.handleCommand(value)
+			result := s.handleCommand(client, value)
 			writer.Write(result)
 			continue
 		}
 
 		// Handle commands that don't require authentication
 		if !requiresAuth(cmd) {
-			result := s.handleCommand(value)
+			result := s.handleCommand(client, value)
 			writer.Write(result)
 			continue
 		}
@@ -521,22 +800,41 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 		// Check permissions for authenticated users
 		if !s.aclMiddleware.CheckCommand(username, value) {
+			s.metrics.IncrACLDenials(metrics.ACLDeniedCommand)
 			writer.Write(models.Value{Type: "error", Str: "NOPERM insufficient permissions"})
 			continue
 		}
 
 		// Handle REPLCONF command for replica identification
 		if cmd == "REPLCONF" {
+			isReplica = true
 			s.addReplica(conn)
 			writer.Write(models.Value{Type: "string", Str: "OK"})
 			continue
 		}
 
+		// Switch the connection into monitor mode; from here on the
+		// monitor goroutine owns all writes to it
+		if cmd == "MONITOR" {
+			s.monitors.add(conn)
+			continue
+		}
+
+		// Subscribing switches the connection into subscribed mode, in
+		// which the subscriber goroutine owns all writes to it
+		if isPubSubCommand(cmd) {
+			if s.monitors.active() {
+				s.feedMonitors(client, value)
+			}
+			s.handlePubSub(conn, writer, cmd, value.Array[1:])
+			continue
+		}
+
 		s.adminHandlers.SetCurrentConn(conn)
-		result := s.handleCommand(value)
+		result := s.handleCommand(client, value)
 
 		// Propagate write commands to replicas if we're the master
-		if s.IsMaster() && isWriteCommand(cmd) {
+		if s.IsMaster() && isWriteCommand(cmd, value.Array[1:]) {
 			s.propagateToReplicas(value)
 		}
 
@@ -548,6 +846,26 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 }
 
+// handleMonitorCommand answers a command sent by a connection in monitor
+// mode and reports whether the connection is to be closed.
+func (s *Server) handleMonitorCommand(conn net.Conn, writer *resp.Writer, cmd string) bool {
+	switch cmd {
+	case "QUIT":
+		// Leave monitor mode before replying, so that the reply is written
+		// like any other instead of queued behind lines the monitor
+		// goroutine may never send
+		s.monitors.remove(conn)
+		writer.Write(models.Value{Type: "string", Str: "OK"})
+		return true
+	case "RESET":
+		s.monitors.remove(conn)
+		writer.Write(models.Value{Type: "string", Str: "RESET"})
+	default:
+		s.monitors.reply(conn, models.Value{Type: "error", Str: "ERR only QUIT and RESET are allowed in MONITOR mode"})
+	}
+	return false
+}
+
 // Helper function to determine if a command requires authentication
 func requiresAuth(cmd string) bool {
 	noAuthCommands := map[string]bool{
@@ -591,15 +909,15 @@ func (s *Server) GetReplicationInfo() map[string]string {
 	return info
 }
 
-func (s *Server) handleCommand(value models.Value) models.Value {
+// handleCommand executes a single command. c is the issuing client, or nil
+// when the command arrives over the replication link.
+func (s *Server) handleCommand(c *client.Client, value models.Value) models.Value {
 	if len(value.Array) == 0 {
 		return models.Value{Type: "error", Str: "ERR empty command"}
 	}
 
 	cmd := strings.ToUpper(value.Array[0].Bulk)
 
-	log.Printf("Received command: %s", cmd)
-
 	// Handle regular commands
 	handler, exists := s.registry.GetHandler(cmd)
 	if !exists {
@@ -607,29 +925,106 @@ func (s *Server) handleCommand(value models.Value) models.Value {
 	}
 
 	// If we're a slave, only allow read commands
-	if !s.isMaster && isWriteCommand(cmd) && !isReplicationCommand(cmd) {
+	if !s.isMaster && isWriteCommand(cmd, value.Array[1:]) && !isReplicationCommand(cmd) {
 		return models.Value{Type: "error", Str: "READONLY You can't write against a read only replica"}
 	}
 
+	// Monitors only see the commands that run
+	if s.monitors.active() {
+		s.feedMonitors(c, value)
+	}
+
+	db := 0
+	if c != nil {
+		db = c.DB
+	}
+	notify := s.prepareKeyspaceEvents(db, cmd, value.Array[1:])
+
 	// Execute command
+	blocking := isBlockingCommand(cmd, value.Array[1:])
+	if blocking {
+		s.metrics.IncrBlockedClients()
+	}
+	start := time.Now()
 	result := handler(value.Array[1:])
+	duration := time.Since(start)
+	if blocking {
+		s.metrics.DecrBlockedClients()
+	}
+	s.recordCommand(c, cmd, value, result, duration)
+	if notify != nil {
+		notify(result)
+	}
 
-	// If master and write command, persist to AOF and propagate
-	if s.isMaster && isWriteCommand(cmd) {
-		// Write to AOF
-		go func() {
-			if err := s.storage.Write(value); err != nil {
-				log.Printf("Failed to write to AOF: %v", err)
-			}
-		}()
-
-		// Propagate to replicas
-		s.propagateToReplicas(value)
+	if isWriteCommand(cmd, value.Array[1:]) {
+		s.LogWrite(value)
 	}
 
 	return result
 }
 
+// LogWrite persists a write command to the AOF and propagates it to the
+// replicas when this server is the master. Writes that reach the cache
+// without going through a connection, such as Prometheus remote writes,
+// log the command that repeats them.
+func (s *Server) LogWrite(value models.Value) {
+	if !s.isMaster {
+		return
+	}
+
+	// Write to AOF
+	go func() {
+		if err := s.storage.Write(value); err != nil {
+			log.Printf("Failed to write to AOF: %v", err)
+		}
+	}()
+
+	// Propagate to replicas
+	s.propagateToReplicas(value)
+}
+
+// recordCommand feeds the execution time of a command into the command
+// statistics, the slow log and the latency monitor.
+func (s *Server) recordCommand(c *client.Client, cmd string, value, result models.Value, duration time.Duration) {
+	s.metrics.IncrCommandCount()
+	s.cache.IncrCommandCount()
+	if result.Type == "error" {
+		s.metrics.AddFailedCommandExecution(strings.ToLower(cmd), duration)
+	} else {
+		s.metrics.AddCommandExecution(strings.ToLower(cmd), duration)
+	}
+	s.latency.Observe(metrics.LatencyEventCommand, duration)
+
+	if threshold := s.slowlog.SlowerThan(); threshold < 0 || duration.Microseconds() < threshold {
+		return
+	}
+	// Credentials never reach SLOWLOG GET, as for MONITOR
+	args := redactArgs(value.Array)
+	if c == nil {
+		host, port := s.GetMasterInfo()
+		s.slowlog.Record(args, duration, net.JoinHostPort(host, port), "")
+		return
+	}
+	s.slowlog.Record(args, duration, c.Addr, c.Name)
+}
+
+// LatencyMonitor returns the monitor used for LATENCY so that storage and
+// cache background jobs can report their spikes to it.
+func (s *Server) LatencyMonitor() *metrics.LatencyMonitor {
+	return s.latency
+}
+
+// feedMonitors streams a command to MONITOR connections, attributing
+// replicated commands to the master link.
+func (s *Server) feedMonitors(c *client.Client, value models.Value) {
+	if c == nil {
+		host, port := s.GetMasterInfo()
+		s.monitors.feed(net.JoinHostPort(host, port), 0, value.Array)
+		return
+	}
+	s.monitors.feed(c.Addr, c.DB, value.Array)
+}
+
 func parseInfoString(info string) map[string]string {
 	result := make(map[string]string)
 	scanner := bufio.NewScanner(strings.NewReader(info))
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genc-murat/crystalcache/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWriteCommand(t *testing.T) {
+	for _, cmd := range []string{
+		"TDIGEST.CREATE", "TDIGEST.ADD", "TDIGEST.MERGE", "TDIGEST.RESET",
+		"TOPK.RESERVE", "TOPK.ADD", "TOPK.INCRBY", "CMS.INITBYDIM", "CMS.INITBYPROB", "CMS.INCRBY", "CMS.MERGE",
+		"BF.RESERVE", "BF.ADD", "BF.MADD", "BF.INSERT", "BF.LOADCHUNK",
+		"CF.RESERVE", "CF.ADD", "CF.ADDNX", "CF.INSERT", "CF.INSERTNX", "CF.DEL", "CF.LOADCHUNK",
+		"PFADD", "PFMERGE",
+		"TS.CREATE", "TS.ADD", "TS.MADD", "TS.INCRBY", "TS.DECRBY", "TS.DEL", "TS.ALTER",
+		"TS.CREATERULE", "TS.DELETERULE",
+		"GEOADD", "GEOSEARCHSTORE",
+	} {
+		assert.True(t, isWriteCommand(cmd, nil), cmd)
+	}
+
+	for _, cmd := range []string{
+		"GET", "TDIGEST.QUANTILE", "TDIGEST.RANK", "TOPK.LIST", "TOPK.QUERY", "CMS.QUERY", "BF.EXISTS", "BF.SCANDUMP", "CF.EXISTS", "CF.COUNT", "PFCOUNT", "TS.GET", "TS.RANGE", "TS.INFO",
+		"GEOSEARCH", "GEORADIUS_RO", "GEORADIUSBYMEMBER_RO",
+	} {
+		assert.False(t, isWriteCommand(cmd, nil), cmd)
+	}
+
+	// Some commands only write with some arguments
+	tests := []struct {
+		command string
+		write   bool
+	}{
+		{"GEORADIUS Sicily 15 37 200 km STORE dst", true},
+		{"GEORADIUS Sicily 15 37 200 km WITHDIST storedist dst", true},
+		{"GEORADIUS Sicily 15 37 200 km WITHDIST ASC", false},
+		{"GEORADIUSBYMEMBER Sicily Palermo 200 km STORE dst", true},
+		{"GEORADIUSBYMEMBER Sicily Palermo 200 km COUNT 3", false},
+		// A member named like the option is not the option
+		{"GEORADIUSBYMEMBER Sicily STORE 200 km", false},
+		{"GEOFENCE ADD Sicily home CIRCLE 15 37 10 km", true},
+		{"GEOFENCE DEL Sicily home", true},
+		{"GEOFENCE LIST Sicily", false},
+	}
+	for _, tt := range tests {
+		fields := strings.Fields(tt.command)
+		assert.Equal(t, tt.write, isWriteCommand(fields[0], bulkArgs(fields[1:]...)), tt.command)
+	}
+}
+
+func TestMaxClientsBurst(t *testing.T) {
+	const maxClients, burst = 3, 10
+
+	s := NewServer(cache.NewMemoryCache(), nil, nil, ServerConfig{MaxConnections: maxClients})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	defer close(s.shutdown)
+
+	// The whole burst is waiting to be accepted before the server runs
+	conns := make([]net.Conn, burst)
+	for i := range conns {
+		conns[i], err = net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		defer conns[i].Close()
+	}
+	go s.serve(listener)
+
+	var admitted []net.Conn
+	for _, conn := range conns {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			// Admitted connections wait for a command
+			admitted = append(admitted, conn)
+			continue
+		}
+		assert.Equal(t, "-ERR max number of clients reached\r\n", line)
+	}
+	require.Len(t, admitted, maxClients)
+
+	// A closed connection frees its slot
+	admitted[0].Close()
+	assert.Eventually(t, func() bool {
+		return s.clients.Load() == maxClients-1
+	}, time.Second, 10*time.Millisecond)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "+PONG\r\n", line)
+}
@@ -7,11 +7,13 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"log"
 
 	"github.com/genc-murat/crystalcache/internal/core/models"
+	"github.com/genc-murat/crystalcache/internal/metrics"
 	"github.com/genc-murat/crystalcache/pkg/resp"
 	"github.com/gofrs/flock"
 )
@@ -51,6 +53,10 @@ type AOF struct {
 	syncCh     chan struct{}
 	done       chan struct{}
 	writeQueue chan models.Value
+
+	latency      *metrics.LatencyMonitor
+	fsyncLatency *metrics.Histogram
+	pending      int64 // commands queued or batched but not yet written
 }
 
 // NewAOF creates a new AOF instance
@@ -91,23 +97,56 @@ func NewAOF(config AOFConfig) (*AOF, error) {
 		logger:   logger,
 		syncCh:   make(chan struct{}, 100),
 		done:     make(chan struct{}),
-	}
 
-	// Start background sync if needed
-	if config.SyncStrategy == "everysec" {
-		go aof.backgroundSync()
+		fsyncLatency: metrics.NewHistogram(metrics.DefaultLatencyBuckets),
 	}
 
+	// The background sync only fsyncs under the everysec strategy, but it
+	// always runs so the strategy can be switched at runtime
+	go aof.backgroundSync()
+
 	aof.writeQueue = make(chan models.Value, 1000)
 	go aof.processWriteQueue()
 	return aof, nil
 }
 
+// SetLatencyMonitor makes fsync calls report their duration to monitor.
+func (aof *AOF) SetLatencyMonitor(monitor *metrics.LatencyMonitor) {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	aof.latency = monitor
+}
+
+// SetSyncStrategy switches the fsync policy between "always", "everysec"
+// and "no".
+func (aof *AOF) SetSyncStrategy(strategy string) error {
+	switch strategy {
+	case "always", "everysec", "no":
+	default:
+		return fmt.Errorf("invalid sync strategy: %s", strategy)
+	}
+
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	aof.config.SyncStrategy = strategy
+	return nil
+}
+
 func (aof *AOF) Write(value models.Value) error {
+	atomic.AddInt64(&aof.pending, 1)
 	aof.writeQueue <- value
 	return nil
 }
 
+// Collect implements metrics.Collector for fsync latency and the write
+// backlog.
+func (aof *AOF) Collect(w *metrics.OpenMetricsWriter) {
+	w.Histogram("crystalcache_aof_fsync_duration_seconds", "Latency of AOF fsync calls.",
+		metrics.HistogramSample{Snapshot: aof.fsyncLatency.Snapshot()})
+	w.Gauge("crystalcache_aof_backlog_commands", "Commands accepted but not yet written to the AOF.",
+		metrics.Sample{Value: float64(atomic.LoadInt64(&aof.pending))})
+}
+
 func (aof *AOF) processWriteQueue() {
 	ticker := time.NewTicker(100 * time.Millisecond)
 	defer ticker.Stop()
@@ -135,6 +174,8 @@ func (aof *AOF) writeBatch(batch []models.Value) {
 	aof.mu.Lock()
 	defer aof.mu.Unlock()
 
+	defer atomic.AddInt64(&aof.pending, -int64(len(batch)))
+
 	writer := resp.NewWriter(aof.writer)
 	for _, value := range batch {
 		if err := writer.Write(value); err != nil {
@@ -201,10 +242,14 @@ func (aof *AOF) sync() error {
 		aof.logger.Printf("Flush failed: %v", err)
 		return err
 	}
+	start := time.Now()
 	if err := aof.file.Sync(); err != nil {
 		aof.logger.Printf("File sync failed: %v", err)
 		return err
 	}
+	elapsed := time.Since(start)
+	aof.fsyncLatency.Observe(elapsed)
+	aof.latency.Observe(metrics.LatencyEventAOFFsync, elapsed)
 	return nil
 }
 
@@ -216,7 +261,9 @@ func (aof *AOF) backgroundSync() {
 		select {
 		case <-ticker.C:
 			aof.mu.Lock()
-			_ = aof.sync()
+			if aof.config.SyncStrategy == "everysec" {
+				_ = aof.sync()
+			}
 			aof.mu.Unlock()
 		case <-aof.syncCh:
 			aof.mu.Lock()
@@ -0,0 +1,172 @@
+// Package geohash implements the 52 bit geohash geo sets are scored with,
+// and the cell ranges covering a search area.
+// Reference: https://github.com/redis/redis/blob/unstable/src/geohash.c
+package geohash
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// StepMax is the precision of a score: 26 bits of longitude and 26 of
+	// latitude, interleaved
+	StepMax = 26
+
+	LonMin = -180.0
+	LonMax = 180.0
+	// The latitudes of the Web Mercator projection
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// EarthRadius is the radius the distances are computed with, in meters
+	EarthRadius = 6372797.560856
+	// mercatorMax is the half circumference of the projection, in meters
+	mercatorMax = 20037726.37
+)
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Bits is a geohash of step bits of longitude and step bits of latitude.
+// Latitude bits are the even ones, longitude bits the odd ones.
+type Bits struct {
+	Bits uint64
+	Step uint
+}
+
+// Area is the cell of a geohash
+type Area struct {
+	Hash                           Bits
+	LonMin, LonMax, LatMin, LatMax float64
+}
+
+// Valid reports whether a point can be stored in a geo set
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// Encode returns the score of a point
+func Encode(lon, lat float64) (uint64, error) {
+	if !Valid(lon, lat) {
+		return 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return encode(lon, lat, LonMin, LonMax, LatMin, LatMax, StepMax).Bits, nil
+}
+
+func encode(lon, lat, lonMin, lonMax, latMin, latMax float64, step uint) Bits {
+	latOffset := (lat - latMin) / (latMax - latMin) * float64(uint64(1)<<step)
+	lonOffset := (lon - lonMin) / (lonMax - lonMin) * float64(uint64(1)<<step)
+	return Bits{Bits: interleave(uint32(latOffset), uint32(lonOffset)), Step: step}
+}
+
+// Decode returns the center of the cell of a score
+func Decode(score uint64) (lon, lat float64) {
+	area := decode(Bits{Bits: score, Step: StepMax}, LonMin, LonMax, LatMin, LatMax)
+	lon = math.Max(LonMin, math.Min(LonMax, (area.LonMin+area.LonMax)/2))
+	lat = math.Max(LatMin, math.Min(LatMax, (area.LatMin+area.LatMax)/2))
+	return lon, lat
+}
+
+func decode(hash Bits, lonMin, lonMax, latMin, latMax float64) Area {
+	latBits, lonBits := deinterleave(hash.Bits)
+	cells := float64(uint64(1) << hash.Step)
+	return Area{
+		Hash:   hash,
+		LatMin: latMin + float64(latBits)/cells*(latMax-latMin),
+		LatMax: latMin + float64(latBits+1)/cells*(latMax-latMin),
+		LonMin: lonMin + float64(lonBits)/cells*(lonMax-lonMin),
+		LonMax: lonMin + float64(lonBits+1)/cells*(lonMax-lonMin),
+	}
+}
+
+// String returns the standard 11 character geohash of a score, which
+// spans latitudes -90 to 90 rather than those of the projection
+func String(score uint64) string {
+	lon, lat := Decode(score)
+	hash := encode(lon, lat, -180, 180, -90, 90, StepMax).Bits
+
+	buf := make([]byte, 11)
+	for i := 0; i < 10; i++ {
+		buf[i] = base32[hash>>(52-(i+1)*5)&0x1f]
+	}
+	// 52 bits only fill 10 characters and 2 bits of the last
+	buf[10] = base32[0]
+	return string(buf)
+}
+
+// interleave spreads the bits of x over the even bits of the result and
+// the bits of y over the odd ones
+func interleave(x, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000ffff0000ffff
+	x = (x | x<<8) & 0x00ff00ff00ff00ff
+	x = (x | x<<4) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+func deinterleave(v uint64) (x, y uint32) {
+	return squash(v), squash(v >> 1)
+}
+
+func squash(v uint64) uint32 {
+	x := v & 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0f0f0f0f0f0f0f0f
+	x = (x | x>>4) & 0x00ff00ff00ff00ff
+	x = (x | x>>8) & 0x0000ffff0000ffff
+	x = (x | x>>16) & 0x00000000ffffffff
+	return uint32(x)
+}
+
+// moveX returns the cell d cells east (d > 0) or west of hash
+func moveX(hash Bits, d int) Bits {
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	if d > 0 {
+		x += zz + 1
+	} else {
+		x |= zz
+		x -= zz + 1
+	}
+	x &= 0xaaaaaaaaaaaaaaaa >> (64 - hash.Step*2)
+	return Bits{Bits: x | y, Step: hash.Step}
+}
+
+// moveY returns the cell d cells north (d > 0) or south of hash
+func moveY(hash Bits, d int) Bits {
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	if d > 0 {
+		y += zz + 1
+	} else {
+		y |= zz
+		y -= zz + 1
+	}
+	y &= 0x5555555555555555 >> (64 - hash.Step*2)
+	return Bits{Bits: x | y, Step: hash.Step}
+}
+
+// Distance returns the great circle distance between two points in meters
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := degRad(lat1), degRad(lon1)
+	lat2r, lon2r := degRad(lat2), degRad(lon2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,225 @@
+package geohash_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/genc-murat/crystalcache/pkg/utils/geohash"
+)
+
+// The points of the GEOADD examples of the Redis documentation
+var (
+	palermo = [2]float64{13.361389, 38.115556}
+	catania = [2]float64{15.087269, 37.502669}
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		lon, lat float64
+		score    uint64
+		hash     string
+	}{
+		{"Palermo", palermo[0], palermo[1], 3479099956230698, "sqc8b49rny0"},
+		{"Catania", catania[0], catania[1], 3479447370796909, "sqdtr74hyu0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, err := geohash.Encode(tt.lon, tt.lat)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if score != tt.score {
+				t.Errorf("Encode() = %d; want %d", score, tt.score)
+			}
+			if got := geohash.String(score); got != tt.hash {
+				t.Errorf("String() = %q; want %q", got, tt.hash)
+			}
+			lon, lat := geohash.Decode(score)
+			if math.Abs(lon-tt.lon) > 1e-5 || math.Abs(lat-tt.lat) > 1e-5 {
+				t.Errorf("Decode() = %f,%f; want %f,%f", lon, lat, tt.lon, tt.lat)
+			}
+		})
+	}
+
+	if _, err := geohash.Encode(10, 86); err == nil {
+		t.Errorf("Encode() of a latitude past the projection succeeded")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// GEODIST measures between the points the scores decode to
+	p, _ := geohash.Encode(palermo[0], palermo[1])
+	c, _ := geohash.Encode(catania[0], catania[1])
+	plon, plat := geohash.Decode(p)
+	clon, clat := geohash.Decode(c)
+	dist := geohash.Distance(plon, plat, clon, clat)
+	if got := fmt.Sprintf("%.4f", dist); got != "166274.1516" {
+		t.Errorf("Distance() = %s; want 166274.1516", got)
+	}
+}
+
+func TestShapeContains(t *testing.T) {
+	circle := geohash.Shape{Lon: 15, Lat: 37, Radius: 200000}
+	dist, ok := circle.Contains(palermo[0], palermo[1])
+	if !ok || fmt.Sprintf("%.4f", dist/1000) != "190.4424" {
+		t.Errorf("Contains(Palermo) = %f, %v; want 190442.4, true", dist, ok)
+	}
+	circle.Radius = 100000
+	if _, ok := circle.Contains(palermo[0], palermo[1]); ok {
+		t.Errorf("Contains(Palermo) within 100 km")
+	}
+
+	box := geohash.Shape{Lon: 15, Lat: 37, Box: true, Width: 400000, Height: 400000}
+	if _, ok := box.Contains(palermo[0], palermo[1]); !ok {
+		t.Errorf("Contains(Palermo) = false in a 400 km box")
+	}
+	box.Width = 250000
+	if _, ok := box.Contains(palermo[0], palermo[1]); ok {
+		t.Errorf("Contains(Palermo) = true in a 250 km wide box")
+	}
+}
+
+// Every point of a shape is in the cells of its ranges
+func TestShapeRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		shape := geohash.Shape{
+			Lon:    r.Float64()*360 - 180,
+			Lat:    r.Float64()*160 - 80,
+			Radius: math.Pow(10, 1+r.Float64()*5),
+		}
+		if i%2 == 1 {
+			shape.Box, shape.Width, shape.Height = true, shape.Radius*2, shape.Radius
+		}
+		ranges := shape.Ranges()
+		if len(ranges) > 9 {
+			t.Fatalf("Ranges() = %d ranges", len(ranges))
+		}
+
+		for j := 0; j < 100; j++ {
+			lon := shape.Lon + (r.Float64()*2-1)*shape.Radius/50000
+			lat := shape.Lat + (r.Float64()*2-1)*shape.Radius/100000
+			if !geohash.Valid(lon, lat) {
+				continue
+			}
+			score, _ := geohash.Encode(lon, lat)
+			dlon, dlat := geohash.Decode(score)
+			if _, ok := shape.Contains(dlon, dlat); !ok {
+				continue
+			}
+			covered := false
+			for _, rg := range ranges {
+				covered = covered || (score >= rg.Min && score < rg.Max)
+			}
+			if !covered {
+				t.Fatalf("%+v: point %f,%f is in no range", shape, lon, lat)
+			}
+		}
+	}
+}
+
+func TestPolygon(t *testing.T) {
+	// A concave polygon, an L with its notch to the north east
+	l, err := geohash.NewPolygon([][2]float64{{0, 0}, {2, 0}, {2, 1}, {1, 1}, {1, 2}, {0, 2}, {0, 0}})
+	if err != nil {
+		t.Fatalf("NewPolygon() error = %v", err)
+	}
+	// Around Fiji, across the antimeridian
+	fiji, err := geohash.NewPolygon([][2]float64{{178, -20}, {-178, -20}, {-178, -16}, {178, -16}})
+	if err != nil {
+		t.Fatalf("NewPolygon() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		polygon  *geohash.Polygon
+		lon, lat float64
+		want     bool
+	}{
+		{"L corner", l, 0.5, 0.5, true},
+		{"L east arm", l, 1.5, 0.5, true},
+		{"L north arm", l, 0.5, 1.5, true},
+		{"L notch", l, 1.5, 1.5, false},
+		{"L outside", l, 3, 0.5, false},
+		{"Fiji west of the antimeridian", fiji, 179.5, -18, true},
+		{"Fiji east of the antimeridian", fiji, -179.5, -18, true},
+		{"Fiji antimeridian", fiji, 180, -18, true},
+		{"Fiji west", fiji, 177, -18, false},
+		{"Fiji east", fiji, -177, -18, false},
+		{"Fiji opposite", fiji, 0, -18, false},
+		{"Fiji south", fiji, 179, -21, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.polygon.Contains(tt.lon, tt.lat); got != tt.want {
+				t.Errorf("Contains(%f, %f) = %v; want %v", tt.lon, tt.lat, got, tt.want)
+			}
+		})
+	}
+
+	if lon, lat := fiji.Center(); math.Abs(math.Abs(lon)-180) > 1e-9 || lat != -18 {
+		t.Errorf("Center() = %f,%f; want 180,-18", lon, lat)
+	}
+
+	invalid := [][][2]float64{
+		{{0, 0}, {1, 1}},
+		{{0, 0}, {1, 1}, {0, 0}},
+		{{0, 0}, {1, 1}, {0, 89}},
+		// Around the north pole
+		{{0, 80}, {120, 80}, {-120, 80}},
+	}
+	for _, vertices := range invalid {
+		if _, err := geohash.NewPolygon(vertices); err == nil {
+			t.Errorf("NewPolygon(%v) succeeded", vertices)
+		}
+	}
+}
+
+// Every point of a polygon across the antimeridian is in the cells of its
+// ranges
+func TestPolygonRanges(t *testing.T) {
+	for _, vertices := range [][][2]float64{
+		{{179.9, -18}, {-179.8, -18.3}, {-179.95, -17.8}},
+		// Centered on the antimeridian
+		{{179.8, -18.3}, {-179.8, -18.3}, {-179.8, -17.8}, {179.8, -17.8}},
+	} {
+		polygon, _ := geohash.NewPolygon(vertices)
+		testPolygonRanges(t, polygon)
+	}
+}
+
+func testPolygonRanges(t *testing.T, polygon *geohash.Polygon) {
+	shape := geohash.Shape{Polygon: polygon}
+	shape.Lon, shape.Lat = polygon.Center()
+	ranges := shape.Ranges()
+
+	r := rand.New(rand.NewSource(1))
+	inside := 0
+	for i := 0; i < 1000; i++ {
+		lon := 179.8 + r.Float64()*0.5
+		if lon > 180 {
+			lon -= 360
+		}
+		lat := -18.3 + r.Float64()*0.5
+		score, _ := geohash.Encode(lon, lat)
+		dlon, dlat := geohash.Decode(score)
+		if _, ok := shape.Contains(dlon, dlat); !ok {
+			continue
+		}
+		inside++
+		covered := false
+		for _, rg := range ranges {
+			covered = covered || (score >= rg.Min && score < rg.Max)
+		}
+		if !covered {
+			t.Fatalf("point %f,%f is in no range", lon, lat)
+		}
+	}
+	if inside == 0 {
+		t.Fatalf("no point is in the polygon")
+	}
+}
@@ -0,0 +1,139 @@
+package geohash
+
+import (
+	"fmt"
+	"math"
+)
+
+// Polygon is a polygon of longitude, latitude vertices. Its edges are
+// straight lines in longitude and latitude, each going the shorter way
+// around, so a polygon may cross the antimeridian. It cannot go around a
+// pole.
+type Polygon struct {
+	// vertices holds the longitudes unwrapped: each one within 180
+	// degrees of the previous one, possibly beyond -180 or 180
+	vertices                       [][2]float64
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// NewPolygon returns the polygon of the given vertices. The last vertex
+// may repeat the first one.
+func NewPolygon(vertices [][2]float64) (*Polygon, error) {
+	if n := len(vertices); n > 1 && vertices[0] == vertices[n-1] {
+		vertices = vertices[:n-1]
+	}
+	if len(vertices) < 3 {
+		return nil, fmt.Errorf("ERR a polygon needs at least 3 vertices")
+	}
+
+	p := &Polygon{
+		vertices: make([][2]float64, len(vertices)),
+		minLon:   math.Inf(1), minLat: math.Inf(1),
+		maxLon: math.Inf(-1), maxLat: math.Inf(-1),
+	}
+	for i, v := range vertices {
+		if !Valid(v[0], v[1]) {
+			return nil, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", v[0], v[1])
+		}
+		if i > 0 {
+			v[0] = unwrap(v[0], p.vertices[i-1][0])
+		}
+		p.vertices[i] = v
+		p.minLon, p.maxLon = math.Min(p.minLon, v[0]), math.Max(p.maxLon, v[0])
+		p.minLat, p.maxLat = math.Min(p.minLat, v[1]), math.Max(p.maxLat, v[1])
+	}
+
+	// The closing edge goes the shorter way around too, which it does not
+	// if the polygon goes around a pole
+	first, last := p.vertices[0][0], p.vertices[len(p.vertices)-1][0]
+	if math.Abs(last-first) > 180 || p.maxLon-p.minLon >= 360 {
+		return nil, fmt.Errorf("ERR a polygon cannot go around a pole")
+	}
+	return p, nil
+}
+
+// unwrap returns the longitude equal to lon, modulo 360 degrees, within
+// 180 degrees of ref
+func unwrap(lon, ref float64) float64 {
+	for lon-ref > 180 {
+		lon -= 360
+	}
+	for lon-ref < -180 {
+		lon += 360
+	}
+	return lon
+}
+
+// wrap returns lon within -180 to 180 degrees, 180 excluded
+func wrap(lon float64) float64 {
+	if lon = unwrap(lon, 0); lon == 180 {
+		return -180
+	}
+	return lon
+}
+
+// Center returns the center of the bounding box of the polygon
+func (p *Polygon) Center() (lon, lat float64) {
+	return wrap((p.minLon + p.maxLon) / 2), (p.minLat + p.maxLat) / 2
+}
+
+// Vertices returns the vertices of the polygon, with longitudes within -180
+// to 180 degrees
+func (p *Polygon) Vertices() [][2]float64 {
+	vertices := make([][2]float64, len(p.vertices))
+	for i, v := range p.vertices {
+		vertices[i] = [2]float64{wrap(v[0]), v[1]}
+	}
+	return vertices
+}
+
+// Contains reports whether a point is inside the polygon
+func (p *Polygon) Contains(lon, lat float64) bool {
+	if lat < p.minLat || lat > p.maxLat {
+		return false
+	}
+	// The point may be on the polygon one turn around from where its
+	// longitude is
+	for _, l := range [...]float64{lon, lon - 360, lon + 360} {
+		if l >= p.minLon && l <= p.maxLon && p.contains(l, lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains casts a ray from the point to the east and counts the edges it
+// crosses
+func (p *Polygon) contains(lon, lat float64) bool {
+	inside := false
+	j := len(p.vertices) - 1
+	for i, vi := range p.vertices {
+		vj := p.vertices[j]
+		if (vi[1] > lat) != (vj[1] > lat) {
+			crossLon := vi[0] + (lat-vi[1])/(vj[1]-vi[1])*(vj[0]-vi[0])
+			if lon < crossLon {
+				inside = !inside
+			}
+		}
+		j = i
+	}
+	return inside
+}
+
+// boundingBox returns the bounding box of the polygon, with longitudes
+// around the center
+func (p *Polygon) boundingBox() (minLon, minLat, maxLon, maxLat float64) {
+	lon, _ := p.Center()
+	shift := lon - (p.minLon+p.maxLon)/2
+	return p.minLon + shift, p.minLat, p.maxLon + shift, p.maxLat
+}
+
+// radius returns the distance from the center to the farthest vertex
+func (p *Polygon) radius() float64 {
+	lon, lat := p.Center()
+	radius := 0.0
+	for _, v := range p.vertices {
+		radius = math.Max(radius, Distance(lon, lat, v[0], v[1]))
+	}
+	return radius
+}
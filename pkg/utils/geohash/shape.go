@@ -0,0 +1,218 @@
+package geohash
+
+import "math"
+
+// Shape is the area of a search: a circle of Radius meters around the
+// center, a box of Width by Height meters centered on it, or a Polygon.
+// Distances are measured from the center, which need not be in a polygon.
+type Shape struct {
+	Lon, Lat      float64
+	Radius        float64
+	Box           bool
+	Width, Height float64
+	Polygon       *Polygon
+}
+
+// Range is a range of scores [Min, Max) holding the points of a cell
+type Range struct {
+	Min, Max uint64
+}
+
+// Contains reports whether a point is in the shape, and its distance to
+// the center in meters
+func (s Shape) Contains(lon, lat float64) (float64, bool) {
+	if s.Polygon != nil {
+		if !s.Polygon.Contains(lon, lat) {
+			return 0, false
+		}
+		return Distance(s.Lon, s.Lat, lon, lat), true
+	}
+	if !s.Box {
+		dist := Distance(s.Lon, s.Lat, lon, lat)
+		return dist, dist <= s.Radius
+	}
+	// The latitude distance is the cheaper one, so it goes first
+	if EarthRadius*math.Abs(degRad(lat)-degRad(s.Lat)) > s.Height/2 {
+		return 0, false
+	}
+	if Distance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return Distance(s.Lon, s.Lat, lon, lat), true
+}
+
+// BoundingBox returns the longitudes and latitudes bounding the shape.
+// Longitudes are around those of its center, past -180 or 180 if the
+// shape crosses the antimeridian.
+func (s Shape) BoundingBox() (minLon, minLat, maxLon, maxLat float64) {
+	if s.Polygon != nil {
+		return s.Polygon.boundingBox()
+	}
+	height, width := s.Radius, s.Radius
+	if s.Box {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radDeg(height / EarthRadius)
+	lonDeltaTop := radDeg(width / EarthRadius / math.Cos(degRad(s.Lat+latDelta)))
+	lonDeltaBottom := radDeg(width / EarthRadius / math.Cos(degRad(s.Lat-latDelta)))
+
+	// The box is widest on the side nearer the equator
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return s.Lon - lonDelta, s.Lat - latDelta, s.Lon + lonDelta, s.Lat + latDelta
+}
+
+// radius returns the radius of the circle the shape fits in
+func (s Shape) radius() float64 {
+	if s.Polygon != nil {
+		return s.Polygon.radius()
+	}
+	if s.Box {
+		return math.Sqrt(s.Width*s.Width+s.Height*s.Height) / 2
+	}
+	return s.Radius
+}
+
+// center returns the point the cells are centered on
+func (s Shape) center() (lon, lat float64) {
+	if s.Polygon != nil {
+		return s.Polygon.Center()
+	}
+	return s.Lon, s.Lat
+}
+
+// Ranges returns the score ranges of the cells covering the shape: the
+// cell of the center and its neighbors, with cells as small as they can
+// be for the nine of them to cover the bounding box.
+func (s Shape) Ranges() []Range {
+	lon, lat := s.center()
+	minLon, minLat, maxLon, maxLat := s.BoundingBox()
+	step := estimateStep(s.radius(), lat)
+
+	area, neighbors := cells(lon, lat, step)
+	// Near the edges of the center cell a neighbor can fall short of the
+	// bounding box, which the cells of a previous step cover
+	for step > 1 && !covers(area, neighbors, minLon, minLat, maxLon, maxLat) {
+		step--
+		area, neighbors = cells(lon, lat, step)
+	}
+
+	// Skip the neighbors on the far side of a bounding box edge the center
+	// cell already crosses
+	skip := make(map[int]bool)
+	if step >= 2 {
+		if area.LatMin < minLat {
+			skip[1], skip[6], skip[7] = true, true, true
+		}
+		if area.LatMax > maxLat {
+			skip[0], skip[4], skip[5] = true, true, true
+		}
+		if area.LonMin < minLon {
+			skip[3], skip[5], skip[7] = true, true, true
+		}
+		if area.LonMax > maxLon {
+			skip[2], skip[4], skip[6] = true, true, true
+		}
+	}
+
+	ranges := []Range{cellRange(area.Hash)}
+	seen := map[uint64]bool{area.Hash.Bits: true}
+	for i, cell := range neighbors {
+		if skip[i] || seen[cell.Bits] {
+			continue
+		}
+		seen[cell.Bits] = true
+		ranges = append(ranges, cellRange(cell))
+	}
+	return ranges
+}
+
+// cells returns the cell of a point at step, and its neighbors: north,
+// south, east, west, north east, north west, south east and south west
+func cells(lon, lat float64, step uint) (Area, [8]Bits) {
+	// Longitude 180 is -180, the western edge of the first column
+	if lon >= LonMax {
+		lon = LonMin
+	}
+	hash := encode(lon, lat, LonMin, LonMax, LatMin, LatMax, step)
+	north, south := moveY(hash, 1), moveY(hash, -1)
+	return decodeCell(hash), [8]Bits{
+		north,
+		south,
+		moveX(hash, 1),
+		moveX(hash, -1),
+		moveX(north, 1),
+		moveX(north, -1),
+		moveX(south, 1),
+		moveX(south, -1),
+	}
+}
+
+// covers reports whether a cell and its neighbors cover a bounding box
+func covers(area Area, neighbors [8]Bits, minLon, minLat, maxLon, maxLat float64) bool {
+	north := decodeCell(neighbors[0])
+	south := decodeCell(neighbors[1])
+	east := decodeCell(neighbors[2])
+	west := decodeCell(neighbors[3])
+
+	// There is nothing past the north and south edges of the projection,
+	// where the neighbors wrap around to the other edge
+	northMax, southMin := north.LatMax, south.LatMin
+	if top := uint32(1)<<area.Hash.Step - 1; row(north) == top || row(area) == top {
+		northMax = math.Inf(1)
+	}
+	if row(south) == 0 || row(area) == 0 {
+		southMin = math.Inf(-1)
+	}
+	// The east and west neighbors wrap around the antimeridian
+	eastMax, westMin := east.LonMax, west.LonMin
+	if eastMax <= area.LonMin {
+		eastMax += 360
+	}
+	if westMin >= area.LonMax {
+		westMin -= 360
+	}
+	return northMax >= maxLat && southMin <= minLat && eastMax >= maxLon && westMin <= minLon
+}
+
+// row returns the latitude index of a cell
+func row(area Area) uint32 {
+	lat, _ := deinterleave(area.Hash.Bits)
+	return lat
+}
+
+func decodeCell(hash Bits) Area {
+	return decode(hash, LonMin, LonMax, LatMin, LatMax)
+}
+
+// cellRange returns the scores of the points in a cell
+func cellRange(hash Bits) Range {
+	shift := 2 * (StepMax - hash.Step)
+	return Range{Min: hash.Bits << shift, Max: (hash.Bits + 1) << shift}
+}
+
+// estimateStep returns the step of the smallest cells a search of radius
+// meters around a point at latitude fits in with their neighbors
+func estimateStep(radius, lat float64) uint {
+	if radius == 0 {
+		return StepMax
+	}
+	step := 1
+	for radius < mercatorMax {
+		radius *= 2
+		step++
+	}
+	// Leave room for the search to be off the center of its cell
+	step -= 2
+
+	// Cells are narrower near the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(max(1, min(step, StepMax)))
+}
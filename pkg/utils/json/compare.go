@@ -2,6 +2,7 @@ package json
 
 import (
 	"fmt"
+	"sort"
 )
 
 // CompareResult represents the result of a comparison operation
@@ -234,6 +235,9 @@ func (c *Compare) compareObjectsNumerically(a map[string]interface{}, b interfac
 		bKeys = append(bKeys, k)
 	}
 
+	sort.Strings(aKeys)
+	sort.Strings(bKeys)
+
 	// Compare keys first
 	for i := range aKeys {
 		if aKeys[i] < bKeys[i] {
@@ -0,0 +1,1057 @@
+package json
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Document is a JSON value encoded on a flat tape. Compared to the tree
+// encoding/json decodes into, a document is a single allocation, keeps
+// object keys interned, can be navigated without decoding and serializes
+// mostly by copying bytes.
+//
+// The tape is little endian and holds one value:
+//
+//	null, false, true   tag
+//	number              tag, float64 bits (8 bytes)
+//	string              tag, uvarint length, UTF-8 bytes
+//	array               tag, uint32 count, uint32 body length, elements
+//	object              tag, uint32 count, uint32 body length, members
+//
+// Strings that JSON output can copy verbatim are tagged plain so that
+// AppendJSON never has to scan them. Object members are sorted by key,
+// which is the order encoding/json writes maps in, and start with a
+// uvarint key reference: odd references are an interned key id (ref>>1),
+// even ones the length (ref>>1) of the key bytes that follow inline.
+//
+// Documents are immutable; Replace returns a modified copy, so a document
+// can be shared between readers without locking.
+type Document struct {
+	tape []byte
+}
+
+const (
+	tagNull byte = iota
+	tagFalse
+	tagTrue
+	tagNumber
+	tagString
+	tagPlain
+	tagArray
+	tagObject
+)
+
+// containerHeader is the size of the tag, count and body length that
+// start an array or object.
+const containerHeader = 9
+
+// maxDocumentDepth matches the nesting limit of encoding/json.
+const maxDocumentDepth = 10000
+
+// Kind is the JSON type of a node.
+type Kind uint8
+
+const (
+	KindNull Kind = iota
+	KindBool
+	KindNumber
+	KindString
+	KindArray
+	KindObject
+)
+
+// String returns the type name JSON.TYPE replies with.
+func (k Kind) String() string {
+	switch k {
+	case KindBool:
+		return "boolean"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindArray:
+		return "array"
+	case KindObject:
+		return "object"
+	}
+	return "null"
+}
+
+// Interned keys are shared by all documents. The table only grows, so it
+// is bounded in both entries and key length; other keys are stored inline.
+const (
+	maxInternedKeys   = 1 << 16
+	maxInternedKeyLen = 64
+)
+
+type internedKey struct {
+	name   string
+	raw    []byte
+	quoted []byte // the key as AppendJSON writes it, colon included
+}
+
+var keyTable = struct {
+	sync.RWMutex
+	ids     map[string]uint32
+	entries atomic.Pointer[[]internedKey]
+}{ids: make(map[string]uint32)}
+
+func init() {
+	keyTable.entries.Store(&[]internedKey{})
+}
+
+// internKey returns the id of key, adding it to the table if there is
+// room.
+func internKey(key []byte) (uint32, bool) {
+	if len(key) > maxInternedKeyLen {
+		return 0, false
+	}
+	keyTable.RLock()
+	id, ok := keyTable.ids[string(key)]
+	keyTable.RUnlock()
+	if ok {
+		return id, true
+	}
+
+	keyTable.Lock()
+	defer keyTable.Unlock()
+	if id, ok := keyTable.ids[string(key)]; ok {
+		return id, true
+	}
+	entries := *keyTable.entries.Load()
+	if len(entries) >= maxInternedKeys {
+		return 0, false
+	}
+	name := string(key)
+	quoted := appendQuoted(nil, key)
+	entries = append(entries, internedKey{name: name, raw: []byte(name), quoted: append(quoted, ':')})
+	id = uint32(len(entries) - 1)
+	keyTable.ids[name] = id
+	keyTable.entries.Store(&entries)
+	return id, true
+}
+
+func internedKeyAt(id uint64) *internedKey {
+	return &(*keyTable.entries.Load())[id]
+}
+
+// tapeBuffers recycles the scratch tapes documents are built in; a finished
+// document copies its tape out at its exact size.
+var tapeBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+func finishTape(buf *[]byte, tape []byte) *Document {
+	doc := &Document{tape: append(make([]byte, 0, len(tape)), tape...)}
+	if cap(tape) <= 1<<20 {
+		*buf = tape[:0]
+		tapeBuffers.Put(buf)
+	}
+	return doc
+}
+
+func putContainerHeader(tape []byte, start, count int) {
+	binary.LittleEndian.PutUint32(tape[start+1:], uint32(count))
+	binary.LittleEndian.PutUint32(tape[start+5:], uint32(len(tape)-start-containerHeader))
+}
+
+func appendStringValue(tape []byte, s []byte) []byte {
+	tag := tagPlain
+	if needsEscape(s) {
+		tag = tagString
+	}
+	tape = append(tape, tag)
+	tape = binary.AppendUvarint(tape, uint64(len(s)))
+	return append(tape, s...)
+}
+
+func appendKey(tape []byte, key []byte) []byte {
+	if id, ok := internKey(key); ok {
+		return binary.AppendUvarint(tape, uint64(id)<<1|1)
+	}
+	tape = binary.AppendUvarint(tape, uint64(len(key))<<1)
+	return append(tape, key...)
+}
+
+func appendNumber(tape []byte, f float64) []byte {
+	tape = append(tape, tagNumber)
+	return binary.LittleEndian.AppendUint64(tape, math.Float64bits(f))
+}
+
+// EncodeDocument encodes a decoded JSON value (as produced by
+// encoding/json) into a document.
+func EncodeDocument(v interface{}) (*Document, error) {
+	buf := tapeBuffers.Get().(*[]byte)
+	tape, err := encodeValue((*buf)[:0], v, 0)
+	if err != nil {
+		return nil, err
+	}
+	return finishTape(buf, tape), nil
+}
+
+func encodeValue(tape []byte, v interface{}, depth int) ([]byte, error) {
+	if depth > maxDocumentDepth {
+		return nil, errors.New("exceeded max depth")
+	}
+	switch t := v.(type) {
+	case nil:
+		return append(tape, tagNull), nil
+	case bool:
+		if t {
+			return append(tape, tagTrue), nil
+		}
+		return append(tape, tagFalse), nil
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil, fmt.Errorf("unsupported value: %v", t)
+		}
+		return appendNumber(tape, t), nil
+	case int:
+		return appendNumber(tape, float64(t)), nil
+	case int64:
+		return appendNumber(tape, float64(t)), nil
+	case string:
+		return appendStringValue(tape, []byte(t)), nil
+	case []interface{}:
+		start := len(tape)
+		tape = append(tape, tagArray, 0, 0, 0, 0, 0, 0, 0, 0)
+		for _, item := range t {
+			var err error
+			if tape, err = encodeValue(tape, item, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		putContainerHeader(tape, start, len(t))
+		return tape, nil
+	case map[string]interface{}:
+		start := len(tape)
+		tape = append(tape, tagObject, 0, 0, 0, 0, 0, 0, 0, 0)
+		for _, k := range sortedKeys(t) {
+			tape = appendKey(tape, []byte(k))
+			var err error
+			if tape, err = encodeValue(tape, t[k], depth+1); err != nil {
+				return nil, err
+			}
+		}
+		putContainerHeader(tape, start, len(t))
+		return tape, nil
+	}
+	return nil, fmt.Errorf("unsupported type: %T", v)
+}
+
+// ParseDocument parses JSON text straight into a document. It accepts and
+// rejects the same input as encoding/json: duplicate keys keep the last
+// value and invalid UTF-8 in strings becomes U+FFFD.
+func ParseDocument(data []byte) (*Document, error) {
+	buf := tapeBuffers.Get().(*[]byte)
+	p := &documentParser{data: data, tape: (*buf)[:0]}
+	if err := p.parseValue(0); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, p.errorf("after top-level value")
+	}
+	return finishTape(buf, p.tape), nil
+}
+
+type documentParser struct {
+	data    []byte
+	pos     int
+	tape    []byte
+	scratch []byte
+	spans   []memberSpan
+}
+
+// memberSpan locates an object member on the tape while the object is
+// parsed, so that members can be put in key order afterwards.
+type memberSpan struct {
+	start, end int
+}
+
+func (p *documentParser) errorf(context string) error {
+	if p.pos >= len(p.data) {
+		return errors.New("unexpected end of JSON input")
+	}
+	return fmt.Errorf("invalid character %q %s at offset %d", p.data[p.pos], context, p.pos)
+}
+
+func (p *documentParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *documentParser) parseValue(depth int) error {
+	if depth > maxDocumentDepth {
+		return errors.New("exceeded max depth")
+	}
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return p.errorf("looking for beginning of value")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject(depth)
+	case c == '[':
+		return p.parseArray(depth)
+	case c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		p.tape = appendStringValue(p.tape, s)
+		return nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c == 't':
+		return p.parseLiteral("true", tagTrue)
+	case c == 'f':
+		return p.parseLiteral("false", tagFalse)
+	case c == 'n':
+		return p.parseLiteral("null", tagNull)
+	}
+	return p.errorf("looking for beginning of value")
+}
+
+func (p *documentParser) parseLiteral(lit string, tag byte) error {
+	for i := 0; i < len(lit); i++ {
+		if p.pos >= len(p.data) || p.data[p.pos] != lit[i] {
+			return p.errorf("in literal " + lit)
+		}
+		p.pos++
+	}
+	p.tape = append(p.tape, tag)
+	return nil
+}
+
+func (p *documentParser) parseNumber() error {
+	start := p.pos
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+		return n
+	}
+
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '0' {
+		p.pos++
+	} else if digits() == 0 {
+		return p.errorf("in numeric literal")
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		p.pos++
+		if digits() == 0 {
+			return p.errorf("after decimal point in numeric literal")
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return p.errorf("in exponent of numeric literal")
+		}
+	}
+
+	f, err := strconv.ParseFloat(string(p.data[start:p.pos]), 64)
+	if err != nil {
+		return fmt.Errorf("cannot represent number %s", p.data[start:p.pos])
+	}
+	p.tape = appendNumber(p.tape, f)
+	return nil
+}
+
+// parseString decodes the string at the current position into the
+// parser's scratch buffer and returns it; the result is only valid until
+// the next call.
+func (p *documentParser) parseString() ([]byte, error) {
+	p.pos++ // opening quote
+	out := p.scratch[:0]
+	for {
+		start := p.pos
+		for p.pos < len(p.data) {
+			c := p.data[p.pos]
+			if c == '"' || c == '\\' || c < 0x20 || c >= utf8.RuneSelf {
+				break
+			}
+			p.pos++
+		}
+		out = append(out, p.data[start:p.pos]...)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("in string literal")
+		}
+
+		switch c := p.data[p.pos]; {
+		case c == '"':
+			p.pos++
+			p.scratch = out
+			return out, nil
+		case c < 0x20:
+			return nil, p.errorf("in string literal")
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(p.data[p.pos:])
+			if r == utf8.RuneError && size == 1 {
+				out = utf8.AppendRune(out, utf8.RuneError)
+			} else {
+				out = append(out, p.data[p.pos:p.pos+size]...)
+			}
+			p.pos += size
+		default:
+			p.pos++
+			if p.pos >= len(p.data) {
+				return nil, p.errorf("in string escape code")
+			}
+			esc := p.data[p.pos]
+			p.pos++
+			switch esc {
+			case '"', '\\', '/':
+				out = append(out, esc)
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'u':
+				r, ok := p.parseHex4()
+				if !ok {
+					return nil, p.errorf("in \\u hexadecimal character escape")
+				}
+				if utf16.IsSurrogate(r) {
+					// A surrogate that does not start a valid pair decodes
+					// to U+FFFD and the escape after it is read on its own.
+					dec := utf8.RuneError
+					if p.pos+6 <= len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+						if r2, ok := parseHex(p.data[p.pos+2 : p.pos+6]); ok {
+							if dec = utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+								p.pos += 6
+							}
+						}
+					}
+					r = dec
+				}
+				out = utf8.AppendRune(out, r)
+			default:
+				p.pos--
+				return nil, p.errorf("in string escape code")
+			}
+		}
+	}
+}
+
+func (p *documentParser) parseHex4() (rune, bool) {
+	if p.pos+4 > len(p.data) {
+		p.pos = len(p.data)
+		return 0, false
+	}
+	r, ok := parseHex(p.data[p.pos : p.pos+4])
+	if ok {
+		p.pos += 4
+	}
+	return r, ok
+}
+
+func parseHex(b []byte) (rune, bool) {
+	var r rune
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+func (p *documentParser) parseArray(depth int) error {
+	p.pos++
+	start := len(p.tape)
+	p.tape = append(p.tape, tagArray, 0, 0, 0, 0, 0, 0, 0, 0)
+	count := 0
+
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		putContainerHeader(p.tape, start, 0)
+		return nil
+	}
+	for {
+		if err := p.parseValue(depth + 1); err != nil {
+			return err
+		}
+		count++
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return p.errorf("after array element")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			putContainerHeader(p.tape, start, count)
+			return nil
+		default:
+			return p.errorf("after array element")
+		}
+	}
+}
+
+func (p *documentParser) parseObject(depth int) error {
+	p.pos++
+	start := len(p.tape)
+	p.tape = append(p.tape, tagObject, 0, 0, 0, 0, 0, 0, 0, 0)
+	base := len(p.spans)
+	defer func() { p.spans = p.spans[:base] }()
+
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		putContainerHeader(p.tape, start, 0)
+		return nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return p.errorf("looking for beginning of object key string")
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		memberStart := len(p.tape)
+		p.tape = appendKey(p.tape, key)
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return p.errorf("after object key")
+		}
+		p.pos++
+		if err := p.parseValue(depth + 1); err != nil {
+			return err
+		}
+		p.spans = append(p.spans, memberSpan{memberStart, len(p.tape)})
+
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return p.errorf("after object key:value pair")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			count := p.sortMembers(start+containerHeader, p.spans[base:])
+			putContainerHeader(p.tape, start, count)
+			return nil
+		default:
+			return p.errorf("after object key:value pair")
+		}
+	}
+}
+
+// sortMembers puts the members of the object whose body starts at
+// bodyStart in key order, dropping all but the last of duplicate keys, and
+// returns the member count.
+func (p *documentParser) sortMembers(bodyStart int, spans []memberSpan) int {
+	sorted := true
+	for i := 1; i < len(spans) && sorted; i++ {
+		prev, _ := memberKey(p.tape, spans[i-1].start)
+		cur, _ := memberKey(p.tape, spans[i].start)
+		sorted = bytes.Compare(prev, cur) < 0
+	}
+	if sorted {
+		return len(spans)
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		a, _ := memberKey(p.tape, spans[i].start)
+		b, _ := memberKey(p.tape, spans[j].start)
+		return bytes.Compare(a, b) < 0
+	})
+	body := append([]byte(nil), p.tape[bodyStart:]...)
+	p.tape = p.tape[:bodyStart]
+	count := 0
+	for i, span := range spans {
+		if i+1 < len(spans) {
+			a, _ := memberKey(body, span.start-bodyStart)
+			b, _ := memberKey(body, spans[i+1].start-bodyStart)
+			if bytes.Equal(a, b) {
+				continue
+			}
+		}
+		p.tape = append(p.tape, body[span.start-bodyStart:span.end-bodyStart]...)
+		count++
+	}
+	return count
+}
+
+// memberKey returns the key of the member at off and the offset of its
+// value.
+func memberKey(tape []byte, off int) ([]byte, int) {
+	ref, n := binary.Uvarint(tape[off:])
+	off += n
+	if ref&1 == 1 {
+		return internedKeyAt(ref >> 1).raw, off
+	}
+	size := int(ref >> 1)
+	return tape[off : off+size], off + size
+}
+
+// valueEnd returns the offset just past the value at off.
+func valueEnd(tape []byte, off int) int {
+	switch tape[off] {
+	case tagNumber:
+		return off + 9
+	case tagString, tagPlain:
+		size, n := binary.Uvarint(tape[off+1:])
+		return off + 1 + n + int(size)
+	case tagArray, tagObject:
+		return off + containerHeader + int(binary.LittleEndian.Uint32(tape[off+5:]))
+	}
+	return off + 1
+}
+
+// Root returns the top-level value of the document.
+func (d *Document) Root() Node {
+	return Node{tape: d.tape}
+}
+
+// Decode returns the document as a tree of the types encoding/json
+// decodes into. Every call returns a new tree.
+func (d *Document) Decode() interface{} {
+	return d.Root().Decode()
+}
+
+// AppendJSON appends the document to dst as encoding/json would marshal
+// its decoded value.
+func (d *Document) AppendJSON(dst []byte) []byte {
+	return d.Root().AppendJSON(dst)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return d.AppendJSON(nil), nil
+}
+
+// Size returns the number of bytes the document occupies in memory,
+// interned keys excepted.
+func (d *Document) Size() int64 {
+	return int64(cap(d.tape)) + int64(unsafe.Sizeof(*d))
+}
+
+// Lookup returns the node a path selects. It only resolves paths made of
+// single member names and indexes, which select at most one node; for any
+// other path, or when nothing matches, ok is false.
+func (d *Document) Lookup(p *Path) (Node, bool) {
+	n, _, ok := d.lookup(p)
+	return n, ok
+}
+
+// lookup is Lookup that also returns the offsets of the containers on the
+// way to the node.
+func (d *Document) lookup(p *Path) (Node, []int, bool) {
+	if !p.IsSingular() {
+		return Node{}, nil, false
+	}
+	n := d.Root()
+	ancestors := make([]int, 0, len(p.segments))
+	for _, seg := range p.segments {
+		ancestors = append(ancestors, n.off)
+		var ok bool
+		switch sel := seg.selectors[0].(type) {
+		case nameSelector:
+			n, ok = n.Get(sel.name)
+		case indexSelector:
+			n, ok = n.Index(sel.index)
+		}
+		if !ok {
+			return Node{}, nil, false
+		}
+	}
+	return n, ancestors, true
+}
+
+// Replace returns a copy of the document in which the node a path selects
+// is replaced by v. Like Lookup it only handles paths selecting at most one
+// node, and ok is false when the path selects nothing.
+func (d *Document) Replace(p *Path, v *Document) (*Document, bool) {
+	n, ancestors, ok := d.lookup(p)
+	if !ok {
+		return nil, false
+	}
+	start, end := n.off, n.end()
+	tape := make([]byte, 0, len(d.tape)-(end-start)+len(v.tape))
+	tape = append(tape, d.tape[:start]...)
+	tape = append(tape, v.tape...)
+	tape = append(tape, d.tape[end:]...)
+
+	delta := len(v.tape) - (end - start)
+	for _, off := range ancestors {
+		body := tape[off+5:]
+		binary.LittleEndian.PutUint32(body, uint32(int(binary.LittleEndian.Uint32(body))+delta))
+	}
+	return &Document{tape: tape}, true
+}
+
+// Node is a value inside a document. It is a cursor into the document's
+// tape and stays valid as long as the document does.
+type Node struct {
+	tape []byte
+	off  int
+}
+
+// Kind returns the JSON type of the node.
+func (n Node) Kind() Kind {
+	switch n.tape[n.off] {
+	case tagFalse, tagTrue:
+		return KindBool
+	case tagNumber:
+		return KindNumber
+	case tagString, tagPlain:
+		return KindString
+	case tagArray:
+		return KindArray
+	case tagObject:
+		return KindObject
+	}
+	return KindNull
+}
+
+func (n Node) end() int {
+	return valueEnd(n.tape, n.off)
+}
+
+// Size returns the number of tape bytes the node occupies.
+func (n Node) Size() int {
+	return n.end() - n.off
+}
+
+// Len returns the number of elements or members of an array or object and
+// the length in bytes of a string. It is 0 for other nodes.
+func (n Node) Len() int {
+	switch n.tape[n.off] {
+	case tagArray, tagObject:
+		return int(binary.LittleEndian.Uint32(n.tape[n.off+1:]))
+	case tagString, tagPlain:
+		size, _ := binary.Uvarint(n.tape[n.off+1:])
+		return int(size)
+	}
+	return 0
+}
+
+// Bool returns the value of a boolean node.
+func (n Node) Bool() bool {
+	return n.tape[n.off] == tagTrue
+}
+
+// Float returns the value of a number node.
+func (n Node) Float() float64 {
+	if n.tape[n.off] != tagNumber {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(n.tape[n.off+1:]))
+}
+
+// Str returns the value of a string node.
+func (n Node) Str() string {
+	return string(n.strBytes())
+}
+
+func (n Node) strBytes() []byte {
+	switch n.tape[n.off] {
+	case tagString, tagPlain:
+		size, k := binary.Uvarint(n.tape[n.off+1:])
+		start := n.off + 1 + k
+		return n.tape[start : start+int(size)]
+	}
+	return nil
+}
+
+// Get returns the member of an object node with the given key.
+func (n Node) Get(key string) (Node, bool) {
+	if n.tape[n.off] != tagObject {
+		return Node{}, false
+	}
+	off, end := n.off+containerHeader, n.end()
+	for off < end {
+		name, valueOff := memberKey(n.tape, off)
+		switch cmp := bytes.Compare(name, []byte(key)); {
+		case cmp == 0:
+			return Node{tape: n.tape, off: valueOff}, true
+		case cmp > 0:
+			return Node{}, false
+		}
+		off = valueEnd(n.tape, valueOff)
+	}
+	return Node{}, false
+}
+
+// Index returns an element of an array node. Negative indexes count from
+// the end of the array.
+func (n Node) Index(i int) (Node, bool) {
+	if n.tape[n.off] != tagArray {
+		return Node{}, false
+	}
+	if i < 0 {
+		i += n.Len()
+	}
+	if i < 0 || i >= n.Len() {
+		return Node{}, false
+	}
+	off := n.off + containerHeader
+	for ; i > 0; i-- {
+		off = valueEnd(n.tape, off)
+	}
+	return Node{tape: n.tape, off: off}, true
+}
+
+// Elements calls fn for each element of an array node until fn returns
+// false.
+func (n Node) Elements(fn func(i int, v Node) bool) {
+	if n.tape[n.off] != tagArray {
+		return
+	}
+	off, end := n.off+containerHeader, n.end()
+	for i := 0; off < end; i++ {
+		if !fn(i, Node{tape: n.tape, off: off}) {
+			return
+		}
+		off = valueEnd(n.tape, off)
+	}
+}
+
+// Members calls fn for each member of an object node, in key order, until
+// fn returns false.
+func (n Node) Members(fn func(key string, v Node) bool) {
+	if n.tape[n.off] != tagObject {
+		return
+	}
+	off, end := n.off+containerHeader, n.end()
+	for off < end {
+		key, valueOff := n.memberName(off)
+		v := Node{tape: n.tape, off: valueOff}
+		if !fn(key, v) {
+			return
+		}
+		off = v.end()
+	}
+}
+
+// memberName is memberKey returning the key as a string, which for
+// interned keys does not allocate.
+func (n Node) memberName(off int) (string, int) {
+	ref, k := binary.Uvarint(n.tape[off:])
+	off += k
+	if ref&1 == 1 {
+		return internedKeyAt(ref >> 1).name, off
+	}
+	size := int(ref >> 1)
+	return string(n.tape[off : off+size]), off + size
+}
+
+// Decode returns the node as a tree of the types encoding/json decodes
+// into.
+func (n Node) Decode() interface{} {
+	switch n.tape[n.off] {
+	case tagFalse:
+		return false
+	case tagTrue:
+		return true
+	case tagNumber:
+		return n.Float()
+	case tagString, tagPlain:
+		return n.Str()
+	case tagArray:
+		arr := make([]interface{}, 0, n.Len())
+		n.Elements(func(_ int, v Node) bool {
+			arr = append(arr, v.Decode())
+			return true
+		})
+		return arr
+	case tagObject:
+		obj := make(map[string]interface{}, n.Len())
+		n.Members(func(key string, v Node) bool {
+			obj[key] = v.Decode()
+			return true
+		})
+		return obj
+	}
+	return nil
+}
+
+// AppendJSON appends the node to dst as encoding/json would marshal its
+// decoded value.
+func (n Node) AppendJSON(dst []byte) []byte {
+	switch tag := n.tape[n.off]; tag {
+	case tagFalse:
+		return append(dst, "false"...)
+	case tagTrue:
+		return append(dst, "true"...)
+	case tagNumber:
+		return appendFloat(dst, n.Float())
+	case tagPlain:
+		dst = append(dst, '"')
+		dst = append(dst, n.strBytes()...)
+		return append(dst, '"')
+	case tagString:
+		return appendQuoted(dst, n.strBytes())
+	case tagArray:
+		dst = append(dst, '[')
+		n.Elements(func(i int, v Node) bool {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = v.AppendJSON(dst)
+			return true
+		})
+		return append(dst, ']')
+	case tagObject:
+		dst = append(dst, '{')
+		off, end := n.off+containerHeader, n.end()
+		for off < end {
+			if off > n.off+containerHeader {
+				dst = append(dst, ',')
+			}
+			ref, k := binary.Uvarint(n.tape[off:])
+			off += k
+			if ref&1 == 1 {
+				dst = append(dst, internedKeyAt(ref>>1).quoted...)
+			} else {
+				size := int(ref >> 1)
+				dst = appendQuoted(dst, n.tape[off:off+size])
+				dst = append(dst, ':')
+				off += size
+			}
+			v := Node{tape: n.tape, off: off}
+			dst = v.AppendJSON(dst)
+			off = v.end()
+		}
+		return append(dst, '}')
+	}
+	return append(dst, "null"...)
+}
+
+// appendFloat formats f the way encoding/json does.
+func appendFloat(dst []byte, f float64) []byte {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// needsEscape reports whether s cannot be written between quotes as is,
+// following the HTML-safe escaping of encoding/json.
+func needsEscape(s []byte) bool {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c < 0x20 || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if (r == utf8.RuneError && size == 1) || r == '\u2028' || r == '\u2029' {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// appendQuoted appends s as a JSON string escaped like encoding/json.
+func appendQuoted(dst []byte, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
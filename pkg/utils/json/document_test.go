@@ -0,0 +1,318 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var documentCorpus = []string{
+	`null`, `true`, `false`, `0`, `-0`, `1.5`, `-12e3`, `1e21`, `1e-7`, `0.000001`, `123456789012345678`,
+	`""`, `"plain text"`, `"tab\tquote\"slash\\"`, `"<a href='x'>&amp;</a>"`, `"\u00e9\u2028\u2029 ✓"`,
+	`"\ud83d\ude00"`, `"\ud800"`, `"\ud800\u0041"`, `"\b\f\u0001\u001f"`, "\"bad \xff utf8\"",
+	`[]`, `{}`, `[1,[2,[3,[]]],{"a":{}}]`,
+	`{"b":1,"a":2,"c":{"z":[true,false,null],"y":"s"}}`,
+	`{"dup":1,"x":0,"dup":2}`, `{"a":1,"a":{"b":2},"a":[3]}`,
+	`{"": "empty key", "a\"b": 1, "a<b": 2, "` + strings.Repeat("k", 100) + `": 3}`,
+	" \n\t{ \"spaced\" : [ 1 , 2 ] } \r\n",
+}
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, src := range documentCorpus {
+		var tree interface{}
+		if err := json.Unmarshal([]byte(src), &tree); err != nil {
+			t.Fatalf("corpus entry %q: %v", src, err)
+		}
+		want, _ := json.Marshal(tree)
+
+		parsed, err := ParseDocument([]byte(src))
+		if err != nil {
+			t.Fatalf("ParseDocument(%q) error = %v", src, err)
+		}
+		if got := parsed.AppendJSON(nil); string(got) != string(want) {
+			t.Errorf("ParseDocument(%q).AppendJSON() = %s, want %s", src, got, want)
+		}
+		if got := parsed.Decode(); !reflect.DeepEqual(got, tree) {
+			t.Errorf("ParseDocument(%q).Decode() = %#v, want %#v", src, got, tree)
+		}
+
+		encoded, err := EncodeDocument(tree)
+		if err != nil {
+			t.Fatalf("EncodeDocument(%q) error = %v", src, err)
+		}
+		if string(encoded.tape) != string(parsed.tape) {
+			t.Errorf("EncodeDocument and ParseDocument disagree for %q", src)
+		}
+	}
+}
+
+func TestParseDocumentErrors(t *testing.T) {
+	for _, src := range []string{
+		``, ` `, `{`, `[1,]`, `{"a":1,}`, `{"a" 1}`, `{a:1}`, `[1 2]`, `01`, `-`, `1.`, `1e`, `.5`,
+		`+1`, `1e400`, `tru`, `nul`, `"abc`, "\"a\nb\"", `"\x"`, `"\u12"`, `"\ud800\uzzzz"`, `[1]]`, `{} {}`,
+	} {
+		var tree interface{}
+		if json.Unmarshal([]byte(src), &tree) == nil {
+			t.Fatalf("corpus entry %q is valid JSON", src)
+		}
+		if _, err := ParseDocument([]byte(src)); err == nil {
+			t.Errorf("ParseDocument(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestDocumentRandomValues(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		tree := randomJSON(rng, 4)
+		want, _ := json.Marshal(tree)
+		doc, err := ParseDocument(want)
+		if err != nil {
+			t.Fatalf("ParseDocument(%s) error = %v", want, err)
+		}
+		if got := doc.AppendJSON(nil); string(got) != string(want) {
+			t.Fatalf("AppendJSON() = %s, want %s", got, want)
+		}
+	}
+}
+
+func randomJSON(rng *rand.Rand, depth int) interface{} {
+	n := rng.Intn(7)
+	if depth == 0 {
+		n = rng.Intn(4)
+	}
+	switch n {
+	case 0:
+		return nil
+	case 1:
+		return rng.Intn(2) == 0
+	case 2:
+		return (rng.Float64() - 0.5) * float64(int64(1)<<uint(rng.Intn(80)))
+	case 3:
+		runes := []rune("aZ09 \"\\<>&\n\x01é€😀\u2028")
+		s := make([]rune, rng.Intn(8))
+		for i := range s {
+			s[i] = runes[rng.Intn(len(runes))]
+		}
+		return string(s)
+	case 4, 5:
+		obj := map[string]interface{}{}
+		for i := rng.Intn(5); i > 0; i-- {
+			obj[fmt.Sprintf("k%d", rng.Intn(8))] = randomJSON(rng, depth-1)
+		}
+		return obj
+	}
+	arr := make([]interface{}, rng.Intn(5))
+	for i := range arr {
+		arr[i] = randomJSON(rng, depth-1)
+	}
+	return arr
+}
+
+func TestDocumentNavigation(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{"name":"x","tags":["a","b","c"],"n":{"v":2.5,"ok":true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"$", `{"n":{"ok":true,"v":2.5},"name":"x","tags":["a","b","c"]}`, true},
+		{"$.tags[1]", `"b"`, true},
+		{"$.tags[-1]", `"c"`, true},
+		{".n.v", `2.5`, true},
+		{"$['n']['ok']", `true`, true},
+		{"$.tags[3]", ``, false},
+		{"$.missing", ``, false},
+		{"$.name.x", ``, false},
+		{"$.tags[*]", ``, false},
+		{"$..v", ``, false},
+	}
+	for _, tt := range tests {
+		n, ok := doc.Lookup(MustCompilePath(tt.path))
+		if ok != tt.ok {
+			t.Errorf("Lookup(%s) ok = %v, want %v", tt.path, ok, tt.ok)
+			continue
+		}
+		if ok && string(n.AppendJSON(nil)) != tt.want {
+			t.Errorf("Lookup(%s) = %s, want %s", tt.path, n.AppendJSON(nil), tt.want)
+		}
+	}
+
+	root := doc.Root()
+	if root.Kind() != KindObject || root.Len() != 3 {
+		t.Errorf("root kind %v len %d", root.Kind(), root.Len())
+	}
+	tags, _ := root.Get("tags")
+	if tags.Kind() != KindArray || tags.Len() != 3 {
+		t.Errorf("tags kind %v len %d", tags.Kind(), tags.Len())
+	}
+	v, _ := doc.Lookup(MustCompilePath("$.n.v"))
+	if v.Kind() != KindNumber || v.Float() != 2.5 {
+		t.Errorf("$.n.v = %v %v", v.Kind(), v.Float())
+	}
+}
+
+func TestDocumentReplace(t *testing.T) {
+	src := `{"a":{"b":[1,{"c":"x"},3]},"z":true}`
+	tests := []struct {
+		path  string
+		value string
+		want  string
+	}{
+		{"$", `[1]`, `[1]`},
+		{"$.z", `false`, `{"a":{"b":[1,{"c":"x"},3]},"z":false}`},
+		{"$.a.b[1].c", `{"long":"replacement value"}`, `{"a":{"b":[1,{"c":{"long":"replacement value"}},3]},"z":true}`},
+		{"$.a.b[-1]", `null`, `{"a":{"b":[1,{"c":"x"},null]},"z":true}`},
+		{"$.a", `0`, `{"a":0,"z":true}`},
+	}
+	for _, tt := range tests {
+		doc, _ := ParseDocument([]byte(src))
+		value, _ := ParseDocument([]byte(tt.value))
+		updated, ok := doc.Replace(MustCompilePath(tt.path), value)
+		if !ok {
+			t.Fatalf("Replace(%s) failed", tt.path)
+		}
+		if got := updated.AppendJSON(nil); string(got) != tt.want {
+			t.Errorf("Replace(%s, %s) = %s, want %s", tt.path, tt.value, got, tt.want)
+		}
+		if got := doc.AppendJSON(nil); string(got) != `{"a":{"b":[1,{"c":"x"},3]},"z":true}` {
+			t.Errorf("Replace modified the original: %s", got)
+		}
+		// Lengths must stay consistent for further navigation
+		if n, ok := updated.Lookup(MustCompilePath("$.z")); ok && string(n.AppendJSON(nil)) == "" {
+			t.Errorf("Replace(%s) broke navigation", tt.path)
+		}
+	}
+
+	doc, _ := ParseDocument([]byte(src))
+	if _, ok := doc.Replace(MustCompilePath("$.missing"), doc); ok {
+		t.Error("Replace of a missing path succeeded")
+	}
+}
+
+func TestDocumentSize(t *testing.T) {
+	small, _ := ParseDocument([]byte(`{"a":1}`))
+	large, _ := ParseDocument([]byte(`{"a":"` + strings.Repeat("x", 1000) + `"}`))
+	// A 1000 byte string with a 2 byte length replaces a 9 byte number
+	if d := large.Size() - small.Size(); d != 1+2+1000-9 {
+		t.Errorf("size difference = %d, want %d", d, 1+2+1000-9)
+	}
+	n, _ := large.Root().Get("a")
+	if n.Size() != 1+2+1000 {
+		t.Errorf("node size = %d, want %d", n.Size(), 1003)
+	}
+}
+
+// largeDocument returns a JSON text of about 1MB shaped like typical API
+// payloads: an array of records with repeated keys.
+func largeDocument() []byte {
+	records := make([]interface{}, 5000)
+	for i := range records {
+		records[i] = map[string]interface{}{
+			"id":       float64(i),
+			"name":     fmt.Sprintf("user-%d", i),
+			"email":    fmt.Sprintf("user%d@example.com", i),
+			"active":   i%3 == 0,
+			"score":    float64(i) * 1.25,
+			"tags":     []interface{}{"alpha", "beta", "gamma"},
+			"location": map[string]interface{}{"city": "Istanbul", "zip": "34000"},
+		}
+	}
+	data, _ := json.Marshal(map[string]interface{}{"records": records, "total": float64(len(records))})
+	return data
+}
+
+func BenchmarkParse(b *testing.B) {
+	data := largeDocument()
+	b.Run("tree", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			var v interface{}
+			if err := json.Unmarshal(data, &v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("document", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseDocument(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	data := largeDocument()
+	var tree interface{}
+	_ = json.Unmarshal(data, &tree)
+	doc, _ := ParseDocument(data)
+
+	b.Run("tree", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(tree); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("document", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		buf := make([]byte, 0, len(data))
+		for i := 0; i < b.N; i++ {
+			buf = doc.AppendJSON(buf[:0])
+		}
+	})
+}
+
+func BenchmarkGetPath(b *testing.B) {
+	data := largeDocument()
+	var tree interface{}
+	_ = json.Unmarshal(data, &tree)
+	doc, _ := ParseDocument(data)
+	path := MustCompilePath("$.records[4000].location.city")
+
+	b.Run("tree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v, _ := path.First(tree)
+			if _, err := json.Marshal(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("document", func(b *testing.B) {
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			n, _ := doc.Lookup(path)
+			buf = n.AppendJSON(buf[:0])
+		}
+	})
+}
+
+func BenchmarkMemory(b *testing.B) {
+	data := largeDocument()
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v interface{}
+			_ = json.Unmarshal(data, &v)
+		}
+	})
+	b.Run("document", func(b *testing.B) {
+		b.ReportAllocs()
+		var size int64
+		for i := 0; i < b.N; i++ {
+			doc, _ := ParseDocument(data)
+			size = doc.Size()
+		}
+		b.ReportMetric(float64(size), "doc-bytes")
+	})
+}
@@ -0,0 +1,902 @@
+package json
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Path is a compiled JSONPath query as defined by RFC 9535. Paths that do
+// not start with '$' are legacy RedisJSON paths ("." or ".a.b[0]"); they
+// are compiled to the same AST but callers resolve them to a single value.
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []segment
+}
+
+type segment struct {
+	descendant bool
+	selectors  []selector
+}
+
+type selector interface {
+	// selectFrom appends the children of node picked by the selector
+	selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match
+}
+
+type nameSelector struct{ name string }
+
+type wildcardSelector struct{}
+
+type indexSelector struct{ index int }
+
+type sliceSelector struct {
+	start, end *int
+	step       int
+}
+
+type filterSelector struct{ expr logicalExpr }
+
+// pathCacheSize bounds the number of compiled paths kept by CompilePath.
+const pathCacheSize = 1024
+
+var pathCache = struct {
+	sync.RWMutex
+	paths map[string]*Path
+}{paths: make(map[string]*Path)}
+
+// CompilePath parses a JSONPath expression, returning a cached AST when the
+// same expression was compiled before. Compiled paths are immutable and
+// safe for concurrent use.
+func CompilePath(expr string) (*Path, error) {
+	pathCache.RLock()
+	p, ok := pathCache.paths[expr]
+	pathCache.RUnlock()
+	if ok {
+		return p, nil
+	}
+
+	p, err := parsePath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	pathCache.Lock()
+	if len(pathCache.paths) >= pathCacheSize {
+		pathCache.paths = make(map[string]*Path)
+	}
+	pathCache.paths[expr] = p
+	pathCache.Unlock()
+	return p, nil
+}
+
+// MustCompilePath is like CompilePath but panics on invalid expressions.
+func MustCompilePath(expr string) *Path {
+	p, err := CompilePath(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the expression the path was compiled from.
+func (p *Path) String() string {
+	return p.raw
+}
+
+// IsLegacy reports whether the path uses the legacy dot syntax, which
+// resolves to a single value instead of a list of matches.
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// IsRoot reports whether the path selects the root value only.
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// IsSingular reports whether the path is made of single member names and
+// indexes only, so that it selects at most one node.
+func (p *Path) IsSingular() bool {
+	for _, seg := range p.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		switch seg.selectors[0].(type) {
+		case nameSelector, indexSelector:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Parent splits off the last segment when it selects a single member name,
+// returning the path of the containing object and the member name. It is
+// used to create members that do not exist yet.
+func (p *Path) Parent() (*Path, string, bool) {
+	if len(p.segments) == 0 {
+		return nil, "", false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.descendant || len(last.selectors) != 1 {
+		return nil, "", false
+	}
+	name, ok := last.selectors[0].(nameSelector)
+	if !ok {
+		return nil, "", false
+	}
+	return &Path{raw: p.raw, legacy: p.legacy, segments: p.segments[:len(p.segments)-1]}, name.name, true
+}
+
+// parentIndex is like Parent for paths ending in a single array index.
+func (p *Path) parentIndex() (*Path, int, bool) {
+	if len(p.segments) == 0 {
+		return nil, 0, false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.descendant || len(last.selectors) != 1 {
+		return nil, 0, false
+	}
+	index, ok := last.selectors[0].(indexSelector)
+	if !ok {
+		return nil, 0, false
+	}
+	return &Path{raw: p.raw, legacy: p.legacy, segments: p.segments[:len(p.segments)-1]}, index.index, true
+}
+
+// parsePath compiles expr without consulting the cache.
+func parsePath(expr string) (*Path, error) {
+	legacy := !strings.HasPrefix(expr, "$")
+	src := expr
+	if legacy {
+		src = legacyToJSONPath(expr)
+	}
+
+	ps := &pathParser{src: src, legacy: legacy}
+	ps.pos = 1 // skip '$'
+	segments, err := ps.parseSegments(false)
+	if err != nil {
+		return nil, err
+	}
+	if ps.pos != len(ps.src) {
+		return nil, ps.errorf("unexpected character %q", ps.src[ps.pos])
+	}
+	return &Path{raw: expr, legacy: legacy, segments: segments}, nil
+}
+
+// legacyToJSONPath rewrites a legacy path (".a.b", "a.b", "a[0]", ".") to
+// its '$' form.
+func legacyToJSONPath(expr string) string {
+	switch {
+	case expr == "" || expr == ".":
+		return "$"
+	case strings.HasPrefix(expr, ".") || strings.HasPrefix(expr, "["):
+		return "$" + expr
+	default:
+		return "$." + expr
+	}
+}
+
+type pathParser struct {
+	src    string
+	pos    int
+	legacy bool
+}
+
+func (ps *pathParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSONPath at position %d: %s", ps.pos, fmt.Sprintf(format, args...))
+}
+
+func (ps *pathParser) peek() byte {
+	if ps.pos < len(ps.src) {
+		return ps.src[ps.pos]
+	}
+	return 0
+}
+
+func (ps *pathParser) hasPrefix(s string) bool {
+	return strings.HasPrefix(ps.src[ps.pos:], s)
+}
+
+func (ps *pathParser) skipSpace() {
+	for ps.pos < len(ps.src) {
+		switch ps.src[ps.pos] {
+		case ' ', '\t', '\n', '\r':
+			ps.pos++
+		default:
+			return
+		}
+	}
+}
+
+// parseSegments parses segments until none follow. Inside filters
+// whitespace may precede a segment.
+func (ps *pathParser) parseSegments(inFilter bool) ([]segment, error) {
+	var segments []segment
+	for {
+		save := ps.pos
+		if inFilter {
+			ps.skipSpace()
+		}
+
+		switch {
+		case ps.hasPrefix(".."):
+			ps.pos += 2
+			seg, err := ps.parseSegmentBody(true)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+		case ps.peek() == '.':
+			ps.pos++
+			// Legacy paths tolerate a dot before a bracket: "a.[0]"
+			if ps.legacy && ps.peek() == '[' {
+				continue
+			}
+			seg, err := ps.parseSegmentBody(false)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, seg)
+		case ps.peek() == '[':
+			selectors, err := ps.parseBracketed()
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment{selectors: selectors})
+		default:
+			ps.pos = save
+			return segments, nil
+		}
+	}
+}
+
+// parseSegmentBody parses what follows '.' or '..'.
+func (ps *pathParser) parseSegmentBody(descendant bool) (segment, error) {
+	switch {
+	case ps.peek() == '*':
+		ps.pos++
+		return segment{descendant: descendant, selectors: []selector{wildcardSelector{}}}, nil
+	case descendant && ps.peek() == '[':
+		selectors, err := ps.parseBracketed()
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{descendant: true, selectors: selectors}, nil
+	}
+
+	name, err := ps.parseMemberName()
+	if err != nil {
+		return segment{}, err
+	}
+	return segment{descendant: descendant, selectors: []selector{nameSelector{name}}}, nil
+}
+
+// parseMemberName parses a member-name-shorthand. Legacy paths accept any
+// character up to the next '.' or '[', with backslash escapes.
+func (ps *pathParser) parseMemberName() (string, error) {
+	start := ps.pos
+	if ps.legacy {
+		var b strings.Builder
+		for ps.pos < len(ps.src) {
+			c := ps.src[ps.pos]
+			if c == '\\' && ps.pos+1 < len(ps.src) {
+				b.WriteByte(ps.src[ps.pos+1])
+				ps.pos += 2
+				continue
+			}
+			if c == '.' || c == '[' {
+				break
+			}
+			b.WriteByte(c)
+			ps.pos++
+		}
+		if ps.pos == start {
+			return "", ps.errorf("expected member name")
+		}
+		return b.String(), nil
+	}
+
+	for ps.pos < len(ps.src) {
+		r, size := utf8.DecodeRuneInString(ps.src[ps.pos:])
+		if !isNameChar(r, ps.pos == start) {
+			break
+		}
+		ps.pos += size
+	}
+	if ps.pos == start {
+		return "", ps.errorf("expected member name")
+	}
+	return ps.src[start:ps.pos], nil
+}
+
+func isNameChar(r rune, first bool) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r >= 0x80:
+		return true
+	case r >= '0' && r <= '9':
+		return !first
+	}
+	return false
+}
+
+func (ps *pathParser) parseBracketed() ([]selector, error) {
+	ps.pos++ // '['
+	var selectors []selector
+	for {
+		ps.skipSpace()
+		sel, err := ps.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+
+		ps.skipSpace()
+		switch ps.peek() {
+		case ',':
+			ps.pos++
+		case ']':
+			ps.pos++
+			return selectors, nil
+		default:
+			return nil, ps.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+func (ps *pathParser) parseSelector() (selector, error) {
+	switch c := ps.peek(); {
+	case c == '\'' || c == '"':
+		name, err := ps.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return nameSelector{name}, nil
+	case c == '*':
+		ps.pos++
+		return wildcardSelector{}, nil
+	case c == '?':
+		ps.pos++
+		ps.skipSpace()
+		expr, err := ps.parseLogicalOr()
+		if err != nil {
+			return nil, err
+		}
+		return filterSelector{expr}, nil
+	case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+		return ps.parseIndexOrSlice()
+	}
+	return nil, ps.errorf("invalid selector")
+}
+
+func (ps *pathParser) parseIndexOrSlice() (selector, error) {
+	var parts [3]*int
+	n := 0
+	for {
+		ps.skipSpace()
+		if c := ps.peek(); c == '-' || (c >= '0' && c <= '9') {
+			v, err := ps.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			parts[n] = &v
+		}
+		ps.skipSpace()
+		if ps.peek() != ':' || n == 2 {
+			break
+		}
+		ps.pos++
+		n++
+	}
+
+	if n == 0 {
+		if parts[0] == nil {
+			return nil, ps.errorf("expected index")
+		}
+		return indexSelector{*parts[0]}, nil
+	}
+
+	step := 1
+	if parts[2] != nil {
+		step = *parts[2]
+	}
+	return sliceSelector{start: parts[0], end: parts[1], step: step}, nil
+}
+
+func (ps *pathParser) parseInt() (int, error) {
+	start := ps.pos
+	if ps.peek() == '-' {
+		ps.pos++
+	}
+	for ps.pos < len(ps.src) && ps.src[ps.pos] >= '0' && ps.src[ps.pos] <= '9' {
+		ps.pos++
+	}
+	text := ps.src[start:ps.pos]
+	if text == "-0" || (len(text) > 1 && text[0] == '0') || (len(text) > 2 && text[:2] == "-0") {
+		return 0, ps.errorf("invalid integer %q", text)
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, ps.errorf("invalid integer %q", text)
+	}
+	return v, nil
+}
+
+// parseString parses a single or double quoted string literal.
+func (ps *pathParser) parseString() (string, error) {
+	quote := ps.src[ps.pos]
+	ps.pos++
+
+	var b strings.Builder
+	for ps.pos < len(ps.src) {
+		c := ps.src[ps.pos]
+		switch {
+		case c == quote:
+			ps.pos++
+			return b.String(), nil
+		case c == '\\':
+			if ps.pos+1 >= len(ps.src) {
+				return "", ps.errorf("unterminated escape")
+			}
+			esc := ps.src[ps.pos+1]
+			ps.pos += 2
+			switch esc {
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '/', '\\', '\'', '"':
+				b.WriteByte(esc)
+			case 'u':
+				r, err := ps.parseUnicodeEscape()
+				if err != nil {
+					return "", err
+				}
+				b.WriteRune(r)
+			default:
+				return "", ps.errorf("invalid escape \\%c", esc)
+			}
+		case c < 0x20:
+			return "", ps.errorf("control character in string")
+		default:
+			b.WriteByte(c)
+			ps.pos++
+		}
+	}
+	return "", ps.errorf("unterminated string")
+}
+
+func (ps *pathParser) parseUnicodeEscape() (rune, error) {
+	read := func() (rune, error) {
+		if ps.pos+4 > len(ps.src) {
+			return 0, ps.errorf("invalid unicode escape")
+		}
+		v, err := strconv.ParseUint(ps.src[ps.pos:ps.pos+4], 16, 32)
+		if err != nil {
+			return 0, ps.errorf("invalid unicode escape")
+		}
+		ps.pos += 4
+		return rune(v), nil
+	}
+
+	r, err := read()
+	if err != nil {
+		return 0, err
+	}
+	if r >= 0xD800 && r < 0xDC00 {
+		if !ps.hasPrefix(`\u`) {
+			return 0, ps.errorf("unpaired surrogate")
+		}
+		ps.pos += 2
+		low, err := read()
+		if err != nil {
+			return 0, err
+		}
+		if low < 0xDC00 || low > 0xDFFF {
+			return 0, ps.errorf("unpaired surrogate")
+		}
+		r = 0x10000 + (r-0xD800)<<10 + (low - 0xDC00)
+	}
+	return r, nil
+}
+
+// Filter expressions
+
+type logicalExpr interface {
+	test(ctx *evalContext, current interface{}) bool
+}
+
+type orExpr struct{ terms []logicalExpr }
+
+type andExpr struct{ terms []logicalExpr }
+
+type notExpr struct{ expr logicalExpr }
+
+// existsExpr is a test expression: true when the query selects a node.
+type existsExpr struct{ query *queryExpr }
+
+// logicalFunc is a test expression calling a function of logical type.
+type logicalFunc struct{ call *funcExpr }
+
+type compareExpr struct {
+	op          string
+	left, right valueExpr
+}
+
+// valueExpr produces a single value or nothing.
+type valueExpr interface {
+	value(ctx *evalContext, current interface{}) (interface{}, bool)
+}
+
+type literalExpr struct{ v interface{} }
+
+type queryExpr struct {
+	relative bool
+	segments []segment
+}
+
+type funcExpr struct {
+	name string
+	args []interface{} // valueExpr, *queryExpr or logicalExpr
+	re   *regexp.Regexp
+}
+
+func (ps *pathParser) parseLogicalOr() (logicalExpr, error) {
+	var terms []logicalExpr
+	for {
+		term, err := ps.parseLogicalAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		ps.skipSpace()
+		if !ps.hasPrefix("||") {
+			break
+		}
+		ps.pos += 2
+		ps.skipSpace()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return orExpr{terms}, nil
+}
+
+func (ps *pathParser) parseLogicalAnd() (logicalExpr, error) {
+	var terms []logicalExpr
+	for {
+		term, err := ps.parseBasic()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		ps.skipSpace()
+		if !ps.hasPrefix("&&") {
+			break
+		}
+		ps.pos += 2
+		ps.skipSpace()
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return andExpr{terms}, nil
+}
+
+func (ps *pathParser) parseBasic() (logicalExpr, error) {
+	if ps.peek() == '!' {
+		ps.pos++
+		ps.skipSpace()
+		inner, err := ps.parseNegatable()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	}
+
+	if ps.peek() == '(' {
+		ps.pos++
+		ps.skipSpace()
+		inner, err := ps.parseLogicalOr()
+		if err != nil {
+			return nil, err
+		}
+		ps.skipSpace()
+		if ps.peek() != ')' {
+			return nil, ps.errorf("expected ')'")
+		}
+		ps.pos++
+		return inner, nil
+	}
+
+	left, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	ps.skipSpace()
+	op := ps.parseComparisonOp()
+	if op == "" {
+		return asTest(left, ps)
+	}
+
+	ps.skipSpace()
+	right, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := asComparable(left, ps)
+	if err != nil {
+		return nil, err
+	}
+	r, err := asComparable(right, ps)
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" {
+		lit, ok := r.(literalExpr)
+		pattern, isString := lit.v.(string)
+		if !ok || !isString {
+			return nil, ps.errorf("=~ requires a string literal pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, ps.errorf("invalid regular expression: %v", err)
+		}
+		return logicalFunc{&funcExpr{name: "search", args: []interface{}{l, r}, re: re}}, nil
+	}
+	return compareExpr{op: op, left: l, right: r}, nil
+}
+
+// parseNegatable parses what may follow '!': a parenthesized expression or
+// a test expression.
+func (ps *pathParser) parseNegatable() (logicalExpr, error) {
+	if ps.peek() == '(' {
+		return ps.parseBasic()
+	}
+	operand, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return asTest(operand, ps)
+}
+
+func (ps *pathParser) parseComparisonOp() string {
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if ps.hasPrefix(op) {
+			ps.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+// parseOperand parses a literal, a query or a function call.
+func (ps *pathParser) parseOperand() (interface{}, error) {
+	switch c := ps.peek(); {
+	case c == '@' || c == '$':
+		ps.pos++
+		segments, err := ps.parseSegments(false)
+		if err != nil {
+			return nil, err
+		}
+		return &queryExpr{relative: c == '@', segments: segments}, nil
+	case c == '\'' || c == '"':
+		s, err := ps.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalExpr{s}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return ps.parseNumber()
+	case ps.hasPrefix("true"):
+		ps.pos += 4
+		return literalExpr{true}, nil
+	case ps.hasPrefix("false"):
+		ps.pos += 5
+		return literalExpr{false}, nil
+	case ps.hasPrefix("null"):
+		ps.pos += 4
+		return literalExpr{nil}, nil
+	case c >= 'a' && c <= 'z':
+		return ps.parseFunction()
+	}
+	return nil, ps.errorf("expected operand")
+}
+
+func (ps *pathParser) parseNumber() (interface{}, error) {
+	start := ps.pos
+	if ps.peek() == '-' {
+		ps.pos++
+	}
+	for ps.pos < len(ps.src) {
+		c := ps.src[ps.pos]
+		if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' ||
+			((c == '+' || c == '-') && (ps.src[ps.pos-1] == 'e' || ps.src[ps.pos-1] == 'E')) {
+			ps.pos++
+			continue
+		}
+		break
+	}
+	f, err := strconv.ParseFloat(ps.src[start:ps.pos], 64)
+	if err != nil {
+		return nil, ps.errorf("invalid number %q", ps.src[start:ps.pos])
+	}
+	return literalExpr{f}, nil
+}
+
+func (ps *pathParser) parseFunction() (interface{}, error) {
+	start := ps.pos
+	for ps.pos < len(ps.src) {
+		c := ps.src[ps.pos]
+		if (c >= 'a' && c <= 'z') || c == '_' || (c >= '0' && c <= '9') {
+			ps.pos++
+			continue
+		}
+		break
+	}
+	name := ps.src[start:ps.pos]
+	if ps.peek() != '(' {
+		return nil, ps.errorf("expected '(' after function name %q", name)
+	}
+	ps.pos++
+
+	call := &funcExpr{name: name}
+	ps.skipSpace()
+	for ps.peek() != ')' {
+		arg, err := ps.parseFunctionArg()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		ps.skipSpace()
+		if ps.peek() == ',' {
+			ps.pos++
+			ps.skipSpace()
+			continue
+		}
+		if ps.peek() != ')' {
+			return nil, ps.errorf("expected ',' or ')'")
+		}
+	}
+	ps.pos++
+
+	if err := checkFunction(call, ps); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+func (ps *pathParser) parseFunctionArg() (interface{}, error) {
+	if c := ps.peek(); c == '!' || c == '(' {
+		return ps.parseLogicalOr()
+	}
+	operand, err := ps.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	// A comparison is a logical argument
+	save := ps.pos
+	ps.skipSpace()
+	if c := ps.peek(); c == '=' || c == '!' || c == '<' || c == '>' || c == '&' || c == '|' {
+		ps.pos = save
+		return nil, ps.errorf("logical expressions as function arguments must be parenthesized")
+	}
+	ps.pos = save
+	return operand, nil
+}
+
+// checkFunction validates the arity and argument types of the functions
+// defined in RFC 9535 section 2.4.
+func checkFunction(call *funcExpr, ps *pathParser) error {
+	arity := map[string]int{"length": 1, "count": 1, "value": 1, "match": 2, "search": 2}
+	n, known := arity[call.name]
+	if !known {
+		return ps.errorf("unknown function %q", call.name)
+	}
+	if len(call.args) != n {
+		return ps.errorf("function %s expects %d argument(s)", call.name, n)
+	}
+
+	switch call.name {
+	case "count", "value":
+		if _, ok := call.args[0].(*queryExpr); !ok {
+			return ps.errorf("function %s expects a query argument", call.name)
+		}
+	case "length":
+		v, err := asComparable(call.args[0], ps)
+		if err != nil {
+			return err
+		}
+		call.args[0] = v
+	case "match", "search":
+		for i, arg := range call.args {
+			v, err := asComparable(arg, ps)
+			if err != nil {
+				return err
+			}
+			call.args[i] = v
+		}
+		// Precompile constant patterns
+		if lit, ok := call.args[1].(literalExpr); ok {
+			if pattern, ok := lit.v.(string); ok {
+				re, err := compileIRegexp(pattern, call.name == "match")
+				if err != nil {
+					return ps.errorf("invalid regular expression: %v", err)
+				}
+				call.re = re
+			}
+		}
+	}
+	return nil
+}
+
+// compileIRegexp compiles an I-Regexp (RFC 9485) pattern. match() anchors
+// the pattern to the whole string and '.' never matches line breaks.
+func compileIRegexp(pattern string, anchored bool) (*regexp.Regexp, error) {
+	if anchored {
+		pattern = `\A(?:` + pattern + `)\z`
+	}
+	return regexp.Compile(pattern)
+}
+
+// asTest turns an operand into a test expression.
+func asTest(operand interface{}, ps *pathParser) (logicalExpr, error) {
+	switch v := operand.(type) {
+	case *queryExpr:
+		return existsExpr{v}, nil
+	case *funcExpr:
+		if v.name == "match" || v.name == "search" {
+			return logicalFunc{v}, nil
+		}
+		return nil, ps.errorf("function %s cannot be used as a test", v.name)
+	}
+	return nil, ps.errorf("literal cannot be used as a test")
+}
+
+// asComparable turns an operand into a value expression. Queries must be
+// singular, i.e. select at most one node.
+func asComparable(operand interface{}, ps *pathParser) (valueExpr, error) {
+	switch v := operand.(type) {
+	case literalExpr:
+		return v, nil
+	case *queryExpr:
+		if !v.singular() {
+			return nil, ps.errorf("non-singular query used as comparable")
+		}
+		return v, nil
+	case *funcExpr:
+		if v.name == "match" || v.name == "search" {
+			return nil, ps.errorf("function %s cannot be compared", v.name)
+		}
+		return v, nil
+	}
+	return nil, ps.errorf("invalid comparable")
+}
+
+func (q *queryExpr) singular() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		switch seg.selectors[0].(type) {
+		case nameSelector, indexSelector:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,596 @@
+package json
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Match is a node selected by a Path together with its location, so that
+// callers can replace or delete it in place.
+type Match struct {
+	Value interface{}
+
+	parent *Match
+	key    string
+	index  int
+	root   *interface{}
+}
+
+// Path returns the normalized path of the node, e.g. $['a'][0].
+func (m *Match) Path() string {
+	if m.parent == nil {
+		return "$"
+	}
+	var b strings.Builder
+	b.WriteString(m.parent.Path())
+	b.WriteByte('[')
+	if _, isArray := m.parent.Value.([]interface{}); isArray {
+		b.WriteString(strconv.Itoa(m.index))
+	} else {
+		b.WriteString(normalizedName(m.key))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// IsRoot reports whether the node is the document root.
+func (m *Match) IsRoot() bool {
+	return m.parent == nil
+}
+
+// Depth returns the number of levels between the node and the root.
+func (m *Match) Depth() int {
+	depth := 0
+	for p := m.parent; p != nil; p = p.parent {
+		depth++
+	}
+	return depth
+}
+
+// Replace stores v at the node's location.
+func (m *Match) Replace(v interface{}) {
+	m.Value = v
+	if m.parent == nil {
+		*m.root = v
+		return
+	}
+	switch container := m.parent.Value.(type) {
+	case map[string]interface{}:
+		container[m.key] = v
+	case []interface{}:
+		container[m.index] = v
+	}
+}
+
+// Delete removes the node from its parent. The root cannot be deleted.
+// When deleting several elements of the same array, delete the highest
+// index first; SortForDelete orders matches accordingly.
+func (m *Match) Delete() bool {
+	if m.parent == nil {
+		return false
+	}
+	switch container := m.parent.Value.(type) {
+	case map[string]interface{}:
+		if _, exists := container[m.key]; !exists {
+			return false
+		}
+		delete(container, m.key)
+		return true
+	case []interface{}:
+		if m.index >= len(container) {
+			return false
+		}
+		updated := make([]interface{}, 0, len(container)-1)
+		updated = append(updated, container[:m.index]...)
+		updated = append(updated, container[m.index+1:]...)
+		m.parent.Replace(updated)
+		return true
+	}
+	return false
+}
+
+// SortForDelete orders matches so that deleting them one by one keeps the
+// remaining locations valid: deeper nodes first, then higher array indices.
+func SortForDelete(matches []*Match) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		di, dj := matches[i].Depth(), matches[j].Depth()
+		if di != dj {
+			return di > dj
+		}
+		return matches[i].index > matches[j].index
+	})
+}
+
+// Set stores value at every node selected by the path and returns the
+// number of locations written. When nothing is selected and the path ends in
+// a member name, the member is added to each object selected by the parent
+// path; legacy paths also create missing intermediate objects, as the dotted
+// syntax always did. A path ending in the index one past the last element
+// of an array appends to it. Every location after the first receives its own
+// copy.
+func (p *Path) Set(doc *interface{}, value interface{}) int {
+	if matches := p.Find(doc); len(matches) > 0 {
+		for i, m := range matches {
+			if i > 0 {
+				m.Replace(Clone(value))
+			} else {
+				m.Replace(value)
+			}
+		}
+		return len(matches)
+	}
+
+	if parent, index, ok := p.parentIndex(); ok {
+		written := 0
+		for _, m := range parent.Find(doc) {
+			if arr, ok := m.Value.([]interface{}); ok && index == len(arr) {
+				if written > 0 {
+					m.Replace(append(arr, Clone(value)))
+				} else {
+					m.Replace(append(arr, value))
+				}
+				written++
+			}
+		}
+		return written
+	}
+
+	parent, name, ok := p.Parent()
+	if !ok {
+		return 0
+	}
+	parents := parent.Find(doc)
+	if len(parents) == 0 && p.legacy && parent.Set(doc, map[string]interface{}{}) > 0 {
+		parents = parent.Find(doc)
+	}
+
+	written := 0
+	for _, m := range parents {
+		obj, ok := m.Value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if written > 0 {
+			obj[name] = Clone(value)
+		} else {
+			obj[name] = value
+		}
+		written++
+	}
+	return written
+}
+
+// Clone returns a deep copy of a decoded JSON value.
+func Clone(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = Clone(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = Clone(item)
+		}
+		return out
+	}
+	return v
+}
+
+func normalizedName(name string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range name {
+		switch r {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteString(strconv.FormatInt(int64(r)>>4, 16))
+				b.WriteString(strconv.FormatInt(int64(r)&0xF, 16))
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+type evalContext struct {
+	root interface{}
+}
+
+// Find returns the nodes selected by the path in *doc. The matches refer to
+// locations inside *doc and can be used to modify it.
+func (p *Path) Find(doc *interface{}) []*Match {
+	ctx := &evalContext{root: *doc}
+	nodes := []*Match{{Value: *doc, root: doc}}
+	return ctx.apply(p.segments, nodes)
+}
+
+// Query returns the values selected by the path in doc.
+func (p *Path) Query(doc interface{}) []interface{} {
+	matches := p.Find(&doc)
+	values := make([]interface{}, len(matches))
+	for i, m := range matches {
+		values[i] = m.Value
+	}
+	return values
+}
+
+// First returns the first value selected by the path, which is how legacy
+// paths are resolved.
+func (p *Path) First(doc interface{}) (interface{}, bool) {
+	matches := p.Find(&doc)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].Value, true
+}
+
+func (ctx *evalContext) apply(segments []segment, nodes []*Match) []*Match {
+	for _, seg := range segments {
+		var next []*Match
+		for _, node := range nodes {
+			if seg.descendant {
+				next = ctx.descend(seg, node, next)
+			} else {
+				next = ctx.applySelectors(seg.selectors, node, next)
+			}
+		}
+		nodes = next
+		if len(nodes) == 0 {
+			break
+		}
+	}
+	return nodes
+}
+
+func (ctx *evalContext) applySelectors(selectors []selector, node *Match, out []*Match) []*Match {
+	for _, sel := range selectors {
+		out = sel.selectFrom(ctx, node, out)
+	}
+	return out
+}
+
+// descend applies the segment's selectors to node and all its descendants
+// in document order.
+func (ctx *evalContext) descend(seg segment, node *Match, out []*Match) []*Match {
+	out = ctx.applySelectors(seg.selectors, node, out)
+	for _, child := range children(node) {
+		out = ctx.descend(seg, child, out)
+	}
+	return out
+}
+
+// children returns the direct children of node. Object members are
+// returned in key order so that results are deterministic.
+func children(node *Match) []*Match {
+	switch v := node.Value.(type) {
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		out := make([]*Match, len(keys))
+		for i, k := range keys {
+			out[i] = &Match{Value: v[k], parent: node, key: k, root: node.root}
+		}
+		return out
+	case []interface{}:
+		out := make([]*Match, len(v))
+		for i, item := range v {
+			out[i] = &Match{Value: item, parent: node, index: i, root: node.root}
+		}
+		return out
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s nameSelector) selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match {
+	if obj, ok := node.Value.(map[string]interface{}); ok {
+		if v, exists := obj[s.name]; exists {
+			out = append(out, &Match{Value: v, parent: node, key: s.name, root: node.root})
+		}
+	}
+	return out
+}
+
+func (wildcardSelector) selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match {
+	return append(out, children(node)...)
+}
+
+func (s indexSelector) selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match {
+	arr, ok := node.Value.([]interface{})
+	if !ok {
+		return out
+	}
+	i := s.index
+	if i < 0 {
+		i += len(arr)
+	}
+	if i < 0 || i >= len(arr) {
+		return out
+	}
+	return append(out, &Match{Value: arr[i], parent: node, index: i, root: node.root})
+}
+
+func (s sliceSelector) selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match {
+	arr, ok := node.Value.([]interface{})
+	if !ok || s.step == 0 {
+		return out
+	}
+	n := len(arr)
+
+	normalize := func(i int) int {
+		if i < 0 {
+			return n + i
+		}
+		return i
+	}
+	clamp := func(i, lo, hi int) int {
+		if i < lo {
+			return lo
+		}
+		if i > hi {
+			return hi
+		}
+		return i
+	}
+
+	if s.step > 0 {
+		start, end := 0, n
+		if s.start != nil {
+			start = normalize(*s.start)
+		}
+		if s.end != nil {
+			end = normalize(*s.end)
+		}
+		lower, upper := clamp(start, 0, n), clamp(end, 0, n)
+		for i := lower; i < upper; i += s.step {
+			out = append(out, &Match{Value: arr[i], parent: node, index: i, root: node.root})
+		}
+		return out
+	}
+
+	start, end := n-1, -n-1
+	if s.start != nil {
+		start = normalize(*s.start)
+	}
+	if s.end != nil {
+		end = normalize(*s.end)
+	}
+	upper, lower := clamp(start, -1, n-1), clamp(end, -1, n-1)
+	for i := upper; lower < i; i += s.step {
+		out = append(out, &Match{Value: arr[i], parent: node, index: i, root: node.root})
+	}
+	return out
+}
+
+func (s filterSelector) selectFrom(ctx *evalContext, node *Match, out []*Match) []*Match {
+	for _, child := range children(node) {
+		if s.expr.test(ctx, child.Value) {
+			out = append(out, child)
+		}
+	}
+	return out
+}
+
+// Filter expression evaluation
+
+func (e orExpr) test(ctx *evalContext, current interface{}) bool {
+	for _, term := range e.terms {
+		if term.test(ctx, current) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e andExpr) test(ctx *evalContext, current interface{}) bool {
+	for _, term := range e.terms {
+		if !term.test(ctx, current) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e notExpr) test(ctx *evalContext, current interface{}) bool {
+	return !e.expr.test(ctx, current)
+}
+
+func (e existsExpr) test(ctx *evalContext, current interface{}) bool {
+	return len(e.query.nodes(ctx, current)) > 0
+}
+
+func (e logicalFunc) test(ctx *evalContext, current interface{}) bool {
+	call := e.call
+	subject, ok := call.args[0].(valueExpr).value(ctx, current)
+	if !ok {
+		return false
+	}
+	s, ok := subject.(string)
+	if !ok {
+		return false
+	}
+
+	re := call.re
+	if re == nil {
+		p, ok := call.args[1].(valueExpr).value(ctx, current)
+		if !ok {
+			return false
+		}
+		pattern, ok := p.(string)
+		if !ok {
+			return false
+		}
+		var err error
+		if re, err = compileIRegexp(pattern, call.name == "match"); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(s)
+}
+
+func (e compareExpr) test(ctx *evalContext, current interface{}) bool {
+	l, lok := e.left.value(ctx, current)
+	r, rok := e.right.value(ctx, current)
+
+	switch e.op {
+	case "==":
+		return valuesEqual(l, lok, r, rok)
+	case "!=":
+		return !valuesEqual(l, lok, r, rok)
+	case "<":
+		return lessThan(l, lok, r, rok)
+	case ">":
+		return lessThan(r, rok, l, lok)
+	case "<=":
+		return lessThan(l, lok, r, rok) || valuesEqual(l, lok, r, rok)
+	case ">=":
+		return lessThan(r, rok, l, lok) || valuesEqual(l, lok, r, rok)
+	}
+	return false
+}
+
+// valuesEqual implements RFC 9535 equality, where two absent values
+// (Nothing) are equal to each other.
+func valuesEqual(a interface{}, aok bool, b interface{}, bok bool) bool {
+	if !aok || !bok {
+		return !aok && !bok
+	}
+	if fa, ok := toNumber(a); ok {
+		fb, ok := toNumber(b)
+		return ok && fa == fb
+	}
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			w, exists := vb[k]
+			if !exists || !valuesEqual(v, true, w, true) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !valuesEqual(va[i], true, vb[i], true) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// lessThan orders numbers and strings; any other combination is false.
+func lessThan(a interface{}, aok bool, b interface{}, bok bool) bool {
+	if !aok || !bok {
+		return false
+	}
+	if fa, ok := toNumber(a); ok {
+		fb, ok := toNumber(b)
+		return ok && fa < fb
+	}
+	sa, ok := a.(string)
+	if !ok {
+		return false
+	}
+	sb, ok := b.(string)
+	return ok && sa < sb
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func (e literalExpr) value(ctx *evalContext, current interface{}) (interface{}, bool) {
+	return e.v, true
+}
+
+func (q *queryExpr) value(ctx *evalContext, current interface{}) (interface{}, bool) {
+	nodes := q.nodes(ctx, current)
+	if len(nodes) != 1 {
+		return nil, false
+	}
+	return nodes[0].Value, true
+}
+
+func (q *queryExpr) nodes(ctx *evalContext, current interface{}) []*Match {
+	start := current
+	if !q.relative {
+		start = ctx.root
+	}
+	return ctx.apply(q.segments, []*Match{{Value: start, root: &start}})
+}
+
+func (f *funcExpr) value(ctx *evalContext, current interface{}) (interface{}, bool) {
+	switch f.name {
+	case "length":
+		v, ok := f.args[0].(valueExpr).value(ctx, current)
+		if !ok {
+			return nil, false
+		}
+		switch t := v.(type) {
+		case string:
+			return float64(utf8.RuneCountInString(t)), true
+		case []interface{}:
+			return float64(len(t)), true
+		case map[string]interface{}:
+			return float64(len(t)), true
+		}
+		return nil, false
+	case "count":
+		return float64(len(f.args[0].(*queryExpr).nodes(ctx, current))), true
+	case "value":
+		nodes := f.args[0].(*queryExpr).nodes(ctx, current)
+		if len(nodes) != 1 {
+			return nil, false
+		}
+		return nodes[0].Value, true
+	}
+	return nil, false
+}
@@ -0,0 +1,268 @@
+package json
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const storeDoc = `{
+	"store": {
+		"book": [
+			{"category": "reference", "author": "Nigel Rees", "title": "Sayings of the Century", "price": 8.95},
+			{"category": "fiction", "author": "Evelyn Waugh", "title": "Sword of Honour", "price": 12.99},
+			{"category": "fiction", "author": "Herman Melville", "title": "Moby Dick", "isbn": "0-553-21311-3", "price": 8.99},
+			{"category": "fiction", "author": "J. R. R. Tolkien", "title": "The Lord of the Rings", "isbn": "0-395-19395-8", "price": 22.99}
+		],
+		"bicycle": {"color": "red", "price": 399}
+	}
+}`
+
+func mustDecode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid test JSON: %v", err)
+	}
+	return v
+}
+
+func TestCompilePath(t *testing.T) {
+	valid := []string{
+		"$", "$.a", "$['a']", `$["a"]`, "$.a.b[0]", "$[-1]", "$[1:5:2]", "$[::-1]", "$[*]", "$.*",
+		"$..a", "$..*", "$..[0]", "$['a','b']", "$[0,2]", "$[?@.a]", "$[?(@.price < 10)]",
+		`$.items[?(@.price < 10 && @.tag == "x")]`, "$[?!@.a]", "$[?@.a || !(@.b > 1)]",
+		"$[?length(@.name) > 3]", "$[?count(@.*) == 2]", `$[?match(@.a, "a.*")]`, `$[?search(@.a, "b")]`,
+		"$[?value(@..x) == 1]", `$[?@.name =~ "^J"]`, "$[?$.limit > @.price]",
+		".", "a", ".a.b", "a[0]", "a.[0].b", `.a\.b`,
+	}
+	for _, expr := range valid {
+		if _, err := CompilePath(expr); err != nil {
+			t.Errorf("CompilePath(%q) returned error: %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"$.", "$[", "$['a'", "$[01]", "$[-0]", "$.1a", "$[?@.a == ]", "$[?@.* == 1]",
+		"$[?foo(@.a)]", "$[?length(@.a, @.b) > 1]", "$[?count(1) == 1]", "$[?1]", "$[?@.a == 1 @.b]",
+		`$[?match(@.a, "(")]`, "$a",
+	}
+	for _, expr := range invalid {
+		if _, err := CompilePath(expr); err == nil {
+			t.Errorf("CompilePath(%q) should fail", expr)
+		}
+	}
+}
+
+func TestCompilePathCache(t *testing.T) {
+	a := MustCompilePath("$.cached.path")
+	b := MustCompilePath("$.cached.path")
+	if a != b {
+		t.Error("compiling the same expression twice should return the cached AST")
+	}
+}
+
+func TestPathQuery(t *testing.T) {
+	doc := mustDecode(t, storeDoc)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"$.store.book[*].author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$..author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$.store..price", `[399,8.95,12.99,8.99,22.99]`},
+		{"$..book[2].title", `["Moby Dick"]`},
+		{"$..book[-1].title", `["The Lord of the Rings"]`},
+		{"$..book[0,1].title", `["Sayings of the Century","Sword of Honour"]`},
+		{"$..book[:2].title", `["Sayings of the Century","Sword of Honour"]`},
+		{"$..book[::-2].title", `["The Lord of the Rings","Sword of Honour"]`},
+		{"$..book[1:3:1].price", `[12.99,8.99]`},
+		{"$..book[?@.isbn].title", `["Moby Dick","The Lord of the Rings"]`},
+		{"$..book[?(@.price < 10)].title", `["Sayings of the Century","Moby Dick"]`},
+		{`$..book[?(@.price < 10 && @.category == "fiction")].title`, `["Moby Dick"]`},
+		{`$..book[?@.price > 20 || @.author == "Nigel Rees"].price`, `[8.95,22.99]`},
+		{"$..book[?!@.isbn].title", `["Sayings of the Century","Sword of Honour"]`},
+		{"$..book[?@.price < $.store.bicycle.price && @.price > 20].title", `["The Lord of the Rings"]`},
+		{`$..book[?match(@.author, "J.*")].author`, `["J. R. R. Tolkien"]`},
+		{`$..book[?search(@.title, "of")].title`, `["Sayings of the Century","Sword of Honour","The Lord of the Rings"]`},
+		{`$..book[?@.title =~ "^S"].title`, `["Sayings of the Century","Sword of Honour"]`},
+		{"$..book[?length(@.title) == 9].title", `["Moby Dick"]`},
+		{"$.store[?count(@.*) == 2].color", `["red"]`},
+		{"$.store.bicycle['color','price']", `["red",399]`},
+		{"$.store.missing", `[]`},
+		{"$..book[10]", `[]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := CompilePath(tt.path)
+			if err != nil {
+				t.Fatalf("CompilePath() error = %v", err)
+			}
+			got := p.Query(doc)
+			if got == nil {
+				got = []interface{}{}
+			}
+			want := mustDecode(t, tt.expected)
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("Query() = %s, want %s", gotJSON, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPathComparisonSemantics(t *testing.T) {
+	doc := mustDecode(t, `[{"a": 1}, {"a": "1"}, {"a": null}, {"a": [1]}, {"b": 1}, {"a": {"x": 1}}]`)
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"$[?@.a == 1]", 1},
+		{`$[?@.a == "1"]`, 1},
+		{"$[?@.a == null]", 1},
+		{"$[?@.a == @.b]", 0},
+		{"$[?@.a < 2]", 1},
+		{"$[?@.a <= 1]", 1},
+		{"$[?@.a != 1]", 5},
+		{"$[?@.a == $[3].a]", 1},
+		{"$[?@.x == @.y]", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := MustCompilePath(tt.path).Query(doc)
+			if len(got) != tt.expected {
+				t.Errorf("Query(%q) returned %d matches, want %d", tt.path, len(got), tt.expected)
+			}
+		})
+	}
+}
+
+func TestLegacyPath(t *testing.T) {
+	doc := mustDecode(t, `{"a": {"b": [10, 20, {"c": "x"}]}, "d.e": 1}`)
+
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{".", doc},
+		{"a.b[1]", float64(20)},
+		{".a.b[2].c", "x"},
+		{"a.b.[0]", float64(10)},
+		{`d\.e`, float64(1)},
+	}
+	for _, tt := range tests {
+		p := MustCompilePath(tt.path)
+		if !p.IsLegacy() {
+			t.Errorf("%q should be a legacy path", tt.path)
+		}
+		got, ok := p.First(doc)
+		if !ok || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("First(%q) = %v, %v; want %v", tt.path, got, ok, tt.expected)
+		}
+	}
+
+	if _, ok := MustCompilePath(".a.missing").First(doc); ok {
+		t.Error("First() on a missing member should report no match")
+	}
+	if MustCompilePath("$.a").IsLegacy() {
+		t.Error("$ paths are not legacy paths")
+	}
+}
+
+func TestMatchModification(t *testing.T) {
+	t.Run("replace", func(t *testing.T) {
+		doc := mustDecode(t, `{"items": [{"n": 1}, {"n": 2}, {"n": 3}]}`)
+		for _, m := range MustCompilePath("$.items[?@.n > 1].n").Find(&doc) {
+			m.Replace(m.Value.(float64) * 10)
+		}
+		want := mustDecode(t, `{"items": [{"n": 1}, {"n": 20}, {"n": 30}]}`)
+		if !reflect.DeepEqual(doc, want) {
+			t.Errorf("unexpected document after replace: %v", doc)
+		}
+	})
+
+	t.Run("replace root", func(t *testing.T) {
+		doc := mustDecode(t, `{"a": 1}`)
+		MustCompilePath("$").Find(&doc)[0].Replace("new")
+		if doc != "new" {
+			t.Errorf("root replace failed: %v", doc)
+		}
+	})
+
+	t.Run("delete array elements", func(t *testing.T) {
+		doc := mustDecode(t, `{"a": [1, 2, 3, 4, 5], "b": {"c": 1, "d": 2}}`)
+		matches := MustCompilePath("$.a[?@ > 1 && @ < 5]").Find(&doc)
+		SortForDelete(matches)
+		for _, m := range matches {
+			if !m.Delete() {
+				t.Errorf("Delete(%s) failed", m.Path())
+			}
+		}
+		for _, m := range MustCompilePath("$.b.c").Find(&doc) {
+			m.Delete()
+		}
+		want := mustDecode(t, `{"a": [1, 5], "b": {"d": 2}}`)
+		if !reflect.DeepEqual(doc, want) {
+			t.Errorf("unexpected document after delete: %v", doc)
+		}
+	})
+
+	t.Run("normalized path", func(t *testing.T) {
+		doc := mustDecode(t, `{"a": [{"it's": true}]}`)
+		matches := MustCompilePath("$..*").Find(&doc)
+		got := make([]string, len(matches))
+		for i, m := range matches {
+			got[i] = m.Path()
+		}
+		want := []string{"$['a']", "$['a'][0]", `$['a'][0]['it\'s']`}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Path() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestPathSet(t *testing.T) {
+	tests := []struct {
+		doc      string
+		path     string
+		written  int
+		expected string
+	}{
+		{`{"a": [{"x": 1}, {"x": 2}]}`, "$.a[*].x", 2, `{"a": [{"x": 0}, {"x": 0}]}`},
+		{`{"a": [{"x": 1}, {}]}`, "$.a[*].y", 2, `{"a": [{"x": 1, "y": 0}, {"y": 0}]}`},
+		{`{"a": 1}`, "$.b.c", 0, `{"a": 1}`},
+		{`{"a": 1}`, "b.c", 1, `{"a": 1, "b": {"c": 0}}`},
+		{`{"a": 1}`, "a.c", 0, `{"a": 1}`},
+		{`[1, 2]`, "$[5]", 0, `[1, 2]`},
+		{`[1, 2]`, "$[2]", 1, `[1, 2, 0]`},
+		{`{"a": [[1], []]}`, "$.a[*][1]", 1, `{"a": [[1, 0], []]}`},
+		{`{"a": [1]}`, "a[1]", 1, `{"a": [1, 0]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			doc := mustDecode(t, tt.doc)
+			if n := MustCompilePath(tt.path).Set(&doc, float64(0)); n != tt.written {
+				t.Errorf("Set() wrote %d locations, want %d", n, tt.written)
+			}
+			if want := mustDecode(t, tt.expected); !reflect.DeepEqual(doc, want) {
+				t.Errorf("unexpected document after Set: %v", doc)
+			}
+		})
+	}
+}
+
+func TestPathParent(t *testing.T) {
+	parent, name, ok := MustCompilePath("$.a.b").Parent()
+	if !ok || name != "b" || parent.String() != "$.a.b" || len(parent.segments) != 1 {
+		t.Errorf("Parent() = %v, %q, %v", parent, name, ok)
+	}
+	if _, _, ok := MustCompilePath("$.a[0]").Parent(); ok {
+		t.Error("Parent() should reject index selectors")
+	}
+	if _, _, ok := MustCompilePath("$").Parent(); ok {
+		t.Error("Parent() of the root should fail")
+	}
+}
@@ -126,29 +126,29 @@ func (m *Merge) MergeMultipleWithOptions(opts *MergeOptions, objects ...map[stri
 
 // MergePatch applies a JSON merge patch according to RFC 7396
 func (m *Merge) MergePatch(target, patch map[string]interface{}) map[string]interface{} {
-	result := make(map[string]interface{})
+	return m.MergePatchValue(target, patch).(map[string]interface{})
+}
 
-	// Copy target
-	for k, v := range target {
-		result[k] = v
+// MergePatchValue applies patch to a value of any type as an RFC 7396 merge
+// patch: objects are merged member by member, null members are removed and
+// any other patch value replaces the target. target is not modified.
+func (m *Merge) MergePatchValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
 	}
 
-	// Apply patch
-	for k, v := range patch {
+	targetObj, _ := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetObj)+len(patchObj))
+	for k, v := range targetObj {
+		result[k] = v
+	}
+	for k, v := range patchObj {
 		if v == nil {
 			delete(result, k)
-		} else if targetVal, exists := target[k]; exists {
-			if targetMap, isTargetMap := targetVal.(map[string]interface{}); isTargetMap {
-				if patchMap, isPatchMap := v.(map[string]interface{}); isPatchMap {
-					result[k] = m.MergePatch(targetMap, patchMap)
-					continue
-				}
-			}
-			result[k] = v
-		} else {
-			result[k] = v
+			continue
 		}
+		result[k] = m.MergePatchValue(result[k], v)
 	}
-
 	return result
 }
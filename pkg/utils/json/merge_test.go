@@ -203,6 +203,24 @@ func TestMergePatch(t *testing.T) {
 				"nested": map[string]interface{}{"a": 1, "b": 3, "c": 4},
 			},
 		},
+		{
+			name:     "Nulls removed from new members",
+			target:   map[string]interface{}{"a": 1},
+			patch:    map[string]interface{}{"b": map[string]interface{}{"c": nil, "d": 2}},
+			expected: map[string]interface{}{"a": 1, "b": map[string]interface{}{"d": 2}},
+		},
+		{
+			name:     "Object replaces scalar",
+			target:   map[string]interface{}{"a": "x"},
+			patch:    map[string]interface{}{"a": map[string]interface{}{"b": 1}},
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": 1}},
+		},
+		{
+			name:     "Arrays are replaced",
+			target:   map[string]interface{}{"a": []interface{}{1, 2}},
+			patch:    map[string]interface{}{"a": []interface{}{3}},
+			expected: map[string]interface{}{"a": []interface{}{3}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -214,3 +232,22 @@ func TestMergePatch(t *testing.T) {
 		})
 	}
 }
+
+func TestMergePatchValue(t *testing.T) {
+	merge := NewMerge()
+
+	// Non-object patches replace the target, non-object targets become objects
+	if got := merge.MergePatchValue(map[string]interface{}{"a": 1}, "x"); got != "x" {
+		t.Errorf("MergePatchValue() = %v, want x", got)
+	}
+	got := merge.MergePatchValue([]interface{}{1}, map[string]interface{}{"a": 1})
+	if !reflect.DeepEqual(got, map[string]interface{}{"a": 1}) {
+		t.Errorf("MergePatchValue() = %v", got)
+	}
+
+	target := map[string]interface{}{"a": 1}
+	merge.MergePatchValue(target, map[string]interface{}{"a": nil})
+	if _, ok := target["a"]; !ok {
+		t.Error("MergePatchValue() modified the target")
+	}
+}
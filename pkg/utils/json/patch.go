@@ -0,0 +1,284 @@
+package json
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch.
+type PatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// DecodePatch parses a JSON Patch document, an array of operations.
+func DecodePatch(data []byte) ([]PatchOperation, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("patch must be an array of operation objects")
+	}
+
+	ops := make([]PatchOperation, len(raw))
+	for i, fields := range raw {
+		op := &ops[i]
+		str := func(name string) (string, error) {
+			v, ok := fields[name]
+			if !ok {
+				return "", fmt.Errorf("operation %d is missing %q", i, name)
+			}
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				return "", fmt.Errorf("operation %d: %q must be a string", i, name)
+			}
+			return s, nil
+		}
+
+		var err error
+		if op.Op, err = str("op"); err != nil {
+			return nil, err
+		}
+		if op.Path, err = str("path"); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			v, ok := fields["value"]
+			if !ok {
+				return nil, fmt.Errorf("operation %d is missing %q", i, "value")
+			}
+			if err := json.Unmarshal(v, &op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: invalid value", i)
+			}
+		case "move", "copy":
+			if op.From, err = str("from"); err != nil {
+				return nil, err
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// ApplyPatch applies ops in order to a copy of doc and returns the result.
+// The patch is atomic: if any operation fails, the error names it and doc
+// is left unchanged.
+func ApplyPatch(doc interface{}, ops []PatchOperation) (interface{}, error) {
+	doc = Clone(doc)
+	for i, op := range ops {
+		var err error
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc interface{}, op PatchOperation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, Clone(op.Value))
+	case "remove":
+		if len(path) == 0 {
+			return nil, fmt.Errorf("cannot remove the root")
+		}
+		_, doc, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return Clone(op.Value), nil
+		}
+		_, doc, err := pointerRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, Clone(op.Value))
+	case "test":
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !valuesEqual(v, true, op.Value, true) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	}
+
+	from, err := parsePointer(op.From)
+	if err != nil {
+		return nil, err
+	}
+	if op.Op == "copy" {
+		v, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, Clone(v))
+	}
+
+	// move
+	if op.From == op.Path {
+		_, err := pointerGet(doc, from)
+		return doc, err
+	}
+	if strings.HasPrefix(op.Path, op.From+"/") {
+		return nil, fmt.Errorf("cannot move a value into one of its children")
+	}
+	v, doc, err := pointerRemove(doc, from)
+	if err != nil {
+		return nil, err
+	}
+	return pointerAdd(doc, path, v)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i, tok := range tokens {
+		if !isJSONPointer("/" + tok) {
+			return nil, fmt.Errorf("invalid JSON pointer %q", ptr)
+		}
+		tokens[i] = unescape.Replace(tok)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses a pointer token as an index into an array of length n.
+// With allowEnd, "-" and n address the position after the last element.
+func arrayIndex(tok string, n int, allowEnd bool) (int, error) {
+	if tok == "-" && allowEnd {
+		return n, nil
+	}
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	if i > n || (i == n && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[tok]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", tok)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(tok, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot traverse a %s", typeName(doc))
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd inserts value at path and returns the updated document. Arrays
+// grow by one element; existing object members are replaced.
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		grown := make([]interface{}, 0, len(node)+1)
+		grown = append(grown, node[:i]...)
+		grown = append(grown, value)
+		grown = append(grown, node[i:]...)
+		return replaceAt(doc, path[:len(path)-1], grown), nil
+	}
+	return nil, fmt.Errorf("cannot add a member to a %s", typeName(parent))
+}
+
+// pointerRemove deletes the value at a non-root path and returns it along
+// with the updated document.
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(node, last)
+		return v, doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		shrunk := make([]interface{}, 0, len(node)-1)
+		shrunk = append(shrunk, node[:i]...)
+		shrunk = append(shrunk, node[i+1:]...)
+		return v, replaceAt(doc, path[:len(path)-1], shrunk), nil
+	}
+	return nil, nil, fmt.Errorf("cannot remove from a %s", typeName(parent))
+}
+
+// replaceAt stores value at an existing path and returns the document.
+func replaceAt(doc interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+	parent, _ := pointerGet(doc, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		i, _ := arrayIndex(last, len(node), false)
+		node[i] = value
+	}
+	return doc
+}
@@ -0,0 +1,89 @@
+package json
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		patch    string
+		expected string
+		wantErr  bool
+	}{
+		{"Add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{"Add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{"Append with dash", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":[2]}]`, `{"foo":[1,[2]]}`, false},
+		{"Remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, false},
+		{"Remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{"Replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{"Replace root", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, false},
+		{"Move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{"Move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, false},
+		{"Copy", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, false},
+		{"Test passes", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, false},
+		{"Escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, false},
+		{"Null value", `{}`, `[{"op":"add","path":"/a","value":null}]`, `{"a":null}`, false},
+		{"Test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ``, true},
+		{"Add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ``, true},
+		{"Remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, ``, true},
+		{"Index out of range", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":1}]`, ``, true},
+		{"Leading zero index", `{"foo":[1,2]}`, `[{"op":"replace","path":"/foo/01","value":1}]`, ``, true},
+		{"Move into child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ``, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := mustDecode(t, tt.doc)
+			ops, err := DecodePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("DecodePatch() error = %v", err)
+			}
+			result, err := ApplyPatch(doc, ops)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(result, mustDecode(t, tt.expected)) {
+				t.Errorf("ApplyPatch() = %v, want %s", result, tt.expected)
+			}
+			if !reflect.DeepEqual(doc, mustDecode(t, tt.doc)) {
+				t.Errorf("ApplyPatch() modified its input: %v", doc)
+			}
+		})
+	}
+}
+
+func TestApplyPatchRollback(t *testing.T) {
+	doc := mustDecode(t, `{"a":[1,2],"b":1}`)
+	ops, err := DecodePatch([]byte(`[{"op":"remove","path":"/a/0"},{"op":"add","path":"/c","value":3},{"op":"test","path":"/b","value":2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyPatch(doc, ops); err == nil || err.Error() != "operation 2 (test /b): test failed" {
+		t.Fatalf("ApplyPatch() error = %v", err)
+	}
+	if !reflect.DeepEqual(doc, mustDecode(t, `{"a":[1,2],"b":1}`)) {
+		t.Errorf("failed patch left changes behind: %v", doc)
+	}
+}
+
+func TestDecodePatchErrors(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add"}`,
+		`[{"path":"/a"}]`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"move","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove","path":5}]`,
+	} {
+		if _, err := DecodePatch([]byte(patch)); err == nil {
+			t.Errorf("DecodePatch(%s) succeeded, want error", patch)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultBaseURI identifies schemas that do not declare an $id.
+const defaultBaseURI = "urn:crystalcache:schema"
+
+// Schema is a JSON Schema (draft 2020-12). Boolean schemas decode with
+// Always set. A schema must be compiled before use, which resolves $ref
+// and $dynamicRef and compiles patterns; Validate does so on first use.
+type Schema struct {
+	Always *bool `json:"-"`
+
+	ID            string             `json:"$id,omitempty"`
+	Ref           string             `json:"$ref,omitempty"`
+	DynamicRef    string             `json:"$dynamicRef,omitempty"`
+	Anchor        string             `json:"$anchor,omitempty"`
+	DynamicAnchor string             `json:"$dynamicAnchor,omitempty"`
+	Defs          map[string]*Schema `json:"$defs,omitempty"`
+	Definitions   map[string]*Schema `json:"definitions,omitempty"`
+
+	Type  SchemaType    `json:"-"`
+	Types []SchemaType  `json:"-"` // set instead of Type for a list of types
+	Enum  []interface{} `json:"enum,omitempty"`
+	Const *interface{}  `json:"const,omitempty"`
+
+	MultipleOf       *float64 `json:"multipleOf,omitempty"`
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+
+	MinLength *int    `json:"minLength,omitempty"`
+	MaxLength *int    `json:"maxLength,omitempty"`
+	Pattern   *string `json:"pattern,omitempty"`
+	Format    string  `json:"format,omitempty"`
+
+	PrefixItems      []*Schema `json:"prefixItems,omitempty"`
+	Items            *Schema   `json:"-"`
+	Contains         *Schema   `json:"contains,omitempty"`
+	MinContains      *int      `json:"minContains,omitempty"`
+	MaxContains      *int      `json:"maxContains,omitempty"`
+	MinItems         *int      `json:"minItems,omitempty"`
+	MaxItems         *int      `json:"maxItems,omitempty"`
+	UniqueItems      bool      `json:"uniqueItems,omitempty"`
+	UnevaluatedItems *Schema   `json:"unevaluatedItems,omitempty"`
+
+	Properties            map[string]*Schema  `json:"properties,omitempty"`
+	PatternProperties     map[string]*Schema  `json:"patternProperties,omitempty"`
+	AdditionalProperties  *Schema             `json:"additionalProperties,omitempty"`
+	PropertyNames         *Schema             `json:"propertyNames,omitempty"`
+	UnevaluatedProperties *Schema             `json:"unevaluatedProperties,omitempty"`
+	Required              []string            `json:"required,omitempty"`
+	DependentRequired     map[string][]string `json:"dependentRequired,omitempty"`
+	DependentSchemas      map[string]*Schema  `json:"dependentSchemas,omitempty"`
+	MinProperties         *int                `json:"minProperties,omitempty"`
+	MaxProperties         *int                `json:"maxProperties,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+	If    *Schema   `json:"if,omitempty"`
+	Then  *Schema   `json:"then,omitempty"`
+	Else  *Schema   `json:"else,omitempty"`
+
+	source   string
+	compiled bool
+	base     *url.URL
+	resource *Schema // enclosing schema resource, the root or an $id
+	anchors  map[string]*Schema
+	dynamic  map[string]*Schema // $dynamicAnchor targets of a resource
+
+	ref         *Schema
+	dynamicRef  *Schema
+	pattern     *regexp.Regexp
+	patternKeys map[string]*regexp.Regexp
+}
+
+// CompileSchema decodes and compiles a schema document.
+func CompileSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	s.source = string(data)
+	return &s, nil
+}
+
+// Source returns the document a schema was compiled from.
+func (s *Schema) Source() string {
+	return s.source
+}
+
+// UnmarshalJSON decodes boolean schemas, type lists and the pre-2020
+// array form of items.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("true")) || bytes.Equal(data, []byte("false")) {
+		always := data[0] == 't'
+		*s = Schema{Always: &always}
+		return nil
+	}
+
+	type plain Schema
+	var raw struct {
+		*plain
+		Type            json.RawMessage `json:"type"`
+		Items           json.RawMessage `json:"items"`
+		AdditionalItems *Schema         `json:"additionalItems"`
+		Const           json.RawMessage `json:"const"`
+	}
+	raw.plain = (*plain)(s)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw.Type) > 0 {
+		if raw.Type[0] == '[' {
+			if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+				return fmt.Errorf("type must be a string or an array of strings")
+			}
+		} else if err := json.Unmarshal(raw.Type, &s.Type); err != nil {
+			return fmt.Errorf("type must be a string or an array of strings")
+		}
+	}
+
+	if len(raw.Items) > 0 {
+		if raw.Items[0] == '[' {
+			if err := json.Unmarshal(raw.Items, &s.PrefixItems); err != nil {
+				return err
+			}
+			s.Items = raw.AdditionalItems
+		} else {
+			s.Items = &Schema{}
+			if err := json.Unmarshal(raw.Items, s.Items); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(raw.Const) > 0 {
+		var c interface{}
+		if err := json.Unmarshal(raw.Const, &c); err != nil {
+			return err
+		}
+		s.Const = &c
+	}
+	return nil
+}
+
+// schemaRegistry maps absolute URIs to the schemas they identify while a
+// document is compiled.
+type schemaRegistry map[string]*Schema
+
+// Compile prepares s as a root schema. It is a no-op for compiled schemas.
+func (s *Schema) Compile() error {
+	if s.compiled {
+		return nil
+	}
+	base, _ := url.Parse(defaultBaseURI)
+	registry := schemaRegistry{}
+	if err := registry.scan(s, base, s); err != nil {
+		return err
+	}
+	if err := registry.resolve(s, map[*Schema]bool{}); err != nil {
+		return err
+	}
+	s.compiled = true
+	return nil
+}
+
+// subschemas calls fn for every schema directly nested in s.
+func (s *Schema) subschemas(fn func(*Schema)) {
+	visit := func(list ...*Schema) {
+		for _, sub := range list {
+			if sub != nil {
+				fn(sub)
+			}
+		}
+	}
+	visitMap := func(m map[string]*Schema) {
+		for _, sub := range m {
+			visit(sub)
+		}
+	}
+	visitMap(s.Defs)
+	visitMap(s.Definitions)
+	visitMap(s.Properties)
+	visitMap(s.PatternProperties)
+	visitMap(s.DependentSchemas)
+	visit(s.PrefixItems...)
+	visit(s.AllOf...)
+	visit(s.AnyOf...)
+	visit(s.OneOf...)
+	visit(s.Items, s.Contains, s.UnevaluatedItems, s.AdditionalProperties, s.PropertyNames,
+		s.UnevaluatedProperties, s.Not, s.If, s.Then, s.Else)
+}
+
+// scan records the base URI and resource of every schema, registers $id
+// and anchors, and compiles patterns.
+func (r schemaRegistry) scan(s *Schema, base *url.URL, resource *Schema) error {
+	if s.ID != "" {
+		id, err := url.Parse(s.ID)
+		if err != nil {
+			return fmt.Errorf("invalid $id %q", s.ID)
+		}
+		base = base.ResolveReference(id)
+		base.Fragment = ""
+		resource = s
+	}
+	s.base, s.resource = base, resource
+	if s == resource {
+		r[base.String()] = s
+	}
+
+	if s.Anchor != "" {
+		resource.addAnchor(s.Anchor, s)
+	}
+	if s.DynamicAnchor != "" {
+		resource.addAnchor(s.DynamicAnchor, s)
+		if resource.dynamic == nil {
+			resource.dynamic = make(map[string]*Schema)
+		}
+		resource.dynamic[s.DynamicAnchor] = s
+	}
+
+	if s.Pattern != nil {
+		re, err := regexp.Compile(*s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", *s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if len(s.PatternProperties) > 0 {
+		s.patternKeys = make(map[string]*regexp.Regexp, len(s.PatternProperties))
+		for expr := range s.PatternProperties {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("invalid patternProperties key %q: %v", expr, err)
+			}
+			s.patternKeys[expr] = re
+		}
+	}
+
+	var err error
+	s.subschemas(func(sub *Schema) {
+		if err == nil {
+			err = r.scan(sub, base, resource)
+		}
+	})
+	return err
+}
+
+func (s *Schema) addAnchor(name string, target *Schema) {
+	if s.anchors == nil {
+		s.anchors = make(map[string]*Schema)
+	}
+	s.anchors[name] = target
+}
+
+// resolve links every $ref and $dynamicRef to its target.
+func (r schemaRegistry) resolve(s *Schema, seen map[*Schema]bool) error {
+	if seen[s] {
+		return nil
+	}
+	seen[s] = true
+
+	if s.Ref != "" {
+		target, err := r.lookup(s.base, s.Ref)
+		if err != nil {
+			return err
+		}
+		s.ref = target
+	}
+	if s.DynamicRef != "" {
+		target, err := r.lookup(s.base, s.DynamicRef)
+		if err != nil {
+			return err
+		}
+		s.dynamicRef = target
+	}
+
+	var err error
+	s.subschemas(func(sub *Schema) {
+		if err == nil {
+			err = r.resolve(sub, seen)
+		}
+	})
+	return err
+}
+
+// lookup finds the schema a reference points to: a resource, a JSON
+// pointer into one or a named anchor.
+func (r schemaRegistry) lookup(base *url.URL, ref string) (*Schema, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q", ref)
+	}
+	target := base.ResolveReference(u)
+	fragment := target.Fragment
+	target.Fragment = ""
+
+	resource, ok := r[target.String()]
+	if !ok {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	if fragment == "" {
+		return resource, nil
+	}
+	if !strings.HasPrefix(fragment, "/") {
+		if s, ok := resource.anchors[fragment]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+
+	s := resource
+	tokens := strings.Split(fragment[1:], "/")
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	for i := range tokens {
+		tokens[i] = unescape.Replace(tokens[i])
+	}
+	for len(tokens) > 0 && s != nil {
+		var n int
+		s, n = s.child(tokens)
+		tokens = tokens[n:]
+	}
+	if s == nil {
+		return nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return s, nil
+}
+
+// child follows the first one or two tokens of a JSON pointer into s and
+// returns the schema reached with the number of tokens used.
+func (s *Schema) child(tokens []string) (*Schema, int) {
+	keyed := func(m map[string]*Schema) (*Schema, int) {
+		if len(tokens) < 2 {
+			return nil, 0
+		}
+		return m[tokens[1]], 2
+	}
+	indexed := func(list []*Schema) (*Schema, int) {
+		if len(tokens) < 2 {
+			return nil, 0
+		}
+		i, err := strconv.Atoi(tokens[1])
+		if err != nil || i < 0 || i >= len(list) {
+			return nil, 0
+		}
+		return list[i], 2
+	}
+
+	switch tokens[0] {
+	case "$defs":
+		return keyed(s.Defs)
+	case "definitions":
+		return keyed(s.Definitions)
+	case "properties":
+		return keyed(s.Properties)
+	case "patternProperties":
+		return keyed(s.PatternProperties)
+	case "dependentSchemas":
+		return keyed(s.DependentSchemas)
+	case "prefixItems":
+		return indexed(s.PrefixItems)
+	case "allOf":
+		return indexed(s.AllOf)
+	case "anyOf":
+		return indexed(s.AnyOf)
+	case "oneOf":
+		return indexed(s.OneOf)
+	case "items":
+		return s.Items, 1
+	case "contains":
+		return s.Contains, 1
+	case "unevaluatedItems":
+		return s.UnevaluatedItems, 1
+	case "additionalProperties":
+		return s.AdditionalProperties, 1
+	case "propertyNames":
+		return s.PropertyNames, 1
+	case "unevaluatedProperties":
+		return s.UnevaluatedProperties, 1
+	case "not":
+		return s.Not, 1
+	case "if":
+		return s.If, 1
+	case "then":
+		return s.Then, 1
+	case "else":
+		return s.Else, 1
+	}
+	return nil, 0
+}
@@ -0,0 +1,160 @@
+package json
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		valid    bool
+		path     string
+	}{
+		{"Boolean true", `true`, `{"a":1}`, true, ""},
+		{"Boolean false", `false`, `1`, false, "$"},
+		{"Type list", `{"type":["string","null"]}`, `null`, true, ""},
+		{"Type list mismatch", `{"type":["string","null"]}`, `1`, false, "$"},
+		{"Integer accepts whole float", `{"type":"integer"}`, `2.0`, true, ""},
+		{"Integer rejects fraction", `{"type":"integer"}`, `2.5`, false, "$"},
+		{"Const", `{"const":{"a":[1,2]}}`, `{"a":[1.0,2]}`, true, ""},
+		{"Const null", `{"const":null}`, `0`, false, "$"},
+		{"Enum", `{"enum":["a",1,null]}`, `"b"`, false, "$"},
+		{"Exclusive bounds", `{"exclusiveMinimum":0,"exclusiveMaximum":10}`, `10`, false, "$"},
+		{"Multiple of", `{"multipleOf":0.01}`, `19.99`, true, ""},
+		{"Not multiple of", `{"multipleOf":3}`, `10`, false, "$"},
+		{"Length counts code points", `{"maxLength":2}`, `"éé"`, true, ""},
+		{"Pattern", `{"properties":{"zip":{"pattern":"^[0-9]{5}$"}}}`, `{"zip":"1234"}`, false, "$.zip"},
+		{"Format email", `{"format":"email"}`, `"not-an-email"`, false, "$"},
+		{"Format date-time", `{"format":"date-time"}`, `"2024-02-29T12:00:00.5+02:00"`, true, ""},
+		{"Format date", `{"format":"date"}`, `"2023-02-29"`, false, "$"},
+		{"Format ipv4", `{"format":"ipv4"}`, `"192.168.0.256"`, false, "$"},
+		{"Format uuid", `{"format":"uuid"}`, `"2eb8aa08-aa98-11ea-b4aa-73b441d16380"`, true, ""},
+		{"Format duration", `{"format":"duration"}`, `"PT"`, false, "$"},
+		{"Unknown format", `{"format":"color"}`, `"red"`, true, ""},
+		{"Min properties", `{"minProperties":2}`, `{"a":1}`, false, "$"},
+		{"Required path", `{"properties":{"a":{"required":["b c"]}}}`, `{"a":{}}`, false, "$.a['b c']"},
+		{"Dependent required", `{"dependentRequired":{"card":["billing"]}}`, `{"card":1}`, false, "$.billing"},
+		{"Dependent schemas", `{"dependentSchemas":{"card":{"required":["cvv"]}}}`, `{"card":1,"cvv":2}`, true, ""},
+		{"Property names", `{"propertyNames":{"maxLength":3}}`, `{"abcd":1}`, false, "$.abcd"},
+		{"Pattern properties", `{"patternProperties":{"^n_":{"type":"number"}},"additionalProperties":false}`, `{"n_a":"x"}`, false, "$.n_a"},
+		{"Additional properties false", `{"properties":{"a":{}},"additionalProperties":false}`, `{"a":1,"b":2}`, false, "$.b"},
+		{"Additional properties schema", `{"additionalProperties":{"type":"string"}}`, `{"a":"x","b":"y"}`, true, ""},
+		{"Prefix items", `{"prefixItems":[{"type":"string"},{"type":"number"}],"items":false}`, `["a",1,true]`, false, "$[2]"},
+		{"Legacy tuple items", `{"items":[{"type":"string"}],"additionalItems":{"type":"number"}}`, `["a",1,"b"]`, false, "$[2]"},
+		{"Contains", `{"contains":{"type":"number"},"minContains":2}`, `["a",1]`, false, "$"},
+		{"Max contains", `{"contains":{"type":"number"},"maxContains":1}`, `[1,"a"]`, true, ""},
+		{"Unique items", `{"uniqueItems":true}`, `[{"a":1},{"a":1.0}]`, false, "$[1]"},
+		{"All of", `{"allOf":[{"minimum":1},{"maximum":5}]}`, `6`, false, "$"},
+		{"Any of", `{"anyOf":[{"type":"string"},{"minimum":10}]}`, `11`, true, ""},
+		{"Any of none", `{"anyOf":[{"type":"string"},{"minimum":10}]}`, `9`, false, "$"},
+		{"One of both", `{"oneOf":[{"minimum":1},{"maximum":5}]}`, `3`, false, "$"},
+		{"One of single", `{"oneOf":[{"minimum":1},{"maximum":5}]}`, `6`, true, ""},
+		{"Not", `{"not":{"type":"null"}}`, `null`, false, "$"},
+		{"If then", `{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"a","y":1}`, false, "$.x"},
+		{"If else", `{"if":{"properties":{"kind":{"const":"a"}}},"then":{"required":["x"]},"else":{"required":["y"]}}`, `{"kind":"b","y":1}`, true, ""},
+		{"Unevaluated properties", `{"allOf":[{"properties":{"a":{}}}],"unevaluatedProperties":false}`, `{"a":1,"b":2}`, false, "$.b"},
+		{"Unevaluated sees passing anyOf", `{"anyOf":[{"properties":{"a":{"type":"number"}}},{"properties":{"b":{}}}],"unevaluatedProperties":false}`, `{"a":"x","b":1}`, false, "$.a"},
+		{"Unevaluated through if", `{"if":{"properties":{"a":{"const":1}}},"then":{"properties":{"b":{}}},"unevaluatedProperties":false}`, `{"a":1,"b":2}`, true, ""},
+		{"Unevaluated through ref", `{"$defs":{"base":{"properties":{"a":{}}}},"$ref":"#/$defs/base","unevaluatedProperties":false}`, `{"a":1}`, true, ""},
+		{"Unevaluated items", `{"prefixItems":[{}],"allOf":[{"contains":{"const":"x"}}],"unevaluatedItems":false}`, `[1,"x",2]`, false, "$[2]"},
+		{"Nested path", `{"properties":{"items":{"items":{"properties":{"qty":{"minimum":1}}}}}}`, `{"items":[{"qty":1},{"qty":0}]}`, false, "$.items[1].qty"},
+	}
+
+	validator := NewValidationUtil()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := CompileSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("CompileSchema() error = %v", err)
+			}
+			var instance interface{}
+			if err := json.Unmarshal([]byte(tt.instance), &instance); err != nil {
+				t.Fatal(err)
+			}
+
+			err = validator.Validate(instance, schema)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Validate() error = %v, valid %v", err, tt.valid)
+			}
+			if err != nil && err.(*ValidationError).Path != tt.path {
+				t.Errorf("error path = %q, want %q (%v)", err.(*ValidationError).Path, tt.path, err)
+			}
+		})
+	}
+}
+
+func TestSchemaReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		instance string
+		valid    bool
+	}{
+		{"Defs", `{"$defs":{"pos":{"minimum":0}},"properties":{"n":{"$ref":"#/$defs/pos"}}}`, `{"n":-1}`, false},
+		{"Recursive", `{"$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"},"v":{"type":"number"}}}},"$ref":"#/$defs/node"}`,
+			`{"v":1,"next":{"v":2,"next":{"v":"x"}}}`, false},
+		{"Root", `{"properties":{"child":{"$ref":"#"}},"required":["id"]}`, `{"id":1,"child":{"id":2,"child":{}}}`, false},
+		{"Anchor", `{"$defs":{"s":{"$anchor":"str","type":"string"}},"items":{"$ref":"#str"}}`, `["a","b"]`, true},
+		{"Escaped pointer", `{"$defs":{"a/b":{"type":"number"}},"$ref":"#/$defs/a~1b"}`, `"x"`, false},
+		{"Embedded resource", `{"$id":"https://example.com/root.json","$defs":{"other":{"$id":"other.json","$defs":{"n":{"type":"number"}}}},"$ref":"other.json#/$defs/n"}`, `1`, true},
+		{"Legacy definitions", `{"definitions":{"b":{"type":"boolean"}},"$ref":"#/definitions/b"}`, `1`, false},
+		{"Dynamic ref", `{
+			"$id": "https://example.com/strict-tree",
+			"$dynamicAnchor": "node",
+			"$ref": "tree",
+			"unevaluatedProperties": false,
+			"$defs": {
+				"tree": {
+					"$id": "tree",
+					"$dynamicAnchor": "node",
+					"type": "object",
+					"properties": {
+						"data": true,
+						"children": {"type": "array", "items": {"$dynamicRef": "#node"}}
+					}
+				}
+			}
+		}`, `{"children":[{"daat":1}]}`, false},
+		{"Dynamic ref default", `{
+			"$id": "https://example.com/tree",
+			"$dynamicAnchor": "node",
+			"type": "object",
+			"properties": {"children": {"type": "array", "items": {"$dynamicRef": "#node"}}}
+		}`, `{"children":[{"daat":1}]}`, true},
+	}
+
+	validator := NewValidationUtil()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := CompileSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("CompileSchema() error = %v", err)
+			}
+			var instance interface{}
+			if err := json.Unmarshal([]byte(tt.instance), &instance); err != nil {
+				t.Fatal(err)
+			}
+			if err := validator.Validate(instance, schema); (err == nil) != tt.valid {
+				t.Errorf("Validate() error = %v, valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCompileSchemaErrors(t *testing.T) {
+	for _, schema := range []string{
+		`{"type":5}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$ref":"https://example.com/elsewhere.json"}`,
+		`{"pattern":"("}`,
+		`{"patternProperties":{"[":{}}}`,
+		`[1,2]`,
+	} {
+		if _, err := CompileSchema([]byte(schema)); err == nil {
+			t.Errorf("CompileSchema(%s) succeeded, want error", schema)
+		}
+	}
+}
@@ -61,6 +61,96 @@ func (s *SearchUtil) Search(jsonData, keyword string, opts *SearchOptions) []Sea
 	return results
 }
 
+// SearchNode is Search for a value held in a document, which is walked in
+// place instead of being serialized and parsed again. Members are visited
+// in key order.
+func (s *SearchUtil) SearchNode(root Node, keyword string, opts *SearchOptions) []SearchResult {
+	var results []SearchResult
+	if keyword == "" || opts == nil {
+		return results
+	}
+
+	searchKeyword := keyword
+	if !opts.CaseSensitive {
+		searchKeyword = strings.ToLower(keyword)
+	}
+
+	root.Members(func(key string, value Node) bool {
+		searchMember(key, value, "", searchKeyword, opts, &results)
+		return true
+	})
+	return results
+}
+
+// searchMember matches handleObject for document nodes.
+func searchMember(key string, value Node, parentPath string, keyword string, opts *SearchOptions, results *[]SearchResult) {
+	currentPath := key
+	if parentPath != "" {
+		currentPath = parentPath + "." + key
+	}
+
+	contains := func(s string) bool {
+		if !opts.CaseSensitive {
+			s = strings.ToLower(s)
+		}
+		return strings.Contains(s, keyword)
+	}
+	keyMatch := func() {
+		*results = append(*results, SearchResult{
+			Path:  currentPath,
+			Key:   key,
+			Value: value.Decode(),
+			IsKey: true,
+		})
+	}
+
+	if opts.IncludeKeys && contains(key) {
+		keyMatch()
+	}
+
+	switch value.Kind() {
+	case KindString:
+		valueStr := value.Str()
+		if !contains(valueStr) {
+			break
+		}
+		if opts.IncludeKeys {
+			keyMatch()
+		}
+		if opts.IncludeValues {
+			*results = append(*results, SearchResult{
+				Path:  currentPath,
+				Value: valueStr,
+			})
+		}
+	case KindObject:
+		value.Members(func(k string, v Node) bool {
+			searchMember(k, v, currentPath, keyword, opts, results)
+			return true
+		})
+	case KindArray:
+		value.Elements(func(i int, item Node) bool {
+			arrayPath := fmt.Sprintf("%s[%d]", currentPath, i)
+
+			// For array elements, we only add value matches
+			if opts.IncludeValues && item.Kind() == KindString && contains(item.Str()) {
+				*results = append(*results, SearchResult{
+					Path:  arrayPath,
+					Value: item.Str(),
+				})
+			}
+
+			if item.Kind() == KindObject {
+				item.Members(func(k string, v Node) bool {
+					searchMember(k, v, arrayPath, keyword, opts, results)
+					return true
+				})
+			}
+			return true
+		})
+	}
+}
+
 func handleObject(key, value gjson.Result, parentPath string, keyword string, opts *SearchOptions, results *[]SearchResult) {
 	// Build current path
 	currentPath := key.String()
@@ -113,3 +113,25 @@ func TestSearchUtil_Search(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchUtil_SearchNode(t *testing.T) {
+	// With keys already in order, both searches visit members alike
+	jsonData := `{"a":{"details":"Example details","tags":["example",{"x":"EXAMPLE"},3]},"example":1,"name":"example"}`
+	doc, err := ParseDocument([]byte(jsonData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	util := NewSearchUtil()
+	for _, opts := range []*SearchOptions{
+		{CaseSensitive: false, IncludeKeys: true, IncludeValues: true},
+		{CaseSensitive: true, IncludeKeys: true, IncludeValues: false},
+		{CaseSensitive: false, IncludeKeys: false, IncludeValues: true},
+	} {
+		want := util.Search(jsonData, "example", opts)
+		got := util.SearchNode(doc.Root(), "example", opts)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("SearchNode(%+v) = %+v, want %+v", *opts, got, want)
+		}
+	}
+}
@@ -2,6 +2,11 @@ package json
 
 import (
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // SchemaType represents the type of a JSON value
@@ -10,13 +15,15 @@ type SchemaType string
 const (
 	TypeString  SchemaType = "string"
 	TypeNumber  SchemaType = "number"
+	TypeInteger SchemaType = "integer"
 	TypeBoolean SchemaType = "boolean"
 	TypeArray   SchemaType = "array"
 	TypeObject  SchemaType = "object"
 	TypeNull    SchemaType = "null"
 )
 
-// ValidationError represents a schema validation error
+// ValidationError represents a schema validation error. Path is the
+// normalized JSONPath of the offending value.
 type ValidationError struct {
 	Path    string
 	Message string
@@ -29,20 +36,6 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Path, e.Message)
 }
 
-// Schema represents a JSON schema structure
-type Schema struct {
-	Type       SchemaType         `json:"type"`
-	Properties map[string]*Schema `json:"properties,omitempty"`
-	Required   []string           `json:"required,omitempty"`
-	Items      *Schema            `json:"items,omitempty"`
-	MinLength  *int               `json:"minLength,omitempty"`
-	MaxLength  *int               `json:"maxLength,omitempty"`
-	Minimum    *float64           `json:"minimum,omitempty"`
-	Maximum    *float64           `json:"maximum,omitempty"`
-	Pattern    *string            `json:"pattern,omitempty"`
-	Enum       []interface{}      `json:"enum,omitempty"`
-}
-
 // ValidationUtil provides JSON schema validation functionality
 type ValidationUtil struct{}
 
@@ -51,188 +44,536 @@ func NewValidationUtil() *ValidationUtil {
 	return &ValidationUtil{}
 }
 
-// Validate validates a JSON value against a schema
+// Validate validates a JSON value against a schema, compiling the schema
+// first if needed. Schemas shared between goroutines must be compiled
+// before use.
 func (v *ValidationUtil) Validate(value interface{}, schema *Schema) error {
-	return v.validateWithPath(value, schema, "")
-}
-
-// validateWithPath validates a value at a specific path
-func (v *ValidationUtil) validateWithPath(value interface{}, schema *Schema, path string) error {
 	if schema == nil {
 		return nil
 	}
+	if err := schema.Compile(); err != nil {
+		return err
+	}
+	_, err := (&validator{}).validate(value, schema, "$")
+	return err
+}
 
-	// Handle null values
-	if value == nil {
-		if schema.Type != TypeNull {
-			return &ValidationError{
-				Path:    path,
-				Message: fmt.Sprintf("expected %s, got null", schema.Type),
-			}
+// evaluated records which properties and items of a value the schemas
+// applied so far have evaluated, for unevaluatedProperties and
+// unevaluatedItems.
+type evaluated struct {
+	props    map[string]bool
+	allProps bool
+	items    int // leading items evaluated by prefixItems
+	allItems bool
+	matched  map[int]bool // items evaluated by contains
+}
+
+func (e *evaluated) prop(name string) {
+	if e.props == nil {
+		e.props = make(map[string]bool)
+	}
+	e.props[name] = true
+}
+
+func (e *evaluated) merge(o *evaluated) {
+	if o == nil {
+		return
+	}
+	for name := range o.props {
+		e.prop(name)
+	}
+	e.allProps = e.allProps || o.allProps
+	if o.items > e.items {
+		e.items = o.items
+	}
+	e.allItems = e.allItems || o.allItems
+	for i := range o.matched {
+		if e.matched == nil {
+			e.matched = make(map[int]bool)
 		}
-		return nil
+		e.matched[i] = true
 	}
+}
 
-	// Validate type
-	if err := v.validateType(value, schema, path); err != nil {
-		return err
+// validator evaluates a value against a compiled schema.
+type validator struct {
+	scope []*Schema // dynamic scope: the resources entered, outermost first
+}
+
+func (v *validator) validate(value interface{}, s *Schema, path string) (*evaluated, error) {
+	if s.Always != nil {
+		if !*s.Always {
+			return nil, &ValidationError{Path: path, Message: "no value is allowed here"}
+		}
+		return nil, nil
 	}
 
-	// Type-specific validation
-	switch schema.Type {
-	case TypeObject:
-		return v.validateObject(value, schema, path)
-	case TypeArray:
-		return v.validateArray(value, schema, path)
-	case TypeString:
-		return v.validateString(value, schema, path)
-	case TypeNumber:
-		return v.validateNumber(value, schema, path)
+	if s.resource != nil && (len(v.scope) == 0 || v.scope[len(v.scope)-1] != s.resource) {
+		v.scope = append(v.scope, s.resource)
+		defer func() { v.scope = v.scope[:len(v.scope)-1] }()
 	}
 
-	return nil
+	ev := &evaluated{}
+	if s.ref != nil {
+		sub, err := v.validate(value, s.ref, path)
+		if err != nil {
+			return nil, err
+		}
+		ev.merge(sub)
+	}
+	if s.dynamicRef != nil {
+		sub, err := v.validate(value, v.dynamicTarget(s), path)
+		if err != nil {
+			return nil, err
+		}
+		ev.merge(sub)
+	}
+
+	if err := v.validateValue(value, s, path); err != nil {
+		return nil, err
+	}
+
+	switch val := value.(type) {
+	case []interface{}:
+		if err := v.validateArray(val, s, path, ev); err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		if err := v.validateObject(val, s, path, ev); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := v.validateApplicators(value, s, path, ev); err != nil {
+		return nil, err
+	}
+
+	switch val := value.(type) {
+	case []interface{}:
+		if err := v.validateUnevaluatedItems(val, s, path, ev); err != nil {
+			return nil, err
+		}
+	case map[string]interface{}:
+		if err := v.validateUnevaluatedProperties(val, s, path, ev); err != nil {
+			return nil, err
+		}
+	}
+	return ev, nil
 }
 
-// validateType checks if the value matches the schema type
-func (v *ValidationUtil) validateType(value interface{}, schema *Schema, path string) error {
-	switch schema.Type {
-	case TypeString:
-		if _, ok := value.(string); !ok {
-			return &ValidationError{Path: path, Message: "expected string"}
+// dynamicTarget resolves a $dynamicRef. A reference that statically lands
+// on a matching $dynamicAnchor is redirected to the outermost resource in
+// the dynamic scope declaring the same anchor.
+func (v *validator) dynamicTarget(s *Schema) *Schema {
+	target := s.dynamicRef
+	name := target.DynamicAnchor
+	if name == "" || !strings.HasSuffix(s.DynamicRef, "#"+name) {
+		return target
+	}
+	for _, resource := range v.scope {
+		if anchor, ok := resource.dynamic[name]; ok {
+			return anchor
 		}
-	case TypeNumber:
-		switch value.(type) {
-		case float64, int, int64:
-			// Valid number types
-		default:
-			return &ValidationError{Path: path, Message: "expected number"}
+	}
+	return target
+}
+
+// validateValue checks the keywords that apply to any value: type, enum,
+// const and the numeric and string constraints.
+func (v *validator) validateValue(value interface{}, s *Schema, path string) error {
+	if s.Type != "" || len(s.Types) > 0 {
+		types := s.Types
+		if s.Type != "" {
+			types = []SchemaType{s.Type}
 		}
-	case TypeBoolean:
-		if _, ok := value.(bool); !ok {
-			return &ValidationError{Path: path, Message: "expected boolean"}
+		ok := false
+		for _, t := range types {
+			if hasType(value, t) {
+				ok = true
+				break
+			}
 		}
-	case TypeArray:
-		if _, ok := value.([]interface{}); !ok {
-			return &ValidationError{Path: path, Message: "expected array"}
+		if !ok {
+			want := string(types[0])
+			if len(types) > 1 {
+				want = fmt.Sprintf("one of %v", types)
+			}
+			return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", want, typeName(value))}
 		}
-	case TypeObject:
-		if _, ok := value.(map[string]interface{}); !ok {
-			return &ValidationError{Path: path, Message: "expected object"}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonEqual(value, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ValidationError{Path: path, Message: "value is not one of the enum values"}
 		}
 	}
+	if s.Const != nil && !jsonEqual(value, *s.Const) {
+		return &ValidationError{Path: path, Message: "value does not match const"}
+	}
+
+	if num, ok := toNumber(value); ok {
+		return v.validateNumber(num, s, path)
+	}
+	if str, ok := value.(string); ok {
+		return v.validateString(str, s, path)
+	}
 	return nil
 }
 
-// validateObject validates an object against a schema
-func (v *ValidationUtil) validateObject(value interface{}, schema *Schema, path string) error {
-	obj, ok := value.(map[string]interface{})
-	if !ok {
-		return &ValidationError{Path: path, Message: "expected object"}
+// validateNumber validates a number against schema constraints
+func (v *validator) validateNumber(num float64, s *Schema, path string) error {
+	if s.Minimum != nil && num < *s.Minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number %v is less than minimum %v", num, *s.Minimum)}
+	}
+	if s.Maximum != nil && num > *s.Maximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number %v is greater than maximum %v", num, *s.Maximum)}
 	}
+	if s.ExclusiveMinimum != nil && num <= *s.ExclusiveMinimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number %v must be greater than %v", num, *s.ExclusiveMinimum)}
+	}
+	if s.ExclusiveMaximum != nil && num >= *s.ExclusiveMaximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number %v must be less than %v", num, *s.ExclusiveMaximum)}
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		q := num / *s.MultipleOf
+		if math.IsInf(q, 0) || math.Abs(q-math.Round(q)) > 1e-9 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("number %v is not a multiple of %v", num, *s.MultipleOf)}
+		}
+	}
+	return nil
+}
+
+// validateString validates a string against schema constraints
+func (v *validator) validateString(str string, s *Schema, path string) error {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string length %d is less than minimum %d", length, *s.MinLength)}
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string length %d is greater than maximum %d", length, *s.MaxLength)}
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string does not match pattern %q", *s.Pattern)}
+	}
+	if s.Format != "" && !checkFormat(s.Format, str) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string is not a valid %s", s.Format)}
+	}
+	return nil
+}
 
-	// Check required properties
-	for _, required := range schema.Required {
-		if _, exists := obj[required]; !exists {
-			return &ValidationError{
-				Path:    v.joinPath(path, required),
-				Message: "required property missing",
+// validateArray applies the array keywords and records the items they
+// evaluated.
+func (v *validator) validateArray(arr []interface{}, s *Schema, path string, ev *evaluated) error {
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("array has %d items, expected at least %d", len(arr), *s.MinItems)}
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("array has %d items, expected at most %d", len(arr), *s.MaxItems)}
+	}
+	if s.UniqueItems {
+		for i := 1; i < len(arr); i++ {
+			for j := 0; j < i; j++ {
+				if jsonEqual(arr[i], arr[j]) {
+					return &ValidationError{Path: indexPath(path, i), Message: fmt.Sprintf("duplicate of item %d", j)}
+				}
 			}
 		}
 	}
 
-	// Validate each property
-	for key, val := range obj {
-		propPath := v.joinPath(path, key)
-		if propSchema, ok := schema.Properties[key]; ok {
-			if err := v.validateWithPath(val, propSchema, propPath); err != nil {
+	for i, sub := range s.PrefixItems {
+		if i >= len(arr) {
+			break
+		}
+		if _, err := v.validate(arr[i], sub, indexPath(path, i)); err != nil {
+			return err
+		}
+		if i+1 > ev.items {
+			ev.items = i + 1
+		}
+	}
+	if s.Items != nil {
+		for i := len(s.PrefixItems); i < len(arr); i++ {
+			if err := v.validateItem(arr[i], s.Items, indexPath(path, i), "additional item not allowed"); err != nil {
 				return err
 			}
 		}
+		ev.allItems = true
 	}
 
+	if s.Contains != nil {
+		matched := make(map[int]bool)
+		for i, item := range arr {
+			if _, err := v.validate(item, s.Contains, indexPath(path, i)); err == nil {
+				matched[i] = true
+			}
+		}
+		min := 1
+		if s.MinContains != nil {
+			min = *s.MinContains
+		}
+		if len(matched) < min {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("array contains %d matching items, expected at least %d", len(matched), min)}
+		}
+		if s.MaxContains != nil && len(matched) > *s.MaxContains {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("array contains %d matching items, expected at most %d", len(matched), *s.MaxContains)}
+		}
+		ev.merge(&evaluated{matched: matched})
+	}
 	return nil
 }
 
-// validateArray validates an array against a schema
-func (v *ValidationUtil) validateArray(value interface{}, schema *Schema, path string) error {
-	arr, ok := value.([]interface{})
-	if !ok {
-		return &ValidationError{Path: path, Message: "expected array"}
+// validateObject applies the object keywords and records the properties
+// they evaluated.
+func (v *validator) validateObject(obj map[string]interface{}, s *Schema, path string, ev *evaluated) error {
+	if s.MinProperties != nil && len(obj) < *s.MinProperties {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("object has %d properties, expected at least %d", len(obj), *s.MinProperties)}
+	}
+	if s.MaxProperties != nil && len(obj) > *s.MaxProperties {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("object has %d properties, expected at most %d", len(obj), *s.MaxProperties)}
+	}
+	for _, name := range s.Required {
+		if _, exists := obj[name]; !exists {
+			return &ValidationError{Path: memberPath(path, name), Message: "required property missing"}
+		}
 	}
 
-	// Validate each array item
-	if schema.Items != nil {
-		for i, item := range arr {
-			itemPath := fmt.Sprintf("%s[%d]", path, i)
-			if err := v.validateWithPath(item, schema.Items, itemPath); err != nil {
+	// Visit members in a fixed order so the first error reported is stable
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, required := range s.DependentRequired[name] {
+			if _, exists := obj[required]; !exists {
+				return &ValidationError{Path: memberPath(path, required), Message: fmt.Sprintf("property required by %q is missing", name)}
+			}
+		}
+	}
+
+	for _, name := range names {
+		value, memberAt := obj[name], memberPath(path, name)
+		if s.PropertyNames != nil {
+			if _, err := v.validate(name, s.PropertyNames, memberAt); err != nil {
+				return &ValidationError{Path: memberAt, Message: "invalid property name: " + err.(*ValidationError).Message}
+			}
+		}
+
+		matched := false
+		if sub, ok := s.Properties[name]; ok {
+			if _, err := v.validate(value, sub, memberAt); err != nil {
 				return err
 			}
+			matched = true
+		}
+		for expr, re := range s.patternKeys {
+			if re.MatchString(name) {
+				if _, err := v.validate(value, s.PatternProperties[expr], memberAt); err != nil {
+					return err
+				}
+				matched = true
+			}
+		}
+		if matched {
+			ev.prop(name)
+		} else if s.AdditionalProperties != nil {
+			if err := v.validateItem(value, s.AdditionalProperties, memberAt, "additional property not allowed"); err != nil {
+				return err
+			}
+			ev.prop(name)
 		}
 	}
 
+	for _, name := range names {
+		if sub, ok := s.DependentSchemas[name]; ok {
+			dep, err := v.validate(obj, sub, path)
+			if err != nil {
+				return err
+			}
+			ev.merge(dep)
+		}
+	}
 	return nil
 }
 
-// validateString validates a string against schema constraints
-func (v *ValidationUtil) validateString(value interface{}, schema *Schema, path string) error {
-	str, ok := value.(string)
-	if !ok {
-		return &ValidationError{Path: path, Message: "expected string"}
+// validateItem validates a member against an additional or unevaluated
+// schema, reporting a false schema with message.
+func (v *validator) validateItem(value interface{}, s *Schema, path, message string) error {
+	if s.Always != nil && !*s.Always {
+		return &ValidationError{Path: path, Message: message}
 	}
+	_, err := v.validate(value, s, path)
+	return err
+}
 
-	if schema.MinLength != nil && len(str) < *schema.MinLength {
-		return &ValidationError{
-			Path:    path,
-			Message: fmt.Sprintf("string length %d is less than minimum %d", len(str), *schema.MinLength),
+// validateApplicators applies allOf, anyOf, oneOf, not and if/then/else,
+// merging the annotations of the subschemas that passed.
+func (v *validator) validateApplicators(value interface{}, s *Schema, path string, ev *evaluated) error {
+	for _, sub := range s.AllOf {
+		res, err := v.validate(value, sub, path)
+		if err != nil {
+			return err
 		}
+		ev.merge(res)
 	}
 
-	if schema.MaxLength != nil && len(str) > *schema.MaxLength {
-		return &ValidationError{
-			Path:    path,
-			Message: fmt.Sprintf("string length %d is greater than maximum %d", len(str), *schema.MaxLength),
+	if len(s.AnyOf) > 0 {
+		passed := 0
+		for _, sub := range s.AnyOf {
+			if res, err := v.validate(value, sub, path); err == nil {
+				ev.merge(res)
+				passed++
+			}
+		}
+		if passed == 0 {
+			return &ValidationError{Path: path, Message: "value does not match any schema in anyOf"}
 		}
 	}
 
-	return nil
-}
-
-// validateNumber validates a number against schema constraints
-func (v *ValidationUtil) validateNumber(value interface{}, schema *Schema, path string) error {
-	var num float64
+	if len(s.OneOf) > 0 {
+		var match *evaluated
+		passed := 0
+		for _, sub := range s.OneOf {
+			if res, err := v.validate(value, sub, path); err == nil {
+				match = res
+				passed++
+			}
+		}
+		switch {
+		case passed == 0:
+			return &ValidationError{Path: path, Message: "value does not match any schema in oneOf"}
+		case passed > 1:
+			return &ValidationError{Path: path, Message: fmt.Sprintf("value matches %d schemas in oneOf, expected exactly one", passed)}
+		}
+		ev.merge(match)
+	}
 
-	switch n := value.(type) {
-	case float64:
-		num = n
-	case int:
-		num = float64(n)
-	case int64:
-		num = float64(n)
-	default:
-		return &ValidationError{Path: path, Message: "expected number"}
+	if s.Not != nil {
+		if _, err := v.validate(value, s.Not, path); err == nil {
+			return &ValidationError{Path: path, Message: "value must not match the schema in not"}
+		}
 	}
 
-	if schema.Minimum != nil && num < *schema.Minimum {
-		return &ValidationError{
-			Path:    path,
-			Message: fmt.Sprintf("number %v is less than minimum %v", num, *schema.Minimum),
+	if s.If != nil {
+		if res, err := v.validate(value, s.If, path); err == nil {
+			ev.merge(res)
+			if s.Then != nil {
+				res, err := v.validate(value, s.Then, path)
+				if err != nil {
+					return err
+				}
+				ev.merge(res)
+			}
+		} else if s.Else != nil {
+			res, err := v.validate(value, s.Else, path)
+			if err != nil {
+				return err
+			}
+			ev.merge(res)
 		}
 	}
+	return nil
+}
 
-	if schema.Maximum != nil && num > *schema.Maximum {
-		return &ValidationError{
-			Path:    path,
-			Message: fmt.Sprintf("number %v is greater than maximum %v", num, *schema.Maximum),
+func (v *validator) validateUnevaluatedItems(arr []interface{}, s *Schema, path string, ev *evaluated) error {
+	if s.UnevaluatedItems == nil || ev.allItems {
+		return nil
+	}
+	for i := ev.items; i < len(arr); i++ {
+		if ev.matched[i] {
+			continue
+		}
+		if err := v.validateItem(arr[i], s.UnevaluatedItems, indexPath(path, i), "unevaluated item not allowed"); err != nil {
+			return err
 		}
 	}
+	ev.allItems = true
+	return nil
+}
 
+func (v *validator) validateUnevaluatedProperties(obj map[string]interface{}, s *Schema, path string, ev *evaluated) error {
+	if s.UnevaluatedProperties == nil || ev.allProps {
+		return nil
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		if !ev.props[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := v.validateItem(obj[name], s.UnevaluatedProperties, memberPath(path, name), "unevaluated property not allowed"); err != nil {
+			return err
+		}
+	}
+	ev.allProps = true
 	return nil
 }
 
-// joinPath joins path components
-func (v *ValidationUtil) joinPath(base, key string) string {
-	if base == "" {
-		return key
+// hasType reports whether value is an instance of t. Integers are numbers
+// with a zero fractional part.
+func hasType(value interface{}, t SchemaType) bool {
+	switch t {
+	case TypeNumber:
+		_, ok := toNumber(value)
+		return ok
+	case TypeInteger:
+		n, ok := toNumber(value)
+		return ok && n == math.Trunc(n) && !math.IsInf(n, 0)
+	}
+	return typeName(value) == string(t)
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if _, ok := toNumber(value); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares decoded JSON values, treating numbers by value.
+func jsonEqual(a, b interface{}) bool {
+	return valuesEqual(a, true, b, true)
+}
+
+func indexPath(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// memberPath appends name in dot notation when it is a plain identifier
+// and in bracket notation otherwise.
+func memberPath(path, name string) string {
+	plain := name != ""
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return path + "." + name
 	}
-	return base + "." + key
+	return path + "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "']"
 }
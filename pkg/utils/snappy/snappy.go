@@ -0,0 +1,238 @@
+// Package snappy implements the Snappy block format, the compression of
+// Prometheus remote write and remote read bodies.
+// Reference: https://github.com/google/snappy/blob/main/format_description.txt
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	// ErrCorrupt is returned when the input is not valid Snappy data
+	ErrCorrupt = errors.New("snappy: corrupt input")
+	// ErrTooLarge is returned when the decoded data would be too large
+	ErrTooLarge = errors.New("snappy: decoded block is too large")
+)
+
+// Element tags, in the low two bits of the tag byte
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+)
+
+const (
+	// maxDecodedLen bounds the allocation a header can ask for
+	maxDecodedLen = 1<<32 - 1
+	// blockSize is the span input is compressed in, so offsets fit in two
+	// bytes
+	blockSize = 1 << 16
+	// minMatch is the shortest match worth a copy
+	minMatch = 4
+	hashBits = 14
+)
+
+// DecodedLen returns the length of the decoded form of src.
+func DecodedLen(src []byte) (int, error) {
+	n, _, err := decodedLen(src)
+	return n, err
+}
+
+func decodedLen(src []byte) (int, int, error) {
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > 0xffffffff {
+		return 0, 0, ErrCorrupt
+	}
+	if v > maxDecodedLen || uint64(int(v)) != v {
+		return 0, 0, ErrTooLarge
+	}
+	return int(v), n, nil
+}
+
+// Decode returns the decoded form of src.
+func Decode(src []byte) ([]byte, error) {
+	length, s, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	dst := make([]byte, 0, length)
+
+	for s < len(src) {
+		tag := src[s]
+		s++
+		switch tag & 0x03 {
+		case tagLiteral:
+			n := int(tag >> 2)
+			if n >= 60 {
+				// 60 to 63 give the length in the next 1 to 4 bytes
+				width := n - 59
+				if s+width > len(src) {
+					return nil, ErrCorrupt
+				}
+				n = 0
+				for i := width - 1; i >= 0; i-- {
+					n = n<<8 | int(src[s+i])
+				}
+				s += width
+			}
+			n++
+			if n <= 0 || n > len(src)-s || n > length-len(dst) {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[s:s+n]...)
+			s += n
+			continue
+
+		case tagCopy1:
+			if s >= len(src) {
+				return nil, ErrCorrupt
+			}
+			n := 4 + int(tag>>2&0x07)
+			offset := int(tag&0xe0)<<3 | int(src[s])
+			s++
+			if dst, err = copyBack(dst, offset, n, length); err != nil {
+				return nil, err
+			}
+
+		case tagCopy2:
+			if s+2 > len(src) {
+				return nil, ErrCorrupt
+			}
+			n := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[s:]))
+			s += 2
+			if dst, err = copyBack(dst, offset, n, length); err != nil {
+				return nil, err
+			}
+
+		case tagCopy4:
+			if s+4 > len(src) {
+				return nil, ErrCorrupt
+			}
+			n := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[s:]))
+			s += 4
+			if dst, err = copyBack(dst, offset, n, length); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(dst) != length {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
+
+// copyBack appends n bytes starting offset bytes back from the end of dst.
+// The copy may overlap what it appends, repeating the last offset bytes.
+func copyBack(dst []byte, offset, n, length int) ([]byte, error) {
+	if offset <= 0 || offset > len(dst) || n > length-len(dst) {
+		return nil, ErrCorrupt
+	}
+	start := len(dst) - offset
+	for i := 0; i < n; i++ {
+		dst = append(dst, dst[start+i])
+	}
+	return dst, nil
+}
+
+// Encode returns the encoded form of src.
+func Encode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, MaxEncodedLen(len(src))), uint64(len(src)))
+	for len(src) > 0 {
+		block := src
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		src = src[len(block):]
+		dst = encodeBlock(dst, block)
+	}
+	return dst
+}
+
+// MaxEncodedLen returns the largest length the encoded form of n bytes
+// may take.
+func MaxEncodedLen(n int) int {
+	return 32 + n + n/6
+}
+
+// encodeBlock appends the encoded form of a block of at most blockSize
+// bytes to dst. It looks up every four byte sequence in a hash table of
+// the positions it was last seen at and turns the matches into copies.
+func encodeBlock(dst, src []byte) []byte {
+	if len(src) < minMatch+1 {
+		return emitLiteral(dst, src)
+	}
+
+	var table [1 << hashBits]int32
+	for i := range table {
+		table[i] = -1
+	}
+
+	literal := 0
+	s := 0
+	for s+minMatch <= len(src) {
+		h := hash(binary.LittleEndian.Uint32(src[s:]))
+		candidate := int(table[h])
+		table[h] = int32(s)
+		if candidate < 0 || binary.LittleEndian.Uint32(src[candidate:]) != binary.LittleEndian.Uint32(src[s:]) {
+			s++
+			continue
+		}
+
+		dst = emitLiteral(dst, src[literal:s])
+		n := minMatch
+		for s+n < len(src) && src[candidate+n] == src[s+n] {
+			n++
+		}
+		dst = emitCopy(dst, s-candidate, n)
+		s += n
+		literal = s
+	}
+	return emitLiteral(dst, src[literal:])
+}
+
+func hash(v uint32) uint32 {
+	return v * 0x1e35a7bd >> (32 - hashBits)
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// emitCopy appends copies of n bytes from offset bytes back. A copy holds
+// at most 64 bytes, and a one byte offset copy 4 to 11 bytes.
+func emitCopy(dst []byte, offset, n int) []byte {
+	for n >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		n -= 64
+	}
+	if n > 64 {
+		// Leave at least 4 bytes for the last copy
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		n -= 60
+	}
+	if n >= 12 || offset >= 2048 {
+		return append(dst, byte(n-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(n-4)<<2|tagCopy1, byte(offset))
+}
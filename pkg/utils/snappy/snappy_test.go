@@ -0,0 +1,95 @@
+package snappy_test
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/genc-murat/crystalcache/pkg/utils/snappy"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{"empty", "\x00", ""},
+		{"literal", "\x05\x10hello", "hello"},
+		{"one byte offset copy", "\x0c\x08abc\x15\x03", "abcabcabcabc"},
+		{"two byte offset copy", "\x15\x00a\x4e\x01\x00", strings.Repeat("a", 21)},
+		{"four byte offset copy", "\x08\x0cabcd\x0f\x04\x00\x00\x00", "abcdabcd"},
+		{"long literal", "\x3d\xf0\x3cxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx", strings.Repeat("x", 61)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := snappy.Decode([]byte(tt.encoded))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Decode() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"no header", ""},
+		{"short", "\x06\x10hello"},
+		{"long", "\x04\x10hello"},
+		{"truncated literal", "\x05\x10hel"},
+		{"offset before start", "\x08\x08abc\x05\x04"},
+		{"zero offset", "\x07\x08abc\x01\x00"},
+		{"truncated copy", "\x07\x08abc\x02\x03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := snappy.Decode([]byte(tt.encoded)); err != snappy.ErrCorrupt {
+				t.Errorf("Decode() error = %v; want %v", err, snappy.ErrCorrupt)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	repetitive := bytes.Repeat([]byte("cpu_usage{host=\"a\"} "), 10000)
+
+	for name, src := range map[string][]byte{
+		"empty":      nil,
+		"short":      []byte("abc"),
+		"random":     random,
+		"repetitive": repetitive,
+	} {
+		t.Run(name, func(t *testing.T) {
+			encoded := snappy.Encode(src)
+			if len(encoded) > snappy.MaxEncodedLen(len(src)) {
+				t.Errorf("len(Encode()) = %d; want at most %d", len(encoded), snappy.MaxEncodedLen(len(src)))
+			}
+			n, err := snappy.DecodedLen(encoded)
+			if err != nil || n != len(src) {
+				t.Errorf("DecodedLen() = %d, %v; want %d", n, err, len(src))
+			}
+			decoded, err := snappy.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !bytes.Equal(decoded, src) {
+				t.Errorf("Decode(Encode()) differs from the input")
+			}
+		})
+	}
+
+	if encoded := snappy.Encode(repetitive); len(encoded) > len(repetitive)/20 {
+		t.Errorf("len(Encode()) = %d for %d repetitive bytes", len(encoded), len(repetitive))
+	}
+}